@@ -0,0 +1,155 @@
+// Package aqmctx defines the typed context keys that carry request metadata
+// (request ID, tenant, session, claims, logger) through aqm services, and
+// snapshots that copy that metadata onto a fresh context for work that must
+// outlive the request.
+package aqmctx
+
+import (
+	"context"
+	"sync"
+)
+
+// Key is a typed context key. Values stored with a Key created by NewKey are
+// request metadata and are copied by Snapshot.
+type Key[T any] struct {
+	name string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []carrier
+)
+
+type carrier interface {
+	capture(src context.Context) (func(context.Context) context.Context, bool)
+}
+
+// NewKey returns a key for values of type T and registers it so Snapshot
+// carries its value. name is informational and need not be unique.
+func NewKey[T any](name string) *Key[T] {
+	k := &Key[T]{name: name}
+	registryMu.Lock()
+	registry = append(registry, k)
+	registryMu.Unlock()
+	return k
+}
+
+// Name returns the name given to NewKey.
+func (k *Key[T]) Name() string {
+	return k.name
+}
+
+// With returns a copy of ctx holding value under k.
+func (k *Key[T]) With(ctx context.Context, value T) context.Context {
+	if ctx == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, k, value)
+}
+
+// From returns the value stored under k and whether one was found.
+func (k *Key[T]) From(ctx context.Context) (T, bool) {
+	var zero T
+	if ctx == nil {
+		return zero, false
+	}
+	value, ok := ctx.Value(k).(T)
+	return value, ok
+}
+
+func (k *Key[T]) capture(src context.Context) (func(context.Context) context.Context, bool) {
+	value, ok := k.From(src)
+	if !ok {
+		return nil, false
+	}
+	return func(ctx context.Context) context.Context { return k.With(ctx, value) }, true
+}
+
+// Metadata is the request metadata captured from a context by Snapshot.
+type Metadata struct {
+	apply []func(context.Context) context.Context
+}
+
+// Snapshot captures the values of every registered key in ctx. Only values are
+// kept: the deadline and cancellation of ctx do not reach Restore.
+func Snapshot(ctx context.Context) Metadata {
+	if ctx == nil {
+		return Metadata{}
+	}
+	registryMu.RLock()
+	keys := append([]carrier(nil), registry...)
+	registryMu.RUnlock()
+
+	var m Metadata
+	for _, key := range keys {
+		if apply, ok := key.capture(ctx); ok {
+			m.apply = append(m.apply, apply)
+		}
+	}
+	return m
+}
+
+// Len returns the number of values captured.
+func (m Metadata) Len() int {
+	return len(m.apply)
+}
+
+// Restore copies the captured metadata onto ctx, typically
+// context.Background() or a context owned by a background task.
+func (m Metadata) Restore(ctx context.Context) context.Context {
+	if ctx == nil {
+		return ctx
+	}
+	for _, apply := range m.apply {
+		ctx = apply(ctx)
+	}
+	return ctx
+}
+
+var (
+	requestIDKey = NewKey[string]("request_id")
+	tenantKey    = NewKey[string]("tenant")
+	sessionKey   = NewKey[string]("session")
+)
+
+// WithRequestID stores the request ID. Empty IDs are ignored.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return requestIDKey.With(ctx, id)
+}
+
+// RequestIDFrom returns the request ID, or "" when none was stored.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := requestIDKey.From(ctx)
+	return id
+}
+
+// WithTenant stores the tenant ID. Empty IDs are ignored.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return tenantKey.With(ctx, tenant)
+}
+
+// TenantFrom returns the tenant ID, or "" when none was stored.
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := tenantKey.From(ctx)
+	return tenant
+}
+
+// WithSession stores the session ID. Empty IDs are ignored.
+func WithSession(ctx context.Context, session string) context.Context {
+	if session == "" {
+		return ctx
+	}
+	return sessionKey.With(ctx, session)
+}
+
+// SessionFrom returns the session ID, or "" when none was stored.
+func SessionFrom(ctx context.Context) string {
+	session, _ := sessionKey.From(ctx)
+	return session
+}
@@ -0,0 +1,151 @@
+package aqmctx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestKeyWithFrom(t *testing.T) {
+	key := NewKey[int]("answer")
+	if key.Name() != "answer" {
+		t.Errorf("Name = %q", key.Name())
+	}
+
+	ctx := context.Background()
+	if _, ok := key.From(ctx); ok {
+		t.Fatal("expected no value")
+	}
+	ctx = key.With(ctx, 42)
+	if got, ok := key.From(ctx); !ok || got != 42 {
+		t.Errorf("From = %d, %v", got, ok)
+	}
+
+	other := NewKey[int]("answer")
+	if _, ok := other.From(ctx); ok {
+		t.Error("keys with the same name must not collide")
+	}
+	if key.With(nil, 1) != nil {
+		t.Error("nil ctx should stay nil")
+	}
+	if _, ok := key.From(nil); ok {
+		t.Error("nil ctx should report no value")
+	}
+}
+
+func TestStringAccessors(t *testing.T) {
+	tests := []struct {
+		name string
+		with func(context.Context, string) context.Context
+		from func(context.Context) string
+	}{
+		{name: "requestID", with: WithRequestID, from: RequestIDFrom},
+		{name: "tenant", with: WithTenant, from: TenantFrom},
+		{name: "session", with: WithSession, from: SessionFrom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if got := tt.from(ctx); got != "" {
+				t.Errorf("empty ctx returned %q", got)
+			}
+			if tt.with(ctx, "") != ctx {
+				t.Error("empty value should return ctx unchanged")
+			}
+			if got := tt.from(tt.with(ctx, "abc")); got != "abc" {
+				t.Errorf("got %q, want abc", got)
+			}
+		})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	custom := NewKey[[]string]("roles")
+
+	parent, cancel := context.WithTimeout(context.Background(), time.Minute)
+	ctx := WithRequestID(parent, "req-1")
+	ctx = WithTenant(ctx, "acme")
+	ctx = custom.With(ctx, []string{"admin"})
+
+	snap := Snapshot(ctx)
+	cancel()
+
+	if snap.Len() != 3 {
+		t.Errorf("Len = %d, want 3", snap.Len())
+	}
+
+	restored := snap.Restore(context.Background())
+	if err := restored.Err(); err != nil {
+		t.Errorf("restored ctx inherited cancellation: %v", err)
+	}
+	if _, ok := restored.Deadline(); ok {
+		t.Error("restored ctx inherited deadline")
+	}
+	if RequestIDFrom(restored) != "req-1" || TenantFrom(restored) != "acme" {
+		t.Errorf("metadata lost: %q %q", RequestIDFrom(restored), TenantFrom(restored))
+	}
+	if roles, _ := custom.From(restored); len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("custom key lost: %v", roles)
+	}
+	if SessionFrom(restored) != "" {
+		t.Error("unset keys should stay unset")
+	}
+
+	if Snapshot(nil).Len() != 0 {
+		t.Error("nil ctx snapshot should be empty")
+	}
+	if (Metadata{}).Restore(nil) != nil {
+		t.Error("restore onto nil should return nil")
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	cases := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{"direct client headers ignored", "203.0.113.9:4000", []string{"1.2.3.4"}, "5.6.7.8", "203.0.113.9"},
+		{"behind trusted proxy", "10.0.0.2:4000", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"spoofed leftmost entry skipped", "10.0.0.2:4000", []string{"1.2.3.4, 198.51.100.7, 10.0.0.3"}, "", "198.51.100.7"},
+		{"multiple headers", "10.0.0.2:4000", []string{"1.2.3.4", "198.51.100.7"}, "", "198.51.100.7"},
+		{"x-real-ip from trusted proxy", "10.0.0.2:4000", nil, "198.51.100.8", "198.51.100.8"},
+		{"only trusted hops", "10.0.0.2:4000", []string{"10.0.0.5"}, "", "10.0.0.5"},
+		{"no headers", "10.0.0.2:4000", nil, "", "10.0.0.2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := ResolveClientIP(r, trusted); got != tc.want {
+				t.Errorf("ResolveClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.9:4000"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := ClientIP(r); got != "203.0.113.9" {
+		t.Errorf("ClientIP = %q, want the peer", got)
+	}
+	r = r.WithContext(WithClientIP(r.Context(), "198.51.100.7"))
+	if got := ClientIP(r); got != "198.51.100.7" {
+		t.Errorf("ClientIP = %q, want the resolved address", got)
+	}
+}
@@ -0,0 +1,93 @@
+package aqmctx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var clientIPKey = NewKey[string]("client_ip")
+
+// WithClientIP stores the client IP resolved for the request. Empty values
+// are ignored.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	if ip == "" {
+		return ctx
+	}
+	return clientIPKey.With(ctx, ip)
+}
+
+// ClientIPFrom returns the stored client IP, or "" when none was stored.
+func ClientIPFrom(ctx context.Context) string {
+	ip, _ := clientIPKey.From(ctx)
+	return ip
+}
+
+// ClientIP returns the address of the client that sent r: the one stored
+// by a trusted-proxy-aware middleware such as middleware.ClientIP, or the
+// peer of the connection. It never reads forwarding headers itself, so a
+// client cannot pick its own address to dodge rate limits, lockouts or
+// audit trails.
+func ClientIP(r *http.Request) string {
+	if ip := ClientIPFrom(r.Context()); ip != "" {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// ResolveClientIP returns the client address of r, believing the
+// X-Forwarded-For and X-Real-IP headers only when the peer is one of the
+// trusted proxies. X-Forwarded-For is walked from the right, skipping
+// trusted hops, so entries a client prepended are ignored.
+func ResolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer := peerIP(r)
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	first := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		first = addr.Unmap().String()
+		if !isTrusted(first, trusted) {
+			return first
+		}
+	}
+	if first != "" {
+		return first
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return peer
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
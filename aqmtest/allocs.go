@@ -0,0 +1,22 @@
+package aqmtest
+
+import "testing"
+
+// allocRuns is how many calls the average allocation count is taken over.
+const allocRuns = 100
+
+// AllocBudget fails tb when fn allocates more than budget objects per call
+// on average. Guard hot paths with it so a redesign for speed, or a change
+// that quietly undoes one, shows up as a failing test rather than in
+// production profiles. It skips under the race detector, which allocates
+// on its own.
+func AllocBudget(tb testing.TB, budget float64, fn func()) {
+	tb.Helper()
+	if raceEnabled {
+		tb.Skip("allocation budgets are not checked under the race detector")
+		return
+	}
+	if allocs := testing.AllocsPerRun(allocRuns, fn); allocs > budget {
+		tb.Errorf("allocation budget exceeded: %.1f allocs per call, budget %.1f", allocs, budget)
+	}
+}
@@ -0,0 +1,45 @@
+package aqmtest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// budgetTB records failures instead of failing the enclosing test.
+type budgetTB struct {
+	testing.TB
+	failure string
+	skipped bool
+}
+
+func (tb *budgetTB) Helper() {}
+
+func (tb *budgetTB) Errorf(format string, args ...any) {
+	tb.failure = fmt.Sprintf(format, args...)
+}
+
+func (tb *budgetTB) Skip(...any) {
+	tb.skipped = true
+}
+
+var sink []byte
+
+func TestAllocBudget(t *testing.T) {
+	within := &budgetTB{TB: t}
+	AllocBudget(within, 1, func() {})
+	if within.failure != "" {
+		t.Errorf("unexpected failure %q", within.failure)
+	}
+
+	over := &budgetTB{TB: t}
+	AllocBudget(over, 1, func() {
+		sink = make([]byte, 64)
+		sink = make([]byte, 64)
+	})
+	if over.skipped {
+		t.Skip("allocation budgets are not checked under the race detector")
+	}
+	if over.failure == "" {
+		t.Error("expected the exceeded budget to fail")
+	}
+}
@@ -0,0 +1,144 @@
+package aqmtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/events"
+)
+
+var (
+	_ events.Publisher     = (*Bus)(nil)
+	_ events.Subscriber    = (*Bus)(nil)
+	_ events.Stream        = (*BusStream)(nil)
+	_ events.CursorFetcher = (*BusStream)(nil)
+)
+
+// Bus is an in-memory event transport. Every topic keeps its full history as
+// a stream with sequences starting at 1, and subscribers are called
+// synchronously from Publish, so tests see the effects of an event as soon
+// as it is published.
+type Bus struct {
+	mu     sync.Mutex
+	topics map[string]*busTopic
+	nextID int
+}
+
+type busTopic struct {
+	msgs []events.StreamMessage
+	subs map[int]events.HandlerFunc
+}
+
+// NewBus builds an empty bus.
+func NewBus() *Bus {
+	return &Bus{topics: make(map[string]*busTopic)}
+}
+
+func (b *Bus) topic(name string) *busTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &busTopic{subs: make(map[int]events.HandlerFunc)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Publish implements events.Publisher. It returns the joined errors of the
+// subscribers; the message is stored either way.
+func (b *Bus) Publish(ctx context.Context, topic string, msg []byte) error {
+	data := append([]byte(nil), msg...)
+	b.mu.Lock()
+	t := b.topic(topic)
+	t.msgs = append(t.msgs, events.StreamMessage{
+		Data:      data,
+		Sequence:  uint64(len(t.msgs) + 1),
+		Timestamp: time.Now().UnixNano(),
+	})
+	subs := make([]events.HandlerFunc, 0, len(t.subs))
+	for _, sub := range t.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	var errs error
+	for _, sub := range subs {
+		errs = errors.Join(errs, sub(ctx, data))
+	}
+	return errs
+}
+
+// Subscribe implements events.Subscriber. The handler receives messages
+// published after the call until ctx is done.
+func (b *Bus) Subscribe(ctx context.Context, topic string, handler events.HandlerFunc) error {
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.topic(topic).subs[id] = handler
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.topics[topic].subs, id)
+		b.mu.Unlock()
+	}()
+	return nil
+}
+
+// Messages returns the payloads published to topic so far.
+func (b *Bus) Messages(topic string) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topic]
+	if !ok {
+		return nil
+	}
+	out := make([][]byte, len(t.msgs))
+	for i, msg := range t.msgs {
+		out[i] = msg.Data
+	}
+	return out
+}
+
+// Stream returns topic as a persistent stream, suitable for events.Consume.
+func (b *Bus) Stream(topic string) *BusStream {
+	return &BusStream{bus: b, topic: topic}
+}
+
+// BusStream is one topic of a Bus seen as an events.Stream.
+type BusStream struct {
+	bus   *Bus
+	topic string
+}
+
+// Publish implements events.Publisher by publishing to the stream topic.
+func (s *BusStream) Publish(ctx context.Context, _ string, msg []byte) error {
+	return s.bus.Publish(ctx, s.topic, msg)
+}
+
+// Fetch implements events.StreamConsumer.
+func (s *BusStream) Fetch(ctx context.Context, limit int) ([]events.StreamMessage, error) {
+	return s.FetchAfter(ctx, 0, limit)
+}
+
+// FetchAfter implements events.CursorFetcher.
+func (s *BusStream) FetchAfter(_ context.Context, seq uint64, limit int) ([]events.StreamMessage, error) {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	t, ok := s.bus.topics[s.topic]
+	if !ok || seq >= uint64(len(t.msgs)) {
+		return nil, nil
+	}
+	msgs := t.msgs[seq:]
+	if limit > 0 && limit < len(msgs) {
+		msgs = msgs[:limit]
+	}
+	return append([]events.StreamMessage(nil), msgs...), nil
+}
+
+// SubscribeStream implements events.StreamConsumer.
+func (s *BusStream) SubscribeStream(ctx context.Context, handler events.HandlerFunc) error {
+	return s.bus.Subscribe(ctx, s.topic, handler)
+}
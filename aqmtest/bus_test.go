@@ -0,0 +1,85 @@
+package aqmtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/events"
+)
+
+func TestBusSubscribeAndHistory(t *testing.T) {
+	bus := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var got []string
+	_ = bus.Subscribe(ctx, "orders", func(_ context.Context, msg []byte) error {
+		got = append(got, string(msg))
+		return nil
+	})
+	_ = bus.Publish(context.Background(), "orders", []byte("a"))
+	_ = bus.Publish(context.Background(), "payments", []byte("x"))
+	_ = bus.Publish(context.Background(), "orders", []byte("b"))
+
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("subscriber got %v, want [a b]", got)
+	}
+	if msgs := bus.Messages("orders"); len(msgs) != 2 {
+		t.Fatalf("history = %d messages, want 2", len(msgs))
+	}
+
+	cancel()
+	Eventually(t, time.Second, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.topics["orders"].subs) == 0
+	}, "subscriber removed after cancel")
+	_ = bus.Publish(context.Background(), "orders", []byte("c"))
+	if len(got) != 2 {
+		t.Fatalf("cancelled subscriber got %v", got)
+	}
+}
+
+func TestBusPublishReturnsSubscriberErrors(t *testing.T) {
+	bus := NewBus()
+	boom := errors.New("boom")
+	_ = bus.Subscribe(context.Background(), "orders", func(context.Context, []byte) error { return boom })
+
+	if err := bus.Publish(context.Background(), "orders", []byte("a")); !errors.Is(err, boom) {
+		t.Fatalf("Publish error = %v, want %v", err, boom)
+	}
+	if len(bus.Messages("orders")) != 1 {
+		t.Fatal("message should be stored even when a subscriber fails")
+	}
+}
+
+func TestBusStreamWithConsume(t *testing.T) {
+	bus := NewBus()
+	stream := bus.Stream("orders")
+	for _, m := range []string{"a", "b", "c"} {
+		_ = stream.Publish(context.Background(), "", []byte(m))
+	}
+
+	msgs, _ := stream.FetchAfter(context.Background(), 1, 1)
+	if len(msgs) != 1 || msgs[0].Sequence != 2 || string(msgs[0].Data) != "b" {
+		t.Fatalf("FetchAfter(1, 1) = %+v", msgs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store := events.NewMemoryCursorStore()
+	var got []string
+	err := events.Consume(ctx, stream, store, func(_ context.Context, msg []byte) error {
+		got = append(got, string(msg))
+		if len(got) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if seq, _, _ := store.LoadCursor(context.Background(), "default"); seq != 3 {
+		t.Fatalf("cursor = %d, want 3", seq)
+	}
+}
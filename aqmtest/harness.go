@@ -0,0 +1,83 @@
+package aqmtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+// Harness runs several services inside one test, connected through an
+// in-memory Bus. Everything it starts is stopped when the test ends.
+type Harness struct {
+	Bus *Bus
+
+	tb     testing.TB
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHarness builds a harness tied to the lifetime of tb.
+func NewHarness(tb testing.TB) *Harness {
+	tb.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Harness{Bus: NewBus(), tb: tb, ctx: ctx, cancel: cancel}
+	tb.Cleanup(func() {
+		h.cancel()
+		h.wg.Wait()
+	})
+	return h
+}
+
+// Context returns a context cancelled when the test ends.
+func (h *Harness) Context() context.Context {
+	return h.ctx
+}
+
+// Serve starts an HTTP server for handler and returns its base URL.
+func (h *Harness) Serve(handler http.Handler) string {
+	server := httptest.NewServer(handler)
+	h.tb.Cleanup(server.Close)
+	return server.URL
+}
+
+// ServeModules mounts modules on a chi router and serves it like Serve.
+func (h *Harness) ServeModules(modules ...aqm.HTTPModule) string {
+	router := chi.NewRouter()
+	for _, module := range modules {
+		module.RegisterRoutes(router)
+	}
+	return h.Serve(router)
+}
+
+// Go runs fn in the background until the test ends, failing the test when
+// it returns an error other than context.Canceled.
+func (h *Harness) Go(name string, fn func(ctx context.Context) error) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		if err := fn(h.ctx); err != nil && !errors.Is(err, context.Canceled) {
+			h.tb.Errorf("%s stopped: %v", name, err)
+		}
+	}()
+}
+
+// Eventually polls cond until it holds or timeout passes, failing the test
+// with msg in the latter case.
+func Eventually(tb testing.TB, timeout time.Duration, cond func() bool, msg string) {
+	tb.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("condition not met after %s: %s", timeout, msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,45 @@
+package aqmtest
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type pingModule struct{}
+
+func (pingModule) RegisterRoutes(r chi.Router) {
+	r.Get("/ping", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestHarnessServesModulesAndRunsWorkers(t *testing.T) {
+	h := NewHarness(t)
+	url := h.ServeModules(pingModule{})
+
+	resp, err := http.Get(url + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", resp.StatusCode)
+	}
+
+	var handled atomic.Int32
+	h.Go("worker", func(ctx context.Context) error {
+		return h.Bus.Subscribe(ctx, "pings", func(context.Context, []byte) error {
+			handled.Add(1)
+			return nil
+		})
+	})
+	Eventually(t, time.Second, func() bool {
+		_ = h.Bus.Publish(h.Context(), "pings", []byte("{}"))
+		return handled.Load() > 0
+	}, "worker receives published events")
+}
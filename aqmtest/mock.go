@@ -0,0 +1,265 @@
+// Package aqmtest provides test helpers for services built with aqm.
+package aqmtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+// Mock is a stubbed downstream service answering with the standard aqm
+// SuccessResponse and ErrorResponse envelopes, ready for ServiceClient.
+type Mock struct {
+	URL string
+
+	server *httptest.Server
+	mu     sync.Mutex
+	stubs  []*Stub
+	calls  []*http.Request
+}
+
+// MockService starts a mock service. Callers must Close it, usually with
+// defer or t.Cleanup.
+func MockService() *Mock {
+	m := &Mock{}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serve))
+	m.URL = m.server.URL
+	return m
+}
+
+// Close shuts the server down.
+func (m *Mock) Close() {
+	m.server.Close()
+}
+
+// Client returns a ServiceClient pointed at the mock.
+func (m *Mock) Client(opts ...aqm.ServiceClientOption) *aqm.ServiceClient {
+	return aqm.NewServiceClient(m.URL, opts...)
+}
+
+// On stubs requests with method and path. Path may contain {param}
+// placeholders matching any single segment.
+func (m *Mock) On(method, path string) *Stub {
+	stub := &Stub{method: strings.ToUpper(method), path: path, status: http.StatusOK}
+	m.mu.Lock()
+	m.stubs = append(m.stubs, stub)
+	m.mu.Unlock()
+	return stub
+}
+
+// OnList stubs GET /{resource}.
+func (m *Mock) OnList(resource string) *Stub {
+	return m.On(http.MethodGet, "/"+resource)
+}
+
+// OnGet stubs GET /{resource}/{id}.
+func (m *Mock) OnGet(resource, id string) *Stub {
+	return m.On(http.MethodGet, "/"+resource+"/"+id)
+}
+
+// OnCreate stubs POST /{resource}, answering 201 by default.
+func (m *Mock) OnCreate(resource string) *Stub {
+	stub := m.On(http.MethodPost, "/"+resource)
+	stub.status = http.StatusCreated
+	return stub
+}
+
+// OnUpdate stubs PATCH /{resource}/{id}.
+func (m *Mock) OnUpdate(resource, id string) *Stub {
+	return m.On(http.MethodPatch, "/"+resource+"/"+id)
+}
+
+// OnDelete stubs DELETE /{resource}/{id}, answering 204 by default.
+func (m *Mock) OnDelete(resource, id string) *Stub {
+	stub := m.On(http.MethodDelete, "/"+resource+"/"+id)
+	stub.status = http.StatusNoContent
+	return stub
+}
+
+// Calls returns how many requests matched method and path.
+func (m *Mock) Calls(method, path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, req := range m.calls {
+		if req.Method == strings.ToUpper(method) && matchPath(path, req.URL.Path) {
+			count++
+		}
+	}
+	return count
+}
+
+// Reset removes every stub and recorded call.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stubs, m.calls = nil, nil
+}
+
+func (m *Mock) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	m.mu.Lock()
+	m.calls = append(m.calls, r)
+	var stub *Stub
+	// Later stubs take precedence so tests can override defaults.
+	for i := len(m.stubs) - 1; i >= 0; i-- {
+		if m.stubs[i].matches(r, body) {
+			stub = m.stubs[i]
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if stub == nil {
+		aqm.Error(w, http.StatusNotImplemented, "not_stubbed", fmt.Sprintf("no stub for %s %s", r.Method, r.URL.RequestURI()))
+		return
+	}
+	stub.respond(w, r)
+}
+
+// Stub is a canned response with optional matchers and fault injection.
+type Stub struct {
+	method   string
+	path     string
+	headers  map[string]string
+	query    map[string]string
+	bodyFunc func(map[string]any) bool
+
+	status  int
+	data    any
+	meta    any
+	links   []aqm.Link
+	errCode string
+	errMsg  string
+	latency time.Duration
+}
+
+// WithHeader only matches requests carrying header key with value.
+func (s *Stub) WithHeader(key, value string) *Stub {
+	if s.headers == nil {
+		s.headers = make(map[string]string)
+	}
+	s.headers[key] = value
+	return s
+}
+
+// WithQuery only matches requests with query parameter key set to value.
+func (s *Stub) WithQuery(key, value string) *Stub {
+	if s.query == nil {
+		s.query = make(map[string]string)
+	}
+	s.query[key] = value
+	return s
+}
+
+// WithBody only matches requests whose JSON object body satisfies match.
+func (s *Stub) WithBody(match func(body map[string]any) bool) *Stub {
+	s.bodyFunc = match
+	return s
+}
+
+// WithLatency delays the response, e.g. to exercise client timeouts.
+func (s *Stub) WithLatency(d time.Duration) *Stub {
+	s.latency = d
+	return s
+}
+
+// Return answers with data in the success envelope and the stub status.
+func (s *Stub) Return(data any) *Stub {
+	s.data = data
+	return s
+}
+
+// ReturnPage answers with data, meta and links, e.g. for pagination.
+func (s *Stub) ReturnPage(data, meta any, links ...aqm.Link) *Stub {
+	s.data, s.meta, s.links = data, meta, links
+	return s
+}
+
+// ReturnStatus overrides the response status.
+func (s *Stub) ReturnStatus(status int) *Stub {
+	s.status = status
+	return s
+}
+
+// ReturnError answers with the error envelope.
+func (s *Stub) ReturnError(status int, code, message string) *Stub {
+	s.status, s.errCode, s.errMsg = status, code, message
+	return s
+}
+
+func (s *Stub) matches(r *http.Request, body []byte) bool {
+	if s.method != r.Method || !matchPath(s.path, r.URL.Path) {
+		return false
+	}
+	for key, value := range s.headers {
+		if r.Header.Get(key) != value {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for key, value := range s.query {
+		if query.Get(key) != value {
+			return false
+		}
+	}
+	if s.bodyFunc != nil {
+		var decoded map[string]any
+		if err := json.Unmarshal(body, &decoded); err != nil || !s.bodyFunc(decoded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Stub) respond(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if s.errCode != "" || s.status >= http.StatusBadRequest {
+		code := s.errCode
+		if code == "" {
+			code = http.StatusText(s.status)
+		}
+		aqm.Error(w, s.status, code, s.errMsg)
+		return
+	}
+	if s.status == http.StatusNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s.status)
+	json.NewEncoder(w).Encode(aqm.SuccessResponse{Data: s.data, Meta: s.meta, Links: s.links})
+}
+
+func matchPath(pattern, path string) bool {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			continue
+		}
+		if segment != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package aqmtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMockServiceStubs(t *testing.T) {
+	mock := MockService()
+	defer mock.Close()
+
+	mock.OnList("users").Return([]user{{ID: "1", Name: "Ada"}})
+	mock.OnGet("users", "{id}").Return(user{ID: "any", Name: "Default"})
+	mock.OnGet("users", "42").Return(user{ID: "42", Name: "Grace"})
+	mock.OnGet("users", "7").ReturnError(http.StatusNotFound, "user_not_found", "no such user")
+	mock.OnCreate("users").WithBody(func(body map[string]any) bool { return body["name"] == "Alan" }).Return(user{ID: "3", Name: "Alan"})
+
+	client := mock.Client()
+	ctx := context.Background()
+
+	list, err := client.List(ctx, "users")
+	if err != nil || len(list.Data.([]any)) != 1 {
+		t.Fatalf("unexpected list %v (%v)", list, err)
+	}
+
+	got, err := client.Get(ctx, "users", "42")
+	if err != nil || got.Data.(map[string]any)["name"] != "Grace" {
+		t.Fatalf("expected the specific stub to win, got %v (%v)", got, err)
+	}
+	got, err = client.Get(ctx, "users", "99")
+	if err != nil || got.Data.(map[string]any)["name"] != "Default" {
+		t.Fatalf("expected placeholder stub, got %v (%v)", got, err)
+	}
+
+	_, err = client.Get(ctx, "users", "7")
+	var httpErr *aqm.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != "user_not_found" || !httpErr.IsNotFound() {
+		t.Fatalf("expected enveloped not found error, got %v", err)
+	}
+
+	created, err := client.Create(ctx, "users", map[string]string{"name": "Alan"})
+	if err != nil || created.Data.(map[string]any)["id"] != "3" {
+		t.Fatalf("unexpected create %v (%v)", created, err)
+	}
+	if _, err := client.Create(ctx, "users", map[string]string{"name": "Other"}); err == nil {
+		t.Error("expected unmatched body to be rejected")
+	}
+
+	if calls := mock.Calls(http.MethodGet, "/users/{id}"); calls != 3 {
+		t.Errorf("expected 3 get calls, got %d", calls)
+	}
+}
+
+func TestMockServiceHeaderMatcherAndLatency(t *testing.T) {
+	mock := MockService()
+	defer mock.Close()
+
+	mock.On(http.MethodGet, "/me").ReturnError(http.StatusUnauthorized, "", "")
+	mock.On(http.MethodGet, "/me").WithHeader(aqm.RequestIDHeader, "req-1").WithLatency(30 * time.Millisecond).Return(user{ID: "1"})
+
+	client := mock.Client()
+	if _, err := client.Request(context.Background(), http.MethodGet, "/me", nil); err == nil {
+		t.Error("expected request without header to hit the fallback stub")
+	}
+
+	start := time.Now()
+	ctx := aqm.WithRequestID(context.Background(), "req-1")
+	if _, err := client.Request(ctx, http.MethodGet, "/me", nil); err != nil {
+		t.Fatalf("expected header match, got %v", err)
+	}
+	if time.Since(start) < 30*time.Millisecond {
+		t.Error("expected injected latency")
+	}
+}
+
+func TestMockServiceUnstubbed(t *testing.T) {
+	mock := MockService()
+	defer mock.Close()
+
+	resp, err := http.Get(mock.URL + "/unknown")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected 501 for unstubbed route, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,34 @@
+package aqm
+
+import (
+	"context"
+	"time"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+// DefaultAsyncTimeout bounds tasks started with Async unless a
+// WithTaskTimeout option overrides it.
+const DefaultAsyncTimeout = 30 * time.Second
+
+// Detach returns a context that keeps the request metadata of ctx (request
+// ID, tenant, session, claims, logger; see aqmctx.Snapshot) and its
+// supervisor, but not its deadline or cancellation. Use it for work that must
+// finish after the handler returns.
+func Detach(ctx context.Context) context.Context {
+	detached := context.Background()
+	if ctx == nil {
+		return detached
+	}
+	detached = aqmctx.Snapshot(ctx).Restore(detached)
+	return ContextWithSupervisor(detached, SupervisorFrom(ctx))
+}
+
+// Async runs fn on the supervisor of ctx with a detached context, so it is
+// not cancelled when the request ends but is still awaited during shutdown.
+// Runs are bounded by DefaultAsyncTimeout and panics are recovered and
+// reported like any supervised task.
+func Async(ctx context.Context, name string, fn func(context.Context) error, opts ...TaskOption) error {
+	opts = append([]TaskOption{WithTaskTimeout(DefaultAsyncTimeout)}, opts...)
+	return Go(Detach(ctx), name, fn, opts...)
+}
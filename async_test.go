@@ -0,0 +1,116 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+func TestDetach(t *testing.T) {
+	s := NewSupervisor()
+	parent, cancel := context.WithTimeout(context.Background(), time.Minute)
+	ctx := aqmctx.WithTenant(WithRequestID(ContextWithSupervisor(parent, s), "req-1"), "acme")
+	cancel()
+
+	detached := Detach(ctx)
+	if detached.Err() != nil {
+		t.Fatalf("detached ctx inherited cancellation: %v", detached.Err())
+	}
+	if _, ok := detached.Deadline(); ok {
+		t.Error("detached ctx inherited deadline")
+	}
+	if RequestIDFrom(detached) != "req-1" || aqmctx.TenantFrom(detached) != "acme" {
+		t.Errorf("metadata lost: %q %q", RequestIDFrom(detached), aqmctx.TenantFrom(detached))
+	}
+	if SupervisorFrom(detached) != s {
+		t.Error("expected supervisor to be kept")
+	}
+	if Detach(nil) == nil {
+		t.Error("expected background context for nil ctx")
+	}
+}
+
+func TestAsyncOutlivesRequest(t *testing.T) {
+	reporter := &recordingReporter{}
+	s := NewSupervisor(WithSupervisorReporter(reporter))
+	done := make(chan string, 1)
+
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := ContextWithSupervisor(r.Context(), s)
+		err := Async(ctx, "notify", func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			done <- RequestIDFrom(ctx)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("async: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "req-9")
+	reqCtx, cancel := context.WithCancel(req.Context())
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(reqCtx))
+	cancel()
+
+	select {
+	case id := <-done:
+		if id != "req-9" {
+			t.Errorf("request id = %q, want req-9", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("async task did not complete")
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if reporter.count() != 0 {
+		t.Errorf("unexpected reports: %v", reporter.errs)
+	}
+}
+
+func TestAsyncTimeoutAndPanic(t *testing.T) {
+	reporter := &recordingReporter{}
+	s := NewSupervisor(WithSupervisorReporter(reporter))
+	ctx := ContextWithSupervisor(context.Background(), s)
+
+	if err := Async(ctx, "slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTaskTimeout(10*time.Millisecond)); err != nil {
+		t.Fatalf("async: %v", err)
+	}
+	if err := Async(ctx, "exploder", func(context.Context) error { panic("boom") }); err != nil {
+		t.Fatalf("async: %v", err)
+	}
+
+	deadline := time.After(time.Second)
+	for reporter.count() < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected two reports, got %d", reporter.count())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	var sawTimeout, sawPanic bool
+	for _, err := range reporter.errs {
+		var panicErr *PanicError
+		sawTimeout = sawTimeout || errors.Is(err, context.DeadlineExceeded)
+		sawPanic = sawPanic || errors.As(err, &panicErr)
+	}
+	if !sawTimeout || !sawPanic {
+		t.Errorf("expected timeout and panic reports, got %v", reporter.errs)
+	}
+}
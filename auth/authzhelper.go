@@ -32,21 +32,10 @@ func NewAuthzHelper(client AuthzClient, cacheTTL time.Duration) *AuthzHelper {
 func (h *AuthzHelper) CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error) {
 	key := h.cacheKey(userID, permission, resource)
 
-	// Try cache first
-	if allowed, found := h.cache.Get(key); found {
-		return allowed, nil
-	}
-
-	// Cache miss - call AuthZ service
-	allowed, err := h.client.CheckPermission(ctx, userID, permission, resource)
-	if err != nil {
-		return false, err
-	}
-
-	// Cache the result
-	h.cache.Set(key, allowed)
-
-	return allowed, nil
+	// Cache miss - call AuthZ service once, however many requests are waiting
+	return h.cache.GetOrLoad(ctx, key, func(ctx context.Context) (bool, error) {
+		return h.client.CheckPermission(ctx, userID, permission, resource)
+	})
 }
 
 // CheckMultiplePermissions checks multiple permissions efficiently.
@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"context"
 	"sync"
 	"time"
+
+	"github.com/aquamarinepk/aqm/internal/coalesce"
 )
 
 // TTLCache provides a generic thread-safe cache with time-to-live expiration.
@@ -11,6 +14,8 @@ type TTLCache[K comparable, V any] struct {
 	items      map[K]cacheItem[V]
 	mutex      sync.RWMutex
 	defaultTTL time.Duration
+	loads      *coalesce.Group[K, V]
+	generation uint64 // bumped on invalidation so in-flight loads are not stored
 }
 
 // cacheItem wraps a cached value with its expiration time.
@@ -24,6 +29,7 @@ func NewTTLCache[K comparable, V any](defaultTTL time.Duration) *TTLCache[K, V]
 	return &TTLCache[K, V]{
 		items:      make(map[K]cacheItem[V]),
 		defaultTTL: defaultTTL,
+		loads:      coalesce.New[K, V](0),
 	}
 }
 
@@ -64,12 +70,42 @@ func (c *TTLCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
 	}
 }
 
+// GetOrLoad returns the cached value for key, calling load on a miss and
+// caching its result with the default TTL. Concurrent misses for the same key
+// share a single load. Failed loads are not cached, and a load that overlaps
+// an invalidation is returned but not stored.
+func (c *TTLCache[K, V]) GetOrLoad(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	if value, found := c.Get(key); found {
+		return value, nil
+	}
+
+	value, _, err := c.loads.Do(ctx, key, func(ctx context.Context) (V, error) {
+		c.mutex.RLock()
+		generation := c.generation
+		c.mutex.RUnlock()
+
+		value, err := load(ctx)
+		if err != nil {
+			return value, err
+		}
+
+		c.mutex.Lock()
+		if c.generation == generation {
+			c.items[key] = cacheItem[V]{Value: value, ExpiresAt: time.Now().Add(c.defaultTTL)}
+		}
+		c.mutex.Unlock()
+		return value, nil
+	})
+	return value, err
+}
+
 // Delete removes a specific key from cache.
 func (c *TTLCache[K, V]) Delete(key K) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	delete(c.items, key)
+	c.generation++
 }
 
 // Clear removes all items from cache.
@@ -78,6 +114,7 @@ func (c *TTLCache[K, V]) Clear() {
 	defer c.mutex.Unlock()
 
 	c.items = make(map[K]cacheItem[V])
+	c.generation++
 }
 
 // ClearExpired removes all expired items from cache.
@@ -127,4 +164,5 @@ func (c *StringTTLCache[V]) DeleteByPrefix(prefix string) {
 			delete(c.items, key)
 		}
 	}
+	c.generation++
 }
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -258,3 +260,65 @@ func TestTTLCacheWithStructValues(t *testing.T) {
 		t.Errorf("val = %+v, want {Name:John Age:30}", val)
 	}
 }
+
+func TestTTLCacheGetOrLoad(t *testing.T) {
+	cache := NewTTLCache[string, int](time.Minute)
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return 5, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := cache.GetOrLoad(context.Background(), "key", load); err != nil || v != 5 {
+				t.Errorf("GetOrLoad = %d, %v; want 5, nil", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("load called %d times, want 1", calls)
+	}
+	if v, found := cache.Get("key"); !found || v != 5 {
+		t.Fatalf("cached value = %d, %v; want 5, true", v, found)
+	}
+}
+
+func TestTTLCacheGetOrLoadErrorNotCached(t *testing.T) {
+	cache := NewTTLCache[string, int](time.Minute)
+	_, err := cache.GetOrLoad(context.Background(), "key", func(context.Context) (int, error) {
+		return 0, errors.New("unavailable")
+	})
+	if err == nil {
+		t.Fatal("expected load error")
+	}
+	if _, found := cache.Get("key"); found {
+		t.Fatal("failed load should not be cached")
+	}
+}
+
+func TestTTLCacheGetOrLoadSkipsStoreAfterInvalidation(t *testing.T) {
+	cache := NewTTLCache[string, int](time.Minute)
+	v, err := cache.GetOrLoad(context.Background(), "key", func(context.Context) (int, error) {
+		cache.Delete("key")
+		return 1, nil
+	})
+	if err != nil || v != 1 {
+		t.Fatalf("GetOrLoad = %d, %v; want 1, nil", v, err)
+	}
+	if _, found := cache.Get("key"); found {
+		t.Fatal("value loaded across an invalidation should not be cached")
+	}
+}
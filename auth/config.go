@@ -0,0 +1,14 @@
+package auth
+
+import "time"
+
+// Config groups token and key settings for auth-aware services. It is meant
+// to be bound from the "auth" subtree with aqm.BindEnv.
+type Config struct {
+	Audience         string        `koanf:"audience" validate:"required"`
+	SessionTTL       time.Duration `koanf:"session_ttl" default:"24h" validate:"min=60"`
+	InternalTokenTTL time.Duration `koanf:"internal_token_ttl" default:"5m" validate:"min=1"`
+	RefreshThreshold time.Duration `koanf:"refresh_threshold" default:"10m"`
+	SigningKey       string        `koanf:"signing_key" validate:"required"`
+	EncryptionKey    string        `koanf:"encryption_key"`
+}
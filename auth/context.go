@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+var claimsKey = aqmctx.NewKey[*TokenClaims]("claims")
+
+// WithClaims stores the verified token claims in ctx. The claims session ID,
+// when set, is stored as the aqmctx session as well.
+func WithClaims(ctx context.Context, claims *TokenClaims) context.Context {
+	if claims == nil {
+		return ctx
+	}
+	ctx = claimsKey.With(ctx, claims)
+	return aqmctx.WithSession(ctx, claims.SessionID)
+}
+
+// ClaimsFrom returns the claims stored by WithClaims, or nil.
+func ClaimsFrom(ctx context.Context) *TokenClaims {
+	claims, _ := claimsKey.From(ctx)
+	return claims
+}
+
+var actorKey = aqmctx.NewKey[*TokenClaims]("actor")
+
+// WithActor stores the claims of the authenticated actor when the request
+// acts on behalf of someone else, as during impersonation. ClaimsFrom keeps
+// returning the effective principal.
+func WithActor(ctx context.Context, actor *TokenClaims) context.Context {
+	if actor == nil {
+		return ctx
+	}
+	return actorKey.With(ctx, actor)
+}
+
+// ActorFrom returns who actually authenticated: the actor stored by
+// WithActor or, when nobody is being impersonated, the claims.
+func ActorFrom(ctx context.Context) *TokenClaims {
+	if actor, ok := actorKey.From(ctx); ok {
+		return actor
+	}
+	return ClaimsFrom(ctx)
+}
+
+// IsImpersonating reports whether ctx carries an actor distinct from the
+// effective principal.
+func IsImpersonating(ctx context.Context) bool {
+	_, ok := actorKey.From(ctx)
+	return ok
+}
+
+var apiKeyKey = aqmctx.NewKey[string]("api_key")
+
+// WithAPIKey stores the ID of the API key the request was authenticated
+// with. Only middleware that has verified the key should call it.
+func WithAPIKey(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return apiKeyKey.With(ctx, id)
+}
+
+// APIKeyFrom returns the API key ID stored by WithAPIKey, or "".
+func APIKeyFrom(ctx context.Context) string {
+	id, _ := apiKeyKey.From(ctx)
+	return id
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+func TestClaimsContext(t *testing.T) {
+	ctx := context.Background()
+	if ClaimsFrom(ctx) != nil {
+		t.Fatal("expected no claims")
+	}
+	if WithClaims(ctx, nil) != ctx {
+		t.Error("nil claims should return ctx unchanged")
+	}
+
+	claims := &TokenClaims{Subject: "user-1", SessionID: "sess-1"}
+	ctx = WithClaims(ctx, claims)
+	if ClaimsFrom(ctx) != claims {
+		t.Error("expected stored claims")
+	}
+	if got := aqmctx.SessionFrom(ctx); got != "sess-1" {
+		t.Errorf("session = %q, want sess-1", got)
+	}
+
+	restored := aqmctx.Snapshot(ctx).Restore(context.Background())
+	if ClaimsFrom(restored) != claims {
+		t.Error("claims should survive snapshot and restore")
+	}
+}
@@ -19,6 +19,11 @@ var (
 	ErrInvalidPolicy      = errors.New("invalid policy format")
 	ErrGrantExpired       = errors.New("grant expired")
 	ErrRoleNotFound       = errors.New("role not found")
+	ErrRefreshInvalid     = errors.New("invalid refresh token")
+	ErrRefreshReused      = errors.New("refresh token reused")
+	ErrTokenRevoked       = errors.New("token revoked")
+	ErrAuthzVersionStale  = errors.New("token authorization version is outdated")
+	ErrInvalidAPIKey      = errors.New("invalid api key")
 )
 
 type ValidationError struct {
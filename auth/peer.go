@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+// ErrInvalidSPIFFEID is returned for strings that are not spiffe://
+// identifiers.
+var ErrInvalidSPIFFEID = errors.New("auth: invalid SPIFFE ID")
+
+// SPIFFEID identifies a workload: spiffe://<trust domain>/<path>.
+type SPIFFEID struct {
+	TrustDomain string
+	Path        string
+}
+
+// ParseSPIFFEID parses a spiffe:// URI. The trust domain is lowercased; query,
+// fragment and user info are rejected as the SPIFFE spec requires.
+func ParseSPIFFEID(raw string) (SPIFFEID, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return SPIFFEID{}, fmt.Errorf("%w: %v", ErrInvalidSPIFFEID, err)
+	}
+	if u.Scheme != "spiffe" || u.Host == "" || u.User != nil || u.Port() != "" ||
+		u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(u.Path, "/") {
+		return SPIFFEID{}, fmt.Errorf("%w: %q", ErrInvalidSPIFFEID, raw)
+	}
+	return SPIFFEID{TrustDomain: strings.ToLower(u.Host), Path: u.Path}, nil
+}
+
+// String returns the spiffe:// form of id.
+func (id SPIFFEID) String() string {
+	if id.TrustDomain == "" {
+		return ""
+	}
+	return "spiffe://" + id.TrustDomain + id.Path
+}
+
+// PeerIdentity is the verified identity of the workload on the other end of
+// an mTLS connection.
+type PeerIdentity struct {
+	SPIFFEID   SPIFFEID
+	DNSNames   []string
+	CommonName string
+	Serial     string
+}
+
+// HasSPIFFEID reports whether the peer presented a SPIFFE ID.
+func (p *PeerIdentity) HasSPIFFEID() bool {
+	return p != nil && p.SPIFFEID.TrustDomain != ""
+}
+
+// String returns the SPIFFE ID, the first DNS name or the common name,
+// whichever is available first.
+func (p *PeerIdentity) String() string {
+	switch {
+	case p == nil:
+		return ""
+	case p.HasSPIFFEID():
+		return p.SPIFFEID.String()
+	case len(p.DNSNames) > 0:
+		return p.DNSNames[0]
+	default:
+		return p.CommonName
+	}
+}
+
+// PeerIdentityFromCertificate extracts the identity of a verified leaf
+// certificate. A SPIFFE X509-SVID carries exactly one spiffe URI SAN; more
+// than one is an error, other URIs are ignored.
+func PeerIdentityFromCertificate(cert *x509.Certificate) (*PeerIdentity, error) {
+	if cert == nil {
+		return nil, errors.New("auth: no peer certificate")
+	}
+	peer := &PeerIdentity{
+		DNSNames:   slices.Clone(cert.DNSNames),
+		CommonName: cert.Subject.CommonName,
+	}
+	if cert.SerialNumber != nil {
+		peer.Serial = cert.SerialNumber.Text(16)
+	}
+	found := false
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+		if found {
+			return nil, fmt.Errorf("%w: certificate has more than one SPIFFE ID", ErrInvalidSPIFFEID)
+		}
+		id, err := ParseSPIFFEID(uri.String())
+		if err != nil {
+			return nil, err
+		}
+		peer.SPIFFEID = id
+		found = true
+	}
+	return peer, nil
+}
+
+// PeerPolicy decides whether a peer may call a service.
+type PeerPolicy func(ctx context.Context, peer *PeerIdentity) bool
+
+// AllowSPIFFEIDs admits peers whose SPIFFE ID is one of ids.
+func AllowSPIFFEIDs(ids ...string) PeerPolicy {
+	allowed := make(map[string]struct{}, len(ids))
+	for _, raw := range ids {
+		if id, err := ParseSPIFFEID(raw); err == nil {
+			allowed[id.String()] = struct{}{}
+		}
+	}
+	return func(_ context.Context, peer *PeerIdentity) bool {
+		if !peer.HasSPIFFEID() {
+			return false
+		}
+		_, ok := allowed[peer.SPIFFEID.String()]
+		return ok
+	}
+}
+
+// AllowTrustDomains admits any peer with a SPIFFE ID in one of domains.
+func AllowTrustDomains(domains ...string) PeerPolicy {
+	allowed := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		allowed[strings.ToLower(d)] = struct{}{}
+	}
+	return func(_ context.Context, peer *PeerIdentity) bool {
+		if !peer.HasSPIFFEID() {
+			return false
+		}
+		_, ok := allowed[peer.SPIFFEID.TrustDomain]
+		return ok
+	}
+}
+
+var peerKey = aqmctx.NewKey[*PeerIdentity]("peer")
+
+// WithPeer stores the verified peer identity in ctx.
+func WithPeer(ctx context.Context, peer *PeerIdentity) context.Context {
+	if peer == nil {
+		return ctx
+	}
+	return peerKey.With(ctx, peer)
+}
+
+// PeerFrom returns the identity stored by WithPeer, or nil.
+func PeerFrom(ctx context.Context) *PeerIdentity {
+	peer, _ := peerKey.From(ctx)
+	return peer
+}
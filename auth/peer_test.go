@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestParseSPIFFEID(t *testing.T) {
+	id, err := ParseSPIFFEID("spiffe://Prod.Example/ns/billing/sa/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.TrustDomain != "prod.example" || id.Path != "/ns/billing/sa/api" || id.String() != "spiffe://prod.example/ns/billing/sa/api" {
+		t.Errorf("id = %+v", id)
+	}
+	for _, raw := range []string{
+		"https://prod.example/api",
+		"spiffe:///api",
+		"spiffe://prod.example/api/",
+		"spiffe://prod.example:443/api",
+		"spiffe://prod.example/api?x=1",
+		"spiffe://user@prod.example/api",
+	} {
+		if _, err := ParseSPIFFEID(raw); !errors.Is(err, ErrInvalidSPIFFEID) {
+			t.Errorf("ParseSPIFFEID(%q) err = %v", raw, err)
+		}
+	}
+}
+
+func TestPeerIdentityFromCertificate(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://prod.example/api")
+	other, _ := url.Parse("https://example.com")
+	cert := &x509.Certificate{URIs: []*url.URL{other, spiffe}, DNSNames: []string{"api.internal"}}
+
+	peer, err := PeerIdentityFromCertificate(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.String() != "spiffe://prod.example/api" || peer.DNSNames[0] != "api.internal" {
+		t.Errorf("peer = %+v", peer)
+	}
+
+	cert.URIs = append(cert.URIs, spiffe)
+	if _, err := PeerIdentityFromCertificate(cert); !errors.Is(err, ErrInvalidSPIFFEID) {
+		t.Errorf("two SPIFFE IDs: err = %v", err)
+	}
+
+	ctx := WithPeer(context.Background(), peer)
+	if PeerFrom(ctx) != peer || PeerFrom(context.Background()) != nil {
+		t.Error("peer context round trip failed")
+	}
+}
+
+func TestPeerPolicies(t *testing.T) {
+	ctx := context.Background()
+	peer := &PeerIdentity{SPIFFEID: SPIFFEID{TrustDomain: "prod.example", Path: "/api"}}
+	dnsOnly := &PeerIdentity{DNSNames: []string{"api.internal"}}
+
+	if !AllowSPIFFEIDs("spiffe://PROD.example/api")(ctx, peer) {
+		t.Error("listed ID refused")
+	}
+	if AllowSPIFFEIDs("spiffe://prod.example/worker")(ctx, peer) {
+		t.Error("unlisted ID admitted")
+	}
+	if !AllowTrustDomains("Prod.Example")(ctx, peer) || AllowTrustDomains("dev.example")(ctx, peer) {
+		t.Error("trust domain policy is wrong")
+	}
+	if AllowTrustDomains("prod.example")(ctx, dnsOnly) {
+		t.Error("peer without SPIFFE ID admitted")
+	}
+}
@@ -0,0 +1,120 @@
+package protect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultMongoCollection = "_auth_failures"
+
+// MongoStore keeps records in a Mongo collection, one document per key. A
+// TTL index on expires_at lets Mongo remove stale records.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore stores records in collection, defaulting to _auth_failures
+// when empty.
+func NewMongoStore(db *mongo.Database, collection string) *MongoStore {
+	if collection == "" {
+		collection = defaultMongoCollection
+	}
+	return &MongoStore{collection: db.Collection(collection)}
+}
+
+// EnsureIndexes creates the TTL index expiring records.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("protect: creating ttl index: %w", err)
+	}
+	return nil
+}
+
+type failureRecord struct {
+	ID          string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	Lockouts    int       `bson:"lockouts"`
+	LastFailure time.Time `bson:"last_failure"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// Get implements Store.
+func (s *MongoStore) Get(ctx context.Context, key string) (Record, error) {
+	var doc failureRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now().UTC()}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Record{Key: key}, nil
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("protect: get %s: %w", key, err)
+	}
+	return Record{
+		Key:         key,
+		Failures:    doc.Failures,
+		Lockouts:    doc.Lockouts,
+		LastFailure: doc.LastFailure,
+		LockedUntil: doc.LockedUntil,
+	}, nil
+}
+
+// Increment implements Store. A single pipeline update counts the failure,
+// so concurrent attempts on any replica are all recorded. Documents past
+// expires_at that the TTL monitor has not removed yet count as absent.
+func (s *MongoStore) Increment(ctx context.Context, key string, now time.Time, window, ttl time.Duration) (Record, error) {
+	now = now.UTC()
+	live := bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$expires_at", time.Time{}}}, now}}
+	recent := bson.M{"$and": bson.A{live, bson.M{"$gte": bson.A{bson.M{"$ifNull": bson.A{"$last_failure", time.Time{}}}, now.Add(-window)}}}}
+	expires := now.Add(ttl)
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures":     bson.M{"$cond": bson.A{recent, bson.M{"$add": bson.A{"$failures", 1}}, 1}},
+		"lockouts":     bson.M{"$cond": bson.A{live, "$lockouts", 0}},
+		"locked_until": bson.M{"$cond": bson.A{live, "$locked_until", time.Time{}}},
+		"last_failure": now,
+		"expires_at":   bson.M{"$cond": bson.A{bson.M{"$and": bson.A{live, bson.M{"$gt": bson.A{"$expires_at", expires}}}}, "$expires_at", expires}},
+	}}}}
+	return s.update(ctx, key, update)
+}
+
+// Lock implements Store.
+func (s *MongoStore) Lock(ctx context.Context, key string, until time.Time, ttl time.Duration) (Record, error) {
+	update := bson.M{
+		"$set": bson.M{"locked_until": until.UTC(), "failures": 0},
+		"$inc": bson.M{"lockouts": 1},
+		"$max": bson.M{"expires_at": time.Now().UTC().Add(ttl)},
+	}
+	return s.update(ctx, key, update)
+}
+
+func (s *MongoStore) update(ctx context.Context, key string, update any) (Record, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var doc failureRecord
+	if err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&doc); err != nil {
+		return Record{}, fmt.Errorf("protect: update %s: %w", key, err)
+	}
+	return Record{
+		Key:         key,
+		Failures:    doc.Failures,
+		Lockouts:    doc.Lockouts,
+		LastFailure: doc.LastFailure,
+		LockedUntil: doc.LockedUntil,
+	}, nil
+}
+
+// Delete implements Store.
+func (s *MongoStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("protect: delete %s: %w", key, err)
+	}
+	return nil
+}
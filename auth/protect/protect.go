@@ -0,0 +1,393 @@
+// Package protect guards authentication endpoints against brute force. It
+// counts failed attempts per principal and per client IP, locks keys out for
+// exponentially growing periods, signals when a CAPTCHA should be required
+// and publishes security events for monitoring.
+package protect
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	defaultBasePath = "/auth/protect"
+	defaultTopic    = "auth.security"
+
+	// CaptchaHeader is set to "true" on responses once a CAPTCHA should be
+	// required for the next attempt.
+	CaptchaHeader = "X-Captcha-Required"
+)
+
+// Security event types published by a Guard.
+const (
+	EventFailure        = "auth.failure"
+	EventLockout        = "auth.lockout"
+	EventLockoutCleared = "auth.lockout_cleared"
+)
+
+// PrincipalKey and IPKey build the keys failures are tracked under, as used
+// by the management API.
+func PrincipalKey(principal string) string { return "principal:" + principal }
+func IPKey(ip string) string               { return "ip:" + ip }
+
+// Policy controls when a key is locked out.
+type Policy struct {
+	// MaxFailures within Window lock the key out.
+	MaxFailures int
+	// CaptchaAfter failures within Window require a CAPTCHA; 0 disables it.
+	CaptchaAfter int
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+	// BaseLockout is the first lockout; each further lockout doubles it up
+	// to MaxLockout.
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// Decay is how long a key must stay clean before its lockout count, and
+	// so the lockout duration, resets.
+	Decay time.Duration
+}
+
+// DefaultPolicy locks a principal out for 1 minute after 5 failures within
+// 15 minutes, doubling up to 1 hour, and asks for a CAPTCHA after 3.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxFailures:  5,
+		CaptchaAfter: 3,
+		Window:       15 * time.Minute,
+		BaseLockout:  time.Minute,
+		MaxLockout:   time.Hour,
+		Decay:        24 * time.Hour,
+	}
+}
+
+// DefaultIPPolicy is looser than DefaultPolicy since many users may share an
+// address.
+func DefaultIPPolicy() Policy {
+	p := DefaultPolicy()
+	p.MaxFailures = 20
+	p.CaptchaAfter = 10
+	return p
+}
+
+func (p Policy) lockout(previous int) time.Duration {
+	d := time.Duration(float64(p.BaseLockout) * math.Pow(2, float64(previous)))
+	if d > p.MaxLockout || d <= 0 {
+		return p.MaxLockout
+	}
+	return d
+}
+
+// Decision is the combined state of the keys of an attempt.
+type Decision struct {
+	Locked          bool          `json:"locked"`
+	RetryAfter      time.Duration `json:"retry_after,omitempty"`
+	CaptchaRequired bool          `json:"captcha_required"`
+}
+
+// Event is published for failures, lockouts and cleared lockouts.
+type Event struct {
+	Type        string    `json:"type"`
+	Key         string    `json:"key"`
+	Principal   string    `json:"principal,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	Failures    int       `json:"failures,omitempty"`
+	Lockouts    int       `json:"lockouts,omitempty"`
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// Guard tracks failed attempts and decides lockouts. It implements
+// aqm.HTTPModule, exposing a management API under {base}/lockouts.
+type Guard struct {
+	store     Store
+	policy    Policy
+	ipPolicy  Policy
+	publisher events.Publisher
+	topic     string
+	basePath  string
+	principal func(*http.Request) string
+	log       aqm.Logger
+	now       func() time.Time
+}
+
+// Option configures a Guard.
+type Option func(*Guard)
+
+// WithPolicy sets the policy for principals (defaults to DefaultPolicy).
+func WithPolicy(p Policy) Option {
+	return func(g *Guard) {
+		g.policy = p
+	}
+}
+
+// WithIPPolicy sets the policy for client IPs (defaults to DefaultIPPolicy).
+func WithIPPolicy(p Policy) Option {
+	return func(g *Guard) {
+		g.ipPolicy = p
+	}
+}
+
+// WithPublisher publishes security events to topic (defaults to
+// "auth.security").
+func WithPublisher(publisher events.Publisher, topic string) Option {
+	return func(g *Guard) {
+		g.publisher = publisher
+		if topic != "" {
+			g.topic = topic
+		}
+	}
+}
+
+// WithBasePath overrides the management API mount point (defaults to
+// /auth/protect).
+func WithBasePath(base string) Option {
+	return func(g *Guard) {
+		if base != "" {
+			g.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithPrincipal sets how the middleware finds the principal an attempt is
+// for, such as the submitted username. Without it the middleware only
+// tracks client IPs. fn must leave the request body readable for the
+// handler.
+func WithPrincipal(fn func(*http.Request) string) Option {
+	return func(g *Guard) {
+		g.principal = fn
+	}
+}
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(g *Guard) {
+		if logger != nil {
+			g.log = logger
+		}
+	}
+}
+
+// NewGuard returns a Guard backed by store. A nil store defaults to an
+// in-memory implementation.
+func NewGuard(store Store, opts ...Option) *Guard {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	g := &Guard{
+		store:    store,
+		policy:   DefaultPolicy(),
+		ipPolicy: DefaultIPPolicy(),
+		topic:    defaultTopic,
+		basePath: defaultBasePath,
+		log:      aqm.NewNoopLogger(),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(g)
+		}
+	}
+	return g
+}
+
+// Check reports whether an attempt for principal from ip may proceed. Either
+// may be empty.
+func (g *Guard) Check(ctx context.Context, principal, ip string) (Decision, error) {
+	var d Decision
+	now := g.now()
+	for _, k := range g.keys(principal, ip) {
+		record, err := g.store.Get(ctx, k.key)
+		if err != nil {
+			return Decision{}, err
+		}
+		g.merge(&d, record, k.policy, now)
+	}
+	return d, nil
+}
+
+// Fail records a failed attempt, locking out every key that reached its
+// policy's MaxFailures, and returns the resulting decision. Failures are
+// counted with Store.Increment, and only the attempt that brings a key to
+// exactly MaxFailures locks it, so concurrent failures are neither lost nor
+// lock a key out twice.
+func (g *Guard) Fail(ctx context.Context, principal, ip string) (Decision, error) {
+	var d Decision
+	now := g.now()
+	for _, k := range g.keys(principal, ip) {
+		record, err := g.store.Increment(ctx, k.key, now, k.policy.Window, max(k.policy.Decay, k.policy.Window))
+		if err != nil {
+			return Decision{}, err
+		}
+		event := Event{Type: EventFailure, Key: k.key, Principal: principal, IP: ip, Failures: record.Failures, Time: now}
+		if record.Failures == max(k.policy.MaxFailures, 1) {
+			lockout := k.policy.lockout(record.Lockouts)
+			record, err = g.store.Lock(ctx, k.key, now.Add(lockout), max(k.policy.Decay, k.policy.Window, lockout))
+			if err != nil {
+				return Decision{}, err
+			}
+			event.Type, event.Failures, event.Lockouts, event.LockedUntil = EventLockout, 0, record.Lockouts, record.LockedUntil
+			g.log.Info("authentication locked out", "key", k.key, "until", record.LockedUntil)
+		}
+		g.publish(ctx, event)
+		g.merge(&d, record, k.policy, now)
+	}
+	return d, nil
+}
+
+// Succeed resets the failures of principal after a successful attempt. The
+// IP record is kept so that logging into one account does not hide attempts
+// on others from the same address.
+func (g *Guard) Succeed(ctx context.Context, principal string) error {
+	if principal == "" {
+		return nil
+	}
+	return g.store.Delete(ctx, PrincipalKey(principal))
+}
+
+// Status returns the record stored under key.
+func (g *Guard) Status(ctx context.Context, key string) (Record, error) {
+	return g.store.Get(ctx, key)
+}
+
+// Clear removes the record stored under key, lifting any lockout.
+func (g *Guard) Clear(ctx context.Context, key string) error {
+	if err := g.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	g.publish(ctx, Event{Type: EventLockoutCleared, Key: key, Time: g.now()})
+	return nil
+}
+
+type trackedKey struct {
+	key    string
+	policy Policy
+}
+
+func (g *Guard) keys(principal, ip string) []trackedKey {
+	var keys []trackedKey
+	if principal != "" {
+		keys = append(keys, trackedKey{PrincipalKey(principal), g.policy})
+	}
+	if ip != "" {
+		keys = append(keys, trackedKey{IPKey(ip), g.ipPolicy})
+	}
+	return keys
+}
+
+func (g *Guard) merge(d *Decision, record Record, policy Policy, now time.Time) {
+	if record.Locked(now) {
+		d.Locked = true
+		d.RetryAfter = max(d.RetryAfter, record.LockedUntil.Sub(now))
+	}
+	recent := !record.LastFailure.IsZero() && now.Sub(record.LastFailure) <= policy.Window
+	if policy.CaptchaAfter > 0 && recent && (record.Failures >= policy.CaptchaAfter || record.Lockouts > 0) {
+		d.CaptchaRequired = true
+	}
+}
+
+func (g *Guard) publish(ctx context.Context, event Event) {
+	if g.publisher == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		g.log.Error("cannot encode security event", "error", err)
+		return
+	}
+	if err := g.publisher.Publish(context.WithoutCancel(ctx), g.topic, data); err != nil {
+		g.log.Error("cannot publish security event", "type", event.Type, "error", err)
+	}
+}
+
+// Middleware protects a login endpoint. Locked out attempts are answered
+// with 429, the locked_out error code and Retry-After; otherwise the handler
+// runs and a 401 or 403 response counts as a failure while a 2xx response
+// resets the principal. Responses carry X-Captcha-Required once a CAPTCHA
+// should be asked for; verifying it is up to the handler. Store failures let
+// the request through. Client IPs come from aqmctx.ClientIP, so behind a
+// proxy mount middleware.ClientIP with the trusted proxies first; forwarding
+// headers are never read here.
+func (g *Guard) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var principal string
+			if g.principal != nil {
+				principal = g.principal(r)
+			}
+			ip := aqmctx.ClientIP(r)
+
+			decision, err := g.Check(r.Context(), principal, ip)
+			if err != nil {
+				g.log.Error("cannot check authentication lockout", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if decision.CaptchaRequired {
+				w.Header().Set(CaptchaHeader, "true")
+			}
+			if decision.Locked {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+				aqm.Error(w, http.StatusTooManyRequests, "locked_out", "too many failed attempts, try again later")
+				return
+			}
+
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			switch {
+			case status == http.StatusUnauthorized || status == http.StatusForbidden:
+				if _, err := g.Fail(r.Context(), principal, ip); err != nil {
+					g.log.Error("cannot record authentication failure", "error", err)
+				}
+			case status == 0 || (status >= 200 && status < 300):
+				if err := g.Succeed(r.Context(), principal); err != nil {
+					g.log.Error("cannot reset authentication failures", "error", err)
+				}
+			}
+		})
+	}
+}
+
+// RegisterRoutes implements aqm.HTTPModule. GET {base}/lockouts/{key}
+// returns the record of a key such as "principal:alice" or "ip:10.0.0.7",
+// and DELETE clears it. Mount it behind admin authentication.
+func (g *Guard) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Get(g.basePath+"/lockouts/{key}", g.handleStatus)
+	r.Delete(g.basePath+"/lockouts/{key}", g.handleClear)
+}
+
+func (g *Guard) handleStatus(w http.ResponseWriter, r *http.Request) {
+	record, err := g.Status(r.Context(), chi.URLParam(r, "key"))
+	if err != nil {
+		g.log.Error("cannot load lockout", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "lockout_failed", "cannot load lockout")
+		return
+	}
+	aqm.RespondSuccess(w, record)
+}
+
+func (g *Guard) handleClear(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if err := g.Clear(r.Context(), key); err != nil {
+		g.log.Error("cannot clear lockout", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "lockout_failed", "cannot clear lockout")
+		return
+	}
+	g.log.Info("lockout cleared", "key", key)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package protect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, _ string, msg []byte) error {
+	var ev Event
+	if err := json.Unmarshal(msg, &ev); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func (p *recordingPublisher) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []string
+	for _, ev := range p.events {
+		out = append(out, ev.Type)
+	}
+	return out
+}
+
+func newTestGuard(at *time.Time, opts ...Option) *Guard {
+	store := NewMemoryStore()
+	store.now = func() time.Time { return *at }
+	g := NewGuard(store, opts...)
+	g.now = func() time.Time { return *at }
+	return g
+}
+
+func TestFailLocksOutWithExponentialBackoff(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	pub := &recordingPublisher{}
+	g := newTestGuard(&now, WithPublisher(pub, ""))
+	ctx := context.Background()
+
+	var d Decision
+	for i := 0; i < 3; i++ {
+		d, _ = g.Fail(ctx, "alice", "")
+	}
+	if d.Locked || !d.CaptchaRequired {
+		t.Fatalf("after 3 failures = %+v; want captcha, not locked", d)
+	}
+	for i := 0; i < 2; i++ {
+		d, _ = g.Fail(ctx, "alice", "")
+	}
+	if !d.Locked || d.RetryAfter != time.Minute {
+		t.Fatalf("after 5 failures = %+v; want locked for 1m", d)
+	}
+	if types := pub.types(); len(types) != 5 || types[4] != EventLockout {
+		t.Fatalf("events = %v", types)
+	}
+
+	now = now.Add(time.Minute)
+	if d, _ = g.Check(ctx, "alice", ""); d.Locked || !d.CaptchaRequired {
+		t.Fatalf("after lockout = %+v; want unlocked with captcha", d)
+	}
+	for i := 0; i < 5; i++ {
+		d, _ = g.Fail(ctx, "alice", "")
+	}
+	if d.RetryAfter != 2*time.Minute {
+		t.Fatalf("second lockout = %v; want 2m", d.RetryAfter)
+	}
+
+	if err := g.Succeed(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ = g.Check(ctx, "alice", ""); d.Locked || d.CaptchaRequired {
+		t.Fatalf("after success = %+v", d)
+	}
+}
+
+func TestFailuresOutsideWindowAreForgotten(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now, WithPolicy(Policy{MaxFailures: 2, Window: time.Minute, BaseLockout: time.Minute, MaxLockout: time.Hour, Decay: time.Hour}))
+	ctx := context.Background()
+
+	g.Fail(ctx, "bob", "")
+	now = now.Add(2 * time.Minute)
+	if d, _ := g.Fail(ctx, "bob", ""); d.Locked {
+		t.Fatal("stale failure counted towards lockout")
+	}
+}
+
+func TestConcurrentFailuresLockOnce(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	pub := &recordingPublisher{}
+	g := newTestGuard(&now, WithPublisher(pub, ""))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Fail(ctx, "dave", "")
+		}()
+	}
+	wg.Wait()
+
+	lockouts := 0
+	for _, typ := range pub.types() {
+		if typ == EventLockout {
+			lockouts++
+		}
+	}
+	record, _ := g.Status(ctx, PrincipalKey("dave"))
+	if lockouts != 1 || record.Lockouts != 1 {
+		t.Fatalf("lockout events = %d, record = %+v; want a single lockout", lockouts, record)
+	}
+	if d, _ := g.Check(ctx, "dave", ""); !d.Locked {
+		t.Fatalf("after concurrent failures = %+v; want locked", d)
+	}
+}
+
+func TestMiddlewareAndManagementAPI(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now,
+		WithPolicy(Policy{MaxFailures: 2, CaptchaAfter: 1, Window: time.Minute, BaseLockout: time.Minute, MaxLockout: time.Hour, Decay: time.Hour}),
+		WithPrincipal(func(r *http.Request) string { return r.URL.Query().Get("user") }))
+
+	login := g.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	attempt := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login?user=carol&password="+password, nil)
+		rec := httptest.NewRecorder()
+		login.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := attempt("wrong"); rec.Code != http.StatusUnauthorized || rec.Header().Get(CaptchaHeader) != "" {
+		t.Fatalf("first failure: %d %v", rec.Code, rec.Header())
+	}
+	if rec := attempt("wrong"); rec.Header().Get(CaptchaHeader) != "true" {
+		t.Fatalf("second attempt lacks captcha signal: %v", rec.Header())
+	}
+	rec := attempt("secret")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locked attempt: %d %v", rec.Code, rec.Header())
+	}
+
+	router := chi.NewRouter()
+	g.RegisterRoutes(router)
+	req := httptest.NewRequest("GET", "/auth/protect/lockouts/"+PrincipalKey("carol"), nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status endpoint: %d %s", rec.Code, rec.Body)
+	}
+	req = httptest.NewRequest("DELETE", "/auth/protect/lockouts/"+PrincipalKey("carol"), nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("clear endpoint: %d", rec.Code)
+	}
+
+	// The IP stays on record, but under its looser policy it is not locked.
+	if rec := attempt("secret"); rec.Code != http.StatusOK {
+		t.Fatalf("after clear: %d %s", rec.Code, rec.Body)
+	}
+}
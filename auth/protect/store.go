@@ -0,0 +1,117 @@
+package protect
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is the failure state of one key.
+type Record struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	Lockouts    int       `json:"lockouts"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+}
+
+// Locked reports whether the key is locked out at now.
+func (r Record) Locked(now time.Time) bool {
+	return now.Before(r.LockedUntil)
+}
+
+// Store persists failure records. Increment and Lock must be atomic per key,
+// also across replicas sharing the store, so concurrent failures can neither
+// be lost nor lock a key out twice.
+type Store interface {
+	// Get returns the record for key, zero valued when none exists.
+	Get(ctx context.Context, key string) (Record, error)
+	// Increment records a failure on key at now and returns the updated
+	// record. Failures before now-window are dropped first. The record may be
+	// discarded once ttl has passed.
+	Increment(ctx context.Context, key string, now time.Time, window, ttl time.Duration) (Record, error)
+	// Lock locks key out until until, counts the lockout and resets the
+	// failures, returning the updated record. The record is kept for at least
+	// ttl.
+	Lock(ctx context.Context, key string, until time.Time, ttl time.Duration) (Record, error)
+	// Delete removes the record for key.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryStore keeps records in process memory. It suits single-instance
+// services and tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	now     func() time.Time
+}
+
+type memoryRecord struct {
+	record  Record
+	expires time.Time
+}
+
+// NewMemoryStore constructs an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]memoryRecord), now: time.Now}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key).record, nil
+}
+
+// Increment implements Store.
+func (s *MemoryStore) Increment(_ context.Context, key string, now time.Time, window, ttl time.Duration) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.get(key)
+	if !entry.record.LastFailure.IsZero() && now.Sub(entry.record.LastFailure) > window {
+		entry.record.Failures = 0
+	}
+	entry.record.Failures++
+	entry.record.LastFailure = now
+	s.put(entry, ttl)
+	return entry.record, nil
+}
+
+// Lock implements Store.
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time, ttl time.Duration) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.get(key)
+	entry.record.LockedUntil = until
+	entry.record.Lockouts++
+	entry.record.Failures = 0
+	s.put(entry, ttl)
+	return entry.record, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// get returns the live entry for key; callers hold s.mu.
+func (s *MemoryStore) get(key string) memoryRecord {
+	entry, ok := s.records[key]
+	if !ok || !s.now().Before(entry.expires) {
+		delete(s.records, key)
+		return memoryRecord{record: Record{Key: key}}
+	}
+	return entry
+}
+
+// put stores entry, extending but never shortening its expiry; callers hold
+// s.mu.
+func (s *MemoryStore) put(entry memoryRecord, ttl time.Duration) {
+	if expires := s.now().Add(ttl); expires.After(entry.expires) {
+		entry.expires = expires
+	}
+	s.records[entry.record.Key] = entry
+}
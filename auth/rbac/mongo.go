@@ -0,0 +1,125 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoStore keeps roles, grants and policies in the _rbac_roles,
+// _rbac_grants and _rbac_policies collections of db.
+func NewMongoStore(db *mongo.Database) Store {
+	return Store{
+		Roles:    NewMongoCollection[auth.Role](db.Collection("_rbac_roles")),
+		Grants:   NewMongoCollection[auth.Grant](db.Collection("_rbac_grants")),
+		Policies: NewMongoCollection[auth.ResourcePolicy](db.Collection("_rbac_policies")),
+	}
+}
+
+// MongoCollection is a Collection backed by a Mongo collection. Revisions
+// are checked in the update filter, so concurrent writers cannot overwrite
+// each other.
+type MongoCollection[T any] struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCollection stores records in collection.
+func NewMongoCollection[T any](collection *mongo.Collection) *MongoCollection[T] {
+	return &MongoCollection[T]{collection: collection}
+}
+
+type mongoRecord[T any] struct {
+	ID        string    `bson:"_id"`
+	Value     T         `bson:"value"`
+	Revision  int       `bson:"revision"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (m mongoRecord[T]) record() Record[T] {
+	return Record[T]{ID: m.ID, Value: m.Value, Revision: m.Revision, UpdatedAt: m.UpdatedAt}
+}
+
+// List implements Collection, ordered by ID.
+func (c *MongoCollection[T]) List(ctx context.Context) ([]Record[T], error) {
+	cur, err := c.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("rbac: list %s: %w", c.collection.Name(), err)
+	}
+	defer cur.Close(ctx)
+	var out []Record[T]
+	for cur.Next(ctx) {
+		var m mongoRecord[T]
+		if err := cur.Decode(&m); err != nil {
+			return nil, fmt.Errorf("rbac: decode %s: %w", c.collection.Name(), err)
+		}
+		out = append(out, m.record())
+	}
+	return out, cur.Err()
+}
+
+// Get implements Collection.
+func (c *MongoCollection[T]) Get(ctx context.Context, id string) (Record[T], error) {
+	var m mongoRecord[T]
+	err := c.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&m)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Record[T]{}, ErrNotFound
+	}
+	if err != nil {
+		return Record[T]{}, fmt.Errorf("rbac: get %s: %w", id, err)
+	}
+	return m.record(), nil
+}
+
+// Create implements Collection.
+func (c *MongoCollection[T]) Create(ctx context.Context, id string, value T) (Record[T], error) {
+	m := mongoRecord[T]{ID: id, Value: value, Revision: 1, UpdatedAt: time.Now().UTC()}
+	if _, err := c.collection.InsertOne(ctx, m); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return Record[T]{}, ErrExists
+		}
+		return Record[T]{}, fmt.Errorf("rbac: create %s: %w", id, err)
+	}
+	return m.record(), nil
+}
+
+// Update implements Collection.
+func (c *MongoCollection[T]) Update(ctx context.Context, id string, value T, revision int) (Record[T], error) {
+	m := mongoRecord[T]{ID: id, Value: value, Revision: revision + 1, UpdatedAt: time.Now().UTC()}
+	res, err := c.collection.ReplaceOne(ctx, bson.M{"_id": id, "revision": revision}, m)
+	if err != nil {
+		return Record[T]{}, fmt.Errorf("rbac: update %s: %w", id, err)
+	}
+	if res.MatchedCount == 0 {
+		return Record[T]{}, c.missOrConflict(ctx, id)
+	}
+	return m.record(), nil
+}
+
+// Delete implements Collection.
+func (c *MongoCollection[T]) Delete(ctx context.Context, id string, revision int) error {
+	res, err := c.collection.DeleteOne(ctx, bson.M{"_id": id, "revision": revision})
+	if err != nil {
+		return fmt.Errorf("rbac: delete %s: %w", id, err)
+	}
+	if res.DeletedCount == 0 {
+		return c.missOrConflict(ctx, id)
+	}
+	return nil
+}
+
+func (c *MongoCollection[T]) missOrConflict(ctx context.Context, id string) error {
+	n, err := c.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("rbac: check %s: %w", id, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
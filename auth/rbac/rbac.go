@@ -0,0 +1,516 @@
+// Package rbac provides a mountable admin API managing roles, grants and
+// resource policies, so services do not hand-build RBAC administration.
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const defaultBasePath = "/admin/rbac"
+
+// Kinds of managed records, as reported in Change.
+const (
+	KindRole   = "role"
+	KindGrant  = "grant"
+	KindPolicy = "policy"
+)
+
+// Change describes a successful write, for audit and cache invalidation.
+type Change struct {
+	Kind     string
+	ID       string
+	Action   string // create, update or delete
+	Revision int
+	Actor    string
+}
+
+// Module serves the admin API. It implements aqm.HTTPModule and
+// auth.GrantSource, so an auth.Resolver can read grants from it directly.
+type Module struct {
+	store    Store
+	basePath string
+	log      aqm.Logger
+	onChange func(ctx context.Context, change Change)
+}
+
+// Option configures a Module.
+type Option func(*Module)
+
+// WithBasePath overrides the mount point (defaults to /admin/rbac).
+func WithBasePath(base string) Option {
+	return func(m *Module) {
+		if base != "" {
+			m.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithLogger wires the logger audit lines are written to.
+func WithLogger(logger aqm.Logger) Option {
+	return func(m *Module) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// WithOnChange calls fn after every successful write, e.g. to invalidate an
+// auth.Resolver or bump the authorization version of affected users.
+func WithOnChange(fn func(ctx context.Context, change Change)) Option {
+	return func(m *Module) {
+		m.onChange = fn
+	}
+}
+
+// New returns a Module managing store. A zero Store defaults to memory.
+func New(store Store, opts ...Option) *Module {
+	if store.Roles == nil || store.Grants == nil || store.Policies == nil {
+		store = NewMemoryStore()
+	}
+	m := &Module{store: store, basePath: defaultBasePath, log: aqm.NewNoopLogger()}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// RegisterRoutes implements aqm.HTTPModule. Every collection is served under
+// {base}/roles, {base}/grants and {base}/policies with GET and POST on the
+// collection and GET, PUT and DELETE on items. Responses carry the record
+// revision as ETag; PUT and DELETE require it in If-Match and answer 412
+// with version_conflict when it is stale. Mount it behind admin
+// authentication.
+func (m *Module) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Route(m.basePath, func(r chi.Router) {
+		mount(r, m, "/roles", m.roles())
+		mount(r, m, "/grants", m.grants())
+		mount(r, m, "/policies", m.policies())
+	})
+}
+
+// UserGrants implements auth.GrantSource.
+func (m *Module) UserGrants(ctx context.Context, userID string) ([]auth.Grant, error) {
+	records, err := m.store.Grants.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var grants []auth.Grant
+	for _, r := range records {
+		if r.Value.UserID.String() == userID {
+			grants = append(grants, r.Value)
+		}
+	}
+	return grants, nil
+}
+
+// Roles implements auth.GrantSource.
+func (m *Module) Roles(ctx context.Context) ([]auth.Role, error) {
+	records, err := m.store.Roles.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]auth.Role, 0, len(records))
+	for _, r := range records {
+		roles = append(roles, r.Value)
+	}
+	return roles, nil
+}
+
+// resource wires one collection into the generic handlers.
+type resource[T, In any] struct {
+	kind       string
+	collection Collection[T]
+	// build turns input into a value; id is empty on create.
+	build func(id string, in In) (string, T)
+	// validate checks a value before it is written.
+	validate func(ctx context.Context, value T) auth.ValidationErrors
+	// beforeDelete may veto a delete with an error code and message.
+	beforeDelete func(ctx context.Context, id string) (string, string, error)
+	view         func(Record[T]) any
+	// filter keeps list entries matching the query; nil keeps all.
+	filter func(r *http.Request, value T) bool
+}
+
+func mount[T, In any](r chi.Router, m *Module, path string, res resource[T, In]) {
+	r.Get(path, func(w http.ResponseWriter, r *http.Request) {
+		records, err := res.collection.List(r.Context())
+		if err != nil {
+			m.fail(w, res.kind, err)
+			return
+		}
+		views := make([]any, 0, len(records))
+		for _, rec := range records {
+			if res.filter == nil || res.filter(r, rec.Value) {
+				views = append(views, res.view(rec))
+			}
+		}
+		aqm.RespondSuccess(w, views)
+	})
+
+	r.Post(path, func(w http.ResponseWriter, r *http.Request) {
+		var in In
+		if !decode(w, r, &in) {
+			return
+		}
+		id, value := res.build("", in)
+		if errs := res.validate(r.Context(), value); len(errs) > 0 {
+			invalid(w, errs)
+			return
+		}
+		rec, err := res.collection.Create(r.Context(), id, value)
+		if err != nil {
+			m.fail(w, res.kind, err)
+			return
+		}
+		m.changed(r.Context(), Change{Kind: res.kind, ID: id, Action: "create", Revision: rec.Revision})
+		w.Header().Set("ETag", etag(rec.Revision))
+		aqm.Respond(w, http.StatusCreated, res.view(rec), nil)
+	})
+
+	r.Get(path+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rec, err := res.collection.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			m.fail(w, res.kind, err)
+			return
+		}
+		w.Header().Set("ETag", etag(rec.Revision))
+		aqm.RespondSuccess(w, res.view(rec))
+	})
+
+	r.Put(path+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		revision, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		var in In
+		if !decode(w, r, &in) {
+			return
+		}
+		id, value := res.build(chi.URLParam(r, "id"), in)
+		if errs := res.validate(r.Context(), value); len(errs) > 0 {
+			invalid(w, errs)
+			return
+		}
+		rec, err := res.collection.Update(r.Context(), id, value, revision)
+		if err != nil {
+			m.fail(w, res.kind, err)
+			return
+		}
+		m.changed(r.Context(), Change{Kind: res.kind, ID: id, Action: "update", Revision: rec.Revision})
+		w.Header().Set("ETag", etag(rec.Revision))
+		aqm.RespondSuccess(w, res.view(rec))
+	})
+
+	r.Delete(path+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		revision, ok := ifMatch(w, r)
+		if !ok {
+			return
+		}
+		id := chi.URLParam(r, "id")
+		if res.beforeDelete != nil {
+			code, msg, err := res.beforeDelete(r.Context(), id)
+			if err != nil {
+				m.fail(w, res.kind, err)
+				return
+			}
+			if code != "" {
+				aqm.Error(w, http.StatusConflict, code, msg)
+				return
+			}
+		}
+		if err := res.collection.Delete(r.Context(), id, revision); err != nil {
+			m.fail(w, res.kind, err)
+			return
+		}
+		m.changed(r.Context(), Change{Kind: res.kind, ID: id, Action: "delete", Revision: revision})
+		aqm.Respond(w, http.StatusNoContent, nil, nil)
+	})
+}
+
+func (m *Module) changed(ctx context.Context, change Change) {
+	if actor := auth.ActorFrom(ctx); actor != nil {
+		change.Actor = actor.Subject
+	}
+	m.log.Info("rbac change", "action", change.Action, "kind", change.Kind, "id", change.ID,
+		"revision", change.Revision, "actor", change.Actor)
+	if m.onChange != nil {
+		m.onChange(ctx, change)
+	}
+}
+
+func (m *Module) fail(w http.ResponseWriter, kind string, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		aqm.Error(w, http.StatusNotFound, "not_found", kind+" not found")
+	case errors.Is(err, ErrExists):
+		aqm.Error(w, http.StatusConflict, "already_exists", kind+" already exists")
+	case errors.Is(err, ErrConflict):
+		aqm.Error(w, http.StatusPreconditionFailed, "version_conflict", kind+" was modified, reload and retry")
+	default:
+		m.log.Error("rbac store failed", "kind", kind, "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "store_failed", "cannot access "+kind+" store")
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		aqm.Error(w, http.StatusBadRequest, "invalid_body", "request body is not valid JSON")
+		return false
+	}
+	return true
+}
+
+func invalid(w http.ResponseWriter, errs auth.ValidationErrors) {
+	details := make([]aqm.ValidationError, 0, len(errs))
+	for _, e := range errs {
+		details = append(details, aqm.ValidationError{Field: e.Field, Code: e.Code, Message: e.Message})
+	}
+	aqm.Error(w, http.StatusUnprocessableEntity, "validation_failed", "request is invalid", details...)
+}
+
+func etag(revision int) string {
+	return `"` + strconv.Itoa(revision) + `"`
+}
+
+func ifMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`)
+	if raw == "" {
+		aqm.Error(w, http.StatusPreconditionRequired, "precondition_required", "If-Match with the current revision is required")
+		return 0, false
+	}
+	revision, err := strconv.Atoi(raw)
+	if err != nil {
+		aqm.Error(w, http.StatusBadRequest, "invalid_if_match", "If-Match must be a revision ETag")
+		return 0, false
+	}
+	return revision, true
+}
+
+// RoleInput is the body of role writes.
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleView is the representation of a role.
+type RoleView struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	Revision    int       `json:"revision"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (m *Module) roles() resource[auth.Role, RoleInput] {
+	return resource[auth.Role, RoleInput]{
+		kind:       KindRole,
+		collection: m.store.Roles,
+		build: func(id string, in RoleInput) (string, auth.Role) {
+			roleID, err := uuid.Parse(id)
+			if err != nil {
+				roleID = uuid.New()
+			}
+			return roleID.String(), auth.Role{ID: roleID, Name: in.Name, Permissions: in.Permissions}
+		},
+		validate: func(_ context.Context, role auth.Role) auth.ValidationErrors {
+			var errs auth.ValidationErrors
+			if strings.TrimSpace(role.Name) == "" {
+				errs = append(errs, auth.ValidationError{Field: "name", Code: "required", Message: "Role name is required"})
+			}
+			if len(role.Permissions) == 0 {
+				errs = append(errs, auth.ValidationError{Field: "permissions", Code: "required", Message: "Role must have at least one permission"})
+			}
+			for i, p := range role.Permissions {
+				for _, e := range auth.ValidatePermissionCode(p) {
+					e.Field = "permissions." + strconv.Itoa(i)
+					errs = append(errs, e)
+				}
+			}
+			return errs
+		},
+		beforeDelete: func(ctx context.Context, id string) (string, string, error) {
+			grants, err := m.store.Grants.List(ctx)
+			if err != nil {
+				return "", "", err
+			}
+			for _, g := range grants {
+				if g.Value.GrantType == auth.GrantTypeRole && g.Value.Value == id {
+					return "role_in_use", "role is still granted, revoke its grants first", nil
+				}
+			}
+			return "", "", nil
+		},
+		view: func(r Record[auth.Role]) any {
+			return RoleView{ID: r.ID, Name: r.Value.Name, Permissions: r.Value.Permissions, Revision: r.Revision, UpdatedAt: r.UpdatedAt}
+		},
+	}
+}
+
+// ScopeView is the JSON form of auth.Scope.
+type ScopeView struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// GrantInput is the body of grant writes.
+type GrantInput struct {
+	UserID    string     `json:"user_id"`
+	GrantType string     `json:"grant_type"`
+	Value     string     `json:"value"`
+	Scope     ScopeView  `json:"scope"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// GrantView is the representation of a grant.
+type GrantView struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	GrantType string     `json:"grant_type"`
+	Value     string     `json:"value"`
+	Scope     ScopeView  `json:"scope"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Revision  int        `json:"revision"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (m *Module) grants() resource[auth.Grant, GrantInput] {
+	return resource[auth.Grant, GrantInput]{
+		kind:       KindGrant,
+		collection: m.store.Grants,
+		build: func(id string, in GrantInput) (string, auth.Grant) {
+			grantID, err := uuid.Parse(id)
+			if err != nil {
+				grantID = uuid.New()
+			}
+			userID, _ := uuid.Parse(in.UserID)
+			return grantID.String(), auth.Grant{
+				ID:        grantID,
+				UserID:    userID,
+				GrantType: auth.GrantType(in.GrantType),
+				Value:     in.Value,
+				Scope:     auth.Scope{Type: in.Scope.Type, ID: in.Scope.ID},
+				ExpiresAt: in.ExpiresAt,
+			}
+		},
+		validate: func(ctx context.Context, g auth.Grant) auth.ValidationErrors {
+			var errs auth.ValidationErrors
+			if g.UserID == uuid.Nil {
+				errs = append(errs, auth.ValidationError{Field: "user_id", Code: "invalid_value", Message: "User ID must be a UUID"})
+			}
+			switch g.GrantType {
+			case auth.GrantTypePermission:
+				for _, e := range auth.ValidatePermissionCode(g.Value) {
+					e.Field = "value"
+					errs = append(errs, e)
+				}
+			case auth.GrantTypeRole:
+				if _, err := m.store.Roles.Get(ctx, g.Value); err != nil {
+					errs = append(errs, auth.ValidationError{Field: "value", Code: "unknown_role", Message: "Role does not exist"})
+				}
+			default:
+				errs = append(errs, auth.ValidationError{Field: "grant_type", Code: "invalid_value", Message: "Grant type must be role or permission"})
+			}
+			if g.Scope.Type == "" || (g.Scope.Type != auth.GlobalScope.Type && g.Scope.ID == "") {
+				errs = append(errs, auth.ValidationError{Field: "scope", Code: "invalid_scope", Message: "Scope needs a type and, unless global, an ID"})
+			}
+			if g.ExpiresAt != nil && !g.ExpiresAt.After(time.Now()) {
+				errs = append(errs, auth.ValidationError{Field: "expires_at", Code: "invalid_value", Message: "Expiry must be in the future"})
+			}
+			return errs
+		},
+		view: func(r Record[auth.Grant]) any {
+			g := r.Value
+			return GrantView{
+				ID:        r.ID,
+				UserID:    g.UserID.String(),
+				GrantType: string(g.GrantType),
+				Value:     g.Value,
+				Scope:     ScopeView{Type: g.Scope.Type, ID: g.Scope.ID},
+				ExpiresAt: g.ExpiresAt,
+				Revision:  r.Revision,
+				UpdatedAt: r.UpdatedAt,
+			}
+		},
+		filter: func(r *http.Request, g auth.Grant) bool {
+			user := r.URL.Query().Get("user_id")
+			return user == "" || g.UserID.String() == user
+		},
+	}
+}
+
+// RuleView is the JSON form of auth.PolicyRule.
+type RuleView struct {
+	AnyOf []string `json:"any_of,omitempty"`
+	AllOf []string `json:"all_of,omitempty"`
+}
+
+// PolicyInput is the body of policy writes. ID is ignored on updates and
+// generated on create when empty.
+type PolicyInput struct {
+	ID      string              `json:"id,omitempty"`
+	Type    string              `json:"type"`
+	Version int                 `json:"version"`
+	Actions map[string]RuleView `json:"actions"`
+}
+
+// PolicyView is the representation of a resource policy. Version is the
+// policy's own version; Revision is the record revision used for
+// concurrency.
+type PolicyView struct {
+	ID        string              `json:"id"`
+	Type      string              `json:"type"`
+	Version   int                 `json:"version"`
+	Actions   map[string]RuleView `json:"actions"`
+	Revision  int                 `json:"revision"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+func (m *Module) policies() resource[auth.ResourcePolicy, PolicyInput] {
+	return resource[auth.ResourcePolicy, PolicyInput]{
+		kind:       KindPolicy,
+		collection: m.store.Policies,
+		build: func(id string, in PolicyInput) (string, auth.ResourcePolicy) {
+			if id == "" {
+				id = in.ID
+			}
+			if id == "" {
+				id = uuid.NewString()
+			}
+			actions := make(map[string]auth.PolicyRule, len(in.Actions))
+			for name, rule := range in.Actions {
+				actions[name] = auth.PolicyRule{AnyOf: rule.AnyOf, AllOf: rule.AllOf}
+			}
+			return id, auth.ResourcePolicy{ID: id, Type: in.Type, Version: in.Version, Actions: actions}
+		},
+		validate: func(_ context.Context, p auth.ResourcePolicy) auth.ValidationErrors {
+			return auth.ValidatePolicy(p)
+		},
+		view: func(r Record[auth.ResourcePolicy]) any {
+			actions := make(map[string]RuleView, len(r.Value.Actions))
+			for name, rule := range r.Value.Actions {
+				actions[name] = RuleView{AnyOf: rule.AnyOf, AllOf: rule.AllOf}
+			}
+			return PolicyView{ID: r.ID, Type: r.Value.Type, Version: r.Value.Version, Actions: actions, Revision: r.Revision, UpdatedAt: r.UpdatedAt}
+		},
+		filter: func(r *http.Request, p auth.ResourcePolicy) bool {
+			kind := r.URL.Query().Get("type")
+			return kind == "" || p.Type == kind
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type client struct {
+	t      *testing.T
+	router chi.Router
+}
+
+func (c client) do(method, path, ifMatch string, body any) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, "/admin/rbac"+path, &buf)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	req = req.WithContext(auth.WithClaims(req.Context(), &auth.TokenClaims{Subject: "admin-1"}))
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeData[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var env struct {
+		Data T `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return env.Data
+}
+
+func newClient(t *testing.T, opts ...Option) (client, *Module) {
+	m := New(Store{}, opts...)
+	router := chi.NewRouter()
+	m.RegisterRoutes(router)
+	return client{t: t, router: router}, m
+}
+
+func TestRoleLifecycleWithOptimisticConcurrency(t *testing.T) {
+	var changes []Change
+	c, _ := newClient(t, WithOnChange(func(_ context.Context, ch Change) { changes = append(changes, ch) }))
+
+	rec := c.do("POST", "/roles", "", RoleInput{Name: "viewer", Permissions: []string{"projects:read"}})
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") != `"1"` {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	role := decodeData[RoleView](t, rec)
+
+	update := RoleInput{Name: "viewer", Permissions: []string{"projects:read", "projects:list"}}
+	if rec := c.do("PUT", "/roles/"+role.ID, "", update); rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("update without If-Match: %d", rec.Code)
+	}
+	if rec := c.do("PUT", "/roles/"+role.ID, `"1"`, update); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body)
+	}
+	if rec := c.do("PUT", "/roles/"+role.ID, `"1"`, update); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale update: %d", rec.Code)
+	}
+
+	rec = c.do("GET", "/roles/"+role.ID, "", nil)
+	if got := decodeData[RoleView](t, rec); len(got.Permissions) != 2 || got.Revision != 2 {
+		t.Fatalf("get = %+v", got)
+	}
+	if rec := c.do("DELETE", "/roles/"+role.ID, `"2"`, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+	if rec := c.do("GET", "/roles/"+role.ID, "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: %d", rec.Code)
+	}
+
+	if len(changes) != 3 || changes[2].Action != "delete" || changes[0].Actor != "admin-1" {
+		t.Fatalf("changes = %+v", changes)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	c, _ := newClient(t)
+
+	rec := c.do("POST", "/roles", "", RoleInput{Permissions: []string{"Not Valid"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid role: %d", rec.Code)
+	}
+	var env struct {
+		Error struct {
+			Details []struct{ Field string } `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if len(env.Error.Details) != 2 {
+		t.Fatalf("details = %s", rec.Body)
+	}
+
+	grant := GrantInput{UserID: uuid.NewString(), GrantType: "role", Value: uuid.NewString(), Scope: ScopeView{Type: "global"}}
+	if rec := c.do("POST", "/grants", "", grant); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("grant of unknown role: %d", rec.Code)
+	}
+	if rec := c.do("POST", "/policies", "", PolicyInput{Type: "project", Version: 1}); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("policy without actions: %d", rec.Code)
+	}
+	policy := PolicyInput{ID: "project-v1", Type: "project", Version: 1, Actions: map[string]RuleView{"read": {AnyOf: []string{"projects:read"}}}}
+	if rec := c.do("POST", "/policies", "", policy); rec.Code != http.StatusCreated {
+		t.Fatalf("policy: %d %s", rec.Code, rec.Body)
+	}
+	if rec := c.do("POST", "/policies", "", policy); rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate policy: %d", rec.Code)
+	}
+}
+
+func TestGrantsFeedResolver(t *testing.T) {
+	c, m := newClient(t)
+	user := uuid.NewString()
+
+	role := decodeData[RoleView](t, c.do("POST", "/roles", "", RoleInput{Name: "editor", Permissions: []string{"projects:write"}}))
+	expires := time.Now().Add(time.Hour)
+	rec := c.do("POST", "/grants", "", GrantInput{UserID: user, GrantType: "role", Value: role.ID, Scope: ScopeView{Type: "org", ID: "acme"}, ExpiresAt: &expires})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("grant: %d %s", rec.Code, rec.Body)
+	}
+	c.do("POST", "/grants", "", GrantInput{UserID: uuid.NewString(), GrantType: "permission", Value: "billing:read", Scope: ScopeView{Type: "global"}})
+
+	if got := decodeData[[]GrantView](t, c.do("GET", "/grants?user_id="+user, "", nil)); len(got) != 1 {
+		t.Fatalf("filtered grants = %+v", got)
+	}
+	if rec := c.do("DELETE", "/roles/"+role.ID, `"1"`, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("delete granted role: %d", rec.Code)
+	}
+
+	resolver := auth.NewResolver(m, time.Minute)
+	ok, err := resolver.CheckPermission(context.Background(), user, "projects:write", "org:acme/project:web")
+	if err != nil || !ok {
+		t.Fatalf("resolver = %v, %v", ok, err)
+	}
+}
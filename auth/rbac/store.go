@@ -0,0 +1,136 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+var (
+	// ErrNotFound is returned when no record has the requested ID.
+	ErrNotFound = errors.New("rbac: not found")
+	// ErrExists is returned when creating a record whose ID is taken.
+	ErrExists = errors.New("rbac: already exists")
+	// ErrConflict is returned when the expected revision is not current.
+	ErrConflict = errors.New("rbac: revision conflict")
+)
+
+// Record is a stored value with the revision used for optimistic
+// concurrency. Revisions start at 1 and grow with every update.
+type Record[T any] struct {
+	ID        string
+	Value     T
+	Revision  int
+	UpdatedAt time.Time
+}
+
+// Collection stores one kind of record.
+type Collection[T any] interface {
+	List(ctx context.Context) ([]Record[T], error)
+	Get(ctx context.Context, id string) (Record[T], error)
+	// Create stores value under id at revision 1, failing with ErrExists.
+	Create(ctx context.Context, id string, value T) (Record[T], error)
+	// Update replaces the value when revision is current, failing with
+	// ErrConflict otherwise and ErrNotFound when id does not exist.
+	Update(ctx context.Context, id string, value T, revision int) (Record[T], error)
+	// Delete removes the record when revision is current.
+	Delete(ctx context.Context, id string, revision int) error
+}
+
+// Store groups the collections managed by the module.
+type Store struct {
+	Roles    Collection[auth.Role]
+	Grants   Collection[auth.Grant]
+	Policies Collection[auth.ResourcePolicy]
+}
+
+// NewMemoryStore keeps everything in process memory, for tests and
+// single-instance services.
+func NewMemoryStore() Store {
+	return Store{
+		Roles:    NewMemoryCollection[auth.Role](),
+		Grants:   NewMemoryCollection[auth.Grant](),
+		Policies: NewMemoryCollection[auth.ResourcePolicy](),
+	}
+}
+
+// MemoryCollection is an in-memory Collection.
+type MemoryCollection[T any] struct {
+	mu      sync.RWMutex
+	records map[string]Record[T]
+}
+
+// NewMemoryCollection builds an empty collection.
+func NewMemoryCollection[T any]() *MemoryCollection[T] {
+	return &MemoryCollection[T]{records: make(map[string]Record[T])}
+}
+
+// List implements Collection, ordered by ID.
+func (c *MemoryCollection[T]) List(context.Context) ([]Record[T], error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]Record[T], 0, len(c.records))
+	for _, r := range c.records {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// Get implements Collection.
+func (c *MemoryCollection[T]) Get(_ context.Context, id string) (Record[T], error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r, ok := c.records[id]
+	if !ok {
+		return Record[T]{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// Create implements Collection.
+func (c *MemoryCollection[T]) Create(_ context.Context, id string, value T) (Record[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.records[id]; ok {
+		return Record[T]{}, ErrExists
+	}
+	r := Record[T]{ID: id, Value: value, Revision: 1, UpdatedAt: time.Now().UTC()}
+	c.records[id] = r
+	return r, nil
+}
+
+// Update implements Collection.
+func (c *MemoryCollection[T]) Update(_ context.Context, id string, value T, revision int) (Record[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, ok := c.records[id]
+	if !ok {
+		return Record[T]{}, ErrNotFound
+	}
+	if current.Revision != revision {
+		return Record[T]{}, ErrConflict
+	}
+	r := Record[T]{ID: id, Value: value, Revision: revision + 1, UpdatedAt: time.Now().UTC()}
+	c.records[id] = r
+	return r, nil
+}
+
+// Delete implements Collection.
+func (c *MemoryCollection[T]) Delete(_ context.Context, id string, revision int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, ok := c.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.Revision != revision {
+		return ErrConflict
+	}
+	delete(c.records, id)
+	return nil
+}
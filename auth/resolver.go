@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GlobalScope is the root of every scope chain.
+var GlobalScope = Scope{Type: "global"}
+
+// ScopeChain lists scopes from the broadest to the narrowest, such as
+// global → org → project. Grants on any scope of the chain apply to the
+// last one.
+type ScopeChain []Scope
+
+// NewScopeChain returns global followed by scopes.
+func NewScopeChain(scopes ...Scope) ScopeChain {
+	return append(ScopeChain{GlobalScope}, scopes...)
+}
+
+// ParseScopeChain parses a resource path such as "org:acme/project:web" into
+// global, org acme and project web. An empty resource is the global chain.
+func ParseScopeChain(resource string) (ScopeChain, error) {
+	chain := NewScopeChain()
+	if resource == "" {
+		return chain, nil
+	}
+	for _, part := range strings.Split(resource, "/") {
+		scopeType, id, ok := strings.Cut(part, ":")
+		if !ok || scopeType == "" || id == "" {
+			return nil, fmt.Errorf("%w: %q is not type:id", ErrInvalidScope, part)
+		}
+		chain = append(chain, Scope{Type: scopeType, ID: id})
+	}
+	return chain, nil
+}
+
+// String formats the chain below global as ParseScopeChain reads it.
+func (c ScopeChain) String() string {
+	parts := make([]string, 0, len(c))
+	for _, s := range c {
+		if s.Type != GlobalScope.Type {
+			parts = append(parts, s.Type+":"+s.ID)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// GrantSource loads the grants of a user and the role definitions they
+// reference by role ID.
+type GrantSource interface {
+	UserGrants(ctx context.Context, userID string) ([]Grant, error)
+	Roles(ctx context.Context) ([]Role, error)
+}
+
+// Resolver computes the effective permissions of users over scope chains,
+// expanding role grants and merging direct permission grants while skipping
+// expired ones. Results are cached per user and chain, never beyond the
+// expiry of the grants they came from. It implements AuthzClient with
+// resources given as scope paths, so it can back an AuthzHelper.
+type Resolver struct {
+	source GrantSource
+	cache  *StringTTLCache[resolved]
+	now    func() time.Time
+}
+
+// NewResolver resolves grants from source, caching results for cacheTTL.
+func NewResolver(source GrantSource, cacheTTL time.Duration) *Resolver {
+	return &Resolver{
+		source: source,
+		cache:  NewStringTTLCache[resolved](cacheTTL),
+		now:    time.Now,
+	}
+}
+
+// resolved is a cached result, valid until the first of its grants
+// expires.
+type resolved struct {
+	perms      []string
+	validUntil time.Time
+}
+
+// EffectivePermissions returns the sorted permissions userID holds on the
+// last scope of chain.
+func (r *Resolver) EffectivePermissions(ctx context.Context, userID string, chain ScopeChain) ([]string, error) {
+	key := userID + "|" + chain.String()
+	load := func(ctx context.Context) (resolved, error) {
+		return r.resolve(ctx, userID, chain)
+	}
+	result, err := r.cache.GetOrLoad(ctx, key, load)
+	if err == nil && !result.validUntil.IsZero() && r.now().After(result.validUntil) {
+		r.cache.Delete(key)
+		result, err = r.cache.GetOrLoad(ctx, key, load)
+	}
+	return result.perms, err
+}
+
+func (r *Resolver) resolve(ctx context.Context, userID string, chain ScopeChain) (resolved, error) {
+	grants, err := r.source.UserGrants(ctx, userID)
+	if err != nil {
+		return resolved{}, fmt.Errorf("loading grants of %s: %w", userID, err)
+	}
+	roles, err := r.source.Roles(ctx)
+	if err != nil {
+		return resolved{}, fmt.Errorf("loading roles: %w", err)
+	}
+
+	now := r.now()
+	var result resolved
+	valid := FilterValidGrants(grants, now)
+	for _, g := range valid {
+		if g.ExpiresAt != nil && (result.validUntil.IsZero() || g.ExpiresAt.Before(result.validUntil)) {
+			result.validUntil = *g.ExpiresAt
+		}
+	}
+	seen := make(map[string]bool)
+	for _, scope := range chain {
+		for _, p := range GetUserPermissions(valid, roles, scope, now) {
+			if !seen[p] {
+				seen[p] = true
+				result.perms = append(result.perms, p)
+			}
+		}
+	}
+	slices.Sort(result.perms)
+	return result, nil
+}
+
+// HasPermission reports whether userID holds permission on the last scope
+// of chain.
+func (r *Resolver) HasPermission(ctx context.Context, userID, permission string, chain ScopeChain) (bool, error) {
+	perms, err := r.EffectivePermissions(ctx, userID, chain)
+	if err != nil {
+		return false, err
+	}
+	_, found := slices.BinarySearch(perms, permission)
+	return found, nil
+}
+
+// CheckPermission implements AuthzClient; resource is a scope path as read
+// by ParseScopeChain.
+func (r *Resolver) CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error) {
+	chain, err := ParseScopeChain(resource)
+	if err != nil {
+		return false, err
+	}
+	return r.HasPermission(ctx, userID, permission, chain)
+}
+
+// Authorize evaluates action of policy against the effective permissions of
+// userID on chain.
+func (r *Resolver) Authorize(ctx context.Context, userID string, policy ResourcePolicy, action string, chain ScopeChain) (bool, error) {
+	perms, err := r.EffectivePermissions(ctx, userID, chain)
+	if err != nil {
+		return false, err
+	}
+	return EvaluatePolicy(policy, action, perms), nil
+}
+
+// Invalidate drops the cached results of userID, e.g. after its grants
+// changed. Pair it with AuthzHelper.ClearUserCache when both are used.
+func (r *Resolver) Invalidate(userID string) {
+	r.cache.DeleteByPrefix(userID + "|")
+}
+
+// InvalidateAll drops every cached result, e.g. after a role changed.
+func (r *Resolver) InvalidateAll() {
+	r.cache.Clear()
+}
+
+// MemoryGrantSource is an in-memory GrantSource for tests and small
+// deployments.
+type MemoryGrantSource struct {
+	mu     sync.RWMutex
+	grants map[string][]Grant
+	roles  []Role
+}
+
+// NewMemoryGrantSource builds a source with roles.
+func NewMemoryGrantSource(roles ...Role) *MemoryGrantSource {
+	return &MemoryGrantSource{grants: make(map[string][]Grant), roles: roles}
+}
+
+// AddGrant stores grant for userID.
+func (s *MemoryGrantSource) AddGrant(userID string, grant Grant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grants[userID] = append(s.grants[userID], grant)
+}
+
+// UserGrants implements GrantSource.
+func (s *MemoryGrantSource) UserGrants(_ context.Context, userID string) ([]Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.grants[userID]), nil
+}
+
+// Roles implements GrantSource.
+func (s *MemoryGrantSource) Roles(context.Context) ([]Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.roles), nil
+}
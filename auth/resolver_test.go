@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseScopeChain(t *testing.T) {
+	chain, err := ParseScopeChain("org:acme/project:web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ScopeChain{GlobalScope, {Type: "org", ID: "acme"}, {Type: "project", ID: "web"}}
+	if fmt.Sprint(chain) != fmt.Sprint(want) || chain.String() != "org:acme/project:web" {
+		t.Fatalf("chain = %v", chain)
+	}
+	if _, err := ParseScopeChain("org"); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("malformed chain error = %v", err)
+	}
+}
+
+func TestResolverEffectivePermissions(t *testing.T) {
+	viewer := Role{ID: uuid.New(), Name: "viewer", Permissions: []string{"projects:read"}}
+	editor := Role{ID: uuid.New(), Name: "editor", Permissions: []string{"projects:read", "projects:write"}}
+	source := NewMemoryGrantSource(viewer, editor)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	source.AddGrant("u1", Grant{GrantType: GrantTypePermission, Value: "billing:read", Scope: GlobalScope})
+	source.AddGrant("u1", Grant{GrantType: GrantTypeRole, Value: viewer.ID.String(), Scope: Scope{Type: "org", ID: "acme"}})
+	source.AddGrant("u1", Grant{GrantType: GrantTypeRole, Value: editor.ID.String(), Scope: Scope{Type: "project", ID: "web"}, ExpiresAt: &expires})
+	source.AddGrant("u1", Grant{GrantType: GrantTypePermission, Value: "projects:delete", Scope: Scope{Type: "project", ID: "api"}})
+
+	resolver := NewResolver(source, time.Minute)
+	resolver.now = func() time.Time { return now }
+	ctx := context.Background()
+	web := NewScopeChain(Scope{Type: "org", ID: "acme"}, Scope{Type: "project", ID: "web"})
+
+	perms, err := resolver.EffectivePermissions(ctx, "u1", web)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(perms); got != "[billing:read projects:read projects:write]" {
+		t.Fatalf("web permissions = %s", got)
+	}
+	if ok, _ := resolver.CheckPermission(ctx, "u1", "projects:delete", "org:acme/project:web"); ok {
+		t.Fatal("grant on a sibling project leaked")
+	}
+	if ok, _ := resolver.CheckPermission(ctx, "u1", "projects:read", "org:acme/project:api"); !ok {
+		t.Fatal("org role not inherited by project")
+	}
+
+	// Once the editor grant expires the cached result is discarded.
+	now = expires.Add(time.Second)
+	perms, _ = resolver.EffectivePermissions(ctx, "u1", web)
+	if got := fmt.Sprint(perms); got != "[billing:read projects:read]" {
+		t.Fatalf("permissions after expiry = %s", got)
+	}
+
+	source.AddGrant("u1", Grant{GrantType: GrantTypePermission, Value: "projects:archive", Scope: GlobalScope})
+	if ok, _ := resolver.HasPermission(ctx, "u1", "projects:archive", web); ok {
+		t.Fatal("expected cached result before invalidation")
+	}
+	resolver.Invalidate("u1")
+	if ok, _ := resolver.HasPermission(ctx, "u1", "projects:archive", web); !ok {
+		t.Fatal("invalidation did not reload grants")
+	}
+
+	policy := ResourcePolicy{Type: "project", Actions: map[string]PolicyRule{
+		"deploy": {AllOf: []string{"projects:read", "projects:archive"}},
+	}}
+	if ok, err := resolver.Authorize(ctx, "u1", policy, "deploy", web); err != nil || !ok {
+		t.Fatalf("authorize = %v, %v", ok, err)
+	}
+
+	helper := NewAuthzHelper(resolver, time.Minute)
+	if ok, err := helper.CheckPermission(ctx, "u1", "billing:read", "org:acme"); err != nil || !ok {
+		t.Fatalf("helper check = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,176 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type bulkRequest struct {
+	Schemas      []string        `json:"schemas"`
+	FailOnErrors int             `json:"failOnErrors,omitempty"`
+	Operations   []bulkOperation `json:"Operations"`
+}
+
+type bulkOperation struct {
+	Method  string          `json:"method"`
+	BulkID  string          `json:"bulkId,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Path    string          `json:"path"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type bulkResponse struct {
+	Schemas    []string     `json:"schemas"`
+	Operations []bulkResult `json:"Operations"`
+}
+
+type bulkResult struct {
+	Method   string          `json:"method"`
+	BulkID   string          `json:"bulkId,omitempty"`
+	Version  string          `json:"version,omitempty"`
+	Location string          `json:"location,omitempty"`
+	Status   string          `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// bulk runs the operations in order through the module router. A
+// "bulkId:<id>" reference in a path or payload resolves to the resource
+// created by an earlier operation of the same request. Processing stops once
+// failOnErrors operations have failed.
+func (m *Module) bulk(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if len(req.Operations) > m.maxBulkOps {
+		writeError(w, http.StatusRequestEntityTooLarge, "",
+			fmt.Sprintf("bulk request exceeds %d operations", m.maxBulkOps))
+		return
+	}
+
+	created := map[string]string{}
+	results := make([]bulkResult, 0, len(req.Operations))
+	failures := 0
+	for _, op := range req.Operations {
+		result := m.bulkOperation(r, op, created)
+		results = append(results, result)
+		if status, _ := strconv.Atoi(result.Status); status >= http.StatusBadRequest {
+			failures++
+			if req.FailOnErrors > 0 && failures >= req.FailOnErrors {
+				break
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, bulkResponse{Schemas: []string{SchemaBulkResponse}, Operations: results})
+}
+
+func (m *Module) bulkOperation(r *http.Request, op bulkOperation, created map[string]string) bulkResult {
+	result := bulkResult{Method: op.Method, BulkID: op.BulkID}
+	fail := func(status int, scimType, detail string) bulkResult {
+		rec := newRecorder()
+		writeError(rec, status, scimType, detail)
+		result.Status = strconv.Itoa(status)
+		result.Response = rec.body.Bytes()
+		return result
+	}
+
+	method := strings.ToUpper(op.Method)
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fail(http.StatusBadRequest, ErrTypeInvalidSyntax, fmt.Sprintf("unsupported method %q", op.Method))
+	}
+	if method == http.MethodPost && op.BulkID == "" {
+		return fail(http.StatusBadRequest, ErrTypeInvalidValue, "POST operations need a bulkId")
+	}
+	if !strings.HasPrefix(op.Path, "/Users") && !strings.HasPrefix(op.Path, "/Groups") {
+		return fail(http.StatusBadRequest, ErrTypeInvalidPath, fmt.Sprintf("unsupported path %q", op.Path))
+	}
+
+	path, err := resolveBulkIDs(op.Path, created)
+	if err != nil {
+		return fail(http.StatusConflict, ErrTypeInvalidValue, err.Error())
+	}
+	data, err := resolveBulkIDs(string(op.Data), created)
+	if err != nil {
+		return fail(http.StatusConflict, ErrTypeInvalidValue, err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(detached(r.Context()), method, path, strings.NewReader(data))
+	if err != nil {
+		return fail(http.StatusBadRequest, ErrTypeInvalidPath, err.Error())
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if op.Version != "" {
+		req.Header.Set("If-Match", op.Version)
+	}
+	rec := newRecorder()
+	m.api.ServeHTTP(rec, req)
+
+	result.Status = strconv.Itoa(rec.status)
+	result.Version = rec.header.Get("ETag")
+	result.Location = rec.header.Get("Location")
+	if rec.status >= http.StatusBadRequest {
+		result.Response = rec.body.Bytes()
+		return result
+	}
+	if method == http.MethodPost {
+		var res struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(rec.body.Bytes(), &res) == nil {
+			created[op.BulkID] = res.ID
+		}
+	}
+	if result.Location == "" && method != http.MethodDelete {
+		result.Location = m.basePath + path
+	}
+	return result
+}
+
+// resolveBulkIDs replaces every bulkId:<id> reference with the created ID.
+func resolveBulkIDs(s string, created map[string]string) (string, error) {
+	const prefix = "bulkId:"
+	var b strings.Builder
+	for {
+		i := strings.Index(s, prefix)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i+len(prefix):]
+		end := strings.IndexAny(s, `"/?&, `)
+		if end < 0 {
+			end = len(s)
+		}
+		ref := s[:end]
+		id, ok := created[ref]
+		if !ok {
+			return "", fmt.Errorf("bulkId %q does not reference a created resource", ref)
+		}
+		b.WriteString(id)
+		s = s[end:]
+	}
+}
+
+// recorder captures a response of the module router.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+
+func (r *recorder) WriteHeader(status int) { r.status = status }
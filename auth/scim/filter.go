@@ -0,0 +1,198 @@
+package scim
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter is a parsed SCIM filter: a disjunction of conjunctions of
+// comparisons. Grouping with parentheses and "not" are not supported.
+type Filter [][]Comparison
+
+// Comparison tests one attribute of a Filter.
+type Comparison struct {
+	Attr  string // lower-cased attribute path
+	Op    string // eq ne co sw ew gt ge lt le pr
+	Value string
+}
+
+// parseFilter parses expressions such as
+//
+//	userName eq "bjensen" and active eq true
+//	displayName co "jensen" or externalId pr
+func parseFilter(raw string) (Filter, error) {
+	tokens, err := tokenize(raw)
+	if err != nil {
+		return nil, err
+	}
+	var f Filter
+	var and []Comparison
+	for i := 0; i < len(tokens); {
+		if len(tokens)-i < 2 {
+			return nil, fmt.Errorf("incomplete expression at %q", strings.Join(tokens[i:], " "))
+		}
+		c := Comparison{Attr: strings.ToLower(tokens[i]), Op: strings.ToLower(tokens[i+1])}
+		i += 2
+		switch c.Op {
+		case "pr":
+		case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("operator %s needs a value", c.Op)
+			}
+			c.Value = tokens[i]
+			i++
+		default:
+			return nil, fmt.Errorf("unsupported operator %q", c.Op)
+		}
+		and = append(and, c)
+
+		if i == len(tokens) {
+			break
+		}
+		switch strings.ToLower(tokens[i]) {
+		case "and":
+		case "or":
+			f = append(f, and)
+			and = nil
+		default:
+			return nil, fmt.Errorf("expected and/or, got %q", tokens[i])
+		}
+		i++
+		if i == len(tokens) {
+			return nil, fmt.Errorf("filter ends with a logical operator")
+		}
+	}
+	if len(and) > 0 {
+		f = append(f, and)
+	}
+	return f, nil
+}
+
+// tokenize splits on spaces, keeping quoted strings (unquoted) as one token.
+func tokenize(raw string) ([]string, error) {
+	var tokens []string
+	runes := []rune(strings.TrimSpace(raw))
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case runes[i] == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			tokens = append(tokens, b.String())
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		}
+	}
+	return tokens, nil
+}
+
+// Match reports whether attrs, keyed by lower-cased attribute path, satisfy
+// the filter. An empty filter matches everything.
+func (f Filter) Match(attrs map[string][]string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, and := range f {
+		ok := true
+		for _, c := range and {
+			if !c.Match(attrs[c.Attr]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// And adds c to every conjunction, so the result also requires c.
+func (f Filter) And(c Comparison) Filter {
+	if len(f) == 0 {
+		return Filter{{c}}
+	}
+	out := make(Filter, 0, len(f))
+	for _, and := range f {
+		out = append(out, append(slices.Clip(and), c))
+	}
+	return out
+}
+
+// Match reports whether the attribute values satisfy the comparison.
+func (c Comparison) Match(values []string) bool {
+	if c.Op == "pr" {
+		for _, v := range values {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if c.Op == "ne" {
+		for _, v := range values {
+			if strings.EqualFold(v, c.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if c.compare(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare applies the operator case-insensitively, as SCIM does for
+// caseExact=false attributes. Ordering compares timestamps when both sides
+// parse as RFC3339 and strings otherwise.
+func (c Comparison) compare(v string) bool {
+	a, b := strings.ToLower(v), strings.ToLower(c.Value)
+	switch c.Op {
+	case "eq":
+		return a == b
+	case "co":
+		return strings.Contains(a, b)
+	case "sw":
+		return strings.HasPrefix(a, b)
+	case "ew":
+		return strings.HasSuffix(a, b)
+	}
+	cmp := strings.Compare(a, b)
+	if ta, err := time.Parse(time.RFC3339, v); err == nil {
+		if tb, err := time.Parse(time.RFC3339, c.Value); err == nil {
+			cmp = ta.Compare(tb)
+		}
+	}
+	switch c.Op {
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (m *Module) listGroups(w http.ResponseWriter, r *http.Request) {
+	p, ok := m.parsePage(w, r)
+	if !ok {
+		return
+	}
+	groups, total, err := m.store.ListGroups(r.Context(), p.query(p.filter))
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	resources := make([]any, 0, len(groups))
+	for _, g := range groups {
+		resources = append(resources, m.groupResource(g))
+	}
+	p.respond(w, resources, total)
+}
+
+func (m *Module) getGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := m.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	writeResource(w, http.StatusOK, "", g.Version, m.groupResource(g))
+}
+
+func (m *Module) createGroup(w http.ResponseWriter, r *http.Request) {
+	var res GroupResource
+	if !decode(w, r, &res) {
+		return
+	}
+	g := Group{ID: uuid.New(), CreatedAt: m.now().UTC()}
+	if !m.saveGroup(w, r, &g, res) {
+		return
+	}
+	m.log.Info("scim group provisioned", "group_id", g.ID, "name", g.DisplayName)
+	writeResource(w, http.StatusCreated, m.location("Groups", g.ID.String()), g.Version, m.groupResource(g))
+}
+
+func (m *Module) replaceGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := m.loadGroup(w, r)
+	if !ok || !checkVersion(w, r, g.Version) {
+		return
+	}
+	var res GroupResource
+	if !decode(w, r, &res) {
+		return
+	}
+	m.updateGroup(w, r, g, res)
+}
+
+func (m *Module) patchGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := m.loadGroup(w, r)
+	if !ok || !checkVersion(w, r, g.Version) {
+		return
+	}
+	var req patchRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	var res GroupResource
+	if err := req.apply(m.groupResource(g), &res); err != nil {
+		writeError(w, http.StatusBadRequest, err.scimType, err.detail)
+		return
+	}
+	m.updateGroup(w, r, g, res)
+}
+
+func (m *Module) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := m.loadGroup(w, r)
+	if !ok || !checkVersion(w, r, g.Version) {
+		return
+	}
+	if err := m.store.DeleteGroup(r.Context(), g.ID); err != nil {
+		m.fail(w, err)
+		return
+	}
+	m.log.Info("scim group deleted", "group_id", g.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Module) updateGroup(w http.ResponseWriter, r *http.Request, g Group, res GroupResource) {
+	if !m.saveGroup(w, r, &g, res) {
+		return
+	}
+	m.log.Info("scim group updated", "group_id", g.ID, "members", len(g.Members))
+	writeResource(w, http.StatusOK, "", g.Version, m.groupResource(g))
+}
+
+// saveGroup validates res, applies it onto g and persists the result.
+// Members must reference provisioned users.
+func (m *Module) saveGroup(w http.ResponseWriter, r *http.Request, g *Group, res GroupResource) bool {
+	ctx := r.Context()
+	name := strings.TrimSpace(res.DisplayName)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, ErrTypeInvalidValue, "displayName is required")
+		return false
+	}
+	_, taken, err := m.store.ListGroups(ctx, Query{
+		Filter:     Filter{{{Attr: "displayname", Op: "eq", Value: name}, {Attr: "id", Op: "ne", Value: g.ID.String()}}},
+		StartIndex: 1,
+	})
+	if err != nil {
+		m.fail(w, err)
+		return false
+	}
+	if taken > 0 {
+		writeError(w, http.StatusConflict, ErrTypeUniqueness, fmt.Sprintf("displayName %q is already in use", name))
+		return false
+	}
+	members := make([]uuid.UUID, 0, len(res.Members))
+	for _, ref := range res.Members {
+		id, err := m.memberID(ctx, ref.Value)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				writeError(w, http.StatusBadRequest, ErrTypeInvalidValue, fmt.Sprintf("member %q is not a provisioned user", ref.Value))
+			} else {
+				m.fail(w, err)
+			}
+			return false
+		}
+		if !slices.Contains(members, id) {
+			members = append(members, id)
+		}
+	}
+	g.DisplayName = name
+	g.ExternalID = res.ExternalID
+	g.Members = members
+	g.UpdatedAt = m.now().UTC()
+	g.Version++
+	if err := m.store.SaveGroup(ctx, *g); err != nil {
+		m.fail(w, err)
+		return false
+	}
+	return true
+}
+
+func (m *Module) memberID(ctx context.Context, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, ErrNotFound
+	}
+	rec, err := m.store.GetUser(ctx, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if rec.User.Status == auth.UserStatusDeleted {
+		return uuid.Nil, ErrNotFound
+	}
+	return id, nil
+}
+
+// dropMember removes a deprovisioned user from every group.
+func (m *Module) dropMember(ctx context.Context, userID uuid.UUID) error {
+	groups, err := m.groupsOf(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		i := slices.Index(g.Members, userID)
+		if i < 0 {
+			continue
+		}
+		g.Members = slices.Delete(slices.Clone(g.Members), i, i+1)
+		g.UpdatedAt = m.now().UTC()
+		g.Version++
+		if err := m.store.SaveGroup(ctx, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupsOf returns the groups listing any of the users as a member.
+func (m *Module) groupsOf(ctx context.Context, userIDs ...uuid.UUID) ([]Group, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	f := make(Filter, 0, len(userIDs))
+	for _, id := range userIDs {
+		f = append(f, []Comparison{{Attr: "members", Op: "eq", Value: id.String()}})
+	}
+	groups, _, err := m.store.ListGroups(ctx, All(f))
+	return groups, err
+}
+
+func (m *Module) loadGroup(w http.ResponseWriter, r *http.Request) (Group, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "", "resource not found")
+		return Group{}, false
+	}
+	g, err := m.store.GetGroup(r.Context(), id)
+	if err != nil {
+		m.fail(w, err)
+		return Group{}, false
+	}
+	return g, true
+}
+
+func (m *Module) groupResource(g Group) GroupResource {
+	res := GroupResource{
+		Schemas:     []string{SchemaGroup},
+		ID:          g.ID.String(),
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: g.UpdatedAt,
+			Location:     m.location("Groups", g.ID.String()),
+			Version:      version(g.Version),
+		},
+	}
+	for _, id := range g.Members {
+		res.Members = append(res.Members, MemberRef{Value: id.String(), Ref: m.location("Users", id.String())})
+	}
+	return res
+}
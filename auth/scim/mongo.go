@@ -0,0 +1,350 @@
+package scim
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps provisioned users and groups in the _scim_users and
+// _scim_groups collections.
+type MongoStore struct {
+	users  *mongo.Collection
+	groups *mongo.Collection
+}
+
+var _ Store = (*MongoStore)(nil)
+
+// NewMongoStore stores records in db.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{users: db.Collection("_scim_users"), groups: db.Collection("_scim_groups")}
+}
+
+type userDocument struct {
+	ID         string    `bson:"_id"`
+	User       auth.User `bson:"user"`
+	ExternalID string    `bson:"external_id,omitempty"`
+	CreatedAt  time.Time `bson:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+	Version    int       `bson:"version"`
+}
+
+type groupDocument struct {
+	ID          string    `bson:"_id"`
+	DisplayName string    `bson:"display_name"`
+	ExternalID  string    `bson:"external_id,omitempty"`
+	Members     []string  `bson:"members"`
+	CreatedAt   time.Time `bson:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+	Version     int       `bson:"version"`
+}
+
+func (d userDocument) record() UserRecord {
+	return UserRecord{User: d.User, ExternalID: d.ExternalID, UpdatedAt: d.UpdatedAt, Version: d.Version}
+}
+
+func (d groupDocument) group() Group {
+	g := Group{DisplayName: d.DisplayName, ExternalID: d.ExternalID, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt, Version: d.Version}
+	g.ID, _ = uuid.Parse(d.ID)
+	for _, m := range d.Members {
+		if id, err := uuid.Parse(m); err == nil {
+			g.Members = append(g.Members, id)
+		}
+	}
+	return g
+}
+
+// ListUsers implements Store. Filters run in Mongo; string comparisons are
+// case-insensitive for eq, ne, co, sw and ew only.
+func (s *MongoStore) ListUsers(ctx context.Context, q Query) ([]UserRecord, int, error) {
+	filter, err := mongoFilter(q.Filter, userClause)
+	if err != nil {
+		return nil, 0, err
+	}
+	var docs []userDocument
+	total, err := findPage(ctx, s.users, filter, q, &docs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("scim: list users: %w", err)
+	}
+	out := make([]UserRecord, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, d.record())
+	}
+	return out, total, nil
+}
+
+// GetUser implements Store.
+func (s *MongoStore) GetUser(ctx context.Context, id uuid.UUID) (UserRecord, error) {
+	var d userDocument
+	err := s.users.FindOne(ctx, bson.M{"_id": id.String()}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return UserRecord{}, ErrNotFound
+	}
+	if err != nil {
+		return UserRecord{}, fmt.Errorf("scim: get user %s: %w", id, err)
+	}
+	return d.record(), nil
+}
+
+// SaveUser implements Store.
+func (s *MongoStore) SaveUser(ctx context.Context, user UserRecord) error {
+	d := userDocument{
+		ID:         user.User.ID.String(),
+		User:       user.User,
+		ExternalID: user.ExternalID,
+		CreatedAt:  user.User.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+		Version:    user.Version,
+	}
+	_, err := s.users.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("scim: save user %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// DeleteUser implements Store.
+func (s *MongoStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	res, err := s.users.DeleteOne(ctx, bson.M{"_id": id.String()})
+	if err != nil {
+		return fmt.Errorf("scim: delete user %s: %w", id, err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListGroups implements Store, with the same filter support as ListUsers.
+func (s *MongoStore) ListGroups(ctx context.Context, q Query) ([]Group, int, error) {
+	filter, err := mongoFilter(q.Filter, groupClause)
+	if err != nil {
+		return nil, 0, err
+	}
+	var docs []groupDocument
+	total, err := findPage(ctx, s.groups, filter, q, &docs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("scim: list groups: %w", err)
+	}
+	out := make([]Group, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, d.group())
+	}
+	return out, total, nil
+}
+
+// GetGroup implements Store.
+func (s *MongoStore) GetGroup(ctx context.Context, id uuid.UUID) (Group, error) {
+	var d groupDocument
+	err := s.groups.FindOne(ctx, bson.M{"_id": id.String()}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Group{}, ErrNotFound
+	}
+	if err != nil {
+		return Group{}, fmt.Errorf("scim: get group %s: %w", id, err)
+	}
+	return d.group(), nil
+}
+
+// SaveGroup implements Store.
+func (s *MongoStore) SaveGroup(ctx context.Context, group Group) error {
+	d := groupDocument{
+		ID:          group.ID.String(),
+		DisplayName: group.DisplayName,
+		ExternalID:  group.ExternalID,
+		Members:     make([]string, 0, len(group.Members)),
+		CreatedAt:   group.CreatedAt,
+		UpdatedAt:   group.UpdatedAt,
+		Version:     group.Version,
+	}
+	for _, m := range group.Members {
+		d.Members = append(d.Members, m.String())
+	}
+	_, err := s.groups.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("scim: save group %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// DeleteGroup implements Store.
+func (s *MongoStore) DeleteGroup(ctx context.Context, id uuid.UUID) error {
+	res, err := s.groups.DeleteOne(ctx, bson.M{"_id": id.String()})
+	if err != nil {
+		return fmt.Errorf("scim: delete group %s: %w", id, err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// findPage counts the matches of filter and decodes q's window of them,
+// ordered by creation, into docs.
+func findPage(ctx context.Context, coll *mongo.Collection, filter bson.M, q Query, docs any) (int, error) {
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(max(q.StartIndex, 1) - 1))
+	if q.Count == 0 {
+		return int(total), nil
+	}
+	if q.Count > 0 {
+		opts.SetLimit(int64(q.Count))
+	}
+	cur, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := cur.All(ctx, docs); err != nil {
+		return 0, fmt.Errorf("decode: %w", err)
+	}
+	return int(total), nil
+}
+
+var (
+	userFields = map[string]string{
+		"id":                "_id",
+		"username":          "user.username",
+		"externalid":        "external_id",
+		"displayname":       "user.name",
+		"name.formatted":    "user.name",
+		"status":            "user.status",
+		"meta.created":      "created_at",
+		"meta.lastmodified": "updated_at",
+	}
+	groupFields = map[string]string{
+		"id":                "_id",
+		"displayname":       "display_name",
+		"externalid":        "external_id",
+		"members":           "members",
+		"members.value":     "members",
+		"meta.created":      "created_at",
+		"meta.lastmodified": "updated_at",
+	}
+	timeFields = map[string]bool{"created_at": true, "updated_at": true}
+	matchNone  = bson.M{"_id": bson.M{"$exists": false}}
+)
+
+// mongoFilter translates f into a query document, using clause for each
+// comparison.
+func mongoFilter(f Filter, clause func(Comparison) (bson.M, error)) (bson.M, error) {
+	if len(f) == 0 {
+		return bson.M{}, nil
+	}
+	or := make(bson.A, 0, len(f))
+	for _, and := range f {
+		clauses := make(bson.A, 0, len(and))
+		for _, c := range and {
+			doc, err := clause(c)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s %s: %v", ErrUnsupportedFilter, c.Attr, c.Op, err)
+			}
+			clauses = append(clauses, doc)
+		}
+		or = append(or, bson.M{"$and": clauses})
+	}
+	return bson.M{"$or": or}, nil
+}
+
+func userClause(c Comparison) (bson.M, error) {
+	switch c.Attr {
+	case "active":
+		if c.Op == "pr" {
+			return bson.M{}, nil
+		}
+		want, err := strconv.ParseBool(c.Value)
+		if err != nil || (c.Op != "eq" && c.Op != "ne") {
+			return nil, errors.New("active supports eq and ne with a boolean")
+		}
+		if want == (c.Op == "eq") {
+			return bson.M{"user.status": auth.UserStatusActive}, nil
+		}
+		return bson.M{"user.status": bson.M{"$ne": auth.UserStatusActive}}, nil
+	case attrEmailLookup:
+		if c.Op == "pr" {
+			return bson.M{"user.emaillookup": bson.M{"$exists": true, "$ne": nil}}, nil
+		}
+		lookup, err := hex.DecodeString(c.Value)
+		if err != nil || (c.Op != "eq" && c.Op != "ne") {
+			return nil, errors.New("emails support eq and ne")
+		}
+		if c.Op == "eq" {
+			return bson.M{"user.emaillookup": lookup}, nil
+		}
+		return bson.M{"user.emaillookup": bson.M{"$ne": lookup}}, nil
+	}
+	return fieldClause(userFields, c)
+}
+
+func groupClause(c Comparison) (bson.M, error) {
+	return fieldClause(groupFields, c)
+}
+
+// fieldClause compares a plain field. Attributes without a field have no
+// values, so they match exactly when the comparison matches nothing.
+func fieldClause(fields map[string]string, c Comparison) (bson.M, error) {
+	field, ok := fields[c.Attr]
+	if !ok {
+		if c.Match(nil) {
+			return bson.M{}, nil
+		}
+		return matchNone, nil
+	}
+	if c.Op == "pr" {
+		return bson.M{field: bson.M{"$exists": true, "$nin": bson.A{nil, "", bson.A{}}}}, nil
+	}
+	if timeFields[field] {
+		return timeClause(field, c)
+	}
+	quoted := regexp.QuoteMeta(c.Value)
+	pattern := map[string]string{"eq": "^" + quoted + "$", "ne": "^" + quoted + "$", "co": quoted, "sw": "^" + quoted, "ew": quoted + "$"}
+	if p, ok := pattern[c.Op]; ok {
+		re := primitive.Regex{Pattern: p, Options: "i"}
+		if c.Op == "ne" {
+			return bson.M{field: bson.M{"$not": re}}, nil
+		}
+		return bson.M{field: re}, nil
+	}
+	return bson.M{field: bson.M{"$" + c.Op: c.Value}}, nil
+}
+
+// timeClause compares a timestamp at the one-second precision attributes
+// are rendered with.
+func timeClause(field string, c Comparison) (bson.M, error) {
+	t, err := time.Parse(time.RFC3339, c.Value)
+	if err != nil {
+		return nil, errors.New("timestamps must be RFC3339")
+	}
+	t = t.Truncate(time.Second)
+	next := t.Add(time.Second)
+	switch c.Op {
+	case "eq":
+		return bson.M{field: bson.M{"$gte": t, "$lt": next}}, nil
+	case "ne":
+		return bson.M{"$or": bson.A{bson.M{field: bson.M{"$lt": t}}, bson.M{field: bson.M{"$gte": next}}}}, nil
+	case "gt":
+		return bson.M{field: bson.M{"$gte": next}}, nil
+	case "ge":
+		return bson.M{field: bson.M{"$gte": t}}, nil
+	case "lt":
+		return bson.M{field: bson.M{"$lt": t}}, nil
+	case "le":
+		return bson.M{field: bson.M{"$lt": next}}, nil
+	}
+	return nil, errors.New("timestamps support eq, ne, gt, ge, lt and le")
+}
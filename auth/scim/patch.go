@@ -0,0 +1,235 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// patchRequest is a SCIM PatchOp message.
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type patchError struct {
+	scimType string
+	detail   string
+}
+
+func invalidPatch(scimType, format string, args ...any) *patchError {
+	return &patchError{scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+// apply runs the operations over the JSON form of current and decodes the
+// result into out. Paths may be plain ("active"), nested ("name.givenName"),
+// filtered (`members[value eq "..."]`) or schema-qualified; operations
+// without a path merge an object value, as Azure AD sends them.
+func (p patchRequest) apply(current, out any) *patchError {
+	if len(p.Operations) == 0 {
+		return invalidPatch(ErrTypeInvalidValue, "no operations")
+	}
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return invalidPatch(ErrTypeInvalidValue, "%v", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return invalidPatch(ErrTypeInvalidValue, "%v", err)
+	}
+
+	for _, op := range p.Operations {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return invalidPatch(ErrTypeInvalidSyntax, "unsupported op %q", op.Op)
+		}
+		var value any
+		if len(bytes.TrimSpace(op.Value)) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return invalidPatch(ErrTypeInvalidValue, "invalid value: %v", err)
+			}
+		}
+		if op.Path != "" {
+			if err := applyPath(doc, kind, op.Path, value); err != nil {
+				return err
+			}
+			continue
+		}
+		attrs, ok := value.(map[string]any)
+		if kind == "remove" || !ok {
+			return invalidPatch(ErrTypeNoTarget, "%s without path needs an object value", kind)
+		}
+		for path, v := range attrs {
+			if err := applyPath(doc, kind, path, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Some providers send booleans as strings ("False").
+	if s, ok := doc[findKey(doc, "active")].(string); ok {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return invalidPatch(ErrTypeInvalidValue, "active must be a boolean")
+		}
+		doc[findKey(doc, "active")] = b
+	}
+
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		return invalidPatch(ErrTypeInvalidValue, "%v", err)
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return invalidPatch(ErrTypeInvalidValue, "%v", err)
+	}
+	return nil
+}
+
+func applyPath(doc map[string]any, op, path string, value any) *patchError {
+	attr, selector, sub, err := parsePath(path)
+	if err != nil {
+		return invalidPatch(ErrTypeInvalidPath, "%v", err)
+	}
+	key := findKey(doc, attr)
+
+	if selector != nil {
+		items, _ := doc[key].([]any)
+		matched := false
+		kept := items[:0:0]
+		for _, item := range items {
+			obj, ok := item.(map[string]any)
+			if !ok || !selector.Match(flatten(obj)) {
+				kept = append(kept, item)
+				continue
+			}
+			matched = true
+			switch {
+			case op == "remove" && sub == "":
+				continue
+			case op == "remove":
+				delete(obj, findKey(obj, sub))
+			case sub != "":
+				obj[findKey(obj, sub)] = value
+			default:
+				if v, ok := value.(map[string]any); ok {
+					for k, x := range v {
+						obj[findKey(obj, k)] = x
+					}
+				}
+			}
+			kept = append(kept, obj)
+		}
+		if !matched && op != "remove" {
+			return invalidPatch(ErrTypeNoTarget, "no values match %q", path)
+		}
+		doc[key] = kept
+		return nil
+	}
+
+	if sub != "" {
+		obj, _ := doc[key].(map[string]any)
+		if obj == nil {
+			obj = map[string]any{}
+			doc[key] = obj
+		}
+		return applyPath(obj, op, sub, value)
+	}
+
+	switch op {
+	case "remove":
+		items, isList := doc[key].([]any)
+		if !isList || value == nil {
+			delete(doc, key)
+			return nil
+		}
+		// Azure AD removes members by listing them in the value.
+		drop := map[string]bool{}
+		for _, v := range asList(value) {
+			if obj, ok := v.(map[string]any); ok {
+				drop[fmt.Sprint(obj["value"])] = true
+			}
+		}
+		kept := items[:0:0]
+		for _, item := range items {
+			if obj, ok := item.(map[string]any); ok && drop[fmt.Sprint(obj["value"])] {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		doc[key] = kept
+	case "add":
+		if items, ok := doc[key].([]any); ok {
+			doc[key] = append(items, asList(value)...)
+			return nil
+		}
+		doc[key] = value
+	default:
+		doc[key] = value
+	}
+	return nil
+}
+
+// parsePath splits attr[filter].sub, dropping any schema URN prefix.
+func parsePath(path string) (attr string, selector Filter, sub string, err error) {
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		end := strings.IndexByte(path, '[')
+		if end < 0 {
+			end = len(path)
+		}
+		path = path[strings.LastIndexByte(path[:end], ':')+1:]
+	}
+	if open := strings.IndexByte(path, '['); open >= 0 {
+		close := strings.LastIndexByte(path, ']')
+		if close < open {
+			return "", nil, "", fmt.Errorf("unbalanced brackets in %q", path)
+		}
+		selector, err = parseFilter(path[open+1 : close])
+		if err != nil {
+			return "", nil, "", err
+		}
+		attr = path[:open]
+		sub = strings.TrimPrefix(path[close+1:], ".")
+	} else {
+		attr, sub, _ = strings.Cut(path, ".")
+	}
+	if attr == "" {
+		return "", nil, "", fmt.Errorf("empty attribute in %q", path)
+	}
+	return attr, selector, sub, nil
+}
+
+// findKey returns the key of obj matching name case-insensitively, or name.
+func findKey(obj map[string]any, name string) string {
+	if _, ok := obj[name]; ok {
+		return name
+	}
+	for k := range obj {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+func flatten(obj map[string]any) map[string][]string {
+	attrs := make(map[string][]string, len(obj))
+	for k, v := range obj {
+		attrs[strings.ToLower(k)] = []string{fmt.Sprint(v)}
+	}
+	return attrs
+}
+
+func asList(value any) []any {
+	if list, ok := value.([]any); ok {
+		return list
+	}
+	return []any{value}
+}
@@ -0,0 +1,336 @@
+// Package scim provisions users and groups from identity providers (Okta,
+// Azure AD, ...) through the SCIM 2.0 protocol. Users map onto auth.User;
+// groups and SCIM-only attributes live in a pluggable Store.
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultBasePath   = "/scim/v2"
+	defaultMaxResults = 200
+	defaultMaxBulkOps = 100
+	maxPayloadSize    = 1 << 20
+
+	// ContentType is the media type of every SCIM response.
+	ContentType = "application/scim+json"
+)
+
+// SCIM error types, reported in the scimType field.
+const (
+	ErrTypeInvalidFilter = "invalidFilter"
+	ErrTypeInvalidSyntax = "invalidSyntax"
+	ErrTypeInvalidPath   = "invalidPath"
+	ErrTypeInvalidValue  = "invalidValue"
+	ErrTypeUniqueness    = "uniqueness"
+	ErrTypeTooMany       = "tooMany"
+	ErrTypeNoTarget      = "noTarget"
+)
+
+// Module serves the SCIM endpoints. It implements aqm.HTTPModule.
+type Module struct {
+	store      Store
+	basePath   string
+	log        aqm.Logger
+	tokens     [][]byte
+	encKey     []byte
+	lookupKey  []byte
+	maxResults int
+	maxBulkOps int
+	now        func() time.Time
+	api        chi.Router
+}
+
+// Option configures a Module.
+type Option func(*Module)
+
+// WithBearerTokens sets the tokens identity providers authenticate with.
+// Without tokens every request is rejected.
+func WithBearerTokens(tokens ...string) Option {
+	return func(m *Module) {
+		for _, t := range tokens {
+			if t != "" {
+				m.tokens = append(m.tokens, []byte(t))
+			}
+		}
+	}
+}
+
+// WithEmailKeys sets the keys used to encrypt emails and compute their
+// lookup hash, as auth.User stores them. Without keys emails are ignored.
+func WithEmailKeys(encryptionKey, lookupKey []byte) Option {
+	return func(m *Module) {
+		m.encKey = encryptionKey
+		m.lookupKey = lookupKey
+	}
+}
+
+// WithBasePath overrides the mount point (defaults to /scim/v2).
+func WithBasePath(base string) Option {
+	return func(m *Module) {
+		if base != "" {
+			m.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithMaxResults caps the page size of list responses (defaults to 200).
+func WithMaxResults(n int) Option {
+	return func(m *Module) {
+		if n > 0 {
+			m.maxResults = n
+		}
+	}
+}
+
+// WithMaxBulkOperations caps the operations of one bulk request (defaults
+// to 100).
+func WithMaxBulkOperations(n int) Option {
+	return func(m *Module) {
+		if n > 0 {
+			m.maxBulkOps = n
+		}
+	}
+}
+
+// WithLogger wires the logger provisioning changes are written to.
+func WithLogger(logger aqm.Logger) Option {
+	return func(m *Module) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// New returns a Module provisioning into store. A nil store defaults to
+// memory.
+func New(store Store, opts ...Option) *Module {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	m := &Module{
+		store:      store,
+		basePath:   defaultBasePath,
+		log:        aqm.NewNoopLogger(),
+		maxResults: defaultMaxResults,
+		maxBulkOps: defaultMaxBulkOps,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	m.api = chi.NewRouter()
+	m.routes(m.api)
+	return m
+}
+
+// RegisterRoutes implements aqm.HTTPModule. Everything under the base path
+// requires one of the configured bearer tokens.
+func (m *Module) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.With(m.authenticate).Mount(m.basePath, m.api)
+}
+
+func (m *Module) routes(r chi.Router) {
+	r.Get("/ServiceProviderConfig", m.serviceProviderConfig)
+
+	r.Get("/Users", m.listUsers)
+	r.Post("/Users", m.createUser)
+	r.Get("/Users/{id}", m.getUser)
+	r.Put("/Users/{id}", m.replaceUser)
+	r.Patch("/Users/{id}", m.patchUser)
+	r.Delete("/Users/{id}", m.deleteUser)
+
+	r.Get("/Groups", m.listGroups)
+	r.Post("/Groups", m.createGroup)
+	r.Get("/Groups/{id}", m.getGroup)
+	r.Put("/Groups/{id}", m.replaceGroup)
+	r.Patch("/Groups/{id}", m.patchGroup)
+	r.Delete("/Groups/{id}", m.deleteGroup)
+
+	r.Post("/Bulk", m.bulk)
+}
+
+func (m *Module) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || !m.validToken(strings.TrimSpace(token)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeError(w, http.StatusUnauthorized, "", "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Module) validToken(token string) bool {
+	valid := false
+	for _, t := range m.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), t) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func (m *Module) serviceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]any { return map[string]any{"supported": ok} }
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schemas": []string{SchemaServiceProviderConfig},
+		"patch":   supported(true),
+		"bulk": map[string]any{
+			"supported":      true,
+			"maxOperations":  m.maxBulkOps,
+			"maxPayloadSize": maxPayloadSize,
+		},
+		"filter":         map[string]any{"supported": true, "maxResults": m.maxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(true),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with a provisioning bearer token",
+			"primary":     true,
+		}},
+	})
+}
+
+// page is the parsed pagination and filter query of a list request.
+type page struct {
+	filter     Filter
+	startIndex int
+	count      int
+}
+
+// query returns the store query for the page window over f.
+func (p page) query(f Filter) Query {
+	return Query{Filter: f, StartIndex: p.startIndex, Count: p.count}
+}
+
+func (m *Module) parsePage(w http.ResponseWriter, r *http.Request) (page, bool) {
+	q := r.URL.Query()
+	p := page{startIndex: 1, count: m.maxResults}
+	if raw := q.Get("filter"); raw != "" {
+		f, err := parseFilter(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrTypeInvalidFilter, err.Error())
+			return page{}, false
+		}
+		p.filter = f
+	}
+	if raw := q.Get("startIndex"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrTypeInvalidValue, "startIndex must be an integer")
+			return page{}, false
+		}
+		p.startIndex = max(n, 1)
+	}
+	if raw := q.Get("count"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrTypeInvalidValue, "count must be an integer")
+			return page{}, false
+		}
+		p.count = min(max(n, 0), m.maxResults)
+	}
+	return p, true
+}
+
+// respond writes a store page of resources as a ListResponse.
+func (p page) respond(w http.ResponseWriter, resources []any, total int) {
+	writeJSON(w, http.StatusOK, ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   p.startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// checkVersion answers 412 when If-Match names another version.
+func checkVersion(w http.ResponseWriter, r *http.Request, current int) bool {
+	match := r.Header.Get("If-Match")
+	if match == "" || match == "*" {
+		return true
+	}
+	for _, v := range strings.Split(match, ",") {
+		if strings.TrimSpace(v) == version(current) {
+			return true
+		}
+	}
+	writeError(w, http.StatusPreconditionFailed, "", "resource version has changed")
+	return false
+}
+
+func (m *Module) location(kind, id string) string {
+	return m.basePath + "/" + kind + "/" + id
+}
+
+func (m *Module) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "", "resource not found")
+		return
+	}
+	if errors.Is(err, ErrUnsupportedFilter) {
+		writeError(w, http.StatusBadRequest, ErrTypeInvalidFilter, err.Error())
+		return
+	}
+	m.log.Error("scim store failed", "error", err)
+	writeError(w, http.StatusInternalServerError, "", "internal error")
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, ErrTypeInvalidSyntax, "request body must be valid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeJSON(w, status, ErrorResponse{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func writeResource(w http.ResponseWriter, status int, location string, v int, body any) {
+	w.Header().Set("ETag", version(v))
+	if status == http.StatusCreated {
+		w.Header().Set("Location", location)
+	}
+	writeJSON(w, status, body)
+}
+
+// detached returns ctx without the routing state of the outer request, so
+// bulk operations can be dispatched through the module router.
+func detached(ctx context.Context) context.Context {
+	return context.WithValue(ctx, chi.RouteCtxKey, nil)
+}
@@ -0,0 +1,407 @@
+package scim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testToken = "provisioning-token"
+
+type client struct {
+	t      *testing.T
+	router chi.Router
+}
+
+func (c client) do(method, path string, body any) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, "/scim/v2"+path, &buf)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return v
+}
+
+func newClient(t *testing.T, opts ...Option) (client, *Module) {
+	m := New(nil, append([]Option{WithBearerTokens(testToken)}, opts...)...)
+	router := chi.NewRouter()
+	m.RegisterRoutes(router)
+	return client{t: t, router: router}, m
+}
+
+func createUser(t *testing.T, c client, userName string) UserResource {
+	t.Helper()
+	rec := c.do(http.MethodPost, "/Users", map[string]any{
+		"schemas":  []string{SchemaUser},
+		"userName": userName,
+		"name":     map[string]string{"givenName": "Barbara", "familyName": "Jensen"},
+		"emails":   []map[string]any{{"value": userName + "@example.com", "primary": true}},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create user: %d %s", rec.Code, rec.Body)
+	}
+	return decodeBody[UserResource](t, rec)
+}
+
+func TestBearerTokenRequired(t *testing.T) {
+	c, _ := newClient(t)
+	req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	open := New(nil)
+	router := chi.NewRouter()
+	open.RegisterRoutes(router)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("module without tokens served %d", rec.Code)
+	}
+}
+
+func TestUserLifecycle(t *testing.T) {
+	encKey := bytes.Repeat([]byte{1}, 32)
+	store := NewMemoryStore()
+	m := New(store, WithBearerTokens(testToken), WithEmailKeys(encKey, []byte("lookup")))
+	router := chi.NewRouter()
+	m.RegisterRoutes(router)
+	c := client{t: t, router: router}
+
+	user := createUser(t, c, "bjensen")
+	if user.DisplayName != "Barbara Jensen" || user.Active == nil || !*user.Active {
+		t.Fatalf("created = %+v", user)
+	}
+	if len(user.Emails) != 1 || user.Emails[0].Value != "bjensen@example.com" {
+		t.Fatalf("emails = %+v", user.Emails)
+	}
+	stored, err := store.GetUser(context.Background(), uuid.MustParse(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored.User.EmailLookup, auth.ComputeLookupHash("bjensen@example.com", []byte("lookup"))) {
+		t.Error("email lookup hash not stored")
+	}
+
+	if rec := c.do(http.MethodPost, "/Users", map[string]any{"userName": "BJensen"}); rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate userName: %d", rec.Code)
+	} else if e := decodeBody[ErrorResponse](t, rec); e.ScimType != ErrTypeUniqueness || e.Status != "409" {
+		t.Errorf("error = %+v", e)
+	}
+
+	rec := c.do(http.MethodPatch, "/Users/"+user.ID, map[string]any{
+		"schemas": []string{SchemaPatchOp},
+		"Operations": []map[string]any{
+			{"op": "Replace", "value": map[string]any{"active": "False"}},
+			{"op": "replace", "path": "externalId", "value": "ext-1"},
+		},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", rec.Code, rec.Body)
+	}
+	patched := decodeBody[UserResource](t, rec)
+	if *patched.Active || patched.ExternalID != "ext-1" || patched.Meta.Version != `W/"2"` {
+		t.Fatalf("patched = %+v", patched)
+	}
+	if stored, _ := store.GetUser(context.Background(), uuid.MustParse(user.ID)); stored.User.Status != auth.UserStatusSuspended {
+		t.Errorf("status = %s, want suspended", stored.User.Status)
+	}
+
+	if rec := c.do(http.MethodDelete, "/Users/"+user.ID, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", rec.Code)
+	}
+	if rec := c.do(http.MethodGet, "/Users/"+user.ID, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted user served %d", rec.Code)
+	}
+	if stored, _ := store.GetUser(context.Background(), uuid.MustParse(user.ID)); stored.User.Status != auth.UserStatusDeleted {
+		t.Errorf("status = %s, want deleted", stored.User.Status)
+	}
+}
+
+func TestListUsersFilterAndPagination(t *testing.T) {
+	c, _ := newClient(t)
+	for _, name := range []string{"alice", "bob", "carol", "alina"} {
+		createUser(t, c, name)
+	}
+
+	list := decodeBody[ListResponse](t, c.do(http.MethodGet, `/Users?filter=userName+sw+%22al%22`, nil))
+	if list.TotalResults != 2 {
+		t.Fatalf("sw filter total = %d", list.TotalResults)
+	}
+
+	list = decodeBody[ListResponse](t, c.do(http.MethodGet, `/Users?filter=userName+eq+%22bob%22+or+userName+eq+%22carol%22`, nil))
+	if list.TotalResults != 2 {
+		t.Fatalf("or filter total = %d", list.TotalResults)
+	}
+
+	list = decodeBody[ListResponse](t, c.do(http.MethodGet, "/Users?startIndex=2&count=2", nil))
+	if list.TotalResults != 4 || list.ItemsPerPage != 2 || list.StartIndex != 2 {
+		t.Fatalf("page = %+v", list)
+	}
+	first := list.Resources[0].(map[string]any)
+	if first["userName"] != "bob" {
+		t.Errorf("page starts at %v, want bob", first["userName"])
+	}
+
+	if rec := c.do(http.MethodGet, `/Users?filter=userName+regex+%22x%22`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid filter: %d", rec.Code)
+	}
+}
+
+type recordingStore struct {
+	*MemoryStore
+	userQueries []Query
+}
+
+func (s *recordingStore) ListUsers(ctx context.Context, q Query) ([]UserRecord, int, error) {
+	s.userQueries = append(s.userQueries, q)
+	return s.MemoryStore.ListUsers(ctx, q)
+}
+
+func TestListUsersPushesQueryToStore(t *testing.T) {
+	store := &recordingStore{MemoryStore: NewMemoryStore()}
+	m := New(store, WithBearerTokens(testToken))
+	router := chi.NewRouter()
+	m.RegisterRoutes(router)
+	c := client{t: t, router: router}
+	for _, name := range []string{"alice", "alina", "albert"} {
+		createUser(t, c, name)
+	}
+	deleted := createUser(t, c, "alfred")
+	if rec := c.do(http.MethodDelete, "/Users/"+deleted.ID, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", rec.Code)
+	}
+
+	store.userQueries = nil
+	list := decodeBody[ListResponse](t, c.do(http.MethodGet, `/Users?filter=userName+sw+%22al%22&startIndex=2&count=1`, nil))
+	if list.TotalResults != 3 || list.ItemsPerPage != 1 || list.StartIndex != 2 {
+		t.Fatalf("page = %+v", list)
+	}
+	if got := list.Resources[0].(map[string]any)["userName"]; got != "alina" {
+		t.Errorf("page holds %v, want alina", got)
+	}
+	if len(store.userQueries) != 1 {
+		t.Fatalf("queries = %+v", store.userQueries)
+	}
+	q := store.userQueries[0]
+	want := Filter{{{Attr: "username", Op: "sw", Value: "al"}, {Attr: "status", Op: "ne", Value: string(auth.UserStatusDeleted)}}}
+	if q.StartIndex != 2 || q.Count != 1 || !reflect.DeepEqual(q.Filter, want) {
+		t.Errorf("query = %+v", q)
+	}
+}
+
+func TestListUsersEmailFilter(t *testing.T) {
+	c, _ := newClient(t, WithEmailKeys(bytes.Repeat([]byte{1}, 32), []byte("lookup")))
+	alice := createUser(t, c, "alice")
+	createUser(t, c, "bob")
+
+	list := decodeBody[ListResponse](t, c.do(http.MethodGet, `/Users?filter=emails.value+eq+%22ALICE@example.com%22`, nil))
+	if list.TotalResults != 1 || list.Resources[0].(map[string]any)["id"] != alice.ID {
+		t.Fatalf("email filter = %+v", list)
+	}
+	list = decodeBody[ListResponse](t, c.do(http.MethodGet, `/Users?filter=emails+pr`, nil))
+	if list.TotalResults != 2 {
+		t.Errorf("emails pr total = %d", list.TotalResults)
+	}
+	if rec := c.do(http.MethodGet, `/Users?filter=emails+co+%22example%22`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("emails co: %d", rec.Code)
+	}
+}
+
+func TestMongoFilter(t *testing.T) {
+	parse := func(raw string) Filter {
+		f, err := parseFilter(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		return f
+	}
+
+	got, err := mongoFilter(parse(`userName eq "a.b" and active eq false`), userClause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.M{"$or": bson.A{bson.M{"$and": bson.A{
+		bson.M{"user.username": primitive.Regex{Pattern: `^a\.b$`, Options: "i"}},
+		bson.M{"user.status": bson.M{"$ne": auth.UserStatusActive}},
+	}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filter = %v, want %v", got, want)
+	}
+
+	if got, _ := mongoFilter(nil, groupClause); len(got) != 0 {
+		t.Errorf("empty filter = %v", got)
+	}
+	if got, _ := groupClause(Comparison{Attr: "title", Op: "eq", Value: "x"}); !reflect.DeepEqual(got, matchNone) {
+		t.Errorf("unknown eq = %v", got)
+	}
+	if got, _ := groupClause(Comparison{Attr: "title", Op: "ne", Value: "x"}); len(got) != 0 {
+		t.Errorf("unknown ne = %v", got)
+	}
+	for _, raw := range []string{`meta.lastModified gt "yesterday"`, `active gt true`, `emails.lookup co "ab"`} {
+		if _, err := mongoFilter(parse(raw), userClause); !errors.Is(err, ErrUnsupportedFilter) {
+			t.Errorf("%s: err = %v", raw, err)
+		}
+	}
+}
+
+func TestGroupMembersPatch(t *testing.T) {
+	c, _ := newClient(t)
+	alice := createUser(t, c, "alice")
+	bob := createUser(t, c, "bob")
+
+	rec := c.do(http.MethodPost, "/Groups", map[string]any{
+		"displayName": "Engineering",
+		"members":     []map[string]string{{"value": alice.ID}},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create group: %d %s", rec.Code, rec.Body)
+	}
+	group := decodeBody[GroupResource](t, rec)
+
+	rec = c.do(http.MethodPatch, "/Groups/"+group.ID, map[string]any{
+		"Operations": []map[string]any{
+			{"op": "add", "path": "members", "value": []map[string]string{{"value": bob.ID}}},
+			{"op": "remove", "path": `members[value eq "` + alice.ID + `"]`},
+		},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch group: %d %s", rec.Code, rec.Body)
+	}
+	group = decodeBody[GroupResource](t, rec)
+	if len(group.Members) != 1 || group.Members[0].Value != bob.ID {
+		t.Fatalf("members = %+v", group.Members)
+	}
+
+	user := decodeBody[UserResource](t, c.do(http.MethodGet, "/Users/"+bob.ID, nil))
+	if len(user.Groups) != 1 || user.Groups[0].Display != "Engineering" {
+		t.Errorf("user groups = %+v", user.Groups)
+	}
+
+	rec = c.do(http.MethodPatch, "/Groups/"+group.ID, map[string]any{
+		"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]string{{"value": uuid.NewString()}}}},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown member: %d", rec.Code)
+	}
+}
+
+func TestBulkResolvesBulkIDs(t *testing.T) {
+	c, _ := newClient(t)
+	rec := c.do(http.MethodPost, "/Bulk", map[string]any{
+		"schemas": []string{SchemaBulkRequest},
+		"Operations": []map[string]any{
+			{"method": "POST", "bulkId": "u1", "path": "/Users", "data": map[string]any{"userName": "dave"}},
+			{"method": "POST", "bulkId": "g1", "path": "/Groups", "data": map[string]any{
+				"displayName": "Ops",
+				"members":     []map[string]string{{"value": "bulkId:u1"}},
+			}},
+			{"method": "PATCH", "path": "/Users/bulkId:u1", "data": map[string]any{
+				"Operations": []map[string]any{{"op": "replace", "path": "active", "value": false}},
+			}},
+			{"method": "DELETE", "path": "/Groups/bulkId:missing"},
+		},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bulk: %d %s", rec.Code, rec.Body)
+	}
+	resp := decodeBody[bulkResponse](t, rec)
+	if len(resp.Operations) != 4 {
+		t.Fatalf("operations = %d", len(resp.Operations))
+	}
+	want := []string{"201", "201", "200", "409"}
+	for i, op := range resp.Operations {
+		if op.Status != want[i] {
+			t.Errorf("operation %d status = %s, want %s (%s)", i, op.Status, want[i], op.Response)
+		}
+	}
+	if !strings.HasPrefix(resp.Operations[0].Location, "/scim/v2/Users/") {
+		t.Errorf("location = %q", resp.Operations[0].Location)
+	}
+
+	groups := decodeBody[ListResponse](t, c.do(http.MethodGet, `/Groups?filter=displayName+eq+%22Ops%22`, nil))
+	if groups.TotalResults != 1 {
+		t.Fatalf("groups = %+v", groups)
+	}
+	members := groups.Resources[0].(map[string]any)["members"].([]any)
+	userID := strings.TrimPrefix(resp.Operations[0].Location, "/scim/v2/Users/")
+	if len(members) != 1 || members[0].(map[string]any)["value"] != userID {
+		t.Errorf("members = %v, want %s", members, userID)
+	}
+}
+
+func TestBulkFailOnErrors(t *testing.T) {
+	c, _ := newClient(t)
+	rec := c.do(http.MethodPost, "/Bulk", map[string]any{
+		"failOnErrors": 1,
+		"Operations": []map[string]any{
+			{"method": "POST", "bulkId": "a", "path": "/Users", "data": map[string]any{}},
+			{"method": "POST", "bulkId": "b", "path": "/Users", "data": map[string]any{"userName": "erin"}},
+		},
+	})
+	resp := decodeBody[bulkResponse](t, rec)
+	if len(resp.Operations) != 1 || resp.Operations[0].Status != "400" {
+		t.Fatalf("operations = %+v", resp.Operations)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	attrs := map[string][]string{"username": {"bjensen"}, "emails.value": {"a@x.com", "b@y.org"}, "active": {"true"}}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "BJENSEN"`, true},
+		{`emails.value ew "y.org" and active eq true`, true},
+		{`emails.value co "z" or userName sw "bj"`, true},
+		{`userName ne "bjensen"`, false},
+		{`externalId pr`, false},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+		if got := f.Match(attrs); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+	for _, bad := range []string{`userName eq`, `userName eq "x" and`, `userName "x"`, `userName eq "x`} {
+		if _, err := parseFilter(bad); err == nil {
+			t.Errorf("%s parsed", bad)
+		}
+	}
+}
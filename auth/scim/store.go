@@ -0,0 +1,225 @@
+package scim
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned by stores when no record has the requested ID.
+	ErrNotFound = errors.New("scim: not found")
+	// ErrUnsupportedFilter is returned by stores that cannot run a filter;
+	// the module answers it with an invalidFilter error.
+	ErrUnsupportedFilter = errors.New("scim: unsupported filter")
+)
+
+// attrEmailLookup is the user attribute carrying the hex email lookup hash.
+const attrEmailLookup = "emails.lookup"
+
+// UserRecord is a provisioned auth.User with the SCIM attributes the user
+// model has no room for.
+type UserRecord struct {
+	User       auth.User
+	ExternalID string
+	UpdatedAt  time.Time
+	Version    int
+}
+
+// Group is a provisioned group. Members holds user IDs.
+type Group struct {
+	ID          uuid.UUID
+	DisplayName string
+	ExternalID  string
+	Members     []uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Version     int
+}
+
+// Query selects a window of records ordered by creation. Filter is matched
+// against the attributes UserAttributes and GroupAttributes report;
+// StartIndex is one-based and Count < 0 lifts the page size limit.
+type Query struct {
+	Filter     Filter
+	StartIndex int
+	Count      int
+}
+
+// All selects every record matching f.
+func All(f Filter) Query {
+	return Query{Filter: f, StartIndex: 1, Count: -1}
+}
+
+// window returns the bounds of q's page over total matches.
+func (q Query) window(total int) (from, to int) {
+	from = min(max(q.StartIndex, 1)-1, total)
+	to = total
+	if q.Count >= 0 {
+		to = min(from+q.Count, total)
+	}
+	return from, to
+}
+
+// Store persists provisioned users and groups. List methods apply the query
+// themselves and return the page along with the total number of matches, so
+// backends can filter and paginate close to the data.
+type Store interface {
+	ListUsers(ctx context.Context, q Query) ([]UserRecord, int, error)
+	GetUser(ctx context.Context, id uuid.UUID) (UserRecord, error)
+	SaveUser(ctx context.Context, user UserRecord) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+
+	ListGroups(ctx context.Context, q Query) ([]Group, int, error)
+	GetGroup(ctx context.Context, id uuid.UUID) (Group, error)
+	SaveGroup(ctx context.Context, group Group) error
+	DeleteGroup(ctx context.Context, id uuid.UUID) error
+}
+
+// UserAttributes flattens rec into the lower-cased attribute paths user
+// queries filter on. Besides the SCIM attributes it reports the account
+// status and the hex email lookup hash, since stored emails are encrypted.
+func UserAttributes(rec UserRecord) map[string][]string {
+	u := rec.User
+	attrs := map[string][]string{
+		"id":                {u.ID.String()},
+		"username":          {u.Username},
+		"externalid":        {rec.ExternalID},
+		"displayname":       {u.Name},
+		"name.formatted":    {u.Name},
+		"active":            {strconv.FormatBool(u.Status == auth.UserStatusActive)},
+		"status":            {string(u.Status)},
+		"meta.created":      {u.CreatedAt.UTC().Format(time.RFC3339)},
+		"meta.lastmodified": {rec.UpdatedAt.UTC().Format(time.RFC3339)},
+	}
+	if len(u.EmailLookup) > 0 {
+		attrs[attrEmailLookup] = []string{hex.EncodeToString(u.EmailLookup)}
+	}
+	return attrs
+}
+
+// GroupAttributes flattens g into the lower-cased attribute paths group
+// queries filter on.
+func GroupAttributes(g Group) map[string][]string {
+	attrs := map[string][]string{
+		"id":                {g.ID.String()},
+		"displayname":       {g.DisplayName},
+		"externalid":        {g.ExternalID},
+		"meta.created":      {g.CreatedAt.UTC().Format(time.RFC3339)},
+		"meta.lastmodified": {g.UpdatedAt.UTC().Format(time.RFC3339)},
+	}
+	for _, m := range g.Members {
+		attrs["members"] = append(attrs["members"], m.String())
+		attrs["members.value"] = append(attrs["members.value"], m.String())
+	}
+	return attrs
+}
+
+// MemoryStore keeps users and groups in process memory.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	users  map[uuid.UUID]UserRecord
+	groups map[uuid.UUID]Group
+}
+
+// NewMemoryStore builds an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[uuid.UUID]UserRecord), groups: make(map[uuid.UUID]Group)}
+}
+
+// ListUsers implements Store.
+func (s *MemoryStore) ListUsers(_ context.Context, q Query) ([]UserRecord, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]UserRecord, 0, len(s.users))
+	for _, u := range s.users {
+		if q.Filter.Match(UserAttributes(u)) {
+			out = append(out, u)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].User.CreatedAt.Before(out[j].User.CreatedAt) })
+	from, to := q.window(len(out))
+	return out[from:to], len(out), nil
+}
+
+// GetUser implements Store.
+func (s *MemoryStore) GetUser(_ context.Context, id uuid.UUID) (UserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return UserRecord{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// SaveUser implements Store.
+func (s *MemoryStore) SaveUser(_ context.Context, user UserRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.User.ID] = user
+	return nil
+}
+
+// DeleteUser implements Store.
+func (s *MemoryStore) DeleteUser(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// ListGroups implements Store.
+func (s *MemoryStore) ListGroups(_ context.Context, q Query) ([]Group, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		if q.Filter.Match(GroupAttributes(g)) {
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	from, to := q.window(len(out))
+	return out[from:to], len(out), nil
+}
+
+// GetGroup implements Store.
+func (s *MemoryStore) GetGroup(_ context.Context, id uuid.UUID) (Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.groups[id]
+	if !ok {
+		return Group{}, ErrNotFound
+	}
+	return g, nil
+}
+
+// SaveGroup implements Store.
+func (s *MemoryStore) SaveGroup(_ context.Context, group Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[group.ID] = group
+	return nil
+}
+
+// DeleteGroup implements Store.
+func (s *MemoryStore) DeleteGroup(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.groups, id)
+	return nil
+}
@@ -0,0 +1,309 @@
+package scim
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (m *Module) listUsers(w http.ResponseWriter, r *http.Request) {
+	p, ok := m.parsePage(w, r)
+	if !ok {
+		return
+	}
+	f, err := m.userFilter(p.filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrTypeInvalidFilter, err.Error())
+		return
+	}
+	users, total, err := m.store.ListUsers(r.Context(), p.query(f))
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, rec := range users {
+		ids = append(ids, rec.User.ID)
+	}
+	groups, err := m.groupsOf(r.Context(), ids...)
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for _, rec := range users {
+		resources = append(resources, m.userResource(rec, groups))
+	}
+	p.respond(w, resources, total)
+}
+
+// userFilter hides deprovisioned users and rewrites email comparisons onto
+// the lookup hash, the only form of the encrypted email a store can match.
+func (m *Module) userFilter(f Filter) (Filter, error) {
+	out := make(Filter, 0, len(f))
+	for _, and := range f {
+		rewritten := make([]Comparison, 0, len(and))
+		for _, c := range and {
+			if c.Attr == "emails" || c.Attr == "emails.value" {
+				switch c.Op {
+				case "eq", "ne":
+					c.Value = hex.EncodeToString(auth.ComputeLookupHash(auth.NormalizeEmail(c.Value), m.lookupKey))
+				case "pr":
+				default:
+					return nil, fmt.Errorf("emails only support the eq, ne and pr operators")
+				}
+				c.Attr = attrEmailLookup
+			}
+			rewritten = append(rewritten, c)
+		}
+		out = append(out, rewritten)
+	}
+	return out.And(Comparison{Attr: "status", Op: "ne", Value: string(auth.UserStatusDeleted)}), nil
+}
+
+func (m *Module) getUser(w http.ResponseWriter, r *http.Request) {
+	rec, ok := m.loadUser(w, r)
+	if !ok {
+		return
+	}
+	groups, err := m.groupsOf(r.Context(), rec.User.ID)
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	writeResource(w, http.StatusOK, "", rec.Version, m.userResource(rec, groups))
+}
+
+func (m *Module) createUser(w http.ResponseWriter, r *http.Request) {
+	var res UserResource
+	if !decode(w, r, &res) {
+		return
+	}
+	now := m.now().UTC()
+	rec := UserRecord{
+		User: auth.User{ID: uuid.New(), Status: auth.UserStatusActive, CreatedAt: now},
+	}
+	if !m.saveUser(w, r, &rec, res) {
+		return
+	}
+	m.log.Info("scim user provisioned", "user_id", rec.User.ID, "username", rec.User.Username)
+	writeResource(w, http.StatusCreated, m.location("Users", rec.User.ID.String()), rec.Version, m.userResource(rec, nil))
+}
+
+func (m *Module) replaceUser(w http.ResponseWriter, r *http.Request) {
+	rec, ok := m.loadUser(w, r)
+	if !ok || !checkVersion(w, r, rec.Version) {
+		return
+	}
+	var res UserResource
+	if !decode(w, r, &res) {
+		return
+	}
+	m.updateUser(w, r, rec, res)
+}
+
+func (m *Module) patchUser(w http.ResponseWriter, r *http.Request) {
+	rec, ok := m.loadUser(w, r)
+	if !ok || !checkVersion(w, r, rec.Version) {
+		return
+	}
+	var req patchRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	var res UserResource
+	if err := req.apply(m.userResource(rec, nil), &res); err != nil {
+		writeError(w, http.StatusBadRequest, err.scimType, err.detail)
+		return
+	}
+	m.updateUser(w, r, rec, res)
+}
+
+func (m *Module) deleteUser(w http.ResponseWriter, r *http.Request) {
+	rec, ok := m.loadUser(w, r)
+	if !ok || !checkVersion(w, r, rec.Version) {
+		return
+	}
+	ctx := r.Context()
+	rec.User.Status = auth.UserStatusDeleted
+	rec.UpdatedAt = m.now().UTC()
+	rec.Version++
+	if err := m.store.SaveUser(ctx, rec); err != nil {
+		m.fail(w, err)
+		return
+	}
+	if err := m.dropMember(ctx, rec.User.ID); err != nil {
+		m.fail(w, err)
+		return
+	}
+	m.log.Info("scim user deprovisioned", "user_id", rec.User.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Module) updateUser(w http.ResponseWriter, r *http.Request, rec UserRecord, res UserResource) {
+	if !m.saveUser(w, r, &rec, res) {
+		return
+	}
+	groups, err := m.groupsOf(r.Context(), rec.User.ID)
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	m.log.Info("scim user updated", "user_id", rec.User.ID, "status", rec.User.Status)
+	writeResource(w, http.StatusOK, "", rec.Version, m.userResource(rec, groups))
+}
+
+// saveUser validates res, applies it onto rec and persists the result.
+func (m *Module) saveUser(w http.ResponseWriter, r *http.Request, rec *UserRecord, res UserResource) bool {
+	res.UserName = strings.TrimSpace(res.UserName)
+	if res.UserName == "" {
+		writeError(w, http.StatusBadRequest, ErrTypeInvalidValue, "userName is required")
+		return false
+	}
+	taken, err := m.userNameTaken(r.Context(), res.UserName, rec.User.ID)
+	if err != nil {
+		m.fail(w, err)
+		return false
+	}
+	if taken {
+		writeError(w, http.StatusConflict, ErrTypeUniqueness, fmt.Sprintf("userName %q is already in use", res.UserName))
+		return false
+	}
+	if err := m.applyUser(rec, res); err != nil {
+		m.fail(w, err)
+		return false
+	}
+	rec.UpdatedAt = m.now().UTC()
+	rec.Version++
+	if err := m.store.SaveUser(r.Context(), *rec); err != nil {
+		m.fail(w, err)
+		return false
+	}
+	return true
+}
+
+// loadUser resolves the {id} parameter. Deprovisioned users are not found.
+func (m *Module) loadUser(w http.ResponseWriter, r *http.Request) (UserRecord, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "", "resource not found")
+		return UserRecord{}, false
+	}
+	rec, err := m.store.GetUser(r.Context(), id)
+	if err == nil && rec.User.Status == auth.UserStatusDeleted {
+		err = ErrNotFound
+	}
+	if err != nil {
+		m.fail(w, err)
+		return UserRecord{}, false
+	}
+	return rec, true
+}
+
+func (m *Module) userNameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	_, taken, err := m.store.ListUsers(ctx, Query{
+		Filter: Filter{{
+			{Attr: "username", Op: "eq", Value: name},
+			{Attr: "id", Op: "ne", Value: except.String()},
+			{Attr: "status", Op: "ne", Value: string(auth.UserStatusDeleted)},
+		}},
+		StartIndex: 1,
+	})
+	return taken > 0, err
+}
+
+// applyUser maps a SCIM user onto rec. Attributes auth.User cannot hold are
+// dropped; an absent active flag keeps the current status.
+func (m *Module) applyUser(rec *UserRecord, res UserResource) error {
+	rec.User.Username = res.UserName
+	rec.ExternalID = res.ExternalID
+	rec.User.Name = formatName(res.Name)
+	if rec.User.Name == "" {
+		rec.User.Name = res.DisplayName
+	}
+	if res.Active != nil {
+		rec.User.Status = auth.UserStatusSuspended
+		if *res.Active {
+			rec.User.Status = auth.UserStatusActive
+		}
+	}
+	if m.encKey == nil {
+		return nil
+	}
+	email := primaryEmail(res.Emails)
+	if email == "" {
+		rec.User.EmailCT, rec.User.EmailIV, rec.User.EmailTag, rec.User.EmailLookup = nil, nil, nil, nil
+		return nil
+	}
+	email = auth.NormalizeEmail(email)
+	enc, err := auth.EncryptEmail(email, m.encKey)
+	if err != nil {
+		return fmt.Errorf("scim: encrypt email: %w", err)
+	}
+	rec.User.EmailCT, rec.User.EmailIV, rec.User.EmailTag = enc.Ciphertext, enc.IV, enc.Tag
+	rec.User.EmailLookup = auth.ComputeLookupHash(email, m.lookupKey)
+	return nil
+}
+
+// userResource renders rec, listing the groups it belongs to.
+func (m *Module) userResource(rec UserRecord, groups []Group) UserResource {
+	u := rec.User
+	active := u.Status == auth.UserStatusActive
+	res := UserResource{
+		Schemas:     []string{SchemaUser},
+		ID:          u.ID.String(),
+		ExternalID:  rec.ExternalID,
+		UserName:    u.Username,
+		DisplayName: u.Name,
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: rec.UpdatedAt,
+			Location:     m.location("Users", u.ID.String()),
+			Version:      version(rec.Version),
+		},
+	}
+	if u.Name != "" {
+		res.Name = &Name{Formatted: u.Name}
+	}
+	if m.encKey != nil && len(u.EmailCT) > 0 {
+		email, err := auth.DecryptEmail(&auth.EncryptedData{Ciphertext: u.EmailCT, IV: u.EmailIV, Tag: u.EmailTag}, m.encKey)
+		if err != nil {
+			m.log.Error("cannot decrypt user email", "user_id", u.ID, "error", err)
+		} else {
+			res.Emails = []Email{{Value: email, Type: "work", Primary: true}}
+		}
+	}
+	for _, g := range groups {
+		for _, member := range g.Members {
+			if member == u.ID {
+				res.Groups = append(res.Groups, MemberRef{
+					Value:   g.ID.String(),
+					Display: g.DisplayName,
+					Ref:     m.location("Groups", g.ID.String()),
+				})
+				break
+			}
+		}
+	}
+	return res
+}
+
+func primaryEmail(emails []Email) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/google/uuid"
+)
+
+// Security event types recorded by SecurityEvents.
+const (
+	SecurityLogin              = "auth.login"
+	SecurityLoginFailed        = "auth.login_failed"
+	SecurityPermissionDenied   = "auth.permission_denied"
+	SecurityTokenRefreshed     = "auth.token_refreshed"
+	SecurityRefreshTokenReused = "auth.refresh_token_reused"
+	SecurityMFAChallenged      = "auth.mfa_challenged"
+	SecurityMFAVerified        = "auth.mfa_verified"
+	SecurityMFAFailed          = "auth.mfa_failed"
+	SecurityEgressBlocked      = "egress.blocked"
+)
+
+// Anomaly labels set by the detectors shipped with this package.
+const (
+	AnomalyNewDevice = "new_device"
+	AnomalyNewGeo    = "new_geo"
+)
+
+// SecurityEvent describes one security relevant action. Actor is set when
+// the subject was impersonated.
+type SecurityEvent struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Time       time.Time         `json:"time"`
+	Subject    string            `json:"subject,omitempty"`
+	Actor      string            `json:"actor,omitempty"`
+	SessionID  string            `json:"session_id,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	DeviceID   string            `json:"device_id,omitempty"`
+	Geo        string            `json:"geo,omitempty"`
+	Permission string            `json:"permission,omitempty"`
+	Resource   string            `json:"resource,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Anomalies  []string          `json:"anomalies,omitempty"`
+}
+
+// SecurityEventFromRequest starts an event of type with the client IP and
+// user agent of r.
+func SecurityEventFromRequest(r *http.Request, eventType string) SecurityEvent {
+	return SecurityEvent{Type: eventType, IP: aqmctx.ClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// SecuritySink stores or forwards recorded events.
+type SecuritySink interface {
+	RecordSecurityEvent(ctx context.Context, ev SecurityEvent) error
+}
+
+// SecuritySinkFunc adapts a function to SecuritySink.
+type SecuritySinkFunc func(ctx context.Context, ev SecurityEvent) error
+
+// RecordSecurityEvent implements SecuritySink.
+func (f SecuritySinkFunc) RecordSecurityEvent(ctx context.Context, ev SecurityEvent) error {
+	return f(ctx, ev)
+}
+
+// AnomalyDetector inspects an event before it reaches the sinks and returns
+// the anomaly labels that apply, such as AnomalyNewDevice.
+type AnomalyDetector interface {
+	DetectAnomalies(ctx context.Context, ev SecurityEvent) ([]string, error)
+}
+
+// AnomalyDetectorFunc adapts a function to AnomalyDetector.
+type AnomalyDetectorFunc func(ctx context.Context, ev SecurityEvent) ([]string, error)
+
+// DetectAnomalies implements AnomalyDetector.
+func (f AnomalyDetectorFunc) DetectAnomalies(ctx context.Context, ev SecurityEvent) ([]string, error) {
+	return f(ctx, ev)
+}
+
+// SecurityEventsOption configures SecurityEvents.
+type SecurityEventsOption func(*SecurityEvents)
+
+// WithSecuritySink adds sinks every event is sent to.
+func WithSecuritySink(sinks ...SecuritySink) SecurityEventsOption {
+	return func(s *SecurityEvents) {
+		for _, sink := range sinks {
+			if sink != nil {
+				s.sinks = append(s.sinks, sink)
+			}
+		}
+	}
+}
+
+// WithAnomalyDetector adds detectors run on every event before the sinks.
+func WithAnomalyDetector(detectors ...AnomalyDetector) SecurityEventsOption {
+	return func(s *SecurityEvents) {
+		for _, d := range detectors {
+			if d != nil {
+				s.detectors = append(s.detectors, d)
+			}
+		}
+	}
+}
+
+// WithAnomalyHandler calls fn for every event flagged by a detector, after
+// the sinks, e.g. to alert or to require step-up authentication.
+func WithAnomalyHandler(fn func(ctx context.Context, ev SecurityEvent)) SecurityEventsOption {
+	return func(s *SecurityEvents) {
+		s.onAnomaly = fn
+	}
+}
+
+// SecurityEvents records security events, runs anomaly detectors on them and
+// fans them out to sinks. A nil *SecurityEvents discards everything, so
+// components can hold one unconditionally.
+type SecurityEvents struct {
+	sinks     []SecuritySink
+	detectors []AnomalyDetector
+	onAnomaly func(ctx context.Context, ev SecurityEvent)
+	now       func() time.Time
+}
+
+// NewSecurityEvents builds a recorder.
+func NewSecurityEvents(opts ...SecurityEventsOption) *SecurityEvents {
+	s := &SecurityEvents{now: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Record completes ev and sends it to every sink. Missing ID and Time are
+// generated, and Subject, Actor and SessionID default to the claims in ctx.
+// Detector and sink failures are joined in the returned error; every sink is
+// tried regardless.
+func (s *SecurityEvents) Record(ctx context.Context, ev SecurityEvent) error {
+	if s == nil {
+		return nil
+	}
+	if ev.ID == "" {
+		ev.ID = uuid.NewString()
+	}
+	if ev.Time.IsZero() {
+		ev.Time = s.now().UTC()
+	}
+	if claims := ClaimsFrom(ctx); claims != nil {
+		if ev.Subject == "" {
+			ev.Subject = claims.Subject
+		}
+		if ev.SessionID == "" {
+			ev.SessionID = claims.SessionID
+		}
+	}
+	if ev.Actor == "" && IsImpersonating(ctx) {
+		ev.Actor = ActorFrom(ctx).Subject
+	}
+
+	var errs error
+	for _, d := range s.detectors {
+		labels, err := d.DetectAnomalies(ctx, ev)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("detecting anomalies: %w", err))
+			continue
+		}
+		ev.Anomalies = append(ev.Anomalies, labels...)
+	}
+	for _, sink := range s.sinks {
+		if err := sink.RecordSecurityEvent(ctx, ev); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("recording %s: %w", ev.Type, err))
+		}
+	}
+	if len(ev.Anomalies) > 0 && s.onAnomaly != nil {
+		s.onAnomaly(ctx, ev)
+	}
+	return errs
+}
+
+// Login records a successful login of subject.
+func (s *SecurityEvents) Login(ctx context.Context, ev SecurityEvent) error {
+	ev.Type = SecurityLogin
+	return s.Record(ctx, ev)
+}
+
+// LoginFailed records a failed login, with the reason it failed.
+func (s *SecurityEvents) LoginFailed(ctx context.Context, ev SecurityEvent, reason string) error {
+	ev.Type, ev.Reason = SecurityLoginFailed, reason
+	return s.Record(ctx, ev)
+}
+
+// PermissionDenied records a denied authorization check.
+func (s *SecurityEvents) PermissionDenied(ctx context.Context, subject, permission, resource string) error {
+	return s.Record(ctx, SecurityEvent{Type: SecurityPermissionDenied, Subject: subject, Permission: permission, Resource: resource})
+}
+
+// TokenRefreshed records a token refresh for a session.
+func (s *SecurityEvents) TokenRefreshed(ctx context.Context, subject, sessionID string) error {
+	return s.Record(ctx, SecurityEvent{Type: SecurityTokenRefreshed, Subject: subject, SessionID: sessionID})
+}
+
+// RefreshTokenReused records an already exchanged refresh token being
+// presented again, a sign it was stolen; the session has been revoked.
+func (s *SecurityEvents) RefreshTokenReused(ctx context.Context, subject, sessionID string) error {
+	return s.Record(ctx, SecurityEvent{Type: SecurityRefreshTokenReused, Subject: subject, SessionID: sessionID})
+}
+
+// MFA records an MFA step; eventType is one of SecurityMFAChallenged,
+// SecurityMFAVerified and SecurityMFAFailed. method names the factor, such
+// as "totp" or "webauthn".
+func (s *SecurityEvents) MFA(ctx context.Context, eventType, subject, method string) error {
+	return s.Record(ctx, SecurityEvent{Type: eventType, Subject: subject, Fields: map[string]string{"method": method}})
+}
+
+// SecurityLogger is the subset of aqm.Logger used by LoggerSink.
+type SecurityLogger interface {
+	Info(v ...any)
+	Warn(v ...any)
+}
+
+// LoggerSink writes events as structured log lines, at warn level for
+// failures, denials and anomalies.
+func LoggerSink(logger SecurityLogger) SecuritySink {
+	return SecuritySinkFunc(func(_ context.Context, ev SecurityEvent) error {
+		args := []any{"security event", "type", ev.Type, "id", ev.ID, "subject", ev.Subject}
+		for _, kv := range [][2]string{
+			{"actor", ev.Actor}, {"session_id", ev.SessionID}, {"ip", ev.IP}, {"user_agent", ev.UserAgent},
+			{"device_id", ev.DeviceID}, {"geo", ev.Geo}, {"permission", ev.Permission},
+			{"resource", ev.Resource}, {"reason", ev.Reason},
+		} {
+			if kv[1] != "" {
+				args = append(args, kv[0], kv[1])
+			}
+		}
+		for k, v := range ev.Fields {
+			args = append(args, k, v)
+		}
+		if len(ev.Anomalies) > 0 {
+			args = append(args, "anomalies", ev.Anomalies)
+		}
+		switch {
+		case len(ev.Anomalies) > 0, ev.Type == SecurityLoginFailed, ev.Type == SecurityPermissionDenied,
+			ev.Type == SecurityMFAFailed, ev.Type == SecurityRefreshTokenReused:
+			logger.Warn(args...)
+		default:
+			logger.Info(args...)
+		}
+		return nil
+	})
+}
+
+// PublisherSink publishes events as JSON to topic, defaulting to
+// "auth.security".
+func PublisherSink(publisher events.Publisher, topic string) SecuritySink {
+	if topic == "" {
+		topic = "auth.security"
+	}
+	return SecuritySinkFunc(func(ctx context.Context, ev SecurityEvent) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		return publisher.Publish(ctx, topic, data)
+	})
+}
+
+// FirstSeenDetector flags login events carrying a value of a subject not
+// seen on its earlier logins, as returned by attr, with label. The first
+// login of a subject is never flagged. It remembers values in memory and
+// suits single-instance services; deployments needing shared history
+// provide their own AnomalyDetector.
+func FirstSeenDetector(label string, attr func(SecurityEvent) string) AnomalyDetector {
+	var mu sync.Mutex
+	seen := make(map[string]map[string]bool)
+	return AnomalyDetectorFunc(func(_ context.Context, ev SecurityEvent) ([]string, error) {
+		value := attr(ev)
+		if ev.Type != SecurityLogin || ev.Subject == "" || value == "" {
+			return nil, nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		values, known := seen[ev.Subject]
+		if !known {
+			values = make(map[string]bool)
+			seen[ev.Subject] = values
+		}
+		isNew := known && !values[value]
+		values[value] = true
+		if isNew {
+			return []string{label}, nil
+		}
+		return nil, nil
+	})
+}
+
+// NewDeviceDetector flags logins from a device ID new to the subject.
+func NewDeviceDetector() AnomalyDetector {
+	return FirstSeenDetector(AnomalyNewDevice, func(ev SecurityEvent) string { return ev.DeviceID })
+}
+
+// NewGeoDetector flags logins from a location new to the subject.
+func NewGeoDetector() AnomalyDetector {
+	return FirstSeenDetector(AnomalyNewGeo, func(ev SecurityEvent) string { return ev.Geo })
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+type captureLogger struct {
+	infos, warns [][]any
+}
+
+func (l *captureLogger) Info(v ...any) { l.infos = append(l.infos, v) }
+func (l *captureLogger) Warn(v ...any) { l.warns = append(l.warns, v) }
+
+type topicPublisher map[string][][]byte
+
+func (p topicPublisher) Publish(_ context.Context, topic string, msg []byte) error {
+	p[topic] = append(p[topic], msg)
+	return nil
+}
+
+func TestSecurityEventsRecord(t *testing.T) {
+	var got []SecurityEvent
+	sink := SecuritySinkFunc(func(_ context.Context, ev SecurityEvent) error {
+		got = append(got, ev)
+		return nil
+	})
+	failing := SecuritySinkFunc(func(context.Context, SecurityEvent) error { return errors.New("down") })
+	recorder := NewSecurityEvents(WithSecuritySink(failing, sink))
+
+	ctx := WithClaims(context.Background(), &TokenClaims{Subject: "user-1", SessionID: "s-1"})
+	ctx = WithActor(ctx, &TokenClaims{Subject: "support-1"})
+	err := recorder.PermissionDenied(ctx, "", "orders:delete", "order-7")
+	if err == nil {
+		t.Fatal("sink failure not reported")
+	}
+	if len(got) != 1 {
+		t.Fatalf("remaining sink not called after failure: %d events", len(got))
+	}
+	ev := got[0]
+	if ev.ID == "" || ev.Time.IsZero() || ev.Subject != "user-1" || ev.SessionID != "s-1" || ev.Actor != "support-1" {
+		t.Fatalf("event not completed from context: %+v", ev)
+	}
+
+	var nilRecorder *SecurityEvents
+	if err := nilRecorder.TokenRefreshed(ctx, "user-1", "s-1"); err != nil {
+		t.Fatalf("nil recorder: %v", err)
+	}
+}
+
+func TestSecurityEventsAnomalies(t *testing.T) {
+	var flagged []SecurityEvent
+	recorder := NewSecurityEvents(
+		WithAnomalyDetector(NewDeviceDetector(), NewGeoDetector()),
+		WithAnomalyHandler(func(_ context.Context, ev SecurityEvent) { flagged = append(flagged, ev) }),
+	)
+	ctx := context.Background()
+	login := func(device, geo string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/login", nil)
+		ev := SecurityEventFromRequest(req, "")
+		ev.Subject, ev.DeviceID, ev.Geo = "alice", device, geo
+		if err := recorder.Login(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	login("laptop", "ES")
+	login("laptop", "ES")
+	if len(flagged) != 0 {
+		t.Fatalf("known device flagged: %+v", flagged)
+	}
+	login("phone", "AR")
+	if len(flagged) != 1 || fmt.Sprint(flagged[0].Anomalies) != "[new_device new_geo]" {
+		t.Fatalf("flagged = %+v", flagged)
+	}
+
+	detectorErr := AnomalyDetectorFunc(func(context.Context, SecurityEvent) ([]string, error) {
+		return nil, errors.New("geoip unavailable")
+	})
+	if err := NewSecurityEvents(WithAnomalyDetector(detectorErr)).Login(ctx, SecurityEvent{Subject: "bob"}); err == nil {
+		t.Fatal("detector failure not reported")
+	}
+}
+
+func TestSecuritySinks(t *testing.T) {
+	logger := &captureLogger{}
+	pub := topicPublisher{}
+	recorder := NewSecurityEvents(WithSecuritySink(LoggerSink(logger), PublisherSink(pub, "")))
+	ctx := context.Background()
+
+	if err := recorder.Login(ctx, SecurityEvent{Subject: "alice", IP: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.LoginFailed(ctx, SecurityEvent{Subject: "alice"}, "bad_password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.MFA(ctx, SecurityMFAFailed, "alice", "totp"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.infos) != 1 || len(logger.warns) != 2 {
+		t.Fatalf("infos %d, warns %d; want 1 and 2", len(logger.infos), len(logger.warns))
+	}
+
+	msgs := pub["auth.security"]
+	if len(msgs) != 3 {
+		t.Fatalf("published %d events", len(msgs))
+	}
+	var ev SecurityEvent
+	if err := json.Unmarshal(msgs[1], &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != SecurityLoginFailed || ev.Reason != "bad_password" {
+		t.Fatalf("published event = %+v", ev)
+	}
+}
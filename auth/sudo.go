@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"strconv"
+	"time"
+)
+
+// SudoUntilClaim is the claims context entry holding the Unix time until
+// which the session is in sudo mode.
+const SudoUntilClaim = "sudo_until"
+
+// GrantSudo puts claims in sudo mode for d from now. Call it after the user
+// re-authenticated, before issuing the token.
+func GrantSudo(claims *TokenClaims, d time.Duration) {
+	if claims.Context == nil {
+		claims.Context = make(map[string]string)
+	}
+	claims.Context[SudoUntilClaim] = strconv.FormatInt(time.Now().Add(d).Unix(), 10)
+}
+
+// InSudoMode reports whether claims are in sudo mode at now.
+func InSudoMode(claims *TokenClaims, now time.Time) bool {
+	if claims == nil {
+		return false
+	}
+	until, err := strconv.ParseInt(claims.Context[SudoUntilClaim], 10, 64)
+	return err == nil && now.Unix() < until
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenPair is what a client receives on login and on every refresh.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	SessionID        string    `json:"session_id"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenServiceOption configures a TokenService.
+type TokenServiceOption func(*TokenService)
+
+// WithAccessTTL sets the access token lifetime (default 15m).
+func WithAccessTTL(ttl time.Duration) TokenServiceOption {
+	return func(s *TokenService) {
+		if ttl > 0 {
+			s.accessTTL = ttl
+		}
+	}
+}
+
+// WithRefreshTTL sets the refresh token lifetime (default 30 days). Each
+// refresh issues a token valid for this long again.
+func WithRefreshTTL(ttl time.Duration) TokenServiceOption {
+	return func(s *TokenService) {
+		if ttl > 0 {
+			s.refreshTTL = ttl
+		}
+	}
+}
+
+// WithTokenSecurityEvents records token refreshes and detected reuse.
+func WithTokenSecurityEvents(events *SecurityEvents) TokenServiceOption {
+	return func(s *TokenService) {
+		s.events = events
+	}
+}
+
+// TokenService issues access and refresh token pairs and manages their
+// lifecycle. Refresh tokens are single use: exchanging one returns a new
+// pair, and presenting an already exchanged token revokes the whole session
+// since either the client or an attacker holds a stolen copy. Access tokens
+// are PASETO tokens checked by Verify against the revocation store and the
+// subject's authorization version.
+type TokenService struct {
+	privateKey  ed25519.PrivateKey
+	publicKey   ed25519.PublicKey
+	refresh     RefreshStore
+	revocations RevocationStore
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	events      *SecurityEvents
+	now         func() time.Time
+}
+
+// NewTokenService signs tokens with privateKey and keeps state in the given
+// stores; MemoryTokenStore implements both.
+func NewTokenService(privateKey ed25519.PrivateKey, refresh RefreshStore, revocations RevocationStore, opts ...TokenServiceOption) *TokenService {
+	s := &TokenService{
+		privateKey:  privateKey,
+		publicKey:   privateKey.Public().(ed25519.PublicKey),
+		refresh:     refresh,
+		revocations: revocations,
+		accessTTL:   15 * time.Minute,
+		refreshTTL:  30 * 24 * time.Hour,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Issue starts a new session for subject and returns its first pair.
+func (s *TokenService) Issue(ctx context.Context, subject, audience string, tokenContext map[string]string) (TokenPair, error) {
+	return s.issue(ctx, uuid.NewString(), subject, audience, tokenContext)
+}
+
+// Refresh exchanges refreshToken for a new pair in the same session. It
+// returns ErrRefreshInvalid for unknown or expired tokens, ErrTokenRevoked
+// for revoked sessions and ErrRefreshReused, after revoking the session,
+// when the token was already exchanged.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	now := s.now()
+	stored, err := s.refresh.UseRefreshToken(ctx, hashToken(refreshToken), now)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !stored.UsedAt.IsZero() {
+		if err := s.revocations.RevokeSession(ctx, stored.SessionID, now.Add(s.refreshTTL)); err != nil {
+			return TokenPair{}, fmt.Errorf("revoking reused session: %w", err)
+		}
+		s.events.RefreshTokenReused(ctx, stored.Subject, stored.SessionID)
+		return TokenPair{}, ErrRefreshReused
+	}
+	if now.After(stored.ExpiresAt) {
+		return TokenPair{}, ErrRefreshInvalid
+	}
+	revoked, err := s.revocations.SessionRevoked(ctx, stored.SessionID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if revoked {
+		return TokenPair{}, ErrTokenRevoked
+	}
+
+	pair, err := s.issue(ctx, stored.SessionID, stored.Subject, stored.Audience, stored.Context)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	s.events.TokenRefreshed(ctx, stored.Subject, stored.SessionID)
+	return pair, nil
+}
+
+// Revoke rejects every token of sessionID from now on.
+func (s *TokenService) Revoke(ctx context.Context, sessionID string) error {
+	return s.revocations.RevokeSession(ctx, sessionID, s.now().Add(s.refreshTTL))
+}
+
+// InvalidateAuthz bumps the authorization version of subject, so access
+// tokens issued before are rejected and clients refresh to pick up the new
+// permissions.
+func (s *TokenService) InvalidateAuthz(ctx context.Context, subject string) error {
+	_, err := s.revocations.BumpAuthzVersion(ctx, subject)
+	return err
+}
+
+// Verify checks an access token for audience and returns its claims. Besides
+// signature, expiry and audience, it rejects tokens of revoked sessions with
+// ErrTokenRevoked and tokens older than the subject's authorization version
+// with ErrAuthzVersionStale.
+func (s *TokenService) Verify(ctx context.Context, token, audience string) (*TokenClaims, error) {
+	claims, err := VerifyPASETOToken(token, s.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if errs := ValidateTokenForService(*claims, audience, s.now()); len(errs) > 0 {
+		if IsTokenExpired(*claims, s.now()) {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, errs)
+	}
+	if err := CheckRevocation(ctx, s.revocations, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// CheckRevocation rejects claims whose session was revoked or whose
+// authorization version is older than the subject's current one.
+func CheckRevocation(ctx context.Context, store RevocationStore, claims *TokenClaims) error {
+	revoked, err := store.SessionRevoked(ctx, claims.SessionID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	current, err := store.AuthzVersion(ctx, claims.Subject)
+	if err != nil {
+		return err
+	}
+	if claims.AuthzVersion < current {
+		return ErrAuthzVersionStale
+	}
+	return nil
+}
+
+func (s *TokenService) issue(ctx context.Context, sessionID, subject, audience string, tokenContext map[string]string) (TokenPair, error) {
+	version, err := s.revocations.AuthzVersion(ctx, subject)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := s.now()
+	claims := TokenClaims{
+		Subject:      subject,
+		SessionID:    sessionID,
+		Audience:     audience,
+		Context:      tokenContext,
+		ExpiresAt:    now.Add(s.accessTTL).Unix(),
+		AuthzVersion: version,
+	}
+	access, err := GeneratePASETOToken(claims, s.privateKey)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return TokenPair{}, fmt.Errorf("could not generate refresh token: %w", err)
+	}
+	refresh := encodeBase64URL(secret)
+	stored := RefreshToken{
+		Hash:      hashToken(refresh),
+		SessionID: sessionID,
+		Subject:   subject,
+		Audience:  audience,
+		Context:   maps.Clone(tokenContext),
+		ExpiresAt: now.Add(s.refreshTTL),
+	}
+	if err := s.refresh.SaveRefreshToken(ctx, stored); err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		SessionID:        sessionID,
+		AccessExpiresAt:  time.Unix(claims.ExpiresAt, 0),
+		RefreshExpiresAt: stored.ExpiresAt,
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
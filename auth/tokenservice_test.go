@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestTokenService(t *testing.T, opts ...TokenServiceOption) (*TokenService, *MemoryTokenStore) {
+	t.Helper()
+	_, key, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryTokenStore()
+	return NewTokenService(key, store, store, opts...), store
+}
+
+func TestTokenServiceRotatesRefreshTokens(t *testing.T) {
+	svc, _ := newTestTokenService(t)
+	ctx := context.Background()
+
+	pair, err := svc.Issue(ctx, "user-1", "api", map[string]string{"type": "global"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.Verify(ctx, pair.AccessToken, "api")
+	if err != nil || claims.Subject != "user-1" || claims.SessionID != pair.SessionID {
+		t.Fatalf("verify = %+v, %v", claims, err)
+	}
+
+	next, err := svc.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if next.SessionID != pair.SessionID || next.RefreshToken == pair.RefreshToken {
+		t.Fatalf("refreshed pair = %+v", next)
+	}
+	if _, err := svc.Refresh(ctx, "unknown"); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("unknown token error = %v", err)
+	}
+}
+
+func TestTokenServiceDetectsReuse(t *testing.T) {
+	var types []string
+	events := NewSecurityEvents(WithSecuritySink(SecuritySinkFunc(func(_ context.Context, ev SecurityEvent) error {
+		types = append(types, ev.Type)
+		return nil
+	})))
+	svc, _ := newTestTokenService(t, WithTokenSecurityEvents(events))
+	ctx := context.Background()
+
+	pair, _ := svc.Issue(ctx, "user-1", "api", nil)
+	next, err := svc.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reuse error = %v", err)
+	}
+	if _, err := svc.Refresh(ctx, next.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("refresh after reuse = %v; want the session revoked", err)
+	}
+	if _, err := svc.Verify(ctx, next.AccessToken, "api"); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("access token after reuse = %v", err)
+	}
+	if len(types) != 2 || types[0] != SecurityTokenRefreshed || types[1] != SecurityRefreshTokenReused {
+		t.Fatalf("security events = %q", types)
+	}
+}
+
+func TestTokenServiceRevocationAndAuthzVersion(t *testing.T) {
+	svc, store := newTestTokenService(t)
+	ctx := context.Background()
+
+	pair, _ := svc.Issue(ctx, "user-1", "api", nil)
+	if err := svc.InvalidateAuthz(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Verify(ctx, pair.AccessToken, "api"); !errors.Is(err, ErrAuthzVersionStale) {
+		t.Fatalf("stale token error = %v", err)
+	}
+	next, err := svc.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Verify(ctx, next.AccessToken, "api"); err != nil {
+		t.Fatalf("refreshed token rejected: %v", err)
+	}
+	if _, err := svc.Verify(ctx, next.AccessToken, "billing"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("wrong audience error = %v", err)
+	}
+
+	if err := svc.Revoke(ctx, next.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Verify(ctx, next.AccessToken, "api"); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("revoked token error = %v", err)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(31 * 24 * time.Hour) }
+	if revoked, _ := store.SessionRevoked(ctx, next.SessionID); revoked {
+		t.Fatal("revocation outlived its expiry")
+	}
+}
+
+type mapKV map[string]string
+
+func (m mapKV) Get(_ context.Context, key string) (string, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+
+func (m mapKV) Set(_ context.Context, key, value string, _ time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func (m mapKV) Incr(_ context.Context, key string) (int64, error) {
+	n, _ := strconv.ParseInt(m[key], 10, 64)
+	m[key] = strconv.FormatInt(n+1, 10)
+	return n + 1, nil
+}
+
+func TestKVRevocationStore(t *testing.T) {
+	kv := mapKV{}
+	store := NewKVRevocationStore(kv, "")
+	ctx := context.Background()
+
+	if err := store.RevokeSession(ctx, "s-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := store.SessionRevoked(ctx, "s-1"); !revoked {
+		t.Fatal("session not revoked")
+	}
+	if _, ok := kv["revoked:session:s-1"]; !ok {
+		t.Fatalf("keys = %v", kv)
+	}
+	if v, err := store.BumpAuthzVersion(ctx, "user-1"); err != nil || v != 1 {
+		t.Fatalf("bump = %d, %v", v, err)
+	}
+	if v, err := store.AuthzVersion(ctx, "user-1"); err != nil || v != 1 {
+		t.Fatalf("authz version = %d, %v", v, err)
+	}
+}
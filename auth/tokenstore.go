@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RefreshToken is the stored form of an issued refresh token. Only the hash
+// of the token is kept. UsedAt is set once the token has been exchanged.
+type RefreshToken struct {
+	Hash      string
+	SessionID string
+	Subject   string
+	Audience  string
+	Context   map[string]string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+// RefreshStore persists refresh tokens.
+type RefreshStore interface {
+	// SaveRefreshToken stores a newly issued token.
+	SaveRefreshToken(ctx context.Context, token RefreshToken) error
+	// UseRefreshToken marks the token with hash as used at at and returns it
+	// as it was before, so a non-zero UsedAt reveals reuse. It must be atomic
+	// so concurrent exchanges of one token see each other. It returns
+	// ErrRefreshInvalid when no token has hash.
+	UseRefreshToken(ctx context.Context, hash string, at time.Time) (RefreshToken, error)
+}
+
+// RevocationStore tracks revoked sessions and per-subject authorization
+// versions. It is consulted on every authenticated request.
+type RevocationStore interface {
+	// RevokeSession rejects tokens of sessionID until until, after which
+	// they would have expired anyway.
+	RevokeSession(ctx context.Context, sessionID string, until time.Time) error
+	// SessionRevoked reports whether sessionID is revoked.
+	SessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	// AuthzVersion returns the current authorization version of subject,
+	// zero when it was never bumped.
+	AuthzVersion(ctx context.Context, subject string) (int, error)
+	// BumpAuthzVersion increments the authorization version of subject,
+	// invalidating tokens issued with an older one, and returns it.
+	BumpAuthzVersion(ctx context.Context, subject string) (int, error)
+}
+
+// MemoryTokenStore implements RefreshStore and RevocationStore in process
+// memory. It suits single-instance services and tests.
+type MemoryTokenStore struct {
+	mu       sync.Mutex
+	refresh  map[string]RefreshToken
+	revoked  map[string]time.Time
+	versions map[string]int
+	now      func() time.Time
+}
+
+// NewMemoryTokenStore builds an empty store.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		refresh:  make(map[string]RefreshToken),
+		revoked:  make(map[string]time.Time),
+		versions: make(map[string]int),
+		now:      time.Now,
+	}
+}
+
+// SaveRefreshToken implements RefreshStore.
+func (s *MemoryTokenStore) SaveRefreshToken(_ context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for hash, t := range s.refresh {
+		if now.After(t.ExpiresAt) {
+			delete(s.refresh, hash)
+		}
+	}
+	s.refresh[token.Hash] = token
+	return nil
+}
+
+// UseRefreshToken implements RefreshStore.
+func (s *MemoryTokenStore) UseRefreshToken(_ context.Context, hash string, at time.Time) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.refresh[hash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshInvalid
+	}
+	if token.UsedAt.IsZero() {
+		used := token
+		used.UsedAt = at
+		s.refresh[hash] = used
+	}
+	return token, nil
+}
+
+// RevokeSession implements RevocationStore.
+func (s *MemoryTokenStore) RevokeSession(_ context.Context, sessionID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until.After(s.revoked[sessionID]) {
+		s.revoked[sessionID] = until
+	}
+	return nil
+}
+
+// SessionRevoked implements RevocationStore.
+func (s *MemoryTokenStore) SessionRevoked(_ context.Context, sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.revoked[sessionID]
+	if ok && !s.now().Before(until) {
+		delete(s.revoked, sessionID)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// AuthzVersion implements RevocationStore.
+func (s *MemoryTokenStore) AuthzVersion(_ context.Context, subject string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.versions[subject], nil
+}
+
+// BumpAuthzVersion implements RevocationStore.
+func (s *MemoryTokenStore) BumpAuthzVersion(_ context.Context, subject string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[subject]++
+	return s.versions[subject], nil
+}
+
+// RevocationKV is the subset of a key/value client such as Redis used by
+// KVRevocationStore. Get reports false when the key does not exist; a zero
+// ttl in Set means no expiry. With go-redis these map to Get (redis.Nil as
+// not found), Set and Incr.
+type RevocationKV interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// KVRevocationStore implements RevocationStore on a key/value store, keeping
+// revoked sessions under prefix+"session:"+id with an expiry and versions
+// under prefix+"authz:"+subject.
+type KVRevocationStore struct {
+	kv     RevocationKV
+	prefix string
+}
+
+// NewKVRevocationStore stores revocations in kv, defaulting prefix to
+// "revoked:".
+func NewKVRevocationStore(kv RevocationKV, prefix string) *KVRevocationStore {
+	if prefix == "" {
+		prefix = "revoked:"
+	}
+	return &KVRevocationStore{kv: kv, prefix: prefix}
+}
+
+// RevokeSession implements RevocationStore.
+func (s *KVRevocationStore) RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.kv.Set(ctx, s.prefix+"session:"+sessionID, "1", ttl)
+}
+
+// SessionRevoked implements RevocationStore.
+func (s *KVRevocationStore) SessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	_, ok, err := s.kv.Get(ctx, s.prefix+"session:"+sessionID)
+	return ok, err
+}
+
+// AuthzVersion implements RevocationStore.
+func (s *KVRevocationStore) AuthzVersion(ctx context.Context, subject string) (int, error) {
+	raw, ok, err := s.kv.Get(ctx, s.prefix+"authz:"+subject)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.Atoi(raw)
+}
+
+// BumpAuthzVersion implements RevocationStore.
+func (s *KVRevocationStore) BumpAuthzVersion(ctx context.Context, subject string) (int, error) {
+	v, err := s.kv.Incr(ctx, s.prefix+"authz:"+subject)
+	return int(v), err
+}
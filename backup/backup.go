@@ -0,0 +1,485 @@
+// Package backup dumps Mongo collections to storage.Blob as gzip-compressed
+// NDJSON, on a schedule or on demand, and restores them. Each run writes a
+// manifest with document counts and SHA-256 digests; incremental runs only
+// export documents modified since the previous run and chain to it, so a
+// restore replays the chain from the last full backup.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultBasePath  = "/internal/backups"
+	defaultPrefix    = "backups"
+	restoreBatchSize = 500
+	latestKey        = "latest.json"
+	idLayout         = "20060102T150405.000Z"
+)
+
+var (
+	// ErrRunning is returned when a run starts while another is in progress.
+	ErrRunning = errors.New("backup: run already in progress")
+	// ErrNoBackup is returned when no manifest exists for the requested ID.
+	ErrNoBackup = errors.New("backup: no such backup")
+	// ErrIntegrity is returned when a dump does not match its manifest.
+	ErrIntegrity = errors.New("backup: integrity check failed")
+)
+
+// Manifest describes one run.
+type Manifest struct {
+	ID          string     `json:"id"`
+	Base        string     `json:"base,omitempty"`
+	Since       *time.Time `json:"since,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  time.Time  `json:"finished_at"`
+	Collections []Dump     `json:"collections"`
+}
+
+// Incremental reports whether the run only holds changes since Base.
+func (m Manifest) Incremental() bool {
+	return m.Base != ""
+}
+
+// Dump describes the export of one collection.
+type Dump struct {
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	Documents  int    `json:"documents"`
+	Bytes      int64  `json:"bytes"`
+	SHA256     string `json:"sha256"`
+}
+
+// Job exports and restores a fixed set of collections. It implements
+// aqm.HTTPModule, aqm.Startable and aqm.Stoppable; the scheduler only runs
+// when an interval is configured.
+type Job struct {
+	source      Source
+	blob        storage.Blob
+	collections []string
+	prefix      string
+	basePath    string
+	interval    time.Duration
+	incremental bool
+	log         aqm.Logger
+	now         func() time.Time
+
+	running sync.Mutex
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Option configures a Job.
+type Option func(*Job)
+
+// WithPrefix sets the blob key prefix backups are written under (defaults
+// to backups).
+func WithPrefix(prefix string) Option {
+	return func(j *Job) {
+		if p := strings.Trim(prefix, "/"); p != "" {
+			j.prefix = p
+		}
+	}
+}
+
+// WithSchedule runs a backup every interval once the job is started.
+func WithSchedule(interval time.Duration) Option {
+	return func(j *Job) {
+		j.interval = interval
+	}
+}
+
+// WithIncremental makes scheduled runs and runs requested without a mode
+// incremental. The first run is always full.
+func WithIncremental(incremental bool) Option {
+	return func(j *Job) {
+		j.incremental = incremental
+	}
+}
+
+// WithBasePath overrides the mount point of the internal endpoint
+// (defaults to /internal/backups).
+func WithBasePath(base string) Option {
+	return func(j *Job) {
+		if base != "" {
+			j.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(j *Job) {
+		if logger != nil {
+			j.log = logger
+		}
+	}
+}
+
+// New returns a Job backing up collections of source into blob.
+func New(source Source, blob storage.Blob, collections []string, opts ...Option) *Job {
+	j := &Job{
+		source:      source,
+		blob:        blob,
+		collections: collections,
+		prefix:      defaultPrefix,
+		basePath:    defaultBasePath,
+		log:         aqm.NewNoopLogger(),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(j)
+		}
+	}
+	return j
+}
+
+// Run exports every collection. Incremental runs export the documents
+// modified since the latest run started and fall back to a full run when
+// there is none.
+func (j *Job) Run(ctx context.Context, incremental bool) (*Manifest, error) {
+	if !j.running.TryLock() {
+		return nil, ErrRunning
+	}
+	defer j.running.Unlock()
+
+	started := j.now().UTC()
+	manifest := &Manifest{ID: started.Format(idLayout), StartedAt: started}
+	if incremental {
+		latest, err := j.Latest(ctx)
+		switch {
+		case err == nil:
+			manifest.Base = latest.ID
+			manifest.Since = &latest.StartedAt
+		case !errors.Is(err, ErrNoBackup):
+			return nil, err
+		}
+	}
+
+	var since time.Time
+	if manifest.Since != nil {
+		since = *manifest.Since
+	}
+	for _, collection := range j.collections {
+		dump, err := j.dump(ctx, manifest.ID, collection, since)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Collections = append(manifest.Collections, dump)
+	}
+	manifest.FinishedAt = j.now().UTC()
+
+	if err := j.putJSON(ctx, j.key(manifest.ID, "manifest.json"), manifest); err != nil {
+		return nil, err
+	}
+	if err := j.putJSON(ctx, j.prefix+"/"+latestKey, manifest); err != nil {
+		return nil, err
+	}
+	j.log.Info("backup completed", "id", manifest.ID, "base", manifest.Base,
+		"collections", len(manifest.Collections), "duration", manifest.FinishedAt.Sub(started))
+	return manifest, nil
+}
+
+func (j *Job) dump(ctx context.Context, id, collection string, since time.Time) (Dump, error) {
+	dump := Dump{Collection: collection, Key: j.key(id, collection+".ndjson.gz")}
+	pr, pw := io.Pipe()
+	digest := sha256.New()
+	counter := &countingWriter{}
+	exported := make(chan error, 1)
+
+	go func() {
+		zw := gzip.NewWriter(io.MultiWriter(pw, digest, counter))
+		err := j.source.Export(ctx, collection, since, func(doc []byte) error {
+			dump.Documents++
+			if _, err := zw.Write(doc); err != nil {
+				return err
+			}
+			_, err := zw.Write([]byte{'\n'})
+			return err
+		})
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+		exported <- err
+	}()
+
+	_, err := j.blob.Put(ctx, dump.Key, pr, "application/gzip")
+	pr.CloseWithError(err)
+	if exportErr := <-exported; exportErr != nil {
+		return Dump{}, fmt.Errorf("backup: export %s: %w", collection, exportErr)
+	}
+	if err != nil {
+		return Dump{}, fmt.Errorf("backup: dump %s: %w", collection, err)
+	}
+	dump.Bytes = counter.n
+	dump.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	return dump, nil
+}
+
+// Latest returns the manifest of the most recent run.
+func (j *Job) Latest(ctx context.Context) (*Manifest, error) {
+	return j.readManifest(ctx, j.prefix+"/"+latestKey)
+}
+
+// Manifest returns the manifest of run id.
+func (j *Job) Manifest(ctx context.Context, id string) (*Manifest, error) {
+	if id == "latest" {
+		return j.Latest(ctx)
+	}
+	return j.readManifest(ctx, j.key(id, "manifest.json"))
+}
+
+// Restore replays run id into the source, starting from the full backup its
+// chain is based on. Every dump is verified against its manifest before any
+// of its documents are written. Collections limits the restore to the named
+// collections.
+func (j *Job) Restore(ctx context.Context, id string, collections ...string) error {
+	var chain []*Manifest
+	for next := id; next != ""; {
+		m, err := j.Manifest(ctx, next)
+		if err != nil {
+			return err
+		}
+		chain = append([]*Manifest{m}, chain...)
+		next = m.Base
+	}
+	for _, m := range chain {
+		for _, dump := range m.Collections {
+			if len(collections) > 0 && !slices.Contains(collections, dump.Collection) {
+				continue
+			}
+			if err := j.restoreDump(ctx, dump); err != nil {
+				return err
+			}
+		}
+		j.log.Info("backup restored", "id", m.ID, "incremental", m.Incremental())
+	}
+	return nil
+}
+
+func (j *Job) restoreDump(ctx context.Context, dump Dump) error {
+	data, _, err := j.blob.Get(ctx, dump.Key)
+	if err != nil {
+		return fmt.Errorf("backup: read %s: %w", dump.Key, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != dump.SHA256 || int64(len(data)) != dump.Bytes {
+		return fmt.Errorf("%w: %s", ErrIntegrity, dump.Key)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("backup: decompress %s: %w", dump.Key, err)
+	}
+	defer zr.Close()
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	batch := make([][]byte, 0, restoreBatchSize)
+	restored := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := j.source.Restore(ctx, dump.Collection, batch); err != nil {
+			return err
+		}
+		restored += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for scanner.Scan() {
+		batch = append(batch, bytes.Clone(scanner.Bytes()))
+		if len(batch) == restoreBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("backup: read %s: %w", dump.Key, err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if restored != dump.Documents {
+		return fmt.Errorf("%w: %s has %d documents, manifest lists %d", ErrIntegrity, dump.Key, restored, dump.Documents)
+	}
+	return nil
+}
+
+// RestoreCommand returns the "restore" CLI command:
+//
+//	./service restore <backup-id|latest> [collection...]
+func RestoreCommand(job *Job) aqm.Command {
+	return aqm.Command{
+		Name:  "restore",
+		Usage: "restore <backup-id|latest> [collection...]",
+		Run: func(ctx context.Context, deps *aqm.Deps, args []string) error {
+			if len(args) == 0 {
+				return errors.New("restore: backup id required (or latest)")
+			}
+			if deps != nil && deps.Logger != nil {
+				job.log = deps.Logger
+			}
+			return job.Restore(ctx, args[0], args[1:]...)
+		},
+	}
+}
+
+// RegisterRoutes implements aqm.HTTPModule. Mount it on an internal router:
+//
+//	POST {base}/runs?mode=full|incremental  run a backup, 201 with its manifest
+//	GET  {base}/{id}                        manifest of a run, or latest
+func (j *Job) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Post(j.basePath+"/runs", j.handleRun)
+	r.Get(j.basePath+"/{id}", j.handleManifest)
+}
+
+func (j *Job) handleRun(w http.ResponseWriter, r *http.Request) {
+	incremental := j.incremental
+	switch r.URL.Query().Get("mode") {
+	case "":
+	case "full":
+		incremental = false
+	case "incremental":
+		incremental = true
+	default:
+		aqm.Error(w, http.StatusBadRequest, "invalid_mode", "mode must be full or incremental")
+		return
+	}
+	manifest, err := j.Run(r.Context(), incremental)
+	if err != nil {
+		if errors.Is(err, ErrRunning) {
+			aqm.Error(w, http.StatusConflict, "backup_running", "a backup is already running")
+			return
+		}
+		j.log.Error("backup failed", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "backup_failed", "backup failed")
+		return
+	}
+	aqm.Respond(w, http.StatusCreated, manifest, nil)
+}
+
+func (j *Job) handleManifest(w http.ResponseWriter, r *http.Request) {
+	manifest, err := j.Manifest(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, ErrNoBackup) {
+			aqm.Error(w, http.StatusNotFound, "backup_not_found", "backup not found")
+			return
+		}
+		j.log.Error("cannot read backup manifest", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "backup_unavailable", "cannot read backup manifest")
+		return
+	}
+	aqm.RespondSuccess(w, manifest)
+}
+
+// Start launches the scheduler when an interval is configured.
+func (j *Job) Start(context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.interval <= 0 || j.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.done = make(chan struct{})
+	go j.schedule(ctx, j.done)
+	return nil
+}
+
+// Stop halts the scheduler, waiting for a run in progress to notice.
+func (j *Job) Stop(ctx context.Context) error {
+	j.mu.Lock()
+	cancel, done := j.cancel, j.done
+	j.cancel, j.done = nil, nil
+	j.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *Job) schedule(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := j.Run(ctx, j.incremental); err != nil && !errors.Is(err, ErrRunning) {
+				j.log.Error("scheduled backup failed", "error", err)
+			}
+		}
+	}
+}
+
+func (j *Job) key(id, name string) string {
+	return j.prefix + "/" + id + "/" + name
+}
+
+func (j *Job) putJSON(ctx context.Context, key string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("backup: encode %s: %w", key, err)
+	}
+	if _, err := j.blob.Put(ctx, key, bytes.NewReader(data), "application/json"); err != nil {
+		return fmt.Errorf("backup: write %s: %w", key, err)
+	}
+	return nil
+}
+
+func (j *Job) readManifest(ctx context.Context, key string) (*Manifest, error) {
+	data, _, err := j.blob.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNoBackup
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backup: read %s: %w", key, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("backup: decode %s: %w", key, err)
+	}
+	return &m, nil
+}
+
+type countingWriter struct{ n int64 }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
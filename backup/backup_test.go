@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type doc struct {
+	ID        string    `json:"_id"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// fakeSource keeps documents per collection, keyed by _id.
+type fakeSource struct {
+	mu   sync.Mutex
+	data map[string]map[string]doc
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{data: map[string]map[string]doc{}}
+}
+
+func (s *fakeSource) put(collection string, d doc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data[collection] == nil {
+		s.data[collection] = map[string]doc{}
+	}
+	s.data[collection][d.ID] = d
+}
+
+func (s *fakeSource) Export(_ context.Context, collection string, since time.Time, emit func([]byte) error) error {
+	s.mu.Lock()
+	docs := make([]doc, 0, len(s.data[collection]))
+	for _, d := range s.data[collection] {
+		if since.IsZero() || d.UpdatedAt.After(since) {
+			docs = append(docs, d)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	for _, d := range docs {
+		raw, _ := json.Marshal(d)
+		if err := emit(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeSource) Restore(_ context.Context, collection string, docs [][]byte) error {
+	for _, raw := range docs {
+		var d doc
+		if err := json.Unmarshal(raw, &d); err != nil {
+			return err
+		}
+		s.put(collection, d)
+	}
+	return nil
+}
+
+func TestIncrementalBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	src := newFakeSource()
+	blob := storage.NewMemoryBlob()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		src.put("users", doc{ID: fmt.Sprintf("u%d", i), Value: "v1", UpdatedAt: t0})
+	}
+	src.put("orders", doc{ID: "o1", Value: "v1", UpdatedAt: t0})
+
+	clock := t0.Add(time.Hour)
+	job := New(src, blob, []string{"users", "orders"})
+	job.now = func() time.Time { return clock }
+
+	full, err := job.Run(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Incremental() || full.Collections[0].Documents != 3 {
+		t.Fatalf("full = %+v", full)
+	}
+
+	src.put("users", doc{ID: "u1", Value: "v2", UpdatedAt: t0.Add(2 * time.Hour)})
+	src.put("users", doc{ID: "u9", Value: "v1", UpdatedAt: t0.Add(2 * time.Hour)})
+	clock = t0.Add(3 * time.Hour)
+	inc, err := job.Run(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inc.Base != full.ID || inc.Collections[0].Documents != 2 || inc.Collections[1].Documents != 0 {
+		t.Fatalf("incremental = %+v", inc)
+	}
+
+	restored := newFakeSource()
+	restoreJob := New(restored, blob, nil)
+	if err := restoreJob.Restore(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.data["users"]) != 4 || restored.data["users"]["u1"].Value != "v2" || len(restored.data["orders"]) != 1 {
+		t.Errorf("restored = %+v", restored.data)
+	}
+
+	only := newFakeSource()
+	if err := New(only, blob, nil).Restore(ctx, full.ID, "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if len(only.data["users"]) != 0 || len(only.data["orders"]) != 1 {
+		t.Errorf("filtered restore = %+v", only.data)
+	}
+}
+
+func TestRestoreRejectsTamperedDump(t *testing.T) {
+	ctx := context.Background()
+	src := newFakeSource()
+	src.put("users", doc{ID: "u1", Value: "v1"})
+	blob := storage.NewMemoryBlob()
+	job := New(src, blob, []string{"users"})
+	m, err := job.Run(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := blob.Get(ctx, m.Collections[0].Key)
+	data[len(data)-1] ^= 0xff
+	if _, err := blob.Put(ctx, m.Collections[0].Key, bytes.NewReader(data), "application/gzip"); err != nil {
+		t.Fatal(err)
+	}
+
+	target := newFakeSource()
+	if err := New(target, blob, nil).Restore(ctx, m.ID); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("err = %v, want ErrIntegrity", err)
+	}
+	if len(target.data) != 0 {
+		t.Error("tampered dump was applied")
+	}
+	if err := job.Restore(ctx, "missing"); !errors.Is(err, ErrNoBackup) {
+		t.Errorf("missing backup err = %v", err)
+	}
+}
+
+func TestRunEndpoint(t *testing.T) {
+	src := newFakeSource()
+	src.put("users", doc{ID: "u1"})
+	job := New(src, storage.NewMemoryBlob(), []string{"users"})
+	r := chi.NewRouter()
+	job.RegisterRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/backups/runs?mode=full", nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("run: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/backups/latest", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("latest: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/backups/runs?mode=weekly", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid mode: %d", rec.Code)
+	}
+}
+
+func TestRestoreCommandRequiresID(t *testing.T) {
+	cmd := RestoreCommand(New(newFakeSource(), storage.NewMemoryBlob(), nil))
+	if cmd.Name != "restore" {
+		t.Errorf("name = %q", cmd.Name)
+	}
+	if err := cmd.Run(context.Background(), nil, nil); err == nil {
+		t.Error("restore without id succeeded")
+	}
+}
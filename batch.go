@@ -0,0 +1,218 @@
+package aqm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const defaultBatchMaxBytes int64 = 8 << 20
+
+var (
+	// ErrBatchEmpty is returned when a batch request carries no items.
+	ErrBatchEmpty = errors.New("batch: no items provided")
+	// ErrBatchTooLarge is returned when a batch exceeds the allowed item count
+	// or body size.
+	ErrBatchTooLarge = errors.New("batch: too many items")
+	// ErrBatchNotAttempted marks items an ordered bulk write skipped because an
+	// earlier item failed.
+	ErrBatchNotAttempted = errors.New("batch: not attempted after an earlier failure")
+)
+
+// BatchOption configures DecodeBatch.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	maxBytes int64
+}
+
+// WithBatchMaxBytes caps the request body size (defaults to 8MiB).
+func WithBatchMaxBytes(n int64) BatchOption {
+	return func(o *batchOptions) {
+		if n > 0 {
+			o.maxBytes = n
+		}
+	}
+}
+
+// DecodeBatch decodes the request body into a slice of T. Both a bare JSON
+// array and an {"items": [...]} object are accepted. maxItems <= 0 disables
+// the item limit; decoding stops as soon as it is exceeded. The body is
+// capped at 8MiB unless WithBatchMaxBytes says otherwise.
+func DecodeBatch[T any](r *http.Request, maxItems int, opts ...BatchOption) ([]T, error) {
+	options := batchOptions{maxBytes: defaultBatchMaxBytes}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, options.maxBytes))
+	items, err := decodeBatchBody[T](dec, maxItems)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errors.New("unexpected data after items")
+		}
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrBatchTooLarge, maxErr.Limit)
+		case errors.Is(err, ErrBatchTooLarge), errors.Is(err, ErrBatchEmpty):
+			return nil, err
+		case err == io.EOF:
+			return nil, ErrBatchEmpty
+		}
+		return nil, fmt.Errorf("batch: decode items: %w", err)
+	}
+
+	if len(items) == 0 {
+		return nil, ErrBatchEmpty
+	}
+	return items, nil
+}
+
+func decodeBatchBody[T any](dec *json.Decoder, maxItems int) ([]T, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('['):
+		return decodeBatchItems[T](dec, maxItems)
+	case json.Delim('{'):
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected %v", tok)
+	}
+
+	var items []T
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "items" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			continue
+		}
+		if tok != json.Delim('[') {
+			return nil, fmt.Errorf("items: unexpected %v", tok)
+		}
+		if items, err = decodeBatchItems[T](dec, maxItems); err != nil {
+			return nil, err
+		}
+	}
+	_, err = dec.Token()
+	return items, err
+}
+
+// decodeBatchItems reads array elements after the opening bracket.
+func decodeBatchItems[T any](dec *json.Decoder, maxItems int) ([]T, error) {
+	var items []T
+	for dec.More() {
+		if maxItems > 0 && len(items) == maxItems {
+			return nil, fmt.Errorf("%w: more than %d", ErrBatchTooLarge, maxItems)
+		}
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	_, err := dec.Token()
+	return items, err
+}
+
+// BatchItemResult reports the outcome of a single item in a batch operation.
+type BatchItemResult struct {
+	Index  int           `json:"index"`
+	ID     string        `json:"id,omitempty"`
+	Status int           `json:"status"`
+	Data   any           `json:"data,omitempty"`
+	Error  *ErrorPayload `json:"error,omitempty"`
+}
+
+// BatchSummary is returned as meta alongside batch results.
+type BatchSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// BatchResult accumulates per-item outcomes for bulk endpoints.
+type BatchResult struct {
+	Items []BatchItemResult
+}
+
+// NewBatchResult creates a result sized for n items.
+func NewBatchResult(n int) *BatchResult {
+	return &BatchResult{Items: make([]BatchItemResult, 0, n)}
+}
+
+// Success records a successful item.
+func (b *BatchResult) Success(index int, status int, id string, data any) {
+	b.Items = append(b.Items, BatchItemResult{Index: index, ID: id, Status: status, Data: data})
+}
+
+// Failure records a failed item with a structured error.
+func (b *BatchResult) Failure(index int, status int, code, message string, details ...ValidationError) {
+	b.Items = append(b.Items, BatchItemResult{
+		Index:  index,
+		Status: status,
+		Error:  &ErrorPayload{Code: code, Message: message, Details: details},
+	})
+}
+
+// Summary counts succeeded and failed items.
+func (b *BatchResult) Summary() BatchSummary {
+	summary := BatchSummary{Total: len(b.Items)}
+	for _, item := range b.Items {
+		if item.Error != nil || item.Status >= http.StatusBadRequest {
+			summary.Failed++
+			continue
+		}
+		summary.Succeeded++
+	}
+	return summary
+}
+
+// StatusCode picks the response status: the shared item status when all
+// items agree, 207 Multi-Status otherwise.
+func (b *BatchResult) StatusCode() int {
+	if len(b.Items) == 0 {
+		return http.StatusOK
+	}
+	status := b.Items[0].Status
+	for _, item := range b.Items[1:] {
+		if item.Status != status {
+			return http.StatusMultiStatus
+		}
+	}
+	return status
+}
+
+// RespondBatch writes the per-item results using the standard success
+// envelope with a BatchSummary as meta.
+func RespondBatch(w http.ResponseWriter, result *BatchResult) {
+	if result == nil {
+		result = NewBatchResult(0)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(result.StatusCode())
+	json.NewEncoder(w).Encode(SuccessResponse{Data: result.Items, Meta: result.Summary()})
+}
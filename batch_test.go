@@ -0,0 +1,152 @@
+package aqm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type batchItem struct {
+	Name string `json:"name"`
+}
+
+func TestDecodeBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		max     int
+		want    int
+		wantErr error
+	}{
+		{name: "array", body: `[{"name":"a"},{"name":"b"}]`, max: 10, want: 2},
+		{name: "wrapped", body: `{"items":[{"name":"a"}]}`, max: 10, want: 1},
+		{name: "empty", body: `[]`, max: 10, wantErr: ErrBatchEmpty},
+		{name: "blank", body: ``, max: 10, wantErr: ErrBatchEmpty},
+		{name: "tooLarge", body: `[{},{},{}]`, max: 2, wantErr: ErrBatchTooLarge},
+		{name: "unlimited", body: `[{},{},{}]`, max: 0, want: 3},
+		{name: "null", body: `null`, max: 10, wantErr: ErrBatchEmpty},
+		{name: "wrappedExtraKeys", body: `{"dryRun":true,"items":[{"name":"a"}]}`, max: 10, want: 1},
+		{name: "stopsAtLimit", body: `[{},{},{},not json`, max: 2, wantErr: ErrBatchTooLarge},
+		{name: "trailingData", body: `[{}] []`, max: 10, wantErr: errBatchDecode},
+		{name: "invalid", body: `[{"name":1}]`, max: 10, wantErr: errBatchDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/items/batch", strings.NewReader(tt.body))
+			items, err := DecodeBatch[batchItem](req, tt.max)
+			if tt.wantErr == errBatchDecode {
+				if err == nil || !strings.HasPrefix(err.Error(), "batch: decode items") {
+					t.Fatalf("expected a decode error, got %v", err)
+				}
+				return
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(items) != tt.want {
+				t.Errorf("expected %d items, got %d", tt.want, len(items))
+			}
+		})
+	}
+}
+
+var errBatchDecode = errors.New("decode")
+
+func TestDecodeBatchMaxBytes(t *testing.T) {
+	body := `[` + strings.Repeat(`{"name":"abcdefgh"},`, 20) + `{}]`
+	req := httptest.NewRequest(http.MethodPost, "/items/batch", strings.NewReader(body))
+
+	_, err := DecodeBatch[batchItem](req, 0, WithBatchMaxBytes(64))
+	if !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("expected ErrBatchTooLarge, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/items/batch", strings.NewReader(body))
+	items, err := DecodeBatch[batchItem](req, 0)
+	if err != nil || len(items) != 21 {
+		t.Fatalf("expected 21 items under the default cap, got %d, %v", len(items), err)
+	}
+}
+
+func TestMarkNotAttempted(t *testing.T) {
+	writeErr := errors.New("duplicate key")
+	failed := map[int]error{1: writeErr}
+
+	markNotAttempted(failed, 4)
+
+	if failed[0] != nil || failed[1] != writeErr {
+		t.Errorf("unexpected entries before the failure: %v", failed)
+	}
+	for _, index := range []int{2, 3} {
+		if !errors.Is(failed[index], ErrBatchNotAttempted) {
+			t.Errorf("expected item %d to be not attempted, got %v", index, failed[index])
+		}
+	}
+
+	empty := map[int]error{}
+	markNotAttempted(empty, 3)
+	if len(empty) != 0 {
+		t.Errorf("expected no entries without a failure, got %v", empty)
+	}
+}
+
+func TestBatchResultStatusCode(t *testing.T) {
+	all := NewBatchResult(2)
+	all.Success(0, http.StatusCreated, "1", nil)
+	all.Success(1, http.StatusCreated, "2", nil)
+	if all.StatusCode() != http.StatusCreated {
+		t.Errorf("expected 201, got %d", all.StatusCode())
+	}
+
+	mixed := NewBatchResult(2)
+	mixed.Success(0, http.StatusCreated, "1", nil)
+	mixed.Failure(1, http.StatusUnprocessableEntity, "validation_failed", "invalid",
+		ValidationError{Field: "name", Code: "required", Message: "name is required"})
+	if mixed.StatusCode() != http.StatusMultiStatus {
+		t.Errorf("expected 207, got %d", mixed.StatusCode())
+	}
+
+	summary := mixed.Summary()
+	if summary.Total != 2 || summary.Succeeded != 1 || summary.Failed != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestRespondBatch(t *testing.T) {
+	result := NewBatchResult(2)
+	result.Success(0, http.StatusOK, "1", map[string]string{"name": "a"})
+	result.Failure(1, http.StatusNotFound, "not_found", "missing")
+
+	rec := httptest.NewRecorder()
+	RespondBatch(rec, result)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Errorf("expected 207, got %d", rec.Code)
+	}
+	var resp struct {
+		Data []BatchItemResult `json:"data"`
+		Meta BatchSummary      `json:"meta"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Data[1].Error == nil || resp.Meta.Failed != 1 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestBulkWriteResultFromNil(t *testing.T) {
+	if res := bulkWriteResultFrom(nil); res.Matched != 0 || res.Failed != nil {
+		t.Errorf("expected zero result, got %+v", res)
+	}
+}
@@ -0,0 +1,45 @@
+package aqm_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmtest"
+)
+
+// These budgets live in an external test package because aqmtest imports
+// aqm. Raise a budget only with a reason; lower it when an optimisation
+// lands so it cannot regress unnoticed.
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func TestRespondAllocBudget(t *testing.T) {
+	w := &discardWriter{header: make(http.Header)}
+	data := []map[string]any{{"id": "ord-1", "total": 42.5}}
+	aqmtest.AllocBudget(t, 12, func() {
+		aqm.Respond(w, http.StatusOK, data, nil)
+	})
+}
+
+func TestErrorAllocBudget(t *testing.T) {
+	w := &discardWriter{header: make(http.Header)}
+	details := []aqm.ValidationError{{Field: "email", Code: "required", Message: "email is required"}}
+	aqmtest.AllocBudget(t, 4, func() {
+		aqm.Error(w, http.StatusUnprocessableEntity, "validation_failed", "invalid order", details...)
+	})
+}
+
+func TestConfigReadAllocBudget(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.Set("service.name", "orders")
+	aqmtest.AllocBudget(t, 2, func() {
+		cfg.GetString("service.name")
+	})
+}
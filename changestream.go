@@ -0,0 +1,431 @@
+package aqm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultResumeTokenCollection = "_resume_tokens"
+	defaultWatchBackoff          = 500 * time.Millisecond
+	defaultMaxWatchBackoff       = 30 * time.Second
+)
+
+// ChangeEvent is a decoded Mongo change stream event.
+type ChangeEvent struct {
+	ResumeToken   bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	Namespace     ChangeNamespace     `bson:"ns"`
+	DocumentKey   bson.M              `bson:"documentKey"`
+	FullDocument  bson.Raw            `bson:"fullDocument,omitempty"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+}
+
+// ChangeNamespace identifies the database and collection of a change.
+type ChangeNamespace struct {
+	DB         string `bson:"db"`
+	Collection string `bson:"coll"`
+}
+
+// Decode unmarshals the full document into v. It is empty for deletes and,
+// unless WithFullDocument is used, for updates.
+func (e ChangeEvent) Decode(v any) error {
+	if len(e.FullDocument) == 0 {
+		return errors.New("change event has no full document")
+	}
+	return bson.Unmarshal(e.FullDocument, v)
+}
+
+// ChangeHandler processes a change event. Returning an error stops the watch
+// without advancing the resume token, so the event is redelivered when the
+// watch restarts.
+type ChangeHandler func(ctx context.Context, event ChangeEvent) error
+
+// ResumeTracker persists change stream resume tokens by watch name.
+type ResumeTracker interface {
+	LoadToken(ctx context.Context, name string) (bson.Raw, error)
+	SaveToken(ctx context.Context, name string, token bson.Raw) error
+}
+
+// MongoResumeTracker keeps resume tokens in a Mongo collection.
+type MongoResumeTracker struct {
+	collection *mongo.Collection
+}
+
+// NewMongoResumeTracker stores tokens in collection, defaulting to
+// _resume_tokens when empty.
+func NewMongoResumeTracker(db *mongo.Database, collection string) *MongoResumeTracker {
+	if collection == "" {
+		collection = defaultResumeTokenCollection
+	}
+	return &MongoResumeTracker{collection: db.Collection(collection)}
+}
+
+type resumeTokenRecord struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// LoadToken returns the stored token, or nil when the watch has none yet.
+func (s *MongoResumeTracker) LoadToken(ctx context.Context, name string) (bson.Raw, error) {
+	var record resumeTokenRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load resume token %s: %w", name, err)
+	}
+	return record.Token, nil
+}
+
+// SaveToken upserts the token for name.
+func (s *MongoResumeTracker) SaveToken(ctx context.Context, name string, token bson.Raw) error {
+	record := resumeTokenRecord{Name: name, Token: token, UpdatedAt: time.Now().UTC()}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": name}, record, opts); err != nil {
+		return fmt.Errorf("save resume token %s: %w", name, err)
+	}
+	return nil
+}
+
+// MemoryResumeTracker keeps resume tokens in memory, mostly for tests.
+type MemoryResumeTracker struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+// NewMemoryResumeTracker builds an empty in-memory tracker.
+func NewMemoryResumeTracker() *MemoryResumeTracker {
+	return &MemoryResumeTracker{tokens: make(map[string]bson.Raw)}
+}
+
+// LoadToken implements ResumeTracker.
+func (s *MemoryResumeTracker) LoadToken(_ context.Context, name string) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[name], nil
+}
+
+// SaveToken implements ResumeTracker.
+func (s *MemoryResumeTracker) SaveToken(_ context.Context, name string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[name] = token
+	return nil
+}
+
+// WatchOption configures WatchCollection.
+type WatchOption func(*watchConfig)
+
+type watchConfig struct {
+	name         string
+	tracker      ResumeTracker
+	fullDocument bool
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	logger       Logger
+}
+
+// WithWatchName sets the key resume tokens are stored under. It defaults to
+// the collection name.
+func WithWatchName(name string) WatchOption {
+	return func(c *watchConfig) {
+		if name != "" {
+			c.name = name
+		}
+	}
+}
+
+// WithResumeTracker persists resume tokens so a restarted watch continues
+// where it stopped instead of from the current time.
+func WithResumeTracker(tracker ResumeTracker) WatchOption {
+	return func(c *watchConfig) {
+		c.tracker = tracker
+	}
+}
+
+// WithFullDocument asks Mongo to include the current document on updates.
+func WithFullDocument() WatchOption {
+	return func(c *watchConfig) {
+		c.fullDocument = true
+	}
+}
+
+// WithWatchBackoff sets the reconnection backoff, doubling from initial up to
+// max.
+func WithWatchBackoff(initial, max time.Duration) WatchOption {
+	return func(c *watchConfig) {
+		if initial > 0 {
+			c.backoff = initial
+		}
+		if max >= c.backoff {
+			c.maxBackoff = max
+		}
+	}
+}
+
+// WithWatchLogger wires a custom logger. It falls back to a noop logger when
+// nil.
+func WithWatchLogger(logger Logger) WatchOption {
+	return func(c *watchConfig) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// changeStream is the subset of *mongo.ChangeStream the watcher needs.
+type changeStream interface {
+	Next(ctx context.Context) bool
+	Decode(v any) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+type openStreamFunc func(ctx context.Context, resumeAfter bson.Raw) (changeStream, error)
+
+// WatchCollection consumes the change stream of coll filtered by pipeline
+// (nil for every change) and calls handler for each event, blocking until ctx
+// is done or handler fails. Resume tokens are saved after each handled event
+// when a ResumeTracker is configured, and transient errors reopen the stream
+// from the last token with exponential backoff.
+func WatchCollection(ctx context.Context, coll *mongo.Collection, pipeline any, handler ChangeHandler, opts ...WatchOption) error {
+	if coll == nil {
+		return errors.New("mongo collection is required")
+	}
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	cfg := newWatchConfig(coll.Name(), opts)
+	open := func(ctx context.Context, resumeAfter bson.Raw) (changeStream, error) {
+		streamOpts := options.ChangeStream()
+		if cfg.fullDocument {
+			streamOpts.SetFullDocument(options.UpdateLookup)
+		}
+		if resumeAfter != nil {
+			streamOpts.SetResumeAfter(resumeAfter)
+		}
+		return coll.Watch(ctx, pipeline, streamOpts)
+	}
+	return watch(ctx, open, handler, cfg)
+}
+
+func newWatchConfig(name string, opts []WatchOption) *watchConfig {
+	cfg := &watchConfig{
+		name:       name,
+		backoff:    defaultWatchBackoff,
+		maxBackoff: defaultMaxWatchBackoff,
+		logger:     NewNoopLogger(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	return cfg
+}
+
+func watch(ctx context.Context, open openStreamFunc, handler ChangeHandler, cfg *watchConfig) error {
+	if handler == nil {
+		return errors.New("change handler is required")
+	}
+	var token bson.Raw
+	if cfg.tracker != nil {
+		stored, err := cfg.tracker.LoadToken(ctx, cfg.name)
+		if err != nil {
+			return err
+		}
+		token = stored
+	}
+
+	delay := cfg.backoff
+	for {
+		stream, err := open(ctx, token)
+		if err == nil {
+			var handled bool
+			token, handled, err = consume(ctx, stream, token, handler, cfg)
+			if handled {
+				delay = cfg.backoff
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !isTransientStreamError(err) {
+			return err
+		}
+
+		cfg.logger.Info("change stream interrupted, reconnecting", "watch", cfg.name, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, cfg.maxBackoff)
+	}
+}
+
+// consume drains stream until it fails and returns the last handled token and
+// whether any event was handled.
+func consume(ctx context.Context, stream changeStream, token bson.Raw, handler ChangeHandler, cfg *watchConfig) (bson.Raw, bool, error) {
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	handled := false
+	for stream.Next(ctx) {
+		var event ChangeEvent
+		if err := stream.Decode(&event); err != nil {
+			return token, handled, fmt.Errorf("decode change event: %w", err)
+		}
+		if err := handler(ctx, event); err != nil {
+			return token, handled, fmt.Errorf("change handler %s: %w", cfg.name, err)
+		}
+		handled = true
+		token = stream.ResumeToken()
+		if cfg.tracker != nil {
+			if err := cfg.tracker.SaveToken(ctx, cfg.name, token); err != nil {
+				cfg.logger.Error("cannot save resume token", "watch", cfg.name, "error", err)
+			}
+		}
+	}
+	return token, handled, stream.Err()
+}
+
+// isTransientStreamError reports whether the watch should reopen the stream.
+// A stream that ended without error is reopened as well.
+func isTransientStreamError(err error) bool {
+	if err == nil {
+		return true
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel("ResumableChangeStreamError")
+}
+
+// WithChangeStream watches coll while Micro runs, calling handler for every
+// change matching pipeline. A handler failure stops the watch and is logged
+// and reported through Deps.Errors.
+func WithChangeStream(coll *mongo.Collection, pipeline any, handler ChangeHandler, opts ...WatchOption) Option {
+	return func(ms *Micro) error {
+		if coll == nil {
+			return errors.New("nil mongo collection provided")
+		}
+		if handler == nil {
+			return errors.New("nil change handler provided")
+		}
+		ms.addRunner(&changeStreamRunner{
+			name: coll.Name(),
+			watch: func(ctx context.Context) error {
+				return WatchCollection(ctx, coll, pipeline, handler, append([]WatchOption{WithWatchLogger(ms.Deps().Logger)}, opts...)...)
+			},
+			deps: ms.Deps,
+		})
+		return nil
+	}
+}
+
+type changeStreamRunner struct {
+	name  string
+	watch func(ctx context.Context) error
+	deps  func() *Deps
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *changeStreamRunner) Name() string {
+	return "change stream " + r.name
+}
+
+func (r *changeStreamRunner) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.cancel, r.done = cancel, done
+	r.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		if err := r.watch(ctx); err != nil {
+			deps := r.deps()
+			deps.Logger.Error("change stream stopped", "watch", r.name, "error", err)
+			if deps.Errors != nil {
+				deps.Errors.Report(ctx, err, map[string]any{"watch": r.name})
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *changeStreamRunner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PublishChanges returns a ChangeHandler that forwards every change to topic
+// as JSON, with the full document in relaxed extended JSON.
+func PublishChanges(publisher events.Publisher, topic string) ChangeHandler {
+	return func(ctx context.Context, event ChangeEvent) error {
+		payload, err := encodeChangeEvent(event)
+		if err != nil {
+			return err
+		}
+		return publisher.Publish(ctx, topic, payload)
+	}
+}
+
+func encodeChangeEvent(event ChangeEvent) ([]byte, error) {
+	message := struct {
+		Operation   string          `json:"operation"`
+		Database    string          `json:"database"`
+		Collection  string          `json:"collection"`
+		DocumentKey json.RawMessage `json:"documentKey,omitempty"`
+		Document    json.RawMessage `json:"document,omitempty"`
+	}{
+		Operation:  event.OperationType,
+		Database:   event.Namespace.DB,
+		Collection: event.Namespace.Collection,
+	}
+	if event.DocumentKey != nil {
+		key, err := bson.MarshalExtJSON(event.DocumentKey, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("encode change document key: %w", err)
+		}
+		message.DocumentKey = key
+	}
+	if len(event.FullDocument) > 0 {
+		doc, err := bson.MarshalExtJSON(event.FullDocument, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("encode change document: %w", err)
+		}
+		message.Document = doc
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,212 @@
+package aqm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type fakeChangeStream struct {
+	events []bson.Raw
+	err    error
+	pos    int
+}
+
+func (s *fakeChangeStream) Next(context.Context) bool {
+	if s.pos >= len(s.events) {
+		return false
+	}
+	s.pos++
+	return true
+}
+
+func (s *fakeChangeStream) Decode(v any) error {
+	return bson.Unmarshal(s.events[s.pos-1], v)
+}
+
+func (s *fakeChangeStream) ResumeToken() bson.Raw {
+	var event ChangeEvent
+	bson.Unmarshal(s.events[s.pos-1], &event)
+	return event.ResumeToken
+}
+
+func (s *fakeChangeStream) Err() error                  { return s.err }
+func (s *fakeChangeStream) Close(context.Context) error { return nil }
+
+func changeDoc(t *testing.T, token, op string, id int) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: token}}},
+		{Key: "operationType", Value: op},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "app"}, {Key: "coll", Value: "users"}}},
+		{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+		{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Ada"}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return raw
+}
+
+func tokenData(token bson.Raw) string {
+	if token == nil {
+		return ""
+	}
+	return token.Lookup("_data").StringValue()
+}
+
+func TestWatchResumesAfterTransientError(t *testing.T) {
+	resumable := mongo.CommandError{Code: 43, Labels: []string{"ResumableChangeStreamError"}}
+	streams := []*fakeChangeStream{
+		{events: []bson.Raw{changeDoc(t, "t1", "insert", 1)}, err: resumable},
+		{events: []bson.Raw{changeDoc(t, "t2", "update", 2)}, err: errors.New("fatal")},
+	}
+
+	store := NewMemoryResumeTracker()
+	store.SaveToken(context.Background(), "users", bson.Raw(mustMarshal(t, bson.D{{Key: "_data", Value: "t0"}})))
+
+	var resumedFrom []string
+	open := func(_ context.Context, token bson.Raw) (changeStream, error) {
+		resumedFrom = append(resumedFrom, tokenData(token))
+		stream := streams[0]
+		streams = streams[1:]
+		return stream, nil
+	}
+
+	var ops []string
+	handler := func(_ context.Context, event ChangeEvent) error {
+		ops = append(ops, event.OperationType)
+		return nil
+	}
+
+	cfg := newWatchConfig("users", []WatchOption{WithResumeTracker(store), WithWatchBackoff(time.Millisecond, time.Millisecond)})
+	err := watch(context.Background(), open, handler, cfg)
+	if err == nil || err.Error() != "fatal" {
+		t.Fatalf("expected fatal error to stop the watch, got %v", err)
+	}
+
+	if len(resumedFrom) != 2 || resumedFrom[0] != "t0" || resumedFrom[1] != "t1" {
+		t.Errorf("expected to resume from t0 then t1, got %v", resumedFrom)
+	}
+	if len(ops) != 2 || ops[0] != "insert" || ops[1] != "update" {
+		t.Errorf("unexpected handled ops %v", ops)
+	}
+	token, _ := store.LoadToken(context.Background(), "users")
+	if tokenData(token) != "t2" {
+		t.Errorf("expected last token t2 persisted, got %v", token)
+	}
+}
+
+func TestWatchHandlerErrorKeepsToken(t *testing.T) {
+	stream := &fakeChangeStream{events: []bson.Raw{changeDoc(t, "t1", "insert", 1), changeDoc(t, "t2", "insert", 2)}}
+	open := func(context.Context, bson.Raw) (changeStream, error) { return stream, nil }
+
+	store := NewMemoryResumeTracker()
+	calls := 0
+	handler := func(context.Context, ChangeEvent) error {
+		calls++
+		if calls == 2 {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	err := watch(context.Background(), open, handler, newWatchConfig("users", []WatchOption{WithResumeTracker(store)}))
+	if err == nil {
+		t.Fatal("expected handler error")
+	}
+	token, _ := store.LoadToken(context.Background(), "users")
+	if tokenData(token) != "t1" {
+		t.Errorf("expected token of the last handled event, got %v", token)
+	}
+}
+
+func TestWatchStopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	opens := 0
+	open := func(context.Context, bson.Raw) (changeStream, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		opens++
+		return nil, mongo.CommandError{Labels: []string{"ResumableChangeStreamError"}}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watch(ctx, open, func(context.Context, ChangeEvent) error { return nil }, newWatchConfig("users", []WatchOption{WithWatchBackoff(time.Millisecond, 5*time.Millisecond)}))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected nil on cancel, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch did not stop")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if opens < 2 {
+		t.Errorf("expected reconnect attempts, got %d", opens)
+	}
+}
+
+func TestPublishChanges(t *testing.T) {
+	var event ChangeEvent
+	if err := bson.Unmarshal(changeDoc(t, "t1", "insert", 7), &event); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	var topic string
+	var payload []byte
+	publisher := publisherFunc(func(_ context.Context, tp string, msg []byte) error {
+		topic, payload = tp, msg
+		return nil
+	})
+	if err := PublishChanges(publisher, "users.changed")(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	var got struct {
+		Operation  string         `json:"operation"`
+		Collection string         `json:"collection"`
+		Document   map[string]any `json:"document"`
+	}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if topic != "users.changed" || got.Operation != "insert" || got.Collection != "users" || got.Document["name"] != "Ada" {
+		t.Errorf("unexpected message on %s: %s", topic, payload)
+	}
+
+	var doc struct {
+		Name string `bson:"name"`
+	}
+	if err := event.Decode(&doc); err != nil || doc.Name != "Ada" {
+		t.Errorf("unexpected decoded document %+v (%v)", doc, err)
+	}
+}
+
+type publisherFunc func(ctx context.Context, topic string, msg []byte) error
+
+func (f publisherFunc) Publish(ctx context.Context, topic string, msg []byte) error {
+	return f(ctx, topic, msg)
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return raw
+}
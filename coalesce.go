@@ -0,0 +1,27 @@
+package aqm
+
+import (
+	"time"
+
+	"github.com/aquamarinepk/aqm/internal/coalesce"
+)
+
+// Coalesce merges concurrent loads of the same key into one call, in the
+// manner of singleflight, and shares successful results for a TTL:
+//
+//	users := aqm.NewCoalesce[string, *User](time.Second)
+//	user, _, err := users.Do(ctx, id, func(ctx context.Context) (*User, error) {
+//		return repo.FindByID(ctx, id)
+//	})
+//
+// A caller whose context ends stops waiting without cancelling the load for
+// the others; the load is cancelled once nobody waits for it. Errors are not
+// shared beyond the callers of the failed call. Forget(key) drops a cached
+// result, e.g. after the resource changed.
+type Coalesce[K comparable, V any] = coalesce.Group[K, V]
+
+// NewCoalesce builds a Coalesce keeping results for ttl. A zero ttl only
+// merges calls that overlap in time.
+func NewCoalesce[K comparable, V any](ttl time.Duration) *Coalesce[K, V] {
+	return coalesce.New[K, V](ttl)
+}
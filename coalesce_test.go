@@ -0,0 +1,138 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceSharesInFlightCall(t *testing.T) {
+	c := NewCoalesce[string, int](0)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, _, err := c.Do(context.Background(), "k", load)
+			if err != nil {
+				t.Errorf("Do: %v", err)
+			}
+			results[i] = v
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("load ran %d times, want 1", calls.Load())
+	}
+	for _, v := range results {
+		if v != 42 {
+			t.Fatalf("results = %v, want all 42", results)
+		}
+	}
+
+	// With no TTL the next call loads again.
+	release = make(chan struct{})
+	close(release)
+	if _, shared, _ := c.Do(context.Background(), "k", load); shared || calls.Load() != 2 {
+		t.Fatalf("expected a fresh load, shared=%v calls=%d", shared, calls.Load())
+	}
+}
+
+func TestCoalesceTTLAndForget(t *testing.T) {
+	c := NewCoalesce[string, int](time.Minute)
+	var calls atomic.Int32
+	load := func(context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	first, _, _ := c.Do(context.Background(), "k", load)
+	second, shared, _ := c.Do(context.Background(), "k", load)
+	if first != 1 || second != 1 || !shared {
+		t.Fatalf("got %d then %d (shared=%v), want cached 1", first, second, shared)
+	}
+
+	c.Forget("k")
+	if v, _, _ := c.Do(context.Background(), "k", load); v != 2 {
+		t.Fatalf("after Forget got %d, want 2", v)
+	}
+}
+
+func TestCoalesceDoesNotCacheErrors(t *testing.T) {
+	c := NewCoalesce[string, int](time.Minute)
+	boom := errors.New("boom")
+	if _, _, err := c.Do(context.Background(), "k", func(context.Context) (int, error) { return 0, boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	v, _, err := c.Do(context.Background(), "k", func(context.Context) (int, error) { return 7, nil })
+	if err != nil || v != 7 {
+		t.Fatalf("got %d, %v; want 7, nil", v, err)
+	}
+}
+
+func TestCoalesceCallerCancellation(t *testing.T) {
+	c := NewCoalesce[string, int](0)
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			close(cancelled)
+			return 0, ctx.Err()
+		}
+	}
+
+	leaving, leave := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := c.Do(leaving, "k", load)
+		errs <- err
+	}()
+	<-started
+
+	staying := make(chan int, 1)
+	go func() {
+		v, _, _ := c.Do(context.Background(), "k", load)
+		staying <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	leave()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leaving caller err = %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-staying; v != 1 {
+		t.Fatalf("remaining caller got %d, want 1", v)
+	}
+
+	// Once every caller is gone the load is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	started, cancelled, release = make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() { _, _, _ = c.Do(ctx, "other", load) }()
+	<-started
+	cancel()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("load not cancelled after its only caller left")
+	}
+}
@@ -0,0 +1,112 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Command is a one-off job, such as a migration or seed, that runs with the
+// fully wired Deps instead of starting the service runners.
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(ctx context.Context, deps *Deps, args []string) error
+}
+
+// ErrUnknownCommand is returned by Run when the first argument names no
+// registered command.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// WithCommands registers subcommands. When the binary is invoked with a
+// registered subcommand (e.g. `./tasks migrate --dry-run`), Run starts the
+// lifecycle components, executes the command with the remaining arguments,
+// runs the stop and shutdown hooks and returns the command error without
+// starting any runner. Without arguments the service starts as usual.
+func WithCommands(cmds ...Command) Option {
+	return func(ms *Micro) error {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		if ms.commands == nil {
+			ms.commands = make(map[string]Command, len(cmds))
+		}
+		for _, cmd := range cmds {
+			if cmd.Name == "" || cmd.Run == nil {
+				return errors.New("command requires a name and a run function")
+			}
+			if strings.HasPrefix(cmd.Name, "-") {
+				return fmt.Errorf("invalid command name %q", cmd.Name)
+			}
+			if _, exists := ms.commands[cmd.Name]; exists {
+				return fmt.Errorf("duplicate command %q", cmd.Name)
+			}
+			ms.commands[cmd.Name] = cmd
+		}
+		return nil
+	}
+}
+
+// WithArgs overrides the command-line arguments inspected by Run, which
+// default to os.Args[1:].
+func WithArgs(args ...string) Option {
+	return func(ms *Micro) error {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.args = append([]string{}, args...)
+		return nil
+	}
+}
+
+// resolveCommand returns the command selected by the arguments, or nil when
+// the service should start normally. Config flags such as --config and
+// --set may come before the command and are not passed to it.
+func (micro *Micro) resolveCommand() (*Command, []string, error) {
+	micro.mu.RLock()
+	defer micro.mu.RUnlock()
+	if len(micro.commands) == 0 {
+		return nil, nil, nil
+	}
+	args := micro.args
+	if args == nil && len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+	_, args, err := parseConfigFlags(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil, nil, nil
+	}
+	cmd, ok := micro.commands[args[0]]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q, available: %s", ErrUnknownCommand, args[0], strings.Join(micro.commandNames(), ", "))
+	}
+	return &cmd, args[1:], nil
+}
+
+func (micro *Micro) commandNames() []string {
+	names := make([]string, 0, len(micro.commands))
+	for name := range micro.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (micro *Micro) runCommand(ctx context.Context, cmd *Command, args []string, supervisor *Supervisor, startFns, stopFns []func(context.Context) error, shutdown []ShutdownFunc) error {
+	if err := startLifecycle(ctx, startFns, stopFns); err != nil {
+		return err
+	}
+	logger := micro.Deps().Logger
+	logger.Info("running command", "command", cmd.Name)
+
+	err := cmd.Run(ctx, micro.Deps(), args)
+	if err != nil {
+		err = fmt.Errorf("command %s: %w", cmd.Name, err)
+	}
+	err = errors.Join(err, stopSupervisor(ctx, supervisor))
+	return errors.Join(err, stopLifecycle(context.Background(), stopFns, shutdown))
+}
@@ -0,0 +1,153 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type recordingRunner struct {
+	started bool
+}
+
+func (r *recordingRunner) Start(context.Context) error { r.started = true; return nil }
+func (r *recordingRunner) Stop(context.Context) error  { return nil }
+
+func TestWithCommandsRunsSelectedCommand(t *testing.T) {
+	var events []string
+	var gotArgs []string
+	var gotDeps *Deps
+	runner := &recordingRunner{}
+	cfg := NewConfig()
+
+	ms := NewMicro(
+		WithConfig(cfg),
+		WithLogger(NewNoopLogger()),
+		WithRunner(runner),
+		WithLifecycle(LifecycleHooks{
+			OnStart: func(context.Context) error { events = append(events, "start"); return nil },
+			OnStop:  func(context.Context) error { events = append(events, "stop"); return nil },
+		}),
+		WithShutdown(func(context.Context) error { events = append(events, "shutdown"); return nil }),
+		WithCommands(Command{
+			Name: "migrate",
+			Run: func(_ context.Context, deps *Deps, args []string) error {
+				events = append(events, "migrate")
+				gotArgs, gotDeps = args, deps
+				return nil
+			},
+		}),
+		WithArgs("migrate", "--dry-run"),
+	)
+
+	if err := ms.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runner.started {
+		t.Error("runners must not start in command mode")
+	}
+	if want := []string{"start", "migrate", "stop", "shutdown"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+	if !reflect.DeepEqual(gotArgs, []string{"--dry-run"}) {
+		t.Errorf("unexpected args %v", gotArgs)
+	}
+	if gotDeps == nil || gotDeps.Config != cfg {
+		t.Error("expected command to receive wired deps")
+	}
+}
+
+func TestWithCommandsAfterConfigFlags(t *testing.T) {
+	var gotArgs []string
+	runner := &recordingRunner{}
+	ms := NewMicro(
+		WithConfig(NewConfig()),
+		WithLogger(NewNoopLogger()),
+		WithRunner(runner),
+		WithCommands(Command{
+			Name: "migrate",
+			Run: func(_ context.Context, _ *Deps, args []string) error {
+				gotArgs = args
+				return nil
+			},
+		}),
+		WithArgs("--config", "prod.yaml", "--set=db.name=app", "migrate", "--dry-run"),
+	)
+
+	if err := ms.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runner.started {
+		t.Error("expected the command to run instead of the server")
+	}
+	if !reflect.DeepEqual(gotArgs, []string{"--dry-run"}) {
+		t.Errorf("unexpected args %v", gotArgs)
+	}
+}
+
+func TestWithCommandsErrors(t *testing.T) {
+	failing := errors.New("boom")
+	newMicro := func(args ...string) *Micro {
+		return NewMicro(
+			WithConfig(NewConfig()),
+			WithLogger(NewNoopLogger()),
+			WithCommands(Command{
+				Name: "seed",
+				Run:  func(context.Context, *Deps, []string) error { return failing },
+			}),
+			WithArgs(args...),
+		)
+	}
+
+	if err := newMicro("seed").Run(context.Background()); !errors.Is(err, failing) {
+		t.Errorf("expected command error, got %v", err)
+	}
+	if err := newMicro("unknown").Run(context.Background()); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("expected ErrUnknownCommand, got %v", err)
+	}
+}
+
+func TestWithCommandsFallsBackToServing(t *testing.T) {
+	runner := &recordingRunner{}
+	ms := NewMicro(
+		WithConfig(NewConfig()),
+		WithLogger(NewNoopLogger()),
+		WithRunner(runner),
+		WithCommands(Command{Name: "migrate", Run: func(context.Context, *Deps, []string) error { return nil }}),
+		WithArgs("--verbose"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ms.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !runner.started {
+		t.Error("expected runners to start without a command")
+	}
+}
+
+func TestWithCommandsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cmds []Command
+	}{
+		{name: "missingName", cmds: []Command{{Run: func(context.Context, *Deps, []string) error { return nil }}}},
+		{name: "missingRun", cmds: []Command{{Name: "migrate"}}},
+		{name: "flagName", cmds: []Command{{Name: "-x", Run: func(context.Context, *Deps, []string) error { return nil }}}},
+		{name: "duplicate", cmds: []Command{
+			{Name: "seed", Run: func(context.Context, *Deps, []string) error { return nil }},
+			{Name: "seed", Run: func(context.Context, *Deps, []string) error { return nil }},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &Micro{deps: DefaultDeps()}
+			if err := WithCommands(tt.cmds...)(ms); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -18,8 +18,11 @@ import (
 
 // Config stores configuration values keyed by hierarchical property names.
 type Config struct {
-	mu     sync.RWMutex
-	values map[string]any
+	mu      sync.RWMutex
+	values  map[string]any
+	aliases map[string]struct{}
+	secrets map[string]struct{}
+	profile string
 }
 
 // NewConfig constructs an empty property store.
@@ -36,13 +39,29 @@ func (p *Config) Clone() *Config {
 	for k, v := range p.values {
 		cloned[k] = v
 	}
-	return &Config{values: cloned}
+	var aliases map[string]struct{}
+	if len(p.aliases) > 0 {
+		aliases = make(map[string]struct{}, len(p.aliases))
+		for k := range p.aliases {
+			aliases[k] = struct{}{}
+		}
+	}
+	var secrets map[string]struct{}
+	if len(p.secrets) > 0 {
+		secrets = make(map[string]struct{}, len(p.secrets))
+		for k := range p.secrets {
+			secrets[k] = struct{}{}
+		}
+	}
+	return &Config{values: cloned, aliases: aliases, secrets: secrets, profile: p.profile}
 }
 
 // Set persists a value under the provided property path.
 func (p *Config) Set(path string, value any) {
 	p.mu.Lock()
-	p.values[normalise(path)] = value
+	key := normalise(path)
+	p.values[key] = value
+	delete(p.aliases, key)
 	p.mu.Unlock()
 }
 
@@ -53,7 +72,9 @@ func (p *Config) MergeFlat(values map[string]any) {
 	}
 	p.mu.Lock()
 	for k, v := range values {
-		p.values[normalise(k)] = v
+		key := normalise(k)
+		p.values[key] = v
+		delete(p.aliases, key)
 	}
 	p.mu.Unlock()
 }
@@ -125,16 +146,7 @@ func (p *Config) GetString(path string) (string, bool) {
 	if !ok {
 		return "", false
 	}
-	switch v := raw.(type) {
-	case string:
-		return v, true
-	case fmt.Stringer:
-		return v.String(), true
-	case []byte:
-		return string(v), true
-	default:
-		return fmt.Sprintf("%v", raw), true
-	}
+	return stringifyConfigValue(raw), true
 }
 
 // GetInt retrieves the value as an int.
@@ -397,6 +409,10 @@ func (p *Config) addAliasKeys() {
 			alias := strings.Join(current, ".")
 			if _, exists := p.values[alias]; !exists {
 				p.values[alias] = value
+				if p.aliases == nil {
+					p.aliases = make(map[string]struct{})
+				}
+				p.aliases[alias] = struct{}{}
 			}
 		}
 	}
@@ -515,3 +515,76 @@ func TestConfigNormalise(t *testing.T) {
 		t.Error("key normalization failed for UPPER.case")
 	}
 }
+
+func benchConfig() *Config {
+	cfg := NewConfig()
+	cfg.MergeNested(map[string]any{
+		"service": map[string]any{"name": "orders", "version": "1.4.0"},
+		"http":    map[string]any{"port": ":8080", "timeout": "30s"},
+		"db":      map[string]any{"pool_size": 20},
+	})
+	return cfg
+}
+
+func BenchmarkConfigGetString(b *testing.B) {
+	cfg := benchConfig()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg.GetString("service.name")
+	}
+}
+
+func BenchmarkConfigGetDurationOrDef(b *testing.B) {
+	cfg := benchConfig()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg.GetDurationOrDef("http.timeout", time.Minute)
+	}
+}
+
+// BenchmarkConfigReadsParallel measures reads contending on the config lock,
+// as every request handler reading settings does.
+func BenchmarkConfigReadsParallel(b *testing.B) {
+	cfg := benchConfig()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cfg.GetString("service.name")
+			cfg.GetIntOrDef("db.pool_size", 10)
+		}
+	})
+}
+
+// BenchmarkConfigReadsDuringWrites measures reads while a reload keeps
+// taking the write lock.
+func BenchmarkConfigReadsDuringWrites(b *testing.B) {
+	cfg := benchConfig()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				cfg.Set("db.pool_size", i%50)
+				time.Sleep(10 * time.Microsecond)
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cfg.GetString("service.name")
+			cfg.GetIntOrDef("db.pool_size", 10)
+		}
+	})
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
@@ -0,0 +1,158 @@
+package aqm
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// HTTPConfig groups the settings of the HTTP server, bound from "http".
+type HTTPConfig struct {
+	Port            string        `koanf:"port" default:":8080"`
+	ReadTimeout     time.Duration `koanf:"read_timeout" default:"15s"`
+	WriteTimeout    time.Duration `koanf:"write_timeout" default:"15s"`
+	IdleTimeout     time.Duration `koanf:"idle_timeout" default:"60s"`
+	ShutdownTimeout time.Duration `koanf:"shutdown_timeout" default:"10s"`
+}
+
+// BindEnv returns a T populated from the config subtree at path. See
+// Config.Bind for the supported tags.
+func BindEnv[T any](cfg *Config, path string) (T, error) {
+	var target T
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	err := cfg.Bind(path, &target)
+	return target, err
+}
+
+// Bind populates target, a pointer to a struct, from the config subtree at
+// path. Fields are matched by their "koanf" tag, unset fields take the value
+// of their "default" tag, and the result is checked against "validate" tags
+// with the rules of ValidateStruct (required, min=N, max=N, oneof=a b, ...).
+// Validation failures are returned as ValidationErrors keyed by the full
+// property path.
+func (p *Config) Bind(path string, target any) error {
+	value := reflect.ValueOf(target)
+	if target == nil || value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: bind target must be a pointer to a struct, got %T", target)
+	}
+	if err := applyDefaults(value.Elem()); err != nil {
+		return err
+	}
+
+	nested := p.snapshot()
+	if path != "" {
+		nested, _ = walkNested(nested, path)
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:          "koanf",
+		Result:           target,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("config: decoder: %w", err)
+	}
+	if err := decoder.Decode(nested); err != nil {
+		return fmt.Errorf("config: decode %s: %w", path, err)
+	}
+
+	if errs := validateBound(value.Elem(), path); errs.HasErrors() {
+		return errs
+	}
+	return nil
+}
+
+func applyDefaults(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			if err := applyDefaults(fv); err != nil {
+				return err
+			}
+			continue
+		}
+		def, ok := field.Tag.Lookup("default")
+		if !ok || !fv.IsZero() {
+			continue
+		}
+		if err := setFromString(fv, def); err != nil {
+			return fmt.Errorf("config: default for %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", v.Type())
+		}
+		parts := strings.Split(raw, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		v.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// validateBound checks v against its validate tags with the rules of
+// ValidateStruct, keying errors by property path.
+func validateBound(v reflect.Value, prefix string) ValidationErrors {
+	var errs ValidationErrors
+	validateValue(v, prefix, "koanf", &errs)
+	return errs
+}
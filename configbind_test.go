@@ -0,0 +1,129 @@
+package aqm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+type bindTestConfig struct {
+	Name    string        `koanf:"name" validate:"required"`
+	Mode    string        `koanf:"mode" default:"fast" validate:"oneof=fast safe"`
+	Workers int           `koanf:"workers" default:"4" validate:"min=1,max=64"`
+	Timeout time.Duration `koanf:"timeout" default:"5s"`
+	Tags    []string      `koanf:"tags" default:"a, b"`
+	Enabled bool          `koanf:"enabled" default:"true"`
+	Retry   struct {
+		Max int `koanf:"max" default:"3"`
+	} `koanf:"retry"`
+}
+
+func TestConfigBindDefaults(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("worker.name", "indexer")
+
+	got, err := BindEnv[bindTestConfig](cfg, "worker")
+	if err != nil {
+		t.Fatalf("BindEnv error: %v", err)
+	}
+	if got.Name != "indexer" || got.Mode != "fast" || got.Workers != 4 || got.Timeout != 5*time.Second {
+		t.Errorf("unexpected binding %+v", got)
+	}
+	if len(got.Tags) != 2 || got.Tags[1] != "b" || !got.Enabled || got.Retry.Max != 3 {
+		t.Errorf("unexpected defaults %+v", got)
+	}
+}
+
+func TestConfigBindOverrides(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MergeFlat(map[string]any{
+		"worker.name":      "indexer",
+		"worker.mode":      "safe",
+		"worker.workers":   "8",
+		"worker.timeout":   "1m",
+		"worker.tags":      "x,y,z",
+		"worker.enabled":   "false",
+		"worker.retry.max": 7,
+	})
+
+	var got bindTestConfig
+	if err := cfg.Bind("worker", &got); err != nil {
+		t.Fatalf("Bind error: %v", err)
+	}
+	if got.Mode != "safe" || got.Workers != 8 || got.Timeout != time.Minute || len(got.Tags) != 3 || got.Enabled || got.Retry.Max != 7 {
+		t.Errorf("unexpected binding %+v", got)
+	}
+}
+
+func TestConfigBindValidation(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MergeFlat(map[string]any{"worker.mode": "slow", "worker.workers": 100})
+
+	_, err := BindEnv[bindTestConfig](cfg, "worker")
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	fields := map[string]string{}
+	for _, v := range verrs {
+		fields[v.Field] = v.Code
+	}
+	want := map[string]string{"worker.name": "required", "worker.mode": "oneof", "worker.workers": "max"}
+	for field, code := range want {
+		if fields[field] != code {
+			t.Errorf("expected %s on %s, got %v", code, field, verrs)
+		}
+	}
+}
+
+func TestConfigBindInvalidRule(t *testing.T) {
+	type broken struct {
+		Mode string `koanf:"mode" default:"a" validate:"oneof=a b,bogus"`
+	}
+	_, err := BindEnv[broken](NewConfig(), "svc")
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 1 || verrs[0].Code != CodeInvalidRule || verrs[0].Field != "svc.mode" {
+		t.Fatalf("expected an invalid_rule error on svc.mode, got %v", err)
+	}
+}
+
+func TestConfigBindInvalidTarget(t *testing.T) {
+	cfg := NewConfig()
+	var s string
+	if err := cfg.Bind("", &s); err == nil {
+		t.Error("expected error for non-struct target")
+	}
+	if err := cfg.Bind("", bindTestConfig{}); err == nil {
+		t.Error("expected error for non-pointer target")
+	}
+}
+
+func TestBindModuleConfigs(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MergeFlat(map[string]any{
+		"mongo.uri":         "mongodb://localhost",
+		"mongo.database":    "app",
+		"auth.audience":     "api",
+		"auth.signing_key":  "k",
+		"http.read_timeout": "30s",
+	})
+
+	httpCfg, err := BindEnv[HTTPConfig](cfg, "http")
+	if err != nil || httpCfg.Port != ":8080" || httpCfg.ReadTimeout != 30*time.Second {
+		t.Errorf("unexpected http config %+v (%v)", httpCfg, err)
+	}
+	mongoCfg, err := BindEnv[MongoConfig](cfg, "mongo")
+	if err != nil || mongoCfg.ConnectTimeout != 10*time.Second {
+		t.Errorf("unexpected mongo config %+v (%v)", mongoCfg, err)
+	}
+	authCfg, err := BindEnv[auth.Config](cfg, "auth")
+	if err != nil || authCfg.SessionTTL != 24*time.Hour {
+		t.Errorf("unexpected auth config %+v (%v)", authCfg, err)
+	}
+
+	if _, err := BindEnv[MongoConfig](NewConfig(), "mongo"); err == nil {
+		t.Error("expected missing mongo uri to fail validation")
+	}
+}
@@ -0,0 +1,119 @@
+package aqm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FlagDotenv forces dotenv loading on (--dotenv) or off (--dotenv=false)
+// regardless of the active profile.
+const FlagDotenv = "dotenv"
+
+// dotenvFiles are read in order, later files overriding earlier ones.
+var dotenvFiles = []string{".env", ".env.local"}
+
+// dotenvEnabled reports whether .env files should be loaded. Loading is on for
+// the dev profile unless --dotenv says otherwise.
+func dotenvEnabled(args []string, profile string) bool {
+	if raw, ok := parseArgsToMap(args)[FlagDotenv].(string); ok {
+		if enabled, err := strconv.ParseBool(raw); err == nil {
+			return enabled
+		}
+	}
+	return profile == ProfileDev
+}
+
+// loadDotenv reads the dotenv files from the working directory and returns the
+// variables carrying envPrefix, keyed the same way as the env layer. Variables
+// already set in the real environment are skipped so they keep precedence.
+func loadDotenv(envPrefix string, transform func(string) string) (map[string]any, error) {
+	vars := make(map[string]string)
+	for _, path := range dotenvFiles {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config: loading %s: %w", path, err)
+		}
+		parsed, err := parseDotenv(data)
+		if err != nil {
+			return nil, fmt.Errorf("config: loading %s: %w", path, err)
+		}
+		for key, value := range parsed {
+			vars[key] = value
+		}
+	}
+
+	out := make(map[string]any)
+	for key, value := range vars {
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		out[transform(key)] = value
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// parseDotenv parses KEY=VALUE lines. Blank lines, # comments and a leading
+// "export " are ignored. Values may be single-quoted (literal) or
+// double-quoted (\n, \t, \" and \\ escapes); unquoted values end at " #".
+func parseDotenv(data []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		value, err := unquoteDotenv(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		out[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func unquoteDotenv(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated %c quote", quote)
+		}
+		inner := value[1:end]
+		if quote == '\'' {
+			return inner, nil
+		}
+		return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(inner), nil
+	}
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value, nil
+}
@@ -0,0 +1,123 @@
+package aqm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "plain",
+			input: "# comment\n\nAPP_HTTP_PORT=8080\nexport APP_DEBUG=true\n",
+			want:  map[string]string{"APP_HTTP_PORT": "8080", "APP_DEBUG": "true"},
+		},
+		{
+			name:  "quoted",
+			input: "A='single # kept'\nB=\"line\\nbreak\"\nC=value # trailing\nD=\n",
+			want:  map[string]string{"A": "single # kept", "B": "line\nbreak", "C": "value", "D": ""},
+		},
+		{
+			name:    "missingEquals",
+			input:   "APP_PORT\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminatedQuote",
+			input:   "A=\"open\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDotenv([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDotenv error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithDotenv(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	write(".env", "DOT_HTTP_PORT=8080\nDOT_LOG_LEVEL=info\nDOT_DB_HOST=dotenv\nOTHER_KEY=x\n")
+	write(".env.local", "DOT_LOG_LEVEL=debug\n")
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		profile string
+		args    []string
+		want    map[string]string
+		missing []string
+	}{
+		{
+			name:    "devProfile",
+			profile: ProfileDev,
+			want:    map[string]string{"http.port": "8080", "log.level": "debug", "db.host": "env"},
+			missing: []string{"other.key"},
+		},
+		{
+			name:    "prodSkipsDotenv",
+			profile: ProfileProd,
+			want:    map[string]string{"db.host": "env"},
+			missing: []string{"http.port", "log.level"},
+		},
+		{
+			name:    "flagEnables",
+			profile: ProfileProd,
+			args:    []string{"--dotenv"},
+			want:    map[string]string{"http.port": "8080"},
+		},
+		{
+			name:    "flagDisables",
+			profile: ProfileDev,
+			args:    []string{"--dotenv=false"},
+			missing: []string{"http.port"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProfileEnvVar, tt.profile)
+			t.Setenv("DOT_DB_HOST", "env")
+
+			cfg, err := LoadConfig("DOT_", tt.args)
+			if err != nil {
+				t.Fatalf("LoadConfig error: %v", err)
+			}
+			for key, want := range tt.want {
+				if got, _ := cfg.GetString(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			for _, key := range tt.missing {
+				if val, ok := cfg.Get(key); ok {
+					t.Errorf("%s should be unset, got %v", key, val)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package aqm
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ErrNoConfigKey is returned when a key provider cannot unwrap the data key
+// of an encrypted configuration file.
+var ErrNoConfigKey = errors.New("config: no key can decrypt the data key")
+
+// ErrConfigMAC is returned when the MAC of an encrypted configuration file
+// does not match its content, e.g. after values were added, removed or
+// reordered without sops.
+var ErrConfigMAC = errors.New("config: encrypted file mac mismatch")
+
+// SOPSMetadata is the sops block of an encrypted configuration file. Each
+// Age and KMS entry holds the data key wrapped for one recipient. The
+// suffix and regex fields select the keys sops left unencrypted; at most one
+// of them is set.
+type SOPSMetadata struct {
+	Age               []SOPSAgeKey `yaml:"age"`
+	KMS               []SOPSKMSKey `yaml:"kms"`
+	LastModified      string       `yaml:"lastmodified"`
+	MAC               string       `yaml:"mac"`
+	MACOnlyEncrypted  bool         `yaml:"mac_only_encrypted"`
+	UnencryptedSuffix string       `yaml:"unencrypted_suffix"`
+	EncryptedSuffix   string       `yaml:"encrypted_suffix"`
+	UnencryptedRegex  string       `yaml:"unencrypted_regex"`
+	EncryptedRegex    string       `yaml:"encrypted_regex"`
+	Version           string       `yaml:"version"`
+}
+
+// SOPSAgeKey is the data key encrypted to an age recipient, as an armored
+// age file.
+type SOPSAgeKey struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// SOPSKMSKey is the data key encrypted by a KMS key, base64 encoded.
+type SOPSKMSKey struct {
+	ARN string `yaml:"arn"`
+	Enc string `yaml:"enc"`
+}
+
+// ConfigKeyProvider unwraps the data key of an encrypted configuration file.
+type ConfigKeyProvider interface {
+	DataKey(ctx context.Context, meta SOPSMetadata) ([]byte, error)
+}
+
+// ConfigKeyProviderFunc adapts a function to ConfigKeyProvider.
+type ConfigKeyProviderFunc func(ctx context.Context, meta SOPSMetadata) ([]byte, error)
+
+// DataKey implements ConfigKeyProvider.
+func (f ConfigKeyProviderFunc) DataKey(ctx context.Context, meta SOPSMetadata) ([]byte, error) {
+	return f(ctx, meta)
+}
+
+// StaticKeyProvider returns a fixed data key, for tests and local
+// development.
+func StaticKeyProvider(key []byte) ConfigKeyProvider {
+	return ConfigKeyProviderFunc(func(context.Context, SOPSMetadata) ([]byte, error) { return key, nil })
+}
+
+// AgeKeyProvider unwraps the data key with decrypt, which opens an armored
+// age file with the local identity (e.g. a closure over filippo.io/age and
+// the key in SOPS_AGE_KEY_FILE). Entries are tried in order.
+func AgeKeyProvider(decrypt func(armored string) ([]byte, error)) ConfigKeyProvider {
+	return ConfigKeyProviderFunc(func(_ context.Context, meta SOPSMetadata) ([]byte, error) {
+		var errs []error
+		for _, entry := range meta.Age {
+			key, err := decrypt(entry.Enc)
+			if err == nil {
+				return key, nil
+			}
+			errs = append(errs, fmt.Errorf("age %s: %w", entry.Recipient, err))
+		}
+		return nil, errors.Join(append([]error{ErrNoConfigKey}, errs...)...)
+	})
+}
+
+// KMSDecrypter decrypts a ciphertext with a KMS key; an AWS KMS or GCP KMS
+// client wrapped in a few lines satisfies it.
+type KMSDecrypter interface {
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKeyProvider unwraps the data key through client with the context the
+// file is loaded with. Entries are tried in order.
+func KMSKeyProvider(client KMSDecrypter) ConfigKeyProvider {
+	return ConfigKeyProviderFunc(func(ctx context.Context, meta SOPSMetadata) ([]byte, error) {
+		var errs []error
+		for _, entry := range meta.KMS {
+			ciphertext, err := base64.StdEncoding.DecodeString(entry.Enc)
+			if err == nil {
+				var key []byte
+				key, err = client.Decrypt(ctx, entry.ARN, ciphertext)
+				if err == nil {
+					return key, nil
+				}
+			}
+			errs = append(errs, fmt.Errorf("kms %s: %w", entry.ARN, err))
+		}
+		return nil, errors.Join(append([]error{ErrNoConfigKey}, errs...)...)
+	})
+}
+
+// MergeEncryptedYAML merges a SOPS-encrypted YAML document. Values in the
+// ENC[AES256_GCM,...] format are decrypted with the data key returned by
+// provider, checking their key path as additional data. Every value must be
+// encrypted unless the sops metadata leaves its key unencrypted through
+// unencrypted_suffix, encrypted_suffix, unencrypted_regex or
+// encrypted_regex. The document MAC is then checked over the decrypted
+// values, so values cannot be added, dropped or swapped without the data
+// key. Decrypted keys are marked secret and always redacted by Export and
+// RedactChanges.
+func (p *Config) MergeEncryptedYAML(ctx context.Context, data []byte, provider ConfigKeyProvider) error {
+	if provider == nil {
+		return errors.New("config: nil key provider")
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return errors.New("config: encrypted document is not a mapping")
+	}
+	root := doc.Content[0]
+
+	var metaNode *yamlv3.Node
+	tree := &yamlv3.Node{Kind: yamlv3.MappingNode}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "sops" {
+			metaNode = root.Content[i+1]
+			continue
+		}
+		tree.Content = append(tree.Content, root.Content[i], root.Content[i+1])
+	}
+	if metaNode == nil {
+		return errors.New("config: document has no sops metadata")
+	}
+	var meta SOPSMetadata
+	if err := metaNode.Decode(&meta); err != nil {
+		return fmt.Errorf("config: sops metadata: %w", err)
+	}
+	if meta.MAC == "" {
+		return errors.New("config: sops metadata has no mac")
+	}
+
+	key, err := provider.DataKey(ctx, meta)
+	if err != nil {
+		return fmt.Errorf("config: data key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("config: data key: %w", err)
+	}
+
+	walker, err := newSOPSWalker(block, meta)
+	if err != nil {
+		return err
+	}
+	decrypted, err := walker.walk(tree, nil)
+	if err != nil {
+		return err
+	}
+	if err := walker.verifyMAC(); err != nil {
+		return err
+	}
+	p.MergeNested(decrypted.(map[string]any))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.secrets == nil {
+		p.secrets = make(map[string]struct{}, len(walker.secrets))
+	}
+	for k := range walker.secrets {
+		p.secrets[normalise(k)] = struct{}{}
+	}
+	return nil
+}
+
+// MergeEncryptedYAMLFile reads a SOPS-encrypted YAML file and merges it
+// like MergeEncryptedYAML.
+func (p *Config) MergeEncryptedYAMLFile(ctx context.Context, path string, provider ConfigKeyProvider) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := p.MergeEncryptedYAML(ctx, data, provider); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// IsSecret reports whether the value at path was decrypted from an
+// encrypted file.
+func (p *Config) IsSecret(path string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.secrets[normalise(path)]
+	return ok
+}
+
+// sopsWalker decrypts a sops tree in document order, hashing the values the
+// way sops computes the file MAC.
+type sopsWalker struct {
+	block            cipher.Block
+	meta             SOPSMetadata
+	unencryptedRegex *regexp.Regexp
+	encryptedRegex   *regexp.Regexp
+	mac              hash.Hash
+	secrets          map[string]struct{}
+}
+
+func newSOPSWalker(block cipher.Block, meta SOPSMetadata) (*sopsWalker, error) {
+	w := &sopsWalker{block: block, meta: meta, mac: sha512.New(), secrets: make(map[string]struct{})}
+	var err error
+	if meta.UnencryptedRegex != "" {
+		if w.unencryptedRegex, err = regexp.Compile(meta.UnencryptedRegex); err != nil {
+			return nil, fmt.Errorf("config: sops unencrypted_regex: %w", err)
+		}
+	}
+	if meta.EncryptedRegex != "" {
+		if w.encryptedRegex, err = regexp.Compile(meta.EncryptedRegex); err != nil {
+			return nil, fmt.Errorf("config: sops encrypted_regex: %w", err)
+		}
+	}
+	return w, nil
+}
+
+// encrypted reports whether sops encrypted the value at path, following the
+// rules sops applies when it writes the file.
+func (w *sopsWalker) encrypted(path []string) bool {
+	match := func(fn func(string) bool) bool {
+		for _, k := range path {
+			if fn(k) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case w.meta.UnencryptedSuffix != "":
+		return !match(func(k string) bool { return strings.HasSuffix(k, w.meta.UnencryptedSuffix) })
+	case w.meta.EncryptedSuffix != "":
+		return match(func(k string) bool { return strings.HasSuffix(k, w.meta.EncryptedSuffix) })
+	case w.unencryptedRegex != nil:
+		return !match(w.unencryptedRegex.MatchString)
+	case w.encryptedRegex != nil:
+		return match(w.encryptedRegex.MatchString)
+	}
+	return true
+}
+
+func (w *sopsWalker) walk(node *yamlv3.Node, path []string) (any, error) {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		out := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k := node.Content[i].Value
+			value, err := w.walk(node.Content[i+1], append(path[:len(path):len(path)], k))
+			if err != nil {
+				return nil, err
+			}
+			out[k] = value
+		}
+		return out, nil
+	case yamlv3.SequenceNode:
+		out := make([]any, len(node.Content))
+		for i, child := range node.Content {
+			value, err := w.walk(child, path)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	case yamlv3.AliasNode:
+		return w.walk(node.Alias, path)
+	case yamlv3.ScalarNode:
+		return w.scalar(node, path)
+	default:
+		return nil, fmt.Errorf("config: unsupported yaml node at %s", strings.Join(path, "."))
+	}
+}
+
+func (w *sopsWalker) scalar(node *yamlv3.Node, path []string) (any, error) {
+	if node.Tag == "!!null" {
+		return nil, nil
+	}
+	name := strings.Join(path, ".")
+	encrypted := w.encrypted(path)
+	var value any
+	if encrypted {
+		if node.Tag != "!!str" || !strings.HasPrefix(node.Value, "ENC[") {
+			return nil, fmt.Errorf("config: %s is not encrypted", name)
+		}
+		var err error
+		value, err = decryptConfigValue(w.block, node.Value, strings.Join(path, ":")+":")
+		if err != nil {
+			return nil, fmt.Errorf("config: decrypt %s: %w", name, err)
+		}
+		w.secrets[name] = struct{}{}
+	} else if err := node.Decode(&value); err != nil {
+		return nil, fmt.Errorf("config: %s: %w", name, err)
+	}
+	if encrypted || !w.meta.MACOnlyEncrypted {
+		w.mac.Write(sopsBytes(value))
+	}
+	return value, nil
+}
+
+// verifyMAC compares the hash of the walked values with the file MAC,
+// which sops encrypts with the lastmodified timestamp as additional data.
+func (w *sopsWalker) verifyMAC() error {
+	stored, err := decryptConfigValue(w.block, w.meta.MAC, w.meta.LastModified)
+	if err != nil {
+		return fmt.Errorf("config: decrypt mac: %w", err)
+	}
+	want, ok := stored.(string)
+	if !ok || !strings.EqualFold(want, hex.EncodeToString(w.mac.Sum(nil))) {
+		return ErrConfigMAC
+	}
+	return nil
+}
+
+// sopsBytes renders a value the way sops feeds it to the MAC.
+func sopsBytes(value any) []byte {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	case bool:
+		if v {
+			return []byte("True")
+		}
+		return []byte("False")
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case time.Time:
+		return []byte(v.Format(time.RFC3339))
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// decryptConfigValue opens ENC[AES256_GCM,data:...,iv:...,tag:...,type:...].
+func decryptConfigValue(block cipher.Block, enc, aad string) (any, error) {
+	body, ok := strings.CutPrefix(enc, "ENC[AES256_GCM,")
+	if !ok || !strings.HasSuffix(body, "]") {
+		return nil, errors.New("unsupported encrypted value format")
+	}
+	fields := make(map[string]string, 4)
+	for _, part := range strings.Split(strings.TrimSuffix(body, "]"), ",") {
+		name, value, _ := strings.Cut(part, ":")
+		fields[name] = value
+	}
+	var decoded [3][]byte
+	for i, name := range []string{"data", "iv", "tag"} {
+		b, err := base64.StdEncoding.DecodeString(fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		decoded[i] = b
+	}
+	data, iv, tag := decoded[0], decoded[1], decoded[2]
+	if len(iv) == 0 {
+		return nil, errors.New("missing iv")
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	if err != nil {
+		return nil, errors.New("authentication failed")
+	}
+
+	s := string(plain)
+	switch fields["type"] {
+	case "", "str":
+		return s, nil
+	case "int":
+		return strconv.Atoi(s)
+	case "float":
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		return strconv.ParseBool(s)
+	case "bytes":
+		return plain, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %q", fields["type"])
+	}
+}
@@ -0,0 +1,179 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testDataKey = bytes.Repeat([]byte{3}, 32)
+
+func encryptTestValue(t *testing.T, value, typ, aad string) string {
+	t.Helper()
+	block, err := aes.NewCipher(testDataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := bytes.Repeat([]byte{9}, 32)
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(aad))
+	n := len(sealed) - gcm.Overhead()
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", enc(sealed[:n]), enc(iv), enc(sealed[n:]), typ)
+}
+
+const testLastModified = "2026-10-16T09:00:00Z"
+
+// encryptedTestDocument is what sops writes for the document with db.name
+// left in clear text by unencrypted_regex. The MAC covers the values in
+// document order.
+func encryptedTestDocument(t *testing.T) string {
+	sum := sha512.Sum512([]byte("app" + "hunter2" + "12" + "True"))
+	return fmt.Sprintf(`db:
+    name: app
+    password: %s
+    pool: %s
+tls:
+    enabled: %s
+sops:
+    kms:
+        - arn: arn:aws:kms:eu-west-1:1:key/a
+          enc: %s
+    lastmodified: "%s"
+    mac: %s
+    unencrypted_regex: ^name$
+    version: 3.9.0
+`,
+		encryptTestValue(t, "hunter2", "str", "db:password:"),
+		encryptTestValue(t, "12", "int", "db:pool:"),
+		encryptTestValue(t, "True", "bool", "tls:enabled:"),
+		base64.StdEncoding.EncodeToString([]byte("wrapped")),
+		testLastModified,
+		encryptTestValue(t, strings.ToUpper(hex.EncodeToString(sum[:])), "str", testLastModified))
+}
+
+type ctxKey struct{}
+
+type fakeKMS struct {
+	calls []string
+	ctx   context.Context
+}
+
+func (k *fakeKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	k.calls = append(k.calls, keyID)
+	k.ctx = ctx
+	if string(ciphertext) != "wrapped" {
+		return nil, errors.New("bad ciphertext")
+	}
+	return testDataKey, nil
+}
+
+func TestMergeEncryptedYAMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	if err := os.WriteFile(path, []byte(encryptedTestDocument(t)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kms := &fakeKMS{}
+	cfg := NewConfig()
+	ctx := context.WithValue(context.Background(), ctxKey{}, "load")
+	if err := cfg.MergeEncryptedYAMLFile(ctx, path, KMSKeyProvider(kms)); err != nil {
+		t.Fatalf("MergeEncryptedYAMLFile error: %v", err)
+	}
+	if len(kms.calls) != 1 || kms.calls[0] != "arn:aws:kms:eu-west-1:1:key/a" {
+		t.Errorf("kms calls = %v", kms.calls)
+	}
+	if kms.ctx == nil || kms.ctx.Value(ctxKey{}) != "load" {
+		t.Error("kms was not called with the load context")
+	}
+
+	if got := cfg.GetStringOrDef("db.password", ""); got != "hunter2" {
+		t.Errorf("db.password = %q", got)
+	}
+	if got := cfg.GetIntOrDef("db.pool", 0); got != 12 {
+		t.Errorf("db.pool = %d", got)
+	}
+	if !cfg.GetBoolOrFalse("tls.enabled") {
+		t.Error("tls.enabled = false")
+	}
+	if _, ok := cfg.Get("sops.version"); ok {
+		t.Error("sops metadata merged into config")
+	}
+	if !cfg.IsSecret("DB.Password") || cfg.IsSecret("db.name") {
+		t.Error("secret marks are wrong")
+	}
+	if !cfg.Clone().IsSecret("db.pool") {
+		t.Error("Clone dropped secret marks")
+	}
+
+	data, err := cfg.Export(ConfigFormatJSON, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "12") || !strings.Contains(out, `"app"`) {
+		t.Errorf("export leaked decrypted values: %s", out)
+	}
+
+	rotated := cfg.Clone()
+	rotated.Set("db.pool", 20)
+	changes := RedactChanges(cfg.Diff(rotated), []string{})
+	if len(changes) != 1 || !changes[0].Secret || changes[0].Old != RedactedValue || changes[0].New != RedactedValue {
+		t.Errorf("secret change not redacted: %+v", changes)
+	}
+}
+
+func TestMergeEncryptedYAMLRejectsTampering(t *testing.T) {
+	doc := encryptedTestDocument(t)
+
+	moved := strings.Replace(doc, "    name: app\n", "", 1)
+	moved = strings.Replace(moved, "password:", "name:", 1)
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(moved), StaticKeyProvider(testDataKey)); err == nil {
+		t.Error("value moved to another key was accepted")
+	}
+
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(doc), StaticKeyProvider(bytes.Repeat([]byte{4}, 32))); err == nil {
+		t.Error("wrong data key was accepted")
+	}
+
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte("db:\n    name: app\n"), StaticKeyProvider(testDataKey)); err == nil {
+		t.Error("document without sops metadata was accepted")
+	}
+
+	plain := strings.Replace(doc, "    pool: ENC[", "    pool: 99\n    was: ENC[", 1)
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(plain), StaticKeyProvider(testDataKey)); err == nil || !strings.Contains(err.Error(), "db.pool is not encrypted") {
+		t.Errorf("clear text value was accepted: %v", err)
+	}
+
+	dropped := doc[:strings.Index(doc, "tls:")] + doc[strings.Index(doc, "sops:"):]
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(dropped), StaticKeyProvider(testDataKey)); !errors.Is(err, ErrConfigMAC) {
+		t.Errorf("dropped value: err = %v, want ErrConfigMAC", err)
+	}
+
+	renamed := strings.Replace(doc, "name: app", "name: other", 1)
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(renamed), StaticKeyProvider(testDataKey)); !errors.Is(err, ErrConfigMAC) {
+		t.Errorf("edited clear text value: err = %v, want ErrConfigMAC", err)
+	}
+
+	noMAC := strings.Replace(doc, "    mac: ENC[", "    was_mac: ENC[", 1)
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(noMAC), StaticKeyProvider(testDataKey)); err == nil {
+		t.Error("document without mac was accepted")
+	}
+
+	noAge := AgeKeyProvider(func(string) ([]byte, error) { return nil, errors.New("no identity") })
+	if err := NewConfig().MergeEncryptedYAML(context.Background(), []byte(doc), noAge); !errors.Is(err, ErrNoConfigKey) {
+		t.Errorf("err = %v, want ErrNoConfigKey", err)
+	}
+}
@@ -0,0 +1,144 @@
+package aqm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Standard configuration flags understood by LoadConfig and Micro.Run.
+const (
+	FlagConfig         = "config"
+	FlagSet            = "set"
+	FlagPrintConfig    = "print-config"
+	FlagValidateConfig = "validate-config"
+)
+
+// configFlags holds the configuration flags extracted from the arguments.
+type configFlags struct {
+	files    []string
+	sets     map[string]any
+	print    bool
+	validate bool
+}
+
+// parseConfigFlags extracts --config, --set, --print-config and
+// --validate-config from args and returns the remaining arguments untouched.
+func parseConfigFlags(args []string) (configFlags, []string, error) {
+	var flags configFlags
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+		switch name {
+		case FlagConfig, FlagSet:
+			if !hasValue {
+				if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+					return flags, nil, fmt.Errorf("config: --%s requires a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			if name == FlagConfig {
+				flags.files = append(flags.files, value)
+				continue
+			}
+			key, val, ok := strings.Cut(value, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return flags, nil, fmt.Errorf("config: --set expects key=value, got %q", value)
+			}
+			if flags.sets == nil {
+				flags.sets = make(map[string]any)
+			}
+			flags.sets[strings.TrimSpace(key)] = val
+		case FlagPrintConfig:
+			flags.print = !hasValue || value != "false"
+		case FlagValidateConfig:
+			flags.validate = !hasValue || value != "false"
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return flags, rest, nil
+}
+
+type configCheck struct {
+	path   string
+	target func() any
+}
+
+// WithConfigCheck binds the config subtree at path into a fresh T before the
+// service starts, so its "default" and "validate" tags are enforced at startup
+// and by --validate-config.
+func WithConfigCheck[T any](path string) Option {
+	return func(ms *Micro) error {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.configChecks = append(ms.configChecks, configCheck{
+			path:   path,
+			target: func() any { return new(T) },
+		})
+		return nil
+	}
+}
+
+// validateConfig runs the registered config checks, joining their errors.
+func (micro *Micro) validateConfig() error {
+	micro.mu.RLock()
+	checks := append([]configCheck(nil), micro.configChecks...)
+	micro.mu.RUnlock()
+
+	cfg := micro.Deps().Config
+	var errs error
+	for _, check := range checks {
+		if err := cfg.Bind(check.path, check.target()); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("config %q: %w", check.path, err))
+		}
+	}
+	return errs
+}
+
+// runConfigFlags handles --print-config and --validate-config. It reports
+// whether one of them was given, in which case Run returns without starting.
+func (micro *Micro) runConfigFlags() (bool, error) {
+	micro.mu.RLock()
+	args := micro.args
+	out := micro.stdout
+	micro.mu.RUnlock()
+	if args == nil && len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+
+	flags, _, err := parseConfigFlags(args)
+	if err != nil {
+		return true, err
+	}
+	if !flags.print && !flags.validate {
+		return false, micro.validateConfig()
+	}
+
+	if err := micro.validateConfig(); err != nil {
+		return true, err
+	}
+	if flags.print {
+		data, err := micro.Deps().Config.Export(ConfigFormatYAML, nil)
+		if err != nil {
+			return true, err
+		}
+		if _, err := out.Write(data); err != nil {
+			return true, fmt.Errorf("config: printing: %w", err)
+		}
+		return true, nil
+	}
+	_, err = io.WriteString(out, "config: ok\n")
+	return true, err
+}
@@ -0,0 +1,183 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantFiles []string
+		wantSets  map[string]any
+		wantPrint bool
+		wantValid bool
+		wantRest  []string
+		wantErr   bool
+	}{
+		{
+			name:     "no config flags",
+			args:     []string{"--http.port=9090", "serve"},
+			wantRest: []string{"--http.port=9090", "serve"},
+		},
+		{
+			name:      "repeatable config",
+			args:      []string{"--config", "a.yaml", "--config=b.yaml", "--debug"},
+			wantFiles: []string{"a.yaml", "b.yaml"},
+			wantRest:  []string{"--debug"},
+		},
+		{
+			name:     "set overrides",
+			args:     []string{"--set", "db.host=localhost", "--set=db.port=5432"},
+			wantSets: map[string]any{"db.host": "localhost", "db.port": "5432"},
+			wantRest: []string{},
+		},
+		{
+			name:      "print and validate",
+			args:      []string{"--print-config", "--validate-config"},
+			wantPrint: true,
+			wantValid: true,
+			wantRest:  []string{},
+		},
+		{
+			name:    "set without equals",
+			args:    []string{"--set", "db.host"},
+			wantErr: true,
+		},
+		{
+			name:    "config without value",
+			args:    []string{"--config"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, rest, err := parseConfigFlags(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseConfigFlags error: %v", err)
+			}
+			if !reflect.DeepEqual(flags.files, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", flags.files, tt.wantFiles)
+			}
+			if !reflect.DeepEqual(flags.sets, tt.wantSets) {
+				t.Errorf("sets = %v, want %v", flags.sets, tt.wantSets)
+			}
+			if flags.print != tt.wantPrint || flags.validate != tt.wantValid {
+				t.Errorf("print=%v validate=%v, want %v %v", flags.print, flags.validate, tt.wantPrint, tt.wantValid)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("rest = %v, want %v", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithConfigFilesAndSet(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.yaml")
+	if err := os.WriteFile(base, []byte("db:\n  host: base\n  port: 1\nname: svc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte("db:\n  host: override\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--config", base, "--config", override, "--db.port=2", "--set", "name=cli"}
+	cfg, err := LoadConfig("", args)
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+
+	for key, want := range map[string]string{"db.host": "override", "db.port": "2", "name": "cli"} {
+		if got, _ := cfg.GetString(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := cfg.Get("config"); ok {
+		t.Error("--config should not be stored as a property")
+	}
+}
+
+func TestLoadConfigMissingConfigFile(t *testing.T) {
+	if _, err := LoadConfig("", []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Fatal("expected error for missing --config file")
+	}
+}
+
+type checkedDBConfig struct {
+	Host string `koanf:"host" validate:"required"`
+}
+
+func TestMicroRunConfigFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]any
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "print redacts secrets",
+			values: map[string]any{"db.host": "localhost", "db.password": "hunter2"},
+			args:   []string{"--print-config"},
+			want:   "host: localhost",
+		},
+		{
+			name:   "validate ok",
+			values: map[string]any{"db.host": "localhost"},
+			args:   []string{"--validate-config"},
+			want:   "config: ok",
+		},
+		{
+			name:    "validate fails",
+			values:  map[string]any{},
+			args:    []string{"--validate-config"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.MergeFlat(tt.values)
+			runner := &testRunnerImpl{}
+			ms := NewMicro(
+				WithConfig(cfg),
+				WithLogger(NewNoopLogger()),
+				WithArgs(tt.args...),
+				WithConfigCheck[checkedDBConfig]("db"),
+				WithRunner(runner),
+			)
+			var out bytes.Buffer
+			ms.stdout = &out
+
+			err := ms.Run(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if runner.startCalled {
+				t.Error("runners should not start")
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output %q does not contain %q", out.String(), tt.want)
+			}
+			if strings.Contains(out.String(), "hunter2") {
+				t.Error("secret leaked in printed config")
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ var defaultConfigPaths = []string{
 // are matched using the provided prefix, replacing underscores with dots and
 // lower-casing the remainder (e.g. TODO_HTTP_PORT -> http.port). CLI arguments
 // use a simple --key=value or --key value syntax with flags taking precedence.
+// The standard flags --config path (repeatable) and --set a.b=c are honoured as
+// described in LoadSources.
 func LoadConfig(envNamespace string, args []string) (*Config, error) {
 	cfg := NewConfig()
 	if err := cfg.LoadSources(envNamespace, args); err != nil {
@@ -37,9 +39,21 @@ func LoadConfig(envNamespace string, args []string) (*Config, error) {
 // LoadSources merges configuration from the default sources into the receiver.
 // Sources are applied in the following order (later overrides earlier):
 //  1. YAML file (first match among config/config.{yaml,yml}, .config/...)
-//  2. Environment variables with the given prefix
-//  3. CLI arguments in --key=value or --key value form
+//  2. Profile YAML file (config.{profile}.yaml next to the above), where the
+//     profile comes from --profile or APP_ENV
+//  3. Files given with --config, merged in the order they appear
+//  4. .env and .env.local in the working directory, for the dev profile or
+//     when --dotenv is given (--dotenv=false disables them)
+//  5. Environment variables with the given prefix
+//  6. CLI arguments in --key=value or --key value form
+//  7. Overrides given with --set a.b=c
+//
+// --print-config and --validate-config are not stored; Micro.Run acts on them.
 func (p *Config) LoadSources(envNamespace string, args []string) error {
+	flags, args, err := parseConfigFlags(args)
+	if err != nil {
+		return err
+	}
 	k := koanf.New(".")
 
 	if path, ok := findConfigFile(); ok {
@@ -48,6 +62,19 @@ func (p *Config) LoadSources(envNamespace string, args []string) error {
 		}
 	}
 
+	profile := resolveProfile(args)
+	if path, ok := findProfileConfigFile(profile); ok {
+		if err := k.Load(file.Provider(path), koanfyaml.Parser()); err != nil {
+			return fmt.Errorf("config: loading %s: %w", path, err)
+		}
+	}
+
+	for _, path := range flags.files {
+		if err := k.Load(file.Provider(path), koanfyaml.Parser()); err != nil {
+			return fmt.Errorf("config: loading %s: %w", path, err)
+		}
+	}
+
 	if envNamespace != "" {
 		envPrefix := strings.ToUpper(strings.TrimSuffix(envNamespace, "_")) + "_"
 		transform := func(s string) string {
@@ -55,6 +82,17 @@ func (p *Config) LoadSources(envNamespace string, args []string) error {
 			s = strings.ReplaceAll(s, "_", ".")
 			return strings.ToLower(s)
 		}
+		if dotenvEnabled(args, profile) {
+			vars, err := loadDotenv(envPrefix, transform)
+			if err != nil {
+				return err
+			}
+			if len(vars) > 0 {
+				if err := k.Load(confmap.Provider(vars, "."), nil); err != nil {
+					return fmt.Errorf("config: loading dotenv: %w", err)
+				}
+			}
+		}
 		if err := k.Load(env.Provider(envPrefix, ".", transform), nil); err != nil {
 			return fmt.Errorf("config: loading env: %w", err)
 		}
@@ -66,12 +104,21 @@ func (p *Config) LoadSources(envNamespace string, args []string) error {
 		}
 	}
 
+	if len(flags.sets) > 0 {
+		if err := k.Load(confmap.Provider(flags.sets, "."), nil); err != nil {
+			return fmt.Errorf("config: loading --set: %w", err)
+		}
+	}
+
 	raw := map[string]any{}
 	if err := k.Unmarshal("", &raw); err != nil {
 		return fmt.Errorf("config: unmarshal: %w", err)
 	}
 	p.MergeNested(raw)
 	p.addAliasKeys()
+	if profile != "" {
+		p.SetProfile(profile)
+	}
 	return nil
 }
 
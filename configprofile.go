@@ -0,0 +1,100 @@
+package aqm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Well-known configuration profiles.
+const (
+	ProfileDev     = "dev"
+	ProfileStaging = "staging"
+	ProfileProd    = "prod"
+)
+
+// ProfileEnvVar selects the active profile when no --profile flag is given.
+const ProfileEnvVar = "APP_ENV"
+
+var profileAliases = map[string]string{
+	"development": ProfileDev,
+	"local":       ProfileDev,
+	"stage":       ProfileStaging,
+	"production":  ProfileProd,
+}
+
+// Profile returns the active configuration profile, or "" when none was
+// selected.
+func (p *Config) Profile() string {
+	if p == nil {
+		return ""
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.profile
+}
+
+// SetProfile overrides the active profile. Names are lower-cased and common
+// aliases (development, production, ...) are folded onto the well-known ones.
+func (p *Config) SetProfile(profile string) {
+	p.mu.Lock()
+	p.profile = normaliseProfile(profile)
+	p.mu.Unlock()
+}
+
+// IsProfile reports whether the active profile matches any of the given names.
+func (p *Config) IsProfile(profiles ...string) bool {
+	active := p.Profile()
+	if active == "" {
+		return false
+	}
+	for _, profile := range profiles {
+		if normaliseProfile(profile) == active {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDev reports whether the dev profile is active.
+func (p *Config) IsDev() bool {
+	return p.IsProfile(ProfileDev)
+}
+
+// IsProd reports whether the prod profile is active.
+func (p *Config) IsProd() bool {
+	return p.IsProfile(ProfileProd)
+}
+
+func normaliseProfile(profile string) string {
+	profile = strings.ToLower(strings.TrimSpace(profile))
+	if alias, ok := profileAliases[profile]; ok {
+		return alias
+	}
+	return profile
+}
+
+// resolveProfile picks the profile from --profile (or --profile=x), falling
+// back to APP_ENV.
+func resolveProfile(args []string) string {
+	if profile, ok := parseArgsToMap(args)["profile"].(string); ok && profile != "true" {
+		return normaliseProfile(profile)
+	}
+	return normaliseProfile(os.Getenv(ProfileEnvVar))
+}
+
+// findProfileConfigFile returns the first config.{profile}.{yaml,yml} found
+// alongside the default config locations.
+func findProfileConfigFile(profile string) (string, bool) {
+	if profile == "" {
+		return "", false
+	}
+	for _, path := range defaultConfigPaths {
+		ext := filepath.Ext(path)
+		candidate := strings.TrimSuffix(path, ext) + "." + profile + ext
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
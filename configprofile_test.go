@@ -0,0 +1,76 @@
+package aqm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigProfileAccessors(t *testing.T) {
+	var nilCfg *Config
+	if nilCfg.Profile() != "" || nilCfg.IsProd() {
+		t.Error("nil config must report no profile")
+	}
+
+	cfg := NewConfig()
+	if cfg.IsDev() {
+		t.Error("expected no profile by default")
+	}
+
+	cfg.SetProfile(" Production ")
+	if cfg.Profile() != ProfileProd {
+		t.Errorf("expected %q, got %q", ProfileProd, cfg.Profile())
+	}
+	if !cfg.IsProd() || !cfg.IsProfile("staging", "prod") || cfg.IsDev() {
+		t.Error("unexpected profile matching")
+	}
+	if cfg.Clone().Profile() != ProfileProd {
+		t.Error("expected clone to keep profile")
+	}
+}
+
+func TestLoadConfigWithProfile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	write("config.yaml", "http:\n  port: 8080\nlog:\n  level: info\n")
+	write("config.dev.yaml", "log:\n  level: debug\n")
+	write("config.prod.yaml", "log:\n  level: error\n")
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		profile string
+		level   string
+	}{
+		{name: "noProfile", profile: "", level: "info"},
+		{name: "fromEnv", env: "development", profile: ProfileDev, level: "debug"},
+		{name: "flagOverridesEnv", env: "dev", args: []string{"--profile", "prod"}, profile: ProfileProd, level: "error"},
+		{name: "missingProfileFile", args: []string{"--profile=staging"}, profile: ProfileStaging, level: "info"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProfileEnvVar, tt.env)
+
+			cfg, err := LoadConfig("", tt.args)
+			if err != nil {
+				t.Fatalf("LoadConfig error: %v", err)
+			}
+			if cfg.Profile() != tt.profile {
+				t.Errorf("expected profile %q, got %q", tt.profile, cfg.Profile())
+			}
+			if level := cfg.GetStringOrDef("log.level", ""); level != tt.level {
+				t.Errorf("expected log.level %q, got %q", tt.level, level)
+			}
+			if port := cfg.GetIntOrDef("http.port", 0); port != 8080 {
+				t.Errorf("expected base http.port 8080, got %d", port)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package aqm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Keys returns the sorted names of the direct children under prefix, so
+// Keys("gateway.routes") lists the configured route names. An empty prefix
+// lists the top-level keys. Derived underscore aliases are not included.
+func (p *Config) Keys(prefix string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	for key := range p.values {
+		if _, alias := p.aliases[key]; alias {
+			continue
+		}
+		rest, ok := trimConfigPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		child, _, _ := strings.Cut(rest, ".")
+		seen[child] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetStringMap returns every value under prefix as a string, keyed by its path
+// relative to prefix (e.g. "orders.partitions" for kafka.topics.orders.partitions).
+// It reports false when nothing is configured under prefix.
+func (p *Config) GetStringMap(prefix string) (map[string]string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	out := make(map[string]string)
+	for key, value := range p.values {
+		if _, alias := p.aliases[key]; alias {
+			continue
+		}
+		rest, ok := trimConfigPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		out[rest] = stringifyConfigValue(value)
+	}
+	if len(out) == 0 {
+		return nil, false
+	}
+	return out, true
+}
+
+// Sub returns a new Config holding the subtree under prefix with keys made
+// relative to it. The result is a copy; later changes to either side are not
+// shared. The active profile is carried over.
+func (p *Config) Sub(prefix string) *Config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	sub := &Config{values: make(map[string]any), profile: p.profile}
+	for key, value := range p.values {
+		rest, ok := trimConfigPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		sub.values[rest] = value
+		if _, alias := p.aliases[key]; alias {
+			if sub.aliases == nil {
+				sub.aliases = make(map[string]struct{})
+			}
+			sub.aliases[rest] = struct{}{}
+		}
+	}
+	return sub
+}
+
+// trimConfigPrefix strips the normalised prefix plus its trailing dot from key.
+func trimConfigPrefix(key, prefix string) (string, bool) {
+	prefix = strings.Trim(normalise(prefix), ".")
+	if prefix == "" {
+		return key, true
+	}
+	rest, ok := strings.CutPrefix(key, prefix+".")
+	if !ok || rest == "" {
+		return "", false
+	}
+	return rest, true
+}
+
+func stringifyConfigValue(raw any) string {
+	switch v := raw.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", raw)
+	}
+}
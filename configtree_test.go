@@ -0,0 +1,100 @@
+package aqm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTreeConfig() *Config {
+	cfg := NewConfig()
+	cfg.MergeNested(map[string]any{
+		"gateway": map[string]any{
+			"routes": map[string]any{
+				"users":  map[string]any{"path": "/users", "upstream": "http://users"},
+				"orders": map[string]any{"path": "/orders", "timeout": 5},
+			},
+		},
+		"kafka": map[string]any{
+			"topics": map[string]any{"orders": "orders-v1", "users": "users-v2"},
+		},
+	})
+	cfg.addAliasKeys()
+	return cfg
+}
+
+func TestConfigKeys(t *testing.T) {
+	cfg := newTreeConfig()
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "", want: []string{"gateway", "kafka"}},
+		{prefix: "gateway.routes", want: []string{"orders", "users"}},
+		{prefix: "Gateway.Routes.", want: []string{"orders", "users"}},
+		{prefix: "gateway.routes.users", want: []string{"path", "upstream"}},
+		{prefix: "missing", want: []string{}},
+		{prefix: "kafka.topics.orders", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := cfg.Keys(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigGetStringMap(t *testing.T) {
+	cfg := newTreeConfig()
+
+	got, ok := cfg.GetStringMap("kafka.topics")
+	if !ok {
+		t.Fatal("expected kafka.topics to exist")
+	}
+	want := map[string]string{"orders": "orders-v1", "users": "users-v2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetStringMap = %v, want %v", got, want)
+	}
+
+	got, _ = cfg.GetStringMap("gateway.routes.orders")
+	if got["timeout"] != "5" {
+		t.Errorf("expected stringified timeout, got %q", got["timeout"])
+	}
+
+	if _, ok := cfg.GetStringMap("missing"); ok {
+		t.Error("expected missing prefix to report false")
+	}
+}
+
+func TestConfigSub(t *testing.T) {
+	cfg := newTreeConfig()
+	cfg.SetProfile(ProfileDev)
+
+	sub := cfg.Sub("gateway.routes")
+	if got := sub.GetStringOrDef("users.path", ""); got != "/users" {
+		t.Errorf("users.path = %q, want /users", got)
+	}
+	if got := sub.GetIntOrDef("orders.timeout", 0); got != 5 {
+		t.Errorf("orders.timeout = %d, want 5", got)
+	}
+	if got := sub.Keys(""); !reflect.DeepEqual(got, []string{"orders", "users"}) {
+		t.Errorf("sub keys = %v", got)
+	}
+	if !sub.IsDev() {
+		t.Error("expected profile to carry over")
+	}
+	if _, ok := sub.Get("kafka.topics.orders"); ok {
+		t.Error("sub should not contain keys outside the prefix")
+	}
+
+	sub.Set("users.path", "/changed")
+	if got := cfg.GetStringOrDef("gateway.routes.users.path", ""); got != "/users" {
+		t.Errorf("parent changed through sub: %q", got)
+	}
+
+	if empty := cfg.Sub("missing"); len(empty.Keys("")) != 0 {
+		t.Error("expected empty sub config")
+	}
+}
@@ -0,0 +1,229 @@
+package aqm
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configDateLayout is accepted by GetTime next to RFC3339.
+const configDateLayout = "2006-01-02"
+
+var byteSizeUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+	"k":   1 << 10,
+	"m":   1 << 20,
+	"g":   1 << 30,
+	"t":   1 << 40,
+}
+
+// GetInt64 retrieves the value as an int64.
+func (p *Config) GetInt64(path string) (int64, bool, error) {
+	raw, ok := p.Get(path)
+	if !ok {
+		return 0, false, nil
+	}
+	switch v := raw.(type) {
+	case int:
+		return int64(v), true, nil
+	case int64:
+		return v, true, nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, true, fmt.Errorf("config: %d overflows int64", v)
+		}
+		return int64(v), true, nil
+	case float64:
+		return int64(v), true, nil
+	case string:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return parsed, true, err
+	default:
+		return 0, true, fmt.Errorf("config: cannot convert %T to int64", raw)
+	}
+}
+
+// GetUint retrieves the value as a uint, rejecting negative numbers.
+func (p *Config) GetUint(path string) (uint, bool, error) {
+	raw, ok := p.Get(path)
+	if !ok {
+		return 0, false, nil
+	}
+	switch v := raw.(type) {
+	case uint:
+		return v, true, nil
+	case uint64:
+		return uint(v), true, nil
+	case int:
+		if v < 0 {
+			return 0, true, fmt.Errorf("config: negative value %d for uint", v)
+		}
+		return uint(v), true, nil
+	case int64:
+		if v < 0 {
+			return 0, true, fmt.Errorf("config: negative value %d for uint", v)
+		}
+		return uint(v), true, nil
+	case float64:
+		if v < 0 {
+			return 0, true, fmt.Errorf("config: negative value %v for uint", v)
+		}
+		return uint(v), true, nil
+	case string:
+		parsed, err := strconv.ParseUint(strings.TrimSpace(v), 10, 0)
+		return uint(parsed), true, err
+	default:
+		return 0, true, fmt.Errorf("config: cannot convert %T to uint", raw)
+	}
+}
+
+// GetTime retrieves the value as a time.Time. Strings may be RFC3339 or a
+// date-only YYYY-MM-DD, which is read as midnight UTC.
+func (p *Config) GetTime(path string) (time.Time, bool, error) {
+	raw, ok := p.Get(path)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	switch v := raw.(type) {
+	case time.Time:
+		return v, true, nil
+	case string:
+		v = strings.TrimSpace(v)
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, true, nil
+		}
+		t, err := time.Parse(configDateLayout, v)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("config: %q is not RFC3339 or YYYY-MM-DD", v)
+		}
+		return t, true, nil
+	default:
+		return time.Time{}, true, fmt.Errorf("config: cannot convert %T to time", raw)
+	}
+}
+
+// GetBytesSize retrieves a size in bytes. Strings take an optional unit
+// (B, KB, MB, GB, TB or the KiB forms, case-insensitive); units are powers of
+// 1024, so "512MB" is 536870912.
+func (p *Config) GetBytesSize(path string) (uint64, bool, error) {
+	raw, ok := p.Get(path)
+	if !ok {
+		return 0, false, nil
+	}
+	switch v := raw.(type) {
+	case int:
+		if v < 0 {
+			return 0, true, fmt.Errorf("config: negative size %d", v)
+		}
+		return uint64(v), true, nil
+	case int64:
+		if v < 0 {
+			return 0, true, fmt.Errorf("config: negative size %d", v)
+		}
+		return uint64(v), true, nil
+	case uint64:
+		return v, true, nil
+	case float64:
+		if v < 0 {
+			return 0, true, fmt.Errorf("config: negative size %v", v)
+		}
+		return uint64(v), true, nil
+	case string:
+		size, err := parseBytesSize(v)
+		return size, true, err
+	default:
+		return 0, true, fmt.Errorf("config: cannot convert %T to byte size", raw)
+	}
+}
+
+// GetURL retrieves the value as an absolute URL with a scheme and host.
+func (p *Config) GetURL(path string) (*url.URL, bool, error) {
+	raw, ok := p.GetString(path)
+	if !ok {
+		return nil, false, nil
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, true, fmt.Errorf("config: invalid url: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, true, fmt.Errorf("config: url %q must include scheme and host", raw)
+	}
+	return u, true, nil
+}
+
+// GetInt64OrDef retrieves the value as an int64 or returns def when not found or on conversion error.
+func (p *Config) GetInt64OrDef(path string, def int64) int64 {
+	if v, ok, err := p.GetInt64(path); ok && err == nil {
+		return v
+	}
+	return def
+}
+
+// GetUintOrDef retrieves the value as a uint or returns def when not found or on conversion error.
+func (p *Config) GetUintOrDef(path string, def uint) uint {
+	if v, ok, err := p.GetUint(path); ok && err == nil {
+		return v
+	}
+	return def
+}
+
+// GetTimeOrDef retrieves the value as a time.Time or returns def when not found or on conversion error.
+func (p *Config) GetTimeOrDef(path string, def time.Time) time.Time {
+	if v, ok, err := p.GetTime(path); ok && err == nil {
+		return v
+	}
+	return def
+}
+
+// GetBytesSizeOrDef retrieves a size in bytes or returns def when not found or on conversion error.
+func (p *Config) GetBytesSizeOrDef(path string, def uint64) uint64 {
+	if v, ok, err := p.GetBytesSize(path); ok && err == nil {
+		return v
+	}
+	return def
+}
+
+// GetURLOrDef retrieves the value as a URL or returns def when not found or on conversion error.
+func (p *Config) GetURLOrDef(path string, def *url.URL) *url.URL {
+	if v, ok, err := p.GetURL(path); ok && err == nil {
+		return v
+	}
+	return def
+}
+
+func parseBytesSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, unit := s, ""
+	if idx >= 0 {
+		number, unit = s[:idx], strings.ToLower(strings.TrimSpace(s[idx:]))
+	}
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("config: invalid byte size %q", s)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("config: invalid byte size %q", s)
+	}
+	size := value * float64(multiplier)
+	if size > math.MaxUint64 {
+		return 0, fmt.Errorf("config: byte size %q overflows", s)
+	}
+	return uint64(size), nil
+}
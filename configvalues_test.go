@@ -0,0 +1,162 @@
+package aqm
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestConfigGetInt64AndUint(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		wantI64  int64
+		wantUint uint
+		i64Err   bool
+		uintErr  bool
+	}{
+		{name: "int", value: 42, wantI64: 42, wantUint: 42},
+		{name: "string", value: "9000000000", wantI64: 9000000000, wantUint: 9000000000},
+		{name: "negative", value: -3, wantI64: -3, uintErr: true},
+		{name: "negativeString", value: "-3", wantI64: -3, uintErr: true},
+		{name: "invalid", value: "abc", i64Err: true, uintErr: true},
+		{name: "invalidType", value: []int{1}, i64Err: true, uintErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Set("key", tt.value)
+
+			i64, ok, err := cfg.GetInt64("key")
+			if !ok || (err != nil) != tt.i64Err {
+				t.Fatalf("GetInt64 ok=%v err=%v, wantErr %v", ok, err, tt.i64Err)
+			}
+			if err == nil && i64 != tt.wantI64 {
+				t.Errorf("GetInt64 = %d, want %d", i64, tt.wantI64)
+			}
+
+			u, ok, err := cfg.GetUint("key")
+			if !ok || (err != nil) != tt.uintErr {
+				t.Fatalf("GetUint ok=%v err=%v, wantErr %v", ok, err, tt.uintErr)
+			}
+			if err == nil && u != tt.wantUint {
+				t.Errorf("GetUint = %d, want %d", u, tt.wantUint)
+			}
+		})
+	}
+}
+
+func TestConfigGetTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "rfc3339", value: "2024-03-01T10:30:00Z", want: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "dateOnly", value: "2024-03-01", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "timeValue", value: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "invalid", value: "yesterday", wantErr: true},
+		{name: "invalidType", value: 12, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Set("key", tt.value)
+			got, ok, err := cfg.GetTime("key")
+			if !ok || (err != nil) != tt.wantErr {
+				t.Fatalf("GetTime ok=%v err=%v, wantErr %v", ok, err, tt.wantErr)
+			}
+			if err == nil && !got.Equal(tt.want) {
+				t.Errorf("GetTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigGetBytesSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    uint64
+		wantErr bool
+	}{
+		{name: "plainInt", value: 1024, want: 1024},
+		{name: "bytes", value: "100B", want: 100},
+		{name: "megabytes", value: "512MB", want: 512 << 20},
+		{name: "lowercaseSpaced", value: "2 gib", want: 2 << 30},
+		{name: "fractional", value: "1.5KB", want: 1536},
+		{name: "shortUnit", value: "4k", want: 4096},
+		{name: "unknownUnit", value: "10XB", wantErr: true},
+		{name: "noNumber", value: "MB", wantErr: true},
+		{name: "negative", value: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Set("key", tt.value)
+			got, ok, err := cfg.GetBytesSize("key")
+			if !ok || (err != nil) != tt.wantErr {
+				t.Fatalf("GetBytesSize ok=%v err=%v, wantErr %v", ok, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("GetBytesSize = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigGetURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", value: "https://api.example.com/v1", want: "https://api.example.com/v1"},
+		{name: "missingScheme", value: "api.example.com", wantErr: true},
+		{name: "missingHost", value: "file:///tmp", wantErr: true},
+		{name: "malformed", value: "http://[::1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Set("key", tt.value)
+			got, ok, err := cfg.GetURL("key")
+			if !ok || (err != nil) != tt.wantErr {
+				t.Fatalf("GetURL ok=%v err=%v, wantErr %v", ok, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("GetURL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValueOrDefFunctions(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("bad", "nope")
+	cfg.Set("size", "1MB")
+
+	if got := cfg.GetInt64OrDef("missing", 7); got != 7 {
+		t.Errorf("GetInt64OrDef = %d, want 7", got)
+	}
+	if got := cfg.GetUintOrDef("bad", 3); got != 3 {
+		t.Errorf("GetUintOrDef = %d, want 3", got)
+	}
+	def := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := cfg.GetTimeOrDef("bad", def); !got.Equal(def) {
+		t.Errorf("GetTimeOrDef = %v, want %v", got, def)
+	}
+	if got := cfg.GetBytesSizeOrDef("size", 0); got != 1<<20 {
+		t.Errorf("GetBytesSizeOrDef = %d, want %d", got, 1<<20)
+	}
+	defURL := &url.URL{Scheme: "http", Host: "localhost"}
+	if got := cfg.GetURLOrDef("missing", defURL); got != defURL {
+		t.Errorf("GetURLOrDef = %v, want %v", got, defURL)
+	}
+}
@@ -0,0 +1,272 @@
+package aqm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc/codes"
+)
+
+// ConnectModule is the name the Connect routes are attributed to.
+const ConnectModule = "connect"
+
+// ConnectHandlerFactory builds one Connect service handler from the shared
+// dependencies. Its results match the New<Service>Handler functions
+// generated by protoc-gen-connect-go: the procedure path prefix, such as
+// "/users.v1.UsersService/", and the handler.
+type ConnectHandlerFactory func(deps *Deps) (path string, handler http.Handler)
+
+// WithConnectHandlers serves Connect, gRPC-Web and gRPC clients from the
+// HTTP server listening on addrKey, configuring it when WithHTTPServer is not
+// used. The handlers run behind the HTTP middleware stack, next to the
+// shared health endpoints, and the server accepts HTTP/2 without TLS (h2c)
+// for gRPC clients. Errors written by middleware as the standard error
+// envelope, e.g. a 401 from authentication, are translated to the protocol
+// of the request so Connect clients see their own error codes.
+//
+// Usage:
+//
+//	aqm.WithConnectHandlers("http.port", func(deps *aqm.Deps) (string, http.Handler) {
+//		return usersv1connect.NewUsersServiceHandler(users.NewService(deps))
+//	})
+func WithConnectHandlers(addrKey string, factories ...ConnectHandlerFactory) Option {
+	return func(ms *Micro) error {
+		if addrKey == "" {
+			return errors.New("connect addr property key required")
+		}
+		if len(factories) == 0 {
+			return errors.New("connect requires at least one handler factory")
+		}
+		for _, factory := range factories {
+			if factory == nil {
+				return errors.New("nil connect handler factory")
+			}
+		}
+
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		if ms.connectAddrKey != "" && ms.connectAddrKey != addrKey {
+			return errors.New("connect handlers already served on " + ms.connectAddrKey)
+		}
+		ms.connectAddrKey = addrKey
+		return ms.addHTTPModule(func(deps *Deps) (HTTPModule, error) {
+			module := &connectModule{}
+			for _, factory := range factories {
+				path, handler := factory(deps)
+				if path == "" || handler == nil {
+					return nil, errors.New("connect handler factory returned no handler")
+				}
+				module.handlers = append(module.handlers, connectHandler{path: path, handler: handler})
+			}
+			return module, nil
+		})
+	}
+}
+
+// finishConnect starts the HTTP server of the Connect handlers when none was
+// configured, and enables h2c on it.
+func (ms *Micro) finishConnect() error {
+	ms.mu.RLock()
+	addrKey, configured := ms.connectAddrKey, ms.httpConfigured
+	ms.mu.RUnlock()
+	if addrKey == "" {
+		return nil
+	}
+	if !configured {
+		if err := WithHTTPServer(addrKey)(ms); err != nil {
+			return err
+		}
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, runner := range ms.runners {
+		if server, ok := runner.(*httpServerRunner); ok {
+			protocols := new(http.Protocols)
+			protocols.SetHTTP1(true)
+			protocols.SetUnencryptedHTTP2(true)
+			server.server.Protocols = protocols
+		}
+	}
+	return nil
+}
+
+type connectHandler struct {
+	path    string
+	handler http.Handler
+}
+
+type connectModule struct {
+	handlers []connectHandler
+}
+
+func (m *connectModule) Name() string {
+	return ConnectModule
+}
+
+func (m *connectModule) RegisterRoutes(router chi.Router) {
+	for _, h := range m.handlers {
+		router.Mount(strings.TrimSuffix(h.path, "/"), h.handler)
+	}
+}
+
+// connectProtocol returns "grpc", "grpc-web" or "connect" for requests made
+// by Connect clients, or "" for other requests.
+func connectProtocol(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		return "grpc-web"
+	case strings.HasPrefix(contentType, "application/grpc"):
+		return "grpc"
+	case strings.HasPrefix(contentType, "application/connect+"), r.Header.Get("Connect-Protocol-Version") != "":
+		return "connect"
+	}
+	return ""
+}
+
+// ConnectErrorMiddleware rewrites error envelopes answered to Connect,
+// gRPC-Web and gRPC requests, typically by authentication or rate limiting
+// middleware, in the error format of the request protocol. Responses of
+// the Connect handlers themselves pass through. WithHTTPServer installs it.
+func ConnectErrorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocol := connectProtocol(r)
+		if protocol == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &connectErrorWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		cw.finish(protocol)
+	})
+}
+
+// connectErrorWriter buffers JSON error responses so they can be rewritten;
+// anything else is written through.
+type connectErrorWriter struct {
+	http.ResponseWriter
+	status    int
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (w *connectErrorWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.buffering = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *connectErrorWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffering {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *connectErrorWriter) Flush() {
+	if w.buffering {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *connectErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *connectErrorWriter) finish(protocol string) {
+	if !w.buffering {
+		return
+	}
+	var envelope ErrorResponse
+	if err := json.Unmarshal(w.buf.Bytes(), &envelope); err != nil || envelope.Error.Code == "" {
+		// Not the standard envelope, e.g. an error of the Connect handler.
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(w.buf.Bytes())
+		return
+	}
+	code := connectCode(envelope.Error.Code, w.status)
+	h := w.Header()
+	h.Del("Content-Length")
+	if protocol == "connect" {
+		body, _ := json.Marshal(map[string]string{"code": grpcCodeName(code.String()), "message": envelope.Error.Message})
+		h.Set("Content-Type", "application/json")
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(body)
+		return
+	}
+	// gRPC and gRPC-Web carry errors as a trailers-only response.
+	h.Set("Content-Type", "application/"+protocol)
+	h.Set("Grpc-Status", strconv.Itoa(int(code)))
+	h.Set("Grpc-Message", grpcPercentEncode(envelope.Error.Message))
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+// grpcPercentEncode encodes a Grpc-Message value as the gRPC spec requires:
+// bytes outside printable ASCII and '%' itself become %XX.
+func grpcPercentEncode(msg string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	return b.String()
+}
+
+// connectCode keeps envelope codes that already name a gRPC code, as
+// rendered by the gRPC gateway, and otherwise maps the HTTP status.
+func connectCode(envelopeCode string, status int) codes.Code {
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if grpcCodeName(code.String()) == envelopeCode {
+			return code
+		}
+	}
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
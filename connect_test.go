@@ -0,0 +1,165 @@
+package aqm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newConnectTestMicro(t *testing.T) *Micro {
+	t.Helper()
+	cfg := NewConfig()
+	cfg.Set("http.port", ":0")
+	cfg.Set("health.cache_ttl", "0s")
+
+	requireToken := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				Error(w, http.StatusUnauthorized, "unauthorized", "missing token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	users := func(*Deps) (string, http.Handler) {
+		return "/users.v1.UsersService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/users.v1.UsersService/Missing" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code":"not_found","message":"no such user"}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"ada"}`))
+		})
+	}
+
+	return NewMicro(
+		WithConfig(cfg),
+		WithLogger(NewNoopLogger()),
+		WithHTTPMiddleware(requireToken),
+		WithConnectHandlers("http.port", users),
+	)
+}
+
+func TestWithConnectHandlers(t *testing.T) {
+	ms := newConnectTestMicro(t)
+	if len(ms.runners) != 1 {
+		t.Fatalf("expected the http server runner, got %d runners", len(ms.runners))
+	}
+	if p := ms.runners[0].(*httpServerRunner).server.Protocols; p == nil || !p.UnencryptedHTTP2() || !p.HTTP1() {
+		t.Errorf("h2c not enabled: %v", p)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/users.v1.UsersService/Get", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	req.Header.Set("Authorization", "Bearer t")
+	rec := httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"name":"ada"}` {
+		t.Errorf("call = %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	rec = httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("shared healthz = %d", rec.Code)
+	}
+}
+
+func TestConnectErrorInterop(t *testing.T) {
+	ms := newConnectTestMicro(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/users.v1.UsersService/Get", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	rec := httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, req)
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusUnauthorized || body["code"] != "unauthenticated" || body["message"] != "missing token" {
+		t.Errorf("connect error = %d %v", rec.Code, body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/users.v1.UsersService/Get", nil)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	rec = httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Grpc-Status") != "16" || rec.Header().Get("Grpc-Message") != "missing token" {
+		t.Errorf("grpc-web error = %d %v", rec.Code, rec.Header())
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "application/grpc-web" {
+		t.Errorf("grpc-web error not trailers-only: %q %q", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/users.v1.UsersService/Missing", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	req.Header.Set("Authorization", "Bearer t")
+	rec = httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || rec.Body.String() != `{"code":"not_found","message":"no such user"}` {
+		t.Errorf("handler error rewritten: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users.v1.UsersService/Get", nil))
+	if !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("plain request lost the envelope: %s", rec.Body.String())
+	}
+}
+
+func TestConnectCode(t *testing.T) {
+	tests := []struct {
+		code   string
+		status int
+		want   string
+	}{
+		{"not_found", http.StatusBadRequest, "NotFound"},
+		{"invalid", http.StatusBadRequest, "InvalidArgument"},
+		{"Too Many Requests", http.StatusTooManyRequests, "ResourceExhausted"},
+		{"boom", http.StatusInternalServerError, "Internal"},
+		{"teapot", http.StatusTeapot, "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := connectCode(tt.code, tt.status).String(); got != tt.want {
+			t.Errorf("connectCode(%q, %d) = %s, want %s", tt.code, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestGRPCPercentEncode(t *testing.T) {
+	tests := map[string]string{
+		"missing token":       "missing token",
+		"a/b?c=d&e#f":         "a/b?c=d&e#f",
+		"100% done":           "100%25 done",
+		"line\nbreak":         "line%0Abreak",
+		"caf\u00e9":           "caf%C3%A9",
+		"tilde ~ and del\x7f": "tilde ~ and del%7F",
+	}
+	for in, want := range tests {
+		if got := grpcPercentEncode(in); got != want {
+			t.Errorf("grpcPercentEncode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWithConnectHandlersErrors(t *testing.T) {
+	users := func(*Deps) (string, http.Handler) { return "/u/", http.NotFoundHandler() }
+	for name, opt := range map[string]Option{
+		"no addr":     WithConnectHandlers("", users),
+		"no handlers": WithConnectHandlers("http.port"),
+		"nil handler": WithConnectHandlers("http.port", nil),
+	} {
+		if err := opt(&Micro{deps: DefaultDeps()}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package contract checks the HTTP contracts between aqm services. Consumers
+// record the requests they make and the response shapes they rely on;
+// providers declare endpoint schemas; Verify replays the recorded
+// expectations against a running provider so drift fails CI instead of
+// production.
+package contract
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Contract is the set of interactions a consumer expects from a provider.
+type Contract struct {
+	Consumer     string        `json:"consumer"`
+	Provider     string        `json:"provider"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one request and the response the consumer relies on.
+type Interaction struct {
+	Description string   `json:"description"`
+	Request     Request  `json:"request"`
+	Response    Response `json:"response"`
+}
+
+// Request describes the call made by the consumer.
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+// Response describes what the consumer expects back. Body is matched by
+// shape: every field present must exist in the actual response with the same
+// JSON type, and arrays match when each element matches the first expected
+// element. Extra fields in the actual response are allowed.
+type Response struct {
+	Status int `json:"status"`
+	Body   any `json:"body,omitempty"`
+}
+
+// Consumer records the interactions of a consumer with one provider.
+type Consumer struct {
+	contract Contract
+}
+
+// NewConsumer starts recording the contract between consumer and provider.
+func NewConsumer(consumer, provider string) *Consumer {
+	return &Consumer{contract: Contract{Consumer: consumer, Provider: provider}}
+}
+
+// InteractionBuilder adds an interaction to a Consumer.
+type InteractionBuilder struct {
+	consumer    *Consumer
+	interaction Interaction
+}
+
+// UponReceiving starts an interaction named description.
+func (c *Consumer) UponReceiving(description string) *InteractionBuilder {
+	return &InteractionBuilder{consumer: c, interaction: Interaction{Description: description}}
+}
+
+// WithRequest sets the method and path, including any query string.
+func (b *InteractionBuilder) WithRequest(method, path string) *InteractionBuilder {
+	b.interaction.Request.Method = strings.ToUpper(method)
+	b.interaction.Request.Path = path
+	return b
+}
+
+// WithHeader adds a request header sent during verification.
+func (b *InteractionBuilder) WithHeader(key, value string) *InteractionBuilder {
+	if b.interaction.Request.Headers == nil {
+		b.interaction.Request.Headers = make(map[string]string)
+	}
+	b.interaction.Request.Headers[key] = value
+	return b
+}
+
+// WithBody sets the JSON request body.
+func (b *InteractionBuilder) WithBody(body any) *InteractionBuilder {
+	b.interaction.Request.Body = normalize(body)
+	return b
+}
+
+// WillRespondWith records the expected status and body and adds the
+// interaction to the consumer contract.
+func (b *InteractionBuilder) WillRespondWith(status int, body any) *Consumer {
+	b.interaction.Response = Response{Status: status, Body: normalize(body)}
+	if b.interaction.Request.Method == "" {
+		b.interaction.Request.Method = http.MethodGet
+	}
+	b.consumer.contract.Interactions = append(b.consumer.contract.Interactions, b.interaction)
+	return b.consumer
+}
+
+// Contract returns the recorded contract.
+func (c *Consumer) Contract() Contract {
+	out := c.contract
+	out.Interactions = append([]Interaction(nil), c.contract.Interactions...)
+	return out
+}
+
+// FileName is the conventional file name, e.g. "web-tasks.json".
+func (c Contract) FileName() string {
+	return fmt.Sprintf("%s-%s.json", c.Consumer, c.Provider)
+}
+
+// Save writes the contract to dir as FileName, so consumer tests can publish
+// it for the provider build.
+func (c Contract) Save(dir string) (string, error) {
+	if c.Consumer == "" || c.Provider == "" {
+		return "", errors.New("contract: consumer and provider names required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("contract: create dir: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("contract: encode: %w", err)
+	}
+	path := filepath.Join(dir, c.FileName())
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("contract: write: %w", err)
+	}
+	return path, nil
+}
+
+// Load reads a contract saved with Save.
+func Load(path string) (Contract, error) {
+	var c Contract
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("contract: read: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("contract: decode %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// LoadDir reads every contract in dir whose provider is provider.
+func LoadDir(dir, provider string) ([]Contract, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*-"+provider+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("contract: list %s: %w", dir, err)
+	}
+	contracts := make([]Contract, 0, len(paths))
+	for _, path := range paths {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if c.Provider == provider {
+			contracts = append(contracts, c)
+		}
+	}
+	return contracts, nil
+}
+
+// normalize round-trips v through JSON so recorded values compare like
+// decoded responses (numbers become float64, structs become maps).
+func normalize(v any) any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+type task struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+func tasksConsumer() *Consumer {
+	return NewConsumer("web", "tasks").
+		UponReceiving("a task by id").
+		WithRequest(http.MethodGet, "/tasks/42").
+		WillRespondWith(http.StatusOK, map[string]any{"data": task{ID: "42", Title: "write docs"}}).
+		UponReceiving("the task list").
+		WithRequest(http.MethodGet, "/tasks?status=open").
+		WillRespondWith(http.StatusOK, map[string]any{"data": []task{{ID: "1", Title: "a"}}})
+}
+
+func tasksProvider() *Provider {
+	taskSchema := Object(map[string]*Schema{"id": String(), "title": String(), "done": Boolean()})
+	return NewProvider("tasks").
+		Get("/tasks/{id}", Envelope(taskSchema)).
+		Get("/tasks", Envelope(Array(taskSchema)))
+}
+
+func tasksHandler(titleAsNumber bool) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if titleAsNumber {
+			aqm.RespondSuccess(w, map[string]any{"id": chi.URLParam(r, "id"), "title": 7, "done": false})
+			return
+		}
+		aqm.RespondSuccess(w, task{ID: chi.URLParam(r, "id"), Title: "write docs"})
+	})
+	r.Get("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		aqm.RespondSuccess(w, []task{{ID: "1", Title: "a"}, {ID: "2", Title: "b", Done: true}})
+	})
+	return r
+}
+
+func TestVerifyHonouredContract(t *testing.T) {
+	VerifyHandler(t, tasksHandler(false), tasksProvider(), tasksConsumer().Contract())
+}
+
+func TestRunReportsDrift(t *testing.T) {
+	server := httptest.NewServer(tasksHandler(true))
+	defer server.Close()
+
+	report := Run(context.Background(), nil, server.URL, tasksProvider(), tasksConsumer().Contract())
+	if report.Checked != 2 || len(report.Failures) != 1 {
+		t.Fatalf("expected one failure out of two, got %+v", report)
+	}
+	failure := report.Failures[0]
+	if failure.Interaction != "a task by id" || !strings.Contains(failure.String(), "$.data.title: expected string, got number") {
+		t.Errorf("unexpected failure %s", failure)
+	}
+}
+
+func TestRunReportsUndeclaredEndpoint(t *testing.T) {
+	server := httptest.NewServer(tasksHandler(false))
+	defer server.Close()
+
+	report := Run(context.Background(), nil, server.URL, NewProvider("tasks"), tasksConsumer().Contract())
+	if len(report.Failures) != 2 || !strings.Contains(report.Failures[0].String(), "not declared") {
+		t.Errorf("expected undeclared endpoint failures, got %+v", report.Failures)
+	}
+}
+
+func TestConsumerServer(t *testing.T) {
+	server := tasksConsumer().Server()
+	defer server.Close()
+
+	client := aqm.NewServiceClient(server.URL)
+	resp, err := client.Get(context.Background(), "tasks", "42")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, _ := json.Marshal(resp.Data)
+	if !strings.Contains(string(data), `"write docs"`) {
+		t.Errorf("unexpected data %s", data)
+	}
+
+	if _, err := client.Get(context.Background(), "tasks", "missing"); err == nil {
+		t.Error("expected unrecorded interaction to fail")
+	}
+}
+
+func TestSaveAndLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	path, err := tasksConsumer().Contract().Save(dir)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if !strings.HasSuffix(path, "web-tasks.json") {
+		t.Errorf("unexpected path %s", path)
+	}
+	_, _ = NewConsumer("mobile", "billing").Contract().Save(dir)
+
+	contracts, err := LoadDir(dir, "tasks")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(contracts) != 1 || len(contracts[0].Interactions) != 2 {
+		t.Fatalf("unexpected contracts %+v", contracts)
+	}
+	VerifyHandler(t, tasksHandler(false), tasksProvider(), contracts...)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Object(map[string]*Schema{"id": String(), "tags": Array(String())})
+	tests := []struct {
+		name     string
+		value    any
+		problems int
+	}{
+		{name: "valid", value: map[string]any{"id": "1", "tags": []any{"a"}}},
+		{name: "missingField", value: map[string]any{"tags": []any{}}, problems: 1},
+		{name: "wrongItem", value: map[string]any{"id": "1", "tags": []any{"a", 2.0}}, problems: 1},
+		{name: "wrongType", value: []any{}, problems: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schema.Validate(tt.value); len(got) != tt.problems {
+				t.Errorf("expected %d problems, got %v", tt.problems, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package contract
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema providers use to declare response
+// bodies: a type, object properties with required fields, and array items.
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+}
+
+// Object builds an object schema. Every listed property is required.
+func Object(properties map[string]*Schema) *Schema {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// Array builds an array schema.
+func Array(items *Schema) *Schema { return &Schema{Type: "array", Items: items} }
+
+// String, Number, Boolean and Any build scalar schemas.
+func String() *Schema  { return &Schema{Type: "string"} }
+func Number() *Schema  { return &Schema{Type: "number"} }
+func Boolean() *Schema { return &Schema{Type: "boolean"} }
+func Any() *Schema     { return &Schema{} }
+
+// Envelope wraps data in the aqm success envelope {"data": ...}.
+func Envelope(data *Schema) *Schema {
+	return Object(map[string]*Schema{"data": data})
+}
+
+// Validate returns the paths at which v violates the schema.
+func (s *Schema) Validate(v any) []string {
+	var problems []string
+	s.validate("$", v, &problems)
+	return problems
+}
+
+func (s *Schema) validate(path string, v any, problems *[]string) {
+	if s == nil || s.Type == "" {
+		return
+	}
+	if got := jsonType(v); got != s.Type {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, s.Type, got))
+		return
+	}
+	switch s.Type {
+	case "object":
+		obj := v.(map[string]any)
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: required field missing", path, name))
+			}
+		}
+		for name, prop := range s.Properties {
+			if value, ok := obj[name]; ok {
+				prop.validate(path+"."+name, value, problems)
+			}
+		}
+	case "array":
+		for i, item := range v.([]any) {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+	}
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Endpoint is a provider route with its declared response schema.
+type Endpoint struct {
+	Method   string
+	Pattern  string
+	Status   int
+	Response *Schema
+}
+
+// Provider declares the endpoints a service offers.
+type Provider struct {
+	Name      string
+	Endpoints []Endpoint
+}
+
+// NewProvider starts declaring the endpoints of the named service.
+func NewProvider(name string) *Provider {
+	return &Provider{Name: name}
+}
+
+// Declare adds an endpoint. Pattern uses chi syntax, e.g. /tasks/{id}.
+func (p *Provider) Declare(method, pattern string, status int, response *Schema) *Provider {
+	p.Endpoints = append(p.Endpoints, Endpoint{Method: strings.ToUpper(method), Pattern: pattern, Status: status, Response: response})
+	return p
+}
+
+// Get declares a GET endpoint answering 200.
+func (p *Provider) Get(pattern string, response *Schema) *Provider {
+	return p.Declare(http.MethodGet, pattern, http.StatusOK, response)
+}
+
+// Post declares a POST endpoint answering 201.
+func (p *Provider) Post(pattern string, response *Schema) *Provider {
+	return p.Declare(http.MethodPost, pattern, http.StatusCreated, response)
+}
+
+// Lookup finds the endpoint matching method and path (query ignored).
+func (p *Provider) Lookup(method, path string) (Endpoint, bool) {
+	if p == nil {
+		return Endpoint{}, false
+	}
+	path, _, _ = strings.Cut(path, "?")
+	for _, ep := range p.Endpoints {
+		if ep.Method == strings.ToUpper(method) && matchPattern(ep.Pattern, path) {
+			return ep, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+func matchPattern(pattern, path string) bool {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range want {
+		if segment == "*" {
+			return true
+		}
+		if i >= len(got) {
+			return false
+		}
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			continue
+		}
+		if segment != got[i] {
+			return false
+		}
+	}
+	return len(want) == len(got)
+}
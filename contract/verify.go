@@ -0,0 +1,186 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Failure is an interaction the provider did not honour.
+type Failure struct {
+	Consumer    string
+	Interaction string
+	Problems    []string
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Consumer, f.Interaction, strings.Join(f.Problems, "; "))
+}
+
+// Report collects the verification failures.
+type Report struct {
+	Checked  int
+	Failures []Failure
+}
+
+// OK reports whether every interaction was honoured.
+func (r Report) OK() bool { return len(r.Failures) == 0 }
+
+// Run replays every interaction of contracts against the provider at baseURL
+// and checks status and body shape, plus the provider declared schema when
+// provider is not nil. A nil client uses http.DefaultClient.
+func Run(ctx context.Context, client *http.Client, baseURL string, provider *Provider, contracts ...Contract) Report {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var report Report
+	for _, c := range contracts {
+		for _, interaction := range c.Interactions {
+			report.Checked++
+			problems := verifyInteraction(ctx, client, baseURL, provider, interaction)
+			if len(problems) > 0 {
+				report.Failures = append(report.Failures, Failure{Consumer: c.Consumer, Interaction: interaction.Description, Problems: problems})
+			}
+		}
+	}
+	return report
+}
+
+// Verify runs the contracts against baseURL and fails t for every
+// interaction the provider breaks.
+func Verify(t testing.TB, baseURL string, provider *Provider, contracts ...Contract) {
+	t.Helper()
+	report := Run(context.Background(), nil, baseURL, provider, contracts...)
+	for _, failure := range report.Failures {
+		t.Errorf("contract broken: %s", failure)
+	}
+}
+
+// VerifyHandler serves handler with httptest and verifies it like Verify.
+func VerifyHandler(t testing.TB, handler http.Handler, provider *Provider, contracts ...Contract) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	Verify(t, server.URL, provider, contracts...)
+}
+
+func verifyInteraction(ctx context.Context, client *http.Client, baseURL string, provider *Provider, interaction Interaction) []string {
+	req, err := newRequest(ctx, baseURL, interaction.Request)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return []string{fmt.Sprintf("request failed: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	var problems []string
+	if resp.StatusCode != interaction.Response.Status {
+		problems = append(problems, fmt.Sprintf("status: expected %d, got %d", interaction.Response.Status, resp.StatusCode))
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return append(problems, fmt.Sprintf("read body: %v", err))
+	}
+	var body any
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return append(problems, fmt.Sprintf("body is not JSON: %v", err))
+		}
+	}
+
+	if interaction.Response.Body != nil {
+		problems = append(problems, matchShape("$", interaction.Response.Body, body)...)
+	}
+	if ep, ok := provider.Lookup(interaction.Request.Method, interaction.Request.Path); ok && ep.Status == resp.StatusCode {
+		for _, problem := range ep.Response.Validate(body) {
+			problems = append(problems, "schema "+problem)
+		}
+	} else if provider != nil && !ok {
+		problems = append(problems, fmt.Sprintf("endpoint %s %s not declared by provider %s", interaction.Request.Method, interaction.Request.Path, provider.Name))
+	}
+	return problems
+}
+
+func newRequest(ctx context.Context, baseURL string, r Request) (*http.Request, error) {
+	var body io.Reader
+	if r.Body != nil {
+		data, err := json.Marshal(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, strings.TrimRight(baseURL, "/")+r.Path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range r.Headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// matchShape compares actual against the shape of expected.
+func matchShape(path string, expected, actual any) []string {
+	if expected == nil {
+		return nil
+	}
+	if want, got := jsonType(expected), jsonType(actual); want != got {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, want, got)}
+	}
+	var problems []string
+	switch want := expected.(type) {
+	case map[string]any:
+		got := actual.(map[string]any)
+		for key, value := range want {
+			field, ok := got[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: missing", path, key))
+				continue
+			}
+			problems = append(problems, matchShape(path+"."+key, value, field)...)
+		}
+	case []any:
+		if len(want) == 0 {
+			return nil
+		}
+		for i, item := range actual.([]any) {
+			problems = append(problems, matchShape(fmt.Sprintf("%s[%d]", path, i), want[0], item)...)
+		}
+	}
+	return problems
+}
+
+// Server serves the recorded interactions, so consumer tests exercise their
+// client against exactly the expectations they publish. Unrecorded requests
+// get 501.
+func (c *Consumer) Server() *httptest.Server {
+	contract := c.Contract()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, interaction := range contract.Interactions {
+			if interaction.Request.Method != r.Method || interaction.Request.Path != r.URL.RequestURI() {
+				continue
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(interaction.Response.Status)
+			if interaction.Response.Body != nil {
+				json.NewEncoder(w).Encode(interaction.Response.Body)
+			}
+			return
+		}
+		http.Error(w, fmt.Sprintf("no interaction recorded for %s %s", r.Method, r.URL.RequestURI()), http.StatusNotImplemented)
+	}))
+}
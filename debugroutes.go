@@ -13,24 +13,55 @@ import (
 type RouteInfo struct {
 	Method      string   `json:"method"`
 	Pattern     string   `json:"pattern"`
+	Module      string   `json:"module,omitempty"`
 	Middlewares []string `json:"middlewares,omitempty"`
 }
 
 // RegisterDebugRoutes exposes GET /debug/routes when enabled. The endpoint
 // lists every route currently registered on the router.
 func RegisterDebugRoutes(r chi.Router, enabled bool) {
+	registerDebugRoutes(r, enabled, func() []RouteInfo { return enumerateRoutes(r) })
+}
+
+func registerDebugRoutes(r chi.Router, enabled bool, list func() []RouteInfo) {
 	if !enabled || r == nil {
 		return
 	}
 
 	r.Get("/debug/routes", func(w http.ResponseWriter, req *http.Request) {
-		routes := enumerateRoutes(r)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(routes)
+		json.NewEncoder(w).Encode(list())
+	})
+}
+
+// RegisterDebugConfig exposes GET /debug/config when enabled. The endpoint
+// returns the effective configuration with sensitive values redacted, as JSON
+// by default or YAML with ?format=yaml.
+func RegisterDebugConfig(r chi.Router, cfg *Config, enabled bool) {
+	if !enabled || r == nil || cfg == nil {
+		return
+	}
+
+	r.Get("/debug/config", func(w http.ResponseWriter, req *http.Request) {
+		format := req.URL.Query().Get("format")
+		if format == "" {
+			format = ConfigFormatJSON
+		}
+		body, err := cfg.Export(format, nil)
+		if err != nil {
+			RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		contentType := "application/json"
+		if format != ConfigFormatJSON {
+			contentType = "application/yaml"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
 	})
 }
 
-func enumerateRoutes(r chi.Router) []RouteInfo {
+func enumerateRoutes(r chi.Routes) []RouteInfo {
 	routes := make([]RouteInfo, 0)
 	_ = chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
 		info := RouteInfo{Method: method, Pattern: route}
@@ -126,3 +126,40 @@ func TestRouteInfoFields(t *testing.T) {
 		t.Errorf("expected 2 middlewares, got %d", len(info.Middlewares))
 	}
 }
+
+func TestDebugRoutesFollowProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		optIn   bool
+		want    int
+	}{
+		{name: "noProfile", want: http.StatusNotFound},
+		{name: "staging", profile: ProfileStaging, want: http.StatusNotFound},
+		{name: "dev", profile: ProfileDev, want: http.StatusOK},
+		{name: "prod", profile: ProfileProd, want: http.StatusNotFound},
+		{name: "noProfileOptIn", optIn: true, want: http.StatusOK},
+		{name: "stagingOptIn", profile: ProfileStaging, optIn: true, want: http.StatusOK},
+		{name: "prodOptIn", profile: ProfileProd, optIn: true, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.SetProfile(tt.profile)
+			opts := []Option{WithConfig(cfg), WithLogger(NewNoopLogger())}
+			if tt.optIn {
+				opts = append(opts, WithDebugRoutes())
+			}
+			ms := NewMicro(append(opts, WithHTTPServer("http.port"))...)
+
+			for _, path := range []string{"/debug/routes", "/debug/config"} {
+				rec := httptest.NewRecorder()
+				ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != tt.want {
+					t.Errorf("%s: expected %d, got %d", path, tt.want, rec.Code)
+				}
+			}
+		})
+	}
+}
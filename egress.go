@@ -0,0 +1,214 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+// ErrEgressBlocked is matched by the errors returned for requests refused by
+// an EgressPolicy.
+var ErrEgressBlocked = errors.New("egress blocked")
+
+// EgressBlockedError describes a refused request.
+type EgressBlockedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *EgressBlockedError) Error() string {
+	return fmt.Sprintf("egress blocked: %s: %s", e.URL, e.Reason)
+}
+
+// Is matches ErrEgressBlocked.
+func (e *EgressBlockedError) Is(target error) bool { return target == ErrEgressBlocked }
+
+// blockedPrefixes are never dialled unless listed in AllowedCIDRs: private,
+// loopback, link-local (including the 169.254.169.254 metadata service),
+// shared, benchmarking, multicast and reserved ranges, plus the IPv6
+// translation and tunnelling ranges (NAT64, 6to4, Teredo) that can embed any
+// IPv4 address.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// EgressPolicy guards requests whose URLs come from user input, such as
+// webhook targets or imports, against server-side request forgery. Set it
+// on HTTPClientConfig.Egress: every request and redirect is checked for
+// scheme, port and host, and the address is checked again after DNS
+// resolution, right before connecting, so rebinding tricks do not get past
+// it. Proxies are disabled on guarded clients since the proxy would resolve
+// the host instead.
+type EgressPolicy struct {
+	// AllowedSchemes defaults to https only.
+	AllowedSchemes []string
+	// AllowedPorts defaults to 443, plus 80 when http is allowed.
+	AllowedPorts []int
+	// AllowedHosts, when set, limits requests to these hosts. "*.example.com"
+	// matches subdomains of example.com.
+	AllowedHosts []string
+	// AllowedCIDRs are exceptions to the blocked ranges, e.g. a partner on a
+	// peered network.
+	AllowedCIDRs []netip.Prefix
+	// Events records an egress.blocked security event for every refusal.
+	Events *auth.SecurityEvents
+}
+
+// CheckURL validates the scheme, port and host of u. Literal IPs are checked
+// against the blocked ranges; names are checked when dialled.
+func (p *EgressPolicy) CheckURL(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if !slices.Contains(p.schemes(), scheme) {
+		return p.blocked(u.Redacted(), "scheme "+scheme+" is not allowed")
+	}
+	if u.User != nil {
+		return p.blocked(u.Redacted(), "credentials in URL are not allowed")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return p.blocked(u.Redacted(), "missing host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[scheme]
+	}
+	if n, err := strconv.Atoi(port); err != nil || !slices.Contains(p.ports(), n) {
+		return p.blocked(u.Redacted(), "port "+port+" is not allowed")
+	}
+	if len(p.AllowedHosts) > 0 && !p.hostAllowed(host) {
+		return p.blocked(u.Redacted(), "host "+host+" is not allowed")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if reason := p.addrReason(addr); reason != "" {
+			return p.blocked(u.Redacted(), reason)
+		}
+	}
+	return nil
+}
+
+// CheckAddr validates a resolved address before it is dialled.
+func (p *EgressPolicy) CheckAddr(addr netip.Addr) error {
+	if reason := p.addrReason(addr); reason != "" {
+		return p.blocked(addr.String(), reason)
+	}
+	return nil
+}
+
+func (p *EgressPolicy) addrReason(addr netip.Addr) string {
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range p.AllowedCIDRs {
+		if prefix.Contains(addr) {
+			return ""
+		}
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return "address " + addr.String() + " is in blocked range " + prefix.String()
+		}
+	}
+	return ""
+}
+
+func (p *EgressPolicy) hostAllowed(host string) bool {
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *EgressPolicy) schemes() []string {
+	if len(p.AllowedSchemes) == 0 {
+		return []string{"https"}
+	}
+	return p.AllowedSchemes
+}
+
+func (p *EgressPolicy) ports() []int {
+	if len(p.AllowedPorts) > 0 {
+		return p.AllowedPorts
+	}
+	if slices.Contains(p.schemes(), "http") {
+		return []int{80, 443}
+	}
+	return []int{443}
+}
+
+func (p *EgressPolicy) blocked(target, reason string) error {
+	return &EgressBlockedError{URL: target, Reason: reason}
+}
+
+func (p *EgressPolicy) record(ctx context.Context, err error) {
+	var blocked *EgressBlockedError
+	if p.Events == nil || !errors.As(err, &blocked) {
+		return
+	}
+	ev := auth.SecurityEvent{Type: auth.SecurityEgressBlocked, Resource: blocked.URL, Reason: blocked.Reason}
+	if recErr := p.Events.Record(ctx, ev); recErr != nil {
+		LoggerFrom(ctx).Error("cannot record egress event", "error", recErr)
+	}
+}
+
+// control is a net.Dialer.ControlContext that refuses blocked addresses.
+func (p *EgressPolicy) control(ctx context.Context, _, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return p.blocked(address, "unparsable address")
+	}
+	if err := p.CheckAddr(addrPort.Addr()); err != nil {
+		p.record(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// egressTransport checks every request, redirects included, against policy.
+type egressTransport struct {
+	base   http.RoundTripper
+	policy *EgressPolicy
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(req.URL); err != nil {
+		t.policy.record(req.Context(), err)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
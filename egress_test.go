@@ -0,0 +1,112 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+func TestEgressPolicyCheckURL(t *testing.T) {
+	policy := &EgressPolicy{AllowedHosts: []string{"*.example.com", "api.partner.io", "203.0.113.10"}}
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://hooks.example.com/in", true},
+		{"https://api.partner.io/v1", true},
+		{"https://203.0.113.10/", true},
+		{"https://example.com/", false},
+		{"http://hooks.example.com/", false},
+		{"https://hooks.example.com:8443/", false},
+		{"https://user:pw@hooks.example.com/", false},
+		{"file:///etc/passwd", false},
+		{"https://evil.io/", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		err := policy.CheckURL(u)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckURL(%s) = %v, allowed %v", tt.url, err, tt.allowed)
+		}
+	}
+
+	open := &EgressPolicy{}
+	for _, raw := range []string{
+		"https://127.0.0.1/", "https://10.1.2.3/", "https://169.254.169.254/", "https://[::1]/",
+		"https://[::ffff:192.168.0.1]/", "https://[fd00:ec2::254]/", "https://100.64.0.1/",
+		"https://[2002:7f00:1::]/", "https://[2001:0:4136:e378:8000:63bf:3fff:fdd2]/",
+		"https://[64:ff9b:1::a9fe:a9fe]/", "https://[64:ff9b::7f00:1]/",
+	} {
+		u, _ := url.Parse(raw)
+		if err := open.CheckURL(u); !errors.Is(err, ErrEgressBlocked) {
+			t.Errorf("CheckURL(%s) = %v, want blocked", raw, err)
+		}
+	}
+	exception := &EgressPolicy{AllowedCIDRs: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}}
+	if err := exception.CheckAddr(netip.MustParseAddr("10.1.2.3")); err != nil {
+		t.Errorf("allowed CIDR blocked: %v", err)
+	}
+}
+
+func TestHTTPClientEgressGuard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	port, _ := strconv.Atoi(srv.URL[len("http://127.0.0.1:"):])
+
+	var mu sync.Mutex
+	var events []auth.SecurityEvent
+	sink := auth.SecuritySinkFunc(func(_ context.Context, ev auth.SecurityEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, ev)
+		return nil
+	})
+	policy := &EgressPolicy{
+		AllowedSchemes: []string{"http"},
+		AllowedPorts:   []int{port, 80},
+		Events:         auth.NewSecurityEvents(auth.WithSecuritySink(sink)),
+	}
+	newClient := func(base string) *HTTPClient {
+		return NewHTTPClient(HTTPClientConfig{BaseURL: base, MaxRetries: 2, RetryDelay: time.Second, Egress: policy})
+	}
+
+	// The host name passes the URL check and is refused once resolved.
+	start := time.Now()
+	err := newClient("http://localhost:"+strconv.Itoa(port)).Get(context.Background(), "/", nil)
+	if !errors.Is(err, ErrEgressBlocked) {
+		t.Fatalf("resolved loopback: err = %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("blocked request was retried")
+	}
+
+	policy.AllowedCIDRs = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	if err := newClient(srv.URL).Get(context.Background(), "/", nil); err != nil {
+		t.Fatalf("allowed address: %v", err)
+	}
+	if err := newClient(srv.URL).Get(context.Background(), "/redirect", nil); !errors.Is(err, ErrEgressBlocked) {
+		t.Fatalf("redirect to metadata: err = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// localhost may resolve to both ::1 and 127.0.0.1, one event each.
+	if len(events) < 2 || events[0].Type != auth.SecurityEgressBlocked || events[len(events)-1].Resource != "http://169.254.169.254/latest/meta-data" {
+		t.Errorf("events = %+v", events)
+	}
+}
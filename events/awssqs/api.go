@@ -0,0 +1,136 @@
+package awssqs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const snsAPIVersion = "2010-03-31"
+
+// APIError is an error answered by SQS or SNS.
+type APIError struct {
+	Service    string
+	Action     string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("awssqs: %s %s: %s: %s", e.Service, e.Action, e.Code, e.Message)
+}
+
+// endpoint returns the base URL of service in region, or the configured
+// endpoint, e.g. LocalStack's http://localhost:4566.
+func (c *Client) endpoint(service, region string) string {
+	if c.cfg.Endpoint != "" {
+		return c.cfg.Endpoint
+	}
+	return "https://" + service + "." + region + ".amazonaws.com/"
+}
+
+// callSQS invokes action with the SQS JSON protocol.
+func (c *Client) callSQS(ctx context.Context, action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("sqs", c.cfg.Region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	data, status, err := c.do(req, c.cfg.Region, "sqs")
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+			Upper   string `json:"Message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		code := apiErr.Type
+		if i := strings.LastIndexAny(code, "#."); i >= 0 {
+			code = code[i+1:]
+		}
+		return &APIError{Service: "sqs", Action: action, StatusCode: status, Code: code, Message: apiErr.Message + apiErr.Upper}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// callSNS invokes action with the SNS Query protocol in region.
+func (c *Client) callSNS(ctx context.Context, region, action string, form url.Values, out any) error {
+	form.Set("Action", action)
+	form.Set("Version", snsAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("sns", region), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	data, status, err := c.do(req, region, "sns")
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		var apiErr struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+		xml.Unmarshal(data, &apiErr)
+		return &APIError{Service: "sns", Action: action, StatusCode: status, Code: apiErr.Error.Code, Message: apiErr.Error.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, out)
+}
+
+func (c *Client) do(req *http.Request, region, service string) ([]byte, int, error) {
+	if err := sign(req, c.cfg.Credentials, region, service, time.Now()); err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, resp.StatusCode, nil
+}
+
+type batchResultError struct {
+	ID          string `json:"Id"`
+	Code        string `json:"Code"`
+	Message     string `json:"Message"`
+	SenderFault bool   `json:"SenderFault"`
+}
+
+type batchResult struct {
+	Failed []batchResultError `json:"Failed"`
+}
+
+type sqsMessage struct {
+	MessageID     string            `json:"MessageId"`
+	ReceiptHandle string            `json:"ReceiptHandle"`
+	Body          string            `json:"Body"`
+	Attributes    map[string]string `json:"Attributes"`
+}
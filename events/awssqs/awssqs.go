@@ -0,0 +1,555 @@
+// Package awssqs implements the events interfaces on AWS managed queues:
+// Publish sends to an SQS queue or an SNS topic, and Subscribe long-polls
+// an SQS queue, extending the visibility timeout while handlers run and
+// deleting handled messages in batches. Requests are signed with AWS
+// Signature Version 4, and a custom endpoint points the client at
+// LocalStack for tests.
+package awssqs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+var (
+	_ events.Publisher      = (*Client)(nil)
+	_ events.BatchPublisher = (*Client)(nil)
+	_ events.Subscriber     = (*Client)(nil)
+)
+
+const (
+	maxBatch                 = 10 // SQS batch and receive limit
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultWaitTime          = 20 * time.Second
+	defaultRetryBackoff      = time.Second
+	defaultMaxRetryBackoff   = 5 * time.Minute
+	maxPollBackoff           = 30 * time.Second
+)
+
+// Credentials are static AWS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Config locates and authenticates the AWS services.
+type Config struct {
+	Region      string
+	Credentials Credentials
+	// Endpoint replaces the AWS endpoints, e.g. http://localhost:4566 for
+	// LocalStack.
+	Endpoint string
+}
+
+// ConfigFrom reads aws.region, aws.endpoint, aws.access_key_id,
+// aws.secret_access_key and aws.session_token, falling back to the
+// standard AWS_* environment variables.
+func ConfigFrom(cfg *aqm.Config) Config {
+	get := func(key string, envs ...string) string {
+		if cfg != nil {
+			if value, ok := cfg.GetString(key); ok && value != "" {
+				return value
+			}
+		}
+		for _, env := range envs {
+			if value := os.Getenv(env); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	return Config{
+		Region:   get("aws.region", "AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint: get("aws.endpoint", "AWS_ENDPOINT_URL"),
+		Credentials: Credentials{
+			AccessKeyID:     get("aws.access_key_id", "AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: get("aws.secret_access_key", "AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    get("aws.session_token", "AWS_SESSION_TOKEN"),
+		},
+	}
+}
+
+// Option configures the Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client; its timeout must exceed the long
+// polling wait time.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		if client != nil {
+			c.httpClient = client
+		}
+	}
+}
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(c *Client) {
+		if logger != nil {
+			c.log = logger
+		}
+	}
+}
+
+// WithMiddleware wraps every subscribed handler, e.g. with
+// events.Codec.Handler adapters or logging.
+func WithMiddleware(middlewares ...events.Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithVisibilityTimeout sets how long a received message stays hidden
+// (default 30s); it is extended while the handler runs.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= time.Second {
+			c.visibility = d
+		}
+	}
+}
+
+// WithWaitTime sets the long polling wait, at most 20s (the default).
+func WithWaitTime(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= 0 && d <= defaultWaitTime {
+			c.waitTime = d
+		}
+	}
+}
+
+// WithMaxMessages sets how many messages one receive returns and are
+// handled concurrently, at most 10 (the default).
+func WithMaxMessages(n int) Option {
+	return func(c *Client) {
+		if n > 0 && n <= maxBatch {
+			c.maxMessages = n
+		}
+	}
+}
+
+// WithRetryBackoff sets how long a failed message stays hidden before it
+// is redelivered, doubling with each receive from initial up to max.
+func WithRetryBackoff(initial, max time.Duration) Option {
+	return func(c *Client) {
+		if initial >= time.Second {
+			c.retryBackoff = initial
+		}
+		if max >= c.retryBackoff {
+			c.maxRetryBackoff = max
+		}
+	}
+}
+
+// WithMessageGroupID chooses the message group of messages sent to FIFO
+// queues and topics (names ending in .fifo); by default all messages of a
+// topic share one group.
+func WithMessageGroupID(fn func(topic string, msg []byte) string) Option {
+	return func(c *Client) {
+		if fn != nil {
+			c.groupID = fn
+		}
+	}
+}
+
+// WithConfig reads the aws.sqs.* tunables: visibility_timeout, wait_time,
+// max_messages, retry_backoff and max_retry_backoff.
+func WithConfig(cfg *aqm.Config) Option {
+	return func(c *Client) {
+		if cfg == nil {
+			return
+		}
+		WithVisibilityTimeout(cfg.GetDurationOrDef("aws.sqs.visibility_timeout", c.visibility))(c)
+		WithWaitTime(cfg.GetDurationOrDef("aws.sqs.wait_time", c.waitTime))(c)
+		WithMaxMessages(cfg.GetIntOrDef("aws.sqs.max_messages", c.maxMessages))(c)
+		WithRetryBackoff(cfg.GetDurationOrDef("aws.sqs.retry_backoff", c.retryBackoff),
+			cfg.GetDurationOrDef("aws.sqs.max_retry_backoff", c.maxRetryBackoff))(c)
+	}
+}
+
+// Client publishes to and subscribes on SQS queues and SNS topics. Topics
+// are queue names, queue URLs or SNS topic ARNs; only queues can be
+// subscribed to.
+type Client struct {
+	cfg             Config
+	httpClient      *http.Client
+	log             aqm.Logger
+	middlewares     []events.Middleware
+	visibility      time.Duration
+	waitTime        time.Duration
+	maxMessages     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	groupID         func(topic string, msg []byte) string
+
+	mu        sync.Mutex
+	queueURLs map[string]string
+	wg        sync.WaitGroup
+}
+
+// New builds a client. Region and credentials are required.
+func New(cfg Config, opts ...Option) (*Client, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("awssqs: region required")
+	}
+	if cfg.Credentials.AccessKeyID == "" || cfg.Credentials.SecretAccessKey == "" {
+		return nil, errors.New("awssqs: credentials required")
+	}
+	c := &Client{
+		cfg:             cfg,
+		httpClient:      &http.Client{Timeout: defaultWaitTime + 10*time.Second},
+		log:             aqm.NewNoopLogger(),
+		visibility:      defaultVisibilityTimeout,
+		waitTime:        defaultWaitTime,
+		maxMessages:     maxBatch,
+		retryBackoff:    defaultRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+		groupID:         func(topic string, _ []byte) string { return topic },
+		queueURLs:       make(map[string]string),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c, nil
+}
+
+// Publish implements events.Publisher, sending msg to the SQS queue or SNS
+// topic named by topic.
+func (c *Client) Publish(ctx context.Context, topic string, msg []byte) error {
+	if region, ok := snsRegion(topic); ok {
+		return c.publishSNS(ctx, region, topic, msg)
+	}
+	queueURL, err := c.queueURL(ctx, topic)
+	if err != nil {
+		return err
+	}
+	in := map[string]any{"QueueUrl": queueURL, "MessageBody": string(msg)}
+	c.addFIFO(in, queueURL, topic, msg)
+	return c.callSQS(ctx, "SendMessage", in, nil)
+}
+
+// BatchPublish implements events.BatchPublisher. SQS messages are sent ten
+// per request; SNS messages one at a time. Failed messages are reported as
+// joined *events.PublishError values.
+func (c *Client) BatchPublish(ctx context.Context, topic string, msgs [][]byte) error {
+	if _, ok := snsRegion(topic); ok {
+		var errs []error
+		for i, msg := range msgs {
+			if err := c.Publish(ctx, topic, msg); err != nil {
+				errs = append(errs, &events.PublishError{Topic: topic, Index: i, Err: err})
+			}
+		}
+		return errors.Join(errs...)
+	}
+	queueURL, err := c.queueURL(ctx, topic)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for start := 0; start < len(msgs); start += maxBatch {
+		end := min(start+maxBatch, len(msgs))
+		entries := make([]map[string]any, 0, end-start)
+		for i := start; i < end; i++ {
+			entry := map[string]any{"Id": strconv.Itoa(i), "MessageBody": string(msgs[i])}
+			c.addFIFO(entry, queueURL, topic, msgs[i])
+			entries = append(entries, entry)
+		}
+		var result batchResult
+		if err := c.callSQS(ctx, "SendMessageBatch", map[string]any{"QueueUrl": queueURL, "Entries": entries}, &result); err != nil {
+			for i := start; i < end; i++ {
+				errs = append(errs, &events.PublishError{Topic: topic, Index: i, Err: err})
+			}
+			continue
+		}
+		for _, failed := range result.Failed {
+			index, _ := strconv.Atoi(failed.ID)
+			errs = append(errs, &events.PublishError{Topic: topic, Index: index, Err: fmt.Errorf("%s: %s", failed.Code, failed.Message)})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) publishSNS(ctx context.Context, region, topicARN string, msg []byte) error {
+	form := url.Values{"TopicArn": {topicARN}, "Message": {string(msg)}}
+	if strings.HasSuffix(topicARN, ".fifo") {
+		form.Set("MessageGroupId", c.groupID(topicARN, msg))
+		form.Set("MessageDeduplicationId", deduplicationID(msg))
+	}
+	return c.callSNS(ctx, region, "Publish", form, nil)
+}
+
+func (c *Client) addFIFO(in map[string]any, queueURL, topic string, msg []byte) {
+	if strings.HasSuffix(queueURL, ".fifo") {
+		in["MessageGroupId"] = c.groupID(topic, msg)
+		in["MessageDeduplicationId"] = deduplicationID(msg)
+	}
+}
+
+// Subscribe implements events.Subscriber. It resolves the queue named by
+// topic and long-polls it until ctx is done. Messages of one receive are
+// handled concurrently, their visibility extended while the handler runs,
+// and the handled ones deleted in one batch. A failed message becomes
+// visible again after the retry backoff; once its receive count reaches
+// the maxReceiveCount of the queue redrive policy, SQS moves it to the
+// dead-letter queue and the failure is logged as such.
+func (c *Client) Subscribe(ctx context.Context, topic string, handler events.HandlerFunc) error {
+	if handler == nil {
+		return errors.New("awssqs: nil handler")
+	}
+	if _, ok := snsRegion(topic); ok {
+		return errors.New("awssqs: subscribe to the SQS queue subscribed to the SNS topic")
+	}
+	queueURL, err := c.queueURL(ctx, topic)
+	if err != nil {
+		return err
+	}
+	redrive, err := c.redrivePolicy(ctx, queueURL)
+	if err != nil {
+		return err
+	}
+	handler = events.Chain(handler, c.middlewares...)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.poll(ctx, queueURL, redrive, handler)
+	}()
+	return nil
+}
+
+// Wait blocks until the subscriptions stopped after their context ended,
+// including the handlers still running.
+func (c *Client) Wait() {
+	c.wg.Wait()
+}
+
+type redrivePolicy struct {
+	deadLetterTarget string
+	maxReceiveCount  int
+}
+
+func (c *Client) poll(ctx context.Context, queueURL string, redrive redrivePolicy, handler events.HandlerFunc) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		var out struct {
+			Messages []sqsMessage `json:"Messages"`
+		}
+		err := c.callSQS(ctx, "ReceiveMessage", map[string]any{
+			"QueueUrl":                    queueURL,
+			"MaxNumberOfMessages":         c.maxMessages,
+			"WaitTimeSeconds":             int(c.waitTime / time.Second),
+			"VisibilityTimeout":           int(c.visibility / time.Second),
+			"AttributeNames":              []string{"ApproximateReceiveCount"},
+			"MessageSystemAttributeNames": []string{"ApproximateReceiveCount"},
+		}, &out)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.log.Error("awssqs: receive failed", "queue", queueURL, "error", err)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, maxPollBackoff)
+			continue
+		}
+		backoff = time.Second
+
+		handled := make([]bool, len(out.Messages))
+		var wg sync.WaitGroup
+		for i, msg := range out.Messages {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handled[i] = c.handle(ctx, queueURL, redrive, msg, handler)
+			}()
+		}
+		wg.Wait()
+
+		var entries []map[string]any
+		for i, ok := range handled {
+			if ok {
+				entries = append(entries, map[string]any{"Id": strconv.Itoa(i), "ReceiptHandle": out.Messages[i].ReceiptHandle})
+			}
+		}
+		if len(entries) > 0 {
+			// Handled messages are deleted even when ctx ended meanwhile.
+			deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			var result batchResult
+			if err := c.callSQS(deleteCtx, "DeleteMessageBatch", map[string]any{"QueueUrl": queueURL, "Entries": entries}, &result); err != nil {
+				c.log.Error("awssqs: delete failed", "queue", queueURL, "messages", len(entries), "error", err)
+			}
+			for _, failed := range result.Failed {
+				c.log.Error("awssqs: delete failed", "queue", queueURL, "entry", failed.ID, "code", failed.Code, "error", failed.Message)
+			}
+			cancel()
+		}
+	}
+}
+
+// handle runs handler for msg, extending its visibility meanwhile, and
+// reports whether the message can be deleted.
+func (c *Client) handle(ctx context.Context, queueURL string, redrive redrivePolicy, msg sqsMessage, handler events.HandlerFunc) bool {
+	heartbeatCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(c.visibility / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+				if err := c.changeVisibility(heartbeatCtx, queueURL, msg.ReceiptHandle, c.visibility); err != nil && heartbeatCtx.Err() == nil {
+					c.log.Warn("awssqs: visibility extension failed", "queue", queueURL, "message_id", msg.MessageID, "error", err)
+				}
+			}
+		}
+	}()
+	err := handler(ctx, unwrapSNS(msg.Body))
+	stop()
+	<-done
+	if err == nil {
+		return true
+	}
+
+	receives, _ := strconv.Atoi(msg.Attributes["ApproximateReceiveCount"])
+	retryCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if redrive.maxReceiveCount > 0 && receives >= redrive.maxReceiveCount {
+		c.log.Error("awssqs: message moving to dead-letter queue", "queue", queueURL, "message_id", msg.MessageID,
+			"receives", receives, "dead_letter_queue", redrive.deadLetterTarget, "error", err)
+		// Make it visible at once so SQS redrives it on the next receive.
+		c.changeVisibility(retryCtx, queueURL, msg.ReceiptHandle, 0)
+		return false
+	}
+	delay := c.retryBackoff
+	for i := 1; i < receives && delay < c.maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, c.maxRetryBackoff)
+	c.log.Warn("awssqs: handler failed, message will be redelivered", "queue", queueURL, "message_id", msg.MessageID,
+		"receives", receives, "retry_in", delay, "error", err)
+	if err := c.changeVisibility(retryCtx, queueURL, msg.ReceiptHandle, delay); err != nil {
+		c.log.Warn("awssqs: retry delay not set", "queue", queueURL, "message_id", msg.MessageID, "error", err)
+	}
+	return false
+}
+
+func (c *Client) changeVisibility(ctx context.Context, queueURL, receiptHandle string, d time.Duration) error {
+	return c.callSQS(ctx, "ChangeMessageVisibility", map[string]any{
+		"QueueUrl":          queueURL,
+		"ReceiptHandle":     receiptHandle,
+		"VisibilityTimeout": int(d / time.Second),
+	}, nil)
+}
+
+// queueURL resolves a queue name, caching the result; URLs pass through.
+func (c *Client) queueURL(ctx context.Context, topic string) (string, error) {
+	if strings.HasPrefix(topic, "https://") || strings.HasPrefix(topic, "http://") {
+		return topic, nil
+	}
+	c.mu.Lock()
+	cached, ok := c.queueURLs[topic]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	var out struct {
+		QueueURL string `json:"QueueUrl"`
+	}
+	if err := c.callSQS(ctx, "GetQueueUrl", map[string]any{"QueueName": topic}, &out); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.queueURLs[topic] = out.QueueURL
+	c.mu.Unlock()
+	return out.QueueURL, nil
+}
+
+func (c *Client) redrivePolicy(ctx context.Context, queueURL string) (redrivePolicy, error) {
+	var out struct {
+		Attributes map[string]string `json:"Attributes"`
+	}
+	if err := c.callSQS(ctx, "GetQueueAttributes", map[string]any{"QueueUrl": queueURL, "AttributeNames": []string{"RedrivePolicy"}}, &out); err != nil {
+		return redrivePolicy{}, err
+	}
+	raw := out.Attributes["RedrivePolicy"]
+	if raw == "" {
+		return redrivePolicy{}, nil
+	}
+	var policy struct {
+		DeadLetterTargetArn string          `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.RawMessage `json:"maxReceiveCount"`
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return redrivePolicy{}, fmt.Errorf("awssqs: decoding redrive policy: %w", err)
+	}
+	// maxReceiveCount is a number or a numeric string depending on the API.
+	count, _ := strconv.Atoi(strings.Trim(string(policy.MaxReceiveCount), `"`))
+	return redrivePolicy{deadLetterTarget: policy.DeadLetterTargetArn, maxReceiveCount: count}, nil
+}
+
+// snsRegion reports whether topic is an SNS topic ARN and returns its
+// region.
+func snsRegion(topic string) (string, bool) {
+	parts := strings.Split(topic, ":")
+	if len(parts) < 6 || parts[0] != "arn" || parts[2] != "sns" {
+		return "", false
+	}
+	return parts[3], true
+}
+
+// unwrapSNS returns the message of an SNS notification delivered to a
+// queue without raw message delivery, and other bodies unchanged.
+func unwrapSNS(body string) []byte {
+	var notification struct {
+		Type     string `json:"Type"`
+		TopicArn string `json:"TopicArn"`
+		Message  string `json:"Message"`
+	}
+	if json.Unmarshal([]byte(body), &notification) == nil && notification.Type == "Notification" && notification.TopicArn != "" {
+		return []byte(notification.Message)
+	}
+	return []byte(body)
+}
+
+// deduplicationID uses the envelope ID when msg is an events.Envelope, so
+// retried publishes of the same event are dropped by FIFO queues.
+func deduplicationID(msg []byte) string {
+	var env events.Envelope
+	if json.Unmarshal(msg, &env) == nil && env.ID != "" {
+		return env.ID
+	}
+	sum := sha256.Sum256(msg)
+	return hex.EncodeToString(sum[:])
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
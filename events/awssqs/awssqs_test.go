@@ -0,0 +1,314 @@
+package awssqs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+func TestSignVector(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	if err := sign(req, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+type fakeMessage struct {
+	id, body, receipt string
+	visibleAt         time.Time
+	receives          int
+}
+
+// fakeAWS serves the SQS JSON and SNS Query actions the client uses, the
+// way LocalStack does on a single endpoint.
+type fakeAWS struct {
+	mu          sync.Mutex
+	queues      map[string][]*fakeMessage
+	redrive     string
+	nextID      int
+	visibility  []int
+	deleted     []string
+	snsMessages []string
+	failSend    bool
+}
+
+func newFakeAWS() *fakeAWS {
+	return &fakeAWS{queues: map[string][]*fakeMessage{"orders": nil}}
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		r.ParseForm()
+		f.snsMessages = append(f.snsMessages, r.Form.Get("Message"))
+		fmt.Fprint(w, `<PublishResponse><PublishResult><MessageId>m</MessageId></PublishResult></PublishResponse>`)
+		return
+	}
+
+	var in map[string]any
+	json.NewDecoder(r.Body).Decode(&in)
+	queue := strings.TrimPrefix(fmt.Sprint(in["QueueUrl"]), "http://queues/")
+	reply := func(v any) { json.NewEncoder(w).Encode(v) }
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.") {
+	case "GetQueueUrl":
+		name := in["QueueName"].(string)
+		if _, ok := f.queues[name]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]string{"__type": "com.amazonaws.sqs#QueueDoesNotExist", "message": "no queue"})
+			return
+		}
+		reply(map[string]string{"QueueUrl": "http://queues/" + name})
+	case "GetQueueAttributes":
+		reply(map[string]any{"Attributes": map[string]string{"RedrivePolicy": f.redrive}})
+	case "SendMessage":
+		f.push(queue, in["MessageBody"].(string))
+		reply(map[string]string{"MessageId": "x"})
+	case "SendMessageBatch":
+		var failed []map[string]any
+		for _, e := range in["Entries"].([]any) {
+			entry := e.(map[string]any)
+			if f.failSend && entry["Id"] == "1" {
+				failed = append(failed, map[string]any{"Id": "1", "Code": "InternalError", "Message": "boom"})
+				continue
+			}
+			f.push(queue, entry["MessageBody"].(string))
+		}
+		reply(map[string]any{"Failed": failed})
+	case "ReceiveMessage":
+		var out []map[string]any
+		now := time.Now()
+		kept := f.queues[queue][:0]
+		for _, m := range f.queues[queue] {
+			if m.receives >= 2 && !m.visibleAt.After(now) {
+				continue // redriven to the dead-letter queue
+			}
+			kept = append(kept, m)
+		}
+		f.queues[queue] = kept
+		for _, m := range f.queues[queue] {
+			if len(out) == int(in["MaxNumberOfMessages"].(float64)) || m.visibleAt.After(now) {
+				continue
+			}
+			m.receives++
+			m.receipt = m.id + "-" + strconv.Itoa(m.receives)
+			m.visibleAt = now.Add(time.Duration(in["VisibilityTimeout"].(float64)) * time.Second)
+			out = append(out, map[string]any{"MessageId": m.id, "ReceiptHandle": m.receipt, "Body": m.body,
+				"Attributes": map[string]string{"ApproximateReceiveCount": strconv.Itoa(m.receives)}})
+		}
+		if len(out) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		reply(map[string]any{"Messages": out})
+	case "ChangeMessageVisibility":
+		seconds := int(in["VisibilityTimeout"].(float64))
+		f.visibility = append(f.visibility, seconds)
+		for _, m := range f.queues[queue] {
+			if m.receipt == in["ReceiptHandle"] {
+				m.visibleAt = time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+		}
+		reply(map[string]any{})
+	case "DeleteMessageBatch":
+		for _, e := range in["Entries"].([]any) {
+			receipt := e.(map[string]any)["ReceiptHandle"]
+			kept := f.queues[queue][:0]
+			for _, m := range f.queues[queue] {
+				if m.receipt == receipt {
+					f.deleted = append(f.deleted, m.body)
+					continue
+				}
+				kept = append(kept, m)
+			}
+			f.queues[queue] = kept
+		}
+		reply(map[string]any{})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (f *fakeAWS) push(queue, body string) {
+	f.nextID++
+	f.queues[queue] = append(f.queues[queue], &fakeMessage{id: strconv.Itoa(f.nextID), body: body})
+}
+
+func newTestClient(t *testing.T, fake *fakeAWS, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := New(Config{Region: "us-east-1", Endpoint: server.URL, Credentials: Credentials{AccessKeyID: "test", SecretAccessKey: "test"}}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestPublish(t *testing.T) {
+	fake := newFakeAWS()
+	fake.failSend = true
+	client := newTestClient(t, fake)
+	ctx := context.Background()
+
+	if err := client.Publish(ctx, "orders", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Publish(ctx, "arn:aws:sns:eu-west-1:123456789012:orders", []byte("fanout")); err != nil {
+		t.Fatal(err)
+	}
+	err := client.BatchPublish(ctx, "orders", [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	var pubErr *events.PublishError
+	if !errors.As(err, &pubErr) || pubErr.Index != 1 {
+		t.Errorf("batch err = %v", err)
+	}
+	if len(fake.queues["orders"]) != 3 || len(fake.snsMessages) != 1 || fake.snsMessages[0] != "fanout" {
+		t.Errorf("queue %d messages, sns %v", len(fake.queues["orders"]), fake.snsMessages)
+	}
+
+	var apiErr *APIError
+	if err := client.Publish(ctx, "missing", []byte("x")); !errors.As(err, &apiErr) || apiErr.Code != "QueueDoesNotExist" {
+		t.Errorf("missing queue err = %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	fake := newFakeAWS()
+	fake.redrive = `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:1:orders-dlq","maxReceiveCount":"2"}`
+	fake.push("orders", "ok")
+	fake.push("orders", `{"Type":"Notification","TopicArn":"arn:aws:sns:us-east-1:1:t","Message":"from-sns"}`)
+	fake.push("orders", "poison")
+
+	var buf strings.Builder
+	var logMu sync.Mutex
+	logger := &lineLogger{mu: &logMu, buf: &buf}
+	var calls []string
+	var mu sync.Mutex
+	tag := func(next events.HandlerFunc) events.HandlerFunc {
+		return func(ctx context.Context, msg []byte) error {
+			return next(ctx, append([]byte("seen:"), msg...))
+		}
+	}
+	client := newTestClient(t, fake, WithLogger(logger), WithMiddleware(tag), WithWaitTime(0),
+		WithVisibilityTimeout(2*time.Second), WithRetryBackoff(time.Second, time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := client.Subscribe(ctx, "orders", func(_ context.Context, msg []byte) error {
+		mu.Lock()
+		calls = append(calls, string(msg))
+		mu.Unlock()
+		if string(msg) == "seen:ok" {
+			time.Sleep(1200 * time.Millisecond) // outlives half the visibility timeout
+		}
+		if string(msg) == "seen:poison" {
+			return errors.New("cannot parse")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		logMu.Lock()
+		done := strings.Contains(buf.String(), "dead-letter")
+		logMu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	client.Wait()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.deleted) != 2 || len(fake.queues["orders"]) != 0 {
+		t.Errorf("deleted %v, left %d", fake.deleted, len(fake.queues["orders"]))
+	}
+	poisonCalls := 0
+	for _, call := range calls {
+		if call == "seen:poison" {
+			poisonCalls++
+		}
+	}
+	if poisonCalls != 2 || !strings.Contains(strings.Join(calls, ","), "seen:from-sns") {
+		t.Errorf("calls = %v", calls)
+	}
+	// Heartbeat extension (2), retry backoff (1) and the dead-letter release (0).
+	if !containsAll(fake.visibility, 2, 1, 0) {
+		t.Errorf("visibility changes = %v", fake.visibility)
+	}
+	if !strings.Contains(buf.String(), "orders-dlq") {
+		t.Errorf("log lacks dead-letter queue: %s", buf.String())
+	}
+}
+
+func TestConfigFrom(t *testing.T) {
+	t.Setenv("AWS_REGION", "eu-central-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	cfg := aqm.NewConfig()
+	cfg.Set("aws.endpoint", "http://localhost:4566")
+	cfg.Set("aws.access_key_id", "test")
+
+	got := ConfigFrom(cfg)
+	if got.Region != "eu-central-1" || got.Endpoint != "http://localhost:4566" || got.Credentials.AccessKeyID != "test" || got.Credentials.SecretAccessKey != "env-secret" {
+		t.Errorf("config = %+v", got)
+	}
+	if _, err := New(Config{Region: "eu-central-1"}); err == nil {
+		t.Error("expected missing credentials error")
+	}
+}
+
+func containsAll(values []int, want ...int) bool {
+	for _, w := range want {
+		found := false
+		for _, v := range values {
+			found = found || v == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// lineLogger records messages and key/value args for assertions.
+type lineLogger struct {
+	aqm.Logger
+	mu  *sync.Mutex
+	buf *strings.Builder
+}
+
+func (l *lineLogger) write(v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.buf, v...)
+}
+
+func (l *lineLogger) Error(v ...any) { l.write(v...) }
+func (l *lineLogger) Warn(v ...any)  { l.write(v...) }
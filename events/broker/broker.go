@@ -0,0 +1,65 @@
+// Package broker opens the events transport named in configuration, so a
+// service moves between managed brokers by changing events.broker instead
+// of its wiring.
+package broker
+
+import (
+	"fmt"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/aquamarinepk/aqm/events/awssqs"
+	"github.com/aquamarinepk/aqm/events/gcppubsub"
+	"github.com/aquamarinepk/aqm/events/mqtt"
+	"github.com/aquamarinepk/aqm/events/rabbit"
+)
+
+// Broker publishes and subscribes. Wait blocks until the subscriptions
+// stopped after their context ended.
+type Broker interface {
+	events.Publisher
+	events.BatchPublisher
+	events.Subscriber
+	Wait()
+}
+
+var (
+	_ Broker = (*awssqs.Client)(nil)
+	_ Broker = (*gcppubsub.Client)(nil)
+	_ Broker = (*rabbit.Client)(nil)
+	_ Broker = (*mqtt.Client)(nil)
+)
+
+// Open builds the broker selected by events.broker: "sqs", configured by
+// the aws.* properties (see awssqs.ConfigFrom and awssqs.WithConfig),
+// "pubsub", configured by the gcp.* properties (see gcppubsub.ConfigFrom
+// and gcppubsub.WithConfig), "rabbit", configured by the rabbit.*
+// properties (see rabbit.ConfigFrom), or "mqtt", configured by the mqtt.*
+// properties (see mqtt.ConfigFrom). middlewares wrap every subscribed
+// handler. The rabbit and mqtt brokers also implement aqm.Startable and
+// aqm.Stoppable; hand them to aqm.WithLifecycle.
+func Open(cfg *aqm.Config, logger aqm.Logger, middlewares ...events.Middleware) (Broker, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("broker: config required")
+	}
+	name, _ := cfg.GetString("events.broker")
+	switch name {
+	case "sqs":
+		return awssqs.New(awssqs.ConfigFrom(cfg),
+			awssqs.WithConfig(cfg), awssqs.WithLogger(logger), awssqs.WithMiddleware(middlewares...))
+	case "pubsub":
+		pubsubCfg, err := gcppubsub.ConfigFrom(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return gcppubsub.New(pubsubCfg,
+			gcppubsub.WithConfig(cfg), gcppubsub.WithLogger(logger), gcppubsub.WithMiddleware(middlewares...))
+	case "rabbit":
+		return rabbit.New(rabbit.ConfigFrom(cfg), rabbit.WithLogger(logger), rabbit.WithMiddleware(middlewares...))
+	case "mqtt":
+		return mqtt.New(mqtt.ConfigFrom(cfg), mqtt.WithLogger(logger), mqtt.WithMiddleware(middlewares...))
+	case "":
+		return nil, fmt.Errorf("broker: events.broker not set")
+	}
+	return nil, fmt.Errorf("broker: unknown events.broker %q", name)
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events/awssqs"
+	"github.com/aquamarinepk/aqm/events/gcppubsub"
+	"github.com/aquamarinepk/aqm/events/mqtt"
+	"github.com/aquamarinepk/aqm/events/rabbit"
+)
+
+func TestOpen(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.Set("aws.region", "us-east-1")
+	cfg.Set("aws.access_key_id", "test")
+	cfg.Set("aws.secret_access_key", "test")
+	cfg.Set("gcp.project", "p")
+	cfg.Set("gcp.pubsub.emulator_host", "localhost:8085")
+
+	cfg.Set("events.broker", "sqs")
+	if b, err := Open(cfg, aqm.NewNoopLogger()); err != nil {
+		t.Fatal(err)
+	} else if _, ok := b.(*awssqs.Client); !ok {
+		t.Errorf("sqs broker = %T", b)
+	}
+
+	cfg.Set("events.broker", "pubsub")
+	if b, err := Open(cfg, aqm.NewNoopLogger()); err != nil {
+		t.Fatal(err)
+	} else if _, ok := b.(*gcppubsub.Client); !ok {
+		t.Errorf("pubsub broker = %T", b)
+	}
+
+	cfg.Set("events.broker", "rabbit")
+	if b, err := Open(cfg, aqm.NewNoopLogger()); err != nil {
+		t.Fatal(err)
+	} else if _, ok := b.(*rabbit.Client); !ok {
+		t.Errorf("rabbit broker = %T", b)
+	}
+
+	cfg.Set("events.broker", "mqtt")
+	if b, err := Open(cfg, aqm.NewNoopLogger()); err != nil {
+		t.Fatal(err)
+	} else if _, ok := b.(*mqtt.Client); !ok {
+		t.Errorf("mqtt broker = %T", b)
+	}
+
+	cfg.Set("events.broker", "kafka")
+	if _, err := Open(cfg, aqm.NewNoopLogger()); err == nil {
+		t.Error("expected unknown broker error")
+	}
+}
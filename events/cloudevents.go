@@ -0,0 +1,444 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CloudEventsSpecVersion is the CloudEvents version read and written.
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsContentType marks structured mode requests.
+	CloudEventsContentType = "application/cloudevents+json"
+	// VersionExtension is the CloudEvents extension attribute carrying the
+	// envelope schema version.
+	VersionExtension = "dataversion"
+
+	maxCloudEventSize = 1 << 20
+)
+
+// ErrInvalidCloudEvent is returned for requests that are not a valid
+// CloudEvent.
+var ErrInvalidCloudEvent = errors.New("events: invalid cloudevent")
+
+// ErrUnsupportedData is returned for CloudEvents whose data is not JSON,
+// which an Envelope cannot hold.
+var ErrUnsupportedData = errors.New("events: cloudevent data is not json")
+
+// CloudEvent is an Envelope received with the CloudEvents attributes it has
+// no field for. Extensions holds the remaining extension attributes.
+type CloudEvent struct {
+	Envelope
+	Source     string
+	Subject    string
+	DataSchema string
+	Extensions map[string]string
+}
+
+// ReadCloudEvent decodes a CloudEvent sent over HTTP in binary mode, with
+// the attributes in ce-* headers, or in structured mode, with the event as
+// an application/cloudevents+json body. The data must be JSON. The envelope
+// version comes from the dataversion extension and defaults to 1.
+func ReadCloudEvent(r *http.Request) (CloudEvent, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCloudEventSize+1))
+	if err != nil {
+		return CloudEvent{}, fmt.Errorf("events: reading cloudevent: %w", err)
+	}
+	if len(body) > maxCloudEventSize {
+		return CloudEvent{}, fmt.Errorf("%w: larger than %d bytes", ErrInvalidCloudEvent, maxCloudEventSize)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	attrs := map[string]string{}
+	var data json.RawMessage
+
+	if mediaType == CloudEventsContentType {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return CloudEvent{}, fmt.Errorf("%w: %v", ErrInvalidCloudEvent, err)
+		}
+		for name, raw := range fields {
+			switch name {
+			case "data":
+				data = raw
+			case "data_base64":
+				var encoded string
+				if err := json.Unmarshal(raw, &encoded); err != nil {
+					return CloudEvent{}, fmt.Errorf("%w: data_base64: %v", ErrInvalidCloudEvent, err)
+				}
+				decoded, err := base64.StdEncoding.DecodeString(encoded)
+				if err != nil {
+					return CloudEvent{}, fmt.Errorf("%w: data_base64: %v", ErrInvalidCloudEvent, err)
+				}
+				data = decoded
+			default:
+				attrs[name] = attributeString(raw)
+			}
+		}
+	} else {
+		for key, values := range r.Header {
+			name := strings.ToLower(key)
+			if !strings.HasPrefix(name, "ce-") || len(values) == 0 {
+				continue
+			}
+			value, err := url.PathUnescape(values[0])
+			if err != nil {
+				value = values[0]
+			}
+			attrs[strings.TrimPrefix(name, "ce-")] = value
+		}
+		if r.Header.Get("Content-Type") != "" {
+			attrs["datacontenttype"] = r.Header.Get("Content-Type")
+		}
+		if len(body) > 0 {
+			data = body
+		}
+	}
+	return cloudEventFromAttributes(attrs, data)
+}
+
+func cloudEventFromAttributes(attrs map[string]string, data json.RawMessage) (CloudEvent, error) {
+	if attrs["specversion"] != CloudEventsSpecVersion {
+		return CloudEvent{}, fmt.Errorf("%w: specversion %q", ErrInvalidCloudEvent, attrs["specversion"])
+	}
+	for _, required := range []string{"id", "source", "type"} {
+		if attrs[required] == "" {
+			return CloudEvent{}, fmt.Errorf("%w: %s required", ErrInvalidCloudEvent, required)
+		}
+	}
+	if contentType := attrs["datacontenttype"]; contentType != "" && !isJSONMediaType(contentType) {
+		return CloudEvent{}, fmt.Errorf("%w: %s", ErrUnsupportedData, contentType)
+	}
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	if !json.Valid(data) {
+		return CloudEvent{}, fmt.Errorf("%w: malformed data", ErrUnsupportedData)
+	}
+
+	event := CloudEvent{
+		Envelope:   Envelope{ID: attrs["id"], Type: attrs["type"], Version: 1, Data: data},
+		Source:     attrs["source"],
+		Subject:    attrs["subject"],
+		DataSchema: attrs["dataschema"],
+	}
+	if raw := attrs["time"]; raw != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return CloudEvent{}, fmt.Errorf("%w: time %q", ErrInvalidCloudEvent, raw)
+		}
+		event.Time = t.UTC()
+	}
+	if raw := attrs[VersionExtension]; raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil || version < 1 {
+			return CloudEvent{}, fmt.Errorf("%w: %s %q", ErrInvalidCloudEvent, VersionExtension, raw)
+		}
+		event.Version = version
+	}
+	for name, value := range attrs {
+		switch name {
+		case "specversion", "id", "source", "type", "subject", "dataschema", "time", "datacontenttype", VersionExtension:
+			continue
+		}
+		if event.Extensions == nil {
+			event.Extensions = map[string]string{}
+		}
+		event.Extensions[name] = value
+	}
+	return event, nil
+}
+
+// CloudEventHandler receives CloudEvents with ReadCloudEvent and passes them
+// to fn. See Codec.CloudEventHandler.
+func CloudEventHandler(fn func(ctx context.Context, event CloudEvent) error) http.Handler {
+	return NewCodec(nil).CloudEventHandler(fn)
+}
+
+// CloudEventHandler receives CloudEvents, validates their data against the
+// schema version they carry and passes them to fn. Invalid events are
+// answered with 400, non-JSON data with 415, and failures of fn with 500 so
+// the sender retries; accepted events get 202.
+func (c *Codec) CloudEventHandler(fn func(ctx context.Context, event CloudEvent) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		event, err := ReadCloudEvent(r)
+		if err == nil {
+			err = c.validate(r.Context(), event.Envelope)
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrUnsupportedData) {
+				status = http.StatusUnsupportedMediaType
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if err := fn(r.Context(), event); err != nil {
+			http.Error(w, "event not processed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// EmitterOption configures a CloudEventEmitter.
+type EmitterOption func(*CloudEventEmitter)
+
+// WithEmitterClient sets the HTTP client used to reach the sinks.
+func WithEmitterClient(client *http.Client) EmitterOption {
+	return func(e *CloudEventEmitter) {
+		if client != nil {
+			e.client = client
+		}
+	}
+}
+
+// WithStructuredMode posts events as application/cloudevents+json bodies
+// instead of binary mode ce-* headers.
+func WithStructuredMode() EmitterOption {
+	return func(e *CloudEventEmitter) {
+		e.structured = true
+	}
+}
+
+// WithEmitterRetries sets how many times a failed delivery is retried
+// (default 3) and the backoff, doubling from initial up to max.
+func WithEmitterRetries(retries int, initial, max time.Duration) EmitterOption {
+	return func(e *CloudEventEmitter) {
+		if retries >= 0 {
+			e.retries = retries
+		}
+		if initial > 0 {
+			e.backoff = initial
+		}
+		if max >= e.backoff {
+			e.maxBackoff = max
+		}
+	}
+}
+
+// CloudEventEmitter posts envelopes as CloudEvents to HTTP sinks such as a
+// Knative broker or an EventBridge API destination.
+type CloudEventEmitter struct {
+	source     string
+	sinks      []string
+	client     *http.Client
+	structured bool
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// NewCloudEventEmitter builds an emitter identifying itself as source, a
+// URI reference such as //orders-service, and posting to every sink URL.
+func NewCloudEventEmitter(source string, sinks []string, opts ...EmitterOption) *CloudEventEmitter {
+	e := &CloudEventEmitter{
+		source:     source,
+		sinks:      append([]string(nil), sinks...),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		retries:    3,
+		backoff:    200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(e)
+		}
+	}
+	return e
+}
+
+// SinkError reports a sink that did not accept an event after the retries.
+type SinkError struct {
+	Sink string
+	Err  error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("events: emitting to %s: %v", e.Sink, e.Err)
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// Emit posts env to every sink with subject as the subject attribute (may
+// be empty). Network errors, 408, 429 and 5xx answers are retried with
+// backoff, honouring Retry-After; other answers fail at once. Failures are
+// joined as *SinkError values.
+func (e *CloudEventEmitter) Emit(ctx context.Context, env Envelope, subject string) error {
+	if env.ID == "" {
+		env.ID = newEventID()
+	}
+	if env.Time.IsZero() {
+		env.Time = time.Now().UTC()
+	}
+	if env.Version == 0 {
+		env.Version = 1
+	}
+	if env.Type == "" {
+		return fmt.Errorf("%w: type required", ErrInvalidCloudEvent)
+	}
+
+	var errs []error
+	for _, sink := range e.sinks {
+		if err := e.deliver(ctx, sink, env, subject); err != nil {
+			errs = append(errs, &SinkError{Sink: sink, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Publish implements Publisher for encoded envelopes, such as those written
+// by Codec.Publish, using topic as the subject.
+func (e *CloudEventEmitter) Publish(ctx context.Context, topic string, msg []byte) error {
+	var env Envelope
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return fmt.Errorf("events: decoding envelope: %w", err)
+	}
+	return e.Emit(ctx, env, topic)
+}
+
+func (e *CloudEventEmitter) deliver(ctx context.Context, sink string, env Envelope, subject string) error {
+	backoff := e.backoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := e.post(ctx, sink, env, subject)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt >= e.retries {
+			return err
+		}
+		wait := backoff
+		if retryAfter > 0 {
+			wait = min(retryAfter, e.maxBackoff)
+		}
+		if !sleep(ctx, wait) {
+			return errors.Join(err, ctx.Err())
+		}
+		backoff = min(backoff*2, e.maxBackoff)
+	}
+}
+
+// post sends one attempt. A negative retryAfter marks errors not worth
+// retrying; a positive one is the delay the sink asked for.
+func (e *CloudEventEmitter) post(ctx context.Context, sink string, env Envelope, subject string) (time.Duration, error) {
+	req, err := e.newRequest(ctx, sink, env, subject)
+	if err != nil {
+		return -1, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 300 {
+		return 0, nil
+	}
+	err = fmt.Errorf("sink answered %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second, err
+		}
+		return 0, err
+	}
+	return -1, err
+}
+
+func (e *CloudEventEmitter) newRequest(ctx context.Context, sink string, env Envelope, subject string) (*http.Request, error) {
+	attrs := map[string]string{
+		"specversion":    CloudEventsSpecVersion,
+		"id":             env.ID,
+		"source":         e.source,
+		"type":           env.Type,
+		"time":           env.Time.UTC().Format(time.RFC3339Nano),
+		VersionExtension: strconv.Itoa(env.Version),
+	}
+	if subject != "" {
+		attrs["subject"] = subject
+	}
+	data := env.Data
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+
+	if e.structured {
+		fields := map[string]any{"datacontenttype": "application/json", "data": data}
+		for name, value := range attrs {
+			fields[name] = value
+		}
+		body, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", CloudEventsContentType)
+		return req, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range attrs {
+		req.Header.Set("ce-"+name, encodeHeaderValue(value))
+	}
+	return req, nil
+}
+
+// attributeString renders a structured mode attribute; strings are
+// unquoted, other JSON values kept as written.
+func attributeString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// encodeHeaderValue percent-encodes the characters the HTTP binding requires:
+// space, double quote, percent and anything outside printable ASCII.
+func encodeHeaderValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadCloudEventModes(t *testing.T) {
+	binary := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"order":"o-1"}`))
+	binary.Header.Set("Content-Type", "application/json")
+	binary.Header.Set("ce-specversion", "1.0")
+	binary.Header.Set("ce-id", "e-1")
+	binary.Header.Set("ce-source", "//orders")
+	binary.Header.Set("ce-type", "order.created")
+	binary.Header.Set("ce-time", "2026-01-02T03:04:05Z")
+	binary.Header.Set("ce-dataversion", "2")
+	binary.Header.Set("ce-subject", "orders%20eu")
+	binary.Header.Set("ce-tenant", "acme")
+
+	structured := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
+		"specversion":"1.0","id":"e-1","source":"//orders","type":"order.created",
+		"time":"2026-01-02T03:04:05Z","dataversion":"2","subject":"orders eu","tenant":"acme",
+		"datacontenttype":"application/json","data":{"order":"o-1"}}`))
+	structured.Header.Set("Content-Type", CloudEventsContentType+"; charset=utf-8")
+
+	for name, req := range map[string]*http.Request{"binary": binary, "structured": structured} {
+		t.Run(name, func(t *testing.T) {
+			event, err := ReadCloudEvent(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.ID != "e-1" || event.Type != "order.created" || event.Version != 2 || event.Source != "//orders" || event.Subject != "orders eu" {
+				t.Errorf("event = %+v", event)
+			}
+			if !event.Time.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) || event.Extensions["tenant"] != "acme" {
+				t.Errorf("time %v, extensions %v", event.Time, event.Extensions)
+			}
+			var payload struct{ Order string }
+			if err := event.Decode(&payload); err != nil || payload.Order != "o-1" {
+				t.Errorf("payload = %+v, %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestCloudEventHandler(t *testing.T) {
+	registry := NewMemorySchemaRegistry()
+	registry.Register(context.Background(), Schema{Type: "order.created", Version: 1, Fields: map[string]string{"order": FieldString}, Required: []string{"order"}})
+	var received []CloudEvent
+	handler := NewCodec(registry).CloudEventHandler(func(_ context.Context, event CloudEvent) error {
+		received = append(received, event)
+		if event.ID == "boom" {
+			return errors.New("store down")
+		}
+		return nil
+	})
+
+	send := func(id, contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("ce-specversion", "1.0")
+		req.Header.Set("ce-id", id)
+		req.Header.Set("ce-source", "//orders")
+		req.Header.Set("ce-type", "order.created")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := send("e-1", "application/json", `{"order":"o-1"}`); code != http.StatusAccepted {
+		t.Errorf("valid event = %d", code)
+	}
+	if code := send("e-2", "application/json", `{}`); code != http.StatusBadRequest {
+		t.Errorf("schema violation = %d", code)
+	}
+	if code := send("e-3", "text/plain", `hello`); code != http.StatusUnsupportedMediaType {
+		t.Errorf("text data = %d", code)
+	}
+	if code := send("boom", "application/json", `{"order":"o-1"}`); code != http.StatusInternalServerError {
+		t.Errorf("handler failure = %d", code)
+	}
+	if len(received) != 2 {
+		t.Errorf("handler called %d times", len(received))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing attributes = %d", rec.Code)
+	}
+}
+
+func TestCloudEventEmitter(t *testing.T) {
+	var attempts atomic.Int32
+	var got CloudEvent
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		event, err := ReadCloudEvent(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got = event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer sink.Close()
+
+	for _, structured := range []bool{false, true} {
+		attempts.Store(0)
+		opts := []EmitterOption{WithEmitterRetries(2, time.Millisecond, time.Millisecond)}
+		if structured {
+			opts = append(opts, WithStructuredMode())
+		}
+		emitter := NewCloudEventEmitter("//orders", []string{sink.URL}, opts...)
+		env := Envelope{Type: "order.created", Version: 3, Data: json.RawMessage(`{"order":"o-1"}`)}
+		if err := emitter.Emit(context.Background(), env, "orders eu"); err != nil {
+			t.Fatalf("structured=%v: %v", structured, err)
+		}
+		if attempts.Load() != 2 || got.ID == "" || got.Version != 3 || got.Subject != "orders eu" || got.Source != "//orders" || string(got.Data) != `{"order":"o-1"}` {
+			t.Errorf("structured=%v: %d attempts, received %+v", structured, attempts.Load(), got)
+		}
+	}
+}
+
+func TestCloudEventEmitterFailures(t *testing.T) {
+	var attempts atomic.Int32
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer accepting.Close()
+
+	emitter := NewCloudEventEmitter("//orders", []string{accepting.URL, rejecting.URL}, WithEmitterRetries(3, time.Millisecond, time.Millisecond))
+	codec := NewCodec(nil)
+	err := codec.Publish(context.Background(), emitter, "orders", "order.created", 0, map[string]string{"order": "o-1"})
+	var sinkErr *SinkError
+	if !errors.As(err, &sinkErr) || sinkErr.Sink != rejecting.URL {
+		t.Fatalf("err = %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("client error retried %d times", attempts.Load())
+	}
+}
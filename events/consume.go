@@ -0,0 +1,218 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultConsumerName       = "default"
+	defaultCheckpointEvery    = 100
+	defaultCheckpointInterval = 5 * time.Second
+	defaultPollInterval       = time.Second
+	defaultFetchLimit         = 100
+	defaultConsumeBackoff     = 500 * time.Millisecond
+	defaultMaxConsumeBackoff  = 30 * time.Second
+)
+
+// CursorFetcher is implemented by stream consumers that can fetch from a
+// position. Consume uses it when available; otherwise it fetches everything
+// and skips what the cursor already covers.
+type CursorFetcher interface {
+	// FetchAfter returns up to limit messages with a sequence above seq,
+	// oldest first.
+	FetchAfter(ctx context.Context, seq uint64, limit int) ([]StreamMessage, error)
+}
+
+// ConsumeOption configures Consume.
+type ConsumeOption func(*consumeConfig)
+
+type consumeConfig struct {
+	name               string
+	checkpointEvery    int
+	checkpointInterval time.Duration
+	pollInterval       time.Duration
+	fetchLimit         int
+	backoff            time.Duration
+	maxBackoff         time.Duration
+}
+
+// WithConsumerName sets the key the cursor is stored under (default
+// "default"). Consumers of different streams must use different names.
+func WithConsumerName(name string) ConsumeOption {
+	return func(c *consumeConfig) {
+		if name != "" {
+			c.name = name
+		}
+	}
+}
+
+// WithCheckpoint saves the cursor after every n handled messages or once
+// interval has passed since the last save, whichever comes first (defaults
+// 100 and 5s). Lower values mean fewer redeliveries after a crash.
+func WithCheckpoint(n int, interval time.Duration) ConsumeOption {
+	return func(c *consumeConfig) {
+		if n > 0 {
+			c.checkpointEvery = n
+		}
+		if interval > 0 {
+			c.checkpointInterval = interval
+		}
+	}
+}
+
+// WithPollInterval sets the wait between fetches once the stream is drained
+// (default 1s).
+func WithPollInterval(d time.Duration) ConsumeOption {
+	return func(c *consumeConfig) {
+		if d > 0 {
+			c.pollInterval = d
+		}
+	}
+}
+
+// WithFetchLimit sets how many messages are handled per fetch (default 100).
+func WithFetchLimit(n int) ConsumeOption {
+	return func(c *consumeConfig) {
+		if n > 0 {
+			c.fetchLimit = n
+		}
+	}
+}
+
+// WithConsumeBackoff sets the retry backoff after fetch errors, doubling from
+// initial up to max.
+func WithConsumeBackoff(initial, max time.Duration) ConsumeOption {
+	return func(c *consumeConfig) {
+		if initial > 0 {
+			c.backoff = initial
+		}
+		if max >= c.backoff {
+			c.maxBackoff = max
+		}
+	}
+}
+
+// Consume feeds the messages of consumer to handler, resuming after the
+// sequence stored in store and checkpointing as configured. Processing is
+// at-least-once: the cursor only moves past messages handler accepted, so
+// messages handled after the last checkpoint are redelivered after a restart.
+// It blocks until ctx is done, returning nil after a final checkpoint, or
+// until handler fails, returning its error without advancing past the failed
+// message. Fetch errors are retried with backoff. Sequences are expected to
+// start at 1.
+func Consume(ctx context.Context, consumer StreamConsumer, store CursorStore, handler HandlerFunc, opts ...ConsumeOption) error {
+	if consumer == nil || store == nil || handler == nil {
+		return errors.New("events: consumer, cursor store and handler are required")
+	}
+	cfg := &consumeConfig{
+		name:               defaultConsumerName,
+		checkpointEvery:    defaultCheckpointEvery,
+		checkpointInterval: defaultCheckpointInterval,
+		pollInterval:       defaultPollInterval,
+		fetchLimit:         defaultFetchLimit,
+		backoff:            defaultConsumeBackoff,
+		maxBackoff:         defaultMaxConsumeBackoff,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+
+	cursor, _, err := store.LoadCursor(ctx, cfg.name)
+	if err != nil {
+		return fmt.Errorf("events: loading cursor %s: %w", cfg.name, err)
+	}
+	saved, pending := cursor, 0
+	lastSave := time.Now()
+	checkpoint := func(ctx context.Context) error {
+		if cursor == saved {
+			return nil
+		}
+		if err := store.SaveCursor(ctx, cfg.name, cursor); err != nil {
+			return fmt.Errorf("events: saving cursor %s: %w", cfg.name, err)
+		}
+		saved, pending, lastSave = cursor, 0, time.Now()
+		return nil
+	}
+	finish := func(err error) error {
+		return errors.Join(err, checkpoint(context.WithoutCancel(ctx)))
+	}
+
+	delay := cfg.backoff
+	for {
+		msgs, err := fetchAfter(ctx, consumer, cursor, cfg.fetchLimit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return finish(nil)
+			}
+			if !sleep(ctx, delay) {
+				return finish(nil)
+			}
+			delay = min(delay*2, cfg.maxBackoff)
+			continue
+		}
+		delay = cfg.backoff
+
+		for _, msg := range msgs {
+			if err := handler(ctx, msg.Data); err != nil {
+				if ctx.Err() != nil {
+					return finish(nil)
+				}
+				return finish(fmt.Errorf("events: handling sequence %d: %w", msg.Sequence, err))
+			}
+			cursor = msg.Sequence
+			pending++
+			if pending >= cfg.checkpointEvery || time.Since(lastSave) >= cfg.checkpointInterval {
+				if err := checkpoint(ctx); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(msgs) < cfg.fetchLimit {
+			if err := checkpoint(ctx); err != nil && ctx.Err() == nil {
+				return err
+			}
+			if !sleep(ctx, cfg.pollInterval) {
+				return finish(nil)
+			}
+		}
+	}
+}
+
+// fetchAfter returns up to limit messages newer than seq.
+func fetchAfter(ctx context.Context, consumer StreamConsumer, seq uint64, limit int) ([]StreamMessage, error) {
+	if fetcher, ok := consumer.(CursorFetcher); ok {
+		return fetcher.FetchAfter(ctx, seq, limit)
+	}
+	all, err := consumer.Fetch(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]StreamMessage, 0, limit)
+	for _, msg := range all {
+		if msg.Sequence <= seq {
+			continue
+		}
+		out = append(out, msg)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
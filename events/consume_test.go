@@ -0,0 +1,179 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sliceConsumer struct {
+	mu       sync.Mutex
+	msgs     []StreamMessage
+	failures int
+	fetches  int
+}
+
+func newSliceConsumer(n int) *sliceConsumer {
+	c := &sliceConsumer{}
+	for i := 1; i <= n; i++ {
+		c.msgs = append(c.msgs, StreamMessage{Data: []byte(fmt.Sprintf("m%d", i)), Sequence: uint64(i)})
+	}
+	return c
+}
+
+func (c *sliceConsumer) Fetch(_ context.Context, limit int) ([]StreamMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetches++
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("broker unavailable")
+	}
+	if limit == 0 || limit > len(c.msgs) {
+		limit = len(c.msgs)
+	}
+	return append([]StreamMessage(nil), c.msgs[:limit]...), nil
+}
+
+func (c *sliceConsumer) SubscribeStream(context.Context, HandlerFunc) error {
+	return nil
+}
+
+type seekingConsumer struct {
+	sliceConsumer
+	after []uint64
+}
+
+func (c *seekingConsumer) FetchAfter(_ context.Context, seq uint64, limit int) ([]StreamMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.after = append(c.after, seq)
+	var out []StreamMessage
+	for _, msg := range c.msgs {
+		if msg.Sequence > seq && len(out) < limit {
+			out = append(out, msg)
+		}
+	}
+	return out, nil
+}
+
+type countingStore struct {
+	*MemoryCursorStore
+	mu    sync.Mutex
+	saves []uint64
+}
+
+func (s *countingStore) SaveCursor(ctx context.Context, name string, seq uint64) error {
+	s.mu.Lock()
+	s.saves = append(s.saves, seq)
+	s.mu.Unlock()
+	return s.MemoryCursorStore.SaveCursor(ctx, name, seq)
+}
+
+// stopAfter returns a handler recording messages that cancels once n were
+// handled.
+func stopAfter(n int, cancel context.CancelFunc, got *[]string) HandlerFunc {
+	return func(_ context.Context, msg []byte) error {
+		*got = append(*got, string(msg))
+		if len(*got) == n {
+			cancel()
+		}
+		return nil
+	}
+}
+
+func TestConsumeResumesFromCursor(t *testing.T) {
+	store := NewMemoryCursorStore()
+	_ = store.SaveCursor(context.Background(), "orders", 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	err := Consume(ctx, newSliceConsumer(5), store, stopAfter(2, cancel, &got),
+		WithConsumerName("orders"), WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if fmt.Sprint(got) != "[m4 m5]" {
+		t.Fatalf("handled %v, want [m4 m5]", got)
+	}
+	if seq, _, _ := store.LoadCursor(context.Background(), "orders"); seq != 5 {
+		t.Fatalf("cursor = %d, want 5", seq)
+	}
+}
+
+func TestConsumeCheckpointsEveryN(t *testing.T) {
+	store := &countingStore{MemoryCursorStore: NewMemoryCursorStore()}
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	err := Consume(ctx, newSliceConsumer(7), store, stopAfter(7, cancel, &got),
+		WithCheckpoint(3, time.Hour), WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if fmt.Sprint(store.saves) != "[3 6 7]" {
+		t.Fatalf("saves = %v, want [3 6 7]", store.saves)
+	}
+}
+
+func TestConsumeHandlerErrorKeepsFailedMessage(t *testing.T) {
+	store := NewMemoryCursorStore()
+	boom := errors.New("boom")
+	handler := func(_ context.Context, msg []byte) error {
+		if string(msg) == "m3" {
+			return boom
+		}
+		return nil
+	}
+
+	err := Consume(context.Background(), newSliceConsumer(5), store, handler, WithCheckpoint(100, time.Hour))
+	if !errors.Is(err, boom) {
+		t.Fatalf("Consume error = %v, want %v", err, boom)
+	}
+	if seq, _, _ := store.LoadCursor(context.Background(), defaultConsumerName); seq != 2 {
+		t.Fatalf("cursor = %d, want 2", seq)
+	}
+}
+
+func TestConsumeRetriesFetchErrors(t *testing.T) {
+	consumer := newSliceConsumer(2)
+	consumer.failures = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	err := Consume(ctx, consumer, NewMemoryCursorStore(), stopAfter(2, cancel, &got),
+		WithConsumeBackoff(time.Millisecond, 2*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if len(got) != 2 || consumer.fetches < 3 {
+		t.Fatalf("handled %v after %d fetches", got, consumer.fetches)
+	}
+}
+
+func TestConsumePrefersCursorFetcher(t *testing.T) {
+	consumer := &seekingConsumer{sliceConsumer: *newSliceConsumer(4)}
+	store := NewMemoryCursorStore()
+	_ = store.SaveCursor(context.Background(), defaultConsumerName, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	err := Consume(ctx, consumer, store, stopAfter(3, cancel, &got), WithFetchLimit(2))
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if fmt.Sprint(consumer.after[:2]) != "[1 3]" {
+		t.Fatalf("FetchAfter positions = %v, want [1 3 ...]", consumer.after)
+	}
+	if consumer.fetches != 0 {
+		t.Fatalf("Fetch called %d times, want 0", consumer.fetches)
+	}
+}
+
+func TestConsumeRequiresArguments(t *testing.T) {
+	if err := Consume(context.Background(), nil, NewMemoryCursorStore(), func(context.Context, []byte) error { return nil }); err == nil {
+		t.Fatal("expected error for nil consumer")
+	}
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// CursorStore persists the last processed stream sequence per consumer name.
+type CursorStore interface {
+	// LoadCursor returns the stored sequence and whether one was stored.
+	LoadCursor(ctx context.Context, name string) (uint64, bool, error)
+	// SaveCursor stores seq as the last processed sequence for name.
+	SaveCursor(ctx context.Context, name string, seq uint64) error
+}
+
+// MemoryCursorStore keeps cursors in memory, mostly for tests.
+type MemoryCursorStore struct {
+	mu      sync.Mutex
+	cursors map[string]uint64
+}
+
+// NewMemoryCursorStore builds an empty in-memory store.
+func NewMemoryCursorStore() *MemoryCursorStore {
+	return &MemoryCursorStore{cursors: make(map[string]uint64)}
+}
+
+// LoadCursor implements CursorStore.
+func (s *MemoryCursorStore) LoadCursor(_ context.Context, name string) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq, ok := s.cursors[name]
+	return seq, ok, nil
+}
+
+// SaveCursor implements CursorStore.
+func (s *MemoryCursorStore) SaveCursor(_ context.Context, name string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[name] = seq
+	return nil
+}
+
+// FileCursorStore keeps every cursor in one JSON file, rewritten atomically
+// on each save. It suits single-instance consumers.
+type FileCursorStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCursorStore stores cursors in the JSON file at path, created on the
+// first save.
+func NewFileCursorStore(path string) *FileCursorStore {
+	return &FileCursorStore{path: path}
+}
+
+// LoadCursor implements CursorStore.
+func (s *FileCursorStore) LoadCursor(_ context.Context, name string) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursors, err := s.read()
+	if err != nil {
+		return 0, false, err
+	}
+	seq, ok := cursors[name]
+	return seq, ok, nil
+}
+
+// SaveCursor implements CursorStore.
+func (s *FileCursorStore) SaveCursor(_ context.Context, name string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursors, err := s.read()
+	if err != nil {
+		return err
+	}
+	cursors[name] = seq
+	data, err := json.Marshal(cursors)
+	if err != nil {
+		return fmt.Errorf("events: encoding cursors: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("events: saving cursor %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("events: saving cursor %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("events: saving cursor %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("events: saving cursor %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *FileCursorStore) read() (map[string]uint64, error) {
+	cursors := make(map[string]uint64)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cursors, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("events: reading cursors: %w", err)
+	}
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, fmt.Errorf("events: parsing %s: %w", s.path, err)
+	}
+	return cursors, nil
+}
+
+// KeyValue is the subset of a key/value client such as Redis used by
+// KVCursorStore. Get reports false when the key does not exist.
+type KeyValue interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string) error
+}
+
+// KVCursorStore keeps cursors in a key/value store under prefix+name. With
+// go-redis, Get maps to client.Get treating redis.Nil as not found, and Set to
+// client.Set with no expiration.
+type KVCursorStore struct {
+	kv     KeyValue
+	prefix string
+}
+
+// NewKVCursorStore stores cursors in kv, defaulting prefix to "cursor:".
+func NewKVCursorStore(kv KeyValue, prefix string) *KVCursorStore {
+	if prefix == "" {
+		prefix = "cursor:"
+	}
+	return &KVCursorStore{kv: kv, prefix: prefix}
+}
+
+// LoadCursor implements CursorStore.
+func (s *KVCursorStore) LoadCursor(ctx context.Context, name string) (uint64, bool, error) {
+	raw, ok, err := s.kv.Get(ctx, s.prefix+name)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	seq, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("events: cursor %s is not a sequence: %q", name, raw)
+	}
+	return seq, true, nil
+}
+
+// SaveCursor implements CursorStore.
+func (s *KVCursorStore) SaveCursor(ctx context.Context, name string, seq uint64) error {
+	return s.kv.Set(ctx, s.prefix+name, strconv.FormatUint(seq, 10))
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMemoryCursorStore(t *testing.T) {
+	testCursorStore(t, NewMemoryCursorStore())
+}
+
+func TestFileCursorStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+	testCursorStore(t, NewFileCursorStore(path))
+
+	reopened := NewFileCursorStore(path)
+	seq, ok, err := reopened.LoadCursor(context.Background(), "orders")
+	if err != nil || !ok || seq != 7 {
+		t.Fatalf("reopened LoadCursor = %d, %v, %v; want 7, true, nil", seq, ok, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Fatalf("expected only the cursor file, found %d entries", len(entries))
+	}
+}
+
+func TestFileCursorStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewFileCursorStore(path).LoadCursor(context.Background(), "orders"); err == nil {
+		t.Fatal("expected error for corrupt cursor file")
+	}
+}
+
+type mapKeyValue struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (m *mapKeyValue) Get(_ context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	return v, ok, nil
+}
+
+func (m *mapKeyValue) Set(_ context.Context, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+	return nil
+}
+
+func TestKVCursorStore(t *testing.T) {
+	kv := &mapKeyValue{values: map[string]string{}}
+	testCursorStore(t, NewKVCursorStore(kv, ""))
+
+	if kv.values["cursor:orders"] != "7" {
+		t.Fatalf("stored values = %v, want cursor:orders=7", kv.values)
+	}
+
+	kv.values["cursor:broken"] = "abc"
+	if _, _, err := NewKVCursorStore(kv, "").LoadCursor(context.Background(), "broken"); err == nil {
+		t.Fatal("expected error for non-numeric cursor")
+	}
+}
+
+func testCursorStore(t *testing.T, store CursorStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, ok, err := store.LoadCursor(ctx, "orders"); err != nil || ok {
+		t.Fatalf("LoadCursor on empty store = %v, %v; want false, nil", ok, err)
+	}
+	if err := store.SaveCursor(ctx, "orders", 3); err != nil {
+		t.Fatalf("SaveCursor: %v", err)
+	}
+	if err := store.SaveCursor(ctx, "orders", 7); err != nil {
+		t.Fatalf("SaveCursor: %v", err)
+	}
+	if err := store.SaveCursor(ctx, "payments", 2); err != nil {
+		t.Fatalf("SaveCursor: %v", err)
+	}
+	seq, ok, err := store.LoadCursor(ctx, "orders")
+	if err != nil || !ok || seq != 7 {
+		t.Fatalf("LoadCursor = %d, %v, %v; want 7, true, nil", seq, ok, err)
+	}
+	seq, _, _ = store.LoadCursor(ctx, "payments")
+	if seq != 2 {
+		t.Fatalf("payments cursor = %d, want 2", seq)
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Envelope wraps an event payload with its type and schema version.
+type Envelope struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Decode unmarshals the payload into v.
+func (e Envelope) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Codec encodes payloads into envelopes and decodes them back, validating
+// them against the registry on both sides. A nil registry skips validation.
+type Codec struct {
+	registry SchemaRegistry
+}
+
+// NewCodec builds a codec validating against registry.
+func NewCodec(registry SchemaRegistry) *Codec {
+	return &Codec{registry: registry}
+}
+
+// Encode marshals payload as version of eventType and wraps it in an
+// envelope. Passing version 0 uses the latest registered version.
+func (c *Codec) Encode(ctx context.Context, eventType string, version int, payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("events: encoding %s payload: %w", eventType, err)
+	}
+	if c.registry != nil {
+		var schema Schema
+		if version == 0 {
+			schema, err = c.registry.Latest(ctx, eventType)
+		} else {
+			schema, err = c.registry.Lookup(ctx, eventType, version)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := schema.Validate(data); err != nil {
+			return nil, err
+		}
+		version = schema.Version
+	}
+	if version == 0 {
+		version = 1
+	}
+	return json.Marshal(Envelope{
+		ID:      newEventID(),
+		Type:    eventType,
+		Version: version,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	})
+}
+
+// Decode unwraps msg and validates its payload against the schema version it
+// was published with.
+func (c *Codec) Decode(ctx context.Context, msg []byte) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return Envelope{}, fmt.Errorf("events: decoding envelope: %w", err)
+	}
+	if err := c.validate(ctx, env); err != nil {
+		return Envelope{}, err
+	}
+	return env, nil
+}
+
+// validate checks env against the schema version it was published with.
+func (c *Codec) validate(ctx context.Context, env Envelope) error {
+	if env.Type == "" {
+		return fmt.Errorf("events: envelope has no type")
+	}
+	if c.registry == nil {
+		return nil
+	}
+	schema, err := c.registry.Lookup(ctx, env.Type, env.Version)
+	if err != nil {
+		return err
+	}
+	return schema.Validate(env.Data)
+}
+
+// Publish encodes payload and publishes it to topic.
+func (c *Codec) Publish(ctx context.Context, publisher Publisher, topic, eventType string, version int, payload any) error {
+	msg, err := c.Encode(ctx, eventType, version, payload)
+	if err != nil {
+		return err
+	}
+	return publisher.Publish(ctx, topic, msg)
+}
+
+// Handler adapts fn to a HandlerFunc that decodes and validates each message
+// before calling fn. Invalid messages are returned as errors without reaching
+// fn.
+func (c *Codec) Handler(fn func(ctx context.Context, env Envelope) error) HandlerFunc {
+	return func(ctx context.Context, msg []byte) error {
+		env, err := c.Decode(ctx, msg)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, env)
+	}
+}
+
+func newEventID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
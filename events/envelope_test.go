@@ -0,0 +1,93 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordingPublisher struct {
+	topic string
+	msg   []byte
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, topic string, msg []byte) error {
+	p.topic, p.msg = topic, msg
+	return nil
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	if err := registry.Register(ctx, orderCreatedV1); err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec(registry)
+	pub := &recordingPublisher{}
+
+	if err := codec.Publish(ctx, pub, "orders", "order.created", 0, map[string]any{"id": "o1", "total": 3}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if pub.topic != "orders" {
+		t.Errorf("topic = %q", pub.topic)
+	}
+
+	var got struct {
+		ID    string  `json:"id"`
+		Total float64 `json:"total"`
+	}
+	handler := codec.Handler(func(_ context.Context, env Envelope) error {
+		if env.Type != "order.created" || env.Version != 1 || env.ID == "" || env.Time.IsZero() {
+			t.Errorf("unexpected envelope %+v", env)
+		}
+		return env.Decode(&got)
+	})
+	if err := handler(ctx, pub.msg); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if got.ID != "o1" || got.Total != 3 {
+		t.Errorf("decoded %+v", got)
+	}
+}
+
+func TestCodecValidation(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	if err := registry.Register(ctx, orderCreatedV1); err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec(registry)
+
+	var violation *SchemaViolationError
+	if _, err := codec.Encode(ctx, "order.created", 1, map[string]any{"total": 1}); !errors.As(err, &violation) {
+		t.Errorf("expected violation on publish, got %v", err)
+	}
+	if _, err := codec.Encode(ctx, "order.created", 9, map[string]any{"id": "o1"}); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+
+	called := false
+	handler := codec.Handler(func(context.Context, Envelope) error {
+		called = true
+		return nil
+	})
+	bad := []byte(`{"type":"order.created","version":1,"data":{"id":5}}`)
+	if err := handler(ctx, bad); !errors.As(err, &violation) {
+		t.Errorf("expected violation on consume, got %v", err)
+	}
+	if err := handler(ctx, []byte(`not json`)); err == nil {
+		t.Error("expected decode error")
+	}
+	if called {
+		t.Error("handler should not run for invalid messages")
+	}
+
+	unvalidated := NewCodec(nil)
+	msg, err := unvalidated.Encode(ctx, "anything", 0, map[string]any{"x": 1})
+	if err != nil {
+		t.Fatalf("Encode without registry: %v", err)
+	}
+	if env, err := unvalidated.Decode(ctx, msg); err != nil || env.Version != 1 {
+		t.Errorf("Decode without registry: %+v, %v", env, err)
+	}
+}
@@ -40,3 +40,17 @@ type Stream interface {
 	Publisher
 	StreamConsumer
 }
+
+// Middleware wraps a HandlerFunc, e.g. to decode envelopes, log or recover.
+// Broker subscribers apply it to every handler they are given.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Chain wraps handler with middlewares; the first one runs outermost.
+func Chain(handler HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			handler = middlewares[i](handler)
+		}
+	}
+	return handler
+}
@@ -3,6 +3,7 @@ package events
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -238,3 +239,25 @@ func TestStreamInterface(t *testing.T) {
 		t.Errorf("Fetch error: %v", err)
 	}
 }
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, msg []byte) error {
+				order = append(order, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+	handler := Chain(func(context.Context, []byte) error {
+		order = append(order, "handler")
+		return nil
+	}, mw("outer"), nil, mw("inner"))
+	if err := handler(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "outer,inner,handler" {
+		t.Errorf("order = %s", got)
+	}
+}
@@ -0,0 +1,181 @@
+package gcppubsub
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pubsubScope      = "https://www.googleapis.com/auth/pubsub"
+	defaultTokenURI  = "https://oauth2.googleapis.com/token"
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	tokenEarlyExpiry = time.Minute
+)
+
+// TokenSource returns OAuth2 access tokens for the Pub/Sub API.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken always returns the same token, e.g. from gcloud auth
+// print-access-token in scripts.
+type StaticToken string
+
+// Token implements TokenSource.
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// fetchFunc requests a token and its lifetime.
+type fetchFunc func(ctx context.Context) (string, time.Duration, error)
+
+// cachedToken reuses a token until shortly before it expires.
+type cachedToken struct {
+	fetch fetchFunc
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (c *cachedToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	token, ttl, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, time.Now().Add(ttl-tokenEarlyExpiry)
+	return token, nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func readToken(resp *http.Response) (string, time.Duration, error) {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("gcppubsub: token request answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", 0, fmt.Errorf("gcppubsub: malformed token response")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// MetadataTokenSource fetches tokens of the attached service account from
+// the metadata server on GCE, GKE and Cloud Run.
+func MetadataTokenSource(client *http.Client) TokenSource {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &cachedToken{fetch: func(ctx context.Context) (string, time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", 0, fmt.Errorf("gcppubsub: metadata server: %w", err)
+		}
+		return readToken(resp)
+	}}
+}
+
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// ServiceAccountTokenSource exchanges signed JWT assertions of a service
+// account JSON key for access tokens.
+func ServiceAccountTokenSource(keyJSON []byte, client *http.Client) (TokenSource, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(keyJSON, &key); err != nil {
+		return nil, fmt.Errorf("gcppubsub: decoding service account key: %w", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" {
+		return nil, errors.New("gcppubsub: not a service account key")
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("gcppubsub: service account private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("gcppubsub: parsing service account private key: %w", err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("gcppubsub: service account private key is not RSA")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = defaultTokenURI
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &cachedToken{fetch: func(ctx context.Context) (string, time.Duration, error) {
+		assertion, err := signJWT(privateKey, key.ClientEmail, key.TokenURI, time.Now())
+		if err != nil {
+			return "", 0, err
+		}
+		form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, key.TokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", 0, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", 0, fmt.Errorf("gcppubsub: token endpoint: %w", err)
+		}
+		return readToken(resp)
+	}}, nil
+}
+
+func signJWT(key *rsa.PrivateKey, email, audience string, now time.Time) (string, error) {
+	encode := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(map[string]any{
+		"iss":   email,
+		"scope": pubsubScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("gcppubsub: signing assertion: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,622 @@
+// Package gcppubsub implements the events interfaces on Google Cloud
+// Pub/Sub through its REST API: Publish sends to a topic, optionally with
+// an ordering key, and Subscribe pulls a subscription under flow control,
+// extending ack deadlines while handlers run and keeping messages of one
+// ordering key in sequence. Setting an emulator host points the client at
+// the Pub/Sub emulator for tests, without authentication.
+package gcppubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+var (
+	_ events.Publisher      = (*Client)(nil)
+	_ events.BatchPublisher = (*Client)(nil)
+	_ events.Subscriber     = (*Client)(nil)
+)
+
+const (
+	defaultEndpoint               = "https://pubsub.googleapis.com/v1"
+	maxPublishBatch               = 1000
+	maxPull                       = 1000
+	defaultMaxOutstandingMessages = 1000
+	defaultMaxOutstandingBytes    = 1 << 30
+	defaultMaxExtension           = time.Hour
+	defaultAckDeadline            = 10 * time.Second
+	maxPollBackoff                = 30 * time.Second
+)
+
+// Config locates and authenticates the Pub/Sub API.
+type Config struct {
+	Project string
+	// Endpoint replaces the API base URL (defaults to
+	// https://pubsub.googleapis.com/v1).
+	Endpoint string
+	// EmulatorHost, e.g. localhost:8085, targets the Pub/Sub emulator over
+	// plain HTTP without authentication.
+	EmulatorHost string
+	// Tokens authenticates requests; not needed with the emulator.
+	Tokens TokenSource
+}
+
+// ConfigFrom reads gcp.project, gcp.pubsub.endpoint,
+// gcp.pubsub.emulator_host and gcp.credentials_file, falling back to the
+// GOOGLE_CLOUD_PROJECT, PUBSUB_EMULATOR_HOST and
+// GOOGLE_APPLICATION_CREDENTIALS environment variables. Without a
+// credentials file, tokens come from the metadata server.
+func ConfigFrom(cfg *aqm.Config) (Config, error) {
+	get := func(key, env string) string {
+		if cfg != nil {
+			if value, ok := cfg.GetString(key); ok && value != "" {
+				return value
+			}
+		}
+		return os.Getenv(env)
+	}
+	c := Config{
+		Project:      get("gcp.project", "GOOGLE_CLOUD_PROJECT"),
+		Endpoint:     get("gcp.pubsub.endpoint", ""),
+		EmulatorHost: get("gcp.pubsub.emulator_host", "PUBSUB_EMULATOR_HOST"),
+	}
+	if c.EmulatorHost != "" {
+		return c, nil
+	}
+	if file := get("gcp.credentials_file", "GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		key, err := os.ReadFile(file)
+		if err != nil {
+			return Config{}, fmt.Errorf("gcppubsub: reading credentials: %w", err)
+		}
+		tokens, err := ServiceAccountTokenSource(key, nil)
+		if err != nil {
+			return Config{}, err
+		}
+		c.Tokens = tokens
+		return c, nil
+	}
+	c.Tokens = MetadataTokenSource(nil)
+	return c, nil
+}
+
+// Option configures the Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for API calls.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		if client != nil {
+			c.httpClient = client
+		}
+	}
+}
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(c *Client) {
+		if logger != nil {
+			c.log = logger
+		}
+	}
+}
+
+// WithMiddleware wraps every subscribed handler, e.g. with
+// events.Codec.Handler adapters or logging.
+func WithMiddleware(middlewares ...events.Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithOrderingKey sets the ordering key of published messages; messages
+// sharing a key are delivered in publish order to subscriptions with
+// message ordering enabled. Topics must be published to in a region
+// endpoint for ordering to hold.
+func WithOrderingKey(fn func(topic string, msg []byte) string) Option {
+	return func(c *Client) {
+		c.orderingKey = fn
+	}
+}
+
+// WithFlowControl bounds the messages (default 1000) and bytes (default
+// 1 GiB) pulled but not yet handled; pulling pauses while either is
+// reached.
+func WithFlowControl(maxMessages, maxBytes int) Option {
+	return func(c *Client) {
+		if maxMessages > 0 {
+			c.maxOutstandingMessages = maxMessages
+		}
+		if maxBytes > 0 {
+			c.maxOutstandingBytes = maxBytes
+		}
+	}
+}
+
+// WithMaxExtension sets how long ack deadlines are extended for a slow
+// handler (default 1h) before the message is left to expire and be
+// redelivered.
+func WithMaxExtension(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.maxExtension = d
+		}
+	}
+}
+
+// WithConfig reads the gcp.pubsub.* tunables: max_outstanding_messages,
+// max_outstanding_bytes and max_extension.
+func WithConfig(cfg *aqm.Config) Option {
+	return func(c *Client) {
+		if cfg == nil {
+			return
+		}
+		WithFlowControl(cfg.GetIntOrDef("gcp.pubsub.max_outstanding_messages", c.maxOutstandingMessages),
+			int(cfg.GetBytesSizeOrDef("gcp.pubsub.max_outstanding_bytes", uint64(c.maxOutstandingBytes))))(c)
+		WithMaxExtension(cfg.GetDurationOrDef("gcp.pubsub.max_extension", c.maxExtension))(c)
+	}
+}
+
+// Client publishes to Pub/Sub topics and pulls subscriptions. Names are
+// short names in the configured project or full resource names such as
+// projects/p/topics/t.
+type Client struct {
+	cfg                    Config
+	base                   string
+	httpClient             *http.Client
+	log                    aqm.Logger
+	middlewares            []events.Middleware
+	orderingKey            func(topic string, msg []byte) string
+	maxOutstandingMessages int
+	maxOutstandingBytes    int
+	maxExtension           time.Duration
+
+	wg sync.WaitGroup
+}
+
+// New builds a client. The project is required, and a token source unless
+// the emulator is used.
+func New(cfg Config, opts ...Option) (*Client, error) {
+	if cfg.Project == "" {
+		return nil, errors.New("gcppubsub: project required")
+	}
+	base := defaultEndpoint
+	switch {
+	case cfg.EmulatorHost != "":
+		base = "http://" + strings.TrimSuffix(cfg.EmulatorHost, "/") + "/v1"
+	case cfg.Endpoint != "":
+		base = strings.TrimSuffix(cfg.Endpoint, "/")
+	}
+	if cfg.EmulatorHost == "" && cfg.Tokens == nil {
+		return nil, errors.New("gcppubsub: token source required outside the emulator")
+	}
+	c := &Client{
+		cfg:                    cfg,
+		base:                   base,
+		httpClient:             &http.Client{Timeout: 90 * time.Second},
+		log:                    aqm.NewNoopLogger(),
+		maxOutstandingMessages: defaultMaxOutstandingMessages,
+		maxOutstandingBytes:    defaultMaxOutstandingBytes,
+		maxExtension:           defaultMaxExtension,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c, nil
+}
+
+// APIError is an error answered by the Pub/Sub API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gcppubsub: %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+type pubsubMessage struct {
+	Data        string            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+	MessageID   string            `json:"messageId,omitempty"`
+}
+
+// Publish implements events.Publisher.
+func (c *Client) Publish(ctx context.Context, topic string, msg []byte) error {
+	return c.publish(ctx, topic, [][]byte{msg})
+}
+
+// BatchPublish implements events.BatchPublisher, sending up to 1000
+// messages per request. A failed request is reported as one
+// *events.PublishError per message it carried.
+func (c *Client) BatchPublish(ctx context.Context, topic string, msgs [][]byte) error {
+	var errs []error
+	for start := 0; start < len(msgs); start += maxPublishBatch {
+		end := min(start+maxPublishBatch, len(msgs))
+		if err := c.publish(ctx, topic, msgs[start:end]); err != nil {
+			for i := start; i < end; i++ {
+				errs = append(errs, &events.PublishError{Topic: topic, Index: i, Err: err})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) publish(ctx context.Context, topic string, msgs [][]byte) error {
+	messages := make([]pubsubMessage, len(msgs))
+	for i, msg := range msgs {
+		messages[i] = pubsubMessage{Data: base64.StdEncoding.EncodeToString(msg), Attributes: envelopeAttributes(msg)}
+		if c.orderingKey != nil {
+			messages[i].OrderingKey = c.orderingKey(topic, msg)
+		}
+	}
+	return c.call(ctx, http.MethodPost, c.resource("topics", topic)+":publish", map[string]any{"messages": messages}, nil)
+}
+
+// envelopeAttributes exposes the type, version and ID of an
+// events.Envelope as attributes, usable in subscription filters.
+func envelopeAttributes(msg []byte) map[string]string {
+	var env events.Envelope
+	if json.Unmarshal(msg, &env) != nil || env.Type == "" {
+		return nil
+	}
+	return map[string]string{"event_type": env.Type, "event_version": strconv.Itoa(env.Version), "event_id": env.ID}
+}
+
+// Subscribe implements events.Subscriber for the subscription named by
+// topic: Pub/Sub delivers to subscriptions, not topics. It pulls until ctx
+// is done. Messages are acknowledged when the handler succeeds and nacked
+// for redelivery when it fails; messages sharing an ordering key are
+// handled one at a time in order, and the rest of a key's messages are
+// nacked after a failure so the order survives redelivery.
+func (c *Client) Subscribe(ctx context.Context, topic string, handler events.HandlerFunc) error {
+	if handler == nil {
+		return errors.New("gcppubsub: nil handler")
+	}
+	sub := c.resource("subscriptions", topic)
+	var info struct {
+		AckDeadlineSeconds int `json:"ackDeadlineSeconds"`
+		DeadLetterPolicy   struct {
+			DeadLetterTopic     string `json:"deadLetterTopic"`
+			MaxDeliveryAttempts int    `json:"maxDeliveryAttempts"`
+		} `json:"deadLetterPolicy"`
+	}
+	if err := c.call(ctx, http.MethodGet, sub, nil, &info); err != nil {
+		return err
+	}
+	s := &subscription{
+		client:      c,
+		name:        sub,
+		handler:     events.Chain(handler, c.middlewares...),
+		ackDeadline: time.Duration(info.AckDeadlineSeconds) * time.Second,
+		deadLetter:  info.DeadLetterPolicy.DeadLetterTopic,
+		maxAttempts: info.DeadLetterPolicy.MaxDeliveryAttempts,
+		flow:        newFlowController(c.maxOutstandingMessages, c.maxOutstandingBytes),
+		keys:        make(map[string]*keyQueue),
+	}
+	if s.ackDeadline <= 0 {
+		s.ackDeadline = defaultAckDeadline
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		s.run(ctx)
+	}()
+	return nil
+}
+
+// Wait blocks until the subscriptions stopped after their context ended,
+// including the handlers still running.
+func (c *Client) Wait() {
+	c.wg.Wait()
+}
+
+type receivedMessage struct {
+	AckID           string        `json:"ackId"`
+	Message         pubsubMessage `json:"message"`
+	DeliveryAttempt int           `json:"deliveryAttempt"`
+}
+
+type subscription struct {
+	client      *Client
+	name        string
+	handler     events.HandlerFunc
+	ackDeadline time.Duration
+	deadLetter  string
+	maxAttempts int
+	flow        *flowController
+
+	mu       sync.Mutex
+	keys     map[string]*keyQueue
+	inflight sync.WaitGroup
+}
+
+// keyQueue holds the pending messages of one ordering key.
+type keyQueue struct {
+	pending []receivedMessage
+	failed  bool
+}
+
+func (s *subscription) run(ctx context.Context) {
+	c := s.client
+	backoff := time.Second
+	defer s.inflight.Wait()
+	for {
+		room, ok := s.flow.wait(ctx)
+		if !ok {
+			return
+		}
+		var out struct {
+			ReceivedMessages []receivedMessage `json:"receivedMessages"`
+		}
+		if err := c.call(ctx, http.MethodPost, s.name+":pull", map[string]any{"maxMessages": min(room, maxPull)}, &out); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.log.Error("gcppubsub: pull failed", "subscription", s.name, "error", err)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = min(backoff*2, maxPollBackoff)
+			continue
+		}
+		backoff = time.Second
+		for _, msg := range out.ReceivedMessages {
+			s.flow.acquire(len(msg.Message.Data))
+			s.inflight.Add(1)
+			if key := msg.Message.OrderingKey; key != "" {
+				s.enqueue(ctx, key, msg)
+				continue
+			}
+			go func() {
+				defer s.done(msg)
+				s.handle(ctx, msg)
+			}()
+		}
+	}
+}
+
+func (s *subscription) done(msg receivedMessage) {
+	s.flow.release(len(msg.Message.Data))
+	s.inflight.Done()
+}
+
+// enqueue appends msg to the queue of its ordering key, starting a worker
+// when the key has none.
+func (s *subscription) enqueue(ctx context.Context, key string, msg receivedMessage) {
+	s.mu.Lock()
+	queue, running := s.keys[key]
+	if !running {
+		queue = &keyQueue{}
+		s.keys[key] = queue
+	}
+	queue.pending = append(queue.pending, msg)
+	s.mu.Unlock()
+	if running {
+		return
+	}
+
+	go func() {
+		for {
+			s.mu.Lock()
+			if len(queue.pending) == 0 {
+				delete(s.keys, key)
+				s.mu.Unlock()
+				return
+			}
+			next, failed := queue.pending[0], queue.failed
+			queue.pending = queue.pending[1:]
+			s.mu.Unlock()
+
+			if failed {
+				s.nack(ctx, next)
+			} else if !s.handle(ctx, next) {
+				s.mu.Lock()
+				queue.failed = true
+				s.mu.Unlock()
+			}
+			s.done(next)
+		}
+	}()
+}
+
+// handle runs the handler for msg, extending its ack deadline meanwhile,
+// then acks or nacks it. It reports whether the handler succeeded.
+func (s *subscription) handle(ctx context.Context, msg receivedMessage) bool {
+	c := s.client
+	data, err := base64.StdEncoding.DecodeString(msg.Message.Data)
+	if err != nil {
+		c.log.Error("gcppubsub: malformed message data", "subscription", s.name, "message_id", msg.Message.MessageID, "error", err)
+		s.nack(ctx, msg)
+		return false
+	}
+
+	extendCtx, stop := context.WithTimeout(ctx, c.maxExtension)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(max(s.ackDeadline/2, 500*time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-extendCtx.Done():
+				return
+			case <-ticker.C:
+				if err := s.modifyDeadline(extendCtx, msg.AckID, s.ackDeadline); err != nil && extendCtx.Err() == nil {
+					c.log.Warn("gcppubsub: ack deadline extension failed", "subscription", s.name, "message_id", msg.Message.MessageID, "error", err)
+				}
+			}
+		}
+	}()
+	err = s.handler(ctx, data)
+	stop()
+	<-done
+
+	if err == nil {
+		ackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if ackErr := c.call(ackCtx, http.MethodPost, s.name+":acknowledge", map[string]any{"ackIds": []string{msg.AckID}}, nil); ackErr != nil {
+			c.log.Warn("gcppubsub: ack failed, message will be redelivered", "subscription", s.name, "message_id", msg.Message.MessageID, "error", ackErr)
+		}
+		return true
+	}
+	if s.maxAttempts > 0 && msg.DeliveryAttempt >= s.maxAttempts {
+		c.log.Error("gcppubsub: message moving to dead-letter topic", "subscription", s.name, "message_id", msg.Message.MessageID,
+			"attempts", msg.DeliveryAttempt, "dead_letter_topic", s.deadLetter, "error", err)
+	} else {
+		c.log.Warn("gcppubsub: handler failed, message will be redelivered", "subscription", s.name, "message_id", msg.Message.MessageID,
+			"attempts", msg.DeliveryAttempt, "error", err)
+	}
+	s.nack(ctx, msg)
+	return false
+}
+
+// nack makes msg available for redelivery at once.
+func (s *subscription) nack(ctx context.Context, msg receivedMessage) {
+	nackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := s.modifyDeadline(nackCtx, msg.AckID, 0); err != nil {
+		s.client.log.Warn("gcppubsub: nack failed", "subscription", s.name, "message_id", msg.Message.MessageID, "error", err)
+	}
+}
+
+func (s *subscription) modifyDeadline(ctx context.Context, ackID string, d time.Duration) error {
+	return s.client.call(ctx, http.MethodPost, s.name+":modifyAckDeadline", map[string]any{
+		"ackIds":             []string{ackID},
+		"ackDeadlineSeconds": int(d / time.Second),
+	}, nil)
+}
+
+// flowController counts the messages and bytes pulled but not handled.
+type flowController struct {
+	maxMessages, maxBytes int
+
+	mu       sync.Mutex
+	messages int
+	bytes    int
+	changed  chan struct{}
+}
+
+func newFlowController(maxMessages, maxBytes int) *flowController {
+	return &flowController{maxMessages: maxMessages, maxBytes: maxBytes, changed: make(chan struct{})}
+}
+
+// wait blocks until there is room for more messages and returns how many.
+func (f *flowController) wait(ctx context.Context) (int, bool) {
+	for {
+		f.mu.Lock()
+		if f.messages < f.maxMessages && f.bytes < f.maxBytes {
+			room := f.maxMessages - f.messages
+			f.mu.Unlock()
+			return room, ctx.Err() == nil
+		}
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return 0, false
+		case <-changed:
+		}
+	}
+}
+
+func (f *flowController) acquire(size int) {
+	f.mu.Lock()
+	f.messages++
+	f.bytes += size
+	f.mu.Unlock()
+}
+
+func (f *flowController) release(size int) {
+	f.mu.Lock()
+	f.messages--
+	f.bytes -= size
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+// resource returns the full name of a topic or subscription.
+func (c *Client) resource(kind, name string) string {
+	if strings.HasPrefix(name, "projects/") {
+		return name
+	}
+	return "projects/" + c.cfg.Project + "/" + kind + "/" + name
+}
+
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+"/"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.EmulatorHost == "" {
+		token, err := c.cfg.Tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return &APIError{StatusCode: resp.StatusCode, Status: apiErr.Error.Status, Message: apiErr.Error.Message}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,331 @@
+package gcppubsub
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+type fakeMessage struct {
+	msg       pubsubMessage
+	ackID     string
+	attempts  int
+	leasedTil time.Time
+	acked     bool
+}
+
+// fakeEmulator serves the Pub/Sub REST calls the client makes for one
+// topic, orders, with one subscription, orders-sub.
+type fakeEmulator struct {
+	mu          sync.Mutex
+	messages    []*fakeMessage
+	ackDeadline int
+	extensions  int
+	token       string
+}
+
+func (f *fakeEmulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"status": "UNAUTHENTICATED", "message": "bad token"}})
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var in map[string]any
+	json.NewDecoder(r.Body).Decode(&in)
+	reply := func(v any) { json.NewEncoder(w).Encode(v) }
+
+	switch r.URL.Path {
+	case "/v1/projects/p/subscriptions/orders-sub":
+		reply(map[string]any{"ackDeadlineSeconds": f.ackDeadline})
+	case "/v1/projects/p/topics/orders:publish":
+		var body struct{ Messages []pubsubMessage }
+		data, _ := json.Marshal(in)
+		json.Unmarshal(data, &body)
+		for _, msg := range body.Messages {
+			id := strconv.Itoa(len(f.messages) + 1)
+			msg.MessageID = id
+			f.messages = append(f.messages, &fakeMessage{msg: msg})
+		}
+		reply(map[string]any{"messageIds": []string{}})
+	case "/v1/projects/p/subscriptions/orders-sub:pull":
+		var out []receivedMessage
+		now := time.Now()
+		// Like the service, hold back later messages of an ordering key
+		// while an earlier one is outstanding.
+		blocked := map[string]bool{}
+		for _, m := range f.messages {
+			if len(out) == int(in["maxMessages"].(float64)) {
+				break
+			}
+			key := m.msg.OrderingKey
+			if m.acked || key != "" && blocked[key] {
+				continue
+			}
+			if m.leasedTil.After(now) {
+				blocked[key] = key != ""
+				continue
+			}
+			m.attempts++
+			m.ackID = m.msg.MessageID + "-" + strconv.Itoa(m.attempts)
+			m.leasedTil = now.Add(time.Duration(f.ackDeadline) * time.Second)
+			out = append(out, receivedMessage{AckID: m.ackID, Message: m.msg, DeliveryAttempt: m.attempts})
+		}
+		if len(out) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		reply(map[string]any{"receivedMessages": out})
+	case "/v1/projects/p/subscriptions/orders-sub:acknowledge":
+		for _, m := range f.find(in) {
+			m.acked = true
+		}
+		reply(map[string]any{})
+	case "/v1/projects/p/subscriptions/orders-sub:modifyAckDeadline":
+		seconds := int(in["ackDeadlineSeconds"].(float64))
+		if seconds > 0 {
+			f.extensions++
+		}
+		for _, m := range f.find(in) {
+			m.leasedTil = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		reply(map[string]any{})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		reply(map[string]any{"error": map[string]any{"status": "NOT_FOUND", "message": r.URL.Path}})
+	}
+}
+
+func (f *fakeEmulator) find(in map[string]any) []*fakeMessage {
+	var found []*fakeMessage
+	for _, id := range in["ackIds"].([]any) {
+		for _, m := range f.messages {
+			if m.ackID == id {
+				found = append(found, m)
+			}
+		}
+	}
+	return found
+}
+
+func (f *fakeEmulator) pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, m := range f.messages {
+		if !m.acked {
+			n++
+		}
+	}
+	return n
+}
+
+func newEmulatorClient(t *testing.T, fake *fakeEmulator, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := New(Config{Project: "p", EmulatorHost: strings.TrimPrefix(server.URL, "http://")}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestPublish(t *testing.T) {
+	fake := &fakeEmulator{ackDeadline: 10}
+	client := newEmulatorClient(t, fake, WithOrderingKey(func(topic string, msg []byte) string {
+		return topic + "/" + string(msg[:1])
+	}))
+	ctx := context.Background()
+
+	env, _ := json.Marshal(events.Envelope{ID: "e-1", Type: "order.created", Version: 2, Data: json.RawMessage(`{}`)})
+	if err := client.Publish(ctx, "orders", env); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.BatchPublish(ctx, "orders", [][]byte{[]byte("a1"), []byte("b1")}); err != nil {
+		t.Fatal(err)
+	}
+	first := fake.messages[0].msg
+	if first.Attributes["event_type"] != "order.created" || first.Attributes["event_version"] != "2" || first.Attributes["event_id"] != "e-1" {
+		t.Errorf("attributes = %v", first.Attributes)
+	}
+	if len(fake.messages) != 3 || fake.messages[1].msg.OrderingKey != "orders/a" {
+		t.Errorf("published %d, ordering key %q", len(fake.messages), fake.messages[1].msg.OrderingKey)
+	}
+
+	err := client.BatchPublish(ctx, "missing", [][]byte{[]byte("x")})
+	var pubErr *events.PublishError
+	var apiErr *APIError
+	if !errors.As(err, &pubErr) || !errors.As(err, &apiErr) || apiErr.Status != "NOT_FOUND" {
+		t.Errorf("missing topic err = %v", err)
+	}
+}
+
+func TestSubscribeOrdered(t *testing.T) {
+	fake := &fakeEmulator{ackDeadline: 1}
+	client := newEmulatorClient(t, fake, WithOrderingKey(func(_ string, msg []byte) string {
+		if msg[0] == 'u' {
+			return ""
+		}
+		return string(msg[:1])
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.BatchPublish(ctx, "orders", [][]byte{[]byte("a1"), []byte("a2"), []byte("a3"), []byte("b1"), []byte("u1")})
+
+	var mu sync.Mutex
+	var handled []string
+	failedOnce := false
+	err := client.Subscribe(ctx, "orders-sub", func(_ context.Context, msg []byte) error {
+		if string(msg) == "u1" {
+			time.Sleep(700 * time.Millisecond) // outlives half the ack deadline
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if string(msg) == "a2" && !failedOnce {
+			failedOnce = true
+			return errors.New("transient")
+		}
+		handled = append(handled, string(msg))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	client.Wait()
+
+	var a []string
+	for _, msg := range handled {
+		if msg[0] == 'a' {
+			a = append(a, msg)
+		}
+	}
+	if strings.Join(a, ",") != "a1,a2,a3" || len(handled) != 5 {
+		t.Errorf("handled = %v", handled)
+	}
+	if fake.extensions == 0 {
+		t.Error("ack deadline not extended for the slow handler")
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	fake := &fakeEmulator{ackDeadline: 10}
+	client := newEmulatorClient(t, fake, WithFlowControl(2, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var msgs [][]byte
+	for i := 0; i < 8; i++ {
+		msgs = append(msgs, []byte(strconv.Itoa(i)))
+	}
+	client.BatchPublish(ctx, "orders", msgs)
+
+	var mu sync.Mutex
+	running, peak, count := 0, 0, 0
+	client.Subscribe(ctx, "orders-sub", func(context.Context, []byte) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		count++
+		mu.Unlock()
+		return nil
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	client.Wait()
+	if count != 8 || peak > 2 {
+		t.Errorf("handled %d, peak concurrency %d", count, peak)
+	}
+}
+
+func TestServiceAccountTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	fetches := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil || !strings.Contains(string(claims), pubsubScope) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fetches++
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "tok", ExpiresIn: 3600})
+	}))
+	defer tokenServer.Close()
+
+	keyJSON, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "svc@p.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenServer.URL,
+	})
+	tokens, err := ServiceAccountTokenSource(keyJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeEmulator{ackDeadline: 10, token: "tok"}
+	api := httptest.NewServer(fake)
+	defer api.Close()
+	client, err := New(Config{Project: "p", Endpoint: api.URL + "/v1", Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.Publish(context.Background(), "orders", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("token fetched %d times, want cached", fetches)
+	}
+}
+
+func TestConfigFrom(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "localhost:8085")
+	cfg := aqm.NewConfig()
+	cfg.Set("gcp.project", "p")
+	got, err := ConfigFrom(cfg)
+	if err != nil || got.Project != "p" || got.EmulatorHost != "localhost:8085" || got.Tokens != nil {
+		t.Errorf("config = %+v, %v", got, err)
+	}
+	if _, err := New(Config{Project: "p"}); err == nil {
+		t.Error("expected missing token source error")
+	}
+}
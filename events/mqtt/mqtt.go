@@ -0,0 +1,782 @@
+// Package mqtt implements the events interfaces on an MQTT 3.1.1 broker
+// for services that talk to device fleets. Publish sends at QoS 0 or 1,
+// optionally retained, and Subscribe routes messages to handlers by topic
+// filter, + and # wildcards included. The client keeps a persistent
+// session: after a lost connection it reconnects with backoff, resumes the
+// broker-side session, resends unacknowledged publishes and subscribes
+// again when the broker lost the session.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+var (
+	_ events.Publisher      = (*Client)(nil)
+	_ events.BatchPublisher = (*Client)(nil)
+	_ events.Subscriber     = (*Client)(nil)
+	_ aqm.Startable         = (*Client)(nil)
+	_ aqm.Stoppable         = (*Client)(nil)
+	_ aqm.HealthReporter    = (*Client)(nil)
+)
+
+const (
+	defaultURL        = "tcp://localhost:1883"
+	defaultKeepAlive  = 30 * time.Second
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	connectTimeout    = 30 * time.Second
+)
+
+var (
+	// ErrClosed is returned after Stop.
+	ErrClosed = errors.New("mqtt: client stopped")
+	// ErrNotConnected is returned by QoS 0 publishes while the client is
+	// reconnecting; QoS 1 publishes wait for the connection instead.
+	ErrNotConnected = errors.New("mqtt: not connected")
+	// ErrSubscriptionRefused is returned when the broker refuses a topic
+	// filter.
+	ErrSubscriptionRefused = errors.New("mqtt: subscription refused")
+)
+
+// Config locates the broker and identifies the client.
+type Config struct {
+	// URL is tcp://host:port, or ssl://, tls:// or mqtts:// for TLS.
+	URL string
+	// ClientID identifies the session on the broker. It must be stable
+	// across restarts to resume the session; a random ID is generated
+	// when empty.
+	ClientID string
+	Username string
+	Password string
+	// QoS is the quality of service of publishes and subscriptions, 0 or 1
+	// (default 1).
+	QoS byte
+	// CleanSession discards the broker-side session on connect, dropping
+	// the subscriptions and queued messages of a previous connection.
+	CleanSession bool
+	// KeepAlive is the longest silence before the broker considers the
+	// client gone (default 30s).
+	KeepAlive time.Duration
+	// Will, when set, is published by the broker if the client vanishes.
+	Will *Will
+	// TLS configures TLS connections.
+	TLS *tls.Config
+}
+
+// ConfigFrom reads mqtt.url (default tcp://localhost:1883),
+// mqtt.client_id, mqtt.username, mqtt.password, mqtt.qos (default 1),
+// mqtt.clean_session, mqtt.keep_alive and the last will from
+// mqtt.will.topic, mqtt.will.payload, mqtt.will.qos and mqtt.will.retain.
+func ConfigFrom(cfg *aqm.Config) Config {
+	c := Config{URL: defaultURL, QoS: 1, KeepAlive: defaultKeepAlive}
+	if cfg == nil {
+		return c
+	}
+	str := func(key string) string {
+		value, _ := cfg.GetString(key)
+		return value
+	}
+	if address := str("mqtt.url"); address != "" {
+		c.URL = address
+	}
+	c.ClientID = str("mqtt.client_id")
+	c.Username = str("mqtt.username")
+	c.Password = str("mqtt.password")
+	c.QoS = byte(cfg.GetIntOrDef("mqtt.qos", int(c.QoS)))
+	c.CleanSession = cfg.GetBoolOrFalse("mqtt.clean_session")
+	c.KeepAlive = cfg.GetDurationOrDef("mqtt.keep_alive", c.KeepAlive)
+	if topic := str("mqtt.will.topic"); topic != "" {
+		c.Will = &Will{
+			Topic:   topic,
+			Payload: []byte(str("mqtt.will.payload")),
+			QoS:     byte(cfg.GetIntOrDef("mqtt.will.qos", 0)),
+			Retain:  cfg.GetBoolOrFalse("mqtt.will.retain"),
+		}
+	}
+	return c
+}
+
+// Option configures the Client.
+type Option func(*Client)
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(c *Client) {
+		if logger != nil {
+			c.log = logger
+		}
+	}
+}
+
+// WithMiddleware wraps every subscribed handler, e.g. with
+// events.Codec.Handler adapters or logging.
+func WithMiddleware(middlewares ...events.Middleware) Option {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithReconnectBackoff sets the first and the longest wait between
+// reconnection attempts (default 500ms to 30s).
+func WithReconnectBackoff(initial, max time.Duration) Option {
+	return func(c *Client) {
+		if initial > 0 {
+			c.backoff = initial
+		}
+		if max > 0 {
+			c.maxBackoff = max
+		}
+	}
+}
+
+type topicKeyType struct{}
+
+var topicKey topicKeyType
+
+// TopicFrom returns the topic a message was published to, in handlers
+// subscribed with a wildcard filter.
+func TopicFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	topic, _ := ctx.Value(topicKey).(string)
+	return topic
+}
+
+type route struct {
+	ctx     context.Context
+	filter  string
+	handler events.HandlerFunc
+	running sync.WaitGroup
+}
+
+// inflight is a packet waiting for its acknowledgement. Publishes keep
+// their packet to be resent after a reconnection; subscriptions their
+// filter.
+type inflight struct {
+	publish *publishPacket
+	sent    bool
+	filter  string
+	done    chan error
+}
+
+// Client is an MQTT client connected by Start. Stop disconnects cleanly,
+// so the broker does not publish the last will, and a Client can be handed
+// to aqm.WithLifecycle.
+type Client struct {
+	cfg         Config
+	address     string
+	useTLS      bool
+	log         aqm.Logger
+	middlewares []events.Middleware
+	backoff     time.Duration
+	maxBackoff  time.Duration
+
+	writeMu    sync.Mutex
+	mu         sync.Mutex
+	conn       net.Conn
+	routes     []*route
+	subscribed map[string]bool
+	pending    map[uint16]*inflight
+	nextID     uint16
+	started    bool
+	stopped    bool
+	stop       chan struct{}
+
+	messages    chan publishPacket
+	dispatching sync.WaitGroup
+	wg          sync.WaitGroup
+}
+
+// New builds a client; Start connects it.
+func New(cfg Config, opts ...Option) (*Client, error) {
+	if cfg.URL == "" {
+		cfg.URL = defaultURL
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: parsing url: %w", err)
+	}
+	c := &Client{
+		log:        aqm.NewNoopLogger(),
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+		subscribed: make(map[string]bool),
+		pending:    make(map[uint16]*inflight),
+		stop:       make(chan struct{}),
+		messages:   make(chan publishPacket, 64),
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if port == "" {
+			port = "1883"
+		}
+	case "ssl", "tls", "mqtts":
+		c.useTLS = true
+		if port == "" {
+			port = "8883"
+		}
+	default:
+		return nil, fmt.Errorf("mqtt: unsupported url scheme %q", u.Scheme)
+	}
+	c.address = net.JoinHostPort(u.Hostname(), port)
+	if cfg.QoS > 1 {
+		return nil, fmt.Errorf("mqtt: unsupported QoS %d", cfg.QoS)
+	}
+	if cfg.Will != nil && (!validTopic(cfg.Will.Topic) || cfg.Will.QoS > 1) {
+		return nil, errors.New("mqtt: invalid last will")
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = defaultKeepAlive
+	}
+	if cfg.ClientID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		cfg.ClientID = "aqm-" + hex.EncodeToString(id)
+	}
+	c.cfg = cfg
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c, nil
+}
+
+// Start connects to the broker, failing fast when it is unreachable or
+// refuses the connection, and keeps the client connected until Stop.
+func (c *Client) Start(ctx context.Context) error {
+	c.mu.Lock()
+	if c.started || c.stopped {
+		c.mu.Unlock()
+		return nil
+	}
+	c.started = true
+	c.mu.Unlock()
+
+	conn, sessionPresent, err := c.connect(ctx)
+	if err == nil {
+		var resend [][]byte
+		if resend, err = c.resume(conn, sessionPresent); err == nil {
+			c.dispatching.Add(1)
+			go c.dispatch()
+			go c.run(conn, resend)
+			return nil
+		}
+		conn.Close()
+	}
+	c.mu.Lock()
+	c.started = false
+	c.mu.Unlock()
+	return err
+}
+
+// Stop disconnects and waits for the running handlers up to the context
+// deadline.
+func (c *Client) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return nil
+	}
+	c.stopped = true
+	close(c.stop)
+	conn := c.conn
+	c.conn = nil
+	for _, p := range c.pending {
+		p.done <- ErrClosed
+	}
+	c.pending = map[uint16]*inflight{}
+	c.mu.Unlock()
+
+	if conn != nil {
+		c.write(conn, packet{kind: packetDisconnect}.encode())
+		conn.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		c.dispatching.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.log.Error("mqtt: handlers still running at stop", "error", ctx.Err())
+	}
+	return nil
+}
+
+// Wait blocks until the subscriptions stopped after their context ended,
+// including the handlers still running.
+func (c *Client) Wait() {
+	c.wg.Wait()
+}
+
+// HealthChecks reports the connection as a readiness check named mqtt.
+func (c *Client) HealthChecks() aqm.HealthChecks {
+	return aqm.HealthChecks{
+		Readiness: map[string]aqm.HealthCheck{
+			"mqtt": func(context.Context) error {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				if c.conn == nil {
+					return ErrNotConnected
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// connect dials and completes the CONNECT handshake, reporting whether the
+// broker resumed an existing session.
+func (c *Client) connect(ctx context.Context) (net.Conn, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return nil, false, fmt.Errorf("mqtt: dial: %w", err)
+	}
+	if c.useTLS {
+		cfg := &tls.Config{}
+		if c.cfg.TLS != nil {
+			cfg = c.cfg.TLS.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(c.address)
+		}
+		conn = tls.Client(conn, cfg)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	connect := connectPacket{
+		clientID:     c.cfg.ClientID,
+		username:     c.cfg.Username,
+		password:     c.cfg.Password,
+		cleanSession: c.cfg.CleanSession,
+		keepAlive:    uint16(c.cfg.KeepAlive / time.Second),
+		will:         c.cfg.Will,
+	}
+	if _, err := conn.Write(connect.encode()); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("mqtt: connect: %w", err)
+	}
+	p, err := readPacket(bufio.NewReaderSize(conn, 1))
+	if err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("mqtt: connect: %w", err)
+	}
+	if p.kind != packetConnack || len(p.body) != 2 {
+		conn.Close()
+		return nil, false, errors.New("mqtt: connect: expected CONNACK")
+	}
+	if code := p.body[1]; code != 0 {
+		conn.Close()
+		return nil, false, &ConnectError{Code: code}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, p.body[0]&0x01 != 0, nil
+}
+
+// run serves connections until Stop, reconnecting with backoff.
+func (c *Client) run(conn net.Conn, resend [][]byte) {
+	for {
+		err := c.serve(conn, resend)
+		c.mu.Lock()
+		c.conn = nil
+		stopped := c.stopped
+		c.mu.Unlock()
+		if stopped {
+			return
+		}
+		c.log.Error("mqtt: connection lost", "error", err)
+
+		backoff := c.backoff
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(backoff):
+			}
+			var sessionPresent bool
+			conn, sessionPresent, err = c.connect(context.Background())
+			if err == nil {
+				if resend, err = c.resume(conn, sessionPresent); err != nil {
+					conn.Close()
+					return
+				}
+				c.log.Info("mqtt: reconnected", "session_present", sessionPresent)
+				break
+			}
+			c.log.Error("mqtt: reconnecting", "error", err, "retry_in", backoff)
+			backoff = min(backoff*2, c.maxBackoff)
+		}
+	}
+}
+
+// resume makes conn the client's connection and returns the packets that
+// restore the session: subscriptions for the filters the broker does not
+// hold, then the unacknowledged publishes.
+func (c *Client) resume(conn net.Conn, sessionPresent bool) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return nil, ErrClosed
+	}
+	c.conn = conn
+	var publishes [][]byte
+	for id, p := range c.pending {
+		if p.publish != nil {
+			p.publish.dup = p.sent
+			p.sent = true
+			publishes = append(publishes, p.publish.encode())
+		} else {
+			// Subscription changes are not resent; settle their waiters.
+			delete(c.pending, id)
+			p.done <- ErrNotConnected
+		}
+	}
+	if !sessionPresent {
+		c.subscribed = make(map[string]bool)
+	}
+	var packets [][]byte
+	for _, filter := range c.filtersLocked() {
+		if !c.subscribed[filter] {
+			id := c.allocIDLocked()
+			c.pending[id] = &inflight{filter: filter, done: make(chan error, 1)}
+			packets = append(packets, subscribePacket(id, filter, c.cfg.QoS))
+		}
+	}
+	return append(packets, publishes...), nil
+}
+
+// serve sends the packets restoring the session and reads from conn until
+// it fails.
+func (c *Client) serve(conn net.Conn, resend [][]byte) error {
+	for _, packet := range resend {
+		if err := c.write(conn, packet); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.keepAlive(conn, done)
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(c.cfg.KeepAlive * 3 / 2))
+		p, err := readPacket(r)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		switch p.kind {
+		case packetPublish:
+			pub, err := decodePublish(p)
+			if err != nil {
+				conn.Close()
+				return err
+			}
+			select {
+			case c.messages <- pub:
+			case <-c.stop:
+				return ErrClosed
+			}
+		case packetPuback, packetUnsuback:
+			c.settle(p, nil)
+		case packetSuback:
+			var err error
+			if codes := p.body[min(2, len(p.body)):]; len(codes) > 0 && codes[0] == subackFailure {
+				err = ErrSubscriptionRefused
+			}
+			c.settle(p, err)
+		}
+	}
+}
+
+func (c *Client) keepAlive(conn net.Conn, done chan struct{}) {
+	ticker := time.NewTicker(c.cfg.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.write(conn, packet{kind: packetPingreq}.encode()); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) settle(p packet, err error) {
+	if len(p.body) < 2 {
+		return
+	}
+	id := uint16(p.body[0])<<8 | uint16(p.body[1])
+	c.mu.Lock()
+	pending := c.pending[id]
+	delete(c.pending, id)
+	if pending != nil && pending.filter != "" && err == nil {
+		c.subscribed[pending.filter] = true
+	}
+	c.mu.Unlock()
+	if pending == nil {
+		return
+	}
+	if err != nil && pending.filter != "" {
+		c.log.Error("mqtt: subscription refused", "filter", pending.filter)
+	}
+	pending.done <- err
+}
+
+func (c *Client) write(conn net.Conn, packet []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := conn.Write(packet)
+	return err
+}
+
+// allocIDLocked returns a packet identifier not in flight. Callers hold
+// c.mu.
+func (c *Client) allocIDLocked() uint16 {
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			continue
+		}
+		if _, busy := c.pending[c.nextID]; !busy {
+			return c.nextID
+		}
+	}
+}
+
+// filtersLocked returns the distinct filters of the active routes. Callers
+// hold c.mu.
+func (c *Client) filtersLocked() []string {
+	seen := map[string]bool{}
+	var filters []string
+	for _, r := range c.routes {
+		if !seen[r.filter] {
+			seen[r.filter] = true
+			filters = append(filters, r.filter)
+		}
+	}
+	return filters
+}
+
+// dispatch hands incoming messages to the matching routes in arrival
+// order and acknowledges QoS 1 messages once handled. Failed handlers are
+// logged: MQTT redelivers only on reconnection, so a failure does not
+// withhold the acknowledgement.
+func (c *Client) dispatch() {
+	defer c.dispatching.Done()
+	for {
+		var pub publishPacket
+		select {
+		case pub = <-c.messages:
+		case <-c.stop:
+			return
+		}
+		c.mu.Lock()
+		var matched []*route
+		for _, r := range c.routes {
+			if Match(r.filter, pub.topic) && r.ctx.Err() == nil {
+				r.running.Add(1)
+				matched = append(matched, r)
+			}
+		}
+		c.mu.Unlock()
+		for _, r := range matched {
+			if err := r.handler(context.WithValue(r.ctx, topicKey, pub.topic), pub.payload); err != nil {
+				c.log.Error("mqtt: handler failed", "topic", pub.topic, "filter", r.filter, "error", err)
+			}
+			r.running.Done()
+		}
+		if pub.qos > 0 {
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			if conn != nil {
+				c.write(conn, ackPacket(packetPuback, pub.id))
+			}
+		}
+	}
+}
+
+// Publish implements events.Publisher at the configured QoS. At QoS 1 it
+// returns once the broker acknowledged the message, waiting across
+// reconnections.
+func (c *Client) Publish(ctx context.Context, topic string, msg []byte) error {
+	return c.publish(ctx, publishPacket{topic: topic, qos: c.cfg.QoS, payload: msg})
+}
+
+// PublishRetained publishes msg as the retained message of topic, handed
+// to every future subscriber; an empty msg clears it.
+func (c *Client) PublishRetained(ctx context.Context, topic string, msg []byte) error {
+	return c.publish(ctx, publishPacket{topic: topic, qos: c.cfg.QoS, retain: true, payload: msg})
+}
+
+// BatchPublish implements events.BatchPublisher, sending the messages
+// before waiting for their acknowledgements.
+func (c *Client) BatchPublish(ctx context.Context, topic string, msgs [][]byte) error {
+	waits := make([]func() error, len(msgs))
+	for i, msg := range msgs {
+		waits[i] = c.send(publishPacket{topic: topic, qos: c.cfg.QoS, payload: msg})
+	}
+	var errs []error
+	for i, wait := range waits {
+		if err := c.await(ctx, wait); err != nil {
+			errs = append(errs, &events.PublishError{Topic: topic, Index: i, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) publish(ctx context.Context, pub publishPacket) error {
+	return c.await(ctx, c.send(pub))
+}
+
+func (c *Client) await(ctx context.Context, wait func() error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	type result struct{ err error }
+	done := make(chan result, 1)
+	go func() { done <- result{wait()} }()
+	select {
+	case r := <-done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send writes pub and returns a function waiting for its acknowledgement.
+func (c *Client) send(pub publishPacket) func() error {
+	if !validTopic(pub.topic) {
+		return func() error { return fmt.Errorf("mqtt: invalid topic %q", pub.topic) }
+	}
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return func() error { return ErrClosed }
+	}
+	conn := c.conn
+	if pub.qos == 0 {
+		c.mu.Unlock()
+		if conn == nil {
+			return func() error { return ErrNotConnected }
+		}
+		err := c.write(conn, pub.encode())
+		return func() error { return err }
+	}
+	pub.id = c.allocIDLocked()
+	p := &inflight{publish: &pub, sent: conn != nil, done: make(chan error, 1)}
+	c.pending[pub.id] = p
+	packet := pub.encode()
+	c.mu.Unlock()
+	if conn != nil {
+		// A failed write is resent by the next connection.
+		c.write(conn, packet)
+	}
+	return func() error { return <-p.done }
+}
+
+// Subscribe implements events.Subscriber for a topic filter, which may use
+// the + and # wildcards; TopicFrom tells handlers the concrete topic.
+// Several handlers may share a filter. Handlers run one message at a time
+// in arrival order, and the filter is unsubscribed once ctx is done and no
+// other handler uses it. While connected, Subscribe waits for the broker
+// to accept the filter; otherwise the next connection subscribes it.
+func (c *Client) Subscribe(ctx context.Context, topic string, handler events.HandlerFunc) error {
+	if handler == nil {
+		return errors.New("mqtt: nil handler")
+	}
+	if !validFilter(topic) {
+		return fmt.Errorf("mqtt: invalid topic filter %q", topic)
+	}
+	r := &route{ctx: ctx, filter: topic, handler: events.Chain(handler, c.middlewares...)}
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.routes = append(c.routes, r)
+	conn := c.conn
+	var p *inflight
+	var id uint16
+	if conn != nil && !c.subscribed[topic] {
+		id = c.allocIDLocked()
+		p = &inflight{filter: topic, done: make(chan error, 1)}
+		c.pending[id] = p
+	}
+	c.mu.Unlock()
+
+	if p != nil {
+		c.write(conn, subscribePacket(id, topic, c.cfg.QoS))
+		if err := c.await(ctx, func() error { return <-p.done }); err != nil && !errors.Is(err, ErrNotConnected) {
+			c.removeRoute(r)
+			return err
+		}
+	}
+	c.wg.Add(1)
+	context.AfterFunc(ctx, func() {
+		defer c.wg.Done()
+		c.removeRoute(r)
+	})
+	return nil
+}
+
+// removeRoute drops r, unsubscribing its filter when no other route uses
+// it, and waits for the broker's acknowledgement and the running handler.
+func (c *Client) removeRoute(r *route) {
+	c.mu.Lock()
+	shared := false
+	for i := 0; i < len(c.routes); i++ {
+		if c.routes[i] == r {
+			c.routes = append(c.routes[:i], c.routes[i+1:]...)
+			i--
+		} else if c.routes[i].filter == r.filter {
+			shared = true
+		}
+	}
+	conn := c.conn
+	var p *inflight
+	var id uint16
+	if !shared {
+		delete(c.subscribed, r.filter)
+		if conn != nil {
+			id = c.allocIDLocked()
+			p = &inflight{done: make(chan error, 1)}
+			c.pending[id] = p
+		}
+	}
+	c.mu.Unlock()
+	if p != nil && c.write(conn, unsubscribePacket(id, r.filter)) == nil {
+		select {
+		case <-p.done:
+		case <-c.stop:
+		case <-time.After(connectTimeout):
+		}
+	}
+	r.running.Wait()
+}
@@ -0,0 +1,481 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+type fakeSession struct {
+	filters map[string]byte
+	queued  []publishPacket
+	conn    *fakeConn
+}
+
+type fakeConn struct {
+	nc  net.Conn
+	wmu sync.Mutex
+}
+
+func (c *fakeConn) write(b []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.nc.Write(b)
+}
+
+// fakeBroker is an MQTT 3.1.1 broker for one test: persistent sessions,
+// retained messages, last wills, QoS 0/1 and filters under denied/ being
+// refused. withholdAck makes it drop the connection instead of
+// acknowledging the next QoS 1 publish.
+type fakeBroker struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	sessions    map[string]*fakeSession
+	retained    map[string]publishPacket
+	conns       map[*fakeConn]string
+	subscribes  int
+	duplicates  int
+	withholdAck bool
+	nextID      uint16
+}
+
+func newFakeBroker(t *testing.T, tlsConfig *tls.Config) *fakeBroker {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+	b := &fakeBroker{listener: l, sessions: map[string]*fakeSession{}, retained: map[string]publishPacket{}, conns: map[*fakeConn]string{}}
+	t.Cleanup(func() {
+		l.Close()
+		b.dropConnections()
+	})
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(nc)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) url(scheme string) string {
+	return scheme + "://" + b.listener.Addr().String()
+}
+
+func (b *fakeBroker) dropConnections() {
+	b.mu.Lock()
+	var conns []*fakeConn
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+	for _, c := range conns {
+		c.nc.Close()
+	}
+}
+
+func (b *fakeBroker) serve(nc net.Conn) {
+	c := &fakeConn{nc: nc}
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	p, err := readPacket(r)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+	in := &reader{data: p.body}
+	in.string()
+	in.byte()
+	flags := in.byte()
+	in.uint16()
+	clientID := in.string()
+	var will *publishPacket
+	if flags&0x04 != 0 {
+		will = &publishPacket{topic: in.string(), payload: []byte(in.string()), qos: flags >> 3 & 0x03, retain: flags&0x20 != 0}
+	}
+	if flags&0x80 != 0 && in.string() != "user" || flags&0x40 != 0 && in.string() != "secret" {
+		nc.Write(packet{kind: packetConnack, body: []byte{0, 4}}.encode())
+		return
+	}
+
+	b.mu.Lock()
+	session, present := b.sessions[clientID]
+	if !present || flags&0x02 != 0 {
+		session, present = &fakeSession{filters: map[string]byte{}}, false
+		b.sessions[clientID] = session
+	}
+	session.conn = c
+	b.conns[c] = clientID
+	var sessionPresent byte
+	if present {
+		sessionPresent = 1
+	}
+	c.write(packet{kind: packetConnack, body: []byte{sessionPresent, 0}}.encode())
+	for _, pub := range session.queued {
+		b.deliver(c, pub)
+	}
+	session.queued = nil
+	b.mu.Unlock()
+
+	clean := false
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, c)
+		if session.conn == c {
+			session.conn = nil
+		}
+		if !clean && will != nil {
+			b.route(*will)
+		}
+		b.mu.Unlock()
+	}()
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.kind {
+		case packetPublish:
+			pub, _ := decodePublish(p)
+			b.mu.Lock()
+			if pub.dup {
+				b.duplicates++
+			}
+			if pub.qos > 0 && b.withholdAck {
+				b.withholdAck = false
+				b.mu.Unlock()
+				return
+			}
+			b.route(pub)
+			b.mu.Unlock()
+			if pub.qos > 0 {
+				c.write(ackPacket(packetPuback, pub.id))
+			}
+		case packetSubscribe:
+			in := &reader{data: p.body}
+			id := in.uint16()
+			filter := in.string()
+			qos := in.byte()
+			code := qos
+			b.mu.Lock()
+			if Match("denied/#", filter) {
+				code = subackFailure
+			} else {
+				b.subscribes++
+				session.filters[filter] = qos
+			}
+			c.write(packet{kind: packetSuback, body: append(binary.BigEndian.AppendUint16(nil, id), code)}.encode())
+			if code != subackFailure {
+				for topic, pub := range b.retained {
+					if Match(filter, topic) {
+						b.deliver(c, pub)
+					}
+				}
+			}
+			b.mu.Unlock()
+		case packetUnsubscribe:
+			in := &reader{data: p.body}
+			id := in.uint16()
+			b.mu.Lock()
+			delete(session.filters, in.string())
+			b.mu.Unlock()
+			c.write(ackPacket(packetUnsuback, id))
+		case packetPingreq:
+			c.write(packet{kind: packetPingresp}.encode())
+		case packetDisconnect:
+			clean = true
+			return
+		}
+	}
+}
+
+// route delivers pub to the matching sessions. Callers hold b.mu.
+func (b *fakeBroker) route(pub publishPacket) {
+	if pub.retain {
+		if len(pub.payload) == 0 {
+			delete(b.retained, pub.topic)
+		} else {
+			b.retained[pub.topic] = pub
+		}
+	}
+	pub.retain, pub.dup = false, false
+	for _, session := range b.sessions {
+		for filter, qos := range session.filters {
+			if !Match(filter, pub.topic) {
+				continue
+			}
+			out := pub
+			out.qos = min(pub.qos, qos)
+			if session.conn != nil {
+				b.deliver(session.conn, out)
+			} else if out.qos > 0 {
+				session.queued = append(session.queued, out)
+			}
+			break
+		}
+	}
+}
+
+func (b *fakeBroker) deliver(c *fakeConn, pub publishPacket) {
+	b.nextID++
+	pub.id = b.nextID
+	c.write(pub.encode())
+}
+
+func newTestClient(t *testing.T, b *fakeBroker, mutate func(*Config)) *Client {
+	t.Helper()
+	cfg := ConfigFrom(nil)
+	cfg.URL = b.url("tcp")
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	client, err := New(cfg, WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Stop(context.Background()) })
+	return client
+}
+
+type received struct {
+	topic, payload string
+}
+
+func collect(t *testing.T, client *Client, ctx context.Context, filter string) chan received {
+	t.Helper()
+	out := make(chan received, 10)
+	err := client.Subscribe(ctx, filter, func(ctx context.Context, msg []byte) error {
+		out <- received{TopicFrom(ctx), string(msg)}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func next(t *testing.T, ch chan received) received {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return received{}
+	}
+}
+
+func TestWildcardRouting(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	client := newTestClient(t, b, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	temps := collect(t, client, ctx, "sensors/+/temp")
+	all := collect(t, client, ctx, "sensors/#")
+	if err := client.Publish(ctx, "sensors/a/temp", []byte("21")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Publish(ctx, "sensors/a/humidity", []byte("40")); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, temps); got != (received{"sensors/a/temp", "21"}) {
+		t.Errorf("temps got %v", got)
+	}
+	if got := next(t, all); got.topic != "sensors/a/temp" {
+		t.Errorf("all got %v", got)
+	}
+	if got := next(t, all); got.topic != "sensors/a/humidity" {
+		t.Errorf("all got %v", got)
+	}
+	select {
+	case got := <-temps:
+		t.Errorf("unexpected %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := client.Subscribe(ctx, "denied/x", func(context.Context, []byte) error { return nil }); !errors.Is(err, ErrSubscriptionRefused) {
+		t.Errorf("refused subscribe err = %v", err)
+	}
+	if err := client.Subscribe(ctx, "a/b#", func(context.Context, []byte) error { return nil }); err == nil {
+		t.Error("expected invalid filter error")
+	}
+	if err := client.Publish(ctx, "a/+", nil); err == nil {
+		t.Error("expected invalid topic error")
+	}
+
+	cancel()
+	client.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := len(b.sessions[client.cfg.ClientID].filters); n != 0 {
+		t.Errorf("%d filters left after unsubscribing", n)
+	}
+}
+
+func TestRetained(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	client := newTestClient(t, b, nil)
+	ctx := context.Background()
+	if err := client.PublishRetained(ctx, "devices/d1/status", []byte("online")); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, collect(t, client, ctx, "devices/+/status")); got.payload != "online" {
+		t.Errorf("retained got %v", got)
+	}
+}
+
+func TestSessionResumption(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	client := newTestClient(t, b, func(cfg *Config) { cfg.ClientID = "svc-1" })
+	publisher := newTestClient(t, b, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	commands := collect(t, client, ctx, "cmd/#")
+
+	// Drop the connections while the publisher waits for its ack: the
+	// publish is resent as a duplicate after reconnecting.
+	b.mu.Lock()
+	b.withholdAck = true
+	b.mu.Unlock()
+	if err := publisher.Publish(ctx, "cmd/reboot", []byte("now")); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, commands); got.payload != "now" {
+		t.Errorf("got %v", got)
+	}
+
+	b.dropConnections()
+	if err := publisher.Publish(ctx, "cmd/update", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, commands); got.payload != "v2" {
+		t.Errorf("got %v after reconnect", got)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.duplicates == 0 || b.subscribes != 1 {
+		t.Errorf("duplicates %d, subscribes %d: want the publish resent and the session resumed", b.duplicates, b.subscribes)
+	}
+}
+
+func TestLastWill(t *testing.T) {
+	b := newFakeBroker(t, nil)
+	watcher := newTestClient(t, b, nil)
+	wills := collect(t, watcher, context.Background(), "status/+")
+
+	will := &Will{Topic: "status/svc", Payload: []byte("offline"), QoS: 1}
+	stopped := newTestClient(t, b, func(cfg *Config) { cfg.Will = will })
+	stopped.Stop(context.Background())
+	select {
+	case got := <-wills:
+		t.Fatalf("will published after a clean stop: %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	vanished, _ := New(Config{URL: b.url("tcp"), Will: will})
+	if err := vanished.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	vanished.mu.Lock()
+	vanished.conn.Close() // the network drops, no DISCONNECT
+	vanished.mu.Unlock()
+	if got := next(t, wills); got != (received{"status/svc", "offline"}) {
+		t.Errorf("will got %v", got)
+	}
+	vanished.Stop(context.Background())
+}
+
+func TestConnectTLSAndAuth(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "broker"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	b := newFakeBroker(t, &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+
+	client := newTestClient(t, b, func(cfg *Config) {
+		cfg.URL = b.url("mqtts")
+		cfg.TLS = &tls.Config{RootCAs: pool}
+		cfg.Username, cfg.Password = "user", "secret"
+	})
+	if err := client.HealthChecks().Readiness["mqtt"](context.Background()); err != nil {
+		t.Errorf("readiness: %v", err)
+	}
+
+	refused, _ := New(Config{URL: b.url("mqtts"), TLS: &tls.Config{RootCAs: pool}, Username: "user", Password: "wrong"})
+	var connErr *ConnectError
+	if err := refused.Start(context.Background()); !errors.As(err, &connErr) || connErr.Code != 4 {
+		t.Errorf("start err = %v", err)
+	}
+	if _, err := New(Config{URL: "http://broker"}); err == nil {
+		t.Error("expected scheme error")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"+/+/c", "a/b/c", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"a/b", "a/c", false},
+	} {
+		if got := Match(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v", tc.filter, tc.topic, got)
+		}
+	}
+}
+
+func TestConfigFrom(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.Set("mqtt.url", "ssl://broker:8883")
+	cfg.Set("mqtt.client_id", "svc")
+	cfg.Set("mqtt.qos", 0)
+	cfg.Set("mqtt.will.topic", "status/svc")
+	cfg.Set("mqtt.will.payload", "offline")
+	cfg.Set("mqtt.will.retain", true)
+	got := ConfigFrom(cfg)
+	if got.URL != "ssl://broker:8883" || got.ClientID != "svc" || got.QoS != 0 ||
+		got.Will == nil || string(got.Will.Payload) != "offline" || !got.Will.Retain {
+		t.Errorf("config = %+v", got)
+	}
+}
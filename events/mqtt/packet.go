@@ -0,0 +1,290 @@
+package mqtt
+
+// This file encodes and decodes the MQTT 3.1.1 control packets the client
+// exchanges with the broker.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+
+	publishDup    = 0x08
+	publishRetain = 0x01
+
+	maxRemainingLength = 268435455
+	subackFailure      = 0x80
+)
+
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return packet{}, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: first >> 4, flags: first & 0x0F, body: body}, nil
+}
+
+func (p packet) encode() []byte {
+	buf := []byte{p.kind<<4 | p.flags}
+	length := len(p.body)
+	for {
+		b := byte(length & 0x7F)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buf, p.body...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// reader reads packet fields; the first error sticks.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errors.New("mqtt: truncated packet")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	return string(r.take(int(r.uint16())))
+}
+
+// Will is the message the broker publishes for the client when it
+// disconnects without a DISCONNECT, e.g. a device going offline.
+type Will struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+type connectPacket struct {
+	clientID     string
+	username     string
+	password     string
+	cleanSession bool
+	keepAlive    uint16
+	will         *Will
+}
+
+func (c connectPacket) encode() []byte {
+	var flags byte
+	if c.cleanSession {
+		flags |= 0x02
+	}
+	if c.will != nil {
+		flags |= 0x04 | c.will.QoS<<3
+		if c.will.Retain {
+			flags |= 0x20
+		}
+	}
+	if c.username != "" {
+		flags |= 0x80
+		if c.password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, c.keepAlive)
+	body = appendString(body, c.clientID)
+	if c.will != nil {
+		body = appendString(body, c.will.Topic)
+		body = appendString(body, string(c.will.Payload))
+	}
+	if c.username != "" {
+		body = appendString(body, c.username)
+		if c.password != "" {
+			body = appendString(body, c.password)
+		}
+	}
+	return packet{kind: packetConnect, body: body}.encode()
+}
+
+// ConnectError is a connection refused by the broker.
+type ConnectError struct {
+	Code byte
+}
+
+func (e *ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	reason, ok := reasons[e.Code]
+	if !ok {
+		reason = "unknown reason"
+	}
+	return fmt.Sprintf("mqtt: connection refused: %s (%d)", reason, e.Code)
+}
+
+type publishPacket struct {
+	topic   string
+	id      uint16
+	qos     byte
+	retain  bool
+	dup     bool
+	payload []byte
+}
+
+func (p publishPacket) encode() []byte {
+	flags := p.qos << 1
+	if p.retain {
+		flags |= publishRetain
+	}
+	if p.dup {
+		flags |= publishDup
+	}
+	body := appendString(nil, p.topic)
+	if p.qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, p.id)
+	}
+	return packet{kind: packetPublish, flags: flags, body: append(body, p.payload...)}.encode()
+}
+
+func decodePublish(p packet) (publishPacket, error) {
+	r := &reader{data: p.body}
+	pub := publishPacket{qos: p.flags >> 1 & 0x03, retain: p.flags&publishRetain != 0, dup: p.flags&publishDup != 0}
+	pub.topic = r.string()
+	if pub.qos > 0 {
+		pub.id = r.uint16()
+	}
+	pub.payload = r.data
+	return pub, r.err
+}
+
+func ackPacket(kind byte, id uint16) []byte {
+	return packet{kind: kind, body: binary.BigEndian.AppendUint16(nil, id)}.encode()
+}
+
+func subscribePacket(id uint16, filter string, qos byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	return packet{kind: packetSubscribe, flags: 0x02, body: append(body, qos)}.encode()
+}
+
+func unsubscribePacket(id uint16, filter string) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	return packet{kind: packetUnsubscribe, flags: 0x02, body: appendString(body, filter)}.encode()
+}
+
+// validTopic reports whether topic may be published to: non-empty and
+// free of wildcards.
+func validTopic(topic string) bool {
+	return topic != "" && len(topic) <= 65535 && !strings.ContainsAny(topic, "+#\x00")
+}
+
+// validFilter reports whether filter is a valid subscription: + takes a
+// whole level and # only the last one.
+func validFilter(filter string) bool {
+	if filter == "" || len(filter) > 65535 || strings.ContainsRune(filter, 0) {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether topic matches the subscription filter, honouring
+// the + (one level) and # (remaining levels) wildcards. Wildcards in the
+// first level do not match topics starting with $, such as $SYS.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,435 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchPublisher is implemented by brokers that publish several messages in
+// one round trip.
+type BatchPublisher interface {
+	BatchPublish(ctx context.Context, topic string, msgs [][]byte) error
+}
+
+// PublishError reports the message of a batch that failed to publish.
+type PublishError struct {
+	Topic string
+	Index int
+	Err   error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("events: publishing message %d to %s: %v", e.Index, e.Topic, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// BatchPublish publishes msgs to topic, in one call when publisher implements
+// BatchPublisher and one message at a time otherwise. In the latter case every
+// message is attempted and the failures are joined as *PublishError values,
+// so callers know exactly which messages were not confirmed.
+func BatchPublish(ctx context.Context, publisher Publisher, topic string, msgs [][]byte) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if batcher, ok := publisher.(BatchPublisher); ok {
+		return batcher.BatchPublish(ctx, topic, msgs)
+	}
+	var errs error
+	for i, msg := range msgs {
+		if err := publisher.Publish(ctx, topic, msg); err != nil {
+			errs = errors.Join(errs, &PublishError{Topic: topic, Index: i, Err: err})
+		}
+	}
+	return errs
+}
+
+// DropPolicy decides what AsyncPublisher.Publish does when the buffer is full.
+type DropPolicy int
+
+const (
+	// BlockWhenFull waits for room in the buffer or for ctx to end.
+	BlockWhenFull DropPolicy = iota
+	// DropNewest rejects the message being published with ErrBufferFull.
+	DropNewest
+	// DropOldest discards the oldest buffered message to make room.
+	DropOldest
+)
+
+var (
+	// ErrBufferFull is returned by AsyncPublisher.Publish under DropNewest.
+	ErrBufferFull = errors.New("events: publish buffer full")
+	// ErrPublisherClosed is returned once AsyncPublisher.Stop has been called.
+	ErrPublisherClosed = errors.New("events: publisher closed")
+)
+
+const (
+	defaultAsyncBufferSize    = 1024
+	defaultAsyncBatchSize     = 100
+	defaultAsyncFlushInterval = 100 * time.Millisecond
+)
+
+// Delivery reports the outcome of a message published by AsyncPublisher.
+// Err is nil on success.
+type Delivery struct {
+	Topic   string
+	Msg     []byte
+	Err     error
+	Latency time.Duration
+}
+
+// PublisherMetrics receives AsyncPublisher measurements.
+type PublisherMetrics interface {
+	QueueDepth(depth int)
+	PublishLatency(topic string, latency time.Duration, err error)
+}
+
+// PublisherStats is a snapshot of AsyncPublisher counters.
+type PublisherStats struct {
+	Queued    int
+	Published uint64
+	Failed    uint64
+	Dropped   uint64
+}
+
+// AsyncOption configures an AsyncPublisher.
+type AsyncOption func(*AsyncPublisher)
+
+// WithBufferSize bounds the number of buffered messages (default 1024).
+func WithBufferSize(n int) AsyncOption {
+	return func(p *AsyncPublisher) {
+		if n > 0 {
+			p.bufferSize = n
+		}
+	}
+}
+
+// WithBatchSize sets how many messages are flushed at once; a full batch is
+// flushed without waiting for the interval (default 100).
+func WithBatchSize(n int) AsyncOption {
+	return func(p *AsyncPublisher) {
+		if n > 0 {
+			p.batchSize = n
+		}
+	}
+}
+
+// WithFlushInterval sets how often buffered messages are flushed (default
+// 100ms).
+func WithFlushInterval(d time.Duration) AsyncOption {
+	return func(p *AsyncPublisher) {
+		if d > 0 {
+			p.flushInterval = d
+		}
+	}
+}
+
+// WithDropPolicy sets the behaviour when the buffer is full (default
+// BlockWhenFull).
+func WithDropPolicy(policy DropPolicy) AsyncOption {
+	return func(p *AsyncPublisher) {
+		p.policy = policy
+	}
+}
+
+// WithDeliveryCallback calls fn from the flusher goroutine for every message
+// once it was published or failed. fn must not block.
+func WithDeliveryCallback(fn func(Delivery)) AsyncOption {
+	return func(p *AsyncPublisher) {
+		p.onDelivery = fn
+	}
+}
+
+// WithPublisherMetrics reports queue depth and publish latency to metrics.
+func WithPublisherMetrics(metrics PublisherMetrics) AsyncOption {
+	return func(p *AsyncPublisher) {
+		p.metrics = metrics
+	}
+}
+
+type queuedMessage struct {
+	topic string
+	msg   []byte
+}
+
+// AsyncPublisher buffers messages and publishes them in batches from a
+// background goroutine, so Publish returns without waiting for the broker.
+// Failed deliveries are sent to Errors and to the delivery callback. Stop
+// flushes what is buffered before returning.
+type AsyncPublisher struct {
+	publisher     Publisher
+	bufferSize    int
+	batchSize     int
+	flushInterval time.Duration
+	policy        DropPolicy
+	onDelivery    func(Delivery)
+	metrics       PublisherMetrics
+
+	mu     sync.Mutex
+	queue  []queuedMessage
+	space  chan struct{}
+	closed bool
+
+	wake    chan struct{}
+	flushes chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	errs    chan Delivery
+
+	published atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewAsyncPublisher wraps publisher and starts the background flusher.
+func NewAsyncPublisher(publisher Publisher, opts ...AsyncOption) *AsyncPublisher {
+	p := &AsyncPublisher{
+		publisher:     publisher,
+		bufferSize:    defaultAsyncBufferSize,
+		batchSize:     defaultAsyncBatchSize,
+		flushInterval: defaultAsyncFlushInterval,
+		space:         make(chan struct{}),
+		wake:          make(chan struct{}, 1),
+		flushes:       make(chan chan struct{}),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+	p.errs = make(chan Delivery, p.bufferSize)
+	go p.run()
+	return p
+}
+
+// Publish buffers msg for topic. It implements Publisher; a nil error only
+// means the message was accepted, use Errors or WithDeliveryCallback for the
+// outcome.
+func (p *AsyncPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return ErrPublisherClosed
+		}
+		if len(p.queue) < p.bufferSize || p.policy != BlockWhenFull {
+			err := p.enqueueLocked(queuedMessage{topic: topic, msg: msg})
+			depth := len(p.queue)
+			p.mu.Unlock()
+			p.reportDepth(depth)
+			if depth >= p.batchSize {
+				p.signal()
+			}
+			return err
+		}
+		space := p.space
+		p.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.stop:
+			return ErrPublisherClosed
+		}
+	}
+}
+
+func (p *AsyncPublisher) enqueueLocked(m queuedMessage) error {
+	if len(p.queue) >= p.bufferSize {
+		p.dropped.Add(1)
+		if p.policy == DropNewest {
+			return ErrBufferFull
+		}
+		p.queue = p.queue[1:]
+	}
+	p.queue = append(p.queue, m)
+	return nil
+}
+
+// Errors returns a channel receiving failed deliveries. It is buffered to the
+// buffer size; failures are discarded when nobody drains it.
+func (p *AsyncPublisher) Errors() <-chan Delivery {
+	return p.errs
+}
+
+// Stats returns the current queue depth and delivery counters.
+func (p *AsyncPublisher) Stats() PublisherStats {
+	p.mu.Lock()
+	queued := len(p.queue)
+	p.mu.Unlock()
+	return PublisherStats{
+		Queued:    queued,
+		Published: p.published.Load(),
+		Failed:    p.failed.Load(),
+		Dropped:   p.dropped.Load(),
+	}
+}
+
+// Flush publishes everything buffered and waits for it, or for ctx to end.
+func (p *AsyncPublisher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case p.flushes <- done:
+	case <-p.done:
+		return ErrPublisherClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop rejects new messages, flushes the buffer and stops the flusher. It
+// returns an error when ctx ends before the buffer is drained.
+func (p *AsyncPublisher) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("events: %d messages not flushed: %w", p.Stats().Queued, ctx.Err())
+	}
+}
+
+func (p *AsyncPublisher) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *AsyncPublisher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.wake:
+			p.drain(false)
+		case <-ticker.C:
+			p.drain(false)
+		case done := <-p.flushes:
+			p.drain(true)
+			close(done)
+		case <-p.stop:
+			p.drain(true)
+			return
+		}
+	}
+}
+
+// drain publishes up to one batch, or everything when all is set.
+func (p *AsyncPublisher) drain(all bool) {
+	for {
+		p.mu.Lock()
+		n := min(len(p.queue), p.batchSize)
+		batch := append([]queuedMessage(nil), p.queue[:n]...)
+		p.queue = p.queue[n:]
+		depth := len(p.queue)
+		close(p.space)
+		p.space = make(chan struct{})
+		p.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+		p.reportDepth(depth)
+		p.publishBatch(batch)
+		if !all && depth < p.batchSize {
+			return
+		}
+	}
+}
+
+// publishBatch publishes runs of consecutive messages sharing a topic, so
+// per-topic ordering is kept.
+func (p *AsyncPublisher) publishBatch(batch []queuedMessage) {
+	ctx := context.Background()
+	for start := 0; start < len(batch); {
+		end := start + 1
+		for end < len(batch) && batch[end].topic == batch[start].topic {
+			end++
+		}
+		topic := batch[start].topic
+		msgs := make([][]byte, 0, end-start)
+		for _, m := range batch[start:end] {
+			msgs = append(msgs, m.msg)
+		}
+
+		began := time.Now()
+		err := BatchPublish(ctx, p.publisher, topic, msgs)
+		latency := time.Since(began)
+		if p.metrics != nil {
+			p.metrics.PublishLatency(topic, latency, err)
+		}
+		for i, msg := range msgs {
+			p.deliver(Delivery{Topic: topic, Msg: msg, Err: messageError(err, i), Latency: latency})
+		}
+		start = end
+	}
+}
+
+// messageError picks the error for message i from a BatchPublish result.
+func messageError(err error, i int) error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return err
+	}
+	indexed := false
+	for _, e := range joined.Unwrap() {
+		var pubErr *PublishError
+		if errors.As(e, &pubErr) {
+			indexed = true
+			if pubErr.Index == i {
+				return pubErr
+			}
+		}
+	}
+	if indexed {
+		return nil
+	}
+	return err
+}
+
+func (p *AsyncPublisher) deliver(d Delivery) {
+	if d.Err == nil {
+		p.published.Add(1)
+	} else {
+		p.failed.Add(1)
+		select {
+		case p.errs <- d:
+		default:
+		}
+	}
+	if p.onDelivery != nil {
+		p.onDelivery(d)
+	}
+}
+
+func (p *AsyncPublisher) reportDepth(depth int) {
+	if p.metrics != nil {
+		p.metrics.QueueDepth(depth)
+	}
+}
@@ -0,0 +1,275 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryPublisher struct {
+	mu      sync.Mutex
+	msgs    map[string][]string
+	fail    map[string]bool
+	block   chan struct{}
+	batches int
+}
+
+func newMemoryPublisher() *memoryPublisher {
+	return &memoryPublisher{msgs: make(map[string][]string), fail: make(map[string]bool)}
+}
+
+func (p *memoryPublisher) Publish(_ context.Context, topic string, msg []byte) error {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[string(msg)] {
+		return errors.New("broker rejected")
+	}
+	p.msgs[topic] = append(p.msgs[topic], string(msg))
+	return nil
+}
+
+func (p *memoryPublisher) published(topic string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.msgs[topic]...)
+}
+
+type batchingPublisher struct {
+	*memoryPublisher
+}
+
+func (p batchingPublisher) BatchPublish(ctx context.Context, topic string, msgs [][]byte) error {
+	p.mu.Lock()
+	p.batches++
+	p.mu.Unlock()
+	for _, msg := range msgs {
+		if err := p.Publish(ctx, topic, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBatchPublish(t *testing.T) {
+	ctx := context.Background()
+	pub := newMemoryPublisher()
+	pub.fail["b"] = true
+
+	err := BatchPublish(ctx, pub, "t", [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	var pubErr *PublishError
+	if !errors.As(err, &pubErr) || pubErr.Index != 1 || pubErr.Topic != "t" {
+		t.Fatalf("expected PublishError for index 1, got %v", err)
+	}
+	if got := pub.published("t"); fmt.Sprint(got) != "[a c]" {
+		t.Errorf("published %v, want [a c]", got)
+	}
+
+	batcher := batchingPublisher{newMemoryPublisher()}
+	if err := BatchPublish(ctx, batcher, "t", [][]byte{[]byte("x"), []byte("y")}); err != nil {
+		t.Fatalf("BatchPublish: %v", err)
+	}
+	if batcher.batches != 1 {
+		t.Errorf("expected one batch call, got %d", batcher.batches)
+	}
+	if err := BatchPublish(ctx, pub, "t", nil); err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+}
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	depths    []int
+	latencies int
+}
+
+func (m *recordingMetrics) QueueDepth(depth int) {
+	m.mu.Lock()
+	m.depths = append(m.depths, depth)
+	m.mu.Unlock()
+}
+
+func (m *recordingMetrics) PublishLatency(string, time.Duration, error) {
+	m.mu.Lock()
+	m.latencies++
+	m.mu.Unlock()
+}
+
+func TestAsyncPublisherDeliversAndFlushesOnStop(t *testing.T) {
+	pub := newMemoryPublisher()
+	pub.fail["bad"] = true
+	metrics := &recordingMetrics{}
+	var mu sync.Mutex
+	var deliveries []Delivery
+
+	async := NewAsyncPublisher(pub,
+		WithFlushInterval(time.Hour),
+		WithBatchSize(50),
+		WithPublisherMetrics(metrics),
+		WithDeliveryCallback(func(d Delivery) {
+			mu.Lock()
+			deliveries = append(deliveries, d)
+			mu.Unlock()
+		}),
+	)
+
+	ctx := context.Background()
+	for _, msg := range []string{"one", "bad", "two"} {
+		if err := async.Publish(ctx, "orders", []byte(msg)); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	if err := async.Publish(ctx, "users", []byte("u1")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := async.Stats().Queued; got != 4 {
+		t.Errorf("queued = %d, want 4 before flush", got)
+	}
+
+	if err := async.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := pub.published("orders"); fmt.Sprint(got) != "[one two]" {
+		t.Errorf("orders published %v", got)
+	}
+	if got := pub.published("users"); fmt.Sprint(got) != "[u1]" {
+		t.Errorf("users published %v", got)
+	}
+
+	stats := async.Stats()
+	if stats.Published != 3 || stats.Failed != 1 || stats.Queued != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	select {
+	case d := <-async.Errors():
+		if string(d.Msg) != "bad" || d.Err == nil {
+			t.Errorf("unexpected failed delivery %+v", d)
+		}
+	default:
+		t.Error("expected failed delivery on Errors")
+	}
+	if len(deliveries) != 4 {
+		t.Errorf("expected 4 delivery callbacks, got %d", len(deliveries))
+	}
+	if metrics.latencies != 2 || len(metrics.depths) == 0 {
+		t.Errorf("unexpected metrics %+v", metrics)
+	}
+	if err := async.Publish(ctx, "orders", []byte("late")); !errors.Is(err, ErrPublisherClosed) {
+		t.Errorf("expected ErrPublisherClosed, got %v", err)
+	}
+}
+
+func TestAsyncPublisherFlush(t *testing.T) {
+	pub := newMemoryPublisher()
+	async := NewAsyncPublisher(pub, WithFlushInterval(time.Hour))
+	defer async.Stop(context.Background())
+
+	if err := async.Publish(context.Background(), "t", []byte("m")); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := pub.published("t"); len(got) != 1 {
+		t.Errorf("expected message after flush, got %v", got)
+	}
+}
+
+func TestAsyncPublisherDropPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     DropPolicy
+		wantErr    error
+		wantOrder  string
+		wantDrops  uint64
+		publishCtx func() (context.Context, context.CancelFunc)
+	}{
+		{name: "dropNewest", policy: DropNewest, wantErr: ErrBufferFull, wantOrder: "[m0 m1]", wantDrops: 1},
+		{name: "dropOldest", policy: DropOldest, wantOrder: "[m1 m2]", wantDrops: 1},
+		{
+			name:      "block",
+			policy:    BlockWhenFull,
+			wantErr:   context.DeadlineExceeded,
+			wantOrder: "[m0 m1]",
+			publishCtx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := newMemoryPublisher()
+			async := NewAsyncPublisher(pub, WithBufferSize(2), WithBatchSize(10), WithFlushInterval(time.Hour), WithDropPolicy(tt.policy))
+
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				if err := async.Publish(ctx, "t", []byte(fmt.Sprintf("m%d", i))); err != nil {
+					t.Fatalf("Publish: %v", err)
+				}
+			}
+			if tt.publishCtx != nil {
+				var cancel context.CancelFunc
+				ctx, cancel = tt.publishCtx()
+				defer cancel()
+			}
+			if err := async.Publish(ctx, "t", []byte("m2")); !errors.Is(err, tt.wantErr) {
+				t.Errorf("third publish error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err := async.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+			if got := fmt.Sprint(pub.published("t")); got != tt.wantOrder {
+				t.Errorf("published %s, want %s", got, tt.wantOrder)
+			}
+			if got := async.Stats().Dropped; got != tt.wantDrops {
+				t.Errorf("dropped = %d, want %d", got, tt.wantDrops)
+			}
+		})
+	}
+}
+
+func TestAsyncPublisherBlockedPublishResumes(t *testing.T) {
+	pub := newMemoryPublisher()
+	async := NewAsyncPublisher(pub, WithBufferSize(1), WithBatchSize(1), WithFlushInterval(time.Hour))
+	defer async.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		if err := async.Publish(ctx, "t", []byte(fmt.Sprintf("m%d", i))); err != nil {
+			t.Fatalf("Publish %d: %v", i, err)
+		}
+	}
+	if err := async.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := pub.published("t"); len(got) != 5 {
+		t.Errorf("published %v, want 5 messages", got)
+	}
+}
+
+func TestAsyncPublisherStopTimeout(t *testing.T) {
+	pub := newMemoryPublisher()
+	pub.block = make(chan struct{})
+	async := NewAsyncPublisher(pub, WithFlushInterval(time.Hour))
+	if err := async.Publish(context.Background(), "t", []byte("m")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := async.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	close(pub.block)
+	if err := async.Stop(context.Background()); err != nil {
+		t.Errorf("second Stop: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Field types understood by Schema.
+const (
+	FieldString  = "string"
+	FieldNumber  = "number"
+	FieldBoolean = "boolean"
+	FieldObject  = "object"
+	FieldArray   = "array"
+)
+
+// ErrSchemaNotFound is returned when no schema is registered for an event type
+// and version.
+var ErrSchemaNotFound = errors.New("events: schema not found")
+
+// Schema describes the JSON payload of one version of an event type. Fields
+// maps top-level field names to their type; Required lists the fields that
+// must be present. Fields not listed are allowed.
+type Schema struct {
+	Type     string            `json:"type"`
+	Version  int               `json:"version"`
+	Fields   map[string]string `json:"fields"`
+	Required []string          `json:"required,omitempty"`
+}
+
+// Validate checks payload against the schema and returns a
+// *SchemaViolationError listing every problem found.
+func (s Schema) Validate(payload []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return &SchemaViolationError{Type: s.Type, Version: s.Version, Problems: []string{"payload is not a JSON object"}}
+	}
+	var problems []string
+	for _, name := range s.Required {
+		if raw, ok := doc[name]; !ok || string(raw) == "null" {
+			problems = append(problems, fmt.Sprintf("missing required field %q", name))
+		}
+	}
+	for name, raw := range doc {
+		want, ok := s.Fields[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		if got := jsonKind(raw); got != want {
+			problems = append(problems, fmt.Sprintf("field %q is %s, want %s", name, got, want))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &SchemaViolationError{Type: s.Type, Version: s.Version, Problems: problems}
+	}
+	return nil
+}
+
+func jsonKind(raw json.RawMessage) string {
+	switch strings.TrimSpace(string(raw))[0] {
+	case '"':
+		return FieldString
+	case '{':
+		return FieldObject
+	case '[':
+		return FieldArray
+	case 't', 'f':
+		return FieldBoolean
+	default:
+		return FieldNumber
+	}
+}
+
+// SchemaViolationError reports a payload that does not match its schema.
+type SchemaViolationError struct {
+	Type     string
+	Version  int
+	Problems []string
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("events: %s v%d payload invalid: %s", e.Type, e.Version, strings.Join(e.Problems, "; "))
+}
+
+// IncompatibleSchemaError reports a new schema version that consumers of the
+// previous version could not read.
+type IncompatibleSchemaError struct {
+	Type     string
+	Previous int
+	Version  int
+	Changes  []string
+}
+
+func (e *IncompatibleSchemaError) Error() string {
+	return fmt.Sprintf("events: %s v%d is incompatible with v%d: %s", e.Type, e.Version, e.Previous, strings.Join(e.Changes, "; "))
+}
+
+// checkCompatible rejects changes that break readers of prev: new required
+// fields and changed field types. Adding optional fields and removing fields
+// are allowed.
+func checkCompatible(prev, next Schema) error {
+	var changes []string
+	wasRequired := make(map[string]bool, len(prev.Required))
+	for _, name := range prev.Required {
+		wasRequired[name] = true
+	}
+	for _, name := range next.Required {
+		if !wasRequired[name] {
+			changes = append(changes, fmt.Sprintf("field %q became required; add it as optional first", name))
+		}
+	}
+	for name, kind := range next.Fields {
+		if old, ok := prev.Fields[name]; ok && old != kind {
+			changes = append(changes, fmt.Sprintf("field %q changed from %s to %s; add a new field instead", name, old, kind))
+		}
+	}
+	if len(changes) > 0 {
+		sort.Strings(changes)
+		return &IncompatibleSchemaError{Type: next.Type, Previous: prev.Version, Version: next.Version, Changes: changes}
+	}
+	return nil
+}
+
+// SchemaRegistry stores event schemas by type and version.
+type SchemaRegistry interface {
+	// Register adds a schema version. It fails with *IncompatibleSchemaError
+	// when the version breaks the closest earlier one.
+	Register(ctx context.Context, schema Schema) error
+	// Lookup returns the schema for an event type and version.
+	Lookup(ctx context.Context, eventType string, version int) (Schema, error)
+	// Latest returns the highest registered version of an event type.
+	Latest(ctx context.Context, eventType string) (Schema, error)
+}
+
+// MemorySchemaRegistry is an in-process SchemaRegistry.
+type MemorySchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string]map[int]Schema
+}
+
+// NewMemorySchemaRegistry builds an empty registry.
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{schemas: make(map[string]map[int]Schema)}
+}
+
+// Register implements SchemaRegistry.
+func (r *MemorySchemaRegistry) Register(_ context.Context, schema Schema) error {
+	if schema.Type == "" || schema.Version < 1 {
+		return fmt.Errorf("events: schema needs a type and a version >= 1, got %q v%d", schema.Type, schema.Version)
+	}
+	for name, kind := range schema.Fields {
+		switch kind {
+		case FieldString, FieldNumber, FieldBoolean, FieldObject, FieldArray:
+		default:
+			return fmt.Errorf("events: %s v%d field %q has unknown type %q", schema.Type, schema.Version, name, kind)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	versions := r.schemas[schema.Type]
+	if _, exists := versions[schema.Version]; exists {
+		return fmt.Errorf("events: %s v%d already registered", schema.Type, schema.Version)
+	}
+	if prev, ok := closestBelow(versions, schema.Version); ok {
+		if err := checkCompatible(prev, schema); err != nil {
+			return err
+		}
+	}
+	if versions == nil {
+		versions = make(map[int]Schema)
+		r.schemas[schema.Type] = versions
+	}
+	versions[schema.Version] = schema
+	return nil
+}
+
+// Lookup implements SchemaRegistry.
+func (r *MemorySchemaRegistry) Lookup(_ context.Context, eventType string, version int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, ok := r.schemas[eventType][version]
+	if !ok {
+		return Schema{}, fmt.Errorf("%w: %s v%d", ErrSchemaNotFound, eventType, version)
+	}
+	return schema, nil
+}
+
+// Latest implements SchemaRegistry.
+func (r *MemorySchemaRegistry) Latest(_ context.Context, eventType string) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var latest Schema
+	for version, schema := range r.schemas[eventType] {
+		if version > latest.Version {
+			latest = schema
+		}
+	}
+	if latest.Version == 0 {
+		return Schema{}, fmt.Errorf("%w: %s", ErrSchemaNotFound, eventType)
+	}
+	return latest, nil
+}
+
+func closestBelow(versions map[int]Schema, version int) (Schema, bool) {
+	var best Schema
+	for v, schema := range versions {
+		if v < version && v > best.Version {
+			best = schema
+		}
+	}
+	return best, best.Version > 0
+}
+
+// LoadSchemaRegistry builds a MemorySchemaRegistry from the *.json files in
+// dir of fsys, each holding one Schema. Use it with embed.FS to ship schemas
+// in the binary, or os.DirFS to read them from disk. Versions are registered
+// in ascending order so compatibility is checked as the history grows.
+func LoadSchemaRegistry(fsys fs.FS, dir string) (*MemorySchemaRegistry, error) {
+	matches, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("events: listing schemas: %w", err)
+	}
+	schemas := make([]Schema, 0, len(matches))
+	for _, name := range matches {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("events: reading schema %s: %w", name, err)
+		}
+		var schema Schema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("events: parsing schema %s: %w", name, err)
+		}
+		schemas = append(schemas, schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool {
+		if schemas[i].Type != schemas[j].Type {
+			return schemas[i].Type < schemas[j].Type
+		}
+		return schemas[i].Version < schemas[j].Version
+	})
+
+	registry := NewMemorySchemaRegistry()
+	for _, schema := range schemas {
+		if err := registry.Register(context.Background(), schema); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var orderCreatedV1 = Schema{
+	Type:     "order.created",
+	Version:  1,
+	Fields:   map[string]string{"id": FieldString, "total": FieldNumber},
+	Required: []string{"id"},
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		problems []string
+	}{
+		{name: "valid", payload: `{"id":"o1","total":12.5,"extra":true}`},
+		{name: "missingRequired", payload: `{"total":1}`, problems: []string{`missing required field "id"`}},
+		{name: "nullRequired", payload: `{"id":null}`, problems: []string{`missing required field "id"`}},
+		{name: "wrongType", payload: `{"id":"o1","total":"12"}`, problems: []string{`field "total" is string, want number`}},
+		{name: "notObject", payload: `[1]`, problems: []string{"payload is not a JSON object"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := orderCreatedV1.Validate([]byte(tt.payload))
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var violation *SchemaViolationError
+			if !errors.As(err, &violation) {
+				t.Fatalf("expected SchemaViolationError, got %v", err)
+			}
+			if strings.Join(violation.Problems, ",") != strings.Join(tt.problems, ",") {
+				t.Errorf("problems = %v, want %v", violation.Problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestMemorySchemaRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	if err := registry.Register(ctx, orderCreatedV1); err != nil {
+		t.Fatalf("register v1: %v", err)
+	}
+
+	compatible := Schema{
+		Type:     "order.created",
+		Version:  2,
+		Fields:   map[string]string{"id": FieldString, "total": FieldNumber, "currency": FieldString},
+		Required: []string{"id"},
+	}
+	if err := registry.Register(ctx, compatible); err != nil {
+		t.Fatalf("register v2: %v", err)
+	}
+
+	incompatible := Schema{
+		Type:     "order.created",
+		Version:  3,
+		Fields:   map[string]string{"id": FieldString, "total": FieldString},
+		Required: []string{"id", "currency"},
+	}
+	err := registry.Register(ctx, incompatible)
+	var incompat *IncompatibleSchemaError
+	if !errors.As(err, &incompat) {
+		t.Fatalf("expected IncompatibleSchemaError, got %v", err)
+	}
+	if incompat.Previous != 2 || len(incompat.Changes) != 2 {
+		t.Errorf("unexpected error %+v", incompat)
+	}
+
+	if err := registry.Register(ctx, orderCreatedV1); err == nil {
+		t.Error("expected duplicate version error")
+	}
+	if err := registry.Register(ctx, Schema{Type: "x", Version: 1, Fields: map[string]string{"a": "date"}}); err == nil {
+		t.Error("expected unknown field type error")
+	}
+
+	latest, err := registry.Latest(ctx, "order.created")
+	if err != nil || latest.Version != 2 {
+		t.Errorf("Latest = v%d, %v", latest.Version, err)
+	}
+	if _, err := registry.Lookup(ctx, "order.created", 3); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+	if _, err := registry.Latest(ctx, "missing"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+}
+
+func TestLoadSchemaRegistry(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schemas/order_v2.json": {Data: []byte(`{"type":"order.created","version":2,"fields":{"id":"string","note":"string"},"required":["id"]}`)},
+		"schemas/order_v1.json": {Data: []byte(`{"type":"order.created","version":1,"fields":{"id":"string"},"required":["id"]}`)},
+		"schemas/readme.txt":    {Data: []byte("ignored")},
+	}
+	registry, err := LoadSchemaRegistry(fsys, "schemas")
+	if err != nil {
+		t.Fatalf("LoadSchemaRegistry: %v", err)
+	}
+	if latest, _ := registry.Latest(context.Background(), "order.created"); latest.Version != 2 {
+		t.Errorf("latest version = %d, want 2", latest.Version)
+	}
+
+	fsys["schemas/order_v3.json"] = &fstest.MapFile{Data: []byte(`{"type":"order.created","version":3,"fields":{"id":"number"}}`)}
+	if _, err := LoadSchemaRegistry(fsys, "schemas"); err == nil {
+		t.Error("expected incompatible schema to fail loading")
+	}
+
+	fsys["schemas/order_v3.json"] = &fstest.MapFile{Data: []byte(`{`)}
+	if _, err := LoadSchemaRegistry(fsys, "schemas"); err == nil {
+		t.Error("expected parse error")
+	}
+}
@@ -0,0 +1,123 @@
+// Package integration runs the orchestration services together in-process.
+// The tests double as executable documentation of the events subsystem.
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmtest"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/contracts"
+	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/runtime"
+	notifications "github.com/aquamarinepk/aqm/examples/orchestration/services/notifications/app"
+	tasks "github.com/aquamarinepk/aqm/examples/orchestration/services/tasks/app"
+)
+
+// TestTaskEventsReachNotifications publishes task events to an in-memory
+// stream and consumes them with events.Consume, the way a broker-backed
+// deployment would.
+func TestTaskEventsReachNotifications(t *testing.T) {
+	h := aqmtest.NewHarness(t)
+	stream := h.Bus.Stream(contracts.TopicTasks)
+	store := events.NewMemoryCursorStore()
+
+	tasksURL := h.ServeModules(tasks.NewInMemory(stream, nil))
+	notifier := notifications.NewInMemory(nil)
+	notificationsURL := h.ServeModules(notifier)
+	h.Go("notifications consumer", func(ctx context.Context) error {
+		return notifier.Consume(ctx, stream, store, events.WithPollInterval(5*time.Millisecond), events.WithCheckpoint(1, 0))
+	})
+
+	createAndComplete(t, aqm.NewServiceClient(tasksURL), "Write docs")
+
+	client := aqm.NewServiceClient(notificationsURL)
+	aqmtest.Eventually(t, 2*time.Second, func() bool {
+		return countNotifications(t, client) == 2
+	}, "created and completed notifications")
+
+	aqmtest.Eventually(t, time.Second, func() bool {
+		seq, _, _ := store.LoadCursor(context.Background(), notifications.ConsumerName)
+		return seq == 2
+	}, "cursor checkpointed at the last event")
+}
+
+// TestNotificationsResumeFromCursor restarts the consumer with the same
+// cursor store: events handled before the restart are not replayed.
+func TestNotificationsResumeFromCursor(t *testing.T) {
+	h := aqmtest.NewHarness(t)
+	stream := h.Bus.Stream(contracts.TopicTasks)
+	store := events.NewMemoryCursorStore()
+	tasksClient := aqm.NewServiceClient(h.ServeModules(tasks.NewInMemory(stream, nil)))
+
+	createAndComplete(t, tasksClient, "Before restart")
+	first := notifications.NewInMemory(nil)
+	runUntil(t, first, stream, store, 2)
+
+	createAndComplete(t, tasksClient, "After restart")
+	restarted := notifications.NewInMemory(nil)
+	runUntil(t, restarted, stream, store, 4)
+
+	got := countNotifications(t, aqm.NewServiceClient(h.ServeModules(restarted)))
+	if got != 2 {
+		t.Fatalf("restarted consumer produced %d notifications, want 2", got)
+	}
+}
+
+// TestTaskEventsPushedOverHTTP uses the HTTP push transport the services use
+// when run as separate processes.
+func TestTaskEventsPushedOverHTTP(t *testing.T) {
+	h := aqmtest.NewHarness(t)
+	notificationsURL := h.ServeModules(notifications.NewInMemory(nil))
+	tasksURL := h.ServeModules(tasks.NewInMemory(runtime.NewHTTPPublisher(notificationsURL), nil))
+
+	createAndComplete(t, aqm.NewServiceClient(tasksURL), "Pushed")
+
+	if got := countNotifications(t, aqm.NewServiceClient(notificationsURL)); got != 2 {
+		t.Fatalf("notifications = %d, want 2", got)
+	}
+}
+
+func createAndComplete(t *testing.T, client *aqm.ServiceClient, title string) {
+	t.Helper()
+	ctx := context.Background()
+	created, err := client.Create(ctx, "tasks", map[string]string{"title": title})
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	id := created.Data.(map[string]any)["id"].(string)
+	if _, err := client.Request(ctx, http.MethodPost, "/tasks/"+id+"/complete", nil); err != nil {
+		t.Fatalf("complete task: %v", err)
+	}
+}
+
+func countNotifications(t *testing.T, client *aqm.ServiceClient) int {
+	t.Helper()
+	resp, err := client.List(context.Background(), "notifications")
+	if err != nil {
+		t.Fatalf("list notifications: %v", err)
+	}
+	list, _ := resp.Data.([]any)
+	return len(list)
+}
+
+// runUntil consumes with app until the cursor reaches seq, then stops it.
+func runUntil(t *testing.T, app *notifications.App, stream events.StreamConsumer, store events.CursorStore, seq uint64) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Consume(ctx, stream, store, events.WithPollInterval(5*time.Millisecond), events.WithCheckpoint(1, 0))
+	}()
+	aqmtest.Eventually(t, 2*time.Second, func() bool {
+		got, _, _ := store.LoadCursor(context.Background(), notifications.ConsumerName)
+		return got == seq
+	}, "consumer caught up")
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package contracts holds the DTOs and event definitions shared between the
+// orchestration services.
+package contracts
+
+import (
+	"context"
+
+	"github.com/aquamarinepk/aqm/events"
+)
+
+// TopicTasks carries every task lifecycle event.
+const TopicTasks = "tasks"
+
+// Task event types published by the Tasks service.
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskCompleted = "task.completed"
+)
+
+// TaskEvent is the payload of every task event.
+type TaskEvent struct {
+	TaskID string `json:"task_id"`
+	Title  string `json:"title"`
+}
+
+var taskEventSchema = events.Schema{
+	Version:  1,
+	Fields:   map[string]string{"task_id": events.FieldString, "title": events.FieldString},
+	Required: []string{"task_id", "title"},
+}
+
+// TaskCodec returns a codec validating task events against their v1
+// schemas. Publisher and consumers must use it so both sides agree on the
+// contract.
+func TaskCodec() *events.Codec {
+	registry := events.NewMemorySchemaRegistry()
+	for _, eventType := range []string{EventTaskCreated, EventTaskCompleted} {
+		schema := taskEventSchema
+		schema.Type = eventType
+		if err := registry.Register(context.Background(), schema); err != nil {
+			panic(err)
+		}
+	}
+	return events.NewCodec(registry)
+}
@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm/events"
+)
+
+var _ events.Publisher = (*HTTPPublisher)(nil)
+
+// HTTPPublisher pushes events to another service by POSTing each message to
+// {baseURL}/events/{topic}. It stands in for a broker in local setups; wrap it
+// in events.NewAsyncPublisher so requests do not wait on delivery.
+type HTTPPublisher struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPPublisher builds a publisher targeting baseURL.
+func NewHTTPPublisher(baseURL string) *HTTPPublisher {
+	return &HTTPPublisher{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Publish implements events.Publisher.
+func (p *HTTPPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/events/"+topic, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push event to %s: %w", topic, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("push event to %s: status %d", topic, resp.StatusCode)
+	}
+	return nil
+}
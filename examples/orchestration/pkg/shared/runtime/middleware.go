@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/aquamarinepk/aqm"
@@ -13,6 +14,17 @@ type MiddlewareConfig struct {
 	Timeout             time.Duration
 	CompressLevel       int
 	AllowedContentTypes []string
+	TrustedProxies      []netip.Prefix
+}
+
+// MiddlewareConfigFrom reads the middleware settings kept in the service
+// config, such as the http.trusted_proxies in front of the service.
+func MiddlewareConfigFrom(cfg *aqm.Config) (MiddlewareConfig, error) {
+	proxies, err := aqmmiddleware.TrustedProxiesFromConfig(cfg)
+	if err != nil {
+		return MiddlewareConfig{}, err
+	}
+	return MiddlewareConfig{TrustedProxies: proxies}, nil
 }
 
 // MiddlewareStack returns the default middleware bundle used across the
@@ -20,9 +32,10 @@ type MiddlewareConfig struct {
 func MiddlewareStack(logger aqm.Logger, cfg MiddlewareConfig) []func(http.Handler) http.Handler {
 	return aqmmiddleware.DefaultStack(aqmmiddleware.StackOptions{
 		Logger:              logger,
-		Timeout:             fallbackDuration(cfg.Timeout, 30*time.Second),
+		TimeoutDuration:     fallbackDuration(cfg.Timeout, 30*time.Second),
 		CompressLevel:       fallbackInt(cfg.CompressLevel, 5),
 		AllowedContentTypes: cfg.AllowedContentTypes,
+		TrustedProxies:      cfg.TrustedProxies,
 	})
 }
 
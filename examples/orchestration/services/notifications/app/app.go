@@ -0,0 +1,40 @@
+// Package app assembles the Notifications service outside of main so
+// integration tests can run it in-process.
+package app
+
+import (
+	"context"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/aquamarinepk/aqm/examples/orchestration/services/notifications/internal/notification"
+	"github.com/go-chi/chi/v5"
+)
+
+// ConsumerName is the cursor name the service consumes the tasks stream
+// under.
+const ConsumerName = "notifications"
+
+// App is an in-memory Notifications service.
+type App struct {
+	service *notification.Service
+	handler *notification.Handler
+}
+
+// NewInMemory builds the service with an in-memory repository.
+func NewInMemory(logger aqm.Logger) *App {
+	service := notification.NewService(notification.NewMemoryRepo(), logger, nil)
+	return &App{service: service, handler: notification.NewHandler(service, logger, nil)}
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (a *App) RegisterRoutes(r chi.Router) {
+	a.handler.RegisterRoutes(r)
+}
+
+// Consume processes the tasks stream until ctx is done, resuming from the
+// cursor kept in store.
+func (a *App) Consume(ctx context.Context, stream events.StreamConsumer, store events.CursorStore, opts ...events.ConsumeOption) error {
+	opts = append([]events.ConsumeOption{events.WithConsumerName(ConsumerName)}, opts...)
+	return events.Consume(ctx, stream, store, a.service.HandleEvents(), opts...)
+}
@@ -0,0 +1,57 @@
+package notification
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/contracts"
+	"github.com/go-chi/chi/v5"
+)
+
+// Handler wires HTTP routes for notifications.
+type Handler struct {
+	service *Service
+	logger  aqm.Logger
+	cfg     *aqm.Config
+}
+
+func NewHandler(service *Service, logger aqm.Logger, cfg *aqm.Config) *Handler {
+	if logger == nil {
+		logger = aqm.NewNoopLogger()
+	}
+	return &Handler{service: service, logger: logger, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Get("/notifications", h.handleList)
+	r.Post("/events/{topic}", h.handleEvent)
+}
+
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	notifications, err := h.service.List(r.Context())
+	if err != nil {
+		aqm.Error(w, http.StatusInternalServerError, "list_failed", err.Error())
+		return
+	}
+	aqm.Respond(w, http.StatusOK, notifications, nil)
+}
+
+// handleEvent receives events pushed by runtime.HTTPPublisher.
+func (h *Handler) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if topic := chi.URLParam(r, "topic"); topic != contracts.TopicTasks {
+		aqm.Error(w, http.StatusNotFound, "unknown_topic", "no consumer for topic "+topic)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		aqm.Error(w, http.StatusBadRequest, "invalid_payload", "Cannot read event")
+		return
+	}
+	if err := h.service.HandleEvents()(r.Context(), body); err != nil {
+		aqm.Error(w, http.StatusUnprocessableEntity, "event_rejected", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/google/uuid"
+)
+
+// Notification is a message produced from a task event.
+type Notification struct {
+	NotificationID uuid.UUID `json:"id"`
+	EventID        string    `json:"event_id"`
+	TaskID         string    `json:"task_id"`
+	Message        string    `json:"message"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// NewNotification constructs a notification for the event with eventID.
+func NewNotification(eventID, taskID, message string) *Notification {
+	return &Notification{
+		NotificationID: aqm.GenerateNewID(),
+		EventID:        eventID,
+		TaskID:         taskID,
+		Message:        message,
+		CreatedAt:      time.Now().UTC(),
+	}
+}
@@ -0,0 +1,42 @@
+package notification
+
+import (
+	"context"
+	"sync"
+)
+
+// Repo abstracts persistence for notifications.
+type Repo interface {
+	// Save stores n unless a notification for the same event exists, and
+	// reports whether it was stored.
+	Save(ctx context.Context, n *Notification) (bool, error)
+	List(ctx context.Context) ([]*Notification, error)
+}
+
+type memoryRepo struct {
+	mu            sync.RWMutex
+	notifications []*Notification
+	events        map[string]bool
+}
+
+// NewMemoryRepo builds an in-memory repository.
+func NewMemoryRepo() Repo {
+	return &memoryRepo{events: make(map[string]bool)}
+}
+
+func (r *memoryRepo) Save(_ context.Context, n *Notification) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events[n.EventID] {
+		return false, nil
+	}
+	r.events[n.EventID] = true
+	r.notifications = append(r.notifications, n)
+	return true, nil
+}
+
+func (r *memoryRepo) List(_ context.Context) ([]*Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Notification(nil), r.notifications...), nil
+}
@@ -0,0 +1,62 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/contracts"
+)
+
+// Service turns task events into notifications.
+type Service struct {
+	repo   Repo
+	log    aqm.Logger
+	config *aqm.Config
+	codec  *events.Codec
+}
+
+// NewService wires the notification service.
+func NewService(repo Repo, logger aqm.Logger, cfg *aqm.Config) *Service {
+	if logger == nil {
+		logger = aqm.NewNoopLogger()
+	}
+	return &Service{repo: repo, log: logger, config: cfg, codec: contracts.TaskCodec()}
+}
+
+func (s *Service) List(ctx context.Context) ([]*Notification, error) {
+	return s.repo.List(ctx)
+}
+
+// HandleEvents returns the handler for messages on contracts.TopicTasks.
+// Delivery is at-least-once, so events already seen are ignored.
+func (s *Service) HandleEvents() events.HandlerFunc {
+	return s.codec.Handler(s.handleTaskEvent)
+}
+
+func (s *Service) handleTaskEvent(ctx context.Context, env events.Envelope) error {
+	var payload contracts.TaskEvent
+	if err := env.Decode(&payload); err != nil {
+		return err
+	}
+
+	var message string
+	switch env.Type {
+	case contracts.EventTaskCreated:
+		message = fmt.Sprintf("Task %q was created", payload.Title)
+	case contracts.EventTaskCompleted:
+		message = fmt.Sprintf("Task %q was completed", payload.Title)
+	default:
+		return nil
+	}
+
+	stored, err := s.repo.Save(ctx, NewNotification(env.ID, payload.TaskID, message))
+	if err != nil {
+		return err
+	}
+	if !stored {
+		s.log.Debug("duplicate task event ignored", "event_id", env.ID)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/runtime"
+	"github.com/aquamarinepk/aqm/examples/orchestration/services/notifications/internal/notification"
+)
+
+const (
+	namespace  = "NOTIFICATIONS"
+	appName    = "Notifications"
+	appVersion = "v0.0.1"
+)
+
+func main() {
+	cfg, err := aqm.LoadConfig(namespace, os.Args[1:])
+	if err != nil {
+		panic(fmt.Errorf("load config: %w", err))
+	}
+
+	logLevel, _ := cfg.GetString("log.level")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	logger := aqm.NewLogger(logLevel)
+
+	middlewareCfg, err := runtime.MiddlewareConfigFrom(cfg)
+	if err != nil {
+		panic(fmt.Errorf("middleware config: %w", err))
+	}
+	stack := runtime.MiddlewareStack(logger, middlewareCfg)
+
+	service := notification.NewService(notification.NewMemoryRepo(), logger, cfg)
+	handler := notification.NewHandler(service, logger, cfg)
+
+	ms := aqm.NewMicro(
+		aqm.WithConfig(cfg),
+		aqm.WithLogger(logger),
+		aqm.WithHTTPMiddleware(stack...),
+		aqm.WithHealthChecks("notifications"),
+		aqm.WithDebugRoutes(),
+		aqm.WithHTTPServerModules("http.port", handler),
+	)
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGTSTP,
+	)
+	defer stop()
+
+	if err := ms.Run(ctx); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s (%s) stopped with error: %v\n", appName, appVersion, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,20 @@
+// Package app assembles the Tasks service outside of main so integration
+// tests can run it in-process.
+package app
+
+import (
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/aquamarinepk/aqm/examples/orchestration/services/tasks/internal/task"
+)
+
+// NewInMemory returns the Tasks HTTP module backed by an in-memory
+// repository, publishing task events to publisher when it is not nil.
+func NewInMemory(publisher events.Publisher, logger aqm.Logger) aqm.HTTPModule {
+	var opts []task.ServiceOption
+	if publisher != nil {
+		opts = append(opts, task.WithPublisher(publisher))
+	}
+	service := task.NewService(task.NewMemoryRepo(), logger, nil, opts...)
+	return task.NewHandler(service, logger, nil)
+}
@@ -3,6 +3,8 @@ package task
 import (
 	"context"
 	"errors"
+	"sort"
+	"sync"
 
 	"github.com/aquamarinepk/aqm"
 	"github.com/google/uuid"
@@ -61,3 +63,51 @@ func (r *mongoRepo) Delete(ctx context.Context, id uuid.UUID) error {
 func (r *mongoRepo) List(ctx context.Context) ([]*Task, error) {
 	return r.repo.List(ctx, nil)
 }
+
+type memoryRepo struct {
+	mu    sync.RWMutex
+	tasks map[uuid.UUID]Task
+}
+
+// NewMemoryRepo builds an in-memory repository for tests and local demos.
+func NewMemoryRepo() Repo {
+	return &memoryRepo{tasks: make(map[uuid.UUID]Task)}
+}
+
+func (r *memoryRepo) Save(_ context.Context, task *Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks[task.TaskID] = *task
+	return nil
+}
+
+func (r *memoryRepo) FindByID(_ context.Context, id uuid.UUID) (*Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &task, nil
+}
+
+func (r *memoryRepo) Delete(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tasks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.tasks, id)
+	return nil
+}
+
+func (r *memoryRepo) List(_ context.Context) ([]*Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tasks := make([]*Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		tasks = append(tasks, &task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	return tasks, nil
+}
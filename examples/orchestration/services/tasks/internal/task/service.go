@@ -5,22 +5,40 @@ import (
 	"strings"
 
 	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/contracts"
 	"github.com/google/uuid"
 )
 
 // Service contains business logic for tasks.
 type Service struct {
-	repo   Repo
-	log    aqm.Logger
-	config *aqm.Config
+	repo      Repo
+	log       aqm.Logger
+	config    *aqm.Config
+	publisher events.Publisher
+	codec     *events.Codec
+}
+
+// ServiceOption customises the task service.
+type ServiceOption func(*Service)
+
+// WithPublisher emits task events to publisher after each successful change.
+func WithPublisher(publisher events.Publisher) ServiceOption {
+	return func(s *Service) {
+		s.publisher = publisher
+	}
 }
 
 // NewService wires the task service.
-func NewService(repo Repo, logger aqm.Logger, cfg *aqm.Config) *Service {
+func NewService(repo Repo, logger aqm.Logger, cfg *aqm.Config, opts ...ServiceOption) *Service {
 	if logger == nil {
 		logger = aqm.NewNoopLogger()
 	}
-	return &Service{repo: repo, log: logger, config: cfg}
+	s := &Service{repo: repo, log: logger, config: cfg, codec: contracts.TaskCodec()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Service) List(ctx context.Context) ([]*Task, error) {
@@ -39,6 +57,7 @@ func (s *Service) Create(ctx context.Context, title, description string) (*Task,
 	if err := s.repo.Save(ctx, task); err != nil {
 		return nil, err
 	}
+	s.emit(ctx, contracts.EventTaskCreated, task)
 	return task, nil
 }
 
@@ -58,7 +77,9 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, update UpdateTask) (
 	if update.Description != nil {
 		task.Description = strings.TrimSpace(*update.Description)
 	}
+	completed := false
 	if update.Completed != nil {
+		completed = *update.Completed && !task.Completed
 		task.Completed = *update.Completed
 	}
 
@@ -67,6 +88,9 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, update UpdateTask) (
 	if err := s.repo.Save(ctx, task); err != nil {
 		return nil, err
 	}
+	if completed {
+		s.emit(ctx, contracts.EventTaskCompleted, task)
+	}
 	return task, nil
 }
 
@@ -83,3 +107,15 @@ func (s *Service) Uncomplete(ctx context.Context, id uuid.UUID) (*Task, error) {
 	done := false
 	return s.Update(ctx, id, UpdateTask{Completed: &done})
 }
+
+// emit publishes a task event. The change is already stored, so a failed
+// publish is logged rather than returned; an outbox would make it reliable.
+func (s *Service) emit(ctx context.Context, eventType string, task *Task) {
+	if s.publisher == nil {
+		return
+	}
+	payload := contracts.TaskEvent{TaskID: task.TaskID.String(), Title: task.Title}
+	if err := s.codec.Publish(ctx, s.publisher, contracts.TopicTasks, eventType, 0, payload); err != nil {
+		s.log.Error("cannot publish task event", "type", eventType, "task_id", payload.TaskID, "error", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
 	"github.com/aquamarinepk/aqm/examples/orchestration/pkg/shared/runtime"
 	"github.com/aquamarinepk/aqm/examples/orchestration/services/tasks/internal/task"
 )
@@ -30,7 +31,11 @@ func main() {
 	}
 	logger := aqm.NewLogger(logLevel)
 
-	stack := runtime.MiddlewareStack(logger, runtime.MiddlewareConfig{})
+	middlewareCfg, err := runtime.MiddlewareConfigFrom(cfg)
+	if err != nil {
+		panic(fmt.Errorf("middleware config: %w", err))
+	}
+	stack := runtime.MiddlewareStack(logger, middlewareCfg)
 
 	mongoURI, _ := cfg.GetString("mongo.uri")
 	if mongoURI == "" {
@@ -58,10 +63,17 @@ func main() {
 		panic(fmt.Errorf("new task repository: %w", err))
 	}
 
-	service := task.NewService(repo, logger, cfg)
+	var serviceOpts []task.ServiceOption
+	var publisher *events.AsyncPublisher
+	if eventsURL, _ := cfg.GetString("events.url"); eventsURL != "" {
+		publisher = events.NewAsyncPublisher(runtime.NewHTTPPublisher(eventsURL))
+		serviceOpts = append(serviceOpts, task.WithPublisher(publisher))
+	}
+
+	service := task.NewService(repo, logger, cfg, serviceOpts...)
 	handler := task.NewHandler(service, logger, cfg)
 
-	ms := aqm.NewMs(
+	ms := aqm.NewMicro(
 		aqm.WithConfig(cfg),
 		aqm.WithLogger(logger),
 		aqm.WithHTTPMiddleware(stack...),
@@ -70,6 +82,11 @@ func main() {
 		aqm.WithLifecycle(service),
 		aqm.WithHTTPServerModules("http.port", handler),
 		aqm.WithShutdown(func(ctx context.Context) error {
+			if publisher != nil {
+				if err := publisher.Stop(ctx); err != nil {
+					logger.Error("cannot flush task events", "error", err)
+				}
+			}
 			return mongoClient.Disconnect(ctx)
 		}),
 	)
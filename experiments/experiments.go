@@ -0,0 +1,337 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+const (
+	defaultExposureTopic  = "experiments.exposure"
+	defaultExposureBuffer = 1024
+
+	// VariantHeader carries the assigned variant on responses rendered through
+	// Branch, so HTMX clients and caches can tell variants apart.
+	VariantHeader = "X-Experiment-Variant"
+)
+
+var errExposureBufferFull = errors.New("experiments: exposure buffer full")
+
+// Variant is one arm of an experiment. Weight is relative to the other
+// variants; non-positive weights count as 1.
+type Variant struct {
+	Name   string
+	Weight int
+}
+
+// Exposure is published the first time a subject is assigned a variant of an
+// experiment within a request.
+type Exposure struct {
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	Subject    string    `json:"subject"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Experiments assigns subjects to experiment variants and logs exposures.
+// Exposures are published from a background goroutine so rendering never
+// waits on the broker; call Stop to flush them on shutdown.
+type Experiments struct {
+	publisher events.Publisher
+	topic     string
+	log       aqm.Logger
+	now       func() time.Time
+
+	exposures chan pendingExposure
+	done      chan struct{}
+	mu        sync.RWMutex
+	closed    bool
+}
+
+type pendingExposure struct {
+	ctx      context.Context
+	exposure Exposure
+}
+
+// Option configures Experiments.
+type Option func(*Experiments)
+
+// WithPublisher publishes exposures through publisher.
+func WithPublisher(publisher events.Publisher) Option {
+	return func(e *Experiments) {
+		e.publisher = publisher
+	}
+}
+
+// WithTopic overrides the exposure topic (defaults to experiments.exposure).
+func WithTopic(topic string) Option {
+	return func(e *Experiments) {
+		if topic != "" {
+			e.topic = topic
+		}
+	}
+}
+
+// WithLogger wires a custom logger. It falls back to a noop logger when nil.
+func WithLogger(logger aqm.Logger) Option {
+	return func(e *Experiments) {
+		if logger != nil {
+			e.log = logger
+		}
+	}
+}
+
+// New builds Experiments. Without a publisher exposures are only logged at
+// debug level.
+func New(opts ...Option) *Experiments {
+	e := &Experiments{
+		topic: defaultExposureTopic,
+		log:   aqm.NewNoopLogger(),
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(e)
+		}
+	}
+	if e.publisher != nil {
+		e.exposures = make(chan pendingExposure, defaultExposureBuffer)
+		e.done = make(chan struct{})
+		go e.publish()
+	}
+	return e
+}
+
+// Stop stops accepting exposures and waits until queued ones are published or
+// ctx is done. It satisfies aqm.Stoppable.
+func (e *Experiments) Stop(ctx context.Context) error {
+	if e.exposures == nil {
+		return nil
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.exposures)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("experiments: flush exposures: %w", ctx.Err())
+	}
+}
+
+type subjectKeyType struct{}
+
+var subjectKey subjectKeyType
+
+// subjectState is the subject of a request and the experiments it has
+// already been exposed to.
+type subjectState struct {
+	id string
+
+	mu      sync.Mutex
+	exposed map[string]struct{}
+}
+
+// WithSubject stores the user or tenant ID that assignments hash on.
+// Exposures are recorded once per experiment for the returned context.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	if ctx == nil || subject == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, subjectKey, &subjectState{id: subject})
+}
+
+// SubjectFrom returns the subject stored by WithSubject.
+func SubjectFrom(ctx context.Context) string {
+	if state := subjectFrom(ctx); state != nil {
+		return state.id
+	}
+	return ""
+}
+
+func subjectFrom(ctx context.Context) *subjectState {
+	if ctx == nil {
+		return nil
+	}
+	state, _ := ctx.Value(subjectKey).(*subjectState)
+	return state
+}
+
+// firstExposure reports whether experiment has not been exposed yet and marks
+// it as exposed.
+func (s *subjectState) firstExposure(experiment string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.exposed[experiment]; ok {
+		return false
+	}
+	if s.exposed == nil {
+		s.exposed = make(map[string]struct{})
+	}
+	s.exposed[experiment] = struct{}{}
+	return true
+}
+
+// SubjectMiddleware stores the subject extracted from each request, e.g. the
+// authenticated user ID or a tenant header.
+func SubjectMiddleware(extract func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if extract != nil {
+				if subject := extract(r); subject != "" {
+					r = r.WithContext(WithSubject(r.Context(), subject))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Assign deterministically buckets subject into one of variants by hashing
+// the experiment name and subject, so the same subject always gets the same
+// variant. It returns false when variants is empty.
+func Assign(experiment, subject string, variants []Variant) (Variant, bool) {
+	if len(variants) == 0 {
+		return Variant{}, false
+	}
+	total := uint64(0)
+	for _, v := range variants {
+		total += uint64(weightOf(v))
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(experiment))
+	h.Write([]byte{0})
+	h.Write([]byte(subject))
+	point := h.Sum64() % total
+
+	for _, v := range variants {
+		weight := uint64(weightOf(v))
+		if point < weight {
+			return v, true
+		}
+		point -= weight
+	}
+	return variants[len(variants)-1], true
+}
+
+func weightOf(v Variant) int {
+	if v.Weight <= 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// Variant returns the name of the variant assigned to the subject stored in
+// ctx and records the exposure the first time the experiment is evaluated for
+// that context. Requests without a subject get the first variant, treated as
+// control, and are not recorded.
+func (e *Experiments) Variant(ctx context.Context, experiment string, variants []Variant) string {
+	if len(variants) == 0 {
+		return ""
+	}
+	subject := subjectFrom(ctx)
+	if subject == nil {
+		return variants[0].Name
+	}
+	variant, _ := Assign(experiment, subject.id, variants)
+	if subject.firstExposure(experiment) {
+		e.expose(ctx, Exposure{
+			Experiment: experiment,
+			Variant:    variant.Name,
+			Subject:    subject.id,
+			Timestamp:  e.now().UTC(),
+		})
+	}
+	return variant.Name
+}
+
+// expose queues the exposure for publishing. It never blocks: exposures are
+// dropped when the buffer is full or Experiments is stopped.
+func (e *Experiments) expose(ctx context.Context, exposure Exposure) {
+	e.log.Debug("experiment exposure", "experiment", exposure.Experiment, "variant", exposure.Variant, "subject", exposure.Subject)
+	if e.exposures == nil {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.exposures <- pendingExposure{ctx: context.WithoutCancel(ctx), exposure: exposure}:
+	default:
+		e.log.Error("experiment exposure dropped", "experiment", exposure.Experiment, "error", errExposureBufferFull)
+	}
+}
+
+func (e *Experiments) publish() {
+	defer close(e.done)
+	for pending := range e.exposures {
+		exposure := pending.exposure
+		payload, err := json.Marshal(exposure)
+		if err != nil {
+			e.log.Error("cannot encode experiment exposure", "experiment", exposure.Experiment, "error", err)
+			continue
+		}
+		if err := e.publisher.Publish(pending.ctx, e.topic, payload); err != nil {
+			e.log.Error("cannot publish experiment exposure", "experiment", exposure.Experiment, "error", err)
+		}
+	}
+}
+
+// Branch dispatches each request to the handler registered for its variant,
+// falling back to the first variant's handler. The variant is echoed in the
+// X-Experiment-Variant header so HTMX swaps can be told apart.
+func (e *Experiments) Branch(experiment string, variants []Variant, handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := e.Variant(r.Context(), experiment, variants)
+		handler, ok := handlers[name]
+		if !ok && len(variants) > 0 {
+			handler, ok = handlers[variants[0].Name]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(VariantHeader, name)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// FuncMap exposes template helpers for equally weighted variants, to be
+// installed with template.WithFuncs:
+//
+//	{{ if inVariant .Ctx "checkout" "new" "control" "new" }}...{{ end }}
+//	{{ $v := variant .Ctx "checkout" "control" "new" }}
+func (e *Experiments) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"variant": func(ctx context.Context, experiment string, names ...string) string {
+			return e.Variant(ctx, experiment, equalVariants(names))
+		},
+		"inVariant": func(ctx context.Context, experiment, want string, names ...string) bool {
+			return e.Variant(ctx, experiment, equalVariants(names)) == want
+		},
+	}
+}
+
+func equalVariants(names []string) []Variant {
+	variants := make([]Variant, len(names))
+	for i, name := range names {
+		variants[i] = Variant{Name: name, Weight: 1}
+	}
+	return variants
+}
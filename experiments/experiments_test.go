@@ -0,0 +1,182 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingPublisher struct {
+	topics   []string
+	messages [][]byte
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, topic string, msg []byte) error {
+	p.topics = append(p.topics, topic)
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func TestAssignIsDeterministic(t *testing.T) {
+	variants := []Variant{{Name: "control"}, {Name: "new"}}
+	for i := 0; i < 20; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		first, ok := Assign("checkout", subject, variants)
+		if !ok {
+			t.Fatal("expected assignment")
+		}
+		again, _ := Assign("checkout", subject, variants)
+		if first != again {
+			t.Errorf("subject %s got %q then %q", subject, first.Name, again.Name)
+		}
+	}
+
+	if _, ok := Assign("checkout", "user-1", nil); ok {
+		t.Error("expected no assignment without variants")
+	}
+}
+
+func TestAssignRespectsWeights(t *testing.T) {
+	variants := []Variant{{Name: "control", Weight: 90}, {Name: "new", Weight: 10}}
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		v, _ := Assign("checkout", fmt.Sprintf("user-%d", i), variants)
+		counts[v.Name]++
+	}
+	if counts["new"] < 700 || counts["new"] > 1300 {
+		t.Errorf("expected roughly 10%% in new, got %v", counts)
+	}
+}
+
+func TestVariantPublishesExposure(t *testing.T) {
+	publisher := &recordingPublisher{}
+	exp := New(WithPublisher(publisher), WithTopic("exposures"))
+	variants := []Variant{{Name: "control"}, {Name: "new"}}
+
+	if got := exp.Variant(context.Background(), "checkout", variants); got != "control" {
+		t.Errorf("expected control without subject, got %q", got)
+	}
+	if len(publisher.messages) != 0 {
+		t.Fatal("expected no exposure without subject")
+	}
+
+	ctx := WithSubject(context.Background(), "user-7")
+	want, _ := Assign("checkout", "user-7", variants)
+	if got := exp.Variant(ctx, "checkout", variants); got != want.Name {
+		t.Errorf("expected %q, got %q", want.Name, got)
+	}
+	if err := exp.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if len(publisher.messages) != 1 || publisher.topics[0] != "exposures" {
+		t.Fatalf("expected one exposure on exposures, got %v", publisher.topics)
+	}
+	var exposure Exposure
+	if err := json.Unmarshal(publisher.messages[0], &exposure); err != nil {
+		t.Fatalf("decode exposure: %v", err)
+	}
+	if exposure.Experiment != "checkout" || exposure.Subject != "user-7" || exposure.Variant != want.Name {
+		t.Errorf("unexpected exposure %+v", exposure)
+	}
+}
+
+func TestBranch(t *testing.T) {
+	exp := New()
+	variants := []Variant{{Name: "control"}, {Name: "new"}}
+	handlers := map[string]http.Handler{}
+	for _, v := range variants {
+		name := v.Name
+		handlers[name] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	handler := SubjectMiddleware(func(r *http.Request) string {
+		return r.Header.Get("X-User-ID")
+	})(exp.Branch("checkout", variants, handlers))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User-ID", "user-3")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	want, _ := Assign("checkout", "user-3", variants)
+	if rec.Body.String() != want.Name || rec.Header().Get(VariantHeader) != want.Name {
+		t.Errorf("expected %q, got body %q header %q", want.Name, rec.Body.String(), rec.Header().Get(VariantHeader))
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	exp := New()
+	tmpl := template.Must(template.New("page").Funcs(exp.FuncMap()).Parse(
+		`{{ if inVariant .Ctx "checkout" "new" "control" "new" }}new{{ else }}{{ variant .Ctx "checkout" "control" "new" }}{{ end }}`,
+	))
+
+	ctx := WithSubject(context.Background(), "user-9")
+	want, _ := Assign("checkout", "user-9", equalVariants([]string{"control", "new"}))
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, map[string]any{"Ctx": ctx}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out.String() != want.Name {
+		t.Errorf("expected %q, got %q", want.Name, out.String())
+	}
+}
+
+func TestFuncMapExposesOncePerRequest(t *testing.T) {
+	publisher := &recordingPublisher{}
+	exp := New(WithPublisher(publisher))
+	tmpl := template.Must(template.New("page").Funcs(exp.FuncMap()).Parse(
+		`{{ variant .Ctx "checkout" "control" "new" }}{{ variant .Ctx "checkout" "control" "new" }}{{ variant .Ctx "banner" "off" "on" }}`,
+	))
+
+	for _, subject := range []string{"user-1", "user-2"} {
+		ctx := WithSubject(context.Background(), subject)
+		if err := tmpl.Execute(io.Discard, map[string]any{"Ctx": ctx}); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	if err := exp.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if len(publisher.messages) != 4 {
+		t.Errorf("expected one exposure per experiment and request, got %d", len(publisher.messages))
+	}
+}
+
+type blockingPublisher struct {
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, _ string, _ []byte) error {
+	<-p.release
+	return nil
+}
+
+func TestVariantDoesNotWaitForPublisher(t *testing.T) {
+	publisher := &blockingPublisher{release: make(chan struct{})}
+	exp := New(WithPublisher(publisher))
+
+	done := make(chan struct{})
+	go func() {
+		exp.Variant(WithSubject(context.Background(), "user-1"), "checkout", []Variant{{Name: "control"}, {Name: "new"}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Variant blocked on the publisher")
+	}
+
+	close(publisher.release)
+	if err := exp.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
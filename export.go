@@ -0,0 +1,349 @@
+package aqm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// ExportCSV and ExportPDF are the formats accepted by ?format=.
+	ExportCSV = "csv"
+	ExportPDF = "pdf"
+
+	csvFlushEvery = 100
+)
+
+// Table is a tabular view of a collection used for exports.
+type Table struct {
+	Title   string
+	Headers []string
+	Rows    [][]string
+}
+
+// PDFRenderer renders a table as a PDF document.
+type PDFRenderer interface {
+	RenderPDF(w io.Writer, table Table) error
+}
+
+// ExportOption configures CSV and PDF responses.
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	filename    string
+	pdf         PDFRenderer
+	rawFormulas bool
+}
+
+// WithExportFilename sets the download name without extension (defaults to
+// "export").
+func WithExportFilename(name string) ExportOption {
+	return func(c *exportConfig) {
+		if name != "" {
+			c.filename = name
+		}
+	}
+}
+
+// WithPDFRenderer overrides the PDF renderer (defaults to SimplePDFRenderer).
+func WithPDFRenderer(renderer PDFRenderer) ExportOption {
+	return func(c *exportConfig) {
+		if renderer != nil {
+			c.pdf = renderer
+		}
+	}
+}
+
+// WithRawCSVFormulas disables the formula neutralization RespondCSV applies
+// by default, for consumers that are not spreadsheets.
+func WithRawCSVFormulas() ExportOption {
+	return func(c *exportConfig) {
+		c.rawFormulas = true
+	}
+}
+
+func newExportConfig(opts []ExportOption) *exportConfig {
+	cfg := &exportConfig{filename: "export", pdf: SimplePDFRenderer{}}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	return cfg
+}
+
+func setAttachment(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+// RespondCSV streams rows as a CSV attachment, flushing periodically so large
+// exports start downloading before they are fully generated. Headers are
+// written first when not empty. Cells a spreadsheet would evaluate as a
+// formula are prefixed with a quote unless WithRawCSVFormulas is given.
+func RespondCSV(w http.ResponseWriter, rows iter.Seq[[]string], headers []string, opts ...ExportOption) error {
+	cfg := newExportConfig(opts)
+	setAttachment(w, "text/csv; charset=utf-8", cfg.filename+".csv")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	writer := csv.NewWriter(w)
+	write := writer.Write
+	if !cfg.rawFormulas {
+		write = func(record []string) error {
+			return writer.Write(neutralizeCSVFormulas(record))
+		}
+	}
+	if len(headers) > 0 {
+		if err := write(headers); err != nil {
+			return fmt.Errorf("write csv headers: %w", err)
+		}
+	}
+	count := 0
+	for row := range rows {
+		if err := write(row); err != nil {
+			return fmt.Errorf("write csv row %d: %w", count, err)
+		}
+		count++
+		if count%csvFlushEvery == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// neutralizeCSVFormulas returns record with every cell starting with =, +,
+// -, @, tab or carriage return prefixed by a quote, so spreadsheets show it
+// as text instead of evaluating it. The record is copied only when needed.
+func neutralizeCSVFormulas(record []string) []string {
+	var out []string
+	for i, cell := range record {
+		if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(record)
+		}
+		out[i] = "'" + cell
+	}
+	if out == nil {
+		return record
+	}
+	return out
+}
+
+// RespondPDF renders table as a PDF attachment. The document is rendered
+// before anything is written so failures can still produce an error response.
+func RespondPDF(w http.ResponseWriter, table Table, opts ...ExportOption) error {
+	cfg := newExportConfig(opts)
+	var buf bytes.Buffer
+	if err := cfg.pdf.RenderPDF(&buf, table); err != nil {
+		RespondError(w, http.StatusInternalServerError, "cannot render pdf")
+		return fmt.Errorf("render pdf: %w", err)
+	}
+	setAttachment(w, "application/pdf", cfg.filename+".pdf")
+	w.WriteHeader(http.StatusOK)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ExportFormat returns the export format requested through ?format=csv|pdf or
+// the Accept header, or "" for the default JSON response.
+func ExportFormat(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case ExportCSV:
+		return ExportCSV
+	case ExportPDF:
+		return ExportPDF
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return ExportCSV
+		case "application/pdf":
+			return ExportPDF
+		case "application/json", "*/*":
+			return ""
+		}
+	}
+	return ""
+}
+
+// RespondExport answers a list endpoint with data in the JSON envelope, or with
+// table as CSV or PDF when the request asks for an export.
+func RespondExport(w http.ResponseWriter, r *http.Request, data any, table Table, opts ...ExportOption) error {
+	switch ExportFormat(r) {
+	case ExportCSV:
+		return RespondCSV(w, slices.Values(table.Rows), table.Headers, opts...)
+	case ExportPDF:
+		return RespondPDF(w, table, opts...)
+	}
+	RespondSuccess(w, data)
+	return nil
+}
+
+// SimplePDFRenderer lays a table out as monospaced text on A4 pages using the
+// built-in Courier font, without external dependencies. Characters outside
+// Latin-1 are replaced with "?".
+type SimplePDFRenderer struct{}
+
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 9
+	pdfLineHeight   = 12
+	pdfCharsPerLine = 95
+)
+
+// RenderPDF implements PDFRenderer.
+func (SimplePDFRenderer) RenderPDF(w io.Writer, table Table) error {
+	lines := tableLines(table)
+	perPage := (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	var pages [][]string
+	for start := 0; start < len(lines); start += perPage {
+		pages = append(pages, lines[start:min(start+perPage, len(lines))])
+	}
+	if len(pages) == 0 {
+		pages = [][]string{{}}
+	}
+
+	// Objects: 1 catalog, 2 pages, 3 font, then a page and a content stream
+	// per page.
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	bw := bufio.NewWriter(w)
+	counter := &countingWriter{w: bw}
+	fmt.Fprint(counter, "%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = counter.n
+		fmt.Fprintf(counter, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := counter.n
+	fmt.Fprintf(counter, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(counter, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(counter, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	if counter.err != nil {
+		return counter.err
+	}
+	return bw.Flush()
+}
+
+// tableLines formats the table as fixed-width text lines.
+func tableLines(table Table) []string {
+	widths := make([]int, len(table.Headers))
+	for i, header := range table.Headers {
+		widths[i] = len([]rune(header))
+	}
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], len([]rune(cell)))
+			}
+		}
+	}
+
+	format := func(cells []string) string {
+		parts := make([]string, len(widths))
+		for i := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			parts[i] = cell + strings.Repeat(" ", widths[i]-len([]rune(cell)))
+		}
+		line := strings.TrimRight(strings.Join(parts, "  "), " ")
+		if runes := []rune(line); len(runes) > pdfCharsPerLine {
+			line = string(runes[:pdfCharsPerLine-1]) + "~"
+		}
+		return line
+	}
+
+	var lines []string
+	if table.Title != "" {
+		lines = append(lines, table.Title, "")
+	}
+	if len(table.Headers) > 0 {
+		header := format(table.Headers)
+		lines = append(lines, header, strings.Repeat("-", len([]rune(header))))
+	}
+	for _, row := range table.Rows {
+		lines = append(lines, format(row))
+	}
+	return lines
+}
+
+// pdfEscape escapes a string literal and encodes it as Latin-1, which
+// WinAnsiEncoding matches for printable characters.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += n
+	c.err = err
+	return n, err
+}
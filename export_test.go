@@ -0,0 +1,147 @@
+package aqm
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRespondCSV(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rows := [][]string{{"1", "Ada, Countess"}, {"2", `Grace "Amazing"`}}
+	if err := RespondCSV(rec, slices.Values(rows), []string{"id", "name"}, WithExportFilename("users")); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+
+	if rec.Header().Get("Content-Disposition") != `attachment; filename=users.csv` {
+		t.Errorf("unexpected disposition %q", rec.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 3 || records[1][1] != "Ada, Countess" || records[2][1] != `Grace "Amazing"` {
+		t.Errorf("unexpected records %v", records)
+	}
+}
+
+func TestRespondCSVNeutralizesFormulas(t *testing.T) {
+	rows := [][]string{{"=HYPERLINK(\"http://x\")", "+1", "-2", "@SUM(A1)", "\tx", "\rx", "ok"}}
+
+	rec := httptest.NewRecorder()
+	if err := RespondCSV(rec, slices.Values(rows), nil); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	want := []string{"'=HYPERLINK(\"http://x\")", "'+1", "'-2", "'@SUM(A1)", "'\tx", "'\rx", "ok"}
+	if len(records) != 1 || !slices.Equal(records[0], want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+	if rows[0][0] != "=HYPERLINK(\"http://x\")" {
+		t.Error("caller row was modified")
+	}
+
+	rec = httptest.NewRecorder()
+	if err := RespondCSV(rec, slices.Values(rows), nil, WithRawCSVFormulas()); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	records, _ = csv.NewReader(rec.Body).ReadAll()
+	if len(records) != 1 || records[0][1] != "+1" {
+		t.Errorf("raw records = %q", records)
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	tests := []struct {
+		query  string
+		accept string
+		want   string
+	}{
+		{query: "", want: ""},
+		{query: "?format=csv", want: ExportCSV},
+		{query: "?format=PDF", want: ExportPDF},
+		{accept: "text/csv", want: ExportCSV},
+		{accept: "application/pdf;q=0.9, text/html", want: ExportPDF},
+		{accept: "application/json, text/csv", want: ""},
+		{query: "?format=xml", accept: "text/csv", want: ExportCSV},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users"+tt.query, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := ExportFormat(req); got != tt.want {
+			t.Errorf("query %q accept %q: expected %q, got %q", tt.query, tt.accept, tt.want, got)
+		}
+	}
+}
+
+func TestRespondExport(t *testing.T) {
+	table := Table{Title: "Users", Headers: []string{"id", "name"}, Rows: [][]string{{"1", "Ada (admin)"}, {"2", "José"}}}
+	data := []map[string]string{{"id": "1"}}
+
+	tests := []struct {
+		query       string
+		contentType string
+	}{
+		{query: "", contentType: "application/json"},
+		{query: "?format=csv", contentType: "text/csv; charset=utf-8"},
+		{query: "?format=pdf", contentType: "application/pdf"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if err := RespondExport(rec, httptest.NewRequest(http.MethodGet, "/users"+tt.query, nil), data, table); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.contentType, got)
+		}
+		if tt.query == "" {
+			var resp SuccessResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Data == nil {
+				t.Errorf("expected json envelope, got %s", rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestSimplePDFRenderer(t *testing.T) {
+	rows := make([][]string, 150)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i), "name (" + strconv.Itoa(i) + ")"}
+	}
+	var buf bytes.Buffer
+	if err := (SimplePDFRenderer{}).RenderPDF(&buf, Table{Title: "Report", Headers: []string{"id", "name"}, Rows: rows}); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("expected PDF header and trailer")
+	}
+	if !strings.Contains(pdf, "/Count 3") {
+		t.Error("expected rows split over three pages")
+	}
+	if !strings.Contains(pdf, `name \(42\)`) {
+		t.Error("expected escaped parentheses")
+	}
+
+	// Every xref offset must point at its object.
+	start, _ := strconv.Atoi(regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(pdf)[1])
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllStringSubmatch(pdf[start:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if !strings.HasPrefix(pdf[offset:], strconv.Itoa(i+1)+" 0 obj") {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[offset:offset+10])
+		}
+	}
+}
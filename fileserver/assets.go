@@ -0,0 +1,393 @@
+package fileserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+const (
+	defaultEsbuildBinary = "esbuild"
+	defaultSourceDir     = "assets/src"
+	defaultOutDir        = "assets/static/dist"
+	defaultPublicPrefix  = "/static/dist"
+	defaultPollInterval  = time.Second
+	manifestFile         = "manifest.json"
+	metafileName         = "meta.json"
+)
+
+// Manifest maps logical asset names (e.g. app.js) to the fingerprinted files
+// produced by the bundler (e.g. app-5XQ2K3.js), relative to the output dir.
+type Manifest map[string]string
+
+// Resolve returns the fingerprinted path for name, or name itself when it is
+// not in the manifest.
+func (m Manifest) Resolve(name string) string {
+	if resolved, ok := m[name]; ok {
+		return resolved
+	}
+	return name
+}
+
+// LoadManifest reads a manifest written by Pipeline.Build.
+func LoadManifest(fsys fs.FS, file string) (Manifest, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, fmt.Errorf("read asset manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decode asset manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// AssetResolver turns logical asset names into public URLs.
+type AssetResolver interface {
+	AssetPath(name string) string
+}
+
+// AssetFuncs exposes the assetPath template helper, to be installed with
+// template.WithFuncs:
+//
+//	<script src="{{ assetPath "app.js" }}"></script>
+func AssetFuncs(resolver AssetResolver) template.FuncMap {
+	return template.FuncMap{"assetPath": resolver.AssetPath}
+}
+
+// StaticAssets resolves asset paths from a prebuilt manifest, typically
+// embedded in the binary for production.
+type StaticAssets struct {
+	prefix   string
+	manifest Manifest
+}
+
+// NewStaticAssets loads the manifest at file from fsys and serves paths under
+// prefix (e.g. /static/dist).
+func NewStaticAssets(fsys fs.FS, file, prefix string) (*StaticAssets, error) {
+	manifest, err := LoadManifest(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticAssets{prefix: strings.TrimRight(prefix, "/"), manifest: manifest}, nil
+}
+
+// AssetPath implements AssetResolver.
+func (s *StaticAssets) AssetPath(name string) string {
+	return s.prefix + "/" + s.manifest.Resolve(name)
+}
+
+// Pipeline bundles sources with esbuild into the static directory, writes a
+// manifest next to the bundles and, in watch mode, rebuilds when a source file
+// changes. It implements aqm.Startable and aqm.Stoppable so it can run with
+// the service in development; for production builds run Build once (see
+// BuildCommand) and embed the output.
+type Pipeline struct {
+	binary       string
+	sourceDir    string
+	outDir       string
+	publicPrefix string
+	entries      []string
+	args         []string
+	watch        bool
+	pollInterval time.Duration
+	log          aqm.Logger
+	run          func(ctx context.Context, name string, args ...string) error
+
+	mu       sync.RWMutex
+	manifest Manifest
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// PipelineOption configures a Pipeline.
+type PipelineOption func(*Pipeline)
+
+// WithEsbuildBinary overrides the esbuild executable (defaults to esbuild on
+// PATH).
+func WithEsbuildBinary(binary string) PipelineOption {
+	return func(p *Pipeline) {
+		if binary != "" {
+			p.binary = binary
+		}
+	}
+}
+
+// WithSourceDir sets the directory entries are relative to (defaults to
+// assets/src).
+func WithSourceDir(dir string) PipelineOption {
+	return func(p *Pipeline) {
+		if dir != "" {
+			p.sourceDir = dir
+		}
+	}
+}
+
+// WithOutDir sets where bundles and the manifest are written (defaults to
+// assets/static/dist).
+func WithOutDir(dir string) PipelineOption {
+	return func(p *Pipeline) {
+		if dir != "" {
+			p.outDir = dir
+		}
+	}
+}
+
+// WithPublicPrefix sets the URL the output dir is served under (defaults to
+// /static/dist).
+func WithPublicPrefix(prefix string) PipelineOption {
+	return func(p *Pipeline) {
+		if prefix != "" {
+			p.publicPrefix = strings.TrimRight(prefix, "/")
+		}
+	}
+}
+
+// WithEsbuildArgs appends extra esbuild flags, e.g. --minify or --loader.
+func WithEsbuildArgs(args ...string) PipelineOption {
+	return func(p *Pipeline) {
+		p.args = append(p.args, args...)
+	}
+}
+
+// WithWatch rebuilds whenever a file under the source dir changes, polling
+// every interval (defaults to one second).
+func WithWatch(interval time.Duration) PipelineOption {
+	return func(p *Pipeline) {
+		p.watch = true
+		if interval > 0 {
+			p.pollInterval = interval
+		}
+	}
+}
+
+// WithPipelineLogger wires a custom logger. It falls back to a noop logger
+// when nil.
+func WithPipelineLogger(logger aqm.Logger) PipelineOption {
+	return func(p *Pipeline) {
+		if logger != nil {
+			p.log = logger
+		}
+	}
+}
+
+// NewPipeline builds a pipeline bundling entries (paths relative to the source
+// dir, e.g. "app.ts", "admin/main.css").
+func NewPipeline(entries []string, opts ...PipelineOption) *Pipeline {
+	p := &Pipeline{
+		binary:       defaultEsbuildBinary,
+		sourceDir:    defaultSourceDir,
+		outDir:       defaultOutDir,
+		publicPrefix: defaultPublicPrefix,
+		entries:      entries,
+		pollInterval: defaultPollInterval,
+		log:          aqm.NewNoopLogger(),
+		run:          runCommand,
+		manifest:     Manifest{},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+	return p
+}
+
+func runCommand(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Start builds the assets and, in watch mode, keeps rebuilding on changes.
+func (p *Pipeline) Start(ctx context.Context) error {
+	if err := p.Build(ctx); err != nil {
+		return err
+	}
+	if !p.watch {
+		return nil
+	}
+	watchCtx, cancel := context.WithCancel(context.Background())
+	p.mu.Lock()
+	p.cancel, p.done = cancel, make(chan struct{})
+	done := p.done
+	p.mu.Unlock()
+	go p.watchSources(watchCtx, p.sourcesModified(), done)
+	return nil
+}
+
+// Stop ends watch mode.
+func (p *Pipeline) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Build runs esbuild once and replaces the manifest.
+func (p *Pipeline) Build(ctx context.Context) error {
+	if len(p.entries) == 0 {
+		return errors.New("asset pipeline: no entries configured")
+	}
+	if err := os.MkdirAll(p.outDir, 0o755); err != nil {
+		return fmt.Errorf("asset pipeline: create out dir: %w", err)
+	}
+
+	metafile := filepath.Join(p.outDir, metafileName)
+	args := make([]string, 0, len(p.entries)+len(p.args)+5)
+	for _, entry := range p.entries {
+		args = append(args, filepath.Join(p.sourceDir, entry))
+	}
+	args = append(args,
+		"--bundle",
+		"--outdir="+p.outDir,
+		"--outbase="+p.sourceDir,
+		"--entry-names=[dir]/[name]-[hash]",
+		"--metafile="+metafile,
+	)
+	args = append(args, p.args...)
+
+	start := time.Now()
+	if err := p.run(ctx, p.binary, args...); err != nil {
+		return fmt.Errorf("asset pipeline: %w", err)
+	}
+	manifest, err := p.manifestFrom(metafile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("asset pipeline: encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(p.outDir, manifestFile), data, 0o644); err != nil {
+		return fmt.Errorf("asset pipeline: write manifest: %w", err)
+	}
+
+	p.mu.Lock()
+	p.manifest = manifest
+	p.mu.Unlock()
+	p.log.Info("assets built", "entries", len(manifest), "duration", time.Since(start))
+	return nil
+}
+
+type esbuildMetafile struct {
+	Outputs map[string]struct {
+		EntryPoint string `json:"entryPoint"`
+		CSSBundle  string `json:"cssBundle"`
+	} `json:"outputs"`
+}
+
+// manifestFrom maps each entry to its outputs using esbuild's metafile. CSS
+// imported from a script entry is listed under the entry name with a .css
+// extension.
+func (p *Pipeline) manifestFrom(metafile string) (Manifest, error) {
+	data, err := os.ReadFile(metafile)
+	if err != nil {
+		return nil, fmt.Errorf("asset pipeline: read metafile: %w", err)
+	}
+	var meta esbuildMetafile
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("asset pipeline: decode metafile: %w", err)
+	}
+
+	manifest := Manifest{}
+	source := filepath.ToSlash(filepath.Clean(p.sourceDir)) + "/"
+	out := filepath.ToSlash(filepath.Clean(p.outDir)) + "/"
+	for output, info := range meta.Outputs {
+		if info.EntryPoint == "" || strings.HasSuffix(output, ".map") {
+			continue
+		}
+		entry := strings.TrimPrefix(filepath.ToSlash(info.EntryPoint), source)
+		base := strings.TrimSuffix(entry, path.Ext(entry))
+		manifest[base+path.Ext(output)] = strings.TrimPrefix(filepath.ToSlash(output), out)
+		if info.CSSBundle != "" {
+			manifest[base+".css"] = strings.TrimPrefix(filepath.ToSlash(info.CSSBundle), out)
+		}
+	}
+	return manifest, nil
+}
+
+// Manifest returns the manifest of the last successful build.
+func (p *Pipeline) Manifest() Manifest {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.manifest
+}
+
+// AssetPath implements AssetResolver using the latest build.
+func (p *Pipeline) AssetPath(name string) string {
+	return p.publicPrefix + "/" + p.Manifest().Resolve(name)
+}
+
+func (p *Pipeline) watchSources(ctx context.Context, last time.Time, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modified := p.sourcesModified()
+			if !modified.After(last) {
+				continue
+			}
+			last = modified
+			if err := p.Build(ctx); err != nil && ctx.Err() == nil {
+				// Keep serving the previous bundles until the sources compile.
+				p.log.Error("asset rebuild failed", "error", err)
+			}
+		}
+	}
+}
+
+func (p *Pipeline) sourcesModified() time.Time {
+	var latest time.Time
+	filepath.WalkDir(p.sourceDir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
+
+// BuildCommand exposes Build as the assets:build subcommand, for producing the
+// bundles and manifest before embedding them in a release binary.
+func BuildCommand(p *Pipeline) aqm.Command {
+	return aqm.Command{
+		Name:  "assets:build",
+		Usage: "bundle static assets with esbuild and write the manifest",
+		Run: func(ctx context.Context, _ *aqm.Deps, _ []string) error {
+			return p.Build(ctx)
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package fileserver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeEsbuild writes the metafile esbuild would produce for app.ts.
+func fakeEsbuild(t *testing.T, srcDir, outDir string, builds *atomic.Int32) func(context.Context, string, ...string) error {
+	return func(_ context.Context, name string, args ...string) error {
+		n := builds.Add(1)
+		if name != "esbuild" || !strings.Contains(strings.Join(args, " "), "--bundle") {
+			t.Errorf("unexpected command %s %v", name, args)
+		}
+		js := filepath.Join(outDir, "app-HASH"+string(rune('0'+n))+".js")
+		meta := map[string]any{"outputs": map[string]any{
+			js:                                   map[string]string{"entryPoint": filepath.Join(srcDir, "app.ts"), "cssBundle": filepath.Join(outDir, "app-CSS.css")},
+			js + ".map":                          map[string]string{},
+			filepath.Join(outDir, "app-CSS.css"): map[string]string{},
+		}}
+		data, _ := json.Marshal(meta)
+		return os.WriteFile(filepath.Join(outDir, metafileName), data, 0o644)
+	}
+}
+
+func TestPipelineBuildWritesManifest(t *testing.T) {
+	dir := t.TempDir()
+	srcDir, outDir := filepath.Join(dir, "src"), filepath.Join(dir, "dist")
+	os.MkdirAll(srcDir, 0o755)
+
+	var builds atomic.Int32
+	p := NewPipeline([]string{"app.ts"}, WithSourceDir(srcDir), WithOutDir(outDir))
+	p.run = fakeEsbuild(t, srcDir, outDir, &builds)
+
+	if err := p.Build(context.Background()); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := p.AssetPath("app.js"); got != "/static/dist/app-HASH1.js" {
+		t.Errorf("unexpected js path %q", got)
+	}
+	if got := p.AssetPath("app.css"); got != "/static/dist/app-CSS.css" {
+		t.Errorf("unexpected css path %q", got)
+	}
+	if got := p.AssetPath("missing.js"); got != "/static/dist/missing.js" {
+		t.Errorf("expected unknown asset to pass through, got %q", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, manifestFile))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	static, err := NewStaticAssets(fstest.MapFS{"dist/manifest.json": {Data: data}}, "dist/manifest.json", "/assets/")
+	if err != nil {
+		t.Fatalf("static assets: %v", err)
+	}
+	if got := static.AssetPath("app.js"); got != "/assets/app-HASH1.js" {
+		t.Errorf("unexpected static path %q", got)
+	}
+	if fn, ok := AssetFuncs(static)["assetPath"].(func(string) string); !ok || fn("app.css") != "/assets/app-CSS.css" {
+		t.Error("expected assetPath helper")
+	}
+}
+
+func TestPipelineWatchRebuilds(t *testing.T) {
+	dir := t.TempDir()
+	srcDir, outDir := filepath.Join(dir, "src"), filepath.Join(dir, "dist")
+	os.MkdirAll(srcDir, 0o755)
+	source := filepath.Join(srcDir, "app.ts")
+	os.WriteFile(source, []byte("export {}"), 0o644)
+
+	var builds atomic.Int32
+	p := NewPipeline([]string{"app.ts"}, WithSourceDir(srcDir), WithOutDir(outDir), WithWatch(5*time.Millisecond))
+	p.run = fakeEsbuild(t, srcDir, outDir, &builds)
+
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer p.Stop(context.Background())
+
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(source, future, future)
+
+	deadline := time.Now().Add(time.Second)
+	for builds.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if builds.Load() < 2 {
+		t.Fatal("expected a rebuild after the source changed")
+	}
+	if err := p.Stop(context.Background()); err != nil {
+		t.Errorf("stop: %v", err)
+	}
+}
+
+func TestPipelineBuildErrors(t *testing.T) {
+	if err := NewPipeline(nil).Build(context.Background()); err == nil {
+		t.Error("expected error without entries")
+	}
+
+	p := NewPipeline([]string{"app.ts"}, WithOutDir(t.TempDir()), WithEsbuildBinary("esbuild-does-not-exist"))
+	if err := p.Build(context.Background()); err == nil {
+		t.Error("expected error when esbuild cannot run")
+	}
+}
@@ -0,0 +1,341 @@
+// Package filter parses a small, safe filter expression language for list
+// endpoints, e.g.
+//
+//	status eq 'open' and (priority ge 3 or assignee eq null) and createdAt gt 2024-01-01
+//
+// Parsing produces an AST checked against a Schema of allowed fields and their
+// types. Repositories translate the AST to their native query language (see
+// ToMongo) so user input never reaches the database verbatim.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxLength = 1024
+	defaultMaxDepth  = 16
+	queryParam       = "filter"
+)
+
+// ErrInvalidFilter wraps every parse and validation failure.
+var ErrInvalidFilter = errors.New("filter: invalid expression")
+
+// Type is the value type of a filterable field.
+type Type int
+
+const (
+	String Type = iota
+	Number
+	Bool
+	Time
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	case Bool:
+		return "bool"
+	case Time:
+		return "time"
+	default:
+		return "unknown"
+	}
+}
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	OpEq         Op = "eq"
+	OpNe         Op = "ne"
+	OpGt         Op = "gt"
+	OpGe         Op = "ge"
+	OpLt         Op = "lt"
+	OpLe         Op = "le"
+	OpIn         Op = "in"
+	OpContains   Op = "contains"
+	OpStartsWith Op = "startswith"
+)
+
+var comparisonOps = map[string]Op{
+	"eq": OpEq, "ne": OpNe, "gt": OpGt, "ge": OpGe, "lt": OpLt, "le": OpLe,
+	"in": OpIn, "contains": OpContains, "startswith": OpStartsWith,
+}
+
+// Field describes a filterable field. Storage optionally renames the field in
+// the backing store (e.g. createdAt -> created_at).
+type Field struct {
+	Type    Type
+	Storage string
+}
+
+// Schema is the allowlist of fields that may appear in expressions.
+type Schema map[string]Field
+
+func (s Schema) storageName(name string) string {
+	if f, ok := s[name]; ok && f.Storage != "" {
+		return f.Storage
+	}
+	return name
+}
+
+// Node is an element of the filter AST.
+type Node interface {
+	node()
+}
+
+// Logical joins child expressions with "and" or "or".
+type Logical struct {
+	Op       string
+	Children []Node
+}
+
+// Not negates its child expression.
+type Not struct {
+	Child Node
+}
+
+// Comparison compares a field against a typed value. Value is nil for null,
+// a string, float64, bool, time.Time, or a []any for the in operator.
+type Comparison struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+func (Logical) node()    {}
+func (Not) node()        {}
+func (Comparison) node() {}
+
+// Parse parses and type-checks expr against schema. An empty expression
+// yields a nil Node.
+func Parse(expr string, schema Schema) (Node, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+	if len(expr) > defaultMaxLength {
+		return nil, fmt.Errorf("%w: expression longer than %d characters", ErrInvalidFilter, defaultMaxLength)
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, schema: schema}
+	node, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidFilter, tok.text, tok.pos)
+	}
+	return node, nil
+}
+
+// FromRequest parses the "filter" query parameter of r.
+func FromRequest(r *http.Request, schema Schema) (Node, error) {
+	return Parse(r.URL.Query().Get(queryParam), schema)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	schema Schema
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	if tok.kind == tokIdent && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr(depth int) (Node, error) {
+	return p.parseLogical(depth, "or", p.parseAnd)
+}
+
+func (p *parser) parseAnd(depth int) (Node, error) {
+	return p.parseLogical(depth, "and", p.parseUnary)
+}
+
+func (p *parser) parseLogical(depth int, op string, operand func(int) (Node, error)) (Node, error) {
+	first, err := operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	children := []Node{first}
+	for p.keyword(op) {
+		child, err := operand(depth)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return Logical{Op: op, Children: children}, nil
+}
+
+func (p *parser) parseUnary(depth int) (Node, error) {
+	if depth > defaultMaxDepth {
+		return nil, fmt.Errorf("%w: expression nested deeper than %d levels", ErrInvalidFilter, defaultMaxDepth)
+	}
+	if p.keyword("not") {
+		child, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Child: child}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		node, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, fmt.Errorf("%w: expected ')' at position %d", ErrInvalidFilter, tok.pos)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokIdent {
+		return nil, fmt.Errorf("%w: expected field name at position %d", ErrInvalidFilter, fieldTok.pos)
+	}
+	field, ok := p.schema[fieldTok.text]
+	if !ok {
+		return nil, fmt.Errorf("%w: field %q is not filterable", ErrInvalidFilter, fieldTok.text)
+	}
+
+	opTok := p.next()
+	op, ok := comparisonOps[strings.ToLower(opTok.text)]
+	if opTok.kind != tokIdent || !ok {
+		return nil, fmt.Errorf("%w: unknown operator %q at position %d", ErrInvalidFilter, opTok.text, opTok.pos)
+	}
+	if err := checkOperator(fieldTok.text, field.Type, op); err != nil {
+		return nil, err
+	}
+
+	if op == OpIn {
+		values, err := p.parseList(fieldTok.text, field.Type)
+		if err != nil {
+			return nil, err
+		}
+		return Comparison{Field: fieldTok.text, Op: op, Value: values}, nil
+	}
+
+	value, err := p.parseValue(fieldTok.text, field.Type)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil && op != OpEq && op != OpNe {
+		return nil, fmt.Errorf("%w: null only supports eq and ne", ErrInvalidFilter)
+	}
+	return Comparison{Field: fieldTok.text, Op: op, Value: value}, nil
+}
+
+func (p *parser) parseList(field string, typ Type) ([]any, error) {
+	if tok := p.next(); tok.kind != tokLParen {
+		return nil, fmt.Errorf("%w: expected '(' after in at position %d", ErrInvalidFilter, tok.pos)
+	}
+	var values []any
+	for {
+		value, err := p.parseValue(field, typ)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		tok := p.next()
+		if tok.kind == tokRParen {
+			return values, nil
+		}
+		if tok.kind != tokComma {
+			return nil, fmt.Errorf("%w: expected ',' or ')' at position %d", ErrInvalidFilter, tok.pos)
+		}
+	}
+}
+
+func (p *parser) parseValue(field string, typ Type) (any, error) {
+	tok := p.next()
+	if tok.kind == tokIdent && strings.EqualFold(tok.text, "null") {
+		return nil, nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("%w: field %q expects a %s value, got %q", ErrInvalidFilter, field, typ, tok.text)
+	}
+	switch typ {
+	case String:
+		if tok.kind != tokString {
+			return nil, mismatch()
+		}
+		return tok.text, nil
+	case Number:
+		if tok.kind != tokNumber {
+			return nil, mismatch()
+		}
+		return tok.number, nil
+	case Bool:
+		if tok.kind != tokIdent {
+			return nil, mismatch()
+		}
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, mismatch()
+	case Time:
+		if tok.kind != tokString && tok.kind != tokIdent && tok.kind != tokNumber {
+			return nil, mismatch()
+		}
+		if t, err := time.Parse(time.RFC3339, tok.text); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse(time.DateOnly, tok.text); err == nil {
+			return t, nil
+		}
+		return nil, mismatch()
+	default:
+		return nil, mismatch()
+	}
+}
+
+func checkOperator(field string, typ Type, op Op) error {
+	switch op {
+	case OpContains, OpStartsWith:
+		if typ != String {
+			return fmt.Errorf("%w: operator %s requires a string field, %q is %s", ErrInvalidFilter, op, field, typ)
+		}
+	case OpGt, OpGe, OpLt, OpLe:
+		if typ == Bool {
+			return fmt.Errorf("%w: operator %s is not supported on bool field %q", ErrInvalidFilter, op, field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testSchema = Schema{
+	"status":    {Type: String},
+	"title":     {Type: String},
+	"priority":  {Type: Number},
+	"archived":  {Type: Bool},
+	"createdAt": {Type: Time, Storage: "created_at"},
+}
+
+func TestParse(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		want Node
+	}{
+		{
+			name: "empty",
+			expr: "  ",
+			want: nil,
+		},
+		{
+			name: "singleComparison",
+			expr: "status eq 'open'",
+			want: Comparison{Field: "status", Op: OpEq, Value: "open"},
+		},
+		{
+			name: "andWithDate",
+			expr: "status eq 'open' and createdAt gt 2024-01-01",
+			want: Logical{Op: "and", Children: []Node{
+				Comparison{Field: "status", Op: OpEq, Value: "open"},
+				Comparison{Field: "createdAt", Op: OpGt, Value: created},
+			}},
+		},
+		{
+			name: "precedence",
+			expr: "archived eq false or priority ge 3 and not (title contains 'it''s')",
+			want: Logical{Op: "or", Children: []Node{
+				Comparison{Field: "archived", Op: OpEq, Value: false},
+				Logical{Op: "and", Children: []Node{
+					Comparison{Field: "priority", Op: OpGe, Value: 3.0},
+					Not{Child: Comparison{Field: "title", Op: OpContains, Value: "it's"}},
+				}},
+			}},
+		},
+		{
+			name: "inList",
+			expr: "status in ('open', 'closed')",
+			want: Comparison{Field: "status", Op: OpIn, Value: []any{"open", "closed"}},
+		},
+		{
+			name: "null",
+			expr: "title ne null",
+			want: Comparison{Field: "title", Op: OpNe, Value: nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.expr, testSchema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "unknownField", expr: "secret eq 'x'"},
+		{name: "unknownOperator", expr: "status like 'x'"},
+		{name: "typeMismatch", expr: "priority eq 'high'"},
+		{name: "badDate", expr: "createdAt gt yesterday"},
+		{name: "containsOnNumber", expr: "priority contains 3"},
+		{name: "orderingOnBool", expr: "archived gt true"},
+		{name: "nullOrdering", expr: "priority gt null"},
+		{name: "infinity", expr: "priority lt inf"},
+		{name: "negativeInfinity", expr: "priority gt -Infinity"},
+		{name: "notANumber", expr: "priority eq NaN"},
+		{name: "unterminatedString", expr: "status eq 'open"},
+		{name: "unbalancedParen", expr: "(status eq 'open'"},
+		{name: "trailingTokens", expr: "status eq 'open' status"},
+		{name: "badCharacter", expr: "status eq 'open'; drop"},
+		{name: "tooDeep", expr: "not not not not not not not not not not not not not not not not not not status eq 'x'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.expr, testSchema); !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("expected ErrInvalidFilter, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/items?filter=priority+lt+5", nil)
+	got, err := FromRequest(req, testSchema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Comparison{Field: "priority", Op: OpLt, Value: 5.0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+}
+
+func TestToMongo(t *testing.T) {
+	node, err := Parse("createdAt le 2024-01-01T10:00:00Z and not title startswith 'a.b' or status in ('open')", testSchema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	want := bson.M{"$or": bson.A{
+		bson.M{"$and": bson.A{
+			bson.M{"created_at": bson.M{"$lte": created}},
+			bson.M{"$nor": bson.A{bson.M{"title": bson.M{"$regex": `^a\.b`}}}},
+		}},
+		bson.M{"status": bson.M{"$in": bson.A{"open"}}},
+	}}
+
+	if got := ToMongo(node, testSchema); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := ToMongo(nil, testSchema); len(got) != 0 {
+		t.Errorf("expected empty filter, got %v", got)
+	}
+}
@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number float64
+	pos    int
+}
+
+// lex splits expr into tokens. Bare words (field names, keywords, numbers and
+// unquoted dates) share one token class and are classified afterwards.
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		case c == '\'':
+			text, end, err := lexString(expr, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i = end
+		case isWordChar(c):
+			start := i
+			for i < len(expr) && isWordChar(expr[i]) {
+				i++
+			}
+			word := expr[start:i]
+			// ParseFloat accepts "inf" and "nan", which are not numbers a
+			// filter can compare against.
+			if n, err := strconv.ParseFloat(word, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+				tokens = append(tokens, token{kind: tokNumber, text: word, number: n, pos: start})
+				continue
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: word, pos: start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at position %d", ErrInvalidFilter, c, i)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// lexString reads a single-quoted literal starting at expr[start]. A doubled
+// quote character escapes it.
+func lexString(expr string, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(expr); i++ {
+		if expr[i] != '\'' {
+			b.WriteByte(expr[i])
+			continue
+		}
+		if i+1 < len(expr) && expr[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidFilter, start)
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == '+' || c == ':'
+}
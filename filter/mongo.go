@@ -0,0 +1,43 @@
+package filter
+
+import (
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var mongoOps = map[Op]string{
+	OpEq: "$eq", OpNe: "$ne", OpGt: "$gt", OpGe: "$gte", OpLt: "$lt", OpLe: "$lte", OpIn: "$in",
+}
+
+// ToMongo translates a parsed expression into a Mongo query document, mapping
+// field names through schema. A nil node matches everything.
+func ToMongo(node Node, schema Schema) bson.M {
+	if node == nil {
+		return bson.M{}
+	}
+	switch n := node.(type) {
+	case Logical:
+		children := make(bson.A, 0, len(n.Children))
+		for _, child := range n.Children {
+			children = append(children, ToMongo(child, schema))
+		}
+		return bson.M{"$" + n.Op: children}
+	case Not:
+		return bson.M{"$nor": bson.A{ToMongo(n.Child, schema)}}
+	case Comparison:
+		field := schema.storageName(n.Field)
+		switch n.Op {
+		case OpContains:
+			return bson.M{field: bson.M{"$regex": regexp.QuoteMeta(n.Value.(string)), "$options": "i"}}
+		case OpStartsWith:
+			return bson.M{field: bson.M{"$regex": "^" + regexp.QuoteMeta(n.Value.(string))}}
+		case OpIn:
+			return bson.M{field: bson.M{"$in": bson.A(n.Value.([]any))}}
+		default:
+			return bson.M{field: bson.M{mongoOps[n.Op]: n.Value}}
+		}
+	default:
+		return bson.M{}
+	}
+}
@@ -0,0 +1,208 @@
+package gen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestGenIsDeterministic(t *testing.T) {
+	sample := func(seed int64) []string {
+		g := New(seed)
+		return []string{
+			g.Name(),
+			g.Email(),
+			g.UUID().String(),
+			g.Money(100, 10000).String(),
+			g.Past(24 * time.Hour).Format(time.RFC3339),
+			g.Sentence(),
+		}
+	}
+
+	first, again, other := sample(42), sample(42), sample(7)
+	if strings.Join(first, "|") != strings.Join(again, "|") {
+		t.Errorf("expected identical output for the same seed:\n%v\n%v", first, again)
+	}
+	if strings.Join(first, "|") == strings.Join(other, "|") {
+		t.Error("expected different output for a different seed")
+	}
+}
+
+func TestGenValues(t *testing.T) {
+	g := New(1)
+	for i := 0; i < 100; i++ {
+		if email := g.Email(); !strings.Contains(email, "@") {
+			t.Fatalf("invalid email %q", email)
+		}
+		if m := g.MoneyIn("EUR", 150, 250); m.Amount < 150 || m.Amount > 250 || m.Currency != "EUR" {
+			t.Fatalf("money out of range: %+v", m)
+		}
+		if ts := g.Past(time.Hour); ts.Before(DefaultEpoch.Add(-time.Hour)) || !ts.Before(DefaultEpoch) {
+			t.Fatalf("timestamp out of range: %v", ts)
+		}
+		if id := g.UUID(); id.Version() != 4 {
+			t.Fatalf("expected v4 uuid, got %v", id.Version())
+		}
+	}
+	if got := (Money{Amount: -1250, Currency: "USD"}).String(); got != "-12.50 USD" {
+		t.Errorf("unexpected money format %q", got)
+	}
+}
+
+type person struct {
+	PersonID uuid.UUID
+	Name     string
+}
+
+func (p *person) ID() uuid.UUID { return p.PersonID }
+
+type memoryRepo struct {
+	saved []*person
+}
+
+func (m *memoryRepo) Save(_ context.Context, p *person) error {
+	m.saved = append(m.saved, p)
+	return nil
+}
+
+func (m *memoryRepo) FindByID(context.Context, uuid.UUID) (*person, error) {
+	return nil, aqm.ErrRepoNotFound
+}
+
+func (m *memoryRepo) Delete(context.Context, uuid.UUID) error { return nil }
+
+func (m *memoryRepo) List(context.Context, any) ([]*person, error) { return m.saved, nil }
+
+type bulkRepo struct {
+	memoryRepo
+	batches []int
+}
+
+func (b *bulkRepo) SaveMany(_ context.Context, items []*person, _ bool) (aqm.BulkWriteResult, error) {
+	b.batches = append(b.batches, len(items))
+	b.saved = append(b.saved, items...)
+	return aqm.BulkWriteResult{Upserted: int64(len(items))}, nil
+}
+
+func newPerson(g *Gen) *person {
+	return &person{PersonID: g.UUID(), Name: g.Name()}
+}
+
+func TestInsert(t *testing.T) {
+	g := New(3)
+	items := make([]*person, 5)
+	for i := range items {
+		items[i] = newPerson(g)
+	}
+
+	plain := &memoryRepo{}
+	if n, err := Insert[*person](context.Background(), plain, items, 2); err != nil || n != 5 {
+		t.Fatalf("expected 5 saved, got %d (%v)", n, err)
+	}
+
+	bulk := &bulkRepo{}
+	if n, err := Insert[*person](context.Background(), bulk, items, 2); err != nil || n != 5 {
+		t.Fatalf("expected 5 saved, got %d (%v)", n, err)
+	}
+	if len(bulk.batches) != 3 || bulk.batches[2] != 1 {
+		t.Errorf("expected batches of 2,2,1, got %v", bulk.batches)
+	}
+}
+
+func TestRegisterDebugPopulate(t *testing.T) {
+	repo := &bulkRepo{}
+	r := chi.NewRouter()
+	RegisterDebugPopulate(r, aqm.NewConfig(), true, "people", Populator[*person](repo, newPerson))
+
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		inserted int
+	}{
+		{name: "valid", query: "?n=3&seed=9", status: http.StatusOK, inserted: 3},
+		{name: "missingN", query: "", status: http.StatusBadRequest},
+		{name: "tooMany", query: "?n=100000", status: http.StatusBadRequest},
+		{name: "badSeed", query: "?n=1&seed=x", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/populate/people"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var body struct {
+				Data struct {
+					Inserted int `json:"inserted"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body.Data.Inserted != tt.inserted {
+				t.Errorf("expected %d inserted, got %d", tt.inserted, body.Data.Inserted)
+			}
+		})
+	}
+
+	if len(repo.saved) != 3 {
+		t.Errorf("expected 3 records, got %d", len(repo.saved))
+	}
+}
+
+func TestRegisterDebugPopulateDisabledInProd(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.SetProfile("prod")
+	r := chi.NewRouter()
+	RegisterDebugPopulate(r, cfg, true, "people", func(context.Context, *Gen, int) (int, error) { return 0, nil })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/populate/people?n=1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected route to be absent in prod, got %d", rec.Code)
+	}
+}
+
+func TestRegisterDebugPopulateRequiresOptIn(t *testing.T) {
+	populate := func(context.Context, *Gen, int) (int, error) { return 0, nil }
+	staging := aqm.NewConfig()
+	staging.SetProfile("staging")
+	dev := aqm.NewConfig()
+	dev.SetProfile("dev")
+
+	tests := []struct {
+		name   string
+		cfg    *aqm.Config
+		debug  bool
+		status int
+	}{
+		{name: "noProfile", cfg: aqm.NewConfig(), status: http.StatusNotFound},
+		{name: "staging", cfg: staging, status: http.StatusNotFound},
+		{name: "stagingWithDebug", cfg: staging, debug: true, status: http.StatusOK},
+		{name: "dev", cfg: dev, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			RegisterDebugPopulate(r, tt.cfg, tt.debug, "people", populate)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/populate/people?n=1", nil))
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
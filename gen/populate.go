@@ -0,0 +1,114 @@
+package gen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultBatchSize = 500
+	maxPopulate      = 10000
+)
+
+// BulkSaver is implemented by repositories that can write many aggregates at
+// once, such as aqm.MongoRepo.
+type BulkSaver[T aqm.Identifiable] interface {
+	SaveMany(ctx context.Context, aggregates []T, ordered bool) (aqm.BulkWriteResult, error)
+}
+
+// Insert saves items through repo in batches, using SaveMany when the
+// repository supports it and Save otherwise. It returns how many items were
+// written.
+func Insert[T aqm.Identifiable](ctx context.Context, repo aqm.Repo[T], items []T, batchSize int) (int, error) {
+	if repo == nil {
+		return 0, errors.New("gen: repository required")
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	bulk, isBulk := repo.(BulkSaver[T])
+	written := 0
+	for start := 0; start < len(items); start += batchSize {
+		end := min(start+batchSize, len(items))
+		batch := items[start:end]
+		if !isBulk {
+			for _, item := range batch {
+				if err := repo.Save(ctx, item); err != nil {
+					return written, fmt.Errorf("gen: save item %d: %w", written, err)
+				}
+				written++
+			}
+			continue
+		}
+		result, err := bulk.SaveMany(ctx, batch, false)
+		if err != nil {
+			return written, fmt.Errorf("gen: bulk save: %w", err)
+		}
+		written += len(batch) - len(result.Failed)
+		if len(result.Failed) > 0 {
+			return written, fmt.Errorf("gen: %d items rejected in bulk save", len(result.Failed))
+		}
+	}
+	return written, nil
+}
+
+// PopulateFunc creates and stores n generated records, returning how many
+// were written.
+type PopulateFunc func(ctx context.Context, g *Gen, n int) (int, error)
+
+// Populator returns a PopulateFunc that builds records with factory and
+// stores them with Insert.
+func Populator[T aqm.Identifiable](repo aqm.Repo[T], factory func(g *Gen) T) PopulateFunc {
+	return func(ctx context.Context, g *Gen, n int) (int, error) {
+		items := make([]T, n)
+		for i := range items {
+			items[i] = factory(g)
+		}
+		return Insert(ctx, repo, items, defaultBatchSize)
+	}
+}
+
+// RegisterDebugPopulate exposes POST /debug/populate/{name}?n=100&seed=42,
+// which generates and stores n records (at most 10000) with populate. As the
+// route writes data it has to be asked for: it is mounted only when the dev
+// profile is active or debug is set, e.g. from Micro.DebugRequested, and
+// never when the prod profile is active.
+func RegisterDebugPopulate(r chi.Router, cfg *aqm.Config, debug bool, name string, populate PopulateFunc) {
+	if r == nil || cfg == nil || populate == nil || name == "" || cfg.IsProd() {
+		return
+	}
+	if !cfg.IsDev() && !debug {
+		return
+	}
+
+	r.Post("/debug/populate/"+name, func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		n, err := strconv.Atoi(query.Get("n"))
+		if err != nil || n <= 0 || n > maxPopulate {
+			aqm.RespondError(w, http.StatusBadRequest, fmt.Sprintf("n must be between 1 and %d", maxPopulate))
+			return
+		}
+		seed := int64(1)
+		if raw := query.Get("seed"); raw != "" {
+			seed, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				aqm.RespondError(w, http.StatusBadRequest, "seed must be an integer")
+				return
+			}
+		}
+
+		written, err := populate(req.Context(), New(seed), n)
+		if err != nil {
+			aqm.RespondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		aqm.RespondSuccess(w, map[string]any{"name": name, "inserted": written, "seed": seed})
+	})
+}
@@ -34,7 +34,7 @@ func WithGRPCServer(addrKey string, factories ...GRPCServiceFactory) Option {
 			return errors.New("grpc addr property key required")
 		}
 
-		grpcServer := grpc.NewServer()
+		grpcServer := grpc.NewServer(ms.grpcServerOptions...)
 
 		// Enable reflection for easier debugging with grpcurl/grpcui
 		reflection.Register(grpcServer)
@@ -60,6 +60,11 @@ func WithGRPCServer(addrKey string, factories ...GRPCServiceFactory) Option {
 			if stoppable, ok := service.(Stoppable); ok {
 				ms.addStop(stoppable.Stop)
 			}
+			if warmable, ok := service.(Warmable); ok {
+				ms.mu.Lock()
+				ms.addWarmup(moduleName(service), 0, warmable.Warmup)
+				ms.mu.Unlock()
+			}
 		}
 
 		addr := ms.deps.Config.GetPort(addrKey, ":50051")
@@ -101,6 +106,10 @@ func newGRPCServerRunner(addr string, server *grpc.Server) Runner {
 	}
 }
 
+func (r *grpcServerRunner) Name() string {
+	return "grpc " + r.addr
+}
+
 func (r *grpcServerRunner) Start(_ context.Context) error {
 	lis, err := net.Listen("tcp", r.addr)
 	if err != nil {
@@ -0,0 +1,189 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCGatewayRegisterFunc matches the Register<Service>HandlerFromEndpoint
+// functions generated by protoc-gen-grpc-gateway.
+type GRPCGatewayRegisterFunc func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error
+
+// GRPCGatewayModule is the name the gateway routes are attributed to.
+const GRPCGatewayModule = "grpc-gateway"
+
+// GRPCGatewayOptions configures WithGRPCGatewayOptions.
+type GRPCGatewayOptions struct {
+	// Prefix mounts the transcoded routes under a path such as "/api",
+	// stripped before matching. Empty mounts them at the router root.
+	Prefix string
+	// DialOptions replace the default plaintext credentials used to dial
+	// the gRPC server, e.g. GRPCWorkloadCredentials for mTLS.
+	DialOptions []grpc.DialOption
+}
+
+// WithGRPCGateway serves REST transcoding for gRPC services through the HTTP
+// server. The generated handlers are mounted at the router root as an
+// HTTPModule, so they run behind the HTTP middleware stack and next to the
+// health endpoints; explicit routes take precedence over transcoded ones.
+// addrKey names the gRPC server address the gateway dials (default ":50051")
+// over plaintext; use WithGRPCGatewayOptions for a prefix or TLS.
+// gRPC status errors are rendered as the standard error envelope, e.g.
+// NotFound becomes a 404 with code "not_found". It may be applied before or
+// after WithHTTPServer.
+//
+// Usage:
+//
+//	aqm.WithGRPCGateway("grpc.port", userspb.RegisterUsersHandlerFromEndpoint)
+func WithGRPCGateway(addrKey string, registerFns ...GRPCGatewayRegisterFunc) Option {
+	return WithGRPCGatewayOptions(addrKey, GRPCGatewayOptions{}, registerFns...)
+}
+
+// WithGRPCGatewayOptions is WithGRPCGateway with a mount prefix and dial
+// options.
+//
+// Usage:
+//
+//	aqm.WithGRPCGatewayOptions("grpc.port", aqm.GRPCGatewayOptions{
+//		Prefix:      "/api",
+//		DialOptions: []grpc.DialOption{aqm.GRPCWorkloadCredentials(cert, roots)},
+//	}, userspb.RegisterUsersHandlerFromEndpoint)
+func WithGRPCGatewayOptions(addrKey string, opts GRPCGatewayOptions, registerFns ...GRPCGatewayRegisterFunc) Option {
+	return func(ms *Micro) error {
+		if addrKey == "" {
+			return errors.New("grpc gateway addr property key required")
+		}
+		prefix := strings.TrimRight(opts.Prefix, "/")
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("grpc gateway prefix %q must start with /", opts.Prefix)
+		}
+		dialOpts := opts.DialOptions
+		if len(dialOpts) == 0 {
+			dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		}
+		if len(registerFns) == 0 {
+			return errors.New("grpc gateway requires at least one register function")
+		}
+		for _, fn := range registerFns {
+			if fn == nil {
+				return errors.New("nil grpc gateway register function")
+			}
+		}
+
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		return ms.addHTTPModule(func(deps *Deps) (HTTPModule, error) {
+			gateway := newGRPCGateway(gatewayEndpoint(deps.Config.GetPort(addrKey, ":50051")), registerFns)
+			gateway.prefix, gateway.dialOpts = prefix, dialOpts
+			return gateway, nil
+		})
+	}
+}
+
+type grpcGateway struct {
+	mux         *runtime.ServeMux
+	endpoint    string
+	prefix      string
+	dialOpts    []grpc.DialOption
+	registerFns []GRPCGatewayRegisterFunc
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+func newGRPCGateway(endpoint string, registerFns []GRPCGatewayRegisterFunc) *grpcGateway {
+	return &grpcGateway{
+		mux: runtime.NewServeMux(
+			runtime.WithErrorHandler(gatewayErrorHandler),
+			runtime.WithMetadata(gatewayMetadata),
+		),
+		endpoint:    endpoint,
+		registerFns: registerFns,
+	}
+}
+
+func (g *grpcGateway) Name() string {
+	return GRPCGatewayModule
+}
+
+func (g *grpcGateway) RegisterRoutes(router chi.Router) {
+	if g.prefix == "" {
+		router.Mount("/", g.mux)
+		return
+	}
+	router.Mount(g.prefix, http.StripPrefix(g.prefix, g.mux))
+}
+
+// Start registers the generated handlers, which dial the gRPC endpoint. The
+// connections live until Stop.
+func (g *grpcGateway) Start(ctx context.Context) error {
+	connCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	for _, register := range g.registerFns {
+		if err := register(connCtx, g.mux, g.endpoint, g.dialOpts); err != nil {
+			cancel()
+			return fmt.Errorf("grpc gateway: registering handler: %w", err)
+		}
+	}
+	g.mu.Lock()
+	g.cancel = cancel
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *grpcGateway) Stop(context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cancel != nil {
+		g.cancel()
+		g.cancel = nil
+	}
+	return nil
+}
+
+// gatewayEndpoint turns a listen address such as ":50051" into a dialable one.
+func gatewayEndpoint(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+// gatewayMetadata forwards the request ID to the gRPC service.
+func gatewayMetadata(ctx context.Context, _ *http.Request) metadata.MD {
+	if id := RequestIDFrom(ctx); id != "" {
+		return metadata.Pairs(strings.ToLower(RequestIDHeader), id)
+	}
+	return nil
+}
+
+func gatewayErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	st := status.Convert(err)
+	Error(w, runtime.HTTPStatusFromCode(st.Code()), grpcCodeName(st.Code().String()), st.Message())
+}
+
+// grpcCodeName converts a gRPC code name such as "NotFound" to "not_found".
+func grpcCodeName(name string) string {
+	var b strings.Builder
+	prevLower := false
+	for _, r := range name {
+		upper := unicode.IsUpper(r)
+		if upper && prevLower {
+			b.WriteByte('_')
+		}
+		prevLower = !upper
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package aqm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeGatewayRegister stands in for a generated RegisterXHandlerFromEndpoint,
+// serving GET /v1/items/{id} and failing with NotFound for unknown items.
+func fakeGatewayRegister(endpoint *string) GRPCGatewayRegisterFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, target string, _ []grpc.DialOption) error {
+		*endpoint = target
+		return mux.HandlePath(http.MethodGet, "/v1/items/{id}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			if params["id"] != "1" {
+				runtime.HTTPError(r.Context(), mux, &runtime.JSONPb{}, w, r, status.Error(codes.NotFound, "item not found"))
+				return
+			}
+			ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/items.Items/Get")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			md, _ := metadata.FromOutgoingContext(ctx)
+			json.NewEncoder(w).Encode(map[string]any{"id": params["id"], "request_id": md.Get("x-request-id")})
+		})
+	}
+}
+
+func TestWithGRPCGateway(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("grpc.port", ":6000")
+	var endpoint string
+
+	for _, order := range []string{"gatewayFirst", "serverFirst"} {
+		t.Run(order, func(t *testing.T) {
+			gateway := WithGRPCGateway("grpc.port", fakeGatewayRegister(&endpoint))
+			opts := []Option{WithConfig(cfg), WithLogger(NewNoopLogger()), WithHTTPMiddleware(RequestIDMiddleware)}
+			if order == "gatewayFirst" {
+				opts = append(opts, gateway, WithHTTPServerModules("http.port"))
+			} else {
+				opts = append(opts, WithHTTPServerModules("http.port"), gateway)
+			}
+			ms := NewMicro(opts...)
+			for _, start := range ms.startFuncs {
+				if err := start(context.Background()); err != nil {
+					t.Fatalf("start: %v", err)
+				}
+			}
+			defer func() {
+				for _, stop := range ms.stopFuncs {
+					stop(context.Background())
+				}
+			}()
+
+			if endpoint != "localhost:6000" {
+				t.Errorf("endpoint = %q, want localhost:6000", endpoint)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/items/1", nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+			rec := httptest.NewRecorder()
+			ms.httpRouter.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			var body struct {
+				ID        string   `json:"id"`
+				RequestID []string `json:"request_id"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(body.RequestID) != 1 || body.RequestID[0] != "req-1" {
+				t.Errorf("request id not forwarded: %v", body.RequestID)
+			}
+
+			rec = httptest.NewRecorder()
+			ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/items/2", nil))
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want 404", rec.Code)
+			}
+			var envelope ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if envelope.Error.Code != "not_found" || envelope.Error.Message != "item not found" {
+				t.Errorf("unexpected envelope %+v", envelope.Error)
+			}
+
+			rec = httptest.NewRecorder()
+			ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("health endpoint status = %d", rec.Code)
+			}
+
+			routes := ms.Routes()
+			var attributed bool
+			for _, route := range routes {
+				attributed = attributed || route.Module == GRPCGatewayModule
+			}
+			if !attributed {
+				t.Errorf("gateway routes not attributed: %v", routes)
+			}
+		})
+	}
+}
+
+func TestWithGRPCGatewayOptions(t *testing.T) {
+	var endpoint string
+	var dialOpts []grpc.DialOption
+	register := func(ctx context.Context, mux *runtime.ServeMux, target string, opts []grpc.DialOption) error {
+		dialOpts = opts
+		return fakeGatewayRegister(&endpoint)(ctx, mux, target, opts)
+	}
+	ms := NewMicro(
+		WithConfig(NewConfig()),
+		WithLogger(NewNoopLogger()),
+		WithHTTPServerModules("http.port"),
+		WithGRPCGatewayOptions("grpc.port", GRPCGatewayOptions{
+			Prefix:      "/api/",
+			DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUserAgent("gateway")},
+		}, register),
+	)
+	for _, start := range ms.startFuncs {
+		if err := start(context.Background()); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+	}
+	defer func() {
+		for _, stop := range ms.stopFuncs {
+			stop(context.Background())
+		}
+	}()
+
+	if len(dialOpts) != 2 {
+		t.Errorf("dial options = %d, want the 2 configured", len(dialOpts))
+	}
+	rec := httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/items/1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("prefixed status = %d, body %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/items/1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unprefixed status = %d, want 404", rec.Code)
+	}
+}
+
+func TestWithGRPCGatewayValidation(t *testing.T) {
+	var endpoint string
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{name: "emptyKey", opt: WithGRPCGateway("", fakeGatewayRegister(&endpoint))},
+		{name: "noRegisterFns", opt: WithGRPCGateway("grpc.port")},
+		{name: "nilRegisterFn", opt: WithGRPCGateway("grpc.port", nil)},
+		{name: "relativePrefix", opt: WithGRPCGatewayOptions("grpc.port", GRPCGatewayOptions{Prefix: "api"}, fakeGatewayRegister(&endpoint))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opt(&Micro{deps: DefaultDeps()}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestGRPCCodeName(t *testing.T) {
+	tests := map[codes.Code]string{
+		codes.OK:               "ok",
+		codes.NotFound:         "not_found",
+		codes.DeadlineExceeded: "deadline_exceeded",
+		codes.Unauthenticated:  "unauthenticated",
+	}
+	for code, want := range tests {
+		if got := grpcCodeName(code.String()); got != want {
+			t.Errorf("grpcCodeName(%s) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package grpcstream gives gRPC modules the streaming counterparts of the
+// HTTP list and upload helpers: List streams repository results page by page
+// to a server stream, and Upload stores a client stream of chunks in a
+// storage.Blob. Both stop on the stream deadline or cancellation, answer
+// with gRPC status codes and record message and duration metrics.
+package grpcstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultPageSize = 100
+
+// Option configures List and Upload.
+type Option func(*config)
+
+type config struct {
+	pageSize int
+	maxSize  int64
+	metrics  aqm.Metrics
+}
+
+// WithPageSize sets how many items List fetches per query (default 100),
+// which bounds the items held in memory while the client reads.
+func WithPageSize(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.pageSize = n
+		}
+	}
+}
+
+// WithMaxSize rejects uploads larger than n bytes with ResourceExhausted.
+func WithMaxSize(n int64) Option {
+	return func(c *config) {
+		c.maxSize = n
+	}
+}
+
+// WithMetrics records grpc_stream_messages_total and
+// grpc_stream_duration_ms, labelled with the method, direction and outcome.
+func WithMetrics(metrics aqm.Metrics) Option {
+	return func(c *config) {
+		if metrics != nil {
+			c.metrics = metrics
+		}
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{pageSize: defaultPageSize, metrics: aqm.NoopMetrics{}}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	return cfg
+}
+
+// PageFunc returns the items of one page, e.g. with
+// aqm.NewQuery(...).Apply(params). A page shorter than params.Limit ends the
+// stream.
+type PageFunc[T any] func(ctx context.Context, params aqm.ListParams) ([]T, error)
+
+// List sends every item returned by page to stream, converted with convert,
+// fetching the next page only once the previous one was sent. Send blocks
+// while the HTTP/2 flow control window of a slow client is full, so the
+// server never runs more than a page ahead. params carries the filters and
+// sort of the request; its Offset is the starting point.
+func List[T, M any](stream grpc.ServerStreamingServer[M], params aqm.ListParams, page PageFunc[T], convert func(T) (*M, error), opts ...Option) error {
+	cfg := newConfig(opts)
+	ctx := stream.Context()
+	method, _ := grpc.Method(ctx)
+	start := time.Now()
+	sent := 0
+
+	err := func() error {
+		params.Limit = cfg.pageSize
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			items, err := page(ctx, params)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				msg, err := convert(item)
+				if err != nil {
+					return status.Errorf(codes.Internal, "convert item: %v", err)
+				}
+				if err := stream.Send(msg); err != nil {
+					return err
+				}
+				sent++
+			}
+			if len(items) < params.Limit {
+				return nil
+			}
+			params.Offset += len(items)
+		}
+	}()
+
+	cfg.record(ctx, method, "send", sent, start, err)
+	return toStatus(err)
+}
+
+// UploadChunk is one message of an upload: the first carries the key and
+// content type of the blob, every one may carry data.
+type UploadChunk struct {
+	Key         string
+	ContentType string
+	Data        []byte
+}
+
+// Upload receives the messages of stream, converted with chunk, into blob
+// until the client closes its side, and returns the stored object; the
+// handler then answers with stream.SendAndClose. A missing key fails with
+// InvalidArgument, exceeding WithMaxSize with ResourceExhausted, and an
+// expired or cancelled stream with DeadlineExceeded or Canceled, leaving
+// the partial blob unwritten.
+func Upload[Req, Res any](stream grpc.ClientStreamingServer[Req, Res], blob storage.Blob, chunk func(*Req) UploadChunk, opts ...Option) (storage.Object, error) {
+	cfg := newConfig(opts)
+	ctx := stream.Context()
+	method, _ := grpc.Method(ctx)
+	start := time.Now()
+	received := 0
+
+	obj, err := func() (storage.Object, error) {
+		first, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return storage.Object{}, status.Error(codes.InvalidArgument, "empty upload")
+		}
+		if err != nil {
+			return storage.Object{}, err
+		}
+		received++
+		head := chunk(first)
+		if head.Key == "" {
+			return storage.Object{}, status.Error(codes.InvalidArgument, "upload key required in the first message")
+		}
+
+		// Put reads while the handler goroutine receives, so the stream is
+		// only used by the handler.
+		pr, pw := io.Pipe()
+		type putResult struct {
+			obj storage.Object
+			err error
+		}
+		done := make(chan putResult, 1)
+		go func() {
+			obj, err := blob.Put(ctx, head.Key, pr, head.ContentType)
+			// Unblock the receiver when Put failed before reading everything.
+			pr.CloseWithError(err)
+			done <- putResult{obj, err}
+		}()
+		recvErr := receive(ctx, stream, chunk, pw, head.Data, cfg.maxSize, &received)
+		pw.CloseWithError(recvErr)
+		put := <-done
+		if recvErr != nil {
+			return storage.Object{}, recvErr
+		}
+		return put.obj, put.err
+	}()
+
+	cfg.record(ctx, method, "receive", received, start, err)
+	return obj, toStatus(err)
+}
+
+// receive writes data, then the data of the following messages, to pw
+// until the client closes its side. Upload closes the pipe with any error,
+// so Put fails instead of storing a truncated blob.
+func receive[Req, Res any](ctx context.Context, stream grpc.ClientStreamingServer[Req, Res], chunk func(*Req) UploadChunk, pw io.Writer, data []byte, maxSize int64, received *int) error {
+	var size int64
+	write := func(p []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size += int64(len(p))
+		if maxSize > 0 && size > maxSize {
+			return status.Errorf(codes.ResourceExhausted, "upload exceeds %d bytes", maxSize)
+		}
+		_, err := pw.Write(p)
+		return err
+	}
+	if err := write(data); err != nil {
+		return err
+	}
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*received++
+		if err := write(chunk(msg).Data); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *config) record(ctx context.Context, method, direction string, messages int, start time.Time, err error) {
+	outcome := "ok"
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded:
+		outcome = "timeout"
+	case errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled:
+		outcome = "canceled"
+	default:
+		outcome = "error"
+	}
+	labels := map[string]string{"method": method, "direction": direction, "outcome": outcome}
+	c.metrics.Counter(ctx, "grpc_stream_messages_total", float64(messages), labels)
+	c.metrics.Counter(ctx, "grpc_stream_duration_ms", float64(time.Since(start).Milliseconds()), labels)
+}
+
+// toStatus maps context errors to their gRPC codes and keeps status errors;
+// other errors become Internal.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Internal, fmt.Sprint(err))
+}
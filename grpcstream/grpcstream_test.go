@@ -0,0 +1,168 @@
+package grpcstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type item struct{ N int }
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*item
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+func (s *serverStream) Send(m *item) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+type chunk struct {
+	Key  string
+	Data string
+}
+
+type uploadStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	chunks []*chunk
+	err    error
+}
+
+func (s *uploadStream) Context() context.Context { return s.ctx }
+func (s *uploadStream) SendAndClose(*item) error { return nil }
+func (s *uploadStream) Recv() (*chunk, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	next := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return next, nil
+}
+
+func toChunk(c *chunk) UploadChunk {
+	return UploadChunk{Key: c.Key, ContentType: "text/plain", Data: []byte(c.Data)}
+}
+
+type metricsRecorder struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (m *metricsRecorder) Counter(_ context.Context, name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values == nil {
+		m.values = map[string]float64{}
+	}
+	m.values[name+"/"+labels["direction"]+"/"+labels["outcome"]] += value
+}
+
+func (m *metricsRecorder) ObserveHTTPRequest(string, string, int, time.Duration) {}
+
+func TestList(t *testing.T) {
+	var offsets []int
+	page := func(_ context.Context, params aqm.ListParams) ([]int, error) {
+		offsets = append(offsets, params.Offset)
+		var items []int
+		for n := params.Offset; n < min(params.Offset+params.Limit, 250); n++ {
+			items = append(items, n)
+		}
+		return items, nil
+	}
+	stream := &serverStream{ctx: context.Background()}
+	metrics := &metricsRecorder{}
+
+	err := List(stream, aqm.ListParams{Sort: []string{"n"}}, page, func(n int) (*item, error) { return &item{N: n}, nil },
+		WithPageSize(100), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stream.sent) != 250 || stream.sent[249].N != 249 {
+		t.Errorf("sent %d items", len(stream.sent))
+	}
+	if len(offsets) != 3 || offsets[2] != 200 {
+		t.Errorf("page offsets = %v", offsets)
+	}
+	if got := metrics.values["grpc_stream_messages_total/send/ok"]; got != 250 {
+		t.Errorf("messages metric = %v", got)
+	}
+}
+
+func TestListCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &serverStream{ctx: ctx}
+	page := func(context.Context, aqm.ListParams) ([]int, error) {
+		cancel()
+		return []int{1, 2}, nil
+	}
+	err := List(stream, aqm.ListParams{}, page, func(n int) (*item, error) { return &item{N: n}, nil })
+	if status.Code(err) != codes.Canceled || len(stream.sent) != 0 {
+		t.Errorf("err = %v, sent %d", err, len(stream.sent))
+	}
+
+	stream = &serverStream{ctx: context.Background()}
+	failing := func(context.Context, aqm.ListParams) ([]int, error) { return nil, errors.New("db down") }
+	if err := List(stream, aqm.ListParams{}, failing, func(n int) (*item, error) { return &item{N: n}, nil }); status.Code(err) != codes.Internal {
+		t.Errorf("page error = %v, want Internal", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	blob := storage.NewMemoryBlob()
+	stream := &uploadStream{ctx: context.Background(), chunks: []*chunk{
+		{Key: "reports/q1.txt", Data: "hello "}, {Data: "streamed "}, {Data: "world"},
+	}}
+	obj, err := Upload(stream, blob, toChunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := blob.Get(context.Background(), "reports/q1.txt")
+	if err != nil || string(data) != "hello streamed world" || obj.Size != int64(len(data)) {
+		t.Errorf("stored %q (%v), object %+v", data, err, obj)
+	}
+}
+
+func TestUploadErrors(t *testing.T) {
+	blob := storage.NewMemoryBlob()
+	tests := []struct {
+		name   string
+		stream *uploadStream
+		opts   []Option
+		want   codes.Code
+	}{
+		{"empty", &uploadStream{}, nil, codes.InvalidArgument},
+		{"no key", &uploadStream{chunks: []*chunk{{Data: "x"}}}, nil, codes.InvalidArgument},
+		{"too large", &uploadStream{chunks: []*chunk{{Key: "big", Data: "1234"}, {Data: "5678"}}}, []Option{WithMaxSize(6)}, codes.ResourceExhausted},
+		{"deadline", &uploadStream{chunks: []*chunk{{Key: "late", Data: "1234"}}, err: context.DeadlineExceeded}, nil, codes.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.stream.ctx = context.Background()
+			_, err := Upload(tt.stream, blob, toChunk, tt.opts...)
+			if status.Code(err) != tt.want {
+				t.Errorf("err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+	for _, key := range []string{"big", "late"} {
+		if _, _, err := blob.Get(context.Background(), key); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("partial upload %s stored: %v", key, err)
+		}
+	}
+}
@@ -3,20 +3,46 @@ package aqm
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
-// HealthCheck represents a liveness or readiness probe.
+// HealthCheck represents a liveness or readiness probe. The context carries
+// the registry's per-check timeout; checks must honor its cancellation, as a
+// check still running past it is reported as failed and left to finish on
+// its own.
 type HealthCheck func(context.Context) error
 
-// HealthChecks aggregates liveness and readiness probes.
+// HealthSeverity states how a failing check affects the probe outcome.
+type HealthSeverity string
+
+const (
+	// HealthCritical checks fail the probe with 503 (the default).
+	HealthCritical HealthSeverity = "critical"
+	// HealthNonCritical checks mark the probe as degraded but keep it 200.
+	HealthNonCritical HealthSeverity = "non_critical"
+)
+
+// Probe statuses reported in ProbeResponse.Status. Any failing check makes
+// the probe degraded; the HTTP status and the result severities tell whether
+// a critical check failed.
+const (
+	HealthStatusUp       = "ok"
+	HealthStatusDegraded = "degraded"
+)
+
+// HealthChecks aggregates liveness and readiness probes. Severity marks checks
+// by name; unlisted checks are critical.
 type HealthChecks struct {
 	Liveness  map[string]HealthCheck
 	Readiness map[string]HealthCheck
+	Severity  map[string]HealthSeverity
 }
 
 // HealthReporter allows components to expose their health probes.
@@ -24,19 +50,64 @@ type HealthReporter interface {
 	HealthChecks() HealthChecks
 }
 
+const (
+	defaultHealthCheckTimeout = 5 * time.Second
+	defaultHealthCacheTTL     = time.Second
+)
+
 // HealthRegistry stores registered probes and exposes HTTP handlers.
 type HealthRegistry struct {
 	mu        sync.RWMutex
 	liveness  map[string]HealthCheck
 	readiness map[string]HealthCheck
+	severity  map[string]HealthSeverity
+
+	checkTimeout time.Duration
+	cacheTTL     time.Duration
+	cache        map[string]cachedProbe
 }
 
-// NewHealthRegistry constructs an empty registry.
+type cachedProbe struct {
+	response ProbeResponse
+	expires  time.Time
+}
+
+// NewHealthRegistry constructs an empty registry. Checks run concurrently with
+// a 5s timeout each and results are cached for 1s; see SetCheckTimeout and
+// SetCacheTTL.
 func NewHealthRegistry() *HealthRegistry {
 	return &HealthRegistry{
-		liveness:  map[string]HealthCheck{},
-		readiness: map[string]HealthCheck{},
+		liveness:     map[string]HealthCheck{},
+		readiness:    map[string]HealthCheck{},
+		severity:     map[string]HealthSeverity{},
+		checkTimeout: defaultHealthCheckTimeout,
+		cacheTTL:     defaultHealthCacheTTL,
+		cache:        map[string]cachedProbe{},
+	}
+}
+
+// SetCheckTimeout bounds how long a single check may run before it is
+// reported as failed; the check's context is cancelled at the deadline.
+// Non-positive values restore the default.
+func (hr *HealthRegistry) SetCheckTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	hr.mu.Lock()
+	hr.checkTimeout = timeout
+	hr.mu.Unlock()
+}
+
+// SetCacheTTL sets how long probe results are reused, protecting dependencies
+// from probe storms. Zero disables caching.
+func (hr *HealthRegistry) SetCacheTTL(ttl time.Duration) {
+	if ttl < 0 {
+		ttl = 0
 	}
+	hr.mu.Lock()
+	hr.cacheTTL = ttl
+	hr.cache = map[string]cachedProbe{}
+	hr.mu.Unlock()
 }
 
 // RegisterChecks installs both liveness and readiness checks from the reporter.
@@ -47,6 +118,26 @@ func (hr *HealthRegistry) RegisterChecks(checks HealthChecks) {
 	for name, check := range checks.Readiness {
 		hr.RegisterReadiness(name, check)
 	}
+	for name, severity := range checks.Severity {
+		hr.SetSeverity(name, severity)
+	}
+}
+
+// SetSeverity sets the severity of the checks registered under name. Only
+// critical failures make a probe return 503; non-critical failures report the
+// probe as degraded.
+func (hr *HealthRegistry) SetSeverity(name string, severity HealthSeverity) {
+	if name == "" {
+		return
+	}
+	hr.mu.Lock()
+	if severity == "" || severity == HealthCritical {
+		delete(hr.severity, name)
+	} else {
+		hr.severity[name] = severity
+	}
+	hr.cache = map[string]cachedProbe{}
+	hr.mu.Unlock()
 }
 
 // RegisterLiveness adds a liveness probe under the provided name.
@@ -56,6 +147,7 @@ func (hr *HealthRegistry) RegisterLiveness(name string, check HealthCheck) {
 	}
 	hr.mu.Lock()
 	hr.liveness[name] = check
+	hr.cache = map[string]cachedProbe{}
 	hr.mu.Unlock()
 }
 
@@ -66,6 +158,7 @@ func (hr *HealthRegistry) RegisterReadiness(name string, check HealthCheck) {
 	}
 	hr.mu.Lock()
 	hr.readiness[name] = check
+	hr.cache = map[string]cachedProbe{}
 	hr.mu.Unlock()
 }
 
@@ -75,9 +168,9 @@ func RegisterHealthEndpoints(r chi.Router, registry *HealthRegistry) {
 		registry = NewHealthRegistry()
 	}
 
-	r.Get("/healthz", makeHealthHandler(registry, registry.liveness))
-	r.Get("/livez", makeHealthHandler(registry, registry.liveness))
-	r.Get("/readyz", makeHealthHandler(registry, registry.readiness))
+	r.Get("/healthz", makeHealthHandler(registry, "liveness", registry.liveness))
+	r.Get("/livez", makeHealthHandler(registry, "liveness", registry.liveness))
+	r.Get("/readyz", makeHealthHandler(registry, "readiness", registry.readiness))
 	r.Get("/ping", pingHandler)
 	r.Get("/metrics", notImplementedHandler)
 	r.Get("/version", notImplementedHandler)
@@ -88,22 +181,12 @@ func pingHandler(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("pong"))
 }
 
-func makeHealthHandler(registry *HealthRegistry, checks map[string]HealthCheck) http.HandlerFunc {
+func makeHealthHandler(registry *HealthRegistry, kind string, checks map[string]HealthCheck) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		registry.mu.RLock()
-		snapshot := make(map[string]HealthCheck, len(checks))
-		for name, check := range checks {
-			snapshot[name] = check
-		}
-		registry.mu.RUnlock()
-
-		summary := runChecks(r.Context(), snapshot)
+		summary := registry.probe(r.Context(), kind, checks)
 		status := http.StatusOK
-		for _, res := range summary.Results {
-			if res.Error != "" {
-				status = http.StatusServiceUnavailable
-				break
-			}
+		if summary.criticalFailed() {
+			status = http.StatusServiceUnavailable
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -112,22 +195,65 @@ func makeHealthHandler(registry *HealthRegistry, checks map[string]HealthCheck)
 	}
 }
 
-func runChecks(ctx context.Context, checks map[string]HealthCheck) ProbeResponse {
-	results := make([]HealthResult, 0, len(checks))
+// probe runs checks, reusing the previous response for kind while it is
+// within the cache TTL. Responses with a cancelled check are not cached: they
+// reflect a prober that went away, not the state of the dependency.
+func (hr *HealthRegistry) probe(ctx context.Context, kind string, checks map[string]HealthCheck) ProbeResponse {
+	hr.mu.RLock()
+	cached, ok := hr.cache[kind]
+	timeout, ttl := hr.checkTimeout, hr.cacheTTL
+	snapshot := make(map[string]HealthCheck, len(checks))
+	severity := make(map[string]HealthSeverity, len(hr.severity))
 	for name, check := range checks {
-		result := HealthResult{Name: name}
-		if check != nil {
-			if err := check(ctx); err != nil {
-				result.Error = err.Error()
-			}
+		snapshot[name] = check
+		if sev, ok := hr.severity[name]; ok {
+			severity[name] = sev
 		}
-		results = append(results, result)
+	}
+	hr.mu.RUnlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.response
 	}
 
-	status := "ok"
+	summary := runChecks(ctx, snapshot, severity, timeout)
+	if ttl > 0 && !summary.canceled() {
+		hr.mu.Lock()
+		hr.cache[kind] = cachedProbe{response: summary, expires: time.Now().Add(ttl)}
+		hr.mu.Unlock()
+	}
+	return summary
+}
+
+// runChecks executes checks concurrently, failing any check that does not
+// finish within timeout. Results are sorted by name. Checks missing from
+// severity are critical.
+func runChecks(ctx context.Context, checks map[string]HealthCheck, severity map[string]HealthSeverity, timeout time.Duration) ProbeResponse {
+	results := make([]HealthResult, len(checks))
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string, check HealthCheck) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, name, check, timeout)
+			results[i].Severity = HealthCritical
+			if sev, ok := severity[name]; ok {
+				results[i].Severity = sev
+			}
+		}(i, name, checks[name])
+	}
+	wg.Wait()
+
+	status := HealthStatusUp
 	for _, res := range results {
 		if res.Error != "" {
-			status = "degraded"
+			status = HealthStatusDegraded
 			break
 		}
 	}
@@ -139,6 +265,37 @@ func runChecks(ctx context.Context, checks map[string]HealthCheck) ProbeResponse
 	}
 }
 
+func runCheck(ctx context.Context, name string, check HealthCheck, timeout time.Duration) HealthResult {
+	result := HealthResult{Name: name}
+	if check == nil {
+		return result
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+	result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		result.canceled = errors.Is(err, context.Canceled)
+	}
+	return result
+}
+
 func notImplementedHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
@@ -148,8 +305,12 @@ func HealthStatusOK(context.Context) error { return nil }
 
 // HealthResult captures the outcome of a single probe.
 type HealthResult struct {
-	Name  string `json:"name"`
-	Error string `json:"error,omitempty"`
+	Name      string         `json:"name"`
+	Severity  HealthSeverity `json:"severity"`
+	Error     string         `json:"error,omitempty"`
+	LatencyMS float64        `json:"latency_ms"`
+
+	canceled bool
 }
 
 // ProbeResponse wraps probe results in a standard JSON envelope.
@@ -158,3 +319,23 @@ type ProbeResponse struct {
 	Timestamp string         `json:"timestamp"`
 	Results   []HealthResult `json:"results,omitempty"`
 }
+
+// criticalFailed reports whether a critical check failed.
+func (p ProbeResponse) criticalFailed() bool {
+	for _, res := range p.Results {
+		if res.Error != "" && res.Severity == HealthCritical {
+			return true
+		}
+	}
+	return false
+}
+
+// canceled reports whether any check was cut short by context cancellation.
+func (p ProbeResponse) canceled() bool {
+	for _, res := range p.Results {
+		if res.canceled {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -280,7 +282,7 @@ func TestRunChecksWithNilCheck(t *testing.T) {
 		"nilcheck": nil,
 	}
 
-	resp := runChecks(context.Background(), checks)
+	resp := runChecks(context.Background(), checks, nil, time.Second)
 
 	if resp.Status != "ok" {
 		t.Errorf("expected status 'ok' for nil check, got %q", resp.Status)
@@ -329,3 +331,142 @@ func TestHealthChecksStruct(t *testing.T) {
 		t.Error("Readiness should be initialized")
 	}
 }
+
+func TestRunChecksConcurrentWithTimeout(t *testing.T) {
+	var cancelled atomic.Bool
+	checks := map[string]HealthCheck{
+		"slow": func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				cancelled.Store(true)
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		},
+		"fast": func(context.Context) error { return nil },
+	}
+
+	start := time.Now()
+	resp := runChecks(context.Background(), checks, nil, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected slow check to be cut off, took %v", elapsed)
+	}
+
+	if len(resp.Results) != 2 || resp.Results[0].Name != "fast" || resp.Results[1].Name != "slow" {
+		t.Fatalf("expected results sorted by name, got %+v", resp.Results)
+	}
+	if resp.Results[0].Error != "" {
+		t.Errorf("expected fast check to pass, got %q", resp.Results[0].Error)
+	}
+	if resp.Results[1].Error == "" || resp.Results[1].LatencyMS < 50 {
+		t.Errorf("expected slow check to time out with latency, got %+v", resp.Results[1])
+	}
+	if resp.Status != HealthStatusDegraded {
+		t.Errorf("expected degraded status, got %q", resp.Status)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !cancelled.Load() {
+		t.Error("expected the check context to be cancelled at the timeout")
+	}
+}
+
+func TestHealthRegistryCachesResults(t *testing.T) {
+	var calls atomic.Int32
+	hr := NewHealthRegistry()
+	hr.RegisterReadiness("db", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+	r := chi.NewRouter()
+	RegisterHealthEndpoints(r, hr)
+
+	probe := func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	}
+
+	probe()
+	probe()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected cached result within TTL, check ran %d times", got)
+	}
+
+	hr.SetCacheTTL(0)
+	probe()
+	probe()
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected checks to run on every probe without cache, ran %d times", got)
+	}
+}
+
+func TestHealthRegistrySkipsCancelledResults(t *testing.T) {
+	var calls atomic.Int32
+	hr := NewHealthRegistry()
+	hr.RegisterReadiness("db", func(context.Context) error {
+		if calls.Add(1) == 1 {
+			return context.Canceled
+		}
+		return nil
+	})
+	r := chi.NewRouter()
+	RegisterHealthEndpoints(r, hr)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected cancelled result not to be cached, check ran %d times", got)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHealthSeverity(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("unreachable") }
+
+	tests := []struct {
+		name       string
+		severity   HealthSeverity
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "critical", severity: HealthCritical, wantCode: http.StatusServiceUnavailable, wantStatus: HealthStatusDegraded},
+		{name: "nonCritical", severity: HealthNonCritical, wantCode: http.StatusOK, wantStatus: HealthStatusDegraded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hr := NewHealthRegistry()
+			hr.RegisterChecks(HealthChecks{
+				Readiness: map[string]HealthCheck{"db": HealthStatusOK, "cache": failing},
+				Severity:  map[string]HealthSeverity{"cache": tt.severity},
+			})
+			r := chi.NewRouter()
+			RegisterHealthEndpoints(r, hr)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("expected status code %d, got %d", tt.wantCode, rec.Code)
+			}
+			var resp ProbeResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, resp.Status)
+			}
+			for _, res := range resp.Results {
+				if res.Name == "cache" && res.Severity != tt.severity {
+					t.Errorf("expected cache severity %q, got %q", tt.severity, res.Severity)
+				}
+				if res.Name == "db" && res.Severity != HealthCritical {
+					t.Errorf("expected db to default to critical, got %q", res.Severity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package aqm
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const defaultHedgeDelay = 100 * time.Millisecond
+
+// Resolver lists the base URLs of the replicas serving a backend.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticResolver serves a fixed list of base URLs.
+type StaticResolver []string
+
+// Resolve implements Resolver.
+func (r StaticResolver) Resolve(context.Context) ([]string, error) {
+	return []string(r), nil
+}
+
+type hedgeKeyType struct{}
+
+var hedgeKey hedgeKeyType
+
+// WithHedging opts the requests made with ctx into hedging. A hedged GET or
+// HEAD is sent to one resolver endpoint and, when it has not succeeded after
+// the client HedgeDelay, to a second one; the first success wins and the
+// other attempt is cancelled. Only use it for idempotent reads.
+func WithHedging(ctx context.Context) context.Context {
+	if ctx == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, hedgeKey, true)
+}
+
+// HedgingFrom reports whether ctx opted into hedging.
+func HedgingFrom(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(hedgeKey).(bool)
+	return enabled
+}
+
+func (c *HTTPClient) shouldHedge(ctx context.Context, method string) bool {
+	if c.Resolver == nil || !HedgingFrom(ctx) {
+		return false
+	}
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+type hedgeResult struct {
+	body  []byte
+	err   error
+	hedge bool
+}
+
+// sendHedged races a primary attempt against a delayed hedge on the next
+// endpoint. Endpoints rotate between calls so load spreads across replicas.
+func (c *HTTPClient) sendHedged(ctx context.Context, method, path string, payload []byte) ([]byte, error) {
+	endpoints, err := c.Resolver.Resolve(ctx)
+	if err != nil || len(endpoints) < 2 {
+		baseURL := c.BaseURL
+		if err == nil && len(endpoints) == 1 {
+			baseURL = endpoints[0]
+		}
+		return c.send(ctx, method, baseURL, path, payload)
+	}
+	offset := int(c.hedgeNext.Add(1)-1) % len(endpoints)
+	primary, secondary := endpoints[offset], endpoints[(offset+1)%len(endpoints)]
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, 2)
+	launch := func(baseURL string, hedge bool) {
+		go func() {
+			body, err := c.send(ctx, method, baseURL, path, payload)
+			results <- hedgeResult{body: body, err: err, hedge: hedge}
+		}()
+	}
+	metrics := c.Metrics
+	if metrics == nil {
+		metrics = NoopMetrics{}
+	}
+
+	launch(primary, false)
+	pending, hedged := 1, false
+	hedge := func() {
+		if hedged {
+			return
+		}
+		hedged = true
+		pending++
+		metrics.Counter(ctx, "http_client_hedges_total", 1, map[string]string{"method": method})
+		launch(secondary, true)
+	}
+
+	timer := time.NewTimer(c.HedgeDelay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedge()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if res.hedge {
+					metrics.Counter(ctx, "http_client_hedge_wins_total", 1, map[string]string{"method": method})
+				}
+				return res.body, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !res.hedge && c.shouldRetry(res.err) {
+				hedge()
+			}
+		}
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,135 @@
+package aqm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type counterMetrics struct {
+	NoopMetrics
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+func (m *counterMetrics) Counter(_ context.Context, name string, value float64, _ map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts == nil {
+		m.counts = map[string]float64{}
+	}
+	m.counts[name] += value
+}
+
+func (m *counterMetrics) get(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[name]
+}
+
+func replica(delay time.Duration, status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestHTTPClientHedging(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   *httptest.Server
+		secondary *httptest.Server
+		hedge     bool
+		want      string
+		hedges    float64
+		wins      float64
+	}{
+		{
+			name:      "slowPrimaryHedged",
+			primary:   replica(500*time.Millisecond, http.StatusOK, `{"from":"primary"}`),
+			secondary: replica(0, http.StatusOK, `{"from":"secondary"}`),
+			hedge:     true,
+			want:      "secondary",
+			hedges:    1,
+			wins:      1,
+		},
+		{
+			name:      "fastPrimaryNoHedge",
+			primary:   replica(0, http.StatusOK, `{"from":"primary"}`),
+			secondary: replica(0, http.StatusOK, `{"from":"secondary"}`),
+			hedge:     true,
+			want:      "primary",
+		},
+		{
+			name:      "failingPrimaryHedgesImmediately",
+			primary:   replica(0, http.StatusServiceUnavailable, `down`),
+			secondary: replica(0, http.StatusOK, `{"from":"secondary"}`),
+			hedge:     true,
+			want:      "secondary",
+			hedges:    1,
+			wins:      1,
+		},
+		{
+			name:      "notOptedIn",
+			primary:   replica(50*time.Millisecond, http.StatusOK, `{"from":"primary"}`),
+			secondary: replica(0, http.StatusOK, `{"from":"secondary"}`),
+			want:      "primary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.primary.Close()
+			defer tt.secondary.Close()
+			metrics := &counterMetrics{}
+			client := NewHTTPClient(HTTPClientConfig{
+				BaseURL:    tt.primary.URL,
+				Resolver:   StaticResolver{tt.primary.URL, tt.secondary.URL},
+				HedgeDelay: 20 * time.Millisecond,
+				Metrics:    metrics,
+			})
+			ctx := context.Background()
+			if tt.hedge {
+				ctx = WithHedging(ctx)
+			}
+
+			var result struct {
+				From string `json:"from"`
+			}
+			if err := client.Get(ctx, "/items", &result); err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if result.From != tt.want {
+				t.Errorf("expected response from %s, got %s", tt.want, result.From)
+			}
+			if got := metrics.get("http_client_hedges_total"); got != tt.hedges {
+				t.Errorf("expected %v hedges, got %v", tt.hedges, got)
+			}
+			if got := metrics.get("http_client_hedge_wins_total"); got != tt.wins {
+				t.Errorf("expected %v hedge wins, got %v", tt.wins, got)
+			}
+		})
+	}
+}
+
+func TestHTTPClientHedgingSkipsWrites(t *testing.T) {
+	client := &HTTPClient{Resolver: StaticResolver{"a", "b"}}
+	ctx := WithHedging(context.Background())
+	if client.shouldHedge(ctx, http.MethodPost) {
+		t.Error("expected writes never to be hedged")
+	}
+	if !client.shouldHedge(ctx, http.MethodGet) {
+		t.Error("expected opted-in GET to be hedged")
+	}
+	if (&HTTPClient{}).shouldHedge(ctx, http.MethodGet) {
+		t.Error("expected no hedging without resolver")
+	}
+}
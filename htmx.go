@@ -147,6 +147,7 @@ func TriggerEvent(w http.ResponseWriter, event interface{}) error {
 
 // RedirectOrHeader performs an HTMX-aware redirect. If the request is from HTMX,
 // it sets the HX-Redirect header. Otherwise, it performs a standard HTTP redirect.
+// Redirect also handles JSON clients and flash messages.
 func RedirectOrHeader(w http.ResponseWriter, r *http.Request, url string) {
 	if IsHTMX(r) {
 		SetHTMXRedirect(w, url)
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -38,7 +40,14 @@ func WithHTTPServerModules(addrKey string, modules ...HTTPModule) Option {
 
 // WithHTTPServer wires a chi-based HTTP server runner. It instantiates the
 // provided module factories, registers their routes, and mounts the resulting
-// server as a lifecycle-managed runner.
+// server as a lifecycle-managed runner. Streams opened with NewSSEStream or
+// registered through StreamsFrom are drained on shutdown within http.stream_grace
+// (default 3s). Handlers can instrument calls with Observe, configured by
+// observe.timeout and observe.slow_threshold. Every request joins the trace of
+// its traceparent header or starts one; http.expose_trace_id returns the trace
+// ID in X-Trace-Id. Error envelopes answered to Connect, gRPC-Web and gRPC
+// requests are rewritten by ConnectErrorMiddleware. Routes claimed by more than one module
+// fail with a RouteConflictError naming both modules.
 func WithHTTPServer(addrKey string, factories ...HTTPModuleFactory) Option {
 	return func(ms *Micro) error {
 		if addrKey == "" {
@@ -53,18 +62,31 @@ func WithHTTPServer(addrKey string, factories ...HTTPModuleFactory) Option {
 		ms.httpConfigured = true
 
 		router := chi.NewRouter()
+		router.Use(TraceMiddleware(ms.deps.Config.GetBoolOrFalse("http.expose_trace_id")))
+		router.Use(ConnectErrorMiddleware)
 		for _, mw := range ms.httpMiddlewares {
 			if mw == nil {
 				continue
 			}
 			router.Use(mw)
 		}
+		streams := NewStreamRegistry()
+		ms.streams = streams
+		router.Use(StreamsMiddleware(streams))
+		router.Use(ObserverMiddleware(func() *Observer { return NewObserver(ms.Deps()) }))
 
 		healthRegistry := NewHealthRegistry()
+		healthRegistry.SetCheckTimeout(ms.deps.Config.GetDurationOrDef("health.check_timeout", defaultHealthCheckTimeout))
+		healthRegistry.SetCacheTTL(ms.deps.Config.GetDurationOrDef("health.cache_ttl", defaultHealthCacheTTL))
 		RegisterHealthEndpoints(router, healthRegistry)
 		healthRegistry.RegisterLiveness("core", HealthStatusOK)
 		healthRegistry.RegisterReadiness("core", HealthStatusOK)
-		RegisterDebugRoutes(router, ms.debugRoutes)
+		healthRegistry.RegisterReadiness("warmup", ms.warmupReadiness)
+		debugEnabled := ms.debugRoutesEnabled()
+		table := &routeTable{}
+		ms.httpRouter, ms.routeTable = router, table
+		registerDebugRoutes(router, debugEnabled, ms.Routes)
+		RegisterDebugConfig(router, ms.deps.Config, debugEnabled)
 		for _, configurer := range ms.routerConfig {
 			if configurer != nil {
 				configurer(router)
@@ -78,55 +100,105 @@ func WithHTTPServer(addrKey string, factories ...HTTPModuleFactory) Option {
 			if reg.readiness != nil {
 				healthRegistry.RegisterReadiness(reg.name, reg.readiness)
 			}
+			if reg.severity != "" {
+				healthRegistry.SetSeverity(reg.name, reg.severity)
+			}
 		}
 
-		for _, factory := range factories {
-			if factory == nil {
-				return errors.New("nil http module factory")
-			}
-			module, err := factory(ms.deps)
-			if err != nil {
-				return fmt.Errorf("building http module: %w", err)
-			}
-			if module == nil {
-				return errors.New("http module factory returned nil module")
-			}
-			module.RegisterRoutes(router)
-			if reporter, ok := module.(HealthReporter); ok {
-				healthRegistry.RegisterChecks(reporter.HealthChecks())
-			}
-			if startable, ok := module.(Startable); ok {
-				ms.addStart(startable.Start)
-			}
-			if stoppable, ok := module.(Stoppable); ok {
-				ms.addStop(stoppable.Stop)
+		table.seed(router, CoreModule)
+		ms.httpHealth = healthRegistry
+		// Concat copies, so queued modules never land in the caller's slice.
+		for _, factory := range slices.Concat(factories, ms.httpModules) {
+			if err := ms.mountHTTPModule(factory); err != nil {
+				return err
 			}
 		}
+		ms.httpModules = nil
 
 		addr := ms.deps.Config.GetPort(addrKey, ":8080")
 
 		server := &http.Server{
-			Addr:    addr,
-			Handler: router,
+			Addr:      addr,
+			Handler:   router,
+			TLSConfig: ms.httpTLS,
 		}
+		ms.httpServer = server
+
+		runner := newHTTPServerRunner(server)
+		runner.streams = streams
+		runner.streamGrace = ms.deps.Config.GetDurationOrDef("http.stream_grace", defaultStreamGrace)
+		ms.runners = append(ms.runners, runner)
+		return nil
+	}
+}
 
-		ms.runners = append(ms.runners, newHTTPServerRunner(server))
+// addHTTPModule mounts factory on the HTTP server, or queues it until
+// WithHTTPServer runs. Callers hold ms.mu.
+func (ms *Micro) addHTTPModule(factory HTTPModuleFactory) error {
+	if !ms.httpConfigured {
+		ms.httpModules = append(ms.httpModules, factory)
 		return nil
 	}
+	return ms.mountHTTPModule(factory)
+}
+
+// mountHTTPModule builds the module and registers its routes, health checks,
+// lifecycle hooks and warmup. Callers hold ms.mu.
+func (ms *Micro) mountHTTPModule(factory HTTPModuleFactory) error {
+	if factory == nil {
+		return errors.New("nil http module factory")
+	}
+	module, err := factory(ms.deps)
+	if err != nil {
+		return fmt.Errorf("building http module: %w", err)
+	}
+	if module == nil {
+		return errors.New("http module factory returned nil module")
+	}
+	if err := ms.routeTable.registerModule(ms.httpRouter, moduleName(module), module); err != nil {
+		return err
+	}
+	if reporter, ok := module.(HealthReporter); ok {
+		ms.httpHealth.RegisterChecks(reporter.HealthChecks())
+	}
+	if startable, ok := module.(Startable); ok {
+		ms.startFuncs = append(ms.startFuncs, startable.Start)
+	}
+	if stoppable, ok := module.(Stoppable); ok {
+		ms.stopFuncs = append(ms.stopFuncs, stoppable.Stop)
+	}
+	if warmable, ok := module.(Warmable); ok {
+		ms.addWarmup(moduleName(module), 0, warmable.Warmup)
+	}
+	return nil
 }
 
 type httpServerRunner struct {
-	server *http.Server
-	errCh  chan error
+	server      *http.Server
+	errCh       chan error
+	streams     *StreamRegistry
+	streamGrace time.Duration
 }
 
-func newHTTPServerRunner(server *http.Server) Runner {
+func newHTTPServerRunner(server *http.Server) *httpServerRunner {
 	return &httpServerRunner{server: server, errCh: make(chan error, 1)}
 }
 
-func (r *httpServerRunner) Start(_ context.Context) error {
+func (r *httpServerRunner) Name() string {
+	return "http " + r.server.Addr
+}
+
+func (r *httpServerRunner) Start(ctx context.Context) error {
+	if r.server.BaseContext == nil {
+		base := ContextWithSupervisor(context.Background(), SupervisorFrom(ctx))
+		r.server.BaseContext = func(net.Listener) context.Context { return base }
+	}
 	go func() {
-		if err := r.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		serve := r.server.ListenAndServe
+		if r.server.TLSConfig != nil {
+			serve = func() error { return r.server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			r.errCh <- err
 		}
 		close(r.errCh)
@@ -134,10 +206,20 @@ func (r *httpServerRunner) Start(_ context.Context) error {
 	return nil
 }
 
+// Stop drains open streams for up to the stream grace period, so SSE and
+// WebSocket clients are told to reconnect elsewhere, then shuts the server
+// down.
 func (r *httpServerRunner) Stop(ctx context.Context) error {
+	var err error
+	if r.streams != nil {
+		graceCtx, cancelGrace := context.WithTimeout(context.WithoutCancel(ctx), r.streamGrace)
+		err = r.streams.Shutdown(graceCtx)
+		cancelGrace()
+	}
+
 	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	err := r.server.Shutdown(shutdownCtx)
+	err = errors.Join(err, r.server.Shutdown(shutdownCtx))
 	select {
 	case srvErr, ok := <-r.errCh:
 		if ok && srvErr != nil {
@@ -208,22 +208,53 @@ func (m *testLifecycleModule) Stop(ctx context.Context) error {
 }
 
 func TestWithHTTPServerLifecycleModule(t *testing.T) {
-	// Note: The lifecycle module registration happens within WithHTTPServer
-	// which holds a mutex. The addStart/addStop calls also try to acquire
-	// the mutex, but since they're called from the same goroutine and Go's
-	// sync.Mutex is not reentrant, this would deadlock in a real scenario.
-	// This test validates that the module interfaces are properly detected.
 	module := &testLifecycleModule{}
+	ms := NewMicro(
+		WithConfig(NewConfig()),
+		WithLogger(NewNoopLogger()),
+		WithHTTPServerModules("http.port", module),
+	)
+
+	if len(ms.startFuncs) != 1 || len(ms.stopFuncs) != 1 {
+		t.Fatalf("expected module lifecycle hooks, got %d start and %d stop", len(ms.startFuncs), len(ms.stopFuncs))
+	}
+	if err := ms.startFuncs[0](context.Background()); err != nil || !module.startCalled {
+		t.Errorf("start hook not wired: %v", err)
+	}
+	if err := ms.stopFuncs[0](context.Background()); err != nil || !module.stopCalled {
+		t.Errorf("stop hook not wired: %v", err)
+	}
+}
+
+type noRoutesModule struct{}
 
-	// Verify the module implements the expected interfaces
-	var _ Startable = module
-	var _ Stoppable = module
+func (noRoutesModule) RegisterRoutes(chi.Router) {}
+
+func TestWithHTTPServerKeepsCallerFactories(t *testing.T) {
+	sentinel := &testHTTPModule{}
+	queued := &testHTTPModule{}
+	backing := []HTTPModuleFactory{
+		func(*Deps) (HTTPModule, error) { return noRoutesModule{}, nil },
+		func(*Deps) (HTTPModule, error) { return sentinel, nil },
+	}
+	queue := func(ms *Micro) error {
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		return ms.addHTTPModule(func(*Deps) (HTTPModule, error) { return queued, nil })
+	}
+
+	NewMicro(
+		WithConfig(NewConfig()),
+		WithLogger(NewNoopLogger()),
+		queue,
+		WithHTTPServer("http.port", backing[:1]...),
+	)
 
-	if module.startCalled {
-		t.Error("startCalled should be false initially")
+	if !queued.registerCalled {
+		t.Fatal("queued module was not mounted")
 	}
-	if module.stopCalled {
-		t.Error("stopCalled should be false initially")
+	if module, _ := backing[1](nil); module != sentinel {
+		t.Fatal("queued module overwrote the caller's factory slice")
 	}
 }
 
@@ -3,10 +3,14 @@ package aqm
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,14 +20,49 @@ type HTTPClient struct {
 	HTTPClient *http.Client
 	MaxRetries int
 	RetryDelay time.Duration
+
+	// Resolver, HedgeDelay and Metrics drive hedged requests; see WithHedging.
+	Resolver   Resolver
+	HedgeDelay time.Duration
+	Metrics    Metrics
+
+	hedgeNext atomic.Uint64
 }
 
-// HTTPClientConfig describes the HTTP client behavior.
+// HTTPClientConfig describes the HTTP client behavior. Zero transport values
+// keep the net/http defaults, except MaxIdleConnsPerHost which defaults to 32
+// to suit service-to-service traffic.
 type HTTPClientConfig struct {
 	BaseURL    string
 	Timeout    time.Duration
 	MaxRetries int
 	RetryDelay time.Duration
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	TLSConfig           *tls.Config
+	// ClientCertificate is presented to servers that ask for one, for mTLS
+	// between services. It is reloaded when its files change.
+	ClientCertificate *WorkloadCertificate
+	// ProxyURL routes requests through a fixed proxy. When empty the
+	// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables apply. Invalid
+	// URLs are ignored.
+	ProxyURL     string
+	DisableHTTP2 bool
+	// DNSCacheTTL caches resolved host addresses for the given duration;
+	// zero resolves on every new connection.
+	DNSCacheTTL time.Duration
+	// Egress guards clients that call user supplied URLs against SSRF;
+	// see EgressPolicy.
+	Egress *EgressPolicy
+
+	// Resolver lists replicated endpoints for hedged requests, and
+	// HedgeDelay (default 100ms) is how long to wait before hedging.
+	Resolver   Resolver
+	HedgeDelay time.Duration
+	Metrics    Metrics
 }
 
 // NewHTTPClient creates a HTTPClient with sane defaults.
@@ -38,13 +77,29 @@ func NewHTTPClient(config HTTPClientConfig) *HTTPClient {
 		config.RetryDelay = 1 * time.Second
 	}
 
+	if config.HedgeDelay == 0 {
+		config.HedgeDelay = defaultHedgeDelay
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+
+	var transport http.RoundTripper = newHTTPTransport(config)
+	if config.Egress != nil {
+		transport = &egressTransport{base: transport, policy: config.Egress}
+	}
+
 	return &HTTPClient{
 		BaseURL: config.BaseURL,
 		HTTPClient: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: transport,
 		},
 		MaxRetries: config.MaxRetries,
 		RetryDelay: config.RetryDelay,
+		Resolver:   config.Resolver,
+		HedgeDelay: config.HedgeDelay,
+		Metrics:    config.Metrics,
 	}
 }
 
@@ -95,23 +150,50 @@ func (c *HTTPClient) doWithRetry(ctx context.Context, method, path string, body
 }
 
 func (c *HTTPClient) do(ctx context.Context, method, path string, body interface{}, result interface{}) error {
-	url := c.BaseURL + path
-
-	var bodyReader io.Reader
+	var payload []byte
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
 		if err != nil {
 			return fmt.Errorf("marshal request body: %w", err)
 		}
-		bodyReader = bytes.NewBuffer(jsonBody)
+		payload = jsonBody
+	}
+
+	var respBody []byte
+	var err error
+	if c.shouldHedge(ctx, method) {
+		respBody, err = c.sendHedged(ctx, method, path, payload)
+	} else {
+		respBody, err = c.send(ctx, method, c.BaseURL, path, payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	if result != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// send performs one request against baseURL and returns the response body.
+func (c *HTTPClient) send(ctx context.Context, method, baseURL, path string, payload []byte) ([]byte, error) {
+	url := baseURL + path
+
+	var bodyReader io.Reader
+	if payload != nil {
+		bodyReader = bytes.NewReader(payload)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	if body != nil {
+	if payload != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("Accept", "application/json")
@@ -119,25 +201,26 @@ func (c *HTTPClient) do(ctx context.Context, method, path string, body interface
 	if reqID := RequestIDFrom(ctx); reqID != "" {
 		req.Header.Set(RequestIDHeader, reqID)
 	}
+	SetTraceHeaders(ctx, req)
+	SetRequestTimeoutHeader(ctx, req)
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	bodyBytes, err := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 400 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return &HTTPError{StatusCode: resp.StatusCode, Message: string(bodyBytes)}
+		return nil, newHTTPError(resp.StatusCode, bodyBytes)
 	}
-
-	if result != nil && resp.StatusCode != http.StatusNoContent {
-		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-			return fmt.Errorf("decode response: %w", err)
-		}
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
 	}
-
-	return nil
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	return bodyBytes, nil
 }
 
 func (c *HTTPClient) shouldRetry(err error) bool {
@@ -145,6 +228,10 @@ func (c *HTTPClient) shouldRetry(err error) bool {
 		return false
 	}
 
+	if errors.Is(err, ErrEgressBlocked) {
+		return false
+	}
+
 	httpErr, ok := err.(*HTTPError)
 	if !ok {
 		return true
@@ -160,12 +247,72 @@ func (c *HTTPClient) shouldRetry(err error) bool {
 	}
 }
 
-// HTTPError wraps HTTP response failures.
+// HTTPError wraps HTTP response failures. When the downstream service answers
+// with the standard ErrorResponse envelope, Code, Message and Details mirror it;
+// otherwise Message holds the raw response body.
 type HTTPError struct {
 	StatusCode int
 	Message    string
+	Code       string
+	Details    []ValidationError
+}
+
+func newHTTPError(status int, body []byte) *HTTPError {
+	httpErr := &HTTPError{StatusCode: status, Message: string(body)}
+	var envelope ErrorResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return httpErr
+	}
+	if envelope.Error.Code == "" && envelope.Error.Message == "" {
+		return httpErr
+	}
+	httpErr.Code = envelope.Error.Code
+	httpErr.Message = envelope.Error.Message
+	httpErr.Details = envelope.Error.Details
+	return httpErr
+}
+
+// AsErrorResponse rebuilds the ErrorResponse envelope so the failure can be
+// re-emitted upstream unchanged.
+func (e *HTTPError) AsErrorResponse() ErrorResponse {
+	code := e.Code
+	if code == "" {
+		code = statusCode(e.StatusCode)
+	}
+	return ErrorResponse{
+		Error: ErrorPayload{
+			Code:    code,
+			Message: e.Message,
+			Details: e.Details,
+		},
+	}
+}
+
+// statusCode derives a snake_case error code such as "not_found" from the
+// HTTP status text, falling back to "error" for unknown statuses.
+func statusCode(status int) string {
+	var b strings.Builder
+	separate := false
+	for _, r := range strings.ToLower(http.StatusText(status)) {
+		if r < 'a' || r > 'z' {
+			separate = true
+			continue
+		}
+		if separate && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		separate = false
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "error"
+	}
+	return b.String()
 }
 
+// HasDetails reports whether the downstream service returned validation details.
+func (e *HTTPError) HasDetails() bool { return len(e.Details) > 0 }
+
 func (e *HTTPError) Error() string {
 	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
 }
@@ -174,6 +321,20 @@ func (e *HTTPError) IsNotFound() bool     { return e.StatusCode == http.StatusNo
 func (e *HTTPError) IsUnauthorized() bool { return e.StatusCode == http.StatusUnauthorized }
 func (e *HTTPError) IsForbidden() bool    { return e.StatusCode == http.StatusForbidden }
 
+// RespondHTTPError re-emits a downstream HTTPError found in err's chain with
+// its original status, code, message and validation details. It reports false
+// when err does not wrap an HTTPError so callers can fall back to their own
+// error handling.
+func RespondHTTPError(w http.ResponseWriter, err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	payload := httpErr.AsErrorResponse().Error
+	Error(w, httpErr.StatusCode, payload.Code, payload.Message, payload.Details...)
+	return true
+}
+
 // Ping checks the /healthz endpoint of the target service.
 func (c *HTTPClient) Ping(ctx context.Context) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/healthz", nil)
@@ -184,6 +345,7 @@ func (c *HTTPClient) Ping(ctx context.Context) error {
 	if reqID := RequestIDFrom(ctx); reqID != "" {
 		req.Header.Set(RequestIDHeader, reqID)
 	}
+	SetTraceHeaders(ctx, req)
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
@@ -3,6 +3,8 @@ package aqm
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -372,3 +374,78 @@ func TestHTTPClientConfigFields(t *testing.T) {
 		t.Error("RetryDelay not set")
 	}
 }
+
+func TestHTTPClientParsesErrorEnvelope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, http.StatusUnprocessableEntity, "validation_failed", "invalid task",
+			ValidationError{Field: "title", Code: "required", Message: "title is required"})
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL, MaxRetries: 1})
+	err := client.Post(context.Background(), "/tasks", map[string]string{}, nil)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected HTTPError, got %T", err)
+	}
+	if httpErr.Code != "validation_failed" || httpErr.Message != "invalid task" {
+		t.Errorf("unexpected code/message: %q %q", httpErr.Code, httpErr.Message)
+	}
+	if !httpErr.HasDetails() || httpErr.Details[0].Field != "title" {
+		t.Errorf("expected validation details, got %+v", httpErr.Details)
+	}
+}
+
+func TestHTTPErrorPlainBody(t *testing.T) {
+	err := newHTTPError(http.StatusBadGateway, []byte("upstream exploded"))
+	if err.Message != "upstream exploded" || err.Code != "" {
+		t.Errorf("unexpected error %+v", err)
+	}
+	resp := err.AsErrorResponse()
+	if resp.Error.Code != "bad_gateway" {
+		t.Errorf("expected code derived from status, got %q", resp.Error.Code)
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := map[int]string{
+		http.StatusNotFound:            "not_found",
+		http.StatusTeapot:              "i_m_a_teapot",
+		http.StatusInternalServerError: "internal_server_error",
+		599:                            "error",
+	}
+	for status, want := range tests {
+		if got := statusCode(status); got != want {
+			t.Errorf("statusCode(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestRespondHTTPError(t *testing.T) {
+	downstream := &HTTPError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "validation_failed",
+		Message:    "bad input",
+		Details:    []ValidationError{{Field: "name", Code: "required", Message: "name is required"}},
+	}
+
+	rec := httptest.NewRecorder()
+	if !RespondHTTPError(rec, fmt.Errorf("calling tasks: %w", downstream)) {
+		t.Fatal("expected wrapped HTTPError to be re-emitted")
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if resp.Error.Code != "validation_failed" || len(resp.Error.Details) != 1 {
+		t.Errorf("unexpected envelope %+v", resp)
+	}
+
+	if RespondHTTPError(httptest.NewRecorder(), errors.New("plain")) {
+		t.Error("expected plain error to be ignored")
+	}
+}
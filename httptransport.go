@@ -0,0 +1,150 @@
+package aqm
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const defaultMaxIdleConnsPerHost = 32
+
+// newHTTPTransport clones http.DefaultTransport and applies the pool, TLS,
+// proxy, HTTP/2, DNS cache and egress settings from config.
+func newHTTPTransport(config HTTPClientConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+	transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	if config.TLSConfig != nil {
+		transport.TLSClientConfig = config.TLSConfig.Clone()
+	}
+	if config.ClientCertificate != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		transport.TLSClientConfig.GetClientCertificate = config.ClientCertificate.GetClientCertificate
+	}
+	if config.ProxyURL != "" {
+		if proxy, err := url.Parse(config.ProxyURL); err == nil {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	if config.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		// A non-nil empty map stops net/http from negotiating h2 over TLS.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if config.DNSCacheTTL > 0 || config.Egress != nil {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		if config.Egress != nil {
+			// Checked on the resolved address; a proxy would resolve it instead.
+			dialer.ControlContext = config.Egress.control
+			transport.Proxy = nil
+		}
+		if config.DNSCacheTTL > 0 {
+			transport.DialContext = NewDNSCache(config.DNSCacheTTL).DialContext(dialer)
+		}
+	}
+	return transport
+}
+
+// DNSCache caches host lookups for a fixed TTL to reduce resolver pressure
+// under high request rates. It is safe for concurrent use.
+type DNSCache struct {
+	ttl      time.Duration
+	resolver interface {
+		LookupHost(ctx context.Context, host string) ([]string, error)
+	}
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewDNSCache builds a cache backed by net.DefaultResolver.
+func NewDNSCache(ttl time.Duration) *DNSCache {
+	return &DNSCache{
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+		now:      time.Now,
+		entries:  make(map[string]dnsCacheEntry),
+	}
+}
+
+// LookupHost returns the cached addresses for host, resolving them when
+// missing or expired. IP literals are returned as is.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsCacheEntry{addrs: addrs, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// DialContext returns a dial function that resolves through the cache and
+// tries each address in turn with dialer.
+func (c *DNSCache) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := c.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var dialErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = errors.Join(dialErr, err)
+		}
+		c.forget(host)
+		return nil, dialErr
+	}
+}
+
+// forget drops host so the next dial resolves it again.
+func (c *DNSCache) forget(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, host)
+}
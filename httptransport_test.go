@@ -0,0 +1,104 @@
+package aqm
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPTransport(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "api.internal"}
+	transport := newHTTPTransport(HTTPClientConfig{
+		MaxIdleConns:    50,
+		MaxConnsPerHost: 10,
+		IdleConnTimeout: 30 * time.Second,
+		TLSConfig:       tlsConfig,
+		ProxyURL:        "http://proxy.internal:3128",
+		DisableHTTP2:    true,
+	})
+
+	if transport.MaxIdleConns != 50 || transport.MaxConnsPerHost != 10 || transport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("unexpected pool settings %d/%d/%v", transport.MaxIdleConns, transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+	if transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Errorf("expected default idle conns per host, got %d", transport.MaxIdleConnsPerHost)
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.ServerName != "api.internal" {
+		t.Error("expected TLS config to be applied")
+	}
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil {
+		t.Error("expected HTTP/2 to be disabled")
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://svc.internal/", nil)
+	proxy, err := transport.Proxy(req)
+	if err != nil || proxy == nil || proxy.Host != "proxy.internal:3128" {
+		t.Errorf("expected fixed proxy, got %v (%v)", proxy, err)
+	}
+}
+
+type countingResolver struct {
+	calls atomic.Int32
+	addrs []string
+}
+
+func (r *countingResolver) LookupHost(context.Context, string) ([]string, error) {
+	r.calls.Add(1)
+	return r.addrs, nil
+}
+
+func TestDNSCache(t *testing.T) {
+	resolver := &countingResolver{addrs: []string{"127.0.0.1"}}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewDNSCache(time.Minute)
+	cache.resolver = resolver
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.LookupHost(context.Background(), "svc.internal"); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+	}
+	if resolver.calls.Load() != 1 {
+		t.Errorf("expected one resolution while fresh, got %d", resolver.calls.Load())
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = cache.LookupHost(context.Background(), "svc.internal")
+	if resolver.calls.Load() != 2 {
+		t.Errorf("expected re-resolution after expiry, got %d", resolver.calls.Load())
+	}
+
+	if addrs, _ := cache.LookupHost(context.Background(), "10.0.0.1"); len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+		t.Errorf("expected IP literal passthrough, got %v", addrs)
+	}
+}
+
+func TestDNSCacheDial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	resolver := &countingResolver{addrs: []string{"127.0.0.1"}}
+	cache := NewDNSCache(time.Minute)
+	cache.resolver = resolver
+	client := &http.Client{Transport: &http.Transport{DialContext: cache.DialContext(&net.Dialer{})}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get("http://svc.internal:" + port + "/")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		resp.Body.Close()
+		client.CloseIdleConnections()
+	}
+	if resolver.calls.Load() != 1 {
+		t.Errorf("expected cached resolution across dials, got %d", resolver.calls.Load())
+	}
+}
@@ -0,0 +1,129 @@
+package aqm
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+const (
+	// ImpersonateHeader names the user a request should act as.
+	ImpersonateHeader = "X-Impersonate-User"
+	// ImpersonatingHeader and ImpersonatorHeader are set on responses served
+	// under impersonation, holding the effective user and the real actor.
+	ImpersonatingHeader = "X-Impersonating"
+	ImpersonatorHeader  = "X-Impersonator"
+
+	// PermissionImpersonate is checked on the target user by default.
+	PermissionImpersonate = "users:impersonate"
+	// ImpersonatedByClaim is the claims context entry naming the actor on
+	// the effective claims.
+	ImpersonatedByClaim = "impersonated_by"
+)
+
+// ImpersonationOptions configures ImpersonationMiddleware.
+type ImpersonationOptions struct {
+	Authz      *auth.AuthzHelper // required; checks Permission on the target user
+	Permission string            // default PermissionImpersonate
+	Logger     Logger            // audit log; defaults to LoggerFrom(ctx)
+}
+
+// ImpersonationMiddleware lets support staff act as another user. When a
+// request carries X-Impersonate-User, the authenticated actor needs
+// Permission on that user, checked through opts.Authz. The effective claims
+// then become the target user's, while auth.ActorFrom still returns the real
+// actor for audit. Every impersonated request is logged with both
+// identities and answered with X-Impersonating and X-Impersonator headers.
+//
+// Place it after the middleware that stores the verified claims with
+// auth.WithClaims. Use DenyImpersonation on routes that must never run
+// impersonated, such as password changes.
+func ImpersonationMiddleware(opts ImpersonationOptions) func(http.Handler) http.Handler {
+	if opts.Permission == "" {
+		opts.Permission = PermissionImpersonate
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target := r.Header.Get(ImpersonateHeader)
+			if target == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+			actor := auth.ClaimsFrom(ctx)
+			if actor == nil {
+				Error(w, http.StatusUnauthorized, "unauthenticated", "authentication is required to impersonate")
+				return
+			}
+			if target == actor.Subject {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if opts.Authz == nil {
+				Error(w, http.StatusForbidden, "impersonation_forbidden", "impersonation is not enabled")
+				return
+			}
+			allowed, err := opts.Authz.CheckPermission(ctx, actor.Subject, opts.Permission, target)
+			if err != nil {
+				Error(w, http.StatusServiceUnavailable, "authz_unavailable", "cannot verify impersonation grant")
+				return
+			}
+			if !allowed {
+				Error(w, http.StatusForbidden, "impersonation_forbidden", "not allowed to impersonate this user")
+				return
+			}
+
+			effective := &auth.TokenClaims{
+				Subject:   target,
+				SessionID: actor.SessionID,
+				Audience:  actor.Audience,
+				ExpiresAt: actor.ExpiresAt,
+				Context:   map[string]string{ImpersonatedByClaim: actor.Subject},
+			}
+			ctx = auth.WithActor(auth.WithClaims(ctx, effective), actor)
+			ctx = ContextWithLogFields(ctx, "actor", actor.Subject, "impersonating", target)
+
+			logger := opts.Logger
+			if logger == nil {
+				logger = LoggerFrom(ctx)
+			} else {
+				logger = logger.With("actor", actor.Subject, "impersonating", target)
+			}
+			logger.Info("impersonated request", "method", r.Method, "path", r.URL.Path, "request_id", RequestIDFrom(ctx))
+
+			w.Header().Set(ImpersonatingHeader, target)
+			w.Header().Set(ImpersonatorHeader, actor.Subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// DenyImpersonation rejects impersonated requests with 403.
+func DenyImpersonation() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.IsImpersonating(r.Context()) {
+				Error(w, http.StatusForbidden, "impersonation_denied", "not available while impersonating")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSudo only lets requests through when the actor's session is in
+// sudo mode (see auth.GrantSudo), answering 403 with the sudo_required code
+// otherwise so clients can ask the user to re-authenticate. Under
+// impersonation the real actor must be in sudo mode.
+func RequireSudo() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.InSudoMode(auth.ActorFrom(r.Context()), time.Now()) {
+				Error(w, http.StatusForbidden, "sudo_required", "re-authenticate to continue")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package aqm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+type grantClient map[string]bool
+
+func (g grantClient) CheckPermission(_ context.Context, userID, permission, resource string) (bool, error) {
+	return g[userID+"|"+permission+"|"+resource], nil
+}
+
+func serveAs(claims *auth.TokenClaims, mw func(http.Handler) http.Handler, target string, next http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/orders", nil)
+	if claims != nil {
+		req = req.WithContext(auth.WithClaims(req.Context(), claims))
+	}
+	if target != "" {
+		req.Header.Set(ImpersonateHeader, target)
+	}
+	rec := httptest.NewRecorder()
+	mw(next).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImpersonationMiddleware(t *testing.T) {
+	authz := auth.NewAuthzHelper(grantClient{"support-1|users:impersonate|user-9": true}, time.Minute)
+	mw := ImpersonationMiddleware(ImpersonationOptions{Authz: authz, Logger: NewNoopLogger()})
+	support := &auth.TokenClaims{Subject: "support-1", Context: map[string]string{"role": "support"}}
+
+	var effective, actor *auth.TokenClaims
+	var impersonating bool
+	record := func(w http.ResponseWriter, r *http.Request) {
+		effective = auth.ClaimsFrom(r.Context())
+		actor = auth.ActorFrom(r.Context())
+		impersonating = auth.IsImpersonating(r.Context())
+	}
+
+	rec := serveAs(support, mw, "user-9", record)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if effective.Subject != "user-9" || actor.Subject != "support-1" || !impersonating {
+		t.Fatalf("effective %q, actor %q, impersonating %v", effective.Subject, actor.Subject, impersonating)
+	}
+	if effective.Context["role"] != "" || effective.Context[ImpersonatedByClaim] != "support-1" {
+		t.Fatalf("effective context = %v", effective.Context)
+	}
+	if rec.Header().Get(ImpersonatingHeader) != "user-9" || rec.Header().Get(ImpersonatorHeader) != "support-1" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+
+	rec = serveAs(support, mw, "user-2", record)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("ungranted target status = %d", rec.Code)
+	}
+
+	rec = serveAs(nil, mw, "user-9", record)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous status = %d", rec.Code)
+	}
+
+	rec = serveAs(support, mw, "", record)
+	if rec.Code != http.StatusOK || impersonating || effective.Subject != "support-1" || actor.Subject != "support-1" {
+		t.Fatalf("plain request: status %d, impersonating %v", rec.Code, impersonating)
+	}
+	if rec.Header().Get(ImpersonatingHeader) != "" {
+		t.Fatal("plain request carries impersonation header")
+	}
+}
+
+func TestDenyImpersonationAndRequireSudo(t *testing.T) {
+	authz := auth.NewAuthzHelper(grantClient{"support-1|users:impersonate|user-9": true}, time.Minute)
+	impersonate := ImpersonationMiddleware(ImpersonationOptions{Authz: authz, Logger: NewNoopLogger()})
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	deny := func(next http.Handler) http.Handler { return impersonate(DenyImpersonation()(next)) }
+	support := &auth.TokenClaims{Subject: "support-1"}
+	if rec := serveAs(support, deny, "user-9", ok); rec.Code != http.StatusForbidden {
+		t.Fatalf("deny impersonated status = %d", rec.Code)
+	}
+	if rec := serveAs(support, deny, "", ok); rec.Code != http.StatusOK {
+		t.Fatalf("deny plain status = %d", rec.Code)
+	}
+
+	sudo := func(next http.Handler) http.Handler { return impersonate(RequireSudo()(next)) }
+	if rec := serveAs(support, sudo, "", ok); rec.Code != http.StatusForbidden {
+		t.Fatalf("no sudo status = %d", rec.Code)
+	}
+	elevated := &auth.TokenClaims{Subject: "support-1"}
+	auth.GrantSudo(elevated, time.Minute)
+	if rec := serveAs(elevated, sudo, "", ok); rec.Code != http.StatusOK {
+		t.Fatalf("sudo status = %d", rec.Code)
+	}
+	if rec := serveAs(elevated, sudo, "user-9", ok); rec.Code != http.StatusOK {
+		t.Fatalf("sudo actor while impersonating status = %d", rec.Code)
+	}
+
+	expired := &auth.TokenClaims{Subject: "support-1"}
+	auth.GrantSudo(expired, -time.Second)
+	if rec := serveAs(expired, sudo, "", ok); rec.Code != http.StatusForbidden {
+		t.Fatalf("expired sudo status = %d", rec.Code)
+	}
+}
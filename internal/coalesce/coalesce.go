@@ -0,0 +1,112 @@
+// Package coalesce merges concurrent calls for the same key into one. It
+// backs aqm.Coalesce and lives here so packages aqm depends on, such as auth,
+// can use it too.
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group coalesces calls by key. Concurrent callers of Do with the same key
+// share a single execution of fn, and successful results are reused for the
+// group TTL. Errors are never cached.
+type Group[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	calls   map[K]*call[V]
+	results map[K]result[V]
+}
+
+type call[V any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	val     V
+	err     error
+}
+
+type result[V any] struct {
+	val     V
+	expires time.Time
+}
+
+// New builds a group keeping results for ttl. A zero ttl only shares calls
+// that are in flight.
+func New[K comparable, V any](ttl time.Duration) *Group[K, V] {
+	return &Group[K, V]{
+		ttl:     ttl,
+		calls:   make(map[K]*call[V]),
+		results: make(map[K]result[V]),
+	}
+}
+
+// Do returns the result of fn for key, running it at most once among
+// concurrent callers. shared reports whether the value came from another
+// caller's execution or from the TTL cache.
+//
+// fn runs with the values of the first caller's context but is only
+// cancelled once every waiting caller has given up; a caller whose ctx ends
+// returns ctx.Err() without affecting the others.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, shared bool, err error) {
+	g.mu.Lock()
+	if r, ok := g.results[key]; ok {
+		if time.Now().Before(r.expires) {
+			g.mu.Unlock()
+			return r.val, true, nil
+		}
+		delete(g.results, key)
+	}
+	c, inflight := g.calls[key]
+	if !inflight {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, inflight, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		var zero V
+		return zero, false, ctx.Err()
+	}
+}
+
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(ctx context.Context) (V, error)) {
+	c.val, c.err = fn(ctx)
+	c.cancel()
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+		if c.err == nil && g.ttl > 0 {
+			g.results[key] = result[V]{val: c.val, expires: time.Now().Add(g.ttl)}
+		}
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// Forget drops the cached result for key and detaches any call in flight, so
+// the next Do runs fn again.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.results, key)
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
@@ -0,0 +1,234 @@
+package aqm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JSONAPIMediaType is the media type mandated by the JSON:API specification.
+const JSONAPIMediaType = "application/vnd.api+json"
+
+// Pagination link relations used alongside RelNext/RelPrev.
+const (
+	RelFirst = "first"
+	RelLast  = "last"
+)
+
+// JSONAPIResourceIdentifier identifies a resource by type and id.
+type JSONAPIResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// JSONAPIRelationship describes a to-one or to-many relationship. Data holds
+// a *JSONAPIResourceIdentifier, a []JSONAPIResourceIdentifier or nil.
+type JSONAPIRelationship struct {
+	Data  any               `json:"data"`
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// JSONAPIResource is a single resource object.
+type JSONAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]any                 `json:"attributes,omitempty"`
+	Relationships map[string]JSONAPIRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+	Meta          any                            `json:"meta,omitempty"`
+}
+
+// JSONAPIErrorSource points at the request element responsible for an error.
+type JSONAPIErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// JSONAPIError is a JSON:API error object.
+type JSONAPIError struct {
+	Status string              `json:"status,omitempty"`
+	Code   string              `json:"code,omitempty"`
+	Title  string              `json:"title,omitempty"`
+	Detail string              `json:"detail,omitempty"`
+	Source *JSONAPIErrorSource `json:"source,omitempty"`
+}
+
+// JSONAPIVersion advertises the implemented specification version.
+type JSONAPIVersion struct {
+	Version string `json:"version"`
+}
+
+// JSONAPIDocument is the top-level JSON:API envelope. Data is always encoded:
+// nil becomes null (an empty to-one) and an empty slice becomes [] (an empty
+// collection). Documents carrying Errors omit data, as the specification
+// forbids both members together.
+type JSONAPIDocument struct {
+	JSONAPI  JSONAPIVersion    `json:"jsonapi"`
+	Data     any               `json:"data"`
+	Errors   []JSONAPIError    `json:"errors,omitempty"`
+	Included []JSONAPIResource `json:"included,omitempty"`
+	Meta     any               `json:"meta,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d JSONAPIDocument) MarshalJSON() ([]byte, error) {
+	if len(d.Errors) > 0 {
+		return json.Marshal(struct {
+			JSONAPI JSONAPIVersion    `json:"jsonapi"`
+			Errors  []JSONAPIError    `json:"errors"`
+			Meta    any               `json:"meta,omitempty"`
+			Links   map[string]string `json:"links,omitempty"`
+		}{d.JSONAPI, d.Errors, d.Meta, d.Links})
+	}
+	type document JSONAPIDocument
+	return json.Marshal(document(d))
+}
+
+// JSONAPIRelated lets a Linkable expose its relationships when converted with
+// JSONAPIResourceFor.
+type JSONAPIRelated interface {
+	JSONAPIRelationships() map[string]JSONAPIRelationship
+}
+
+// JSONAPIResourceFor converts a Linkable into a resource object. Attributes are
+// derived from the JSON encoding of obj, excluding the id field. The resource
+// type uses the plural form of ResourceType, matching the REST link paths.
+func JSONAPIResourceFor(obj Linkable) (JSONAPIResource, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return JSONAPIResource{}, fmt.Errorf("jsonapi: marshal %s: %w", obj.ResourceType(), err)
+	}
+	attrs := map[string]any{}
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return JSONAPIResource{}, fmt.Errorf("jsonapi: attributes for %s must be an object: %w", obj.ResourceType(), err)
+	}
+	delete(attrs, "id")
+	delete(attrs, "ID")
+
+	resource := JSONAPIResource{
+		Type:       Pluralize(obj.ResourceType()),
+		ID:         obj.GetID().String(),
+		Attributes: attrs,
+		Links:      JSONAPILinks(RESTfulLinksFor(obj)[0]),
+	}
+	if related, ok := obj.(JSONAPIRelated); ok {
+		resource.Relationships = related.JSONAPIRelationships()
+	}
+	return resource, nil
+}
+
+// JSONAPIResourcesFor converts a slice of Linkable values into resource objects.
+func JSONAPIResourcesFor[T Linkable](items []T) ([]JSONAPIResource, error) {
+	resources := make([]JSONAPIResource, 0, len(items))
+	for _, item := range items {
+		resource, err := JSONAPIResourceFor(item)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// JSONAPIIdentifierFor returns the resource identifier of obj.
+func JSONAPIIdentifierFor(obj Linkable) *JSONAPIResourceIdentifier {
+	return &JSONAPIResourceIdentifier{Type: Pluralize(obj.ResourceType()), ID: obj.GetID().String()}
+}
+
+// JSONAPILinks converts HATEOAS links into the JSON:API links object keyed by relation.
+func JSONAPILinks(links ...Link) map[string]string {
+	if len(links) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(links))
+	for _, link := range links {
+		out[link.Rel] = link.Href
+	}
+	return out
+}
+
+// JSONAPIPaginationLinks builds self/first/last/next/prev links for page-based
+// pagination using page[number] and page[size] query parameters. Pages are
+// one-based.
+func JSONAPIPaginationLinks(basePath string, page, size, total int) []Link {
+	if size <= 0 {
+		size = 1
+	}
+	if page <= 0 {
+		page = 1
+	}
+	last := (total + size - 1) / size
+	if last < 1 {
+		last = 1
+	}
+	pageURL := func(n int) string {
+		sep := "?"
+		if strings.Contains(basePath, "?") {
+			sep = "&"
+		}
+		return basePath + sep + "page[number]=" + strconv.Itoa(n) + "&page[size]=" + strconv.Itoa(size)
+	}
+	links := []Link{
+		{Rel: RelSelf, Href: pageURL(page)},
+		{Rel: RelFirst, Href: pageURL(1)},
+		{Rel: RelLast, Href: pageURL(last)},
+	}
+	if page > 1 {
+		links = append(links, Link{Rel: RelPrev, Href: pageURL(page - 1)})
+	}
+	if page < last {
+		links = append(links, Link{Rel: RelNext, Href: pageURL(page + 1)})
+	}
+	return links
+}
+
+// JSONAPIErrorsFrom maps an ErrorPayload into JSON:API error objects. Each
+// validation detail becomes its own error pointing at the offending attribute.
+func JSONAPIErrorsFrom(status int, payload ErrorPayload) []JSONAPIError {
+	statusText := strconv.Itoa(status)
+	if len(payload.Details) == 0 {
+		return []JSONAPIError{{
+			Status: statusText,
+			Code:   payload.Code,
+			Title:  http.StatusText(status),
+			Detail: payload.Message,
+		}}
+	}
+	errs := make([]JSONAPIError, 0, len(payload.Details))
+	for _, detail := range payload.Details {
+		errs = append(errs, JSONAPIError{
+			Status: statusText,
+			Code:   detail.Code,
+			Title:  payload.Message,
+			Detail: detail.Message,
+			Source: &JSONAPIErrorSource{Pointer: "/data/attributes/" + detail.Field},
+		})
+	}
+	return errs
+}
+
+// RespondJSONAPI writes a JSON:API document with the primary data, included
+// resources and top-level links. Data may be a JSONAPIResource, a slice of
+// them, or nil for an empty to-one relationship.
+func RespondJSONAPI(w http.ResponseWriter, code int, data any, included []JSONAPIResource, links ...Link) {
+	writeJSONAPI(w, code, JSONAPIDocument{
+		Data:     data,
+		Included: included,
+		Links:    JSONAPILinks(links...),
+	})
+}
+
+// RespondJSONAPIError writes a JSON:API error document derived from an ErrorPayload.
+func RespondJSONAPIError(w http.ResponseWriter, code int, payload ErrorPayload) {
+	writeJSONAPI(w, code, JSONAPIDocument{Errors: JSONAPIErrorsFrom(code, payload)})
+}
+
+func writeJSONAPI(w http.ResponseWriter, code int, doc JSONAPIDocument) {
+	doc.JSONAPI = JSONAPIVersion{Version: "1.1"}
+	w.Header().Set("Content-Type", JSONAPIMediaType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(doc)
+}
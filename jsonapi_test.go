@@ -0,0 +1,195 @@
+package aqm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type jsonapiArticle struct {
+	ID     uuid.UUID `json:"id"`
+	Title  string    `json:"title"`
+	Author uuid.UUID `json:"-"`
+}
+
+func (a jsonapiArticle) GetID() uuid.UUID     { return a.ID }
+func (a jsonapiArticle) ResourceType() string { return "article" }
+
+func (a jsonapiArticle) JSONAPIRelationships() map[string]JSONAPIRelationship {
+	return map[string]JSONAPIRelationship{
+		"author": {Data: &JSONAPIResourceIdentifier{Type: "people", ID: a.Author.String()}},
+	}
+}
+
+func TestJSONAPIResourceFor(t *testing.T) {
+	article := jsonapiArticle{ID: uuid.New(), Title: "Hello", Author: uuid.New()}
+
+	resource, err := JSONAPIResourceFor(article)
+	if err != nil {
+		t.Fatalf("JSONAPIResourceFor error: %v", err)
+	}
+	if resource.Type != "articles" {
+		t.Errorf("expected type articles, got %q", resource.Type)
+	}
+	if resource.ID != article.ID.String() {
+		t.Errorf("expected id %s, got %s", article.ID, resource.ID)
+	}
+	if _, ok := resource.Attributes["id"]; ok {
+		t.Error("id must not be part of attributes")
+	}
+	if resource.Attributes["title"] != "Hello" {
+		t.Errorf("expected title attribute, got %v", resource.Attributes["title"])
+	}
+	if resource.Links[RelSelf] != "/articles/"+article.ID.String() {
+		t.Errorf("unexpected self link %q", resource.Links[RelSelf])
+	}
+	if _, ok := resource.Relationships["author"]; !ok {
+		t.Error("expected author relationship")
+	}
+}
+
+func TestJSONAPIPaginationLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     int
+		wantNext bool
+		wantPrev bool
+	}{
+		{name: "firstPage", page: 1, wantNext: true},
+		{name: "middlePage", page: 2, wantNext: true, wantPrev: true},
+		{name: "lastPage", page: 3, wantPrev: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := JSONAPILinks(JSONAPIPaginationLinks("/articles", tt.page, 10, 25)...)
+			if _, ok := links[RelNext]; ok != tt.wantNext {
+				t.Errorf("next present = %v, want %v", ok, tt.wantNext)
+			}
+			if _, ok := links[RelPrev]; ok != tt.wantPrev {
+				t.Errorf("prev present = %v, want %v", ok, tt.wantPrev)
+			}
+			if links[RelLast] != "/articles?page[number]=3&page[size]=10" {
+				t.Errorf("unexpected last link %q", links[RelLast])
+			}
+		})
+	}
+}
+
+func TestJSONAPIErrorsFrom(t *testing.T) {
+	errs := JSONAPIErrorsFrom(http.StatusUnprocessableEntity, ErrorPayload{
+		Code:    "validation_failed",
+		Message: "invalid article",
+		Details: []ValidationError{
+			{Field: "title", Code: "required", Message: "title is required"},
+			{Field: "body", Code: "max_length", Message: "body too long"},
+		},
+	})
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d", len(errs))
+	}
+	if errs[0].Source == nil || errs[0].Source.Pointer != "/data/attributes/title" {
+		t.Errorf("unexpected pointer %+v", errs[0].Source)
+	}
+	if errs[1].Status != "422" {
+		t.Errorf("expected status 422, got %q", errs[1].Status)
+	}
+
+	plain := JSONAPIErrorsFrom(http.StatusNotFound, ErrorPayload{Code: "not_found", Message: "missing"})
+	if len(plain) != 1 || plain[0].Detail != "missing" {
+		t.Errorf("unexpected plain error %+v", plain)
+	}
+}
+
+func TestRespondJSONAPI(t *testing.T) {
+	article := jsonapiArticle{ID: uuid.New(), Title: "Hello"}
+	resource, _ := JSONAPIResourceFor(article)
+	included := []JSONAPIResource{{Type: "people", ID: "1", Attributes: map[string]any{"name": "Ada"}}}
+
+	rec := httptest.NewRecorder()
+	RespondJSONAPI(rec, http.StatusOK, []JSONAPIResource{resource}, included, JSONAPIPaginationLinks("/articles", 1, 10, 1)...)
+
+	if ct := rec.Header().Get("Content-Type"); ct != JSONAPIMediaType {
+		t.Errorf("expected %s, got %s", JSONAPIMediaType, ct)
+	}
+	var doc struct {
+		JSONAPI  JSONAPIVersion    `json:"jsonapi"`
+		Data     []JSONAPIResource `json:"data"`
+		Included []JSONAPIResource `json:"included"`
+		Links    map[string]string `json:"links"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if doc.JSONAPI.Version != "1.1" || len(doc.Data) != 1 || len(doc.Included) != 1 {
+		t.Errorf("unexpected document %+v", doc)
+	}
+	if doc.Links[RelFirst] == "" {
+		t.Error("expected first link")
+	}
+}
+
+func TestRespondJSONAPIError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	RespondJSONAPIError(rec, http.StatusBadRequest, ErrorPayload{Code: "bad_request", Message: "nope"})
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+	var doc JSONAPIDocument
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(doc.Errors) != 1 || doc.Errors[0].Code != "bad_request" {
+		t.Errorf("unexpected errors %+v", doc.Errors)
+	}
+}
+
+func TestRespondJSONAPIEmptyData(t *testing.T) {
+	tests := []struct {
+		name string
+		data any
+		want string
+	}{
+		{name: "nil", data: nil, want: `null`},
+		{name: "emptyCollection", data: []JSONAPIResource{}, want: `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			RespondJSONAPI(rec, http.StatusOK, tt.data, nil)
+
+			var doc map[string]json.RawMessage
+			if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			data, ok := doc["data"]
+			if !ok {
+				t.Fatal("expected a data member")
+			}
+			if string(data) != tt.want {
+				t.Errorf("expected data %s, got %s", tt.want, data)
+			}
+		})
+	}
+}
+
+func TestRespondJSONAPIErrorOmitsData(t *testing.T) {
+	rec := httptest.NewRecorder()
+	RespondJSONAPIError(rec, http.StatusNotFound, ErrorPayload{Code: "not_found", Message: "missing"})
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if _, ok := doc["data"]; ok {
+		t.Errorf("expected no data member in an error document, got %s", doc["data"])
+	}
+	if _, ok := doc["errors"]; !ok {
+		t.Error("expected an errors member")
+	}
+}
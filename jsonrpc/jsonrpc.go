@@ -0,0 +1,464 @@
+// Package jsonrpc serves JSON-RPC 2.0 over HTTP so internal automation and
+// tooling, e.g. MCP style agents or scripts, can call a service without
+// generated clients. Methods are registered by name with typed parameters;
+// the module answers single and batch requests on one POST endpoint and
+// lists its methods through the rpc.methods introspection call.
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultBasePath = "/rpc"
+	defaultMaxBatch = 100
+	defaultMaxBody  = 1 << 20
+
+	// IntrospectionMethod lists the registered methods.
+	IntrospectionMethod = "rpc.methods"
+)
+
+// Error codes defined by the JSON-RPC 2.0 specification, and the server
+// error codes the module maps common failures to.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeTimeout  = -32001
+	CodeCanceled = -32002
+)
+
+// Error is a JSON-RPC error object. Handlers return it to choose the code
+// sent to the caller.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %d %s", e.Code, e.Message)
+}
+
+// NewError builds an error with optional data.
+func NewError(code int, message string, data any) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
+
+// Handler serves one method. params is the raw params member, nil when
+// absent.
+type Handler interface {
+	Call(ctx context.Context, params json.RawMessage) (any, error)
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Call implements Handler.
+func (f HandlerFunc) Call(ctx context.Context, params json.RawMessage) (any, error) {
+	return f(ctx, params)
+}
+
+// Method adapts a typed function to Handler. Params given by name are
+// decoded into P, rejecting unknown fields; positional params are accepted
+// when P is a slice or array. Struct params are checked with
+// aqm.ValidateStruct, and decoding or validation failures answer
+// CodeInvalidParams.
+func Method[P, R any](fn func(ctx context.Context, params P) (R, error)) Handler {
+	return typedHandler[P, R](fn)
+}
+
+type typedHandler[P, R any] func(ctx context.Context, params P) (R, error)
+
+func (h typedHandler[P, R]) Call(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params P
+	if len(raw) > 0 && !bytes.Equal(raw, []byte("null")) {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&params); err != nil {
+			return nil, NewError(CodeInvalidParams, "invalid params", err.Error())
+		}
+	}
+	if t := reflect.TypeOf(params); t != nil && (t.Kind() == reflect.Struct || t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct) {
+		if errs := aqm.ValidateStruct(params); errs.HasErrors() {
+			return nil, NewError(CodeInvalidParams, "invalid params", errs)
+		}
+	}
+	return h(ctx, params)
+}
+
+// paramNames lists the JSON names of struct params for introspection.
+func (h typedHandler[P, R]) paramNames() []string {
+	t := reflect.TypeFor[P]()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Interceptor wraps every call, e.g. to authorize methods or record
+// metrics; call next to run the method.
+type Interceptor func(ctx context.Context, method string, next func(context.Context) (any, error)) (any, error)
+
+// MethodInfo describes a registered method in the rpc.methods result.
+type MethodInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Params      []string `json:"params,omitempty"`
+}
+
+type method struct {
+	handler     Handler
+	description string
+}
+
+// Module serves the registered methods on POST <base path>. It implements
+// aqm.HTTPModule.
+type Module struct {
+	basePath     string
+	maxBatch     int
+	maxBody      int64
+	middlewares  []func(http.Handler) http.Handler
+	interceptors []Interceptor
+	errorMapper  func(error) *Error
+	log          aqm.Logger
+
+	mu      sync.RWMutex
+	methods map[string]method
+}
+
+// Option configures the Module.
+type Option func(*Module)
+
+// WithBasePath overrides the endpoint (defaults to /rpc).
+func WithBasePath(base string) Option {
+	return func(m *Module) {
+		if base != "" {
+			m.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithMaxBatch limits the requests of one batch (default 100).
+func WithMaxBatch(n int) Option {
+	return func(m *Module) {
+		if n > 0 {
+			m.maxBatch = n
+		}
+	}
+}
+
+// WithMaxBodySize limits the request body in bytes (default 1 MiB).
+func WithMaxBodySize(n int64) Option {
+	return func(m *Module) {
+		if n > 0 {
+			m.maxBody = n
+		}
+	}
+}
+
+// WithMiddleware runs HTTP middleware, e.g. authentication, in front of the
+// endpoint only, after the middleware stack of the server.
+func WithMiddleware(middlewares ...func(http.Handler) http.Handler) Option {
+	return func(m *Module) {
+		for _, mw := range middlewares {
+			if mw != nil {
+				m.middlewares = append(m.middlewares, mw)
+			}
+		}
+	}
+}
+
+// WithInterceptor wraps every method call; the first interceptor runs
+// outermost.
+func WithInterceptor(interceptors ...Interceptor) Option {
+	return func(m *Module) {
+		for _, i := range interceptors {
+			if i != nil {
+				m.interceptors = append(m.interceptors, i)
+			}
+		}
+	}
+}
+
+// WithErrorMapper converts handler errors that are not an *Error; returning
+// nil falls back to the default mapping.
+func WithErrorMapper(mapper func(error) *Error) Option {
+	return func(m *Module) {
+		m.errorMapper = mapper
+	}
+}
+
+// WithLogger wires a custom logger, used for internal errors.
+func WithLogger(logger aqm.Logger) Option {
+	return func(m *Module) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// New builds an empty module.
+func New(opts ...Option) *Module {
+	m := &Module{
+		basePath: defaultBasePath,
+		maxBatch: defaultMaxBatch,
+		maxBody:  defaultMaxBody,
+		log:      aqm.NewNoopLogger(),
+		methods:  make(map[string]method),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// Register adds a method. Names starting with "rpc." are reserved by the
+// specification, and registering a name twice panics, as both are
+// programming errors.
+func (m *Module) Register(name, description string, handler Handler) {
+	if name == "" || handler == nil {
+		panic("jsonrpc: method name and handler required")
+	}
+	if strings.HasPrefix(name, "rpc.") {
+		panic("jsonrpc: method names starting with rpc. are reserved: " + name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.methods[name]; ok {
+		panic("jsonrpc: method already registered: " + name)
+	}
+	m.methods[name] = method{handler: handler, description: description}
+}
+
+// Methods returns the registered methods sorted by name.
+func (m *Module) Methods() []MethodInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infos := make([]MethodInfo, 0, len(m.methods))
+	for name, method := range m.methods {
+		info := MethodInfo{Name: name, Description: method.description}
+		if describer, ok := method.handler.(interface{ paramNames() []string }); ok {
+			info.Params = describer.paramNames()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Name implements the module naming used by the route table.
+func (m *Module) Name() string {
+	return "jsonrpc"
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (m *Module) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.With(m.middlewares...).Post(m.basePath, m.handle)
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func (m *Module) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, m.maxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			aqm.Error(w, http.StatusRequestEntityTooLarge, "body_too_large", "request body too large")
+			return
+		}
+		writeJSON(w, errorResponse(nil, NewError(CodeParseError, "parse error", nil)))
+		return
+	}
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSON(w, errorResponse(nil, NewError(CodeParseError, "parse error", nil)))
+			return
+		}
+		if len(batch) == 0 || len(batch) > m.maxBatch {
+			writeJSON(w, errorResponse(nil, NewError(CodeInvalidRequest, fmt.Sprintf("batch must hold 1 to %d requests", m.maxBatch), nil)))
+			return
+		}
+		var responses []*response
+		for _, raw := range batch {
+			if resp := m.serve(r.Context(), raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, responses)
+		return
+	}
+
+	if !json.Valid(body) {
+		writeJSON(w, errorResponse(nil, NewError(CodeParseError, "parse error", nil)))
+		return
+	}
+	resp := m.serve(r.Context(), body)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// serve runs one request and returns its response, or nil for a
+// notification.
+func (m *Module) serve(ctx context.Context, raw json.RawMessage) *response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil || req.Version != "2.0" || req.Method == "" || !validID(req.ID) {
+		return errorResponse(nil, NewError(CodeInvalidRequest, "invalid request", nil))
+	}
+	notification := req.ID == nil
+
+	result, err := m.call(ctx, req.Method, req.Params)
+	if notification {
+		if err != nil {
+			m.log.Debug("jsonrpc: notification failed", "method", req.Method, "error", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return errorResponse(req.ID, m.mapError(req.Method, err))
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return &response{Version: "2.0", Result: result, ID: req.ID}
+}
+
+func (m *Module) call(ctx context.Context, name string, params json.RawMessage) (any, error) {
+	var handler Handler
+	if name == IntrospectionMethod {
+		handler = HandlerFunc(func(context.Context, json.RawMessage) (any, error) {
+			return m.Methods(), nil
+		})
+	} else {
+		m.mu.RLock()
+		method, ok := m.methods[name]
+		m.mu.RUnlock()
+		if !ok {
+			return nil, NewError(CodeMethodNotFound, "method not found", name)
+		}
+		handler = method.handler
+	}
+
+	next := func(ctx context.Context) (any, error) {
+		return handler.Call(ctx, params)
+	}
+	for i := len(m.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := m.interceptors[i], next
+		next = func(ctx context.Context) (any, error) {
+			return interceptor(ctx, name, inner)
+		}
+	}
+	return next(ctx)
+}
+
+// mapError keeps *Error values, reports validation failures as invalid
+// params and context errors as timeouts or cancellations. Anything else is
+// logged and answered as an internal error without its message.
+func (m *Module) mapError(name string, err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	if m.errorMapper != nil {
+		if mapped := m.errorMapper(err); mapped != nil {
+			return mapped
+		}
+	}
+	var validation aqm.ValidationErrors
+	switch {
+	case errors.As(err, &validation):
+		return NewError(CodeInvalidParams, "invalid params", validation)
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewError(CodeTimeout, "timeout", nil)
+	case errors.Is(err, context.Canceled):
+		return NewError(CodeCanceled, "canceled", nil)
+	}
+	m.log.Error("jsonrpc: method failed", "method", name, "error", err)
+	return NewError(CodeInternalError, "internal error", nil)
+}
+
+// validID accepts an absent id, a string, a number or null.
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &response{Version: "2.0", Error: err, ID: id}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,196 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type greetParams struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func newTestServer(t *testing.T, opts ...Option) http.Handler {
+	t.Helper()
+	m := New(opts...)
+	m.Register("greet", "Greets someone", Method(func(_ context.Context, p greetParams) (string, error) {
+		return "hello " + p.Name, nil
+	}))
+	m.Register("sum", "", Method(func(_ context.Context, p []int) (int, error) {
+		total := 0
+		for _, n := range p {
+			total += n
+		}
+		return total, nil
+	}))
+	m.Register("fail", "", HandlerFunc(func(ctx context.Context, _ json.RawMessage) (any, error) {
+		return nil, errors.New("db password leaked")
+	}))
+	m.Register("slow", "", HandlerFunc(func(ctx context.Context, _ json.RawMessage) (any, error) {
+		return nil, context.DeadlineExceeded
+	}))
+	router := chi.NewRouter()
+	m.RegisterRoutes(router)
+	return router
+}
+
+func post(t *testing.T, h http.Handler, body string) (*httptest.ResponseRecorder, any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	var decoded any
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, decoded
+}
+
+func errorCode(resp any) float64 {
+	obj, _ := resp.(map[string]any)
+	errObj, _ := obj["error"].(map[string]any)
+	code, _ := errObj["code"].(float64)
+	return code
+}
+
+func TestCall(t *testing.T) {
+	h := newTestServer(t)
+
+	_, resp := post(t, h, `{"jsonrpc":"2.0","method":"greet","params":{"name":"ada"},"id":1}`)
+	if got := resp.(map[string]any); got["result"] != "hello ada" || got["id"] != float64(1) {
+		t.Errorf("greet = %v", got)
+	}
+	_, resp = post(t, h, `{"jsonrpc":"2.0","method":"sum","params":[1,2,3],"id":"a"}`)
+	if got := resp.(map[string]any); got["result"] != float64(6) || got["id"] != "a" {
+		t.Errorf("sum = %v", got)
+	}
+
+	rec, _ := post(t, h, `{"jsonrpc":"2.0","method":"greet","params":{"name":"ada"}}`)
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("notification = %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	h := newTestServer(t)
+	tests := []struct {
+		name string
+		body string
+		want float64
+	}{
+		{"parse", `{"jsonrpc":`, CodeParseError},
+		{"version", `{"method":"greet","id":1}`, CodeInvalidRequest},
+		{"id", `{"jsonrpc":"2.0","method":"greet","id":{}}`, CodeInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","method":"nope","id":1}`, CodeMethodNotFound},
+		{"unknown field", `{"jsonrpc":"2.0","method":"greet","params":{"nom":"x"},"id":1}`, CodeInvalidParams},
+		{"validation", `{"jsonrpc":"2.0","method":"greet","params":{},"id":1}`, CodeInvalidParams},
+		{"internal", `{"jsonrpc":"2.0","method":"fail","id":1}`, CodeInternalError},
+		{"timeout", `{"jsonrpc":"2.0","method":"slow","id":1}`, CodeTimeout},
+		{"empty batch", `[]`, CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := post(t, h, tt.body)
+			if rec.Code != http.StatusOK || errorCode(resp) != tt.want {
+				t.Errorf("response = %d %s, want code %v", rec.Code, rec.Body.String(), tt.want)
+			}
+		})
+	}
+
+	_, resp := post(t, h, `{"jsonrpc":"2.0","method":"fail","id":1}`)
+	if strings.Contains(resp.(map[string]any)["error"].(map[string]any)["message"].(string), "password") {
+		t.Error("internal error message leaked")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	h := newTestServer(t, WithMaxBatch(3))
+
+	_, resp := post(t, h, `[
+		{"jsonrpc":"2.0","method":"greet","params":{"name":"a"},"id":1},
+		{"jsonrpc":"2.0","method":"greet","params":{"name":"b"}},
+		{"jsonrpc":"2.0","method":"nope","id":2}
+	]`)
+	results, ok := resp.([]any)
+	if !ok || len(results) != 2 {
+		t.Fatalf("batch = %v", resp)
+	}
+	if results[0].(map[string]any)["result"] != "hello a" || errorCode(results[1]) != CodeMethodNotFound {
+		t.Errorf("batch results = %v", results)
+	}
+
+	_, resp = post(t, h, `[1,2,3,4]`)
+	if errorCode(resp) != CodeInvalidRequest {
+		t.Errorf("oversized batch = %v", resp)
+	}
+	_, resp = post(t, h, `[1]`)
+	if results, ok := resp.([]any); !ok || errorCode(results[0]) != CodeInvalidRequest {
+		t.Errorf("invalid batch entry = %v", resp)
+	}
+}
+
+func TestIntrospectionAndInterceptors(t *testing.T) {
+	var called []string
+	deny := func(ctx context.Context, method string, next func(context.Context) (any, error)) (any, error) {
+		called = append(called, method)
+		if method == "sum" {
+			return nil, NewError(-32003, "forbidden", nil)
+		}
+		return next(ctx)
+	}
+	requireKey := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Api-Key") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := newTestServer(t, WithInterceptor(deny), WithMiddleware(requireKey))
+
+	rec, _ := post(t, h, `{"jsonrpc":"2.0","method":"rpc.methods","id":1}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("middleware not applied: %d", rec.Code)
+	}
+
+	call := func(body string) any {
+		req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		req.Header.Set("X-Api-Key", "k")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp any
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	methods := call(`{"jsonrpc":"2.0","method":"rpc.methods","id":1}`).(map[string]any)["result"].([]any)
+	if len(methods) != 4 {
+		t.Fatalf("methods = %v", methods)
+	}
+	greet := methods[1].(map[string]any)
+	if greet["name"] != "greet" || greet["description"] != "Greets someone" || greet["params"].([]any)[0] != "name" {
+		t.Errorf("greet info = %v", greet)
+	}
+	if code := errorCode(call(`{"jsonrpc":"2.0","method":"sum","params":[1],"id":1}`)); code != -32003 {
+		t.Errorf("interceptor error code = %v", code)
+	}
+	if strings.Join(called, ",") != "rpc.methods,sum" {
+		t.Errorf("intercepted = %v", called)
+	}
+}
+
+func TestRegisterReserved(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for reserved name")
+		}
+	}()
+	New().Register("rpc.custom", "", HandlerFunc(func(context.Context, json.RawMessage) (any, error) { return nil, nil }))
+}
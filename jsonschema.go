@@ -0,0 +1,400 @@
+package aqm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const maxSchemaBodyBytes = 1 << 20
+
+// JSONSchema is a compiled JSON Schema supporting the keywords used for API
+// contracts: type, properties, required, additionalProperties, items, enum,
+// const, minLength, maxLength, pattern, format (email, uuid, date-time, date),
+// minimum, maximum, minItems, maxItems and local $ref into $defs.
+type JSONSchema struct {
+	Type                 schemaTypes            `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Const                any                    `json:"const,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+
+	reject  bool
+	pattern *regexp.Regexp
+	root    *JSONSchema
+}
+
+// schemaTypes accepts both "type": "string" and "type": ["string", "null"].
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("schema type must be a string or a list of strings")
+	}
+	*t = many
+	return nil
+}
+
+// UnmarshalJSON accepts the boolean schemas true (anything) and false
+// (nothing), as used by additionalProperties.
+func (s *JSONSchema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = JSONSchema{}
+		return nil
+	case "false":
+		*s = JSONSchema{reject: true}
+		return nil
+	}
+	type plain JSONSchema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// ParseJSONSchema compiles a schema document.
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	var schema JSONSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("parse json schema: %w", err)
+	}
+	if err := schema.compile(&schema); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// LoadJSONSchema reads and compiles the schema at path in fsys.
+func LoadJSONSchema(fsys fs.FS, path string) (*JSONSchema, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("read json schema %s: %w", path, err)
+	}
+	schema, err := ParseJSONSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// MustLoadJSONSchema is like LoadJSONSchema but panics on error, for schemas
+// embedded in the binary and loaded while declaring routes.
+func MustLoadJSONSchema(fsys fs.FS, path string) *JSONSchema {
+	schema, err := LoadJSONSchema(fsys, path)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// ValidateJSONSchema validates doc against the schema at path in fsys. The
+// error is only set when the schema cannot be loaded.
+func ValidateJSONSchema(doc []byte, fsys fs.FS, path string) (ValidationErrors, error) {
+	schema, err := LoadJSONSchema(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Validate(doc), nil
+}
+
+func (s *JSONSchema) compile(root *JSONSchema) error {
+	s.root = root
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if s.Ref != "" {
+		if _, err := s.resolve(); err != nil {
+			return err
+		}
+	}
+	children := []*JSONSchema{s.AdditionalProperties, s.Items}
+	for _, child := range s.Properties {
+		children = append(children, child)
+	}
+	for _, child := range s.Defs {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		if err := child.compile(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) resolve() (*JSONSchema, error) {
+	name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported schema reference %q", s.Ref)
+	}
+	target := s.root.Defs[name]
+	if target == nil {
+		return nil, fmt.Errorf("unknown schema reference %q", s.Ref)
+	}
+	return target, nil
+}
+
+// Validate checks doc and returns one ValidationError per violation, with
+// Field set to the JSON pointer of the offending value ("" for the root).
+func (s *JSONSchema) Validate(doc []byte) ValidationErrors {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return ValidationErrors{{Field: "", Code: "invalid_json", Message: "Body is not valid JSON"}}
+	}
+	var errs ValidationErrors
+	s.validate("", value, &errs)
+	return errs
+}
+
+// ValidateValue checks an already decoded value, such as a struct.
+func (s *JSONSchema) ValidateValue(value any) ValidationErrors {
+	doc, err := json.Marshal(value)
+	if err != nil {
+		return ValidationErrors{{Field: "", Code: "invalid_json", Message: err.Error()}}
+	}
+	return s.Validate(doc)
+}
+
+func (s *JSONSchema) validate(pointer string, value any, errs *ValidationErrors) {
+	if s.reject {
+		s.fail(errs, pointer, "not_allowed", "Value is not allowed")
+		return
+	}
+	if s.Ref != "" {
+		if target, err := s.resolve(); err == nil {
+			target.validate(pointer, value, errs)
+		}
+		return
+	}
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		s.fail(errs, pointer, "type", fmt.Sprintf("Expected %s", strings.Join(s.Type, " or ")))
+		return
+	}
+	if len(s.Enum) > 0 && !containsJSON(s.Enum, value) {
+		s.fail(errs, pointer, "enum", "Value is not one of the allowed values")
+	}
+	if s.Const != nil && !jsonEqual(s.Const, value) {
+		s.fail(errs, pointer, "const", "Value does not match the expected constant")
+	}
+
+	switch v := value.(type) {
+	case string:
+		s.validateString(pointer, v, errs)
+	case json.Number:
+		s.validateNumber(pointer, v, errs)
+	case []any:
+		s.validateArray(pointer, v, errs)
+	case map[string]any:
+		s.validateObject(pointer, v, errs)
+	}
+}
+
+func (s *JSONSchema) validateString(pointer, v string, errs *ValidationErrors) {
+	length := len([]rune(v))
+	if s.MinLength != nil && length < *s.MinLength {
+		s.fail(errs, pointer, "min_length", fmt.Sprintf("Must be at least %d characters", *s.MinLength))
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		s.fail(errs, pointer, "max_length", fmt.Sprintf("Must be at most %d characters", *s.MaxLength))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		s.fail(errs, pointer, "pattern", fmt.Sprintf("Must match %s", s.Pattern))
+	}
+	if s.Format != "" && !matchesFormat(s.Format, v) {
+		s.fail(errs, pointer, "format", fmt.Sprintf("Must be a valid %s", s.Format))
+	}
+}
+
+func (s *JSONSchema) validateNumber(pointer string, v json.Number, errs *ValidationErrors) {
+	n, err := v.Float64()
+	if err != nil {
+		return
+	}
+	if s.Minimum != nil && n < *s.Minimum {
+		s.fail(errs, pointer, "minimum", fmt.Sprintf("Must be at least %v", *s.Minimum))
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		s.fail(errs, pointer, "maximum", fmt.Sprintf("Must be at most %v", *s.Maximum))
+	}
+}
+
+func (s *JSONSchema) validateArray(pointer string, v []any, errs *ValidationErrors) {
+	if s.MinItems != nil && len(v) < *s.MinItems {
+		s.fail(errs, pointer, "min_items", fmt.Sprintf("Must have at least %d items", *s.MinItems))
+	}
+	if s.MaxItems != nil && len(v) > *s.MaxItems {
+		s.fail(errs, pointer, "max_items", fmt.Sprintf("Must have at most %d items", *s.MaxItems))
+	}
+	if s.Items != nil {
+		for i, item := range v {
+			s.Items.validate(pointer+"/"+strconv.Itoa(i), item, errs)
+		}
+	}
+}
+
+func (s *JSONSchema) validateObject(pointer string, v map[string]any, errs *ValidationErrors) {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			s.fail(errs, pointer+"/"+escapePointer(name), "required", "Field is required")
+		}
+	}
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := pointer + "/" + escapePointer(key)
+		if prop, ok := s.Properties[key]; ok {
+			prop.validate(child, v[key], errs)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if s.AdditionalProperties.reject {
+			s.fail(errs, child, "additional_property", "Field is not allowed")
+			continue
+		}
+		s.AdditionalProperties.validate(child, v[key], errs)
+	}
+}
+
+func (s *JSONSchema) fail(errs *ValidationErrors, pointer, code, message string) {
+	*errs = append(*errs, ValidationError{Field: pointer, Code: code, Message: message})
+}
+
+func (s *JSONSchema) matchesType(value any) bool {
+	for _, typ := range s.Type {
+		switch v := value.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case json.Number:
+			if typ == "number" {
+				return true
+			}
+			if typ == "integer" {
+				if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case []any:
+			if typ == "array" {
+				return true
+			}
+		case map[string]any:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesFormat(format, v string) bool {
+	switch format {
+	case "email":
+		return IsEmail(v)
+	case "uuid":
+		_, err := uuid.Parse(v)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, v)
+		return err == nil
+	}
+	// Unknown formats are annotations only.
+	return true
+}
+
+func containsJSON(values []any, value any) bool {
+	for _, candidate := range values {
+		if jsonEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonEqual(a, b any) bool {
+	left, errA := json.Marshal(a)
+	right, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(left, right)
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// ValidateBody rejects requests whose JSON body does not match schema with a
+// 422 error envelope listing every violation, and passes the body through
+// unchanged otherwise. Bodies over 1 MiB are rejected with 413.
+func ValidateBody(schema *JSONSchema) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxSchemaBodyBytes+1))
+			if err != nil {
+				RespondError(w, http.StatusBadRequest, "cannot read request body")
+				return
+			}
+			if len(body) > maxSchemaBodyBytes {
+				RespondError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			if errs := schema.Validate(body); errs.HasErrors() {
+				Error(w, http.StatusUnprocessableEntity, "validation_failed", "Request body does not match schema", errs...)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package aqm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const userSchema = `{
+  "type": "object",
+  "required": ["name", "email"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "minLength": 2},
+    "email": {"type": "string", "format": "email"},
+    "age": {"type": "integer", "minimum": 0},
+    "role": {"enum": ["admin", "member"]},
+    "tags": {"type": "array", "maxItems": 2, "items": {"$ref": "#/$defs/tag"}}
+  },
+  "$defs": {
+    "tag": {"type": "string", "pattern": "^[a-z]+$"}
+  }
+}`
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want map[string]string
+	}{
+		{name: "valid", doc: `{"name":"Ada","email":"ada@example.com","age":36,"role":"admin","tags":["math"]}`},
+		{name: "missing required", doc: `{"name":"Ada"}`, want: map[string]string{"/email": "required"}},
+		{name: "wrong types", doc: `{"name":1,"email":"ada@example.com","age":1.5}`, want: map[string]string{"/name": "type", "/age": "type"}},
+		{
+			name: "constraints",
+			doc:  `{"name":"A","email":"nope","age":-1,"role":"root","tags":["ok","Bad","x"],"extra":true}`,
+			want: map[string]string{
+				"/name":   "min_length",
+				"/email":  "format",
+				"/age":    "minimum",
+				"/role":   "enum",
+				"/tags":   "max_items",
+				"/tags/1": "pattern",
+				"/extra":  "additional_property",
+			},
+		},
+		{name: "invalid json", doc: `{`, want: map[string]string{"": "invalid_json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := schema.Validate([]byte(tt.doc))
+			got := make(map[string]string, len(errs))
+			for _, e := range errs {
+				got[e.Field] = e.Code
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for field, code := range tt.want {
+				if got[field] != code {
+					t.Errorf("field %q: expected %q, got %q", field, code, got[field])
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONSchemaErrors(t *testing.T) {
+	for _, doc := range []string{`{"pattern":"("}`, `{"$ref":"#/$defs/missing"}`, `{"type":1}`} {
+		if _, err := ParseJSONSchema([]byte(doc)); err == nil {
+			t.Errorf("expected error for %s", doc)
+		}
+	}
+}
+
+func TestValidateJSONSchemaFromFS(t *testing.T) {
+	fsys := fstest.MapFS{"schemas/user.json": {Data: []byte(userSchema)}}
+	errs, err := ValidateJSONSchema([]byte(`{"name":"Ada"}`), fsys, "schemas/user.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(errs) != 1 || errs[0].Field != "/email" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if _, err := ValidateJSONSchema(nil, fsys, "schemas/missing.json"); err == nil {
+		t.Error("expected error for missing schema")
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	schema := MustLoadJSONSchema(fstest.MapFS{"user.json": {Data: []byte(userSchema)}}, "user.json")
+	handler := ValidateBody(schema)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Ada","email":"ada@example.com"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Ada") {
+		t.Fatalf("expected body passed through, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Ada"}`)))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", rec.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Error.Code != "validation_failed" || len(resp.Error.Details) != 1 || resp.Error.Details[0].Field != "/email" {
+		t.Errorf("unexpected error payload %+v", resp.Error)
+	}
+}
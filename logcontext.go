@@ -0,0 +1,151 @@
+package aqm
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+var logContextKey = aqmctx.NewKey[logContext]("logger")
+
+type logContext struct {
+	logger Logger
+	fields []any
+}
+
+// ContextWithLogger stores logger as the base of the request-scoped logger
+// returned by LoggerFrom.
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	if ctx == nil || logger == nil {
+		return ctx
+	}
+	current := logContextFrom(ctx)
+	return logContextKey.With(ctx, logContext{logger: logger, fields: current.fields})
+}
+
+// ContextWithLogFields adds key/value pairs (e.g. "tenant_id", id) that
+// LoggerFrom attaches to every entry logged with the returned context.
+// Middleware uses it to enrich downstream logs without passing loggers around.
+func ContextWithLogFields(ctx context.Context, args ...any) context.Context {
+	if ctx == nil || len(args) == 0 {
+		return ctx
+	}
+	current := logContextFrom(ctx)
+	fields := make([]any, 0, len(current.fields)+len(args))
+	fields = append(fields, current.fields...)
+	fields = append(fields, args...)
+	return logContextKey.With(ctx, logContext{logger: current.logger, fields: fields})
+}
+
+// LoggerFrom returns the request-scoped logger stored in ctx, pre-populated
+// with the fields added through ContextWithLogFields and the trace_id and
+// span_id of the current span. A no-op logger is used when none was stored.
+func LoggerFrom(ctx context.Context) Logger {
+	current := logContextFrom(ctx)
+	logger := current.logger
+	if logger == nil {
+		logger = NewNoopLogger()
+	}
+	fields := current.fields
+	if trace := TraceFields(ctx); trace != nil {
+		fields = append(fields[:len(fields):len(fields)], trace...)
+	}
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
+
+func logContextFrom(ctx context.Context) logContext {
+	current, _ := logContextKey.From(ctx)
+	return current
+}
+
+// LoggerMiddleware stores logger in the request context and tags it with the
+// request ID, so handlers can call LoggerFrom(r.Context()).
+func LoggerMiddleware(logger Logger) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = NewNoopLogger()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := ContextWithLogger(r.Context(), logger)
+			if reqID := RequestIDFrom(ctx); reqID != "" {
+				ctx = ContextWithLogFields(ctx, "request_id", reqID)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// SlogHandler adapts logger to slog.Handler so code written against the
+// standard library slog package logs through the aqm Logger. Level filtering
+// is left to logger.
+func SlogHandler(logger Logger) slog.Handler {
+	if logger == nil {
+		logger = NewNoopLogger()
+	}
+	return &slogAdapter{logger: logger}
+}
+
+type slogAdapter struct {
+	logger Logger
+	group  string
+}
+
+func (h *slogAdapter) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *slogAdapter) Handle(ctx context.Context, record slog.Record) error {
+	args := make([]any, 0, record.NumAttrs()+1)
+	args = append(args, record.Message)
+	record.Attrs(func(attr slog.Attr) bool {
+		args = append(args, h.qualify(attr))
+		return true
+	})
+
+	switch {
+	case record.Level >= slog.LevelError:
+		h.logger.Error(args...)
+	case record.Level >= slog.LevelWarn:
+		h.logger.Warn(args...)
+	case record.Level >= slog.LevelInfo:
+		h.logger.Info(args...)
+	default:
+		h.logger.Debug(args...)
+	}
+	return nil
+}
+
+func (h *slogAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	args := make([]any, len(attrs))
+	for i, attr := range attrs {
+		args[i] = h.qualify(attr)
+	}
+	return &slogAdapter{logger: h.logger.With(args...), group: h.group}
+}
+
+func (h *slogAdapter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &slogAdapter{logger: h.logger, group: group}
+}
+
+func (h *slogAdapter) qualify(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	if h.group != "" {
+		attr.Key = h.group + "." + attr.Key
+	}
+	return attr
+}
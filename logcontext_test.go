@@ -0,0 +1,93 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+func newBufferLogger(buf *bytes.Buffer) Logger {
+	return &standardLogger{logger: log.New(buf, "", 0), logLevel: DebugLevel}
+}
+
+func TestLoggerFrom(t *testing.T) {
+	if _, ok := LoggerFrom(context.Background()).(noopLogger); !ok {
+		t.Error("expected noop logger without a stored logger")
+	}
+
+	var buf bytes.Buffer
+	ctx := ContextWithLogFields(context.Background(), "tenant_id", "acme")
+	ctx = ContextWithLogger(ctx, newBufferLogger(&buf))
+	ctx = ContextWithLogFields(ctx, "user_id", "u1")
+
+	LoggerFrom(ctx).Info("hello")
+	out := buf.String()
+	if !strings.Contains(out, "tenant_id=acme") || !strings.Contains(out, "user_id=u1") {
+		t.Errorf("expected context fields in %q", out)
+	}
+}
+
+func TestLoggerMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	handler := RequestIDMiddleware(LoggerMiddleware(newBufferLogger(&buf))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFrom(r.Context()).Info("handled")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), "request_id=req-42") {
+		t.Errorf("expected request id in %q", buf.String())
+	}
+}
+
+func TestLoggerFromSnapshot(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := ContextWithLogger(context.Background(), newBufferLogger(&buf))
+	ctx = ContextWithLogFields(WithRequestID(ctx, "req-7"), "tenant_id", "acme")
+
+	detached := aqmctx.Snapshot(ctx).Restore(context.Background())
+	LoggerFrom(detached).Info("background")
+	if !strings.Contains(buf.String(), "tenant_id=acme") {
+		t.Errorf("expected log fields to survive snapshot in %q", buf.String())
+	}
+	if RequestIDFrom(detached) != "req-7" {
+		t.Errorf("expected request id to survive snapshot, got %q", RequestIDFrom(detached))
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(SlogHandler(newBufferLogger(&buf)))
+
+	tests := []struct {
+		name  string
+		log   func()
+		level string
+		want  string
+	}{
+		{name: "debug", log: func() { logger.Debug("dbg", "k", 1) }, level: "[DEBUG]", want: "dbg k=1"},
+		{name: "warn", log: func() { logger.Warn("careful") }, level: "[WARN]", want: "careful"},
+		{name: "error", log: func() { logger.Error("boom", "err", "x") }, level: "[ERROR]", want: "boom err=x"},
+		{name: "groupAndAttrs", log: func() { logger.With("svc", "api").WithGroup("db").Info("query", "ms", 3) }, level: "[INFO]", want: "svc=api query db.ms=3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			tt.log()
+			out := strings.TrimSpace(buf.String())
+			if !strings.HasPrefix(out, tt.level) || !strings.Contains(out, tt.want) {
+				t.Errorf("expected %s %q, got %q", tt.level, tt.want, out)
+			}
+		})
+	}
+}
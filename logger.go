@@ -1,12 +1,15 @@
 package aqm
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -17,49 +20,95 @@ type LogLevel int
 const (
 	DebugLevel LogLevel = iota
 	InfoLevel
+	WarnLevel
 	ErrorLevel
 )
 
+// LogComponentKey is the With key that selects a per-component level
+// override, e.g. logger.With(LogComponentKey, "http") picks up log.level.http.
+const LogComponentKey = "component"
+
+// slogLevelFatal renders as FATAL; entries at this level bypass level filtering.
+const slogLevelFatal = slog.Level(12)
+
 type Logger interface {
 	Debug(v ...any)
 	Debugf(format string, a ...any)
 	Info(v ...any)
 	Infof(format string, a ...any)
+	Warn(v ...any)
+	Warnf(format string, a ...any)
 	Error(v ...any)
 	Errorf(format string, a ...any)
+	// Fatal and Fatalf log the entry, run the OnFatal hooks and exit with
+	// status 1.
+	Fatal(v ...any)
+	Fatalf(format string, a ...any)
 	SetLogLevel(level LogLevel)
 	With(args ...any) Logger
 }
 
 type slogLogger struct {
-	logger   *slog.Logger
-	logLevel LogLevel
+	logger    *slog.Logger
+	logLevel  LogLevel
+	overrides map[string]LogLevel
 }
 
 func NewLogger(logLevelStr string) Logger {
-	level := toValidLevel(logLevelStr)
+	return NewLoggerWithWriter(logLevelStr, os.Stdout)
+}
+
+// NewLoggerWithWriter builds a structured Logger that writes to w instead of
+// stdout. Combine it with NewRotatingFile, NewAsyncWriter or io.MultiWriter to
+// route logs to other destinations.
+func NewLoggerWithWriter(logLevelStr string, w io.Writer) Logger {
+	return newSlogLogger(toValidLevel(logLevelStr), nil, w)
+}
+
+// newSlogLogger builds a slogLogger whose children created with
+// With(LogComponentKey, name) use overrides[name] when present.
+func newSlogLogger(level LogLevel, overrides map[string]LogLevel, w io.Writer) *slogLogger {
+	if w == nil {
+		w = os.Stdout
+	}
+
+	minLevel := level
+	for _, override := range overrides {
+		if override < minLevel {
+			minLevel = override
+		}
+	}
+	opts := &slog.HandlerOptions{
+		Level: slogLevel(minLevel),
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.LevelKey {
+				if lvl, ok := attr.Value.Any().(slog.Level); ok && lvl == slogLevelFatal {
+					attr.Value = slog.StringValue("FATAL")
+				}
+			}
+			return attr
+		},
+	}
 
 	var handler slog.Handler
-	if isTerminal() {
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slogLevel(level),
-		})
+	if isTerminal(w) {
+		handler = slog.NewTextHandler(w, opts)
 	} else {
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slogLevel(level),
-		})
+		handler = slog.NewJSONHandler(w, opts)
 	}
 
 	return &slogLogger{
-		logger:   slog.New(handler),
-		logLevel: level,
+		logger:    slog.New(handler),
+		logLevel:  level,
+		overrides: overrides,
 	}
 }
 
 type standardLogger struct {
-	logger   *log.Logger
-	logLevel LogLevel
-	prefix   string
+	logger    *log.Logger
+	logLevel  LogLevel
+	prefix    string
+	overrides map[string]LogLevel
 }
 
 // NewStandardLogger builds a Logger that emits plain text log lines using the
@@ -99,6 +148,19 @@ func (l *slogLogger) Infof(format string, a ...any) {
 	}
 }
 
+func (l *slogLogger) Warn(v ...any) {
+	if l.logLevel <= WarnLevel {
+		msg, attrs := normalizeArgs(v...)
+		l.logger.Warn(msg, attrs...)
+	}
+}
+
+func (l *slogLogger) Warnf(format string, a ...any) {
+	if l.logLevel <= WarnLevel {
+		l.logger.Warn(fmt.Sprintf(format, a...))
+	}
+}
+
 func (l *slogLogger) Error(v ...any) {
 	if l.logLevel <= ErrorLevel {
 		msg, attrs := normalizeArgs(v...)
@@ -112,14 +174,26 @@ func (l *slogLogger) Errorf(format string, a ...any) {
 	}
 }
 
+func (l *slogLogger) Fatal(v ...any) {
+	msg, attrs := normalizeArgs(v...)
+	l.logger.Log(context.Background(), slogLevelFatal, msg, attrs...)
+	exitFatal()
+}
+
+func (l *slogLogger) Fatalf(format string, a ...any) {
+	l.logger.Log(context.Background(), slogLevelFatal, fmt.Sprintf(format, a...))
+	exitFatal()
+}
+
 func (l *slogLogger) SetLogLevel(level LogLevel) {
 	l.logLevel = level
 }
 
 func (l *slogLogger) With(args ...any) Logger {
 	return &slogLogger{
-		logger:   l.logger.With(args...),
-		logLevel: l.logLevel,
+		logger:    l.logger.With(args...),
+		logLevel:  componentLevel(l.overrides, args, l.logLevel),
+		overrides: l.overrides,
 	}
 }
 
@@ -147,6 +221,18 @@ func (l *standardLogger) Infof(format string, a ...any) {
 	}
 }
 
+func (l *standardLogger) Warn(v ...any) {
+	if l.logLevel <= WarnLevel {
+		l.log("WARN", v...)
+	}
+}
+
+func (l *standardLogger) Warnf(format string, a ...any) {
+	if l.logLevel <= WarnLevel {
+		l.log("WARN", fmt.Sprintf(format, a...))
+	}
+}
+
 func (l *standardLogger) Error(v ...any) {
 	if l.logLevel <= ErrorLevel {
 		l.log("ERROR", v...)
@@ -159,13 +245,23 @@ func (l *standardLogger) Errorf(format string, a ...any) {
 	}
 }
 
+func (l *standardLogger) Fatal(v ...any) {
+	l.log("FATAL", v...)
+	exitFatal()
+}
+
+func (l *standardLogger) Fatalf(format string, a ...any) {
+	l.log("FATAL", fmt.Sprintf(format, a...))
+	exitFatal()
+}
+
 func (l *standardLogger) SetLogLevel(level LogLevel) {
 	l.logLevel = level
 }
 
 func (l *standardLogger) With(args ...any) Logger {
 	if len(args) == 0 {
-		return &standardLogger{logger: l.logger, logLevel: l.logLevel, prefix: l.prefix}
+		return &standardLogger{logger: l.logger, logLevel: l.logLevel, prefix: l.prefix, overrides: l.overrides}
 	}
 	extra := formatKeyValueAttrs(args)
 	if extra == "" {
@@ -177,7 +273,12 @@ func (l *standardLogger) With(args ...any) Logger {
 	} else if extra != "" {
 		prefix = extra
 	}
-	return &standardLogger{logger: l.logger, logLevel: l.logLevel, prefix: prefix}
+	return &standardLogger{
+		logger:    l.logger,
+		logLevel:  componentLevel(l.overrides, args, l.logLevel),
+		prefix:    prefix,
+		overrides: l.overrides,
+	}
 }
 
 func (l *standardLogger) log(level string, v ...any) {
@@ -205,8 +306,12 @@ func (noopLogger) Debug(v ...any)                 {}
 func (noopLogger) Debugf(format string, a ...any) {}
 func (noopLogger) Info(v ...any)                  {}
 func (noopLogger) Infof(format string, a ...any)  {}
+func (noopLogger) Warn(v ...any)                  {}
+func (noopLogger) Warnf(format string, a ...any)  {}
 func (noopLogger) Error(v ...any)                 {}
 func (noopLogger) Errorf(format string, a ...any) {}
+func (noopLogger) Fatal(v ...any)                 { exitFatal() }
+func (noopLogger) Fatalf(format string, a ...any) { exitFatal() }
 func (noopLogger) SetLogLevel(level LogLevel)     {}
 func (noopLogger) With(args ...any) Logger        { return noopLogger{} }
 
@@ -214,6 +319,61 @@ func NewNoopLogger() Logger {
 	return noopLogger{}
 }
 
+var (
+	fatalMu    sync.Mutex
+	fatalHooks []func()
+	fatalExit  = os.Exit
+)
+
+// OnFatal registers fn to run before Logger.Fatal exits the process, e.g. to
+// flush buffered log output or release locks. Hooks run in reverse order.
+func OnFatal(fn func()) {
+	if fn == nil {
+		return
+	}
+	fatalMu.Lock()
+	fatalHooks = append(fatalHooks, fn)
+	fatalMu.Unlock()
+}
+
+func exitFatal() {
+	fatalMu.Lock()
+	hooks := append([]func(){}, fatalHooks...)
+	fatalMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+	fatalExit(1)
+}
+
+// componentLevel returns the override for the LogComponentKey value in args,
+// or current when there is none.
+func componentLevel(overrides map[string]LogLevel, args []any, current LogLevel) LogLevel {
+	if len(overrides) == 0 {
+		return current
+	}
+	for i := 0; i < len(args); i++ {
+		var name any
+		switch arg := args[i].(type) {
+		case slog.Attr:
+			if arg.Key == LogComponentKey {
+				name = arg.Value.Any()
+			}
+		case string:
+			if arg == LogComponentKey && i+1 < len(args) {
+				name = args[i+1]
+			}
+			i++
+		}
+		if component, ok := name.(string); ok {
+			if level, ok := overrides[strings.ToLower(component)]; ok {
+				return level
+			}
+		}
+	}
+	return current
+}
+
 func toValidLevel(level string) LogLevel {
 	level = strings.ToLower(level)
 	switch level {
@@ -221,6 +381,8 @@ func toValidLevel(level string) LogLevel {
 		return DebugLevel
 	case "info", "inf":
 		return InfoLevel
+	case "warn", "warning", "wrn":
+		return WarnLevel
 	case "error", "err":
 		return ErrorLevel
 	default:
@@ -234,6 +396,8 @@ func slogLevel(level LogLevel) slog.Level {
 		return slog.LevelDebug
 	case InfoLevel:
 		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
 	case ErrorLevel:
 		return slog.LevelError
 	default:
@@ -241,8 +405,22 @@ func slogLevel(level LogLevel) slog.Level {
 	}
 }
 
-func isTerminal() bool {
-	return os.Getenv("LOG_FORMAT") != "json"
+// isTerminal reports whether entries written to w should use the text format.
+// LOG_FORMAT=json or LOG_FORMAT=text forces a format; otherwise text is only
+// used when w is a character device such as an interactive console.
+func isTerminal(w io.Writer) bool {
+	switch os.Getenv("LOG_FORMAT") {
+	case "json":
+		return false
+	case "text":
+		return true
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 // NewRequestLogger returns a chi RequestLogger middleware that emits structured
@@ -260,11 +438,11 @@ type structuredLogFormatter struct {
 
 func (f *structuredLogFormatter) NewLogEntry(r *http.Request) chimiddleware.LogEntry {
 	reqID := RequestIDFrom(r.Context())
-	entryLogger := f.logger.With(
+	entryLogger := f.logger.With(append([]any{
 		"request_id", reqID,
 		"method", r.Method,
 		"path", r.URL.Path,
-	)
+	}, TraceFields(r.Context())...)...)
 
 	entry := &structuredLogEntry{
 		logger: entryLogger,
@@ -1,8 +1,12 @@
 package aqm
 
 import (
+	"bytes"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -207,6 +211,8 @@ func TestToValidLevel(t *testing.T) {
 		{"info", InfoLevel},
 		{"inf", InfoLevel},
 		{"INFO", InfoLevel},
+		{"warn", WarnLevel},
+		{"warning", WarnLevel},
 		{"error", ErrorLevel},
 		{"err", ErrorLevel},
 		{"ERROR", ErrorLevel},
@@ -231,6 +237,7 @@ func TestSlogLevel(t *testing.T) {
 	}{
 		{DebugLevel, slog.LevelDebug},
 		{InfoLevel, slog.LevelInfo},
+		{WarnLevel, slog.LevelWarn},
 		{ErrorLevel, slog.LevelError},
 		{LogLevel(99), slog.LevelInfo}, // unknown defaults to info
 	}
@@ -249,14 +256,28 @@ func TestIsTerminal(t *testing.T) {
 	original := os.Getenv("LOG_FORMAT")
 	defer os.Setenv("LOG_FORMAT", original)
 
+	var buf bytes.Buffer
 	os.Setenv("LOG_FORMAT", "json")
-	if isTerminal() {
+	if isTerminal(&buf) {
 		t.Error("expected false when LOG_FORMAT=json")
 	}
 
+	os.Setenv("LOG_FORMAT", "text")
+	if !isTerminal(&buf) {
+		t.Error("expected true when LOG_FORMAT=text")
+	}
+
 	os.Unsetenv("LOG_FORMAT")
-	if !isTerminal() {
-		t.Error("expected true when LOG_FORMAT is not set")
+	if isTerminal(&buf) {
+		t.Error("expected false for a writer that is not a terminal")
+	}
+	file, err := os.Create(filepath.Join(t.TempDir(), "service.log"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer file.Close()
+	if isTerminal(file) {
+		t.Error("expected false for a regular file")
 	}
 }
 
@@ -389,7 +410,54 @@ func TestLogLevelConstants(t *testing.T) {
 	if InfoLevel != 1 {
 		t.Errorf("InfoLevel = %v, want 1", InfoLevel)
 	}
-	if ErrorLevel != 2 {
-		t.Errorf("ErrorLevel = %v, want 2", ErrorLevel)
+	if WarnLevel != 2 {
+		t.Errorf("WarnLevel = %v, want 2", WarnLevel)
+	}
+	if ErrorLevel != 3 {
+		t.Errorf("ErrorLevel = %v, want 3", ErrorLevel)
+	}
+}
+
+func TestLoggerFatalRunsHooks(t *testing.T) {
+	originalExit, originalHooks := fatalExit, fatalHooks
+	defer func() { fatalExit, fatalHooks = originalExit, originalHooks }()
+
+	var calls []string
+	fatalHooks = nil
+	fatalExit = func(code int) { calls = append(calls, fmt.Sprintf("exit %d", code)) }
+	OnFatal(func() { calls = append(calls, "first") })
+	OnFatal(func() { calls = append(calls, "second") })
+
+	var buf bytes.Buffer
+	NewLoggerWithWriter("error", &buf).Fatalf("cannot start: %s", "port in use")
+
+	if got := strings.Join(calls, ","); got != "second,first,exit 1" {
+		t.Errorf("unexpected fatal sequence %q", got)
+	}
+	if !strings.Contains(buf.String(), "FATAL") || !strings.Contains(buf.String(), "port in use") {
+		t.Errorf("expected fatal entry, got %q", buf.String())
+	}
+}
+
+func TestComponentLevelOverrides(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newSlogLogger(WarnLevel, map[string]LogLevel{"http": DebugLevel, "mongo": ErrorLevel}, &buf)
+
+	logger.Info("root info")
+	logger.With(LogComponentKey, "http").Debug("http debug")
+	logger.With(LogComponentKey, "mongo").Warn("mongo warn")
+	logger.With(slog.String(LogComponentKey, "mongo")).Error("mongo error")
+	logger.With("other", "x").Warn("root warn")
+
+	out := buf.String()
+	for _, want := range []string{"http debug", "mongo error", "root warn"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+	for _, unwanted := range []string{"root info", "mongo warn"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("did not expect %q in %q", unwanted, out)
+		}
 	}
 }
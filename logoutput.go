@@ -0,0 +1,412 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogConfig groups the logging settings, bound from "log". Level holds
+// "log.level" (or "log.level.default") and Levels the per-component overrides
+// set as "log.level.<component>", e.g. log.level.http=debug.
+type LogConfig struct {
+	Level   string            `koanf:"-" default:"info"`
+	Levels  map[string]string `koanf:"-"`
+	Outputs []string          `koanf:"outputs" default:"stdout"`
+	File    LogFileConfig     `koanf:"file"`
+	Syslog  LogSyslogConfig   `koanf:"syslog"`
+	Async   LogAsyncConfig    `koanf:"async"`
+}
+
+// LogFileConfig configures the "file" output. MaxSizeMB and MaxAge trigger a
+// rotation; zero disables the corresponding trigger.
+type LogFileConfig struct {
+	Path       string        `koanf:"path"`
+	MaxSizeMB  int           `koanf:"max_size_mb" default:"100"`
+	MaxAge     time.Duration `koanf:"max_age"`
+	MaxBackups int           `koanf:"max_backups" default:"5"`
+}
+
+// LogSyslogConfig configures the "syslog" output. Empty network and address
+// connect to the local syslog socket, which journald also serves.
+type LogSyslogConfig struct {
+	Network string `koanf:"network"`
+	Address string `koanf:"address"`
+	Tag     string `koanf:"tag" default:"aqm"`
+}
+
+// LogAsyncConfig enables buffering log writes off the calling goroutine.
+type LogAsyncConfig struct {
+	Enabled    bool `koanf:"enabled"`
+	BufferSize int  `koanf:"buffer_size" default:"1024"`
+}
+
+// LogConfigFrom binds the "log" config subtree, including the level
+// overrides that cannot be expressed as plain struct fields.
+func LogConfigFrom(cfg *Config) (LogConfig, error) {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	logCfg, err := BindEnv[LogConfig](cfg, "log")
+	if err != nil {
+		return logCfg, err
+	}
+
+	const prefix = "log.level"
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	for key, value := range cfg.values {
+		if _, alias := cfg.aliases[key]; alias {
+			continue
+		}
+		level := strings.TrimSpace(fmt.Sprint(value))
+		switch {
+		case key == prefix || key == prefix+".default":
+			logCfg.Level = level
+		case strings.HasPrefix(key, prefix+"."):
+			if logCfg.Levels == nil {
+				logCfg.Levels = make(map[string]string)
+			}
+			logCfg.Levels[strings.TrimPrefix(key, prefix+".")] = level
+		}
+	}
+	return logCfg, nil
+}
+
+// NewLoggerFromConfig builds a Logger from the "log" config subtree. Outputs
+// are any of "stdout", "stderr", "file" and "syslog"; extra writers receive
+// every entry as well. Loggers derived with With(LogComponentKey, name) use the
+// level configured for that component. The returned ShutdownFunc flushes
+// buffered entries and closes files and sockets, so register it with
+// WithShutdown; it also runs before Fatal exits.
+func NewLoggerFromConfig(cfg *Config, extra ...io.Writer) (Logger, ShutdownFunc, error) {
+	logCfg, err := LogConfigFrom(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var writers []io.Writer
+	var closers []io.Closer
+	closeAll := func() error {
+		var errs error
+		for i := len(closers) - 1; i >= 0; i-- {
+			errs = errors.Join(errs, closers[i].Close())
+		}
+		return errs
+	}
+
+	for _, output := range logCfg.Outputs {
+		switch strings.ToLower(strings.TrimSpace(output)) {
+		case "", "stdout":
+			writers = append(writers, os.Stdout)
+		case "stderr":
+			writers = append(writers, os.Stderr)
+		case "file":
+			if logCfg.File.Path == "" {
+				closeAll()
+				return nil, nil, errors.New("log: file output requires log.file.path")
+			}
+			file, err := NewRotatingFile(logCfg.File.Path, int64(logCfg.File.MaxSizeMB)<<20, logCfg.File.MaxAge, logCfg.File.MaxBackups)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			writers = append(writers, file)
+			closers = append(closers, file)
+		case "syslog":
+			sink, err := NewSyslogWriter(logCfg.Syslog.Network, logCfg.Syslog.Address, logCfg.Syslog.Tag)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			writers = append(writers, sink)
+			closers = append(closers, sink)
+		default:
+			closeAll()
+			return nil, nil, fmt.Errorf("log: unknown output %q", output)
+		}
+	}
+	for _, w := range extra {
+		if w != nil {
+			writers = append(writers, w)
+		}
+	}
+
+	var out io.Writer = fanoutWriter(writers)
+	if len(writers) == 1 {
+		out = writers[0]
+	}
+	var async *AsyncWriter
+	if logCfg.Async.Enabled {
+		async = NewAsyncWriter(out, logCfg.Async.BufferSize)
+		out = async
+	}
+
+	shutdown := func(ctx context.Context) error {
+		var errs error
+		if async != nil {
+			errs = errors.Join(errs, async.Shutdown(ctx))
+		}
+		return errors.Join(errs, closeAll())
+	}
+	OnFatal(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown(ctx)
+	})
+
+	var overrides map[string]LogLevel
+	for component, level := range logCfg.Levels {
+		if overrides == nil {
+			overrides = make(map[string]LogLevel, len(logCfg.Levels))
+		}
+		overrides[strings.ToLower(component)] = toValidLevel(level)
+	}
+	return newSlogLogger(toValidLevel(logCfg.Level), overrides, out), shutdown, nil
+}
+
+// fanoutWriter writes to every writer even when one of them fails, unlike
+// io.MultiWriter, so a broken sink does not silence the others.
+type fanoutWriter []io.Writer
+
+func (f fanoutWriter) Write(p []byte) (int, error) {
+	var errs error
+	for _, w := range f {
+		if _, err := w.Write(p); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return len(p), errs
+}
+
+// entryLevel extracts the level of a single JSON or text slog entry, e.g.
+// "ERROR", returning "" when the entry carries none.
+func entryLevel(p []byte) string {
+	for _, key := range [][]byte{[]byte(`"level":"`), []byte("level=")} {
+		i := bytes.Index(p, key)
+		if i < 0 {
+			continue
+		}
+		rest := p[i+len(key):]
+		end := bytes.IndexAny(rest, "\" \n")
+		if end < 0 {
+			end = len(rest)
+		}
+		return string(rest[:end])
+	}
+	return ""
+}
+
+// RotatingFile is an io.WriteCloser that appends to a file and rotates it when
+// it grows past maxSize bytes or has been open longer than maxAge. Rotated
+// files are kept as path.1 (newest) through path.N, N being maxBackups.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// NewRotatingFile opens path for appending, creating parent directories as
+// needed. A zero maxSize or maxAge disables that rotation trigger.
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("log: rotating file path required")
+	}
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p, rotating first when p would exceed the size limit or the
+// current file is too old.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate forces a rotation, e.g. from a signal handler.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) shouldRotate(incoming int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+incoming > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && f.now().Sub(f.openedAt) >= f.maxAge
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("log: create log dir: %w", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("log: open %s: %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("log: stat %s: %w", f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("log: close %s: %w", f.path, err)
+	}
+	f.file = nil
+
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("log: remove %s: %w", f.path, err)
+		}
+		return f.open()
+	}
+
+	os.Remove(f.backupName(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backupName(i), f.backupName(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("log: shift backup: %w", err)
+		}
+	}
+	if err := os.Rename(f.path, f.backupName(1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("log: rotate %s: %w", f.path, err)
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+// AsyncWriter hands writes to a background goroutine so logging does not
+// block on slow sinks. Writes block only when the buffer is full. Call
+// Shutdown (or Close) to flush pending entries before exiting.
+type AsyncWriter struct {
+	w       io.Writer
+	entries chan []byte
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+	err    error
+}
+
+// NewAsyncWriter wraps w with a buffer of bufferSize entries (1024 when not
+// positive).
+func NewAsyncWriter(w io.Writer, bufferSize int) *AsyncWriter {
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+	a := &AsyncWriter{
+		w:       w,
+		entries: make(chan []byte, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+// Write queues a copy of p. It fails once the writer has been closed.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+	entry := make([]byte, len(p))
+	copy(entry, p)
+	a.entries <- entry
+	return len(p), nil
+}
+
+// Shutdown stops accepting writes and waits until queued entries are written
+// or ctx is done. It returns the first error reported by the wrapped writer.
+func (a *AsyncWriter) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.entries)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return a.err
+	case <-ctx.Done():
+		return fmt.Errorf("log: flush: %w", ctx.Err())
+	}
+}
+
+// Close flushes pending entries without a deadline.
+func (a *AsyncWriter) Close() error {
+	return a.Shutdown(context.Background())
+}
+
+func (a *AsyncWriter) loop() {
+	defer close(a.done)
+	for entry := range a.entries {
+		if _, err := a.w.Write(entry); err != nil && a.err == nil {
+			a.err = err
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	f, err := NewRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first-\n", "second\n", "third-\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third-\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(name), content, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected backups beyond maxBackups to be pruned")
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := NewRotatingFile(path, 0, time.Hour, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	f.openedAt = now
+
+	f.Write([]byte("old\n"))
+	now = now.Add(2 * time.Hour)
+	f.Write([]byte("new\n"))
+
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "old\n" {
+		t.Errorf("expected rotated file to hold old entry, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new\n" {
+		t.Errorf("expected current file to hold new entry, got %q", data)
+	}
+}
+
+func TestAsyncWriterFlushesOnShutdown(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAsyncWriter(&buf, 2)
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("x"))
+	}
+	if err := w.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != strings.Repeat("x", 10) {
+		t.Errorf("expected all entries flushed, got %q", buf.String())
+	}
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("expected write after shutdown to fail")
+	}
+}
+
+func TestNewLoggerFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	cfg := NewConfig()
+	cfg.Set("log.level", "debug")
+	cfg.Set("log.outputs", []string{"file"})
+	cfg.Set("log.file.path", path)
+	cfg.Set("log.async.enabled", true)
+
+	var extra bytes.Buffer
+	logger, shutdown, err := NewLoggerFromConfig(cfg, &extra)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Debug("written", "sink", "file")
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(data), "written") || !strings.Contains(extra.String(), "written") {
+		t.Errorf("expected entry in file and extra writer, got %q and %q", data, extra.String())
+	}
+}
+
+func TestLogConfigFromLevels(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MergeFlat(map[string]any{
+		"log.level":       "warn",
+		"log.level.http":  "debug",
+		"log.level.mongo": "error",
+	})
+
+	logCfg, err := LogConfigFrom(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logCfg.Level != "warn" {
+		t.Errorf("expected default level warn, got %q", logCfg.Level)
+	}
+	if logCfg.Levels["http"] != "debug" || logCfg.Levels["mongo"] != "error" {
+		t.Errorf("unexpected overrides %v", logCfg.Levels)
+	}
+}
+
+func TestNewLoggerFromConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+	}{
+		{name: "unknownOutput", values: map[string]any{"log.outputs": []string{"kafka"}}},
+		{name: "fileWithoutPath", values: map[string]any{"log.outputs": []string{"file"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.MergeFlat(tt.values)
+			if _, _, err := NewLoggerFromConfig(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestEntryLevel(t *testing.T) {
+	tests := map[string]string{
+		`{"time":"2026-01-01T00:00:00Z","level":"ERROR","msg":"boom"}`: "ERROR",
+		"time=2026-01-01T00:00:00Z level=WARN msg=slow\n":              "WARN",
+		`{"msg":"no level"}`: "",
+	}
+	for entry, want := range tests {
+		if got := entryLevel([]byte(entry)); got != want {
+			t.Errorf("entryLevel(%q) = %q, want %q", entry, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+
+package aqm
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// NewSyslogWriter connects to a syslog daemon. Empty network and address use
+// the local socket, which journald also listens on. Each entry is sent with
+// the syslog priority matching its log level.
+func NewSyslogWriter(network, address, tag string) (io.WriteCloser, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("log: syslog dial: %w", err)
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	msg := string(p)
+	var err error
+	switch entryLevel(p) {
+	case "DEBUG":
+		err = s.w.Debug(msg)
+	case "WARN":
+		err = s.w.Warning(msg)
+	case "ERROR":
+		err = s.w.Err(msg)
+	case "FATAL":
+		err = s.w.Crit(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
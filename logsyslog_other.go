@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package aqm
+
+import (
+	"errors"
+	"io"
+)
+
+// NewSyslogWriter is not supported on this platform.
+func NewSyslogWriter(network, address, tag string) (io.WriteCloser, error) {
+	return nil, errors.New("log: syslog is not supported on this platform")
+}
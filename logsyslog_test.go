@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+
+package aqm
+
+import (
+	"fmt"
+	"log/syslog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogWriterPriorities(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp listener unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogWriter("udp", conn.LocalAddr().String(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.Close()
+
+	logger := NewLoggerWithWriter("debug", sink)
+	logger.Debug("debug entry")
+	logger.Info("info entry")
+	logger.Error("error entry")
+
+	want := []syslog.Priority{syslog.LOG_DEBUG, syslog.LOG_INFO, syslog.LOG_ERR}
+	buf := make([]byte, 2048)
+	for _, severity := range want {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		prefix := fmt.Sprintf("<%d>", syslog.LOG_DAEMON|severity)
+		if got := string(buf[:n]); !strings.HasPrefix(got, prefix) {
+			t.Errorf("expected priority %s, got %q", prefix, got)
+		}
+	}
+}
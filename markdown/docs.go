@@ -0,0 +1,162 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultDocsPrefix = "/docs"
+	defaultDocsIndex  = "index.md"
+)
+
+// Page is the data passed to the docs layout.
+type Page struct {
+	Title   string
+	Path    string
+	Content template.HTML
+}
+
+// Layout looks up the template documentation pages are rendered through. The
+// template manager satisfies it.
+type Layout interface {
+	Get(name string) (*template.Template, error)
+}
+
+var fallbackLayout = template.Must(template.New("docs").Parse(
+	`<!DOCTYPE html><html><head><meta charset="utf-8"><title>{{.Title}}</title></head><body><main>{{.Content}}</main></body></html>`,
+))
+
+// DocsModule serves the Markdown files of an embedded filesystem as HTML
+// pages, e.g. /docs/guides/auth renders guides/auth.md.
+type DocsModule struct {
+	fs         fs.FS
+	renderer   *Renderer
+	prefix     string
+	layout     Layout
+	layoutName string
+	log        aqm.Logger
+}
+
+// DocsOption configures a DocsModule.
+type DocsOption func(*DocsModule)
+
+// WithDocsPrefix overrides the mount point (defaults to /docs).
+func WithDocsPrefix(prefix string) DocsOption {
+	return func(m *DocsModule) {
+		if prefix = strings.TrimRight(prefix, "/"); prefix != "" {
+			m.prefix = prefix
+		}
+	}
+}
+
+// WithLayout renders pages through the named template, executed with a Page.
+// Without it pages use a minimal HTML document.
+func WithLayout(layout Layout, name string) DocsOption {
+	return func(m *DocsModule) {
+		m.layout, m.layoutName = layout, name
+	}
+}
+
+// WithRenderer overrides the renderer, e.g. to change the policy.
+func WithRenderer(renderer *Renderer) DocsOption {
+	return func(m *DocsModule) {
+		if renderer != nil {
+			m.renderer = renderer
+		}
+	}
+}
+
+// WithDocsLogger wires a custom logger. It falls back to a noop logger when
+// nil.
+func WithDocsLogger(logger aqm.Logger) DocsOption {
+	return func(m *DocsModule) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// NewDocsModule serves the Markdown files in docs.
+func NewDocsModule(docs fs.FS, opts ...DocsOption) *DocsModule {
+	m := &DocsModule{
+		fs:       docs,
+		renderer: New(),
+		prefix:   defaultDocsPrefix,
+		log:      aqm.NewNoopLogger(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// Name identifies the module in route listings.
+func (m *DocsModule) Name() string {
+	return "docs"
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (m *DocsModule) RegisterRoutes(r chi.Router) {
+	r.Get(m.prefix, m.serve)
+	r.Get(m.prefix+"/*", m.serve)
+}
+
+func (m *DocsModule) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(chi.URLParam(r, "*"), "/")
+	if name == "" {
+		name = defaultDocsIndex
+	} else if !strings.HasSuffix(name, ".md") {
+		name += ".md"
+	}
+
+	src, err := fs.ReadFile(m.fs, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			http.NotFound(w, r)
+			return
+		}
+		m.log.Error("cannot read doc", "path", name, "error", err)
+		http.Error(w, "cannot read document", http.StatusInternalServerError)
+		return
+	}
+
+	page := Page{Title: titleOf(string(src), name), Path: name, Content: m.renderer.Render(string(src))}
+	tmpl := fallbackLayout
+	if m.layout != nil {
+		if tmpl, err = m.layout.Get(m.layoutName); err != nil {
+			m.log.Error("cannot load docs layout", "layout", m.layoutName, "error", err)
+			http.Error(w, "cannot render document", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		m.log.Error("cannot render doc", "path", name, "error", err)
+		http.Error(w, "cannot render document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// titleOf returns the first heading of src, or the file name.
+func titleOf(src, name string) string {
+	for _, line := range strings.Split(src, "\n") {
+		if m := headingRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			return m[2]
+		}
+	}
+	return strings.TrimSuffix(path.Base(name), ".md")
+}
@@ -0,0 +1,257 @@
+// Package markdown renders a safe subset of Markdown to HTML for templates and
+// documentation pages. Raw HTML in the source is always escaped; links and
+// images are filtered through a Policy.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Policy controls what rendered Markdown may contain.
+type Policy struct {
+	// AllowedSchemes lists the URL schemes links and images may use. Relative
+	// URLs and fragments are always allowed.
+	AllowedSchemes []string
+	// AllowImages renders ![alt](src) as images instead of links.
+	AllowImages bool
+	// LinkRel is set as the rel attribute of absolute links.
+	LinkRel string
+	// HeadingIDs adds slug ids to headings so pages can link to sections.
+	HeadingIDs bool
+}
+
+// DefaultPolicy allows http, https and mailto links, images and heading ids,
+// and marks absolute links nofollow noopener.
+func DefaultPolicy() Policy {
+	return Policy{
+		AllowedSchemes: []string{"http", "https", "mailto"},
+		AllowImages:    true,
+		LinkRel:        "nofollow noopener",
+		HeadingIDs:     true,
+	}
+}
+
+// Renderer converts Markdown to HTML under a Policy.
+type Renderer struct {
+	policy Policy
+}
+
+// Option configures a Renderer.
+type Option func(*Renderer)
+
+// WithPolicy replaces the default policy.
+func WithPolicy(policy Policy) Option {
+	return func(r *Renderer) {
+		r.policy = policy
+	}
+}
+
+// New builds a renderer using DefaultPolicy unless overridden.
+func New(opts ...Option) *Renderer {
+	r := &Renderer{policy: DefaultPolicy()}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+	return r
+}
+
+// Render converts src to HTML. The result is safe to embed in templates.
+func (r *Renderer) Render(src string) template.HTML {
+	var b strings.Builder
+	r.renderBlocks(&b, strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n"))
+	return template.HTML(b.String())
+}
+
+// FuncMap exposes the markdown template helper, to be installed with
+// template.WithFuncs:
+//
+//	{{ markdown .Description }}
+func (r *Renderer) FuncMap() template.FuncMap {
+	return template.FuncMap{"markdown": r.Render}
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	ruleRe      = regexp.MustCompile(`^\s{0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	bulletRe    = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedRe   = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	fenceRe     = regexp.MustCompile("^\\s{0,3}(```|~~~)\\s*([\\w+-]*)")
+	codeSpanRe  = regexp.MustCompile("`([^`]+)`")
+	imageRe     = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkRe      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongRe    = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	emRe        = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:[^*_]*?\S)?)[*_]`)
+	placeholder = regexp.MustCompile("\x00(\\d+)\x00")
+	slugRe      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+func (r *Renderer) renderBlocks(b *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case fenceRe.MatchString(line):
+			i = r.renderFence(b, lines, i)
+		case headingRe.MatchString(trimmed):
+			m := headingRe.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			id := ""
+			if r.policy.HeadingIDs {
+				id = fmt.Sprintf(` id="%s"`, Slug(m[2]))
+			}
+			fmt.Fprintf(b, "<h%d%s>%s</h%d>\n", level, id, r.inline(m[2]), level)
+			i++
+		case ruleRe.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				content := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(content, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			r.renderBlocks(b, quoted)
+			b.WriteString("</blockquote>\n")
+		case bulletRe.MatchString(line):
+			i = r.renderList(b, lines, i, bulletRe, "ul")
+		case orderedRe.MatchString(line):
+			i = r.renderList(b, lines, i, orderedRe, "ol")
+		default:
+			i = r.renderParagraph(b, lines, i)
+		}
+	}
+}
+
+func (r *Renderer) renderFence(b *strings.Builder, lines []string, i int) int {
+	m := fenceRe.FindStringSubmatch(lines[i])
+	fence, lang := m[1], m[2]
+	var code []string
+	for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+		code = append(code, lines[i])
+	}
+	class := ""
+	if lang != "" {
+		class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(lang))
+	}
+	fmt.Fprintf(b, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(code, "\n")))
+	return i + 1
+}
+
+func (r *Renderer) renderList(b *strings.Builder, lines []string, i int, itemRe *regexp.Regexp, tag string) int {
+	var items []string
+	for i < len(lines) {
+		line := lines[i]
+		if m := itemRe.FindStringSubmatch(line); m != nil {
+			items = append(items, m[1])
+		} else if strings.TrimSpace(line) != "" && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) && len(items) > 0 {
+			items[len(items)-1] += " " + strings.TrimSpace(line)
+		} else {
+			break
+		}
+		i++
+	}
+	fmt.Fprintf(b, "<%s>\n", tag)
+	for _, item := range items {
+		fmt.Fprintf(b, "<li>%s</li>\n", r.inline(item))
+	}
+	fmt.Fprintf(b, "</%s>\n", tag)
+	return i
+}
+
+func (r *Renderer) renderParagraph(b *strings.Builder, lines []string, i int) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || headingRe.MatchString(trimmed) || fenceRe.MatchString(line) || ruleRe.MatchString(line) ||
+			strings.HasPrefix(trimmed, ">") || bulletRe.MatchString(line) || orderedRe.MatchString(line) {
+			break
+		}
+		text = append(text, trimmed)
+	}
+	fmt.Fprintf(b, "<p>%s</p>\n", r.inline(strings.Join(text, "\n")))
+	return i
+}
+
+// inline escapes text and applies code spans, images, links and emphasis.
+// Code spans are swapped for placeholders first so their content is never
+// reinterpreted.
+func (r *Renderer) inline(text string) string {
+	var spans []string
+	text = codeSpanRe.ReplaceAllStringFunc(text, func(match string) string {
+		spans = append(spans, "<code>"+html.EscapeString(match[1:len(match)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	text = html.EscapeString(text)
+
+	text = imageRe.ReplaceAllStringFunc(text, func(match string) string {
+		m := imageRe.FindStringSubmatch(match)
+		src, ok := r.safeURL(m[2])
+		if !ok {
+			return m[1]
+		}
+		if !r.policy.AllowImages {
+			return r.link(src, m[1])
+		}
+		return fmt.Sprintf(`<img src="%s" alt="%s">`, src, m[1])
+	})
+	text = linkRe.ReplaceAllStringFunc(text, func(match string) string {
+		m := linkRe.FindStringSubmatch(match)
+		href, ok := r.safeURL(m[2])
+		if !ok {
+			return m[1]
+		}
+		return r.link(href, m[1])
+	})
+	text = strongRe.ReplaceAllString(text, "<strong>$2</strong>")
+	text = emRe.ReplaceAllString(text, "$1<em>$2</em>")
+	text = strings.ReplaceAll(text, "\n", " ")
+
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		var n int
+		fmt.Sscanf(strings.Trim(match, "\x00"), "%d", &n)
+		return spans[n]
+	})
+}
+
+func (r *Renderer) link(href, label string) string {
+	rel := ""
+	if r.policy.LinkRel != "" && strings.Contains(href, ":") {
+		rel = fmt.Sprintf(` rel="%s"`, html.EscapeString(r.policy.LinkRel))
+	}
+	return fmt.Sprintf(`<a href="%s"%s>%s</a>`, href, rel, label)
+}
+
+// safeURL checks an already escaped URL against the policy schemes and
+// returns it still escaped for attribute use.
+func (r *Renderer) safeURL(escaped string) (string, bool) {
+	raw := html.UnescapeString(escaped)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme == "" {
+		return escaped, true
+	}
+	for _, scheme := range r.policy.AllowedSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return escaped, true
+		}
+	}
+	return "", false
+}
+
+// Slug turns a heading into an id, e.g. "Getting Started!" -> getting-started.
+func Slug(text string) string {
+	return strings.Trim(slugRe.ReplaceAllString(strings.ToLower(text), "-"), "-")
+}
@@ -0,0 +1,104 @@
+package markdown
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		src    string
+		want   string
+	}{
+		{name: "heading", src: "## Getting Started", want: `<h2 id="getting-started">Getting Started</h2>` + "\n"},
+		{name: "paragraph", src: "Hello **bold** and *em*\nnext line", want: "<p>Hello <strong>bold</strong> and <em>em</em> next line</p>\n"},
+		{name: "code span", src: "Use `<b>**x**</b>`", want: "<p>Use <code>&lt;b&gt;**x**&lt;/b&gt;</code></p>\n"},
+		{name: "fence", src: "```go\nfmt.Println(\"<hi>\")\n```", want: "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)</code></pre>\n"},
+		{name: "list", src: "- one\n- two\n  more", want: "<ul>\n<li>one</li>\n<li>two more</li>\n</ul>\n"},
+		{name: "ordered", src: "1. one\n2. two", want: "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{name: "quote", src: "> quoted", want: "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{name: "rule", src: "---", want: "<hr>\n"},
+		{name: "raw html escaped", src: "<script>alert(1)</script>", want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{name: "relative link", src: "[guide](/docs/guide)", want: `<p><a href="/docs/guide">guide</a></p>` + "\n"},
+		{name: "absolute link", src: "[site](https://example.com)", want: `<p><a href="https://example.com" rel="nofollow noopener">site</a></p>` + "\n"},
+		{name: "unsafe scheme", src: "[x](javascript:void)", want: "<p>x</p>\n"},
+		{name: "image", src: "![logo](/logo.png)", want: `<p><img src="/logo.png" alt="logo"></p>` + "\n"},
+		{
+			name:   "images disabled",
+			policy: &Policy{AllowedSchemes: []string{"https"}},
+			src:    "![logo](/logo.png) [a](http://x.test)",
+			want:   `<p><a href="/logo.png">logo</a> a</p>` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			if tt.policy != nil {
+				r = New(WithPolicy(*tt.policy))
+			}
+			if got := string(r.Render(tt.src)); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	tmpl := template.Must(template.New("t").Funcs(New().FuncMap()).Parse(`<div>{{ markdown .}}</div>`))
+	var out strings.Builder
+	if err := tmpl.Execute(&out, "**hi**"); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out.String() != "<div><p><strong>hi</strong></p>\n</div>" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+type layoutFunc func(string) (*template.Template, error)
+
+func (f layoutFunc) Get(name string) (*template.Template, error) { return f(name) }
+
+func TestDocsModule(t *testing.T) {
+	docs := fstest.MapFS{
+		"index.md":       {Data: []byte("# API Guide\n\nWelcome")},
+		"guides/auth.md": {Data: []byte("Tokens go in the header")},
+	}
+	layout := template.Must(template.New("base.html").Parse(`<title>{{.Title}}</title>{{.Content}}`))
+	module := NewDocsModule(docs, WithLayout(layoutFunc(func(name string) (*template.Template, error) {
+		return layout, nil
+	}), "base.html"))
+
+	router := chi.NewRouter()
+	module.RegisterRoutes(router)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/docs", wantStatus: http.StatusOK, wantBody: "<title>API Guide</title>"},
+		{path: "/docs/guides/auth", wantStatus: http.StatusOK, wantBody: "<title>auth</title><p>Tokens go in the header</p>"},
+		{path: "/docs/missing", wantStatus: http.StatusNotFound},
+		{path: "/docs/../secret", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantBody != "" && !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package metering emits normalized usage events (who used what, how much,
+// when) for billing. Middleware meters HTTP requests, Task meters background
+// work, and handlers call Record for anything else; a Meter deduplicates the
+// events and publishes them in batches to an events.Publisher.
+package metering
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/events"
+)
+
+const (
+	defaultTopic       = "metering.usage"
+	defaultDedupWindow = time.Hour
+)
+
+// Event is one normalized usage record. ID makes retries idempotent: events
+// sharing an ID within the dedup window are emitted once.
+type Event struct {
+	ID         string            `json:"id"`
+	Principal  string            `json:"principal"`
+	Resource   string            `json:"resource"`
+	Quantity   float64           `json:"quantity"`
+	Unit       string            `json:"unit,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Hook receives usage events. Implementations must not block the caller.
+type Hook interface {
+	Meter(ctx context.Context, event Event)
+}
+
+// HookFunc adapts a function to Hook.
+type HookFunc func(ctx context.Context, event Event)
+
+// Meter implements Hook.
+func (f HookFunc) Meter(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+var (
+	hookKey      = aqmctx.NewKey[Hook]("metering.hook")
+	principalKey = aqmctx.NewKey[string]("metering.principal")
+)
+
+// WithHook stores hook in ctx for Record and Task. The value travels with
+// aqmctx snapshots, so work started with aqm.Async is metered too.
+func WithHook(ctx context.Context, hook Hook) context.Context {
+	if hook == nil {
+		return ctx
+	}
+	return hookKey.With(ctx, hook)
+}
+
+// WithPrincipal stores the principal events recorded from ctx default to.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	if principal == "" {
+		return ctx
+	}
+	return principalKey.With(ctx, principal)
+}
+
+// PrincipalFrom returns the principal stored by WithPrincipal, or "".
+func PrincipalFrom(ctx context.Context) string {
+	principal, _ := principalKey.From(ctx)
+	return principal
+}
+
+// Record sends event to the hook stored in ctx, filling in the principal
+// from ctx when empty. It does nothing when ctx has no hook.
+func Record(ctx context.Context, event Event) {
+	hook, ok := hookKey.From(ctx)
+	if !ok {
+		return
+	}
+	if event.Principal == "" {
+		event.Principal = PrincipalFrom(ctx)
+	}
+	hook.Meter(ctx, event)
+}
+
+// Task wraps fn so its run time is recorded as resource "task:"+name in
+// seconds once it returns, whatever the outcome. Use it with
+// aqm.Supervisor.Go, aqm.Async or operation work functions.
+func Task(name string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		start := time.Now()
+		err := fn(ctx)
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		Record(ctx, Event{
+			Resource:   "task:" + name,
+			Quantity:   time.Since(start).Seconds(),
+			Unit:       "seconds",
+			Attributes: map[string]string{"status": status},
+		})
+		return err
+	}
+}
+
+// Meter is the Hook publishing events. It fills in missing IDs and
+// timestamps, drops duplicates and publishes through an
+// events.AsyncPublisher, so batching and delivery happen off the request
+// path. It implements aqm.Stoppable to flush on shutdown.
+type Meter struct {
+	publisher *events.AsyncPublisher
+	topic     string
+	window    time.Duration
+	log       aqm.Logger
+	now       func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// Option configures a Meter.
+type Option func(*meterConfig)
+
+type meterConfig struct {
+	topic  string
+	window time.Duration
+	log    aqm.Logger
+	async  []events.AsyncOption
+}
+
+// WithTopic overrides the topic events are published to (defaults to
+// metering.usage).
+func WithTopic(topic string) Option {
+	return func(c *meterConfig) {
+		if topic != "" {
+			c.topic = topic
+		}
+	}
+}
+
+// WithDedupWindow sets how long event IDs are remembered (default 1h).
+func WithDedupWindow(d time.Duration) Option {
+	return func(c *meterConfig) {
+		if d > 0 {
+			c.window = d
+		}
+	}
+}
+
+// WithBatching tunes the underlying events.AsyncPublisher, e.g. with
+// events.WithBatchSize and events.WithFlushInterval.
+func WithBatching(opts ...events.AsyncOption) Option {
+	return func(c *meterConfig) {
+		c.async = append(c.async, opts...)
+	}
+}
+
+// WithLogger wires a custom logger for publish failures.
+func WithLogger(logger aqm.Logger) Option {
+	return func(c *meterConfig) {
+		if logger != nil {
+			c.log = logger
+		}
+	}
+}
+
+// NewMeter publishes usage events to publisher.
+func NewMeter(publisher events.Publisher, opts ...Option) *Meter {
+	cfg := &meterConfig{topic: defaultTopic, window: defaultDedupWindow, log: aqm.NewNoopLogger()}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	log := cfg.log
+	async := append([]events.AsyncOption{
+		events.WithDeliveryCallback(func(d events.Delivery) {
+			if d.Err != nil {
+				log.Error("cannot publish usage event", "topic", d.Topic, "error", d.Err)
+			}
+		}),
+	}, cfg.async...)
+	return &Meter{
+		publisher: events.NewAsyncPublisher(publisher, async...),
+		topic:     cfg.topic,
+		window:    cfg.window,
+		log:       cfg.log,
+		now:       time.Now,
+		seen:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Meter implements Hook.
+func (m *Meter) Meter(ctx context.Context, event Event) {
+	now := m.now()
+	if event.ID == "" {
+		event.ID = newEventID()
+	} else if m.duplicate(event.ID, now) {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = now
+	}
+	event.Timestamp = event.Timestamp.UTC()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		m.log.Error("cannot encode usage event", "resource", event.Resource, "error", err)
+		return
+	}
+	if err := m.publisher.Publish(context.WithoutCancel(ctx), m.topic, data); err != nil {
+		m.log.Error("cannot queue usage event", "resource", event.Resource, "error", err)
+	}
+}
+
+// duplicate reports whether id was seen within the window and remembers it.
+func (m *Meter) duplicate(id string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= m.window {
+		for seenID, at := range m.seen {
+			if now.Sub(at) >= m.window {
+				delete(m.seen, seenID)
+			}
+		}
+		m.lastSweep = now
+	}
+	if at, ok := m.seen[id]; ok && now.Sub(at) < m.window {
+		return true
+	}
+	m.seen[id] = now
+	return false
+}
+
+// Flush publishes buffered events and waits for them.
+func (m *Meter) Flush(ctx context.Context) error {
+	return m.publisher.Flush(ctx)
+}
+
+// Stop flushes buffered events and stops publishing.
+func (m *Meter) Stop(ctx context.Context) error {
+	return m.publisher.Stop(ctx)
+}
+
+func newEventID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,152 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/aquamarinepk/aqm/events"
+	"github.com/go-chi/chi/v5"
+)
+
+type recordingPublisher struct {
+	mu      sync.Mutex
+	batches int
+	events  []Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	return p.BatchPublish(ctx, topic, [][]byte{msg})
+}
+
+func (p *recordingPublisher) BatchPublish(_ context.Context, _ string, msgs [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches++
+	for _, msg := range msgs {
+		var ev Event
+		if err := json.Unmarshal(msg, &ev); err != nil {
+			return err
+		}
+		p.events = append(p.events, ev)
+	}
+	return nil
+}
+
+func (p *recordingPublisher) snapshot() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
+
+type collector struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (c *collector) Meter(_ context.Context, ev Event) {
+	c.mu.Lock()
+	c.events = append(c.events, ev)
+	c.mu.Unlock()
+}
+
+func (c *collector) snapshot() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.events...)
+}
+
+func TestMeterBatchesAndDeduplicates(t *testing.T) {
+	pub := &recordingPublisher{}
+	meter := NewMeter(pub, WithBatching(events.WithFlushInterval(time.Hour), events.WithBatchSize(100)))
+	ctx := context.Background()
+
+	meter.Meter(ctx, Event{ID: "a", Principal: "tenant:acme", Resource: "storage", Quantity: 10})
+	meter.Meter(ctx, Event{ID: "a", Principal: "tenant:acme", Resource: "storage", Quantity: 10})
+	meter.Meter(ctx, Event{Principal: "tenant:acme", Resource: "storage", Quantity: 5})
+
+	if err := meter.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	got := pub.snapshot()
+	if len(got) != 2 || pub.batches != 1 {
+		t.Fatalf("published %d events in %d batches, want 2 in 1", len(got), pub.batches)
+	}
+	if got[1].ID == "" || got[1].Timestamp.IsZero() || got[1].Timestamp.Location() != time.UTC {
+		t.Fatalf("event not normalized: %+v", got[1])
+	}
+}
+
+func TestMeterDedupWindowExpires(t *testing.T) {
+	pub := &recordingPublisher{}
+	meter := NewMeter(pub, WithDedupWindow(time.Minute))
+	now := time.Now()
+	meter.now = func() time.Time { return now }
+
+	meter.Meter(context.Background(), Event{ID: "a"})
+	now = now.Add(2 * time.Minute)
+	meter.Meter(context.Background(), Event{ID: "a"})
+	_ = meter.Stop(context.Background())
+
+	if got := pub.snapshot(); len(got) != 2 {
+		t.Fatalf("published %d events, want 2 once the window passed", len(got))
+	}
+}
+
+func TestRecordAndTaskUseContextHook(t *testing.T) {
+	Record(context.Background(), Event{Resource: "ignored"})
+
+	hook := &collector{}
+	ctx := WithPrincipal(WithHook(context.Background(), hook), "user:1")
+	boom := errors.New("boom")
+	task := Task("export", func(context.Context) error { return boom })
+
+	// aqm.Detach carries the hook and principal into background work.
+	if err := task(aqm.Detach(ctx)); !errors.Is(err, boom) {
+		t.Fatalf("task error = %v", err)
+	}
+	got := hook.snapshot()
+	if len(got) != 1 {
+		t.Fatalf("recorded %d events, want 1", len(got))
+	}
+	ev := got[0]
+	if ev.Resource != "task:export" || ev.Principal != "user:1" || ev.Unit != "seconds" || ev.Attributes["status"] != "error" {
+		t.Fatalf("task event = %+v", ev)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	hook := &collector{}
+	router := chi.NewRouter()
+	router.Use(Middleware(hook))
+	router.Get("/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Record(r.Context(), Event{Resource: "download_bytes", Quantity: 2048, Unit: "bytes"})
+		w.WriteHeader(http.StatusOK)
+	})
+	router.Get("/broken", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/files/42", nil)
+	req = req.WithContext(auth.WithAPIKey(req.Context(), "key-1"))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/broken", nil))
+
+	got := hook.snapshot()
+	if len(got) != 2 {
+		t.Fatalf("recorded %d events, want 2: %+v", len(got), got)
+	}
+	if got[0].Resource != "download_bytes" || got[0].Principal != "api_key:key-1" {
+		t.Fatalf("handler event = %+v", got[0])
+	}
+	if got[1].Resource != "http:GET /files/{id}" || got[1].Quantity != 1 || got[1].Attributes["status"] != "200" {
+		t.Fatalf("request event = %+v", got[1])
+	}
+}
@@ -0,0 +1,50 @@
+package metering
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// Middleware stores hook and the request principal in the request context,
+// so handlers can Record their own usage, and records every request as one
+// "request" of resource "http:<METHOD> <route pattern>". Server errors are
+// not metered. Place it after the middleware that authenticates requests so
+// aqm.RatePrincipalFromRequest sees the caller.
+func Middleware(hook Hook) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hook == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := WithHook(r.Context(), hook)
+			ctx = WithPrincipal(ctx, aqm.RatePrincipalFromRequest(r).Key())
+			r = r.WithContext(ctx)
+
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				return
+			}
+			route := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			Record(ctx, Event{
+				Resource:   "http:" + r.Method + " " + route,
+				Quantity:   1,
+				Unit:       "request",
+				Attributes: map[string]string{"status": strconv.Itoa(status)},
+			})
+		})
+	}
+}
@@ -0,0 +1,490 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsPushConfig configures pushing metrics, bound from "metrics.push".
+// Exporter selects "otlp" (OTLP/HTTP with JSON encoding) or "statsd"; empty
+// leaves push mode off. Endpoint defaults to http://localhost:4318/v1/metrics
+// for otlp and localhost:8125 for statsd. Headers are sent with OTLP
+// requests, e.g. for authentication, and Prefix is prepended to StatsD
+// metric names.
+type MetricsPushConfig struct {
+	Exporter string            `koanf:"exporter" validate:"oneof=otlp statsd"`
+	Endpoint string            `koanf:"endpoint"`
+	Interval time.Duration     `koanf:"interval" default:"10s"`
+	Timeout  time.Duration     `koanf:"timeout" default:"5s"`
+	Prefix   string            `koanf:"prefix"`
+	Headers  map[string]string `koanf:"headers"`
+}
+
+const (
+	pushHTTPRequests = "http_requests_total"
+	pushHTTPDuration = "http_request_duration_ms"
+	maxStatsDPacket  = 1432
+)
+
+// pushBounds are the histogram bucket bounds of request durations, in
+// milliseconds.
+var pushBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// PushMetricsOption customises PushMetrics.
+type PushMetricsOption func(*PushMetrics)
+
+// WithPushLogger reports failed pushes to logger.
+func WithPushLogger(logger Logger) PushMetricsOption {
+	return func(p *PushMetrics) {
+		if logger != nil {
+			p.log = logger
+		}
+	}
+}
+
+// WithPushHTTPClient sets the client of the OTLP exporter.
+func WithPushHTTPClient(client *http.Client) PushMetricsOption {
+	return func(p *PushMetrics) {
+		if client != nil {
+			p.client = client
+		}
+	}
+}
+
+// WithPushAttributes labels every pushed metric: resource attributes for
+// OTLP, tags for StatsD.
+func WithPushAttributes(attrs map[string]string) PushMetricsOption {
+	return func(p *PushMetrics) {
+		for k, v := range attrs {
+			if v != "" {
+				p.attrs[k] = v
+			}
+		}
+	}
+}
+
+type pushSeries struct {
+	name   string
+	labels map[string]string
+}
+
+type pushHistogram struct {
+	count    uint64
+	sum      float64
+	min, max float64
+	buckets  []uint64
+}
+
+// PushMetrics is a Metrics implementation for jobs and serverless functions
+// that are gone before a scraper comes by: it aggregates counters and
+// request durations in memory and pushes the deltas every interval and on
+// Shutdown. Code recording metrics is the same in both deployment modes.
+type PushMetrics struct {
+	cfg    MetricsPushConfig
+	log    Logger
+	client *http.Client
+	attrs  map[string]string
+	send   func(ctx context.Context, sums map[string]float64, series map[string]pushSeries, histograms map[string]*pushHistogram, start, end time.Time) error
+
+	mu         sync.Mutex
+	series     map[string]pushSeries
+	sums       map[string]float64
+	histograms map[string]*pushHistogram
+	since      time.Time
+
+	runMu   sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+var _ Metrics = (*PushMetrics)(nil)
+
+// NewPushMetrics builds a pusher for cfg.Exporter; Start begins the
+// periodic pushes.
+func NewPushMetrics(cfg MetricsPushConfig, opts ...PushMetricsOption) (*PushMetrics, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	p := &PushMetrics{
+		cfg:        cfg,
+		log:        NewNoopLogger(),
+		attrs:      make(map[string]string),
+		series:     make(map[string]pushSeries),
+		sums:       make(map[string]float64),
+		histograms: make(map[string]*pushHistogram),
+		since:      time.Now(),
+	}
+	switch cfg.Exporter {
+	case "otlp":
+		if p.cfg.Endpoint == "" {
+			p.cfg.Endpoint = "http://localhost:4318"
+		}
+		if !strings.HasSuffix(p.cfg.Endpoint, "/v1/metrics") {
+			p.cfg.Endpoint = strings.TrimSuffix(p.cfg.Endpoint, "/") + "/v1/metrics"
+		}
+		p.send = p.sendOTLP
+	case "statsd":
+		if p.cfg.Endpoint == "" {
+			p.cfg.Endpoint = "localhost:8125"
+		}
+		p.send = p.sendStatsD
+	default:
+		return nil, fmt.Errorf("metrics push: unknown exporter %q", cfg.Exporter)
+	}
+	p.client = &http.Client{Timeout: p.cfg.Timeout}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+	return p, nil
+}
+
+// WithPushMetrics installs PushMetrics as the shared Metrics when the config
+// sets metrics.push.exporter, labelled with service.name and
+// service.version. It pushes from the start of the lifecycle and flushes a
+// last time in a shutdown hook, so commands report too. Apply it after
+// WithConfig; without an exporter it leaves the metrics untouched.
+func WithPushMetrics(opts ...PushMetricsOption) Option {
+	return func(ms *Micro) error {
+		deps := ms.Deps()
+		cfg, err := BindEnv[MetricsPushConfig](deps.Config, "metrics.push")
+		if err != nil {
+			return err
+		}
+		if cfg.Exporter == "" {
+			return nil
+		}
+		attrs := map[string]string{
+			"service.name":    deps.Config.GetStringOrDef("service.name", "aqm"),
+			"service.version": deps.Config.GetStringOrDef("service.version", ""),
+		}
+		opts = append([]PushMetricsOption{WithPushLogger(deps.Logger), WithPushAttributes(attrs)}, opts...)
+		pusher, err := NewPushMetrics(cfg, opts...)
+		if err != nil {
+			return err
+		}
+		ms.mu.Lock()
+		ms.deps.Metrics = pusher
+		ms.mu.Unlock()
+		ms.addStart(pusher.Start)
+		ms.addShutdown(pusher.Shutdown)
+		return nil
+	}
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "\x00" + labels[k])
+	}
+	return b.String()
+}
+
+func (p *PushMetrics) track(name string, labels map[string]string) string {
+	key := seriesKey(name, labels)
+	if _, ok := p.series[key]; !ok {
+		copied := make(map[string]string, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		p.series[key] = pushSeries{name: name, labels: copied}
+	}
+	return key
+}
+
+// Counter adds value to the counter identified by name and labels.
+func (p *PushMetrics) Counter(_ context.Context, name string, value float64, labels map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sums[p.track(name, labels)] += value
+}
+
+// ObserveHTTPRequest counts the request in http_requests_total and records
+// its duration in the http_request_duration_ms histogram.
+func (p *PushMetrics) ObserveHTTPRequest(path, method string, status int, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sums[p.track(pushHTTPRequests, map[string]string{"path": path, "method": method, "status": strconv.Itoa(status)})]++
+
+	key := p.track(pushHTTPDuration, map[string]string{"path": path, "method": method})
+	h := p.histograms[key]
+	if h == nil {
+		h = &pushHistogram{buckets: make([]uint64, len(pushBounds)+1)}
+		p.histograms[key] = h
+	}
+	ms := float64(duration) / float64(time.Millisecond)
+	h.observe(ms, 1, ms, ms)
+	h.buckets[sort.SearchFloat64s(pushBounds, ms)]++
+}
+
+func (h *pushHistogram) observe(sum float64, count uint64, min, max float64) {
+	if h.count == 0 || min < h.min {
+		h.min = min
+	}
+	if h.count == 0 || max > h.max {
+		h.max = max
+	}
+	h.count += count
+	h.sum += sum
+}
+
+// Start pushes every interval until Shutdown.
+func (p *PushMetrics) Start(context.Context) error {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if p.stop != nil {
+		return nil
+	}
+	p.stop, p.stopped = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(p.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+				if err := p.Flush(ctx); err != nil {
+					p.log.Error("metrics push failed", "exporter", p.cfg.Exporter, "error", err)
+				}
+				cancel()
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the periodic pushes and pushes what was recorded since the
+// last one.
+func (p *PushMetrics) Shutdown(ctx context.Context) error {
+	p.runMu.Lock()
+	if p.stop != nil {
+		close(p.stop)
+		<-p.stopped
+		p.stop = nil
+	}
+	p.runMu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+	return p.Flush(ctx)
+}
+
+// Flush pushes the metrics recorded since the last push. When the push
+// fails they are kept and go out with the next one.
+func (p *PushMetrics) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	sums, histograms, start := p.sums, p.histograms, p.since
+	series := make(map[string]pushSeries, len(p.series))
+	for k, v := range p.series {
+		series[k] = v
+	}
+	end := time.Now()
+	p.sums, p.histograms, p.since = make(map[string]float64), make(map[string]*pushHistogram), end
+	p.mu.Unlock()
+	if len(sums) == 0 && len(histograms) == 0 {
+		return nil
+	}
+
+	err := p.send(ctx, sums, series, histograms, start, end)
+	if err == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, value := range sums {
+		p.sums[key] += value
+	}
+	for key, h := range histograms {
+		current := p.histograms[key]
+		if current == nil {
+			p.histograms[key] = h
+			continue
+		}
+		current.observe(h.sum, h.count, h.min, h.max)
+		for i, n := range h.buckets {
+			current.buckets[i] += n
+		}
+	}
+	p.since = start
+	return err
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttributes(labels map[string]string) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(labels))
+	for k, v := range labels {
+		attr := otlpAttribute{Key: k}
+		attr.Value.StringValue = v
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// sendOTLP posts delta sums and histograms in the OTLP/HTTP JSON encoding,
+// where 64-bit integers are strings.
+func (p *PushMetrics) sendOTLP(ctx context.Context, sums map[string]float64, series map[string]pushSeries, histograms map[string]*pushHistogram, start, end time.Time) error {
+	const deltaTemporality = 1
+	startNano, endNano := strconv.FormatInt(start.UnixNano(), 10), strconv.FormatInt(end.UnixNano(), 10)
+	metrics := map[string]map[string]any{}
+	point := func(key string) (map[string]any, string) {
+		s := series[key]
+		if metrics[s.name] == nil {
+			metrics[s.name] = map[string]any{"name": s.name}
+		}
+		return map[string]any{"attributes": otlpAttributes(s.labels), "startTimeUnixNano": startNano, "timeUnixNano": endNano}, s.name
+	}
+	appendPoint := func(name, kind string, dp map[string]any, extra map[string]any) {
+		data, ok := metrics[name][kind].(map[string]any)
+		if !ok {
+			data = map[string]any{"aggregationTemporality": deltaTemporality, "dataPoints": []map[string]any{}}
+			for k, v := range extra {
+				data[k] = v
+			}
+			metrics[name][kind] = data
+		}
+		data["dataPoints"] = append(data["dataPoints"].([]map[string]any), dp)
+	}
+	for key, value := range sums {
+		dp, name := point(key)
+		dp["asDouble"] = value
+		appendPoint(name, "sum", dp, map[string]any{"isMonotonic": true})
+	}
+	for key, h := range histograms {
+		dp, name := point(key)
+		buckets := make([]string, len(h.buckets))
+		for i, n := range h.buckets {
+			buckets[i] = strconv.FormatUint(n, 10)
+		}
+		dp["count"] = strconv.FormatUint(h.count, 10)
+		dp["sum"], dp["min"], dp["max"] = h.sum, h.min, h.max
+		dp["bucketCounts"], dp["explicitBounds"] = buckets, pushBounds
+		appendPoint(name, "histogram", dp, nil)
+	}
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]map[string]any, len(names))
+	for i, name := range names {
+		list[i] = metrics[name]
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource":     map[string]any{"attributes": otlpAttributes(p.attrs)},
+			"scopeMetrics": []any{map[string]any{"scope": map[string]any{"name": "aqm"}, "metrics": list}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("metrics push: encoding: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("metrics push: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("metrics push: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("metrics push: collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// sendStatsD writes the sums as counters and each histogram as
+// <name>.count and <name>.sum counters and a <name>.max gauge, in the
+// DogStatsD dialect with labels and attributes as tags.
+func (p *PushMetrics) sendStatsD(ctx context.Context, sums map[string]float64, series map[string]pushSeries, histograms map[string]*pushHistogram, _, _ time.Time) error {
+	var lines []string
+	line := func(key, suffix string, value float64, kind string) {
+		s := series[key]
+		tags := make([]string, 0, len(s.labels)+len(p.attrs))
+		for k, v := range p.attrs {
+			tags = append(tags, k+":"+v)
+		}
+		for k, v := range s.labels {
+			tags = append(tags, k+":"+v)
+		}
+		sort.Strings(tags)
+		l := p.cfg.Prefix + s.name + suffix + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+		if len(tags) > 0 {
+			l += "|#" + strings.Join(tags, ",")
+		}
+		lines = append(lines, l)
+	}
+	for key, value := range sums {
+		line(key, "", value, "c")
+	}
+	for key, h := range histograms {
+		line(key, ".count", float64(h.count), "c")
+		line(key, ".sum", h.sum, "c")
+		line(key, ".max", h.max, "g")
+	}
+	sort.Strings(lines)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", p.cfg.Endpoint)
+	if err != nil {
+		return fmt.Errorf("metrics push: %w", err)
+	}
+	defer conn.Close()
+	var packet []byte
+	for i, l := range lines {
+		if len(packet) > 0 && len(packet)+1+len(l) > maxStatsDPacket {
+			if _, err := conn.Write(packet); err != nil {
+				return fmt.Errorf("metrics push: %w", err)
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, l...)
+		if i == len(lines)-1 {
+			if _, err := conn.Write(packet); err != nil {
+				return fmt.Errorf("metrics push: %w", err)
+			}
+		}
+	}
+	return nil
+}
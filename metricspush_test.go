@@ -0,0 +1,241 @@
+package aqm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type otlpCollector struct {
+	mu       sync.Mutex
+	fail     bool
+	bodies   []map[string]any
+	apiKeys  []string
+	requests int
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	if r.URL.Path != "/v1/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	if c.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var body map[string]any
+	data, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(data, &body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.bodies = append(c.bodies, body)
+	c.apiKeys = append(c.apiKeys, r.Header.Get("X-Api-Key"))
+}
+
+func (c *otlpCollector) last(t *testing.T) map[string]any {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.bodies) == 0 {
+		t.Fatal("expected a push")
+	}
+	return c.bodies[len(c.bodies)-1]
+}
+
+// otlpMetrics indexes the pushed metrics by name.
+func otlpMetrics(t *testing.T, body map[string]any) (resource []any, metrics map[string]map[string]any) {
+	t.Helper()
+	rm := body["resourceMetrics"].([]any)[0].(map[string]any)
+	resource = rm["resource"].(map[string]any)["attributes"].([]any)
+	metrics = map[string]map[string]any{}
+	for _, m := range rm["scopeMetrics"].([]any)[0].(map[string]any)["metrics"].([]any) {
+		metric := m.(map[string]any)
+		metrics[metric["name"].(string)] = metric
+	}
+	return resource, metrics
+}
+
+func TestPushMetricsOTLP(t *testing.T) {
+	collector := &otlpCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	p, err := NewPushMetrics(MetricsPushConfig{
+		Exporter: "otlp",
+		Endpoint: srv.URL,
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	}, WithPushAttributes(map[string]string{"service.name": "billing"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	p.Counter(ctx, "jobs_total", 2, map[string]string{"kind": "invoice"})
+	p.Counter(ctx, "jobs_total", 3, map[string]string{"kind": "invoice"})
+	p.ObserveHTTPRequest("/orders", "GET", 200, 20*time.Millisecond)
+	p.ObserveHTTPRequest("/orders", "GET", 200, 300*time.Millisecond)
+
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	resource, metrics := otlpMetrics(t, collector.last(t))
+	if attr := resource[0].(map[string]any); attr["key"] != "service.name" || attr["value"].(map[string]any)["stringValue"] != "billing" {
+		t.Errorf("unexpected resource attributes %v", resource)
+	}
+	jobs := metrics["jobs_total"]["sum"].(map[string]any)
+	if jobs["isMonotonic"] != true || jobs["aggregationTemporality"] != float64(1) {
+		t.Errorf("expected a monotonic delta sum, got %v", jobs)
+	}
+	if dp := jobs["dataPoints"].([]any)[0].(map[string]any); dp["asDouble"] != float64(5) {
+		t.Errorf("expected 5 jobs, got %v", dp["asDouble"])
+	}
+	if dp := metrics[pushHTTPRequests]["sum"].(map[string]any)["dataPoints"].([]any)[0].(map[string]any); dp["asDouble"] != float64(2) {
+		t.Errorf("expected 2 requests, got %v", dp["asDouble"])
+	}
+	hist := metrics[pushHTTPDuration]["histogram"].(map[string]any)["dataPoints"].([]any)[0].(map[string]any)
+	if hist["count"] != "2" || hist["sum"] != float64(320) || hist["max"] != float64(300) {
+		t.Errorf("unexpected histogram %v", hist)
+	}
+	if buckets := hist["bucketCounts"].([]any); buckets[2] != "1" || buckets[6] != "1" {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+	if collector.apiKeys[0] != "secret" {
+		t.Errorf("expected configured headers, got %q", collector.apiKeys[0])
+	}
+
+	if err := p.Flush(ctx); err != nil || collector.requests != 1 {
+		t.Errorf("expected nothing to push, got err %v and %d requests", err, collector.requests)
+	}
+}
+
+func TestPushMetricsKeepsUnsentDeltas(t *testing.T) {
+	collector := &otlpCollector{fail: true}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	p, err := NewPushMetrics(MetricsPushConfig{Exporter: "otlp", Endpoint: srv.URL + "/v1/metrics"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	p.Counter(ctx, "jobs_total", 1, nil)
+	if err := p.Flush(ctx); err == nil {
+		t.Fatal("expected the failed push to be reported")
+	}
+
+	collector.mu.Lock()
+	collector.fail = false
+	collector.mu.Unlock()
+	p.Counter(ctx, "jobs_total", 1, nil)
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	_, metrics := otlpMetrics(t, collector.last(t))
+	if dp := metrics["jobs_total"]["sum"].(map[string]any)["dataPoints"].([]any)[0].(map[string]any); dp["asDouble"] != float64(2) {
+		t.Errorf("expected the unsent delta to be pushed again, got %v", dp["asDouble"])
+	}
+}
+
+func TestPushMetricsStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	p, err := NewPushMetrics(MetricsPushConfig{
+		Exporter: "statsd",
+		Endpoint: conn.LocalAddr().String(),
+		Prefix:   "app.",
+	}, WithPushAttributes(map[string]string{"service.name": "billing"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.Counter(context.Background(), "jobs_total", 3, map[string]string{"kind": "invoice"})
+	p.ObserveHTTPRequest("/orders", "POST", 201, 40*time.Millisecond)
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	want := []string{
+		"app.http_request_duration_ms.count:1|c|#method:POST,path:/orders,service.name:billing",
+		"app.http_request_duration_ms.max:40|g|#method:POST,path:/orders,service.name:billing",
+		"app.http_request_duration_ms.sum:40|c|#method:POST,path:/orders,service.name:billing",
+		"app.http_requests_total:1|c|#method:POST,path:/orders,service.name:billing,status:201",
+		"app.jobs_total:3|c|#kind:invoice,service.name:billing",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestNewPushMetricsUnknownExporter(t *testing.T) {
+	if _, err := NewPushMetrics(MetricsPushConfig{Exporter: "graphite"}); err == nil {
+		t.Fatal("expected an error for an unknown exporter")
+	}
+}
+
+func TestWithPushMetrics(t *testing.T) {
+	t.Run("disabled without exporter", func(t *testing.T) {
+		ms := NewMicro(WithConfig(NewConfig()), WithLogger(NewNoopLogger()), WithPushMetrics())
+		if _, ok := ms.Deps().Metrics.(*PushMetrics); ok {
+			t.Fatal("expected metrics to be left untouched")
+		}
+	})
+
+	t.Run("flushes on shutdown", func(t *testing.T) {
+		collector := &otlpCollector{}
+		srv := httptest.NewServer(collector)
+		defer srv.Close()
+
+		cfg := NewConfig()
+		cfg.Set("service.name", "billing")
+		cfg.Set("service.version", "1.4.0")
+		cfg.Set("metrics.push.exporter", "otlp")
+		cfg.Set("metrics.push.endpoint", srv.URL)
+		ms := NewMicro(
+			WithConfig(cfg),
+			WithLogger(NewNoopLogger()),
+			WithPushMetrics(),
+			WithCommands(Command{
+				Name: "reindex",
+				Run: func(ctx context.Context, deps *Deps, _ []string) error {
+					deps.Metrics.Counter(ctx, "reindexed_total", 7, nil)
+					return nil
+				},
+			}),
+			WithArgs("reindex"),
+		)
+		if _, ok := ms.Deps().Metrics.(*PushMetrics); !ok {
+			t.Fatalf("expected push metrics, got %T", ms.Deps().Metrics)
+		}
+		if err := ms.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		resource, metrics := otlpMetrics(t, collector.last(t))
+		if len(resource) != 2 {
+			t.Errorf("expected service name and version attributes, got %v", resource)
+		}
+		if _, ok := metrics["reindexed_total"]; !ok {
+			t.Errorf("expected the command's metrics to be pushed, got %v", metrics)
+		}
+	})
+}
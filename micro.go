@@ -2,12 +2,16 @@ package aqm
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
 )
 
 // Micro orchestrates dependency wiring, runner lifecycle management, and shutdown hooks.
@@ -20,18 +24,43 @@ type Micro struct {
 	httpConfigured  bool
 	httpMiddlewares []func(http.Handler) http.Handler
 	routerConfig    []func(*chi.Mux)
+	httpRouter      *chi.Mux
+	routeTable      *routeTable
+	httpHealth      *HealthRegistry
+	httpModules     []HTTPModuleFactory
+	httpServer      *http.Server
+	httpTLS         *tls.Config
+	streams         *StreamRegistry
+	connectAddrKey  string
 
 	healthChecks []healthCheckRegistration
 	debugRoutes  bool
+	debugOptIn   bool
 
 	startFuncs []func(context.Context) error
 	stopFuncs  []func(context.Context) error
+
+	commands     map[string]Command
+	args         []string
+	configChecks []configCheck
+	stdout       io.Writer
+
+	signalHandlers []signalRegistration
+	supervisor     *Supervisor
+
+	grpcServerOptions []grpc.ServerOption
+
+	warmups       []warmupRegistration
+	warmupPending atomic.Bool
+
+	redactor *Redactor
 }
 
 type healthCheckRegistration struct {
 	name      string
 	liveness  HealthCheck
 	readiness HealthCheck
+	severity  HealthSeverity
 }
 
 // ShutdownFunc is executed when Run exits, giving modules a chance to release resources.
@@ -49,21 +78,85 @@ func NewMicro(opts ...Option) *Micro {
 			panic(fmt.Errorf("applying option: %w", err))
 		}
 	}
+	if err := ms.finishConnect(); err != nil {
+		panic(fmt.Errorf("configuring connect: %w", err))
+	}
 	ms.ensureCoreDependencies()
+	ms.applyRedactor()
+	ms.deps.Errors = TraceErrorReporter(ms.deps.Errors)
+	ms.supervisor = NewSupervisor(
+		WithSupervisorReporter(ms.deps.Errors),
+		WithSupervisorLogger(ms.deps.Logger),
+	)
 	return ms
 }
 
-// Run starts all registered runners, blocks until the context is cancelled, and then stops
+// Run starts all registered runners concurrently, blocks until the context is cancelled, and then stops
 // runners in reverse order before executing shutdown hooks. Errors emitted while stopping
-// or during shutdown are aggregated.
+// or during shutdown are aggregated. A failed runner start stops the runners that already
+// started (runner.start_timeout bounds each start). When the arguments select a command registered with
+// WithCommands, that command runs instead of the runners. --print-config and
+// --validate-config check the configuration and return without starting. Once
+// the runners started the warmups run; /readyz fails until they finish.
 func (micro *Micro) Run(ctx context.Context) error {
 	micro.mu.RLock()
 	runners := append([]Runner(nil), micro.runners...)
 	shutdown := append([]ShutdownFunc(nil), micro.shutdown...)
 	startFns := append([]func(context.Context) error(nil), micro.startFuncs...)
 	stopFns := append([]func(context.Context) error(nil), micro.stopFuncs...)
+	warmups := append([]warmupRegistration(nil), micro.warmups...)
+	supervisor := micro.supervisor
 	micro.mu.RUnlock()
+	if supervisor == nil {
+		supervisor = NewSupervisor()
+	}
+	ctx = ContextWithSupervisor(ctx, supervisor)
+
+	if done, err := micro.runConfigFlags(); done || err != nil {
+		return err
+	}
+
+	cmd, args, err := micro.resolveCommand()
+	if err != nil {
+		return err
+	}
+	if cmd != nil {
+		return micro.runCommand(ctx, cmd, args, supervisor, startFns, stopFns, shutdown)
+	}
+
+	if err := startLifecycle(ctx, startFns, stopFns); err != nil {
+		return err
+	}
 
+	ctx, cancelRunners := context.WithCancel(ctx)
+	defer cancelRunners()
+
+	stopSignals := micro.watchSignals(ctx)
+	defer stopSignals()
+
+	startTimeout := micro.Deps().Config.GetDurationOrDef("runner.start_timeout", 0)
+	if err := startRunners(ctx, cancelRunners, runners, startTimeout); err != nil {
+		err = errors.Join(err, stopSupervisor(ctx, supervisor))
+		return errors.Join(err, stopLifecycle(context.WithoutCancel(ctx), stopFns, shutdown))
+	}
+	go micro.runWarmups(ctx, warmups)
+
+	<-ctx.Done()
+	stopSignals()
+
+	var aggErr error
+	for i := len(runners) - 1; i >= 0; i-- {
+		if err := runners[i].Stop(ctx); err != nil {
+			aggErr = errors.Join(aggErr, fmt.Errorf("runner %s stop: %w", runnerName(runners[i]), err))
+		}
+	}
+	aggErr = errors.Join(aggErr, stopSupervisor(ctx, supervisor))
+	return errors.Join(aggErr, stopLifecycle(ctx, stopFns, shutdown))
+}
+
+// startLifecycle runs the start hooks in order, stopping the already started
+// ones when a hook fails.
+func startLifecycle(ctx context.Context, startFns, stopFns []func(context.Context) error) error {
 	for i, start := range startFns {
 		if err := start(ctx); err != nil {
 			// attempt rollback of previously started components
@@ -75,21 +168,13 @@ func (micro *Micro) Run(ctx context.Context) error {
 			return fmt.Errorf("lifecycle start: %w", err)
 		}
 	}
+	return nil
+}
 
-	for _, runner := range runners {
-		if err := runner.Start(ctx); err != nil {
-			return fmt.Errorf("runner start: %w", err)
-		}
-	}
-
-	<-ctx.Done()
-
+// stopLifecycle runs the stop hooks in reverse order followed by the shutdown
+// hooks, aggregating their errors.
+func stopLifecycle(ctx context.Context, stopFns []func(context.Context) error, shutdown []ShutdownFunc) error {
 	var aggErr error
-	for i := len(runners) - 1; i >= 0; i-- {
-		if err := runners[i].Stop(ctx); err != nil {
-			aggErr = errors.Join(aggErr, fmt.Errorf("runner stop: %w", err))
-		}
-	}
 	for i := len(stopFns) - 1; i >= 0; i-- {
 		if err := stopFns[i](ctx); err != nil {
 			aggErr = errors.Join(aggErr, fmt.Errorf("lifecycle stop: %w", err))
@@ -103,6 +188,33 @@ func (micro *Micro) Run(ctx context.Context) error {
 	return aggErr
 }
 
+// stopSupervisor cancels background tasks and waits a bounded time for them,
+// even when ctx is already cancelled.
+func stopSupervisor(ctx context.Context, supervisor *Supervisor) error {
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), supervisorStopTimeout)
+	defer cancel()
+	if err := supervisor.Stop(stopCtx); err != nil {
+		return fmt.Errorf("background tasks: %w", err)
+	}
+	return nil
+}
+
+// Supervisor returns the supervisor tracking background tasks spawned with Go
+// from runners and lifecycle hooks.
+func (micro *Micro) Supervisor() *Supervisor {
+	micro.mu.RLock()
+	defer micro.mu.RUnlock()
+	return micro.supervisor
+}
+
+// Streams returns the registry of long-lived HTTP streams drained on shutdown,
+// or nil until WithHTTPServer has been applied.
+func (micro *Micro) Streams() *StreamRegistry {
+	micro.mu.RLock()
+	defer micro.mu.RUnlock()
+	return micro.streams
+}
+
 // Deps exposes the wired dependency container.
 func (micro *Micro) Deps() *Deps {
 	micro.mu.RLock()
@@ -110,6 +222,25 @@ func (micro *Micro) Deps() *Deps {
 	return micro.deps
 }
 
+// DebugRequested reports whether WithDebugRoutes was applied, the explicit
+// opt-in for debug endpoints that write data, such as gen's populate route.
+func (micro *Micro) DebugRequested() bool {
+	micro.mu.RLock()
+	defer micro.mu.RUnlock()
+	return micro.debugOptIn
+}
+
+// debugRoutesEnabled reports whether the debug endpoints should be mounted:
+// by default only under the dev profile, or anywhere but prod after an
+// explicit WithDebugRoutes. Callers must hold the lock.
+func (micro *Micro) debugRoutesEnabled() bool {
+	cfg := micro.deps.Config
+	if cfg.IsProd() {
+		return false
+	}
+	return micro.debugOptIn || (micro.debugRoutes && cfg.IsDev())
+}
+
 // addRunner installs a runner in a threadsafe manner.
 func (micro *Micro) addRunner(r Runner) {
 	micro.mu.Lock()
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+// TokenVerifier checks a bearer token and returns its claims.
+// *auth.TokenService implements it through auth.TokenService.Verify.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token, audience string) (*auth.TokenClaims, error)
+}
+
+// AuthenticateOptions configures Authenticate.
+type AuthenticateOptions struct {
+	Verifier TokenVerifier // required
+	Audience string        // required; the audience tokens must carry
+	Optional bool          // let requests without a token through anonymously
+}
+
+// Authenticate verifies the bearer token of every request and stores its
+// claims with auth.WithClaims. Missing, invalid and expired tokens are
+// answered with 401; revoked sessions with the token_revoked code and tokens
+// older than the subject's authorization version with authz_version_stale,
+// telling clients to refresh. With opts.Optional, requests without an
+// Authorization header pass through without claims.
+func Authenticate(opts AuthenticateOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" && opts.Optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" || opts.Verifier == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				aqm.Error(w, http.StatusUnauthorized, "unauthenticated", "a bearer token is required")
+				return
+			}
+
+			claims, err := opts.Verifier.Verify(r.Context(), token, opts.Audience)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				switch {
+				case errors.Is(err, auth.ErrTokenRevoked):
+					aqm.Error(w, http.StatusUnauthorized, "token_revoked", "the session was revoked")
+				case errors.Is(err, auth.ErrAuthzVersionStale):
+					aqm.Error(w, http.StatusUnauthorized, "authz_version_stale", "permissions changed, refresh the token")
+				case errors.Is(err, auth.ErrTokenExpired):
+					aqm.Error(w, http.StatusUnauthorized, "token_expired", "the token has expired")
+				case errors.Is(err, auth.ErrInvalidToken):
+					aqm.Error(w, http.StatusUnauthorized, "invalid_token", "the token is invalid")
+				default:
+					aqm.LoggerFrom(r.Context()).Error("cannot verify token", "error", err)
+					aqm.Error(w, http.StatusServiceUnavailable, "auth_unavailable", "cannot verify the token")
+				}
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// APIKeyVerifier checks an API key and returns the ID it is known by, or an
+// error wrapping auth.ErrInvalidAPIKey when the key is unknown or revoked.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (string, error)
+}
+
+// APIKeyVerifierFunc adapts a function to APIKeyVerifier.
+type APIKeyVerifierFunc func(ctx context.Context, key string) (string, error)
+
+// VerifyAPIKey implements APIKeyVerifier.
+func (f APIKeyVerifierFunc) VerifyAPIKey(ctx context.Context, key string) (string, error) {
+	return f(ctx, key)
+}
+
+// APIKeyOptions configures AuthenticateAPIKey.
+type APIKeyOptions struct {
+	Verifier APIKeyVerifier // required
+	Optional bool           // let requests without a key through anonymously
+}
+
+// AuthenticateAPIKey verifies the aqm.APIKeyHeader of every request and
+// stores the key ID with auth.WithAPIKey, where RatePrincipalFromRequest
+// picks it up. Missing and invalid keys are answered with 401. With
+// opts.Optional, requests without the header pass through.
+func AuthenticateAPIKey(opts APIKeyOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(aqm.APIKeyHeader)
+			if key == "" && opts.Optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key == "" || opts.Verifier == nil {
+				aqm.Error(w, http.StatusUnauthorized, "unauthenticated", "an api key is required")
+				return
+			}
+
+			id, err := opts.Verifier.VerifyAPIKey(r.Context(), key)
+			switch {
+			case errors.Is(err, auth.ErrInvalidAPIKey):
+				aqm.Error(w, http.StatusUnauthorized, "invalid_api_key", "the api key is invalid")
+				return
+			case err != nil:
+				aqm.LoggerFrom(r.Context()).Error("cannot verify api key", "error", err)
+				aqm.Error(w, http.StatusServiceUnavailable, "auth_unavailable", "cannot verify the api key")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithAPIKey(r.Context(), id)))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+func TestAuthenticate(t *testing.T) {
+	_, key, err := auth.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := auth.NewMemoryTokenStore()
+	tokens := auth.NewTokenService(key, store, store)
+	pair, err := tokens.Issue(context.Background(), "user-1", "api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subject string
+	handler := Authenticate(AuthenticateOptions{Verifier: tokens, Audience: "api"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = auth.ClaimsFrom(r.Context()).Subject
+	}))
+	call := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call("Bearer " + pair.AccessToken); rec.Code != http.StatusOK || subject != "user-1" {
+		t.Fatalf("valid token: %d, subject %q", rec.Code, subject)
+	}
+	if rec := call(""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing token: %d", rec.Code)
+	}
+	if rec := call("Bearer v4.public.bogus.token"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("invalid token: %d", rec.Code)
+	}
+
+	if err := tokens.InvalidateAuthz(context.Background(), "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	rec := call("Bearer " + pair.AccessToken)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "authz_version_stale") {
+		t.Fatalf("stale token: %d %s", rec.Code, rec.Body)
+	}
+
+	optional := Authenticate(AuthenticateOptions{Verifier: tokens, Audience: "api", Optional: true})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec = httptest.NewRecorder()
+	optional.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("optional anonymous: %d", rec.Code)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	verifier := APIKeyVerifierFunc(func(_ context.Context, key string) (string, error) {
+		switch key {
+		case "sk_live_1":
+			return "key-1", nil
+		case "sk_down":
+			return "", errors.New("store down")
+		}
+		return "", auth.ErrInvalidAPIKey
+	})
+	var id string
+	handler := AuthenticateAPIKey(APIKeyOptions{Verifier: verifier})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = auth.APIKeyFrom(r.Context())
+	}))
+	call := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			req.Header.Set(aqm.APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call("sk_live_1"); rec.Code != http.StatusOK || id != "key-1" {
+		t.Fatalf("valid key: %d, id %q", rec.Code, id)
+	}
+	if rec := call(""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing key: %d", rec.Code)
+	}
+	if rec := call("sk_forged"); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "invalid_api_key") {
+		t.Fatalf("invalid key: %d %s", rec.Code, rec.Body)
+	}
+	if rec := call("sk_down"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("verifier failure: %d", rec.Code)
+	}
+}
@@ -0,0 +1,305 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressEncoder is a content coding the Compress middleware can produce.
+// New returns a writer compressing into w at level; a Close method on it is
+// called when the response ends.
+type CompressEncoder struct {
+	Name  string // Content-Encoding token, e.g. "br"
+	Level int
+	New   func(w io.Writer, level int) io.Writer
+}
+
+// CompressOptions configures CompressWith.
+type CompressOptions struct {
+	// Level is the gzip and deflate level, default 5.
+	Level int
+	// MinSize is the smallest body worth compressing, default 1024 bytes.
+	// Negative values compress every body.
+	MinSize int
+	// ContentTypes lists the compressible media types. Entries may end in
+	// "/*" ("text/*") or start with "*/*+" ("*/*+json" for any +json
+	// suffix). Defaults to DefaultCompressContentTypes.
+	ContentTypes []string
+	// Encoders are preferred over gzip and deflate, in order, when the client
+	// accepts them. Only gzip and deflate are built in; Brotli must be
+	// registered this way, e.g. with github.com/andybalholm/brotli:
+	//
+	//	{Name: "br", Level: 5, New: func(w io.Writer, l int) io.Writer { return brotli.NewWriterLevel(w, l) }}
+	Encoders []CompressEncoder
+}
+
+// DefaultCompressContentTypes are the text based types compressed by default.
+// Images, archives and other already compressed formats are left alone.
+var DefaultCompressContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"image/svg+xml",
+	"*/*+json",
+	"*/*+xml",
+}
+
+const defaultCompressMinSize = 1024
+
+// Compress enables gzip and deflate compression at level for text responses
+// of at least 1 KiB. See CompressWith for the other settings.
+func Compress(level int) func(http.Handler) http.Handler {
+	return CompressWith(CompressOptions{Level: level})
+}
+
+// CompressWith compresses responses whose content type is allowed and whose
+// body reaches MinSize, using the best encoding the client accepts. Bodies
+// are held back until MinSize bytes are written; a Flush before that, an
+// event stream, a partial (206 or Content-Range) response or a response
+// already carrying a Content-Encoding is sent uncompressed, so streaming
+// responses are never buffered and byte ranges stay valid.
+func CompressWith(opts CompressOptions) func(http.Handler) http.Handler {
+	if opts.Level <= 0 {
+		opts.Level = 5
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = defaultCompressMinSize
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultCompressContentTypes
+	}
+	encoders := append([]CompressEncoder{}, opts.Encoders...)
+	encoders = append(encoders,
+		CompressEncoder{Name: "gzip", Level: opts.Level, New: newGzipWriter},
+		CompressEncoder{Name: "deflate", Level: opts.Level, New: newFlateWriter},
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoder, ok := negotiateEncoding(r.Header.Get("Accept-Encoding"), encoders)
+			if !ok || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoder: encoder, opts: &opts}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+func newGzipWriter(w io.Writer, level int) io.Writer {
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		gw = gzip.NewWriter(w)
+	}
+	return gw
+}
+
+func newFlateWriter(w io.Writer, level int) io.Writer {
+	fw, err := flate.NewWriter(w, level)
+	if err != nil {
+		fw, _ = flate.NewWriter(w, flate.DefaultCompression)
+	}
+	return fw
+}
+
+// negotiateEncoding picks the first encoder the client accepts with a non
+// zero quality; "*" accepts any of them.
+func negotiateEncoding(header string, encoders []CompressEncoder) (CompressEncoder, bool) {
+	if header == "" {
+		return CompressEncoder{}, false
+	}
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	for _, enc := range encoders {
+		if ok, listed := accepted[enc.Name]; listed {
+			if ok {
+				return enc, true
+			}
+			continue
+		}
+		if accepted["*"] {
+			return enc, true
+		}
+	}
+	return CompressEncoder{}, false
+}
+
+func compressibleType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	for _, pattern := range allowed {
+		switch {
+		case pattern == mediaType:
+			return true
+		case strings.HasPrefix(pattern, "*/*+"):
+			if strings.HasSuffix(mediaType, pattern[3:]) {
+				return true
+			}
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the start of the body until it can tell whether
+// compressing is worth it.
+type compressWriter struct {
+	http.ResponseWriter
+	encoder CompressEncoder
+	opts    *CompressOptions
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	writer  io.Writer // the encoder, or nil when passing through
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		// No body follows; informational headers go out as they come.
+		if status >= http.StatusOK {
+			cw.decide(false)
+		}
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		return cw.out().Write(p)
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.skip() {
+		cw.decide(false)
+		return cw.out().Write(p)
+	}
+	cw.buf.Write(p)
+	if cw.opts.MinSize < 0 || cw.buf.Len() >= cw.opts.MinSize {
+		cw.decide(cw.compressible())
+	}
+	return len(p), nil
+}
+
+// skip reports whether the status and headers alone rule compression out.
+// Ranges refer to the identity encoding, so partial responses are skipped.
+func (cw *compressWriter) skip() bool {
+	h := cw.Header()
+	if cw.status == http.StatusPartialContent || h.Get("Content-Range") != "" || h.Get("Content-Encoding") != "" {
+		return true
+	}
+	ct := h.Get("Content-Type")
+	return ct != "" && !compressibleType(ct, cw.opts.ContentTypes)
+}
+
+func (cw *compressWriter) compressible() bool {
+	ct := cw.Header().Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(cw.buf.Bytes())
+		cw.Header().Set("Content-Type", ct)
+	}
+	return compressibleType(ct, cw.opts.ContentTypes)
+}
+
+// decide sends the headers and the buffered body, compressed or not.
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoder.Name)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		cw.writer = cw.encoder.New(cw.ResponseWriter, cw.encoder.Level)
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if cw.buf.Len() > 0 {
+		_, _ = cw.out().Write(cw.buf.Bytes())
+		cw.buf.Reset()
+	}
+}
+
+func (cw *compressWriter) out() io.Writer {
+	if cw.writer != nil {
+		return cw.writer
+	}
+	return cw.ResponseWriter
+}
+
+// Flush sends what was written so far. Flushing before the body was
+// classified means the handler streams, so the response stays uncompressed.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(false)
+	}
+	if f, ok := cw.writer.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("compress: response writer does not support hijacking")
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && cw.buf.Len() == 0 {
+			return
+		}
+		// The body stayed under MinSize.
+		cw.decide(false)
+	}
+	if c, ok := cw.writer.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
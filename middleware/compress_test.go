@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func compressCall(t *testing.T, mw func(http.Handler) http.Handler, acceptEncoding string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	mw(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func writeBody(contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		io.WriteString(w, body)
+	}
+}
+
+func TestCompressWithThresholdAndTypes(t *testing.T) {
+	mw := CompressWith(CompressOptions{MinSize: 100})
+	large := strings.Repeat(`{"k":"value"}`, 20)
+
+	rec := compressCall(t, mw, "gzip", writeBody("application/json", large))
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large JSON not compressed: %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != large {
+		t.Errorf("decompressed body = %q", body)
+	}
+	if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+		t.Error("missing Vary header")
+	}
+
+	rec = compressCall(t, mw, "gzip", writeBody("application/json", `{"k":1}`))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != `{"k":1}` {
+		t.Errorf("small body compressed: %v %q", rec.Header(), rec.Body)
+	}
+
+	rec = compressCall(t, mw, "gzip", writeBody("image/png", large))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != large {
+		t.Error("image compressed")
+	}
+
+	rec = compressCall(t, mw, "gzip", writeBody("", "<!doctype html><p>"+large))
+	if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("sniffed HTML: %v", rec.Header())
+	}
+
+	rec = compressCall(t, mw, "gzip;q=0, deflate", writeBody("text/plain", large))
+	if rec.Header().Get("Content-Encoding") != "deflate" {
+		t.Errorf("q=0 ignored: %v", rec.Header())
+	}
+
+	rec = compressCall(t, mw, "", writeBody("text/plain", large))
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Error("compressed without Accept-Encoding")
+	}
+}
+
+func TestCompressWithPreferredEncoder(t *testing.T) {
+	var level int
+	br := CompressEncoder{Name: "br", Level: 9, New: func(w io.Writer, l int) io.Writer {
+		level = l
+		return w
+	}}
+	mw := CompressWith(CompressOptions{MinSize: -1, Encoders: []CompressEncoder{br}})
+
+	rec := compressCall(t, mw, "gzip, deflate, br", writeBody("text/plain", "hello"))
+	if rec.Header().Get("Content-Encoding") != "br" || level != 9 {
+		t.Errorf("encoding %q level %d", rec.Header().Get("Content-Encoding"), level)
+	}
+	rec = compressCall(t, mw, "gzip", writeBody("text/plain", "hello"))
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("fallback encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressWithSkipsStreams(t *testing.T) {
+	mw := CompressWith(CompressOptions{MinSize: 100})
+
+	rec := compressCall(t, mw, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: one\n\n")
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	})
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "data: one\n\n" || !rec.Flushed {
+		t.Errorf("event stream: %v %q flushed=%v", rec.Header(), rec.Body, rec.Flushed)
+	}
+
+	rec = compressCall(t, mw, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "chunk")
+		http.NewResponseController(w).Flush()
+		io.WriteString(w, strings.Repeat("x", 200))
+	})
+	if rec.Header().Get("Content-Encoding") != "" || !rec.Flushed || rec.Body.Len() != 205 {
+		t.Errorf("flushed response: %v len %d", rec.Header(), rec.Body.Len())
+	}
+
+	rec = compressCall(t, mw, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("no content: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = compressCall(t, mw, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status without body: %d", rec.Code)
+	}
+}
+
+func TestCompressWithSkipsPartialContent(t *testing.T) {
+	content := strings.NewReader(strings.Repeat("id,name\n1,Ada Lovelace\n", 500))
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		http.ServeContent(w, r, "export.csv", time.Time{}, content)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-1999")
+	rec := httptest.NewRecorder()
+	CompressWith(CompressOptions{})(http.HandlerFunc(handler)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 2000 {
+		t.Errorf("partial response compressed: %v, %d bytes", rec.Header(), rec.Body.Len())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Range"), "bytes 0-1999/") {
+		t.Errorf("Content-Range = %q", rec.Header().Get("Content-Range"))
+	}
+}
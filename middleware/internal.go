@@ -3,7 +3,8 @@ package middleware
 import (
 	"net"
 	"net/http"
-	"strings"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
 )
 
 // InternalOnly returns a middleware that restricts access to requests from
@@ -35,8 +36,9 @@ func InternalOnly() func(http.Handler) http.Handler {
 // AllowFromNetworks returns a middleware that restricts access to requests
 // originating from the specified CIDR networks.
 //
-// This middleware respects X-Forwarded-For and X-Real-IP headers when present,
-// checking the originating client IP rather than just the immediate connection.
+// Behind proxies, place it after ClientIP with the proxies trusted, so the
+// originating client IP is checked rather than the immediate connection;
+// forwarding headers are never believed on their own.
 //
 // Example usage:
 //
@@ -71,35 +73,11 @@ func AllowFromNetworks(networks ...*net.IPNet) func(http.Handler) http.Handler {
 	}
 }
 
-// extractClientIP extracts the real client IP from the request, checking
-// X-Forwarded-For and X-Real-IP headers before falling back to RemoteAddr.
+// extractClientIP returns the client address resolved by the ClientIP
+// middleware, or the connection peer. Forwarding headers are not read here,
+// so a client cannot claim an allowed address.
 func extractClientIP(r *http.Request) net.IP {
-	// Check X-Forwarded-For (can be a comma-separated list)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		// Take the first (leftmost) IP as the original client
-		if len(ips) > 0 {
-			ip := strings.TrimSpace(ips[0])
-			if parsed := net.ParseIP(ip); parsed != nil {
-				return parsed
-			}
-		}
-	}
-
-	// Check X-Real-IP
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		if parsed := net.ParseIP(xri); parsed != nil {
-			return parsed
-		}
-	}
-
-	// Fall back to RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		// RemoteAddr might not have a port
-		host = r.RemoteAddr
-	}
-	return net.ParseIP(host)
+	return net.ParseIP(aqmctx.ClientIP(r))
 }
 
 // parseCIDR is a helper that panics on invalid CIDR (for compile-time constants).
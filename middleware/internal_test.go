@@ -4,7 +4,10 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
 )
 
 func TestInternalOnly(t *testing.T) {
@@ -147,32 +150,6 @@ func TestAllowFromNetworksMultiple(t *testing.T) {
 	}
 }
 
-func TestExtractClientIPXForwardedFor(t *testing.T) {
-	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Set("X-Forwarded-For", "203.0.113.1, 10.0.0.1")
-	req.RemoteAddr = "127.0.0.1:12345"
-
-	ip := extractClientIP(req)
-
-	expected := net.ParseIP("203.0.113.1")
-	if !ip.Equal(expected) {
-		t.Errorf("extractClientIP = %v, want %v", ip, expected)
-	}
-}
-
-func TestExtractClientIPXRealIP(t *testing.T) {
-	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Set("X-Real-IP", "203.0.113.2")
-	req.RemoteAddr = "127.0.0.1:12345"
-
-	ip := extractClientIP(req)
-
-	expected := net.ParseIP("203.0.113.2")
-	if !ip.Equal(expected) {
-		t.Errorf("extractClientIP = %v, want %v", ip, expected)
-	}
-}
-
 func TestExtractClientIPRemoteAddr(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", nil)
 	req.RemoteAddr = "192.168.1.100:54321"
@@ -271,17 +248,48 @@ func TestParseCIDRPanic(t *testing.T) {
 	parseCIDR("invalid")
 }
 
-func TestXForwardedForPriority(t *testing.T) {
+func TestExtractClientIPIgnoresForwardingHeaders(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	req.Header.Set("X-Forwarded-For", "203.0.113.1, 10.0.0.1")
 	req.Header.Set("X-Real-IP", "203.0.113.2")
 	req.RemoteAddr = "127.0.0.1:12345"
 
-	ip := extractClientIP(req)
+	if ip := extractClientIP(req); !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("extractClientIP = %v, want the peer", ip)
+	}
 
-	// X-Forwarded-For should take priority
-	expected := net.ParseIP("203.0.113.1")
-	if !ip.Equal(expected) {
-		t.Errorf("extractClientIP = %v, want %v (X-Forwarded-For should take priority)", ip, expected)
+	req = req.WithContext(aqmctx.WithClientIP(req.Context(), "203.0.113.1"))
+	if ip := extractClientIP(req); !ip.Equal(net.ParseIP("203.0.113.1")) {
+		t.Errorf("extractClientIP = %v, want the resolved client", ip)
+	}
+}
+
+func TestAllowFromNetworksBehindTrustedProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrapped := ClientIP(netip.MustParsePrefix("10.0.0.0/8"))(AllowFromNetworks(parseCIDR("192.168.0.0/16"))(handler))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantStatus int
+	}{
+		{"forwarded by trusted proxy", "10.0.0.2:12345", "203.0.113.1, 192.168.1.5", http.StatusOK},
+		{"spoofed leftmost entry", "10.0.0.2:12345", "192.168.1.5, 203.0.113.1", http.StatusForbidden},
+		{"header from untrusted peer", "203.0.113.9:12345", "192.168.1.5", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			rec := httptest.NewRecorder()
+			wrapped.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
 	}
 }
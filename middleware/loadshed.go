@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+// AdaptiveInFlightOptions configures AdaptiveMaxInFlight.
+type AdaptiveInFlightOptions struct {
+	MinLimit      int           // lower bound for the concurrency limit (default 1)
+	MaxLimit      int           // upper bound for the concurrency limit (default 100)
+	QueueLen      int           // requests allowed to wait for a slot
+	QueueTimeout  time.Duration // how long a queued request waits before being shed
+	TargetLatency time.Duration // latency the limiter steers towards (default 250ms)
+}
+
+// MaxInFlight bounds the number of requests processed concurrently to n.
+// Up to queueLen additional requests wait at most timeout for a free slot;
+// anything beyond that is shed with 503 Service Unavailable and a Retry-After
+// header so well-behaved clients back off.
+//
+// Unlike per-client rate limits this protects the service as a whole during
+// traffic spikes. It is NOT part of the default stack.
+func MaxInFlight(n, queueLen int, timeout time.Duration) func(http.Handler) http.Handler {
+	if n <= 0 {
+		n = 1
+	}
+	limiter := newInFlightLimiter(n, queueLen)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.acquire(r.Context(), timeout) {
+				shed(w, timeout)
+				return
+			}
+			defer limiter.release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdaptiveMaxInFlight behaves like MaxInFlight but tunes the concurrency limit
+// using additive-increase/multiplicative-decrease against a latency target:
+// the limit grows while the smoothed latency stays under TargetLatency and
+// shrinks by 10% when it is exceeded.
+func AdaptiveMaxInFlight(opts AdaptiveInFlightOptions) func(http.Handler) http.Handler {
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = 100
+		if opts.MaxLimit < opts.MinLimit {
+			opts.MaxLimit = opts.MinLimit
+		}
+	}
+	if opts.TargetLatency <= 0 {
+		opts.TargetLatency = 250 * time.Millisecond
+	}
+	limiter := newInFlightLimiter(opts.MaxLimit, opts.QueueLen)
+	tuner := &latencyTuner{opts: opts, limiter: limiter, limit: float64(opts.MaxLimit)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.acquire(r.Context(), opts.QueueTimeout) {
+				shed(w, opts.QueueTimeout)
+				return
+			}
+			start := time.Now()
+			defer func() {
+				limiter.release()
+				tuner.observe(time.Since(start))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func shed(w http.ResponseWriter, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	aqm.Error(w, http.StatusServiceUnavailable, "overloaded", "server is at capacity, retry later")
+}
+
+// inFlightLimiter is a resizable semaphore with a bounded FIFO wait queue.
+type inFlightLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	queueLen int
+	waiters  list.List
+}
+
+func newInFlightLimiter(limit, queueLen int) *inFlightLimiter {
+	if queueLen < 0 {
+		queueLen = 0
+	}
+	return &inFlightLimiter{limit: limit, queueLen: queueLen}
+}
+
+func (l *inFlightLimiter) acquire(ctx context.Context, timeout time.Duration) bool {
+	l.mu.Lock()
+	if l.inFlight < l.limit && l.waiters.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if l.waiters.Len() >= l.queueLen || timeout <= 0 {
+		l.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-ready:
+		// Granted while timing out; hand the slot back.
+		l.inFlight--
+		l.grantLocked()
+	default:
+		l.waiters.Remove(elem)
+	}
+	return false
+}
+
+func (l *inFlightLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.grantLocked()
+	l.mu.Unlock()
+}
+
+func (l *inFlightLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	l.limit = limit
+	l.grantLocked()
+	l.mu.Unlock()
+}
+
+func (l *inFlightLimiter) grantLocked() {
+	for l.inFlight < l.limit && l.waiters.Len() > 0 {
+		front := l.waiters.Front()
+		l.waiters.Remove(front)
+		l.inFlight++
+		close(front.Value.(chan struct{}))
+	}
+}
+
+type latencyTuner struct {
+	mu      sync.Mutex
+	opts    AdaptiveInFlightOptions
+	limiter *inFlightLimiter
+	limit   float64
+	ewma    float64
+}
+
+func (t *latencyTuner) observe(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sample := float64(latency)
+	if t.ewma == 0 {
+		t.ewma = sample
+	} else {
+		t.ewma = 0.8*t.ewma + 0.2*sample
+	}
+
+	if t.ewma > float64(t.opts.TargetLatency) {
+		t.limit = math.Max(float64(t.opts.MinLimit), t.limit*0.9)
+	} else {
+		t.limit = math.Min(float64(t.opts.MaxLimit), t.limit+1)
+	}
+	t.limiter.setLimit(int(t.limit))
+}
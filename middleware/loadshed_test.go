@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+func TestMaxInFlightShedsExcessLoad(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	handler := MaxInFlight(1, 0, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+	}
+	var body aqm.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code != "overloaded" {
+		t.Errorf("expected the standard error envelope, got %+v (%v)", body, err)
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+func TestMaxInFlightQueuesBriefly(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := MaxInFlight(1, 1, time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes <- rec.Code
+		}()
+	}
+	<-started
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expected queued request to succeed, got %d", code)
+		}
+	}
+}
+
+func TestInFlightLimiterTimeout(t *testing.T) {
+	limiter := newInFlightLimiter(1, 1)
+	if !limiter.acquire(context.Background(), time.Second) {
+		t.Fatal("expected first acquire to succeed")
+	}
+	if limiter.acquire(context.Background(), 10*time.Millisecond) {
+		t.Fatal("expected queued acquire to time out")
+	}
+	if limiter.waiters.Len() != 0 {
+		t.Errorf("expected waiter to be removed, got %d", limiter.waiters.Len())
+	}
+	limiter.release()
+	if limiter.inFlight != 0 {
+		t.Errorf("expected no requests in flight, got %d", limiter.inFlight)
+	}
+}
+
+func TestLatencyTunerAdjustsLimit(t *testing.T) {
+	opts := AdaptiveInFlightOptions{MinLimit: 2, MaxLimit: 10, TargetLatency: 10 * time.Millisecond}
+	limiter := newInFlightLimiter(opts.MaxLimit, 0)
+	tuner := &latencyTuner{opts: opts, limiter: limiter, limit: float64(opts.MaxLimit)}
+
+	for i := 0; i < 50; i++ {
+		tuner.observe(100 * time.Millisecond)
+	}
+	if limiter.limit != opts.MinLimit {
+		t.Errorf("expected limit to shrink to %d, got %d", opts.MinLimit, limiter.limit)
+	}
+
+	for i := 0; i < 100; i++ {
+		tuner.observe(time.Millisecond)
+	}
+	if limiter.limit != opts.MaxLimit {
+		t.Errorf("expected limit to recover to %d, got %d", opts.MaxLimit, limiter.limit)
+	}
+}
+
+func TestAdaptiveMaxInFlight(t *testing.T) {
+	handler := AdaptiveMaxInFlight(AdaptiveInFlightOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
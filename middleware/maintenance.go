@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+// MaintenanceFlag reports whether maintenance mode is on. It is consulted
+// on every request, so switching it takes effect without a redeploy.
+type MaintenanceFlag interface {
+	Enabled(ctx context.Context) bool
+}
+
+// MaintenanceFlagFunc adapts a function to MaintenanceFlag, e.g. a feature
+// flag lookup.
+type MaintenanceFlagFunc func(ctx context.Context) bool
+
+// Enabled implements MaintenanceFlag.
+func (f MaintenanceFlagFunc) Enabled(ctx context.Context) bool { return f(ctx) }
+
+// ConfigMaintenanceFlag reads a boolean from cfg at key, so toggling the
+// value with cfg.Set switches maintenance mode.
+func ConfigMaintenanceFlag(cfg *aqm.Config, key string) MaintenanceFlag {
+	return MaintenanceFlagFunc(func(context.Context) bool {
+		return cfg.GetBoolOrFalse(key)
+	})
+}
+
+// MaintenanceSwitch is an in-process MaintenanceFlag. The zero value is off.
+type MaintenanceSwitch struct {
+	on atomic.Bool
+}
+
+// Enabled implements MaintenanceFlag.
+func (s *MaintenanceSwitch) Enabled(context.Context) bool { return s.on.Load() }
+
+// Set turns maintenance mode on or off.
+func (s *MaintenanceSwitch) Set(on bool) { s.on.Store(on) }
+
+// MaintenanceOptions configures MaintenanceModeWith.
+type MaintenanceOptions struct {
+	Message    string             // default "the service is under maintenance"
+	RetryAfter time.Duration      // sent as Retry-After when set
+	Template   *template.Template // HTML page for browsers; executed with MaintenancePage
+	// AllowPaths keep working during maintenance. Entries ending in "/"
+	// match a prefix. Defaults to DefaultMaintenanceAllowPaths.
+	AllowPaths []string
+	// Bypass lets matching requests through, e.g. operators checking the
+	// service before reopening it.
+	Bypass func(r *http.Request) bool
+}
+
+// MaintenancePage is the data the maintenance template is executed with.
+type MaintenancePage struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+// DefaultMaintenanceAllowPaths are the health, metrics and debug endpoints.
+var DefaultMaintenanceAllowPaths = []string{
+	"/healthz", "/livez", "/readyz", "/ping", "/metrics", "/version", "/debug/",
+}
+
+var defaultMaintenanceTemplate = template.Must(template.New("maintenance").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Maintenance</title></head>
+<body><h1>Down for maintenance</h1><p>{{.Message}}</p></body></html>
+`))
+
+// MaintenanceMode answers every request but the health and debug endpoints
+// with 503 while flag is enabled.
+func MaintenanceMode(flag MaintenanceFlag) func(http.Handler) http.Handler {
+	return MaintenanceModeWith(flag, MaintenanceOptions{})
+}
+
+// MaintenanceModeWith answers requests with 503 while flag is enabled,
+// except for opts.AllowPaths and requests accepted by opts.Bypass. Browsers
+// asking for text/html get the HTML page, other clients the maintenance
+// JSON error.
+func MaintenanceModeWith(flag MaintenanceFlag, opts MaintenanceOptions) func(http.Handler) http.Handler {
+	if opts.Message == "" {
+		opts.Message = "the service is under maintenance"
+	}
+	if opts.Template == nil {
+		opts.Template = defaultMaintenanceTemplate
+	}
+	if opts.AllowPaths == nil {
+		opts.AllowPaths = DefaultMaintenanceAllowPaths
+	}
+	page := MaintenancePage{Message: opts.Message, RetryAfter: opts.RetryAfter}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if flag == nil || !flag.Enabled(r.Context()) || maintenanceAllowed(r, opts) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if opts.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(opts.RetryAfter.Round(time.Second).Seconds())))
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				if err := opts.Template.Execute(w, page); err != nil {
+					aqm.LoggerFrom(r.Context()).Error("cannot render maintenance page", "error", err)
+				}
+				return
+			}
+			aqm.Error(w, http.StatusServiceUnavailable, "maintenance", opts.Message)
+		})
+	}
+}
+
+func maintenanceAllowed(r *http.Request, opts MaintenanceOptions) bool {
+	for _, path := range opts.AllowPaths {
+		if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+			return true
+		}
+	}
+	return opts.Bypass != nil && opts.Bypass(r)
+}
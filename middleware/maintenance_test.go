@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	var flag MaintenanceSwitch
+	handler := MaintenanceModeWith(&flag, MaintenanceOptions{
+		RetryAfter: 2 * time.Minute,
+		Bypass:     func(r *http.Request) bool { return r.Header.Get("X-Operator") == "yes" },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	call := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := call("/orders"); rec.Code != http.StatusOK {
+		t.Fatalf("maintenance off: %d", rec.Code)
+	}
+
+	flag.Set(true)
+	rec := call("/orders")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "120" || !strings.Contains(rec.Body.String(), `"maintenance"`) {
+		t.Errorf("JSON: %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+	rec = call("/", "Accept", "text/html,application/xhtml+xml")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "Down for maintenance") {
+		t.Errorf("HTML: %d %s", rec.Code, rec.Body)
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/debug/routes"} {
+		if rec := call(path); rec.Code != http.StatusOK {
+			t.Errorf("%s during maintenance: %d", path, rec.Code)
+		}
+	}
+	if rec := call("/orders", "X-Operator", "yes"); rec.Code != http.StatusOK {
+		t.Errorf("bypass: %d", rec.Code)
+	}
+
+	flag.Set(false)
+	if rec := call("/orders"); rec.Code != http.StatusOK {
+		t.Errorf("maintenance switched off: %d", rec.Code)
+	}
+}
+
+func TestMaintenanceModeConfigFlag(t *testing.T) {
+	cfg := aqm.NewConfig()
+	page := template.Must(template.New("page").Parse(`back at {{.Message}}`))
+	handler := MaintenanceModeWith(ConfigMaintenanceFlag(cfg, "maintenance.enabled"), MaintenanceOptions{
+		Message:  "10:00 UTC",
+		Template: page,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cfg.Set("maintenance.enabled", true)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "back at 10:00 UTC" {
+		t.Errorf("got %d %q", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+// PeerAuthOptions configures PeerAuth.
+type PeerAuthOptions struct {
+	Policy   auth.PeerPolicy // nil admits every verified peer
+	Optional bool            // let requests without a client certificate through
+}
+
+// PeerAuth reads the identity of the verified client certificate, SPIFFE ID
+// and SANs, and stores it with auth.WithPeer. The server must request client
+// certificates (see aqm.WorkloadCertificate.ServerTLSConfig); requests
+// without a verified one are answered with 401 and peers refused by
+// opts.Policy with 403.
+func PeerAuth(opts PeerAuthOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := aqm.PeerIdentityFromTLS(r.TLS)
+			if err != nil {
+				if opts.Optional && (r.TLS == nil || len(r.TLS.PeerCertificates) == 0) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				aqm.Error(w, http.StatusUnauthorized, "peer_unauthenticated", "a verified client certificate is required")
+				return
+			}
+
+			ctx := auth.WithPeer(r.Context(), peer)
+			if opts.Policy != nil && !opts.Policy(ctx, peer) {
+				aqm.LoggerFrom(ctx).Info("peer refused", "peer", peer.String())
+				aqm.Error(w, http.StatusForbidden, "peer_forbidden", "the calling workload is not allowed")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+func TestPeerAuth(t *testing.T) {
+	var seen string
+	handler := PeerAuth(PeerAuthOptions{Policy: auth.AllowSPIFFEIDs("spiffe://prod.example/api")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = auth.PeerFrom(r.Context()).String()
+	}))
+	call := func(state *tls.ConnectionState) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.TLS = state
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	verified := func(id string) *tls.ConnectionState {
+		u, _ := url.Parse(id)
+		cert := &x509.Certificate{URIs: []*url.URL{u}}
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	if code := call(verified("spiffe://prod.example/api")); code != http.StatusOK || seen != "spiffe://prod.example/api" {
+		t.Fatalf("allowed peer: %d, seen %q", code, seen)
+	}
+	if code := call(verified("spiffe://prod.example/worker")); code != http.StatusForbidden {
+		t.Errorf("refused peer: %d", code)
+	}
+	if code := call(nil); code != http.StatusUnauthorized {
+		t.Errorf("plain HTTP: %d", code)
+	}
+	unverified := verified("spiffe://prod.example/api")
+	unverified.VerifiedChains = nil
+	if code := call(unverified); code != http.StatusUnauthorized {
+		t.Errorf("unverified certificate: %d", code)
+	}
+
+	optional := PeerAuth(PeerAuthOptions{Optional: true})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec := httptest.NewRecorder()
+	optional.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("optional without certificate: %d", rec.Code)
+	}
+}
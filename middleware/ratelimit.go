@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+// RateLimitOptions configures RateLimit.
+type RateLimitOptions struct {
+	Policies  aqm.RatePolicyResolver                // required
+	Principal func(*http.Request) aqm.RatePrincipal // default aqm.RatePrincipalFromRequest
+}
+
+// RateLimit counts requests per principal in fixed windows and rejects those
+// over the principal's policy with 429 Too Many Requests in the standard
+// error envelope. Every limited response carries X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the window
+// resets); rejections add Retry-After.
+//
+// Principals are API keys, tenants, users or IPs as chosen by
+// opts.Principal, and their policies come from opts.Policies, e.g.
+// aqm.NewConfigRatePolicies or aqm.NewMongoRatePolicyStore. When the
+// resolver fails the request is let through. Counters are kept in memory, so
+// each instance enforces the limit on its own. It is NOT part of the default
+// stack; place it after the middleware that authenticates requests.
+func RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if opts.Principal == nil {
+		opts.Principal = aqm.RatePrincipalFromRequest
+	}
+	limiter := newRateLimiter()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Policies == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			principal := opts.Principal(r)
+			policy, err := opts.Policies.ResolveRatePolicy(r.Context(), principal)
+			if err != nil || policy.Unlimited() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			remaining, reset, allowed := limiter.take(principal.Key(), policy, time.Now())
+			resetSeconds := strconv.Itoa(int(math.Ceil(reset.Seconds())))
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(policy.Limit))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			h.Set("X-RateLimit-Reset", resetSeconds)
+			if !allowed {
+				h.Set("Retry-After", resetSeconds)
+				aqm.Error(w, http.StatusTooManyRequests, "rate_limited",
+					fmt.Sprintf("rate limit of %d requests per %s exceeded", policy.Limit, policy.Window))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+const rateLimiterSweepEvery = time.Minute
+
+// rateLimiter keeps one fixed-window counter per principal key.
+type rateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start  time.Time
+	length time.Duration
+	count  int
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: make(map[string]*rateWindow), lastSweep: time.Now()}
+}
+
+// take counts a request for key and reports how many remain in the window,
+// the time until it resets and whether the request is allowed.
+func (l *rateLimiter) take(key string, policy aqm.RatePolicy, now time.Time) (int, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimiterSweepEvery {
+		for k, win := range l.windows {
+			if now.Sub(win.start) >= win.length {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	win, ok := l.windows[key]
+	if !ok || now.Sub(win.start) >= policy.Window {
+		win = &rateWindow{start: now}
+		l.windows[key] = win
+	}
+	win.length = policy.Window
+	reset := win.start.Add(policy.Window).Sub(now)
+	if win.count >= policy.Limit {
+		return 0, reset, false
+	}
+	win.count++
+	return policy.Limit - win.count, reset, true
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+func TestRateLimitPerPrincipal(t *testing.T) {
+	policies := aqm.RatePolicyResolverFunc(func(_ context.Context, p aqm.RatePrincipal) (aqm.RatePolicy, error) {
+		if p.Kind == aqm.PrincipalAPIKey && p.ID == "premium" {
+			return aqm.RatePolicy{Limit: 3, Window: time.Minute}, nil
+		}
+		return aqm.RatePolicy{Limit: 1, Window: time.Minute}, nil
+	})
+	keys := APIKeyVerifierFunc(func(_ context.Context, key string) (string, error) {
+		if key == "premium" || key == "basic" {
+			return key, nil
+		}
+		return "", auth.ErrInvalidAPIKey
+	})
+	limited := RateLimit(RateLimitOptions{Policies: policies})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	handler := AuthenticateAPIKey(APIKeyOptions{Verifier: keys, Optional: true})(limited)
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if apiKey != "" {
+			req.Header.Set(aqm.APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		if rec := send("premium"); rec.Code != http.StatusNoContent {
+			t.Fatalf("premium request %d status = %d", i, rec.Code)
+		}
+	}
+	rec := send("premium")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("4th premium request status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("missing rate limit headers: %v", rec.Header())
+	}
+	var body aqm.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code != "rate_limited" {
+		t.Fatalf("body = %+v (%v), want rate_limited envelope", body, err)
+	}
+
+	if rec := send("basic"); rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Fatalf("basic key should have its own counter, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := send("basic"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second basic request status = %d, want 429", rec.Code)
+	}
+
+	// Without the verifying middleware a fresh key per request must not
+	// earn a fresh counter: the requests are counted against the client IP.
+	for i, key := range []string{"k1", "k2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(aqm.APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		limited.ServeHTTP(rec, req)
+		if want := []int{http.StatusNoContent, http.StatusTooManyRequests}[i]; rec.Code != want {
+			t.Fatalf("unverified key %s status = %d, want %d", key, rec.Code, want)
+		}
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	policies := aqm.RatePolicyResolverFunc(func(context.Context, aqm.RatePrincipal) (aqm.RatePolicy, error) {
+		return aqm.RatePolicy{}, errors.New("store down")
+	})
+	handler := RateLimit(RateLimitOptions{Policies: policies})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", rec.Code)
+		}
+	}
+}
+
+func TestRateLimiterWindowReset(t *testing.T) {
+	l := newRateLimiter()
+	policy := aqm.RatePolicy{Limit: 2, Window: time.Second}
+	now := time.Now()
+
+	l.take("k", policy, now)
+	if remaining, _, ok := l.take("k", policy, now); !ok || remaining != 0 {
+		t.Fatalf("second take = %d, %v; want 0, true", remaining, ok)
+	}
+	if _, reset, ok := l.take("k", policy, now.Add(500*time.Millisecond)); ok || reset != 500*time.Millisecond {
+		t.Fatalf("third take allowed=%v reset=%s; want rejected with 500ms", ok, reset)
+	}
+	if remaining, _, ok := l.take("k", policy, now.Add(time.Second)); !ok || remaining != 1 {
+		t.Fatalf("take after window = %d, %v; want 1, true", remaining, ok)
+	}
+
+	l.take("stale", policy, now)
+	l.take("k", policy, now.Add(2*rateLimiterSweepEvery))
+	if _, ok := l.windows["stale"]; ok {
+		t.Fatal("expired windows should be swept")
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+// Values of RedirectOptions.TrailingSlash.
+const (
+	TrailingAdd   = "add"
+	TrailingStrip = "strip"
+)
+
+// RedirectOptions configures Redirects. It binds from config, e.g.
+// aqm.BindEnv[middleware.RedirectOptions](cfg, "http.redirect").
+type RedirectOptions struct {
+	// HTTPS redirects plain HTTP requests to https.
+	HTTPS bool `koanf:"https"`
+	// CanonicalHost replaces any other request host, e.g. "example.com" or
+	// "www.example.com". It is required: redirect targets are never built
+	// from the client supplied Host or X-Forwarded-Host.
+	CanonicalHost string `koanf:"canonical_host" validate:"required"`
+	// TrailingSlash adds or strips the trailing slash of paths; "/" is
+	// never changed.
+	TrailingSlash string `koanf:"trailing_slash" validate:"oneof=add strip"`
+	// TrustForwarded reads the scheme and host from X-Forwarded-Proto and
+	// X-Forwarded-Host, as set by the ingress in front of the service.
+	TrustForwarded bool `koanf:"trust_forwarded"`
+	// SkipPaths are left alone, so load balancer probes over plain HTTP keep
+	// working. Entries ending in "/" match a prefix.
+	SkipPaths []string `koanf:"skip_paths" default:"/healthz,/livez,/readyz,/ping"`
+	// Status is the redirect status for GET and HEAD, default 301. Other
+	// methods get 308 so the body is replayed.
+	Status int `koanf:"status" default:"301"`
+}
+
+// RedirectOptionsFromConfig binds RedirectOptions from the config subtree at
+// path.
+func RedirectOptionsFromConfig(cfg *aqm.Config, path string) (RedirectOptions, error) {
+	return aqm.BindEnv[RedirectOptions](cfg, path)
+}
+
+// Redirects sends requests to their canonical URL: https, the canonical host
+// and the configured trailing slash form, in a single redirect. Register it
+// before routing (router.Use or WithHTTPMiddleware) so every ingress ends up
+// on the same URLs. The query string is kept. Without a CanonicalHost the
+// middleware never redirects.
+func Redirects(opts RedirectOptions) func(http.Handler) http.Handler {
+	if opts.Status == 0 {
+		opts.Status = http.StatusMovedPermanently
+	}
+	return func(next http.Handler) http.Handler {
+		if opts.CanonicalHost == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target, ok := canonicalURL(r, opts)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			status := opts.Status
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				status = http.StatusPermanentRedirect
+			}
+			http.Redirect(w, r, target, status)
+		})
+	}
+}
+
+// canonicalURL returns the URL r should be redirected to, if any.
+func canonicalURL(r *http.Request, opts RedirectOptions) (string, bool) {
+	for _, path := range opts.SkipPaths {
+		if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+			return "", false
+		}
+	}
+
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if opts.TrustForwarded {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme, _, _ = strings.Cut(proto, ",")
+			scheme = strings.ToLower(strings.TrimSpace(scheme))
+		}
+		if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+			host, _, _ = strings.Cut(fwd, ",")
+			host = strings.TrimSpace(host)
+		}
+	}
+	host = strings.ToLower(host)
+	origScheme, origHost, path := scheme, host, r.URL.Path
+
+	if opts.HTTPS {
+		scheme = "https"
+	}
+	host = strings.ToLower(opts.CanonicalHost)
+	if path != "/" && path != "" {
+		switch opts.TrailingSlash {
+		case TrailingAdd:
+			if !strings.HasSuffix(path, "/") && !strings.Contains(path[strings.LastIndex(path, "/"):], ".") {
+				path += "/"
+			}
+		case TrailingStrip:
+			path = strings.TrimRight(path, "/")
+			if path == "" {
+				path = "/"
+			}
+		}
+	}
+
+	if scheme == origScheme && host == origHost && path == r.URL.Path {
+		return "", false
+	}
+	target := scheme + "://" + host + escapePath(r, path)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	return target, true
+}
+
+// escapePath keeps the original escaping of r when the path is unchanged
+// apart from its trailing slash.
+func escapePath(r *http.Request, path string) string {
+	escaped := r.URL.EscapedPath()
+	switch {
+	case path == r.URL.Path:
+		return escaped
+	case path == r.URL.Path+"/":
+		return escaped + "/"
+	case strings.TrimRight(r.URL.Path, "/") == path:
+		if trimmed := strings.TrimRight(escaped, "/"); trimmed != "" {
+			return trimmed
+		}
+	}
+	return path
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+func TestRedirects(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     RedirectOptions
+		method   string
+		target   string
+		tls      bool
+		headers  map[string]string
+		status   int
+		location string
+	}{
+		{name: "https", opts: RedirectOptions{CanonicalHost: "example.com", HTTPS: true}, target: "http://example.com:80/a?x=1", status: 301, location: "https://example.com/a?x=1"},
+		{name: "already https", opts: RedirectOptions{CanonicalHost: "example.com", HTTPS: true}, target: "https://example.com/a", tls: true, status: 200},
+		{name: "forwarded proto", opts: RedirectOptions{CanonicalHost: "example.com", HTTPS: true, TrustForwarded: true}, target: "http://example.com/a", headers: map[string]string{"X-Forwarded-Proto": "https"}, status: 200},
+		{name: "canonical host", opts: RedirectOptions{CanonicalHost: "example.com"}, target: "http://app.ingress.local/a", status: 301, location: "http://example.com/a"},
+		{name: "canonical www", opts: RedirectOptions{CanonicalHost: "www.example.com"}, target: "http://example.com/a", status: 301, location: "http://www.example.com/a"},
+		{name: "forwarded host", opts: RedirectOptions{CanonicalHost: "example.com", TrustForwarded: true}, target: "http://pod:8080/a", headers: map[string]string{"X-Forwarded-Host": "example.com"}, status: 200},
+		{name: "spoofed forwarded host", opts: RedirectOptions{CanonicalHost: "example.com", TrustForwarded: true}, target: "http://example.com/a", headers: map[string]string{"X-Forwarded-Host": "evil.test"}, status: 301, location: "http://example.com/a"},
+		{name: "strip slash", opts: RedirectOptions{CanonicalHost: "example.com", TrailingSlash: TrailingStrip}, target: "http://example.com/docs/", status: 301, location: "http://example.com/docs"},
+		{name: "add slash", opts: RedirectOptions{CanonicalHost: "example.com", TrailingSlash: TrailingAdd}, target: "http://example.com/docs", status: 301, location: "http://example.com/docs/"},
+		{name: "add slash skips files", opts: RedirectOptions{CanonicalHost: "example.com", TrailingSlash: TrailingAdd}, target: "http://example.com/app.css", status: 200},
+		{name: "root untouched", opts: RedirectOptions{CanonicalHost: "example.com", TrailingSlash: TrailingStrip}, target: "http://example.com/", status: 200},
+		{name: "single redirect", opts: RedirectOptions{CanonicalHost: "example.com", HTTPS: true, TrailingSlash: TrailingStrip}, target: "http://www.example.com/a%20b/", status: 301, location: "https://example.com/a%20b"},
+		{name: "post keeps method", opts: RedirectOptions{CanonicalHost: "example.com", HTTPS: true}, method: http.MethodPost, target: "http://example.com/a", status: 308, location: "https://example.com/a"},
+		{name: "skip path", opts: RedirectOptions{CanonicalHost: "example.com", HTTPS: true, SkipPaths: []string{"/healthz"}}, target: "http://example.com/healthz", status: 200},
+		{name: "no canonical host", opts: RedirectOptions{HTTPS: true, TrailingSlash: TrailingStrip}, target: "http://evil.test/a/", status: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Redirects(tt.opts)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			} else {
+				req.TLS = nil
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status || rec.Header().Get("Location") != tt.location {
+				t.Errorf("got %d %q, want %d %q", rec.Code, rec.Header().Get("Location"), tt.status, tt.location)
+			}
+		})
+	}
+}
+
+func TestRedirectOptionsFromConfig(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.MergeNested(map[string]any{"http": map[string]any{"redirect": map[string]any{
+		"https": true, "canonical_host": "example.com", "trailing_slash": "strip",
+	}}})
+	opts, err := RedirectOptionsFromConfig(cfg, "http.redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.HTTPS || opts.CanonicalHost != "example.com" || opts.TrailingSlash != TrailingStrip || opts.Status != 301 || len(opts.SkipPaths) != 4 {
+		t.Errorf("opts = %+v", opts)
+	}
+
+	cfg.Set("http.redirect.trailing_slash", "sometimes")
+	if _, err := RedirectOptionsFromConfig(cfg, "http.redirect"); err == nil {
+		t.Error("invalid trailing slash mode accepted")
+	}
+
+	cfg.Set("http.redirect.trailing_slash", "strip")
+	cfg.Set("http.redirect.canonical_host", "")
+	if _, err := RedirectOptionsFromConfig(cfg, "http.redirect"); err == nil {
+		t.Error("missing canonical host accepted")
+	}
+}
@@ -1,12 +1,17 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmctx"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
@@ -14,21 +19,47 @@ import (
 type StackOptions struct {
 	Logger              aqm.Logger
 	Metrics             aqm.Metrics
+	MetricsRouteLabels  []aqm.RouteLabelOption // path label tuning for Metrics
 	Errors              aqm.ErrorReporter
+	Redactor            *aqm.Redactor // scrubs Logger and Errors fields when set
+	ExposeTraceID       bool          // return the trace ID in X-Trace-Id
 	TimeoutDuration     time.Duration // default 60s if 0
 	DisableTimeout      bool          // explicit opt-out
 	CompressLevel       int
+	CompressOptions     *CompressOptions // nil = CompressLevel with defaults
 	AllowedContentTypes []string
+	TrustedProxies      []netip.Prefix // proxies whose forwarding headers are believed, see TrustedProxiesFromConfig
 	DisableCORS         bool // disable CORS middleware
 	CORSOptions         *CORSOptions // nil = use defaults
 }
 
 // DefaultStack wires the recommended middleware order for aqm services.
+//
+// Client addresses are resolved by ClientIP, which replaced RealIP: the
+// X-Forwarded-For and X-Real-IP headers are only believed from
+// opts.TrustedProxies. This is a breaking change for services behind a load
+// balancer or ingress; without their addresses in http.trusted_proxies (see
+// TrustedProxiesFromConfig) every request appears to come from the proxy,
+// and per-IP rate limits and lockouts apply to all clients at once.
 func DefaultStack(opts StackOptions) []func(http.Handler) http.Handler {
+	if opts.Redactor != nil {
+		opts.Logger = aqm.RedactLogger(normalizeLogger(opts.Logger), opts.Redactor)
+		if opts.Errors != nil {
+			opts.Errors = aqm.RedactErrorReporter(opts.Errors, opts.Redactor)
+		}
+	}
+
+	compress := CompressOptions{Level: opts.CompressLevel}
+	if opts.CompressOptions != nil {
+		compress = *opts.CompressOptions
+	}
+
 	stack := []func(http.Handler) http.Handler{
 		RequestID(),
-		RealIP(),
-		Compress(opts.CompressLevel),
+		Trace(opts.ExposeTraceID),
+		ContextLogger(opts.Logger),
+		ClientIP(opts.TrustedProxies...),
+		CompressWith(compress),
 		Recoverer(),
 		ErrorReporter(opts.Errors),
 	}
@@ -44,7 +75,7 @@ func DefaultStack(opts StackOptions) []func(http.Handler) http.Handler {
 
 	stack = append(stack,
 		RequestLogger(opts.Logger),
-		Metrics(opts.Metrics),
+		Metrics(opts.Metrics, opts.MetricsRouteLabels...),
 		AllowContentType(opts.AllowedContentTypes...),
 	)
 
@@ -66,17 +97,59 @@ func RequestID() func(http.Handler) http.Handler {
 	return aqm.RequestIDMiddleware
 }
 
+// Trace joins the trace of the incoming traceparent header or starts one,
+// so logs, error reports and outgoing client calls share its IDs.
+func Trace(expose bool) func(http.Handler) http.Handler {
+	return aqm.TraceMiddleware(expose)
+}
+
 // RealIP resolves the actual remote IP when behind proxies/load balancers.
+// It believes the forwarding headers of any client; prefer ClientIP.
 func RealIP() func(http.Handler) http.Handler {
 	return chimiddleware.RealIP
 }
 
-// Compress enables gzip compression.
-func Compress(level int) func(http.Handler) http.Handler {
-	if level <= 0 {
-		level = 5
+// ClientIP resolves the client address with aqmctx.ResolveClientIP and
+// stores it for aqmctx.ClientIP. Forwarding headers are only believed from
+// the trusted proxies; behind them RemoteAddr is rewritten to the client
+// address as RealIP does. Unlike RealIP, a client connecting directly
+// cannot choose its address.
+func ClientIP(trusted ...netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := aqmctx.ResolveClientIP(r, trusted)
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && host != ip {
+				r.RemoteAddr = net.JoinHostPort(ip, "0")
+			}
+			next.ServeHTTP(w, r.WithContext(aqmctx.WithClientIP(r.Context(), ip)))
+		})
+	}
+}
+
+// TrustedProxiesFromConfig parses http.trusted_proxies, the CIDRs or
+// addresses of the load balancers and proxies in front of the service, for
+// StackOptions.TrustedProxies.
+func TrustedProxiesFromConfig(cfg *aqm.Config) ([]netip.Prefix, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	var proxies []netip.Prefix
+	for _, entry := range cfg.GetStringSliceOrDef("http.trusted_proxies", nil) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("http.trusted_proxies: invalid address or CIDR %q", entry)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
 	}
-	return chimiddleware.Compress(level)
+	return proxies, nil
 }
 
 // Recoverer prevents panics from tearing down the server.
@@ -85,7 +158,10 @@ func Recoverer() func(http.Handler) http.Handler {
 }
 
 // Timeout aborts requests that exceed the configured duration.
-// A duration of 0 means no timeout (infinite).
+// A duration of 0 means no timeout (infinite). A shorter deadline propagated
+// by the caller through aqm.RequestTimeoutHeader takes precedence, and routes
+// wrapped with aqm.WithRouteTimeout may only shorten it. A 504 is only written
+// when the handler produced no response before the deadline.
 func Timeout(duration time.Duration) func(http.Handler) http.Handler {
 	if duration == 0 {
 		// No timeout - return passthrough middleware
@@ -93,7 +169,28 @@ func Timeout(duration time.Duration) func(http.Handler) http.Handler {
 			return next
 		}
 	}
-	return chimiddleware.Timeout(duration)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := duration
+			if propagated, ok := aqm.ParseRequestTimeout(r); ok && propagated < timeout {
+				timeout = propagated
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			recorder := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				cancel()
+				if ctx.Err() == context.DeadlineExceeded && recorder.Status() == 0 {
+					recorder.WriteHeader(http.StatusGatewayTimeout)
+				}
+			}()
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+		})
+	}
+}
+
+// ContextLogger makes a request-scoped logger available via aqm.LoggerFrom.
+func ContextLogger(logger aqm.Logger) func(http.Handler) http.Handler {
+	return aqm.LoggerMiddleware(normalizeLogger(logger))
 }
 
 // RequestLogger emits structured request lifecycle logs.
@@ -102,10 +199,12 @@ func RequestLogger(logger aqm.Logger) func(http.Handler) http.Handler {
 }
 
 // Metrics publishes request counters and latencies using the shared Metrics.
-func Metrics(metrics aqm.Metrics) func(http.Handler) http.Handler {
+// The path label is the chi route pattern, see aqm.RouteLabeler.
+func Metrics(metrics aqm.Metrics, opts ...aqm.RouteLabelOption) func(http.Handler) http.Handler {
 	if metrics == nil {
 		metrics = aqm.NoopMetrics{}
 	}
+	labeler := aqm.NewRouteLabeler(opts...)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			recorder := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
@@ -114,7 +213,7 @@ func Metrics(metrics aqm.Metrics) func(http.Handler) http.Handler {
 
 			labels := map[string]string{
 				"method": r.Method,
-				"path":   r.URL.Path,
+				"path":   labeler.Label(r),
 				"status": strconv.Itoa(recorder.Status()),
 			}
 			metrics.Counter(r.Context(), "http_requests_total", 1, labels)
@@ -172,6 +271,9 @@ func errorFields(r *http.Request, status int) map[string]any {
 	if status != 0 {
 		fields["status"] = status
 	}
+	if tc, ok := aqm.TraceFrom(r.Context()); ok {
+		fields["trace_id"], fields["span_id"] = tc.TraceID, tc.SpanID
+	}
 	return fields
 }
 
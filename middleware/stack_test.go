@@ -5,10 +5,13 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
 
 	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/aqmtest"
 )
 
 func TestDefaultStack(t *testing.T) {
@@ -116,6 +119,61 @@ func TestRealIP(t *testing.T) {
 	}
 }
 
+func TestClientIP(t *testing.T) {
+	var got, remote string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = aqmctx.ClientIP(r)
+		remote = r.RemoteAddr
+	})
+	wrapped := ClientIP(netip.MustParsePrefix("10.0.0.0/8"))(handler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.7" || remote != "198.51.100.7:0" {
+		t.Errorf("trusted proxy: got ip %q, remote %q", got, remote)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "203.0.113.9" || remote != "203.0.113.9:4000" {
+		t.Errorf("untrusted peer: got ip %q, remote %q", got, remote)
+	}
+}
+
+func TestTrustedProxiesFromConfig(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.Set("http.trusted_proxies", []any{"10.0.0.0/8", "192.168.1.7", "10.1.2.3/16"})
+	proxies, err := TrustedProxiesFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.7/32"),
+		netip.MustParsePrefix("10.1.0.0/16"),
+	}
+	if len(proxies) != len(want) {
+		t.Fatalf("proxies = %v, want %v", proxies, want)
+	}
+	for i := range want {
+		if proxies[i] != want[i] {
+			t.Errorf("proxy %d = %v, want %v", i, proxies[i], want[i])
+		}
+	}
+
+	cfg.Set("http.trusted_proxies", "10.0.0.0/8, lb.internal")
+	if _, err := TrustedProxiesFromConfig(cfg); err == nil {
+		t.Error("expected an error for a host name")
+	}
+	if proxies, err := TrustedProxiesFromConfig(aqm.NewConfig()); err != nil || len(proxies) != 0 {
+		t.Errorf("unset key = %v, %v", proxies, err)
+	}
+}
+
 func TestCompress(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("test response"))
@@ -497,3 +555,127 @@ func TestStackOptionsFields(t *testing.T) {
 		t.Error("DisableCORS not set correctly")
 	}
 }
+
+func TestTimeoutHonoursPropagatedDeadline(t *testing.T) {
+	var remaining time.Duration
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining, _ = aqm.RemainingTimeout(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(aqm.RequestTimeoutHeader, "100")
+	Timeout(time.Minute)(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if remaining <= 0 || remaining > 100*time.Millisecond {
+		t.Errorf("expected propagated 100ms deadline, got %v", remaining)
+	}
+}
+
+func TestTimeoutExceeded(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	rec := httptest.NewRecorder()
+	Timeout(10*time.Millisecond)(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestTimeoutNotExtendedByRoute(t *testing.T) {
+	handler := aqm.WithRouteTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	rec := httptest.NewRecorder()
+	Timeout(10*time.Millisecond)(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestDefaultStackRedactor(t *testing.T) {
+	var fields map[string]any
+	stack := DefaultStack(StackOptions{
+		Errors: aqm.ErrorReporterFunc(func(_ context.Context, _ error, f map[string]any) {
+			fields = f
+		}),
+		Redactor:    aqm.NewRedactor(),
+		DisableCORS: true,
+	})
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	for i := len(stack) - 1; i >= 0; i-- {
+		handler = stack[i](handler)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/ada@example.com", nil))
+
+	if fields["path"] != "/users/******" {
+		t.Errorf("reported path = %v, want redacted", fields["path"])
+	}
+}
+
+func benchStack() http.Handler {
+	stack := DefaultStack(StackOptions{
+		Logger:  aqm.NewNoopLogger(),
+		Metrics: aqm.NoopMetrics{},
+		Errors:  aqm.NoopErrorReporter{},
+	})
+	return chain(stack, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func chain(stack []func(http.Handler) http.Handler, h http.Handler) http.Handler {
+	for i := len(stack) - 1; i >= 0; i-- {
+		h = stack[i](h)
+	}
+	return h
+}
+
+func BenchmarkDefaultStack(b *testing.B) {
+	h := benchStack()
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkDefaultStackParallel(b *testing.B) {
+	h := benchStack()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+		for pb.Next() {
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+// BenchmarkDefaultStackPerRequest rebuilds the chain on every request, the
+// baseline a precomputed chain is measured against.
+func BenchmarkDefaultStackPerRequest(b *testing.B) {
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchStack().ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func TestDefaultStackAllocBudget(t *testing.T) {
+	h := benchStack()
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	aqmtest.AllocBudget(t, 75, func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -11,11 +11,12 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-// MongoConfig encapsulates the parameters required to connect to MongoDB.
+// MongoConfig encapsulates the parameters required to connect to MongoDB. It
+// can be bound from the "mongo" subtree with BindEnv.
 type MongoConfig struct {
-	URI            string
-	Database       string
-	ConnectTimeout time.Duration
+	URI            string        `koanf:"uri" validate:"required"`
+	Database       string        `koanf:"database" validate:"required"`
+	ConnectTimeout time.Duration `koanf:"connect_timeout" default:"10s"`
 }
 
 // MongoClient is a thin wrapper over the official driver that implements a
@@ -0,0 +1,60 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultCursorCollection = "_stream_cursors"
+
+var _ events.CursorStore = (*MongoCursorStore)(nil)
+
+// MongoCursorStore keeps events.Consume cursors in a Mongo collection.
+type MongoCursorStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCursorStore stores cursors in collection, defaulting to
+// _stream_cursors when empty.
+func NewMongoCursorStore(db *mongo.Database, collection string) *MongoCursorStore {
+	if collection == "" {
+		collection = defaultCursorCollection
+	}
+	return &MongoCursorStore{collection: db.Collection(collection)}
+}
+
+type cursorRecord struct {
+	Name      string    `bson:"_id"`
+	Sequence  int64     `bson:"sequence"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// LoadCursor implements events.CursorStore.
+func (s *MongoCursorStore) LoadCursor(ctx context.Context, name string) (uint64, bool, error) {
+	var record cursorRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("load cursor %s: %w", name, err)
+	}
+	return uint64(record.Sequence), true, nil
+}
+
+// SaveCursor implements events.CursorStore.
+func (s *MongoCursorStore) SaveCursor(ctx context.Context, name string, seq uint64) error {
+	record := cursorRecord{Name: name, Sequence: int64(seq), UpdatedAt: time.Now().UTC()}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": name}, record, opts); err != nil {
+		return fmt.Errorf("save cursor %s: %w", name, err)
+	}
+	return nil
+}
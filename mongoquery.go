@@ -0,0 +1,247 @@
+package aqm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// ErrQueryField is returned when a query references a field outside the
+// allowlist or an operator-like name.
+var ErrQueryField = errors.New("query: field not allowed")
+
+// Query builds Mongo filters and find options from typed calls such as
+// NewQuery("status", "createdAt").Eq("status", s).Sort("-createdAt").Limit(50).
+// Field names are checked against the allowlist given to NewQuery; the first
+// violation is kept and reported by Err, Filter and List.
+type Query struct {
+	allowed map[string]struct{}
+	filter  bson.D
+	sort    bson.D
+	limit   int64
+	skip    int64
+	err     error
+}
+
+// NewQuery returns a builder accepting only the given fields. Without fields
+// any name is accepted except those starting with "$".
+func NewQuery(allowed ...string) *Query {
+	q := &Query{}
+	if len(allowed) > 0 {
+		q.allowed = make(map[string]struct{}, len(allowed))
+		for _, field := range allowed {
+			q.allowed[field] = struct{}{}
+		}
+	}
+	return q
+}
+
+// Eq matches documents where field equals value.
+func (q *Query) Eq(field string, value any) *Query {
+	return q.add(field, value)
+}
+
+// Ne matches documents where field differs from value.
+func (q *Query) Ne(field string, value any) *Query {
+	return q.add(field, bson.M{"$ne": value})
+}
+
+// In matches documents where field is one of values.
+func (q *Query) In(field string, values ...any) *Query {
+	return q.add(field, bson.M{"$in": values})
+}
+
+// Nin matches documents where field is none of values.
+func (q *Query) Nin(field string, values ...any) *Query {
+	return q.add(field, bson.M{"$nin": values})
+}
+
+// Gt matches documents where field is greater than value.
+func (q *Query) Gt(field string, value any) *Query {
+	return q.add(field, bson.M{"$gt": value})
+}
+
+// Gte matches documents where field is greater than or equal to value.
+func (q *Query) Gte(field string, value any) *Query {
+	return q.add(field, bson.M{"$gte": value})
+}
+
+// Lt matches documents where field is less than value.
+func (q *Query) Lt(field string, value any) *Query {
+	return q.add(field, bson.M{"$lt": value})
+}
+
+// Lte matches documents where field is less than or equal to value.
+func (q *Query) Lte(field string, value any) *Query {
+	return q.add(field, bson.M{"$lte": value})
+}
+
+// Exists matches documents where field is present (or absent).
+func (q *Query) Exists(field string, exists bool) *Query {
+	return q.add(field, bson.M{"$exists": exists})
+}
+
+// Sort orders results by fields; a leading "-" sorts descending.
+func (q *Query) Sort(fields ...string) *Query {
+	for _, field := range fields {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			field, order = field[1:], -1
+		}
+		field = strings.TrimPrefix(field, "+")
+		if !q.check(field) {
+			return q
+		}
+		q.sort = append(q.sort, bson.E{Key: field, Value: order})
+	}
+	return q
+}
+
+// Limit caps the number of results; zero means no limit.
+func (q *Query) Limit(n int64) *Query {
+	if n >= 0 {
+		q.limit = n
+	}
+	return q
+}
+
+// Skip skips the first n results.
+func (q *Query) Skip(n int64) *Query {
+	if n >= 0 {
+		q.skip = n
+	}
+	return q
+}
+
+// Apply adds the equality filters, sort, limit and offset parsed from a
+// request.
+func (q *Query) Apply(params ListParams) *Query {
+	for _, field := range params.filterFields() {
+		q.Eq(field, params.Filters[field])
+	}
+	return q.Sort(params.Sort...).Limit(int64(params.Limit)).Skip(int64(params.Offset))
+}
+
+// Err reports the first invalid field used with the builder.
+func (q *Query) Err() error {
+	return q.err
+}
+
+// Filter returns the compiled Mongo filter.
+func (q *Query) Filter() (bson.D, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.filter == nil {
+		return bson.D{}, nil
+	}
+	return q.filter, nil
+}
+
+// FindOptions returns the sort, limit and skip as Mongo find options.
+func (q *Query) FindOptions() *options.FindOptions {
+	opts := options.Find()
+	if len(q.sort) > 0 {
+		opts.SetSort(q.sort)
+	}
+	if q.limit > 0 {
+		opts.SetLimit(q.limit)
+	}
+	if q.skip > 0 {
+		opts.SetSkip(q.skip)
+	}
+	return opts
+}
+
+func (q *Query) add(field string, value any) *Query {
+	if q.check(field) {
+		q.filter = append(q.filter, bson.E{Key: field, Value: value})
+	}
+	return q
+}
+
+func (q *Query) check(field string) bool {
+	if q.err != nil {
+		return false
+	}
+	if field == "" || strings.HasPrefix(field, "$") {
+		q.err = fmt.Errorf("%w: %q", ErrQueryField, field)
+		return false
+	}
+	if q.allowed != nil {
+		if _, ok := q.allowed[field]; !ok {
+			q.err = fmt.Errorf("%w: %q", ErrQueryField, field)
+			return false
+		}
+	}
+	return true
+}
+
+// ListParams holds the paging, sorting and filtering parameters of a list
+// request.
+type ListParams struct {
+	Limit   int
+	Offset  int
+	Sort    []string
+	Filters map[string]string
+}
+
+// ParseListParams reads limit (default 20, max 100), offset, sort (comma
+// separated, "-" for descending) and any other query parameter as an
+// equality filter, e.g. ?status=open&sort=-createdAt&limit=50.
+func ParseListParams(r *http.Request) (ListParams, error) {
+	params := ListParams{Limit: defaultListLimit}
+	for key, values := range r.URL.Query() {
+		if len(values) == 0 {
+			continue
+		}
+		value := values[0]
+		switch key {
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return ListParams{}, fmt.Errorf("limit must be a positive integer")
+			}
+			params.Limit = min(n, maxListLimit)
+		case "offset":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return ListParams{}, fmt.Errorf("offset must be a non-negative integer")
+			}
+			params.Offset = n
+		case "sort":
+			for _, field := range strings.Split(value, ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					params.Sort = append(params.Sort, field)
+				}
+			}
+		default:
+			if params.Filters == nil {
+				params.Filters = make(map[string]string)
+			}
+			params.Filters[key] = value
+		}
+	}
+	return params, nil
+}
+
+// filterFields returns the filter keys in a stable order.
+func (p ListParams) filterFields() []string {
+	fields := make([]string, 0, len(p.Filters))
+	for field := range p.Filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
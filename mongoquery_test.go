@@ -0,0 +1,112 @@
+package aqm
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryFilter(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := NewQuery("status", "tags", "createdAt").
+		Eq("status", "open").
+		In("tags", "a", "b").
+		Gte("createdAt", since).
+		Sort("-createdAt", "status").
+		Limit(50).
+		Skip(10)
+
+	filter, err := q.Filter()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := bson.D{
+		{Key: "status", Value: "open"},
+		{Key: "tags", Value: bson.M{"$in": []any{"a", "b"}}},
+		{Key: "createdAt", Value: bson.M{"$gte": since}},
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("expected filter %v, got %v", want, filter)
+	}
+
+	opts := q.FindOptions()
+	wantSort := bson.D{{Key: "createdAt", Value: -1}, {Key: "status", Value: 1}}
+	if !reflect.DeepEqual(opts.Sort, wantSort) {
+		t.Errorf("expected sort %v, got %v", wantSort, opts.Sort)
+	}
+	if *opts.Limit != 50 || *opts.Skip != 10 {
+		t.Errorf("unexpected limit/skip %d/%d", *opts.Limit, *opts.Skip)
+	}
+}
+
+func TestQueryRejectsFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+	}{
+		{name: "not allowed", query: NewQuery("status").Eq("owner", "x")},
+		{name: "operator", query: NewQuery().Eq("$where", "1")},
+		{name: "sort not allowed", query: NewQuery("status").Sort("-secret")},
+		{name: "empty", query: NewQuery().Ne("", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.query.Filter(); !errors.Is(err, ErrQueryField) {
+				t.Errorf("expected ErrQueryField, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseListParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    ListParams
+		wantErr bool
+	}{
+		{name: "defaults", query: "", want: ListParams{Limit: 20}},
+		{
+			name:  "all",
+			query: "?limit=500&offset=40&sort=-createdAt,%20status&status=open",
+			want:  ListParams{Limit: 100, Offset: 40, Sort: []string{"-createdAt", "status"}, Filters: map[string]string{"status": "open"}},
+		},
+		{name: "bad limit", query: "?limit=abc", wantErr: true},
+		{name: "negative offset", query: "?offset=-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseListParams(httptest.NewRequest("GET", "/items"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestQueryApplyListParams(t *testing.T) {
+	params, _ := ParseListParams(httptest.NewRequest("GET", "/items?status=open&sort=-createdAt&limit=5", nil))
+	q := NewQuery("status", "createdAt").Apply(params)
+	filter, err := q.Filter()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(filter, bson.D{{Key: "status", Value: "open"}}) {
+		t.Errorf("unexpected filter %v", filter)
+	}
+	if *q.FindOptions().Limit != 5 {
+		t.Error("expected limit from params")
+	}
+
+	params, _ = ParseListParams(httptest.NewRequest("GET", "/items?password=x", nil))
+	if err := NewQuery("status").Apply(params).Err(); !errors.Is(err, ErrQueryField) {
+		t.Errorf("expected unknown filter to be rejected, got %v", err)
+	}
+}
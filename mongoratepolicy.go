@@ -0,0 +1,94 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultRatePolicyCollection = "_rate_policies"
+	defaultRatePolicyCacheTTL   = 30 * time.Second
+)
+
+var _ RatePolicyResolver = (*MongoRatePolicyStore)(nil)
+
+// MongoRatePolicyStore keeps rate policies in a Mongo collection, one
+// document per "kind:id" key, with "kind:*" holding the default of a kind.
+// Lookups are cached for a short TTL so policy edits apply within it without
+// a query per request.
+type MongoRatePolicyStore struct {
+	collection *mongo.Collection
+	fallback   RatePolicy
+	cache      *auth.TTLCache[string, RatePolicy]
+}
+
+// NewMongoRatePolicyStore stores policies in collection, defaulting to
+// _rate_policies when empty. fallback applies when no document matches.
+func NewMongoRatePolicyStore(db *mongo.Database, collection string, fallback RatePolicy) *MongoRatePolicyStore {
+	if collection == "" {
+		collection = defaultRatePolicyCollection
+	}
+	return &MongoRatePolicyStore{
+		collection: db.Collection(collection),
+		fallback:   fallback,
+		cache:      auth.NewTTLCache[string, RatePolicy](defaultRatePolicyCacheTTL),
+	}
+}
+
+type ratePolicyRecord struct {
+	Key       string        `bson:"_id"`
+	Limit     int           `bson:"limit"`
+	Window    time.Duration `bson:"window"`
+	UpdatedAt time.Time     `bson:"updated_at"`
+}
+
+// ResolveRatePolicy implements RatePolicyResolver.
+func (s *MongoRatePolicyStore) ResolveRatePolicy(ctx context.Context, principal RatePrincipal) (RatePolicy, error) {
+	return s.cache.GetOrLoad(ctx, principal.Key(), func(ctx context.Context) (RatePolicy, error) {
+		for _, key := range []string{principal.Key(), principal.Kind + ":*"} {
+			var record ratePolicyRecord
+			err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&record)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			if err != nil {
+				return RatePolicy{}, fmt.Errorf("load rate policy %s: %w", key, err)
+			}
+			return RatePolicy{Limit: record.Limit, Window: record.Window}, nil
+		}
+		return s.fallback, nil
+	})
+}
+
+// SetPolicy stores policy for principal. Use ID "*" to set the default of a
+// kind.
+func (s *MongoRatePolicyStore) SetPolicy(ctx context.Context, principal RatePrincipal, policy RatePolicy) error {
+	record := ratePolicyRecord{
+		Key:       principal.Key(),
+		Limit:     policy.Limit,
+		Window:    policy.Window,
+		UpdatedAt: time.Now().UTC(),
+	}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": record.Key}, record, opts); err != nil {
+		return fmt.Errorf("save rate policy %s: %w", record.Key, err)
+	}
+	s.cache.Clear()
+	return nil
+}
+
+// DeletePolicy removes the policy stored for principal.
+func (s *MongoRatePolicyStore) DeletePolicy(ctx context.Context, principal RatePrincipal) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": principal.Key()}); err != nil {
+		return fmt.Errorf("delete rate policy %s: %w", principal.Key(), err)
+	}
+	s.cache.Clear()
+	return nil
+}
@@ -68,11 +68,32 @@ func (r *MongoRepo[T]) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// List returns the aggregates matching filter, which may be a *Query to also
+// apply its sort, limit and skip.
 func (r *MongoRepo[T]) List(ctx context.Context, filter any) ([]T, error) {
+	if q, ok := filter.(*Query); ok {
+		return r.Find(ctx, q)
+	}
 	if filter == nil {
 		filter = bson.M{}
 	}
-	cursor, err := r.collection.Find(ctx, filter)
+	return r.find(ctx, filter)
+}
+
+// Find returns the aggregates matching q, honouring its sort, limit and skip.
+func (r *MongoRepo[T]) Find(ctx context.Context, q *Query) ([]T, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	filter, err := q.Filter()
+	if err != nil {
+		return nil, err
+	}
+	return r.find(ctx, filter, q.FindOptions())
+}
+
+func (r *MongoRepo[T]) find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("mongo list aggregates: %w", err)
 	}
@@ -91,3 +112,96 @@ func (r *MongoRepo[T]) List(ctx context.Context, filter any) ([]T, error) {
 	}
 	return aggregates, nil
 }
+
+// BulkWriteResult summarises a batched Mongo write. Failed maps the index of
+// each rejected input item to its error.
+type BulkWriteResult struct {
+	Matched  int64
+	Modified int64
+	Upserted int64
+	Deleted  int64
+	Failed   map[int]error
+}
+
+// SaveMany upserts the aggregates in a single bulk write. In ordered mode Mongo
+// stops at the first failure and the remaining items are reported as
+// ErrBatchNotAttempted; unordered mode attempts every item. Per-item failures
+// are reported through BulkWriteResult.Failed rather than as an error.
+func (r *MongoRepo[T]) SaveMany(ctx context.Context, aggregates []T, ordered bool) (BulkWriteResult, error) {
+	if len(aggregates) == 0 {
+		return BulkWriteResult{}, nil
+	}
+	models := make([]mongo.WriteModel, 0, len(aggregates))
+	for i, aggregate := range aggregates {
+		if any(aggregate) == nil {
+			return BulkWriteResult{}, fmt.Errorf("aggregate at index %d cannot be nil", i)
+		}
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": aggregate.ID()}).
+			SetReplacement(aggregate).
+			SetUpsert(true))
+	}
+	return r.bulkWrite(ctx, models, ordered)
+}
+
+// DeleteMany removes the aggregates with the given IDs in a single bulk write.
+func (r *MongoRepo[T]) DeleteMany(ctx context.Context, ids []uuid.UUID, ordered bool) (BulkWriteResult, error) {
+	if len(ids) == 0 {
+		return BulkWriteResult{}, nil
+	}
+	models := make([]mongo.WriteModel, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": id}))
+	}
+	return r.bulkWrite(ctx, models, ordered)
+}
+
+func (r *MongoRepo[T]) bulkWrite(ctx context.Context, models []mongo.WriteModel, ordered bool) (BulkWriteResult, error) {
+	res, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(ordered))
+	result := bulkWriteResultFrom(res)
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return result, fmt.Errorf("mongo bulk write: %w", err)
+		}
+		result.Failed = make(map[int]error, len(bulkErr.WriteErrors))
+		for _, writeErr := range bulkErr.WriteErrors {
+			result.Failed[writeErr.Index] = writeErr
+		}
+		if ordered {
+			markNotAttempted(result.Failed, len(models))
+		}
+	}
+	return result, nil
+}
+
+// markNotAttempted flags every item after the first failure of an ordered
+// bulk write with ErrBatchNotAttempted, since Mongo stops there.
+func markNotAttempted(failed map[int]error, total int) {
+	first := -1
+	for index := range failed {
+		if first < 0 || index < first {
+			first = index
+		}
+	}
+	if first < 0 {
+		return
+	}
+	for index := first + 1; index < total; index++ {
+		if _, ok := failed[index]; !ok {
+			failed[index] = ErrBatchNotAttempted
+		}
+	}
+}
+
+func bulkWriteResultFrom(res *mongo.BulkWriteResult) BulkWriteResult {
+	if res == nil {
+		return BulkWriteResult{}
+	}
+	return BulkWriteResult{
+		Matched:  res.MatchedCount,
+		Modified: res.ModifiedCount,
+		Upserted: res.UpsertedCount,
+		Deleted:  res.DeletedCount,
+	}
+}
@@ -0,0 +1,77 @@
+package aqm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultSecurityEventCollection = "_security_events"
+
+var _ auth.SecuritySink = (*MongoSecuritySink)(nil)
+
+// MongoSecuritySink stores auth.SecurityEvent values in a Mongo collection
+// for audit and investigation.
+type MongoSecuritySink struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSecuritySink stores events in collection, defaulting to
+// _security_events when empty.
+func NewMongoSecuritySink(db *mongo.Database, collection string) *MongoSecuritySink {
+	if collection == "" {
+		collection = defaultSecurityEventCollection
+	}
+	return &MongoSecuritySink{collection: db.Collection(collection)}
+}
+
+type securityEventRecord struct {
+	ID         string            `bson:"_id"`
+	Type       string            `bson:"type"`
+	Time       time.Time         `bson:"time"`
+	Subject    string            `bson:"subject,omitempty"`
+	Actor      string            `bson:"actor,omitempty"`
+	SessionID  string            `bson:"session_id,omitempty"`
+	IP         string            `bson:"ip,omitempty"`
+	UserAgent  string            `bson:"user_agent,omitempty"`
+	DeviceID   string            `bson:"device_id,omitempty"`
+	Geo        string            `bson:"geo,omitempty"`
+	Permission string            `bson:"permission,omitempty"`
+	Resource   string            `bson:"resource,omitempty"`
+	Reason     string            `bson:"reason,omitempty"`
+	Fields     map[string]string `bson:"fields,omitempty"`
+	Anomalies  []string          `bson:"anomalies,omitempty"`
+}
+
+// RecordSecurityEvent implements auth.SecuritySink.
+func (s *MongoSecuritySink) RecordSecurityEvent(ctx context.Context, ev auth.SecurityEvent) error {
+	if _, err := s.collection.InsertOne(ctx, securityEventRecord(ev)); err != nil {
+		return fmt.Errorf("record security event %s: %w", ev.ID, err)
+	}
+	return nil
+}
+
+// Recent returns up to limit events of subject, newest first.
+func (s *MongoSecuritySink) Recent(ctx context.Context, subject string, limit int64) ([]auth.SecurityEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: -1}}).SetLimit(limit)
+	cur, err := s.collection.Find(ctx, bson.M{"subject": subject}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("find security events of %s: %w", subject, err)
+	}
+	defer cur.Close(ctx)
+
+	var out []auth.SecurityEvent
+	for cur.Next(ctx) {
+		var record securityEventRecord
+		if err := cur.Decode(&record); err != nil {
+			return nil, fmt.Errorf("decode security event: %w", err)
+		}
+		out = append(out, auth.SecurityEvent(record))
+	}
+	return out, cur.Err()
+}
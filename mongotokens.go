@@ -0,0 +1,168 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultRefreshTokenCollection = "_refresh_tokens"
+	defaultRevocationCollection   = "_token_revocations"
+)
+
+var (
+	_ auth.RefreshStore    = (*MongoTokenStore)(nil)
+	_ auth.RevocationStore = (*MongoTokenStore)(nil)
+)
+
+// MongoTokenStore keeps auth.TokenService refresh tokens and revocations in
+// Mongo. Call EnsureIndexes once so expired entries are removed.
+type MongoTokenStore struct {
+	refresh     *mongo.Collection
+	revocations *mongo.Collection
+}
+
+// NewMongoTokenStore stores refresh tokens in _refresh_tokens and
+// revocations in _token_revocations.
+func NewMongoTokenStore(db *mongo.Database) *MongoTokenStore {
+	return &MongoTokenStore{
+		refresh:     db.Collection(defaultRefreshTokenCollection),
+		revocations: db.Collection(defaultRevocationCollection),
+	}
+}
+
+// EnsureIndexes creates the TTL indexes expiring refresh tokens and session
+// revocations.
+func (s *MongoTokenStore) EnsureIndexes(ctx context.Context) error {
+	ttl := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := s.refresh.Indexes().CreateOne(ctx, ttl); err != nil {
+		return fmt.Errorf("create refresh token index: %w", err)
+	}
+	if _, err := s.revocations.Indexes().CreateOne(ctx, ttl); err != nil {
+		return fmt.Errorf("create revocation index: %w", err)
+	}
+	return nil
+}
+
+type refreshTokenRecord struct {
+	Hash      string            `bson:"_id"`
+	SessionID string            `bson:"session_id"`
+	Subject   string            `bson:"subject"`
+	Audience  string            `bson:"audience"`
+	Context   map[string]string `bson:"context,omitempty"`
+	ExpiresAt time.Time         `bson:"expires_at"`
+	UsedAt    *time.Time        `bson:"used_at,omitempty"`
+}
+
+// SaveRefreshToken implements auth.RefreshStore.
+func (s *MongoTokenStore) SaveRefreshToken(ctx context.Context, token auth.RefreshToken) error {
+	record := refreshTokenRecord{
+		Hash:      token.Hash,
+		SessionID: token.SessionID,
+		Subject:   token.Subject,
+		Audience:  token.Audience,
+		Context:   token.Context,
+		ExpiresAt: token.ExpiresAt,
+	}
+	if _, err := s.refresh.InsertOne(ctx, record); err != nil {
+		return fmt.Errorf("save refresh token: %w", err)
+	}
+	return nil
+}
+
+// UseRefreshToken implements auth.RefreshStore. The first use is recorded
+// with a conditional update so concurrent exchanges cannot both succeed.
+func (s *MongoTokenStore) UseRefreshToken(ctx context.Context, hash string, at time.Time) (auth.RefreshToken, error) {
+	var record refreshTokenRecord
+	err := s.refresh.FindOneAndUpdate(ctx,
+		bson.M{"_id": hash, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": at.UTC()}},
+	).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = s.refresh.FindOne(ctx, bson.M{"_id": hash}).Decode(&record)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return auth.RefreshToken{}, auth.ErrRefreshInvalid
+	}
+	if err != nil {
+		return auth.RefreshToken{}, fmt.Errorf("use refresh token: %w", err)
+	}
+	token := auth.RefreshToken{
+		Hash:      record.Hash,
+		SessionID: record.SessionID,
+		Subject:   record.Subject,
+		Audience:  record.Audience,
+		Context:   record.Context,
+		ExpiresAt: record.ExpiresAt,
+	}
+	if record.UsedAt != nil {
+		token.UsedAt = *record.UsedAt
+	}
+	return token, nil
+}
+
+// RevokeSession implements auth.RevocationStore.
+func (s *MongoTokenStore) RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	_, err := s.revocations.UpdateOne(ctx,
+		bson.M{"_id": "session:" + sessionID},
+		bson.M{"$max": bson.M{"expires_at": until.UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("revoke session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// SessionRevoked implements auth.RevocationStore.
+func (s *MongoTokenStore) SessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	filter := bson.M{"_id": "session:" + sessionID, "expires_at": bson.M{"$gt": time.Now().UTC()}}
+	n, err := s.revocations.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("check session %s: %w", sessionID, err)
+	}
+	return n > 0, nil
+}
+
+type authzVersionRecord struct {
+	ID      string `bson:"_id"`
+	Version int    `bson:"version"`
+}
+
+// AuthzVersion implements auth.RevocationStore.
+func (s *MongoTokenStore) AuthzVersion(ctx context.Context, subject string) (int, error) {
+	var record authzVersionRecord
+	err := s.revocations.FindOne(ctx, bson.M{"_id": "authz:" + subject}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("load authz version of %s: %w", subject, err)
+	}
+	return record.Version, nil
+}
+
+// BumpAuthzVersion implements auth.RevocationStore.
+func (s *MongoTokenStore) BumpAuthzVersion(ctx context.Context, subject string) (int, error) {
+	var record authzVersionRecord
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.revocations.FindOneAndUpdate(ctx,
+		bson.M{"_id": "authz:" + subject},
+		bson.M{"$inc": bson.M{"version": 1}},
+		opts,
+	).Decode(&record)
+	if err != nil {
+		return 0, fmt.Errorf("bump authz version of %s: %w", subject, err)
+	}
+	return record.Version, nil
+}
@@ -0,0 +1,235 @@
+package aqm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const defaultCertificateRecheck = 30 * time.Second
+
+// WorkloadCertificate is a certificate and key pair read from files and
+// reloaded when they change, as written by a SPIFFE helper or cert-manager
+// sidecar. Handshakes check the files at most once per recheck interval and
+// keep the previous pair when the new one cannot be loaded. It is safe for
+// concurrent use.
+type WorkloadCertificate struct {
+	certFile string
+	keyFile  string
+	recheck  time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// LoadWorkloadCertificate reads the pair once and fails when it is invalid.
+// A zero recheck checks the files every 30 seconds.
+func LoadWorkloadCertificate(certFile, keyFile string, recheck time.Duration) (*WorkloadCertificate, error) {
+	if recheck <= 0 {
+		recheck = defaultCertificateRecheck
+	}
+	w := &WorkloadCertificate{certFile: certFile, keyFile: keyFile, recheck: recheck, now: time.Now}
+	modTime, err := w.modified()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.load(modTime); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Certificate returns the current pair, reloading it first when the files
+// changed since the last check.
+func (w *WorkloadCertificate) Certificate() (*tls.Certificate, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	if now.Sub(w.checkedAt) < w.recheck {
+		return w.cert, nil
+	}
+	w.checkedAt = now
+	if modTime, err := w.modified(); err == nil && modTime.After(w.modTime) {
+		// A pair that fails to load is usually half written; the next
+		// check picks it up.
+		_ = w.load(modTime)
+	}
+	return w.cert, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (w *WorkloadCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return w.Certificate()
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (w *WorkloadCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return w.Certificate()
+}
+
+// ClientTLSConfig presents the workload certificate and verifies servers
+// against roots.
+func (w *WorkloadCertificate) ClientTLSConfig(roots *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              roots,
+		GetClientCertificate: w.GetClientCertificate,
+	}
+}
+
+// ServerTLSConfig serves the workload certificate and requires clients to
+// present one signed by clientCAs.
+func (w *WorkloadCertificate) ServerTLSConfig(clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientCAs:      clientCAs,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		GetCertificate: w.GetCertificate,
+	}
+}
+
+func (w *WorkloadCertificate) modified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{w.certFile, w.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("workload certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (w *WorkloadCertificate) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(w.certFile, w.keyFile)
+	if err != nil {
+		return fmt.Errorf("workload certificate: %w", err)
+	}
+	w.cert = &cert
+	w.modTime = modTime
+	w.checkedAt = w.now()
+	return nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates, such as a SPIFFE trust
+// bundle.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", path)
+	}
+	return pool, nil
+}
+
+// PeerIdentityFromTLS returns the identity of the verified client
+// certificate of state. Unverified certificates are never trusted.
+func PeerIdentityFromTLS(state *tls.ConnectionState) (*auth.PeerIdentity, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, errors.New("no verified peer certificate")
+	}
+	return auth.PeerIdentityFromCertificate(state.VerifiedChains[0][0])
+}
+
+// GRPCWorkloadCredentials is a dial option presenting the workload
+// certificate to gRPC servers and verifying them against roots.
+func GRPCWorkloadCredentials(cert *WorkloadCertificate, roots *x509.CertPool) grpc.DialOption {
+	return grpc.WithTransportCredentials(credentials.NewTLS(cert.ClientTLSConfig(roots)))
+}
+
+// WithGRPCServerOptions adds options to the servers built by later
+// WithGRPCServer options, e.g. grpc.Creds with a ServerTLSConfig and the
+// GRPCPeerAuth interceptors.
+func WithGRPCServerOptions(opts ...grpc.ServerOption) Option {
+	return func(ms *Micro) error {
+		ms.grpcServerOptions = append(ms.grpcServerOptions, opts...)
+		return nil
+	}
+}
+
+// WithHTTPServerTLS serves the WithHTTPServer server over TLS with cfg,
+// e.g. a ServerTLSConfig requiring client certificates for
+// middleware.PeerAuth. cfg must provide the server certificate. It may be
+// applied before or after WithHTTPServer.
+func WithHTTPServerTLS(cfg *tls.Config) Option {
+	return func(ms *Micro) error {
+		if cfg == nil {
+			return errors.New("nil http server tls config provided")
+		}
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.httpTLS = cfg
+		if ms.httpServer != nil {
+			ms.httpServer.TLSConfig = cfg
+		}
+		return nil
+	}
+}
+
+// GRPCPeerAuth returns interceptors that store the verified peer identity
+// with auth.WithPeer and reject calls without one (Unauthenticated) or that
+// policy refuses (PermissionDenied). A nil policy admits every verified peer.
+func GRPCPeerAuth(policy auth.PeerPolicy) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	authorize := func(ctx context.Context) (context.Context, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "peer certificate required")
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "peer certificate required")
+		}
+		identity, err := PeerIdentityFromTLS(&info.State)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		ctx = auth.WithPeer(ctx, identity)
+		if policy != nil && !policy(ctx, identity) {
+			return nil, status.Errorf(codes.PermissionDenied, "peer %s is not allowed", identity)
+		}
+		return ctx, nil
+	}
+
+	unary := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &peerServerStream{ServerStream: ss, ctx: ctx})
+	}
+	return unary, stream
+}
+
+type peerServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *peerServerStream) Context() context.Context { return s.ctx }
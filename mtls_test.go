@@ -0,0 +1,275 @@
+package aqm
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue writes a leaf certificate for spiffeID to dir and returns the cert
+// and key paths.
+func (ca *testCA) issue(t *testing.T, dir, spiffeID string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := url.Parse(spiffeID)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{id},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTPClientPresentsWorkloadCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, t.TempDir(), "spiffe://prod.example/server", 2)
+	serverCert, err := LoadWorkloadCertificate(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := PeerIdentityFromTLS(r.TLS)
+		if err != nil {
+			t.Errorf("peer identity: %v", err)
+			return
+		}
+		got = peer.String()
+		Respond(w, http.StatusOK, map[string]string{}, nil)
+	}))
+	srv.TLS = serverCert.ServerTLSConfig(ca.pool)
+	// StartTLS installs its own certificate unless one is set; handshakes
+	// to an IP carry no server name, so GetCertificate would lose.
+	pair, _ := serverCert.Certificate()
+	srv.TLS.Certificates = []tls.Certificate{*pair}
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientDir := t.TempDir()
+	certFile, keyFile = ca.issue(t, clientDir, "spiffe://prod.example/api", 3)
+	clientCert, err := LoadWorkloadCertificate(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	clientCert.now = func() time.Time { return now }
+	client := NewHTTPClient(HTTPClientConfig{
+		BaseURL:           srv.URL,
+		MaxRetries:        1,
+		TLSConfig:         &tls.Config{RootCAs: ca.pool},
+		ClientCertificate: clientCert,
+	})
+	if err := client.Get(context.Background(), "/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != "spiffe://prod.example/api" {
+		t.Errorf("server saw %q", got)
+	}
+
+	// Rotate the files; the new pair is picked up after the recheck interval.
+	certFile, keyFile = ca.issue(t, clientDir, "spiffe://prod.example/api-v2", 4)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	_ = os.Chtimes(keyFile, later, later)
+	now = now.Add(time.Minute)
+	client.HTTPClient.CloseIdleConnections()
+	if err := client.Get(context.Background(), "/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != "spiffe://prod.example/api-v2" {
+		t.Errorf("after rotation server saw %q", got)
+	}
+
+	plain := NewHTTPClient(HTTPClientConfig{BaseURL: srv.URL, MaxRetries: 1, RetryDelay: time.Millisecond, TLSConfig: &tls.Config{RootCAs: ca.pool}})
+	if err := plain.Get(context.Background(), "/", nil); err == nil {
+		t.Error("client without certificate was accepted")
+	}
+}
+
+type peerEchoModule struct{}
+
+func (peerEchoModule) RegisterRoutes(r chi.Router) {
+	r.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		peer, err := PeerIdentityFromTLS(r.TLS)
+		if err != nil {
+			Error(w, http.StatusUnauthorized, "peer_unauthenticated", err.Error())
+			return
+		}
+		Respond(w, http.StatusOK, map[string]string{"peer": peer.String()}, nil)
+	})
+}
+
+func TestWithHTTPServerTLS(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, t.TempDir(), "spiffe://prod.example/server", 2)
+	serverCert, err := LoadWorkloadCertificate(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = ca.issue(t, t.TempDir(), "spiffe://prod.example/api", 3)
+	clientCert, err := LoadWorkloadCertificate(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	cfg := NewConfig()
+	cfg.Set("http.port", addr)
+	ms := NewMicro(
+		WithConfig(cfg),
+		WithLogger(NewNoopLogger()),
+		WithHTTPServerModules("http.port", peerEchoModule{}),
+		WithHTTPServerTLS(serverCert.ServerTLSConfig(ca.pool)),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ms.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Errorf("run: %v", err)
+		}
+	}()
+
+	client := NewHTTPClient(HTTPClientConfig{
+		BaseURL:           "https://" + addr,
+		MaxRetries:        20,
+		RetryDelay:        10 * time.Millisecond,
+		TLSConfig:         &tls.Config{RootCAs: ca.pool},
+		ClientCertificate: clientCert,
+	})
+	var body struct {
+		Data struct {
+			Peer string `json:"peer"`
+		} `json:"data"`
+	}
+	if err := client.Get(context.Background(), "/whoami", &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.Peer != "spiffe://prod.example/api" {
+		t.Errorf("server saw peer %q", body.Data.Peer)
+	}
+
+	client.HTTPClient.CloseIdleConnections()
+
+	plain := NewHTTPClient(HTTPClientConfig{BaseURL: "https://" + addr, MaxRetries: 1, RetryDelay: time.Millisecond, TLSConfig: &tls.Config{RootCAs: ca.pool}})
+	if err := plain.Get(context.Background(), "/whoami", nil); err == nil {
+		t.Error("client without certificate was accepted")
+	}
+}
+
+func TestGRPCPeerAuth(t *testing.T) {
+	ca := newTestCA(t)
+	leaf := func(id string) *x509.Certificate {
+		certFile, keyFile := ca.issue(t, t.TempDir(), id, 5)
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(pair.Certificate[0])
+		return cert
+	}
+	peerCtx := func(cert *x509.Certificate) context.Context {
+		state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}}
+		return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	}
+
+	unary, _ := GRPCPeerAuth(auth.AllowTrustDomains("prod.example"))
+	var seen *auth.PeerIdentity
+	handler := func(ctx context.Context, _ any) (any, error) {
+		seen = auth.PeerFrom(ctx)
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}
+
+	if _, err := unary(peerCtx(leaf("spiffe://prod.example/api")), nil, info, handler); err != nil || seen.String() != "spiffe://prod.example/api" {
+		t.Fatalf("allowed peer: err %v, seen %v", err, seen)
+	}
+	if _, err := unary(peerCtx(leaf("spiffe://dev.example/api")), nil, info, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("foreign trust domain: %v", err)
+	}
+	if _, err := unary(context.Background(), nil, info, handler); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no peer: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+const (
+	defaultObserveTimeout       = 10 * time.Second
+	defaultObserveSlowThreshold = 500 * time.Millisecond
+)
+
+var observerKey = aqmctx.NewKey[*Observer]("observer")
+
+// Observer instruments service and repository calls made through Observe:
+// every call gets a deadline, a span and a duration metric, and calls slower
+// than SlowThreshold are logged with the request ID.
+type Observer struct {
+	Metrics Metrics
+	Tracer  Tracer
+	Logger  Logger
+	// Timeout bounds each call unless the context already expires sooner;
+	// zero leaves the context deadline alone.
+	Timeout time.Duration
+	// SlowThreshold is the duration above which a call is logged; zero
+	// disables slow call logging.
+	SlowThreshold time.Duration
+}
+
+// NewObserver builds an Observer from deps, reading observe.timeout
+// (default 10s) and observe.slow_threshold (default 500ms).
+func NewObserver(deps *Deps) *Observer {
+	o := &Observer{Timeout: defaultObserveTimeout, SlowThreshold: defaultObserveSlowThreshold}
+	if deps == nil {
+		return o
+	}
+	o.Metrics, o.Tracer, o.Logger = deps.Metrics, deps.Tracer, deps.Logger
+	if deps.Config != nil {
+		o.Timeout = deps.Config.GetDurationOrDef("observe.timeout", defaultObserveTimeout)
+		o.SlowThreshold = deps.Config.GetDurationOrDef("observe.slow_threshold", defaultObserveSlowThreshold)
+	}
+	return o
+}
+
+// ContextWithObserver stores o for Observe calls made with the returned
+// context.
+func ContextWithObserver(ctx context.Context, o *Observer) context.Context {
+	if ctx == nil || o == nil {
+		return ctx
+	}
+	return observerKey.With(ctx, o)
+}
+
+// ObserverFrom returns the Observer stored in ctx, or nil.
+func ObserverFrom(ctx context.Context) *Observer {
+	if ctx == nil {
+		return nil
+	}
+	o, _ := observerKey.From(ctx)
+	return o
+}
+
+// ObserverMiddleware exposes the observer returned by observer to handlers
+// through the request context. It is called once, on the first request, so
+// dependencies wired after the server are picked up. WithHTTPServer installs
+// it with NewObserver over the service dependencies.
+func ObserverMiddleware(observer func() *Observer) func(http.Handler) http.Handler {
+	get := sync.OnceValue(observer)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(ContextWithObserver(r.Context(), get())))
+		})
+	}
+}
+
+// Observe runs fn as the named call, e.g. "repo.todo.list", with the
+// Observer stored in ctx. Without one fn still gets the default 10s timeout
+// but nothing is recorded.
+func Observe(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	o := ObserverFrom(ctx)
+	if o == nil {
+		o = &Observer{Timeout: defaultObserveTimeout}
+	}
+	return o.Observe(ctx, name, fn)
+}
+
+// ObserveValue is Observe for calls returning a value.
+func ObserveValue[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	err := Observe(ctx, name, func(ctx context.Context) error {
+		var err error
+		value, err = fn(ctx)
+		return err
+	})
+	return value, err
+}
+
+// Observe runs fn as the named call. A context that already expired fails
+// the call without running fn. The duration is recorded as the
+// call_duration_ms counter labelled with the call name and its outcome: ok,
+// error or timeout.
+func (o *Observer) Observe(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	tracer := o.Tracer
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+	ctx, span := tracer.Start(ctx, name, map[string]any{"call": name})
+	if ts, ok := span.(TraceSpan); ok {
+		ctx = ContextWithTrace(ctx, ts.TraceContext())
+	}
+
+	start := time.Now()
+	err := fn(ctx)
+	duration := time.Since(start)
+	span.End(err)
+
+	outcome := "ok"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "error"
+	}
+	if o.Metrics != nil {
+		o.Metrics.Counter(ctx, "call_duration_ms", float64(duration.Milliseconds()), map[string]string{"call": name, "outcome": outcome})
+	}
+	if o.SlowThreshold > 0 && duration > o.SlowThreshold {
+		logger := o.Logger
+		if logger == nil {
+			logger = NewNoopLogger()
+		}
+		logger.Warn(append([]any{"slow call", "call", name, "duration", duration, "threshold", o.SlowThreshold,
+			"outcome", outcome, "request_id", RequestIDFrom(ctx)}, TraceFields(ctx)...)...)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingTracer struct {
+	started []string
+	ended   []error
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ map[string]any) (context.Context, Span) {
+	t.started = append(t.started, name)
+	return ctx, recordingSpan{t}
+}
+
+type recordingSpan struct{ t *recordingTracer }
+
+func (s recordingSpan) End(err error) { s.t.ended = append(s.t.ended, err) }
+
+func TestObserve(t *testing.T) {
+	var buf bytes.Buffer
+	metrics := &counterMetrics{}
+	tracer := &recordingTracer{}
+	o := &Observer{Metrics: metrics, Tracer: tracer, Logger: newBufferLogger(&buf), Timeout: 20 * time.Millisecond, SlowThreshold: 5 * time.Millisecond}
+	ctx := ContextWithObserver(WithRequestID(context.Background(), "req-1"), o)
+
+	items, err := ObserveValue(ctx, "repo.todo.list", func(context.Context) ([]string, error) {
+		return []string{"a"}, nil
+	})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("unexpected result %v %v", items, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("fast call logged: %s", buf.String())
+	}
+
+	err = Observe(ctx, "repo.todo.get", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "slow call") || !strings.Contains(out, "repo.todo.get") || !strings.Contains(out, "req-1") || !strings.Contains(out, "timeout") {
+		t.Errorf("unexpected slow call log %q", out)
+	}
+	if len(tracer.started) != 2 || tracer.started[1] != "repo.todo.get" || !errors.Is(tracer.ended[1], context.DeadlineExceeded) {
+		t.Errorf("unexpected spans %v %v", tracer.started, tracer.ended)
+	}
+	if metrics.get("call_duration_ms") < 20 {
+		t.Errorf("expected durations recorded, got %v", metrics.get("call_duration_ms"))
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	called := false
+	if err := Observe(cancelled, "repo.todo.get", func(context.Context) error { called = true; return nil }); !errors.Is(err, context.Canceled) || called {
+		t.Errorf("expected expired context to skip the call, got %v called=%v", err, called)
+	}
+}
+
+func TestObserveWithoutObserver(t *testing.T) {
+	err := Observe(context.Background(), "call", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestObserverMiddleware(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("observe.slow_threshold", "1s")
+	deps := DefaultDeps()
+	deps.Config = cfg
+	var got *Observer
+	handler := ObserverMiddleware(func() *Observer { return NewObserver(deps) })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ObserverFrom(r.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got == nil || got.SlowThreshold != time.Second || got.Timeout != defaultObserveTimeout {
+		t.Errorf("unexpected observer %+v", got)
+	}
+}
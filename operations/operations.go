@@ -0,0 +1,390 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBasePath      = "/operations"
+	defaultTTL           = 24 * time.Hour
+	defaultSweepInterval = time.Minute
+	defaultRetryAfter    = "2"
+)
+
+// ErrNotFound is returned when an operation does not exist or has expired.
+var ErrNotFound = errors.New("operations: operation not found")
+
+// Status describes where a long-running operation is in its lifecycle.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Done reports whether the status is terminal.
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+// Operation is the pollable record of an asynchronous request.
+type Operation struct {
+	ID        uuid.UUID         `json:"id" bson:"_id"`
+	Kind      string            `json:"kind" bson:"kind"`
+	Status    Status            `json:"status" bson:"status"`
+	Progress  int               `json:"progress" bson:"progress"`
+	Message   string            `json:"message,omitempty" bson:"message,omitempty"`
+	Result    any               `json:"result,omitempty" bson:"result,omitempty"`
+	Error     *aqm.ErrorPayload `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at" bson:"updated_at"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero" bson:"expires_at,omitempty"`
+}
+
+// GetID implements aqm.Linkable.
+func (o *Operation) GetID() uuid.UUID { return o.ID }
+
+// ResourceType implements aqm.Linkable.
+func (o *Operation) ResourceType() string { return "operation" }
+
+// Store persists operations.
+type Store interface {
+	Create(ctx context.Context, op *Operation) error
+	Get(ctx context.Context, id uuid.UUID) (*Operation, error)
+	Update(ctx context.Context, op *Operation) error
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// Queue executes work outside the request goroutine. aqm.WebhookQueue
+// implementations satisfy it.
+type Queue interface {
+	Enqueue(ctx context.Context, task func(context.Context) error) error
+}
+
+// WorkFunc performs the long-running work, reporting progress through p. The
+// returned value becomes the operation result.
+type WorkFunc func(ctx context.Context, p *Progress) (any, error)
+
+// Manager creates operations, runs their work, exposes the polling endpoint
+// and expires finished records. It implements aqm.HTTPModule, aqm.Startable
+// and aqm.Stoppable.
+type Manager struct {
+	store         Store
+	queue         Queue
+	log           aqm.Logger
+	basePath      string
+	ttl           time.Duration
+	sweepInterval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(m *Manager) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// WithQueue routes work through the provided queue instead of plain goroutines.
+func WithQueue(queue Queue) Option {
+	return func(m *Manager) {
+		if queue != nil {
+			m.queue = queue
+		}
+	}
+}
+
+// WithBasePath overrides the polling mount point (defaults to /operations).
+func WithBasePath(base string) Option {
+	return func(m *Manager) {
+		if base != "" {
+			m.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithTTL controls how long finished operations remain pollable. The ttl
+// counts from completion; pending and running operations never expire.
+func WithTTL(ttl time.Duration) Option {
+	return func(m *Manager) {
+		if ttl > 0 {
+			m.ttl = ttl
+		}
+	}
+}
+
+// WithSweepInterval controls how often expired operations are purged.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		if interval > 0 {
+			m.sweepInterval = interval
+		}
+	}
+}
+
+// NewManager returns a Manager backed by store. A nil store defaults to an
+// in-memory implementation.
+func NewManager(store Store, opts ...Option) *Manager {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	m := &Manager{
+		store:         store,
+		queue:         goroutineQueue{},
+		log:           aqm.NewNoopLogger(),
+		basePath:      defaultBasePath,
+		ttl:           defaultTTL,
+		sweepInterval: defaultSweepInterval,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// Submit records a pending operation and enqueues work for execution.
+func (m *Manager) Submit(ctx context.Context, kind string, work WorkFunc) (*Operation, error) {
+	if work == nil {
+		return nil, errors.New("operations: nil work function")
+	}
+	now := time.Now().UTC()
+	op := &Operation{
+		ID:        uuid.New(),
+		Kind:      kind,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.store.Create(ctx, op); err != nil {
+		return nil, fmt.Errorf("operations: create: %w", err)
+	}
+
+	id := op.ID
+	taskCtx := context.WithoutCancel(ctx)
+	if err := m.queue.Enqueue(taskCtx, func(ctx context.Context) error {
+		return m.execute(ctx, id, work)
+	}); err != nil {
+		_ = m.finish(taskCtx, id, nil, err)
+		return nil, fmt.Errorf("operations: enqueue: %w", err)
+	}
+	return op, nil
+}
+
+// Get returns the current state of an operation.
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Operation, error) {
+	return m.store.Get(ctx, id)
+}
+
+func (m *Manager) execute(ctx context.Context, id uuid.UUID, work WorkFunc) error {
+	progress := &Progress{manager: m, id: id}
+	if err := progress.set(ctx, StatusRunning, 0, ""); err != nil {
+		if finishErr := m.finish(ctx, id, nil, err); finishErr != nil {
+			m.log.Error("cannot record operation failure", "id", id, "error", finishErr)
+		}
+		return err
+	}
+	result, workErr := runWork(ctx, work, progress)
+	if err := m.finish(ctx, id, result, workErr); err != nil {
+		m.log.Error("cannot record operation result", "id", id, "error", err)
+		return err
+	}
+	if workErr != nil {
+		m.log.Error("operation failed", "id", id, "error", workErr)
+	}
+	return nil
+}
+
+// runWork turns a panicking worker into a failed operation instead of a
+// crashed process or an operation stuck in running.
+func runWork(ctx context.Context, work WorkFunc, progress *Progress) (result any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			result, err = nil, fmt.Errorf("operations: panic: %v", rec)
+		}
+	}()
+	return work(ctx, progress)
+}
+
+func (m *Manager) finish(ctx context.Context, id uuid.UUID, result any, workErr error) error {
+	op, err := m.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	op.UpdatedAt = time.Now().UTC()
+	op.ExpiresAt = op.UpdatedAt.Add(m.ttl)
+	if workErr != nil {
+		op.Status = StatusFailed
+		op.Error = &aqm.ErrorPayload{Code: "operation_failed", Message: workErr.Error()}
+		var verrs aqm.ValidationErrors
+		if errors.As(workErr, &verrs) {
+			op.Error.Code = "validation_failed"
+			op.Error.Details = verrs
+		}
+	} else {
+		op.Status = StatusSucceeded
+		op.Progress = 100
+		op.Result = result
+	}
+	return m.store.Update(ctx, op)
+}
+
+// Location returns the polling URL for an operation.
+func (m *Manager) Location(id uuid.UUID) string {
+	return m.basePath + "/" + id.String()
+}
+
+// RespondAccepted answers 202 Accepted with a Location header and a self
+// link pointing at the polling resource.
+func (m *Manager) RespondAccepted(w http.ResponseWriter, op *Operation) {
+	location := m.Location(op.ID)
+	w.Header().Set("Location", location)
+	w.Header().Set("Retry-After", defaultRetryAfter)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(aqm.SuccessResponse{Data: op, Links: []aqm.Link{{Rel: aqm.RelSelf, Href: location}}})
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (m *Manager) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Get(m.basePath+"/{id}", m.handleGet)
+}
+
+func (m *Manager) handleGet(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		aqm.RespondError(w, http.StatusBadRequest, "invalid operation id")
+		return
+	}
+	op, err := m.store.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			aqm.RespondError(w, http.StatusNotFound, "operation not found")
+			return
+		}
+		m.log.Error("cannot load operation", "id", id, "error", err)
+		aqm.RespondError(w, http.StatusInternalServerError, "cannot load operation")
+		return
+	}
+	if !op.Status.Done() {
+		w.Header().Set("Retry-After", defaultRetryAfter)
+	}
+	aqm.RespondSuccess(w, op, aqm.Link{Rel: aqm.RelSelf, Href: m.Location(op.ID)})
+}
+
+// Start launches the background sweeper that purges expired operations.
+func (m *Manager) Start(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+	go m.sweep(ctx, m.done)
+	return nil
+}
+
+// Stop halts the sweeper.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) sweep(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := m.store.DeleteExpired(ctx, time.Now().UTC())
+			if err != nil {
+				m.log.Error("operation sweep failed", "error", err)
+				continue
+			}
+			if removed > 0 {
+				m.log.Debug("expired operations removed", "count", removed)
+			}
+		}
+	}
+}
+
+// Progress lets workers publish intermediate state.
+type Progress struct {
+	manager *Manager
+	id      uuid.UUID
+}
+
+// Update records the completion percentage (clamped to 0-99) and an optional message.
+func (p *Progress) Update(ctx context.Context, percent int, message string) error {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 99 {
+		percent = 99
+	}
+	return p.set(ctx, StatusRunning, percent, message)
+}
+
+func (p *Progress) set(ctx context.Context, status Status, percent int, message string) error {
+	op, err := p.manager.store.Get(ctx, p.id)
+	if err != nil {
+		return err
+	}
+	op.Status = status
+	op.Progress = percent
+	op.Message = message
+	op.UpdatedAt = time.Now().UTC()
+	return p.manager.store.Update(ctx, op)
+}
+
+type goroutineQueue struct{}
+
+func (goroutineQueue) Enqueue(ctx context.Context, task func(context.Context) error) error {
+	go func() {
+		defer func() { _ = recover() }()
+		_ = task(ctx)
+	}()
+	return nil
+}
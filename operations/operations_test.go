@@ -0,0 +1,242 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type syncQueue struct{}
+
+func (syncQueue) Enqueue(ctx context.Context, task func(context.Context) error) error {
+	return task(ctx)
+}
+
+type failingQueue struct{}
+
+func (failingQueue) Enqueue(context.Context, func(context.Context) error) error {
+	return errors.New("queue full")
+}
+
+func TestSubmitSucceeds(t *testing.T) {
+	mgr := NewManager(nil, WithQueue(syncQueue{}))
+	ctx := context.Background()
+
+	op, err := mgr.Submit(ctx, "export", func(ctx context.Context, p *Progress) (any, error) {
+		if err := p.Update(ctx, 50, "halfway"); err != nil {
+			return nil, err
+		}
+		return map[string]string{"url": "/files/1"}, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+
+	got, err := mgr.Get(ctx, op.ID)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if got.Status != StatusSucceeded || got.Progress != 100 || got.Result == nil {
+		t.Errorf("unexpected operation %+v", got)
+	}
+}
+
+func TestSubmitFails(t *testing.T) {
+	mgr := NewManager(nil, WithQueue(syncQueue{}))
+	ctx := context.Background()
+
+	op, err := mgr.Submit(ctx, "import", func(context.Context, *Progress) (any, error) {
+		return nil, aqm.ValidationErrors{{Field: "file", Code: "invalid", Message: "bad csv"}}
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+
+	got, _ := mgr.Get(ctx, op.ID)
+	if got.Status != StatusFailed || got.Error == nil || got.Error.Code != "validation_failed" {
+		t.Errorf("unexpected operation %+v", got)
+	}
+}
+
+func TestSubmitRecoversPanics(t *testing.T) {
+	for name, queue := range map[string]Queue{"sync": syncQueue{}, "goroutine": goroutineQueue{}} {
+		t.Run(name, func(t *testing.T) {
+			mgr := NewManager(nil, WithQueue(queue))
+			ctx := context.Background()
+
+			op, err := mgr.Submit(ctx, "export", func(context.Context, *Progress) (any, error) {
+				panic("boom")
+			})
+			if err != nil {
+				t.Fatalf("Submit error: %v", err)
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for {
+				got, err := mgr.Get(ctx, op.ID)
+				if err != nil {
+					t.Fatalf("Get error: %v", err)
+				}
+				if got.Status == StatusFailed {
+					if got.Error == nil || got.Error.Code != "operation_failed" {
+						t.Errorf("unexpected error payload %+v", got.Error)
+					}
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("expected the operation to fail, got %+v", got)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestSubmitExtendsExpiry(t *testing.T) {
+	ttl := 20 * time.Millisecond
+	mgr := NewManager(nil, WithQueue(syncQueue{}), WithTTL(ttl))
+	ctx := context.Background()
+
+	op, err := mgr.Submit(ctx, "export", func(ctx context.Context, p *Progress) (any, error) {
+		time.Sleep(2 * ttl)
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+
+	got, err := mgr.Get(ctx, op.ID)
+	if err != nil {
+		t.Fatalf("expected the finished operation to still be readable, got %v", err)
+	}
+	if !got.ExpiresAt.Equal(got.UpdatedAt.Add(ttl)) {
+		t.Errorf("expected expiry to count from completion, got created %v updated %v expires %v", got.CreatedAt, got.UpdatedAt, got.ExpiresAt)
+	}
+}
+
+func TestSubmitQueueError(t *testing.T) {
+	mgr := NewManager(nil, WithQueue(failingQueue{}))
+	if _, err := mgr.Submit(context.Background(), "x", func(context.Context, *Progress) (any, error) { return nil, nil }); err == nil {
+		t.Error("expected enqueue error")
+	}
+	if _, err := mgr.Submit(context.Background(), "x", nil); err == nil {
+		t.Error("expected nil work error")
+	}
+}
+
+func TestRespondAcceptedAndPoll(t *testing.T) {
+	release := make(chan struct{})
+	mgr := NewManager(nil)
+	op, err := mgr.Submit(context.Background(), "slow", func(context.Context, *Progress) (any, error) {
+		<-release
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	mgr.RespondAccepted(rec, op)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected 202, got %d", rec.Code)
+	}
+	location := rec.Header().Get("Location")
+	if location != "/operations/"+op.ID.String() {
+		t.Errorf("unexpected Location %q", location)
+	}
+
+	router := chi.NewRouter()
+	mgr.RegisterRoutes(router)
+
+	poll := httptest.NewRecorder()
+	router.ServeHTTP(poll, httptest.NewRequest(http.MethodGet, location, nil))
+	if poll.Code != http.StatusOK || poll.Header().Get("Retry-After") == "" {
+		t.Errorf("expected pending poll with Retry-After, got %d %q", poll.Code, poll.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		got, _ := mgr.Get(context.Background(), op.ID)
+		if got.Status.Done() {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	poll = httptest.NewRecorder()
+	router.ServeHTTP(poll, httptest.NewRequest(http.MethodGet, location, nil))
+	var resp struct {
+		Data Operation `json:"data"`
+	}
+	if err := json.NewDecoder(poll.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if resp.Data.Status != StatusSucceeded {
+		t.Errorf("expected succeeded, got %s", resp.Data.Status)
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	router := chi.NewRouter()
+	NewManager(nil).RegisterRoutes(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/operations/not-a-uuid", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/operations/"+uuid.NewString(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	op := &Operation{ID: uuid.New(), ExpiresAt: time.Now().Add(-time.Second)}
+	_ = store.Create(ctx, op)
+
+	if _, err := store.Get(ctx, op.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expired operation to be hidden, got %v", err)
+	}
+	removed, _ := store.DeleteExpired(ctx, time.Now())
+	if removed != 1 {
+		t.Errorf("expected 1 removed, got %d", removed)
+	}
+	if err := store.Update(ctx, op); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound on update, got %v", err)
+	}
+}
+
+func TestManagerStartStop(t *testing.T) {
+	store := NewMemoryStore()
+	_ = store.Create(context.Background(), &Operation{ID: uuid.New(), ExpiresAt: time.Now().Add(-time.Second)})
+
+	mgr := NewManager(store, WithSweepInterval(5*time.Millisecond))
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := mgr.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop error: %v", err)
+	}
+
+	store.mu.RLock()
+	remaining := len(store.ops)
+	store.mu.RUnlock()
+	if remaining != 0 {
+		t.Errorf("expected sweeper to purge expired operations, %d left", remaining)
+	}
+}
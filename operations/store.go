@@ -0,0 +1,65 @@
+package operations
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps operations in process memory. It suits single-instance
+// services and tests; use a shared store when several replicas serve polls.
+type MemoryStore struct {
+	mu  sync.RWMutex
+	ops map[uuid.UUID]Operation
+}
+
+// NewMemoryStore constructs an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ops: map[uuid.UUID]Operation{}}
+}
+
+// Create implements Store.
+func (s *MemoryStore) Create(_ context.Context, op *Operation) error {
+	s.mu.Lock()
+	s.ops[op.ID] = *op
+	s.mu.Unlock()
+	return nil
+}
+
+// Get implements Store. Expired operations are reported as not found.
+func (s *MemoryStore) Get(_ context.Context, id uuid.UUID) (*Operation, error) {
+	s.mu.RLock()
+	op, ok := s.ops[id]
+	s.mu.RUnlock()
+	if !ok || (!op.ExpiresAt.IsZero() && time.Now().After(op.ExpiresAt)) {
+		return nil, ErrNotFound
+	}
+	return &op, nil
+}
+
+// Update implements Store.
+func (s *MemoryStore) Update(_ context.Context, op *Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ops[op.ID]; !ok {
+		return ErrNotFound
+	}
+	s.ops[op.ID] = *op
+	return nil
+}
+
+// DeleteExpired implements Store.
+func (s *MemoryStore) DeleteExpired(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for id, op := range s.ops {
+		if !op.ExpiresAt.IsZero() && now.After(op.ExpiresAt) {
+			delete(s.ops, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -1,6 +1,7 @@
 package aqm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -87,18 +88,59 @@ func WithHealthChecks(name string, checks ...HealthCheck) Option {
 	}
 }
 
-// WithDebugRoutes enables the /debug/routes endpoint on the HTTP server.
+// WithHealthCheckSeverity sets the severity of the checks registered under
+// name. HealthNonCritical checks only mark probes as degraded when failing.
+func WithHealthCheckSeverity(name string, severity HealthSeverity) Option {
+	return func(ms *Micro) error {
+		if name == "" {
+			return errors.New("health check name required")
+		}
+		ms.addHealthCheck(healthCheckRegistration{name: name, severity: severity})
+		return nil
+	}
+}
+
+// HealthPinger is implemented by clients that can check their downstream
+// dependency, such as HTTPClient and ServiceClient.
+type HealthPinger interface {
+	Ping(context.Context) error
+}
+
+// WithClientHealth registers client.Ping as a readiness check with the given
+// severity.
+func WithClientHealth(name string, client HealthPinger, severity HealthSeverity) Option {
+	return func(ms *Micro) error {
+		if name == "" {
+			return errors.New("health check name required")
+		}
+		if client == nil {
+			return errors.New("nil health client provided")
+		}
+		ms.addHealthCheck(healthCheckRegistration{
+			name:      name,
+			readiness: client.Ping,
+			severity:  severity,
+		})
+		return nil
+	}
+}
+
+// WithDebugRoutes enables the /debug/routes and /debug/config endpoints on the
+// HTTP server outside the dev profile too. Debug routes are never mounted when
+// the prod profile is active.
 func WithDebugRoutes() Option {
 	return func(ms *Micro) error {
 		ms.mu.Lock()
 		ms.debugRoutes = true
+		ms.debugOptIn = true
 		ms.mu.Unlock()
 		return nil
 	}
 }
 
 // WithLifecycle registers components whose Start/Stop methods will be invoked
-// by the orchestrator alongside other runners.
+// by the orchestrator alongside other runners. Warmable components are warmed
+// up once the runners started.
 func WithLifecycle(components ...any) Option {
 	return func(ms *Micro) error {
 		for _, component := range components {
@@ -111,6 +153,11 @@ func WithLifecycle(components ...any) Option {
 			if stoppable, ok := component.(Stoppable); ok {
 				ms.addStop(stoppable.Stop)
 			}
+			if warmable, ok := component.(Warmable); ok {
+				ms.mu.Lock()
+				ms.addWarmup(moduleName(component), 0, warmable.Warmup)
+				ms.mu.Unlock()
+			}
 		}
 		return nil
 	}
@@ -130,11 +177,21 @@ func WithConfig(cfg *Config) Option {
 }
 
 // WithRunner appends a lifecycle-managed component to the orchestrator.
-func WithRunner(r Runner) Option {
+// Options can name the runner and bound its start time.
+func WithRunner(r Runner, opts ...RunnerOption) Option {
 	return func(ms *Micro) error {
 		if r == nil {
 			return errors.New("nil runner provided")
 		}
+		if len(opts) > 0 {
+			configured := &configuredRunner{Runner: r}
+			for _, opt := range opts {
+				if opt != nil {
+					opt(configured)
+				}
+			}
+			r = configured
+		}
 		ms.addRunner(r)
 		return nil
 	}
@@ -188,6 +188,56 @@ func TestWithHealthChecks(t *testing.T) {
 	}
 }
 
+type pingerFunc func(context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestWithClientHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkName string
+		client    HealthPinger
+		expectErr bool
+	}{
+		{name: "valid", checkName: "cache", client: pingerFunc(HealthStatusOK)},
+		{name: "emptyName", checkName: "", client: pingerFunc(HealthStatusOK), expectErr: true},
+		{name: "nilClient", checkName: "cache", client: nil, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &Micro{deps: DefaultDeps()}
+			err := WithClientHealth(tt.checkName, tt.client, HealthNonCritical)(ms)
+
+			if tt.expectErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ms.healthChecks) != 1 || ms.healthChecks[0].severity != HealthNonCritical || ms.healthChecks[0].readiness == nil {
+				t.Errorf("unexpected registration %+v", ms.healthChecks)
+			}
+		})
+	}
+}
+
+func TestWithHealthCheckSeverity(t *testing.T) {
+	ms := &Micro{deps: DefaultDeps()}
+	if err := WithHealthCheckSeverity("", HealthNonCritical)(ms); err == nil {
+		t.Error("expected error for empty name")
+	}
+	if err := WithHealthCheckSeverity("cache", HealthNonCritical)(ms); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ms.healthChecks) != 1 || ms.healthChecks[0].severity != HealthNonCritical {
+		t.Errorf("unexpected registration %+v", ms.healthChecks)
+	}
+}
+
 func TestWithDebugRoutes(t *testing.T) {
 	ms := &Micro{deps: DefaultDeps()}
 	opt := WithDebugRoutes()
@@ -199,6 +249,12 @@ func TestWithDebugRoutes(t *testing.T) {
 	if !ms.debugRoutes {
 		t.Error("debugRoutes should be true")
 	}
+	if !ms.DebugRequested() {
+		t.Error("DebugRequested should be true")
+	}
+	if (&Micro{deps: DefaultDeps()}).DebugRequested() {
+		t.Error("DebugRequested should be false without WithDebugRoutes")
+	}
 }
 
 func TestWithLifecycle(t *testing.T) {
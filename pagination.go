@@ -0,0 +1,171 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultCursorParam = "cursor"
+
+// ErrPageRepeated is returned by Pages when a server points back at a page
+// already fetched, which would otherwise loop forever.
+var ErrPageRepeated = errors.New("pagination: next page was already fetched")
+
+// ListOptions controls how Pages and ListAll walk a paginated collection.
+type ListOptions struct {
+	// Query holds the parameters of the first request, e.g. filters or a
+	// page size.
+	Query url.Values
+	// CursorParam is the query parameter set from meta.next_cursor
+	// (default "cursor").
+	CursorParam string
+	// PageDelay is the pause before each following page. It doubles, up to
+	// MaxPageDelay, while the server keeps answering with more pages.
+	PageDelay    time.Duration
+	MaxPageDelay time.Duration
+	// MaxPages stops iteration after that many pages; zero means no limit.
+	MaxPages int
+}
+
+// Page is one response of a paginated collection.
+type Page struct {
+	Number   int
+	Items    []any
+	Response *SuccessResponse
+}
+
+// Pages iterates over a collection, following the "next" link of each
+// response or, when absent, the next_cursor value in its meta. Iteration
+// stops at the last page, on the first error, when the server repeats a page
+// (ErrPageRepeated), or when the loop breaks:
+//
+//	for page, err := range client.Pages(ctx, "tasks", aqm.ListOptions{}) {
+//		if err != nil { ... }
+//	}
+func (c *ServiceClient) Pages(ctx context.Context, resource string, opts ListOptions) iter.Seq2[*Page, error] {
+	return func(yield func(*Page, error) bool) {
+		path := "/" + strings.TrimPrefix(resource, "/")
+		if len(opts.Query) > 0 {
+			path += "?" + opts.Query.Encode()
+		}
+		delay := opts.PageDelay
+		seen := map[string]bool{path: true}
+
+		for number := 1; ; number++ {
+			resp, err := c.Request(ctx, "GET", path, nil)
+			if err != nil {
+				yield(nil, fmt.Errorf("page %d: %w", number, err))
+				return
+			}
+			if !yield(&Page{Number: number, Items: pageItems(resp.Data), Response: resp}, nil) {
+				return
+			}
+			if opts.MaxPages > 0 && number >= opts.MaxPages {
+				return
+			}
+			next, ok := c.nextPagePath(path, resp, opts)
+			if !ok {
+				return
+			}
+			if seen[next] {
+				yield(nil, fmt.Errorf("page %d: %w: %s", number+1, ErrPageRepeated, next))
+				return
+			}
+			seen[next] = true
+			path = next
+
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					yield(nil, ctx.Err())
+					return
+				case <-time.After(delay):
+				}
+				delay *= 2
+				if opts.MaxPageDelay > 0 && delay > opts.MaxPageDelay {
+					delay = opts.MaxPageDelay
+				}
+			}
+		}
+	}
+}
+
+// ListAll collects the items of every page of a collection.
+func (c *ServiceClient) ListAll(ctx context.Context, resource string, opts ListOptions) ([]any, error) {
+	var items []any
+	for page, err := range c.Pages(ctx, resource, opts) {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+func pageItems(data any) []any {
+	switch v := data.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	default:
+		return []any{v}
+	}
+}
+
+// nextPagePath resolves the request path of the page after resp.
+func (c *ServiceClient) nextPagePath(current string, resp *SuccessResponse, opts ListOptions) (string, bool) {
+	for _, link := range resp.Links {
+		if link.Rel == RelNext && link.Href != "" {
+			return c.relativePath(link.Href), true
+		}
+	}
+
+	meta, _ := resp.Meta.(map[string]any)
+	cursor := metaString(meta, "next_cursor", "nextCursor")
+	if cursor == "" {
+		if href := metaString(meta, "next"); href != "" {
+			return c.relativePath(href), true
+		}
+		return "", false
+	}
+
+	param := opts.CursorParam
+	if param == "" {
+		param = defaultCursorParam
+	}
+	u, err := url.Parse(current)
+	if err != nil {
+		return "", false
+	}
+	query := u.Query()
+	query.Set(param, cursor)
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
+
+// relativePath strips the client base URL, or the scheme and host of other
+// absolute links, so the request goes through the underlying HTTPClient.
+func (c *ServiceClient) relativePath(href string) string {
+	if c.baseURL != "" && strings.HasPrefix(href, c.baseURL) {
+		return strings.TrimPrefix(href, c.baseURL)
+	}
+	if u, err := url.Parse(href); err == nil && u.IsAbs() {
+		return u.RequestURI()
+	}
+	return href
+}
+
+func metaString(meta map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := meta[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServiceClientPagesFollowsLinks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if r.URL.Query().Get("status") != "open" {
+			t.Errorf("expected filters to be kept, got %q", r.URL.RawQuery)
+		}
+		var links []Link
+		if page < 3 {
+			links = append(links, Link{Rel: RelNext, Href: server.URL + "/tasks?status=open&page=" + strconv.Itoa(page+1)})
+		}
+		RespondSuccess(w, []any{page * 10, page*10 + 1}, links...)
+	}))
+	defer server.Close()
+
+	client := NewServiceClient(server.URL)
+	items, err := client.ListAll(context.Background(), "tasks", ListOptions{Query: url.Values{"status": {"open"}}})
+	if err != nil {
+		t.Fatalf("list all: %v", err)
+	}
+	if len(items) != 6 || items[0] != float64(10) || items[5] != float64(31) {
+		t.Errorf("unexpected items %v", items)
+	}
+}
+
+func TestServiceClientPagesFollowsCursor(t *testing.T) {
+	cursors := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("after")
+		cursors = append(cursors, cursor)
+		meta := map[string]any{}
+		if cursor == "" {
+			meta["next_cursor"] = "abc"
+		}
+		Respond(w, http.StatusOK, []any{"item-" + cursor}, meta)
+	}))
+	defer server.Close()
+
+	client := NewServiceClient(server.URL)
+	var numbers []int
+	for page, err := range client.Pages(context.Background(), "tasks", ListOptions{CursorParam: "after", PageDelay: time.Millisecond}) {
+		if err != nil {
+			t.Fatalf("page: %v", err)
+		}
+		numbers = append(numbers, page.Number)
+	}
+	if len(numbers) != 2 || cursors[1] != "abc" {
+		t.Errorf("expected two pages with cursor, got pages %v cursors %v", numbers, cursors)
+	}
+}
+
+func TestServiceClientPagesStops(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		RespondSuccess(w, []any{calls}, Link{Rel: RelNext, Href: "/tasks?page=" + strconv.Itoa(calls+1)})
+	}))
+	defer server.Close()
+	client := NewServiceClient(server.URL)
+
+	items, err := client.ListAll(context.Background(), "tasks", ListOptions{MaxPages: 3})
+	if err != nil || len(items) != 3 {
+		t.Fatalf("expected 3 items within MaxPages, got %v (%v)", items, err)
+	}
+
+	calls = 0
+	for page := range client.Pages(context.Background(), "tasks", ListOptions{}) {
+		if page.Number == 2 {
+			break
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected iteration to stop on break, got %d calls", calls)
+	}
+}
+
+func TestServiceClientPagesRepeatedCursor(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		next := "b"
+		if r.URL.Query().Get("cursor") == "b" {
+			next = "a"
+		}
+		Respond(w, http.StatusOK, []any{calls}, map[string]any{"next_cursor": next})
+	}))
+	defer server.Close()
+
+	items, err := NewServiceClient(server.URL).ListAll(context.Background(), "tasks", ListOptions{})
+	if !errors.Is(err, ErrPageRepeated) {
+		t.Fatalf("expected ErrPageRepeated, got %v", err)
+	}
+	if calls != 3 || len(items) != 3 {
+		t.Errorf("expected 3 pages before the loop was detected, got %d calls and items %v", calls, items)
+	}
+}
+
+func TestServiceClientPagesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondError(w, http.StatusNotFound, "missing")
+	}))
+	defer server.Close()
+
+	_, err := NewServiceClient(server.URL).ListAll(context.Background(), "tasks", ListOptions{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
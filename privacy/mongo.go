@@ -0,0 +1,88 @@
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps consents in the _consents collection.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+var _ ConsentStore = (*MongoStore)(nil)
+
+// NewMongoStore stores consents in db.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection("_consents")}
+}
+
+type consentDocument struct {
+	ID          string     `bson:"_id"`
+	UserID      string     `bson:"user_id"`
+	Type        string     `bson:"type"`
+	Scope       string     `bson:"scope,omitempty"`
+	Timestamp   time.Time  `bson:"timestamp"`
+	SourceIP    string     `bson:"source_ip,omitempty"`
+	WithdrawnAt *time.Time `bson:"withdrawn_at,omitempty"`
+}
+
+// EnsureIndexes creates the index consents are listed by.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("privacy: create consent index: %w", err)
+	}
+	return nil
+}
+
+// SaveConsent implements ConsentStore.
+func (s *MongoStore) SaveConsent(ctx context.Context, consent Consent) error {
+	d := consentDocument{
+		ID:          consent.ID.String(),
+		UserID:      consent.UserID.String(),
+		Type:        consent.Record.Type,
+		Scope:       consent.Record.Scope,
+		Timestamp:   consent.Record.Timestamp,
+		SourceIP:    consent.Record.SourceIP,
+		WithdrawnAt: consent.WithdrawnAt,
+	}
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("privacy: save consent %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// ListConsents implements ConsentStore.
+func (s *MongoStore) ListConsents(ctx context.Context, userID uuid.UUID) ([]Consent, error) {
+	cur, err := s.collection.Find(ctx, bson.M{"user_id": userID.String()},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("privacy: list consents: %w", err)
+	}
+	var docs []consentDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("privacy: decode consents: %w", err)
+	}
+	out := make([]Consent, 0, len(docs))
+	for _, d := range docs {
+		id, _ := uuid.Parse(d.ID)
+		out = append(out, Consent{
+			ID:          id,
+			UserID:      userID,
+			Record:      auth.ConsentRecord{Type: d.Type, Scope: d.Scope, Timestamp: d.Timestamp, SourceIP: d.SourceIP},
+			WithdrawnAt: d.WithdrawnAt,
+		})
+	}
+	return out, nil
+}
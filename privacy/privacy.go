@@ -0,0 +1,456 @@
+// Package privacy implements the data subject rights services owe under
+// GDPR-like regulations: consent capture and withdrawal, export of a user's
+// data and erasure or anonymization, with personal data collected from the
+// DataProviders each service registers. Exports and erasures run as
+// operations so clients poll for the result.
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/aquamarinepk/aqm/operations"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBasePath = "/privacy"
+
+	// Operation kinds submitted to the operations manager.
+	KindExport  = "privacy.export"
+	KindErasure = "privacy.erasure"
+)
+
+// ErrNoConsent is returned when withdrawing a consent that is not active.
+var ErrNoConsent = errors.New("privacy: no active consent")
+
+// Module manages consents and runs exports and erasures. It implements
+// aqm.HTTPModule.
+type Module struct {
+	store        ConsentStore
+	ops          *operations.Manager
+	ownsOps      bool
+	providers    []DataProvider
+	consentTypes []string
+	erasureMode  ErasureMode
+	subject      func(r *http.Request) (uuid.UUID, error)
+	basePath     string
+	log          aqm.Logger
+	now          func() time.Time
+}
+
+// Option configures a Module.
+type Option func(*Module)
+
+// WithProvider registers data providers.
+func WithProvider(providers ...DataProvider) Option {
+	return func(m *Module) {
+		for _, p := range providers {
+			if p != nil {
+				m.providers = append(m.providers, p)
+			}
+		}
+	}
+}
+
+// WithOperations runs exports and erasures on ops. Without it the module
+// creates a manager and mounts its polling endpoint under the base path.
+func WithOperations(ops *operations.Manager) Option {
+	return func(m *Module) {
+		if ops != nil {
+			m.ops = ops
+		}
+	}
+}
+
+// WithConsentTypes restricts the consent types that can be captured.
+func WithConsentTypes(types ...string) Option {
+	return func(m *Module) {
+		m.consentTypes = append(m.consentTypes, types...)
+	}
+}
+
+// WithErasureMode sets the mode used when an erasure request names none
+// (defaults to EraseAnonymize).
+func WithErasureMode(mode ErasureMode) Option {
+	return func(m *Module) {
+		if mode.Valid() {
+			m.erasureMode = mode
+		}
+	}
+}
+
+// WithSubject overrides how the user a request acts on is resolved. The
+// default is the subject of the request claims, so users manage their own
+// data; admin tooling can resolve it from a path parameter instead.
+func WithSubject(fn func(r *http.Request) (uuid.UUID, error)) Option {
+	return func(m *Module) {
+		if fn != nil {
+			m.subject = fn
+		}
+	}
+}
+
+// WithBasePath overrides the mount point (defaults to /privacy).
+func WithBasePath(base string) Option {
+	return func(m *Module) {
+		if base != "" {
+			m.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithLogger wires the logger audit lines are written to.
+func WithLogger(logger aqm.Logger) Option {
+	return func(m *Module) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// New returns a Module keeping consents in store. A nil store defaults to
+// memory.
+func New(store ConsentStore, opts ...Option) *Module {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	m := &Module{
+		store:       store,
+		erasureMode: EraseAnonymize,
+		subject:     claimsSubject,
+		basePath:    defaultBasePath,
+		log:         aqm.NewNoopLogger(),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	if m.ops == nil {
+		m.ops = operations.NewManager(nil, operations.WithBasePath(m.basePath+"/operations"), operations.WithLogger(m.log))
+		m.ownsOps = true
+	}
+	return m
+}
+
+// RegisterRoutes implements aqm.HTTPModule:
+//
+//	GET    {base}/consents         list the user's consents
+//	POST   {base}/consents         capture a consent
+//	DELETE {base}/consents/{type}  withdraw a consent
+//	POST   {base}/export           start an export, 202 with the operation
+//	POST   {base}/erasure          start an erasure, 202 with the operation
+func (m *Module) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Route(m.basePath, func(r chi.Router) {
+		r.Get("/consents", m.handleListConsents)
+		r.Post("/consents", m.handleRecordConsent)
+		r.Delete("/consents/{type}", m.handleWithdrawConsent)
+		r.Post("/export", m.handleExport)
+		r.Post("/erasure", m.handleErasure)
+	})
+	if m.ownsOps {
+		m.ops.RegisterRoutes(r)
+	}
+}
+
+// RecordConsent captures a consent of userID.
+func (m *Module) RecordConsent(ctx context.Context, userID uuid.UUID, record auth.ConsentRecord) (Consent, error) {
+	if record.Timestamp.IsZero() {
+		record.Timestamp = m.now().UTC()
+	}
+	consent := Consent{ID: uuid.New(), UserID: userID, Record: record}
+	if err := m.store.SaveConsent(ctx, consent); err != nil {
+		return Consent{}, fmt.Errorf("privacy: save consent: %w", err)
+	}
+	m.log.Info("consent recorded", "user_id", userID, "type", record.Type, "scope", record.Scope,
+		"source_ip", record.SourceIP)
+	return consent, nil
+}
+
+// WithdrawConsent withdraws every active consent of consentType.
+func (m *Module) WithdrawConsent(ctx context.Context, userID uuid.UUID, consentType string) error {
+	consents, err := m.store.ListConsents(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("privacy: list consents: %w", err)
+	}
+	withdrawn := 0
+	for _, c := range consents {
+		if !c.Active() || (consentType != "" && c.Record.Type != consentType) {
+			continue
+		}
+		at := m.now().UTC()
+		c.WithdrawnAt = &at
+		if err := m.store.SaveConsent(ctx, c); err != nil {
+			return fmt.Errorf("privacy: withdraw consent: %w", err)
+		}
+		withdrawn++
+	}
+	if withdrawn == 0 {
+		return ErrNoConsent
+	}
+	m.log.Info("consent withdrawn", "user_id", userID, "type", consentType, "count", withdrawn)
+	return nil
+}
+
+// HasConsent reports whether userID has an active consent of consentType.
+// An empty scope matches any scope.
+func (m *Module) HasConsent(ctx context.Context, userID uuid.UUID, consentType, scope string) (bool, error) {
+	consents, err := m.store.ListConsents(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("privacy: list consents: %w", err)
+	}
+	for _, c := range consents {
+		if c.Active() && c.Record.Type == consentType && (scope == "" || c.Record.Scope == scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Export is the document assembled for a data export.
+type Export struct {
+	UserID      uuid.UUID      `json:"user_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Consents    []Consent      `json:"consents"`
+	Data        map[string]any `json:"data"`
+}
+
+// Export assembles the consents of userID and the records of every
+// provider. It fails if any provider fails, so exports are never partial.
+func (m *Module) Export(ctx context.Context, userID uuid.UUID) (*Export, error) {
+	return m.export(ctx, userID, nil)
+}
+
+func (m *Module) export(ctx context.Context, userID uuid.UUID, p *operations.Progress) (*Export, error) {
+	consents, err := m.store.ListConsents(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("privacy: list consents: %w", err)
+	}
+	out := &Export{UserID: userID, GeneratedAt: m.now().UTC(), Consents: consents, Data: map[string]any{}}
+	for i, provider := range m.providers {
+		data, err := provider.Export(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("privacy: export %s: %w", provider.Name(), err)
+		}
+		if data != nil {
+			out.Data[provider.Name()] = data
+		}
+		m.progress(ctx, p, i+1, "exported "+provider.Name())
+	}
+	m.log.Info("personal data exported", "user_id", userID, "providers", len(m.providers))
+	return out, nil
+}
+
+// ErasureReport lists the outcome of an erasure per provider.
+type ErasureReport struct {
+	UserID    uuid.UUID         `json:"user_id"`
+	Mode      ErasureMode       `json:"mode"`
+	Providers map[string]string `json:"providers"`
+}
+
+// Erase runs every provider's erasure hook and withdraws the user's
+// consents. Providers run even after one fails; the error names all
+// failures, and a retried erasure repeats the hooks, which must therefore be
+// idempotent.
+func (m *Module) Erase(ctx context.Context, userID uuid.UUID, mode ErasureMode) (*ErasureReport, error) {
+	return m.erase(ctx, userID, mode, nil)
+}
+
+func (m *Module) erase(ctx context.Context, userID uuid.UUID, mode ErasureMode, p *operations.Progress) (*ErasureReport, error) {
+	if !mode.Valid() {
+		mode = m.erasureMode
+	}
+	report := &ErasureReport{UserID: userID, Mode: mode, Providers: map[string]string{}}
+	var errs []error
+	for i, provider := range m.providers {
+		if err := provider.Erase(ctx, userID, mode); err != nil {
+			report.Providers[provider.Name()] = "failed: " + err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			m.log.Error("personal data erasure failed", "user_id", userID, "provider", provider.Name(), "error", err)
+		} else {
+			report.Providers[provider.Name()] = "erased"
+		}
+		m.progress(ctx, p, i+1, "erased "+provider.Name())
+	}
+	if err := m.WithdrawConsent(ctx, userID, ""); err != nil && !errors.Is(err, ErrNoConsent) {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return report, fmt.Errorf("privacy: erasure incomplete: %w", errors.Join(errs...))
+	}
+	m.log.Info("personal data erased", "user_id", userID, "mode", mode, "providers", len(m.providers))
+	return report, nil
+}
+
+func (m *Module) progress(ctx context.Context, p *operations.Progress, done int, message string) {
+	if p == nil || len(m.providers) == 0 {
+		return
+	}
+	if err := p.Update(ctx, done*100/len(m.providers), message); err != nil {
+		m.log.Error("cannot update privacy operation", "error", err)
+	}
+}
+
+// ConsentInput is the body of consent capture.
+type ConsentInput struct {
+	Type  string `json:"type"`
+	Scope string `json:"scope"`
+}
+
+// ErasureInput is the body of erasure requests.
+type ErasureInput struct {
+	Mode ErasureMode `json:"mode,omitempty"`
+}
+
+func (m *Module) handleListConsents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.resolveSubject(w, r)
+	if !ok {
+		return
+	}
+	consents, err := m.store.ListConsents(r.Context(), userID)
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	if consents == nil {
+		consents = []Consent{}
+	}
+	aqm.RespondSuccess(w, consents)
+}
+
+func (m *Module) handleRecordConsent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.resolveSubject(w, r)
+	if !ok {
+		return
+	}
+	var in ConsentInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		aqm.Error(w, http.StatusBadRequest, "invalid_body", "request body is not valid JSON")
+		return
+	}
+	in.Type = strings.TrimSpace(in.Type)
+	if in.Type == "" {
+		aqm.Error(w, http.StatusUnprocessableEntity, "validation_failed", "request is invalid",
+			aqm.ValidationError{Field: "type", Code: "required", Message: "consent type is required"})
+		return
+	}
+	if len(m.consentTypes) > 0 && !slices.Contains(m.consentTypes, in.Type) {
+		aqm.Error(w, http.StatusUnprocessableEntity, "validation_failed", "request is invalid",
+			aqm.ValidationError{Field: "type", Code: "unsupported", Message: "unknown consent type " + in.Type})
+		return
+	}
+	consent, err := m.RecordConsent(r.Context(), userID, auth.ConsentRecord{
+		Type:     in.Type,
+		Scope:    in.Scope,
+		SourceIP: aqmctx.ClientIP(r),
+	})
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	aqm.Respond(w, http.StatusCreated, consent, nil)
+}
+
+func (m *Module) handleWithdrawConsent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.resolveSubject(w, r)
+	if !ok {
+		return
+	}
+	if err := m.WithdrawConsent(r.Context(), userID, chi.URLParam(r, "type")); err != nil {
+		m.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Module) handleExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.resolveSubject(w, r)
+	if !ok {
+		return
+	}
+	op, err := m.ops.Submit(aqm.Detach(r.Context()), KindExport, func(ctx context.Context, p *operations.Progress) (any, error) {
+		return m.export(ctx, userID, p)
+	})
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	m.log.Info("personal data export requested", "user_id", userID, "operation_id", op.ID, "actor", actor(r))
+	m.ops.RespondAccepted(w, op)
+}
+
+func (m *Module) handleErasure(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.resolveSubject(w, r)
+	if !ok {
+		return
+	}
+	var in ErasureInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			aqm.Error(w, http.StatusBadRequest, "invalid_body", "request body is not valid JSON")
+			return
+		}
+	}
+	if in.Mode != "" && !in.Mode.Valid() {
+		aqm.Error(w, http.StatusUnprocessableEntity, "validation_failed", "request is invalid",
+			aqm.ValidationError{Field: "mode", Code: "unsupported", Message: "mode must be anonymize or delete"})
+		return
+	}
+	op, err := m.ops.Submit(aqm.Detach(r.Context()), KindErasure, func(ctx context.Context, p *operations.Progress) (any, error) {
+		return m.erase(ctx, userID, in.Mode, p)
+	})
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	m.log.Info("personal data erasure requested", "user_id", userID, "operation_id", op.ID, "actor", actor(r))
+	m.ops.RespondAccepted(w, op)
+}
+
+func (m *Module) resolveSubject(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := m.subject(r)
+	if err != nil {
+		aqm.Error(w, http.StatusUnauthorized, "unauthenticated", "cannot resolve the data subject")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func (m *Module) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNoConsent) {
+		aqm.Error(w, http.StatusNotFound, "consent_not_found", "no active consent of this type")
+		return
+	}
+	m.log.Error("privacy request failed", "error", err)
+	aqm.Error(w, http.StatusInternalServerError, "privacy_failed", "cannot process privacy request")
+}
+
+func claimsSubject(r *http.Request) (uuid.UUID, error) {
+	claims := auth.ClaimsFrom(r.Context())
+	if claims == nil {
+		return uuid.Nil, errors.New("privacy: no claims")
+	}
+	return uuid.Parse(claims.Subject)
+}
+
+func actor(r *http.Request) string {
+	if a := auth.ActorFrom(r.Context()); a != nil {
+		return a.Subject
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package privacy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/aquamarinepk/aqm/operations"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type syncQueue struct{}
+
+func (syncQueue) Enqueue(ctx context.Context, task func(context.Context) error) error {
+	return task(ctx)
+}
+
+func newRouter(t *testing.T, opts ...Option) (chi.Router, *Module, *operations.Manager) {
+	t.Helper()
+	ops := operations.NewManager(nil, operations.WithQueue(syncQueue{}))
+	m := New(nil, append([]Option{WithOperations(ops)}, opts...)...)
+	r := chi.NewRouter()
+	m.RegisterRoutes(r)
+	ops.RegisterRoutes(r)
+	return r, m, ops
+}
+
+func do(r chi.Router, userID uuid.UUID, method, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req = req.WithContext(auth.WithClaims(req.Context(), &auth.TokenClaims{Subject: userID.String()}))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func operation(t *testing.T, ops *operations.Manager, rec *httptest.ResponseRecorder) *operations.Operation {
+	t.Helper()
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d %s", rec.Code, rec.Body)
+	}
+	var env struct {
+		Data operations.Operation `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	op, err := ops.Get(context.Background(), env.Data.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return op
+}
+
+func TestConsentCaptureAndWithdrawal(t *testing.T) {
+	r, m, _ := newRouter(t, WithConsentTypes("marketing", "analytics"))
+	user := uuid.New()
+
+	if rec := do(r, user, http.MethodPost, "/privacy/consents", ConsentInput{Type: "marketing", Scope: "email"}); rec.Code != http.StatusCreated {
+		t.Fatalf("capture: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(r, user, http.MethodPost, "/privacy/consents", ConsentInput{Type: "profiling"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown type: %d", rec.Code)
+	}
+
+	ok, err := m.HasConsent(context.Background(), user, "marketing", "email")
+	if err != nil || !ok {
+		t.Fatalf("HasConsent = %v, %v", ok, err)
+	}
+
+	if rec := do(r, user, http.MethodDelete, "/privacy/consents/marketing", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("withdraw: %d %s", rec.Code, rec.Body)
+	}
+	if ok, _ := m.HasConsent(context.Background(), user, "marketing", ""); ok {
+		t.Error("consent still active after withdrawal")
+	}
+	if rec := do(r, user, http.MethodDelete, "/privacy/consents/marketing", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second withdrawal: %d", rec.Code)
+	}
+
+	var env struct {
+		Data []Consent `json:"data"`
+	}
+	rec := do(r, user, http.MethodGet, "/privacy/consents", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Data) != 1 || env.Data[0].WithdrawnAt == nil || env.Data[0].Record.SourceIP == "" {
+		t.Errorf("consents = %+v", env.Data)
+	}
+}
+
+func TestExportAssemblesProviders(t *testing.T) {
+	orders := ProviderFuncs{
+		ProviderName: "orders",
+		ExportFunc: func(_ context.Context, userID uuid.UUID) (any, error) {
+			return []string{"order-1", "order-2"}, nil
+		},
+	}
+	r, m, ops := newRouter(t, WithProvider(orders))
+	user := uuid.New()
+	if _, err := m.RecordConsent(context.Background(), user, auth.ConsentRecord{Type: "terms"}); err != nil {
+		t.Fatal(err)
+	}
+
+	op := operation(t, ops, do(r, user, http.MethodPost, "/privacy/export", nil))
+	if op.Status != operations.StatusSucceeded || op.Kind != KindExport {
+		t.Fatalf("operation = %+v", op)
+	}
+	export := op.Result.(*Export)
+	if export.UserID != user || len(export.Consents) != 1 || export.Data["orders"] == nil {
+		t.Errorf("export = %+v", export)
+	}
+}
+
+func TestErasureRunsEveryProvider(t *testing.T) {
+	var erased []string
+	hook := func(name string, err error) DataProvider {
+		return ProviderFuncs{ProviderName: name, EraseFunc: func(_ context.Context, _ uuid.UUID, mode ErasureMode) error {
+			erased = append(erased, name+":"+string(mode))
+			return err
+		}}
+	}
+	r, m, ops := newRouter(t, WithProvider(hook("profile", nil), hook("billing", errors.New("ledger locked")), hook("files", nil)))
+	user := uuid.New()
+	if _, err := m.RecordConsent(context.Background(), user, auth.ConsentRecord{Type: "marketing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	op := operation(t, ops, do(r, user, http.MethodPost, "/privacy/erasure", ErasureInput{Mode: EraseDelete}))
+	if op.Status != operations.StatusFailed {
+		t.Fatalf("status = %s, want failed", op.Status)
+	}
+	want := []string{"profile:delete", "billing:delete", "files:delete"}
+	if len(erased) != len(want) {
+		t.Fatalf("erased = %v", erased)
+	}
+	for i := range want {
+		if erased[i] != want[i] {
+			t.Errorf("erased[%d] = %s, want %s", i, erased[i], want[i])
+		}
+	}
+	if ok, _ := m.HasConsent(context.Background(), user, "marketing", ""); ok {
+		t.Error("erasure left consent active")
+	}
+
+	report, err := m.Erase(context.Background(), user, "")
+	if err == nil || report.Mode != EraseAnonymize || report.Providers["profile"] != "erased" {
+		t.Errorf("report = %+v, err = %v", report, err)
+	}
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	u := auth.User{ID: uuid.New(), Username: "bjensen", Name: "Barbara", EmailCT: []byte{1}, PasswordHash: []byte{2}, Status: auth.UserStatusActive}
+	AnonymizeUser(&u)
+	if u.Username == "bjensen" || u.Name != "" || u.EmailCT != nil || u.PasswordHash != nil || u.Status != auth.UserStatusDeleted {
+		t.Errorf("user = %+v", u)
+	}
+}
+
+func TestRequiresSubject(t *testing.T) {
+	r, _, _ := newRouter(t)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/privacy/consents", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
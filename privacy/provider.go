@@ -0,0 +1,73 @@
+package privacy
+
+import (
+	"context"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+)
+
+// ErasureMode selects how a provider forgets a user.
+type ErasureMode string
+
+const (
+	// EraseAnonymize keeps records needed for accounting or integrity but
+	// strips everything identifying the user.
+	EraseAnonymize ErasureMode = "anonymize"
+	// EraseDelete removes the records.
+	EraseDelete ErasureMode = "delete"
+)
+
+// Valid reports whether m is a known mode.
+func (m ErasureMode) Valid() bool {
+	return m == EraseAnonymize || m == EraseDelete
+}
+
+// DataProvider owns part of a user's personal data. Each service holding
+// personal data registers one, so exports and erasures cover all of it.
+type DataProvider interface {
+	// Name identifies the provider in exports and erasure reports.
+	Name() string
+	// Export returns the provider's records of the user, JSON encodable.
+	Export(ctx context.Context, userID uuid.UUID) (any, error)
+	// Erase deletes or anonymizes the provider's records of the user.
+	Erase(ctx context.Context, userID uuid.UUID, mode ErasureMode) error
+}
+
+// ProviderFuncs adapts functions to DataProvider. A nil hook is skipped.
+type ProviderFuncs struct {
+	ProviderName string
+	ExportFunc   func(ctx context.Context, userID uuid.UUID) (any, error)
+	EraseFunc    func(ctx context.Context, userID uuid.UUID, mode ErasureMode) error
+}
+
+// Name implements DataProvider.
+func (p ProviderFuncs) Name() string { return p.ProviderName }
+
+// Export implements DataProvider.
+func (p ProviderFuncs) Export(ctx context.Context, userID uuid.UUID) (any, error) {
+	if p.ExportFunc == nil {
+		return nil, nil
+	}
+	return p.ExportFunc(ctx, userID)
+}
+
+// Erase implements DataProvider.
+func (p ProviderFuncs) Erase(ctx context.Context, userID uuid.UUID, mode ErasureMode) error {
+	if p.EraseFunc == nil {
+		return nil
+	}
+	return p.EraseFunc(ctx, userID, mode)
+}
+
+// AnonymizeUser strips the identifying and secret fields of u and marks it
+// deleted, keeping the ID so references stay valid.
+func AnonymizeUser(u *auth.User) {
+	u.Username = "deleted-" + u.ID.String()[:8]
+	u.Name = ""
+	u.EmailCT, u.EmailIV, u.EmailTag, u.EmailLookup = nil, nil, nil, nil
+	u.PasswordHash, u.PasswordSalt = nil, nil
+	u.MFASecretCT = nil
+	u.PINCT, u.PINIV, u.PINTag, u.PINLookup = nil, nil, nil, nil
+	u.Status = auth.UserStatusDeleted
+}
@@ -0,0 +1,64 @@
+package privacy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+)
+
+// Consent is one captured auth.ConsentRecord of a user. Withdrawn consents
+// are kept as evidence of what was granted and when.
+type Consent struct {
+	ID          uuid.UUID          `json:"id"`
+	UserID      uuid.UUID          `json:"user_id"`
+	Record      auth.ConsentRecord `json:"record"`
+	WithdrawnAt *time.Time         `json:"withdrawn_at,omitempty"`
+}
+
+// Active reports whether the consent has not been withdrawn.
+func (c Consent) Active() bool {
+	return c.WithdrawnAt == nil
+}
+
+// ConsentStore persists consents.
+type ConsentStore interface {
+	SaveConsent(ctx context.Context, consent Consent) error
+	ListConsents(ctx context.Context, userID uuid.UUID) ([]Consent, error)
+}
+
+// MemoryStore keeps consents in process memory.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	consents map[uuid.UUID]Consent
+}
+
+// NewMemoryStore builds an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{consents: make(map[uuid.UUID]Consent)}
+}
+
+// SaveConsent implements ConsentStore, inserting or replacing by ID.
+func (s *MemoryStore) SaveConsent(_ context.Context, consent Consent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consents[consent.ID] = consent
+	return nil
+}
+
+// ListConsents implements ConsentStore, oldest first.
+func (s *MemoryStore) ListConsents(_ context.Context, userID uuid.UUID) ([]Consent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Consent
+	for _, c := range s.consents {
+		if c.UserID == userID {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Record.Timestamp.Before(out[j].Record.Timestamp) })
+	return out, nil
+}
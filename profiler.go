@@ -0,0 +1,334 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProfilerConfig configures continuous profiling, bound from "profiler".
+// URL is the base address of a Pyroscope-compatible server receiving
+// profiles on /ingest; empty leaves profiling off. Every Interval the
+// profiler records a CPU profile for CPUDuration and snapshots the heap, as
+// listed in Profiles. Labels are attached to every upload next to the
+// service name and version.
+type ProfilerConfig struct {
+	URL         string            `koanf:"url"`
+	Interval    time.Duration     `koanf:"interval" default:"60s"`
+	CPUDuration time.Duration     `koanf:"cpu_duration" default:"10s"`
+	Timeout     time.Duration     `koanf:"timeout" default:"10s"`
+	Profiles    []string          `koanf:"profiles" default:"cpu,heap"`
+	AuthToken   string            `koanf:"auth_token"`
+	Labels      map[string]string `koanf:"labels"`
+}
+
+// ProfilerOption customises Profiler.
+type ProfilerOption func(*Profiler)
+
+// WithProfilerLogger reports failed captures and uploads to logger.
+func WithProfilerLogger(logger Logger) ProfilerOption {
+	return func(p *Profiler) {
+		if logger != nil {
+			p.log = logger
+		}
+	}
+}
+
+// WithProfilerHTTPClient sets the client uploads are sent with.
+func WithProfilerHTTPClient(client *http.Client) ProfilerOption {
+	return func(p *Profiler) {
+		if client != nil {
+			p.client = client
+		}
+	}
+}
+
+// WithProfilerApplication names the application profiles are filed under;
+// WithProfiler uses service.name.
+func WithProfilerApplication(name string) ProfilerOption {
+	return func(p *Profiler) {
+		if name != "" {
+			p.app = name
+		}
+	}
+}
+
+// WithProfilerLabels adds labels to every upload.
+func WithProfilerLabels(labels map[string]string) ProfilerOption {
+	return func(p *Profiler) {
+		for k, v := range labels {
+			if v != "" {
+				p.labels[profileLabel(k)] = v
+			}
+		}
+	}
+}
+
+// Profiler captures CPU and heap profiles on an interval and uploads them,
+// so performance can be compared across the fleet without attaching to a
+// single instance. It implements Runner and NamedRunner.
+type Profiler struct {
+	cfg    ProfilerConfig
+	app    string
+	labels map[string]string
+	log    Logger
+	client *http.Client
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var (
+	_ Runner      = (*Profiler)(nil)
+	_ NamedRunner = (*Profiler)(nil)
+)
+
+// NewProfiler builds a profiler uploading to cfg.URL; Start begins the
+// captures.
+func NewProfiler(cfg ProfilerConfig, opts ...ProfilerOption) (*Profiler, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("profiler: url is required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.CPUDuration <= 0 || cfg.CPUDuration > cfg.Interval {
+		cfg.CPUDuration = min(10*time.Second, cfg.Interval)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if len(cfg.Profiles) == 0 {
+		cfg.Profiles = []string{"cpu", "heap"}
+	}
+	for _, kind := range cfg.Profiles {
+		if kind != "cpu" && kind != "heap" {
+			return nil, fmt.Errorf("profiler: unknown profile %q", kind)
+		}
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	p := &Profiler{
+		cfg:    cfg,
+		app:    "aqm",
+		labels: make(map[string]string),
+		log:    NewNoopLogger(),
+	}
+	WithProfilerLabels(cfg.Labels)(p)
+	p.client = &http.Client{Timeout: cfg.Timeout}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+	return p, nil
+}
+
+// WithProfiler registers a Profiler runner when the config sets
+// profiler.url, filing profiles under service.name and labelling them with
+// service.version. Apply it after WithConfig; without a URL it does
+// nothing.
+func WithProfiler(opts ...ProfilerOption) Option {
+	return func(ms *Micro) error {
+		deps := ms.Deps()
+		cfg, err := BindEnv[ProfilerConfig](deps.Config, "profiler")
+		if err != nil {
+			return err
+		}
+		if cfg.URL == "" {
+			return nil
+		}
+		labels := map[string]string{"service_version": deps.Config.GetStringOrDef("service.version", "")}
+		opts = append([]ProfilerOption{
+			WithProfilerLogger(deps.Logger),
+			WithProfilerApplication(deps.Config.GetStringOrDef("service.name", "")),
+			WithProfilerLabels(labels),
+		}, opts...)
+		profiler, err := NewProfiler(cfg, opts...)
+		if err != nil {
+			return err
+		}
+		return WithRunner(profiler)(ms)
+	}
+}
+
+// Name implements NamedRunner.
+func (p *Profiler) Name() string {
+	return "profiler"
+}
+
+// Start launches the capture loop.
+func (p *Profiler) Start(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go p.loop(ctx, p.done)
+	return nil
+}
+
+// Stop halts the capture loop, abandoning a CPU profile in progress.
+func (p *Profiler) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Profiler) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Collect(ctx); err != nil && ctx.Err() == nil {
+			p.log.Error("profiler: collection failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect captures the configured profiles once and uploads them. The CPU
+// profile takes CPUDuration and fails while another CPU profile is running,
+// e.g. one requested from /debug/pprof; the other profiles still go out.
+func (p *Profiler) Collect(ctx context.Context) error {
+	var errs []error
+	for _, kind := range p.cfg.Profiles {
+		from := time.Now()
+		var buf bytes.Buffer
+		var err error
+		switch kind {
+		case "cpu":
+			err = p.captureCPU(ctx, &buf)
+		case "heap":
+			err = pprof.Lookup("heap").WriteTo(&buf, 0)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			err = p.upload(ctx, kind, from, time.Now(), &buf)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s profile: %w", kind, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Profiler) captureCPU(ctx context.Context, buf *bytes.Buffer) error {
+	if err := pprof.StartCPUProfile(buf); err != nil {
+		return err
+	}
+	timer := time.NewTimer(p.cfg.CPUDuration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	pprof.StopCPUProfile()
+	return nil
+}
+
+// upload posts a gzipped pprof profile the way the Pyroscope ingest API
+// expects: the application, kind and labels in the name parameter and the
+// profile as a multipart file.
+func (p *Profiler) upload(ctx context.Context, kind string, from, until time.Time, profile io.Reader) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, profile); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("name", p.app+"."+kind+p.labelSet())
+	query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	query.Set("until", strconv.FormatInt(until.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+	if kind == "cpu" {
+		query.Set("sampleRate", "100")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL+"/ingest?"+query.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if p.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.AuthToken)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	return nil
+}
+
+// labelSet renders the labels as {k=v,...}, sorted by key.
+func (p *Profiler) labelSet() string {
+	if len(p.labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(p.labels))
+	for k := range p.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + p.labels[k]
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// profileLabel turns key into a valid label name by replacing everything
+// but letters, digits and underscores, e.g. service.version becomes
+// service_version.
+func profileLabel(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
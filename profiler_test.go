@@ -0,0 +1,150 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type profileUpload struct {
+	query   map[string]string
+	auth    string
+	profile []byte
+}
+
+type profileServer struct {
+	mu      sync.Mutex
+	uploads []profileUpload
+}
+
+func (s *profileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ingest" {
+		http.NotFound(w, r)
+		return
+	}
+	file, _, err := r.FormFile("profile")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(file)
+	query := map[string]string{}
+	for k := range r.URL.Query() {
+		query[k] = r.URL.Query().Get(k)
+	}
+	s.mu.Lock()
+	s.uploads = append(s.uploads, profileUpload{query: query, auth: r.Header.Get("Authorization"), profile: data})
+	s.mu.Unlock()
+}
+
+func (s *profileServer) received() []profileUpload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]profileUpload(nil), s.uploads...)
+}
+
+func TestProfilerCollect(t *testing.T) {
+	server := &profileServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	p, err := NewProfiler(ProfilerConfig{
+		URL:         srv.URL + "/",
+		CPUDuration: 20 * time.Millisecond,
+		AuthToken:   "secret",
+		Labels:      map[string]string{"region": "eu-west-1"},
+	}, WithProfilerApplication("billing"), WithProfilerLabels(map[string]string{"service.version": "1.4.0"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Collect(context.Background()); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	uploads := server.received()
+	if len(uploads) != 2 {
+		t.Fatalf("expected cpu and heap uploads, got %d", len(uploads))
+	}
+	for i, kind := range []string{"cpu", "heap"} {
+		u := uploads[i]
+		if want := "billing." + kind + "{region=eu-west-1,service_version=1.4.0}"; u.query["name"] != want {
+			t.Errorf("expected name %q, got %q", want, u.query["name"])
+		}
+		if u.query["format"] != "pprof" || u.query["from"] == "" || u.query["until"] == "" {
+			t.Errorf("unexpected query %v", u.query)
+		}
+		if u.auth != "Bearer secret" {
+			t.Errorf("expected bearer token, got %q", u.auth)
+		}
+		if !bytes.HasPrefix(u.profile, []byte{0x1f, 0x8b}) {
+			t.Errorf("expected a gzipped %s profile", kind)
+		}
+	}
+	if uploads[0].query["sampleRate"] != "100" {
+		t.Errorf("expected the cpu sample rate, got %v", uploads[0].query)
+	}
+}
+
+func TestProfilerStartStop(t *testing.T) {
+	server := &profileServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	p, err := NewProfiler(ProfilerConfig{URL: srv.URL, Interval: time.Hour, CPUDuration: time.Hour, Profiles: []string{"cpu"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("expected stop to abandon the running capture: %v", err)
+	}
+	if uploads := server.received(); len(uploads) != 0 {
+		t.Errorf("expected no upload of an abandoned capture, got %d", len(uploads))
+	}
+}
+
+func TestNewProfilerValidation(t *testing.T) {
+	if _, err := NewProfiler(ProfilerConfig{}); err == nil {
+		t.Error("expected an error without url")
+	}
+	if _, err := NewProfiler(ProfilerConfig{URL: "http://localhost:4040", Profiles: []string{"goroutine"}}); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestWithProfiler(t *testing.T) {
+	ms := NewMicro(WithConfig(NewConfig()), WithLogger(NewNoopLogger()), WithProfiler())
+	if len(ms.runners) != 0 {
+		t.Fatalf("expected no runner without url, got %d", len(ms.runners))
+	}
+
+	cfg := NewConfig()
+	cfg.Set("service.name", "billing")
+	cfg.Set("service.version", "1.4.0")
+	cfg.Set("profiler.url", "http://localhost:4040")
+	ms = NewMicro(WithConfig(cfg), WithLogger(NewNoopLogger()), WithProfiler())
+	if len(ms.runners) != 1 {
+		t.Fatalf("expected the profiler runner, got %d", len(ms.runners))
+	}
+	p, ok := ms.runners[0].(*Profiler)
+	if !ok {
+		t.Fatalf("expected *Profiler, got %T", ms.runners[0])
+	}
+	if p.app != "billing" || p.labelSet() != "{service_version=1.4.0}" {
+		t.Errorf("unexpected app %q and labels %q", p.app, p.labelSet())
+	}
+	if p.cfg.Interval != time.Minute || p.cfg.CPUDuration != 10*time.Second || len(p.cfg.Profiles) != 2 {
+		t.Errorf("unexpected defaults %+v", p.cfg)
+	}
+}
@@ -0,0 +1,72 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultMongoCollection = "_quota_usage"
+
+// MongoStore keeps counters in a Mongo collection, one document per counter
+// updated with $inc so increments are atomic across replicas.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore stores counters in collection, defaulting to _quota_usage
+// when empty.
+func NewMongoStore(db *mongo.Database, collection string) *MongoStore {
+	if collection == "" {
+		collection = defaultMongoCollection
+	}
+	return &MongoStore{collection: db.Collection(collection)}
+}
+
+type counterRecord struct {
+	ID        string    `bson:"_id"`
+	Principal string    `bson:"principal"`
+	Metric    string    `bson:"metric"`
+	Period    Period    `bson:"period"`
+	PeriodKey string    `bson:"period_key"`
+	Used      int64     `bson:"used"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// Add implements Store.
+func (s *MongoStore) Add(ctx context.Context, c Counter, n int64) (int64, error) {
+	update := bson.M{
+		"$inc": bson.M{"used": n},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+		"$setOnInsert": bson.M{
+			"principal":  c.Principal,
+			"metric":     c.Metric,
+			"period":     c.Period,
+			"period_key": c.PeriodKey,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var record counterRecord
+	if err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": c.ID()}, update, opts).Decode(&record); err != nil {
+		return 0, fmt.Errorf("quota: add to %s: %w", c.ID(), err)
+	}
+	return record.Used, nil
+}
+
+// Get implements Store.
+func (s *MongoStore) Get(ctx context.Context, c Counter) (int64, error) {
+	var record counterRecord
+	err := s.collection.FindOne(ctx, bson.M{"_id": c.ID()}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("quota: get %s: %w", c.ID(), err)
+	}
+	return record.Used, nil
+}
@@ -0,0 +1,392 @@
+// Package quota tracks usage counters per principal and metric over daily
+// and monthly periods, enforces limits on them and reports usage for
+// billing.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultBasePath = "/quota"
+
+// Metrics tracked out of the box. Any other name works as well.
+const (
+	MetricRequests     = "requests"
+	MetricStorageBytes = "storage_bytes"
+)
+
+// ErrExceeded is returned by Consume when a limit would be exceeded.
+var ErrExceeded = errors.New("quota: exceeded")
+
+// Period is the span a counter accumulates over before rolling over.
+type Period string
+
+const (
+	Daily   Period = "daily"
+	Monthly Period = "monthly"
+)
+
+// Start returns the UTC start of the period containing t.
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	if p == Monthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// End returns the UTC start of the period following the one containing t.
+func (p Period) End(t time.Time) time.Time {
+	if p == Monthly {
+		return p.Start(t).AddDate(0, 1, 0)
+	}
+	return p.Start(t).AddDate(0, 0, 1)
+}
+
+// Key identifies the period containing t, e.g. "2026-10" or "2026-10-16".
+func (p Period) Key(t time.Time) string {
+	if p == Monthly {
+		return p.Start(t).Format("2006-01")
+	}
+	return p.Start(t).Format("2006-01-02")
+}
+
+// Limit caps a metric over a period.
+type Limit struct {
+	Metric string `json:"metric"`
+	Period Period `json:"period"`
+	Max    int64  `json:"max"`
+}
+
+// Limits resolves the limits that apply to a principal.
+type Limits interface {
+	QuotaLimits(ctx context.Context, principal string) ([]Limit, error)
+}
+
+// LimitsFunc adapts a function to Limits.
+type LimitsFunc func(ctx context.Context, principal string) ([]Limit, error)
+
+// QuotaLimits implements Limits.
+func (f LimitsFunc) QuotaLimits(ctx context.Context, principal string) ([]Limit, error) {
+	return f(ctx, principal)
+}
+
+// StaticLimits applies the same limits to every principal.
+func StaticLimits(limits ...Limit) Limits {
+	return LimitsFunc(func(context.Context, string) ([]Limit, error) {
+		return limits, nil
+	})
+}
+
+// Usage is the counter of one metric for one period. Max is 0 when the
+// metric has no limit for that period.
+type Usage struct {
+	Principal   string    `json:"principal"`
+	Metric      string    `json:"metric"`
+	Period      Period    `json:"period"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Used        int64     `json:"used"`
+	Max         int64     `json:"max,omitempty"`
+}
+
+// Remaining returns how much of the limit is left, or -1 when unlimited.
+func (u Usage) Remaining() int64 {
+	if u.Max <= 0 {
+		return -1
+	}
+	return max(u.Max-u.Used, 0)
+}
+
+// Tracker records usage and enforces limits. It implements aqm.HTTPModule,
+// exposing GET {base}/usage/{principal} for billing integrations.
+type Tracker struct {
+	store     Store
+	limits    Limits
+	periods   []Period
+	basePath  string
+	principal func(*http.Request) string
+	log       aqm.Logger
+	now       func() time.Time
+}
+
+// Option configures a Tracker.
+type Option func(*Tracker)
+
+// WithLimits sets the limits enforced by Consume and the middleware.
+func WithLimits(limits Limits) Option {
+	return func(t *Tracker) {
+		t.limits = limits
+	}
+}
+
+// WithPeriods sets the periods every metric is counted over (defaults to
+// daily and monthly).
+func WithPeriods(periods ...Period) Option {
+	return func(t *Tracker) {
+		if len(periods) > 0 {
+			t.periods = periods
+		}
+	}
+}
+
+// WithBasePath overrides the usage endpoint mount point (defaults to /quota).
+func WithBasePath(base string) Option {
+	return func(t *Tracker) {
+		if base != "" {
+			t.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithPrincipal sets how the middleware identifies the principal of a
+// request (defaults to aqm.RatePrincipalFromRequest).
+func WithPrincipal(fn func(*http.Request) string) Option {
+	return func(t *Tracker) {
+		if fn != nil {
+			t.principal = fn
+		}
+	}
+}
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(t *Tracker) {
+		if logger != nil {
+			t.log = logger
+		}
+	}
+}
+
+// NewTracker returns a Tracker backed by store. A nil store defaults to an
+// in-memory implementation.
+func NewTracker(store Store, opts ...Option) *Tracker {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	t := &Tracker{
+		store:    store,
+		periods:  []Period{Daily, Monthly},
+		basePath: defaultBasePath,
+		principal: func(r *http.Request) string {
+			return aqm.RatePrincipalFromRequest(r).Key()
+		},
+		log: aqm.NewNoopLogger(),
+		now: time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+// Record adds n to the counters of metric for every tracked period without
+// checking limits. Negative values decrease usage, e.g. when storage is
+// freed.
+func (t *Tracker) Record(ctx context.Context, principal, metric string, n int64) error {
+	now := t.now()
+	for _, period := range t.periods {
+		if _, err := t.store.Add(ctx, Counter{principal, metric, period, period.Key(now)}, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Consume adds n to metric and checks the principal's limits. When a limit
+// is exceeded the increments are reverted and ErrExceeded is returned along
+// with the exhausted counter. Otherwise it returns the limited counter with
+// the least remaining, or the first tracked period when none is limited.
+func (t *Tracker) Consume(ctx context.Context, principal, metric string, n int64) (Usage, error) {
+	limits, err := t.limitsFor(ctx, principal, metric)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	now := t.now()
+	var added []Counter
+	revert := func() {
+		for _, c := range added {
+			if _, err := t.store.Add(context.WithoutCancel(ctx), c, -n); err != nil {
+				t.log.Error("cannot revert quota usage", "principal", principal, "metric", metric, "error", err)
+			}
+		}
+	}
+
+	var tightest Usage
+	for i, period := range t.periods {
+		counter := Counter{principal, metric, period, period.Key(now)}
+		used, err := t.store.Add(ctx, counter, n)
+		if err != nil {
+			revert()
+			return Usage{}, err
+		}
+		added = append(added, counter)
+
+		usage := t.usage(counter, now, used, limits[period])
+		if usage.Max > 0 && used > usage.Max {
+			revert()
+			usage.Used -= n
+			return usage, fmt.Errorf("%w: %s %s limit of %d for %s", ErrExceeded, period, metric, usage.Max, principal)
+		}
+		if i == 0 || (usage.Max > 0 && (tightest.Max == 0 || usage.Remaining() < tightest.Remaining())) {
+			tightest = usage
+		}
+	}
+	return tightest, nil
+}
+
+// Usage reports the principal's counters at time at for every tracked
+// period, covering the given metrics and every metric with a limit.
+func (t *Tracker) Usage(ctx context.Context, principal string, at time.Time, metrics ...string) ([]Usage, error) {
+	var limits []Limit
+	if t.limits != nil {
+		var err error
+		if limits, err = t.limits.QuotaLimits(ctx, principal); err != nil {
+			return nil, err
+		}
+	}
+	seen := make(map[string]bool)
+	for _, limit := range limits {
+		if !seen[limit.Metric] {
+			seen[limit.Metric] = true
+			metrics = append(metrics, limit.Metric)
+		}
+	}
+
+	var report []Usage
+	reported := make(map[string]bool)
+	for _, metric := range metrics {
+		if reported[metric] {
+			continue
+		}
+		reported[metric] = true
+		maxByPeriod := make(map[Period]int64)
+		for _, limit := range limits {
+			if limit.Metric == metric {
+				maxByPeriod[limit.Period] = limit.Max
+			}
+		}
+		for _, period := range t.periods {
+			counter := Counter{principal, metric, period, period.Key(at)}
+			used, err := t.store.Get(ctx, counter)
+			if err != nil {
+				return nil, err
+			}
+			report = append(report, t.usage(counter, at, used, maxByPeriod[period]))
+		}
+	}
+	return report, nil
+}
+
+func (t *Tracker) limitsFor(ctx context.Context, principal, metric string) (map[Period]int64, error) {
+	byPeriod := make(map[Period]int64)
+	if t.limits == nil {
+		return byPeriod, nil
+	}
+	limits, err := t.limits.QuotaLimits(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+	for _, limit := range limits {
+		if limit.Metric == metric {
+			byPeriod[limit.Period] = limit.Max
+		}
+	}
+	return byPeriod, nil
+}
+
+func (t *Tracker) usage(c Counter, at time.Time, used, max int64) Usage {
+	return Usage{
+		Principal:   c.Principal,
+		Metric:      c.Metric,
+		Period:      c.Period,
+		PeriodStart: c.Period.Start(at),
+		PeriodEnd:   c.Period.End(at),
+		Used:        used,
+		Max:         max,
+	}
+}
+
+// Middleware counts every request against MetricRequests. Responses carry
+// X-Quota-Limit, X-Quota-Remaining and X-Quota-Reset (seconds until the
+// tightest limited period rolls over); requests over quota are answered with
+// 429 and the quota_exceeded error code. Tracker failures let the request
+// through.
+func (t *Tracker) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			usage, err := t.Consume(r.Context(), t.principal(r), MetricRequests, 1)
+			if err != nil && !errors.Is(err, ErrExceeded) {
+				t.log.Error("cannot track quota", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if usage.Max > 0 {
+				reset := strconv.Itoa(int(math.Ceil(usage.PeriodEnd.Sub(t.now()).Seconds())))
+				h := w.Header()
+				h.Set("X-Quota-Limit", strconv.FormatInt(usage.Max, 10))
+				h.Set("X-Quota-Remaining", strconv.FormatInt(usage.Remaining(), 10))
+				h.Set("X-Quota-Reset", reset)
+				if err != nil {
+					h.Set("Retry-After", reset)
+				}
+			}
+			if err != nil {
+				aqm.Error(w, http.StatusTooManyRequests, "quota_exceeded",
+					fmt.Sprintf("%s quota of %d %s exhausted", usage.Period, usage.Max, usage.Metric))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RegisterRoutes implements aqm.HTTPModule. GET {base}/usage/{principal}
+// reports the current periods; ?at=2026-09-15 (or an RFC3339 time) reports
+// the periods containing that date, and ?metric= adds metrics without limits.
+// Mount it behind internal or admin authentication.
+func (t *Tracker) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Get(t.basePath+"/usage/{principal}", t.handleUsage)
+}
+
+func (t *Tracker) handleUsage(w http.ResponseWriter, r *http.Request) {
+	at := t.now()
+	if raw := r.URL.Query().Get("at"); raw != "" {
+		parsed, err := parseAt(raw)
+		if err != nil {
+			aqm.Error(w, http.StatusBadRequest, "invalid_at", "at must be a date (2006-01-02) or an RFC3339 time")
+			return
+		}
+		at = parsed
+	}
+	report, err := t.Usage(r.Context(), chi.URLParam(r, "principal"), at, r.URL.Query()["metric"]...)
+	if err != nil {
+		t.log.Error("cannot load quota usage", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "usage_failed", "cannot load usage")
+		return
+	}
+	aqm.RespondSuccess(w, report)
+}
+
+func parseAt(raw string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, raw); err == nil {
+		return at, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
@@ -0,0 +1,177 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+func fixedClock(t *Tracker, at time.Time) {
+	t.now = func() time.Time { return at }
+}
+
+func TestPeriodBounds(t *testing.T) {
+	at := time.Date(2026, 10, 16, 15, 4, 5, 0, time.UTC)
+	if got := Daily.Key(at); got != "2026-10-16" {
+		t.Fatalf("daily key = %s", got)
+	}
+	if got := Monthly.Key(at); got != "2026-10" {
+		t.Fatalf("monthly key = %s", got)
+	}
+	if got := Monthly.End(at); !got.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("monthly end = %s", got)
+	}
+	if got := Daily.End(at); !got.Equal(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("daily end = %s", got)
+	}
+}
+
+func TestConsumeEnforcesLimitsAndRollsOver(t *testing.T) {
+	tracker := NewTracker(nil, WithLimits(StaticLimits(
+		Limit{Metric: MetricRequests, Period: Daily, Max: 2},
+		Limit{Metric: MetricRequests, Period: Monthly, Max: 3},
+	)))
+	day := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixedClock(tracker, day)
+	ctx := context.Background()
+
+	usage, err := tracker.Consume(ctx, "tenant:acme", MetricRequests, 1)
+	if err != nil || usage.Period != Daily || usage.Remaining() != 1 {
+		t.Fatalf("first consume = %+v, %v; want daily with 1 remaining", usage, err)
+	}
+	if _, err := tracker.Consume(ctx, "tenant:acme", MetricRequests, 1); err != nil {
+		t.Fatalf("second consume: %v", err)
+	}
+	usage, err = tracker.Consume(ctx, "tenant:acme", MetricRequests, 1)
+	if !errors.Is(err, ErrExceeded) || usage.Period != Daily || usage.Used != 2 {
+		t.Fatalf("third consume = %+v, %v; want daily ErrExceeded at 2", usage, err)
+	}
+
+	// The next day the daily counter starts over but the monthly one does not.
+	fixedClock(tracker, day.AddDate(0, 0, 1))
+	usage, err = tracker.Consume(ctx, "tenant:acme", MetricRequests, 1)
+	if err != nil || usage.Period != Monthly || usage.Remaining() != 0 {
+		t.Fatalf("next day consume = %+v, %v; want monthly with 0 remaining", usage, err)
+	}
+	if _, err := tracker.Consume(ctx, "tenant:acme", MetricRequests, 1); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("monthly limit not enforced: %v", err)
+	}
+
+	report, _ := tracker.Usage(ctx, "tenant:acme", day)
+	if len(report) != 2 || report[0].Used != 2 || report[1].Used != 3 {
+		t.Fatalf("usage report = %+v; want daily 2 and monthly 3", report)
+	}
+}
+
+func TestRecordWithoutLimits(t *testing.T) {
+	tracker := NewTracker(nil, WithPeriods(Monthly))
+	ctx := context.Background()
+	_ = tracker.Record(ctx, "user:1", MetricStorageBytes, 500)
+	_ = tracker.Record(ctx, "user:1", MetricStorageBytes, -200)
+
+	report, err := tracker.Usage(ctx, "user:1", time.Now(), MetricStorageBytes)
+	if err != nil || len(report) != 1 || report[0].Used != 300 || report[0].Remaining() != -1 {
+		t.Fatalf("report = %+v, %v; want one unlimited monthly counter at 300", report, err)
+	}
+}
+
+func TestMiddlewareHeadersAndRejection(t *testing.T) {
+	tracker := NewTracker(nil,
+		WithLimits(StaticLimits(Limit{Metric: MetricRequests, Period: Daily, Max: 1})),
+		WithPrincipal(func(r *http.Request) string { return r.Header.Get("X-Tenant") }),
+	)
+	handler := tracker.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant", "acme")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send()
+	if rec.Code != http.StatusNoContent || rec.Header().Get("X-Quota-Remaining") != "0" || rec.Header().Get("X-Quota-Limit") != "1" {
+		t.Fatalf("first request = %d %v", rec.Code, rec.Header())
+	}
+	rec = send()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("second request = %d %v; want 429 with Retry-After", rec.Code, rec.Header())
+	}
+	var body aqm.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code != "quota_exceeded" {
+		t.Fatalf("body = %+v (%v)", body, err)
+	}
+}
+
+func TestUsageEndpoint(t *testing.T) {
+	tracker := NewTracker(nil, WithLimits(StaticLimits(Limit{Metric: MetricRequests, Period: Monthly, Max: 10})))
+	september := time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC)
+	fixedClock(tracker, september)
+	_, _ = tracker.Consume(context.Background(), "tenant:acme", MetricRequests, 4)
+	fixedClock(tracker, september.AddDate(0, 1, 0))
+
+	router := chi.NewRouter()
+	tracker.RegisterRoutes(router)
+
+	get := func(url string) (int, []Usage) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var body struct {
+			Data []Usage `json:"data"`
+		}
+		_ = json.NewDecoder(rec.Body).Decode(&body)
+		return rec.Code, body.Data
+	}
+
+	code, report := get("/quota/usage/tenant:acme?at=2026-09-01")
+	if code != http.StatusOK || len(report) != 2 || report[1].Used != 4 || report[1].Max != 10 {
+		t.Fatalf("september usage = %d %+v", code, report)
+	}
+	if _, report := get("/quota/usage/tenant:acme"); report[1].Used != 0 {
+		t.Fatalf("current month should be empty, got %+v", report)
+	}
+	if code, _ := get("/quota/usage/tenant:acme?at=yesterday"); code != http.StatusBadRequest {
+		t.Fatalf("invalid at status = %d, want 400", code)
+	}
+}
+
+type fakeIncrementer struct {
+	mu     sync.Mutex
+	values map[string]int64
+	ttls   map[string]time.Duration
+}
+
+func (f *fakeIncrementer) IncrBy(_ context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] += n
+	f.ttls[key] = ttl
+	return f.values[key], nil
+}
+
+func TestKVStore(t *testing.T) {
+	kv := &fakeIncrementer{values: map[string]int64{}, ttls: map[string]time.Duration{}}
+	store := NewKVStore(kv, "", 24*time.Hour)
+	counter := Counter{Principal: "tenant:acme", Metric: MetricRequests, Period: Daily, PeriodKey: Daily.Key(time.Now())}
+
+	if used, _ := store.Add(context.Background(), counter, 3); used != 3 {
+		t.Fatalf("Add = %d, want 3", used)
+	}
+	if used, _ := store.Get(context.Background(), counter); used != 3 {
+		t.Fatalf("Get = %d, want 3", used)
+	}
+	key := "quota:" + counter.ID()
+	if ttl := kv.ttls[key]; ttl <= 24*time.Hour || ttl > 48*time.Hour {
+		t.Fatalf("ttl = %s, want until end of day plus retention", ttl)
+	}
+}
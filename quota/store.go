@@ -0,0 +1,110 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Counter identifies one usage counter.
+type Counter struct {
+	Principal string
+	Metric    string
+	Period    Period
+	PeriodKey string // Period.Key of the counted period
+}
+
+// ID returns the counter as "principal|metric|period|periodKey".
+func (c Counter) ID() string {
+	return c.Principal + "|" + c.Metric + "|" + string(c.Period) + "|" + c.PeriodKey
+}
+
+// Store persists counters. Add must be atomic so concurrent replicas can
+// share a store.
+type Store interface {
+	// Add increments the counter by n, creating it at zero, and returns the
+	// new value.
+	Add(ctx context.Context, c Counter, n int64) (int64, error)
+	// Get returns the counter value, zero when it does not exist.
+	Get(ctx context.Context, c Counter) (int64, error)
+}
+
+// MemoryStore keeps counters in process memory. It suits single-instance
+// services and tests. Counters of past periods are never removed.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+// NewMemoryStore constructs an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]int64)}
+}
+
+// Add implements Store.
+func (s *MemoryStore) Add(_ context.Context, c Counter, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[c.ID()] += n
+	return s.counters[c.ID()], nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, c Counter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[c.ID()], nil
+}
+
+// Incrementer is the atomic increment of a key/value store such as Redis.
+// IncrBy adds n to key, creating it at zero, and makes it expire after ttl;
+// with go-redis that is a pipeline of IncrBy and Expire.
+type Incrementer interface {
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// KVStore keeps counters in a key/value store under prefix+Counter.ID().
+// Keys expire one retention window after their period ends, so old periods
+// stay available for billing reports for that long.
+type KVStore struct {
+	kv        Incrementer
+	prefix    string
+	retention time.Duration
+}
+
+// NewKVStore stores counters in kv, defaulting prefix to "quota:" and
+// retention to 90 days.
+func NewKVStore(kv Incrementer, prefix string, retention time.Duration) *KVStore {
+	if prefix == "" {
+		prefix = "quota:"
+	}
+	if retention <= 0 {
+		retention = 90 * 24 * time.Hour
+	}
+	return &KVStore{kv: kv, prefix: prefix, retention: retention}
+}
+
+// Add implements Store.
+func (s *KVStore) Add(ctx context.Context, c Counter, n int64) (int64, error) {
+	return s.kv.IncrBy(ctx, s.prefix+c.ID(), n, s.ttl(c))
+}
+
+// Get implements Store by adding zero.
+func (s *KVStore) Get(ctx context.Context, c Counter) (int64, error) {
+	return s.kv.IncrBy(ctx, s.prefix+c.ID(), 0, s.ttl(c))
+}
+
+func (s *KVStore) ttl(c Counter) time.Duration {
+	start, err := parsePeriodKey(c.Period, c.PeriodKey)
+	if err != nil {
+		return s.retention
+	}
+	return time.Until(c.Period.End(start)) + s.retention
+}
+
+func parsePeriodKey(p Period, key string) (time.Time, error) {
+	if p == Monthly {
+		return time.Parse("2006-01", key)
+	}
+	return time.Parse("2006-01-02", key)
+}
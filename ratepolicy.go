@@ -0,0 +1,140 @@
+package aqm
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+// Principal kinds a rate limit can be applied to.
+const (
+	PrincipalAPIKey = "api_key"
+	PrincipalTenant = "tenant"
+	PrincipalUser   = "user"
+	PrincipalIP     = "ip"
+)
+
+// APIKeyHeader is the header clients send API keys in. It is read by
+// middleware.AuthenticateAPIKey; RatePrincipalFromRequest never trusts it.
+const APIKeyHeader = "X-API-Key"
+
+// RatePolicy allows Limit requests per Window. A zero Limit or Window means
+// no limit.
+type RatePolicy struct {
+	Limit  int           `json:"limit" bson:"limit"`
+	Window time.Duration `json:"window" bson:"window"`
+}
+
+// Unlimited reports whether the policy lets every request through.
+func (p RatePolicy) Unlimited() bool {
+	return p.Limit <= 0 || p.Window <= 0
+}
+
+// RatePrincipal identifies who a request is counted against.
+type RatePrincipal struct {
+	Kind string
+	ID   string
+}
+
+// Key returns the principal as "kind:id".
+func (p RatePrincipal) Key() string {
+	return p.Kind + ":" + p.ID
+}
+
+// RatePrincipalFromRequest picks the most specific identity available, in
+// order: the authenticated API key stored with auth.WithAPIKey, the aqmctx
+// tenant, the subject of the auth claims, and finally the client IP. An
+// unverified X-API-Key header is ignored, so clients cannot escape their
+// limits by sending a new key with every request.
+func RatePrincipalFromRequest(r *http.Request) RatePrincipal {
+	ctx := r.Context()
+	if key := auth.APIKeyFrom(ctx); key != "" {
+		return RatePrincipal{Kind: PrincipalAPIKey, ID: key}
+	}
+	if tenant := aqmctx.TenantFrom(ctx); tenant != "" {
+		return RatePrincipal{Kind: PrincipalTenant, ID: tenant}
+	}
+	if claims := auth.ClaimsFrom(ctx); claims != nil && claims.Subject != "" {
+		return RatePrincipal{Kind: PrincipalUser, ID: claims.Subject}
+	}
+	return RatePrincipal{Kind: PrincipalIP, ID: aqmctx.ClientIP(r)}
+}
+
+// RatePolicyResolver looks up the policy that applies to a principal.
+type RatePolicyResolver interface {
+	ResolveRatePolicy(ctx context.Context, principal RatePrincipal) (RatePolicy, error)
+}
+
+// RatePolicyResolverFunc adapts a function to RatePolicyResolver.
+type RatePolicyResolverFunc func(ctx context.Context, principal RatePrincipal) (RatePolicy, error)
+
+// ResolveRatePolicy implements RatePolicyResolver.
+func (f RatePolicyResolverFunc) ResolveRatePolicy(ctx context.Context, principal RatePrincipal) (RatePolicy, error) {
+	return f(ctx, principal)
+}
+
+// StaticRatePolicy applies policy to every principal.
+func StaticRatePolicy(policy RatePolicy) RatePolicyResolver {
+	return RatePolicyResolverFunc(func(context.Context, RatePrincipal) (RatePolicy, error) {
+		return policy, nil
+	})
+}
+
+// ConfigRatePolicies resolves policies from configuration. For a principal
+// it tries, in order:
+//
+//	<prefix>.<kind>.<id>     e.g. ratelimit.tenant.acme
+//	<prefix>.<kind>.default  e.g. ratelimit.tenant.default
+//	<prefix>.default
+//
+// each holding a limit and a window:
+//
+//	ratelimit:
+//	  default: {limit: 100, window: 1m}
+//	  tenant:
+//	    acme: {limit: 5000, window: 1m}
+//
+// Values are read on every request, so changes made to the Config at runtime
+// apply immediately. IDs containing dots, such as IPv4 addresses, can only
+// match the kind default.
+type ConfigRatePolicies struct {
+	cfg    *Config
+	prefix string
+}
+
+// NewConfigRatePolicies resolves policies under prefix, defaulting to
+// "ratelimit".
+func NewConfigRatePolicies(cfg *Config, prefix string) *ConfigRatePolicies {
+	if prefix == "" {
+		prefix = "ratelimit"
+	}
+	return &ConfigRatePolicies{cfg: cfg, prefix: prefix}
+}
+
+// ResolveRatePolicy implements RatePolicyResolver. It returns an unlimited
+// policy when nothing is configured.
+func (c *ConfigRatePolicies) ResolveRatePolicy(_ context.Context, principal RatePrincipal) (RatePolicy, error) {
+	paths := []string{
+		c.prefix + "." + principal.Kind + "." + principal.ID,
+		c.prefix + "." + principal.Kind + ".default",
+		c.prefix + ".default",
+	}
+	for _, path := range paths {
+		limit, ok, err := c.cfg.GetInt(path + ".limit")
+		if err != nil {
+			return RatePolicy{}, err
+		}
+		if !ok {
+			continue
+		}
+		window, _, err := c.cfg.GetDuration(path + ".window")
+		if err != nil {
+			return RatePolicy{}, err
+		}
+		return RatePolicy{Limit: limit, Window: window}, nil
+	}
+	return RatePolicy{}, nil
+}
@@ -0,0 +1,77 @@
+package aqm
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/auth"
+)
+
+func TestRatePrincipalFromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.7:5123"
+	if got := RatePrincipalFromRequest(req); got != (RatePrincipal{Kind: PrincipalIP, ID: "10.0.0.7"}) {
+		t.Fatalf("anonymous principal = %+v", got)
+	}
+
+	ctx := auth.WithClaims(req.Context(), &auth.TokenClaims{Subject: "user-1"})
+	req = req.WithContext(ctx)
+	if got := RatePrincipalFromRequest(req); got.Kind != PrincipalUser || got.ID != "user-1" {
+		t.Fatalf("user principal = %+v", got)
+	}
+
+	req = req.WithContext(aqmctx.WithTenant(ctx, "acme"))
+	if got := RatePrincipalFromRequest(req); got.Kind != PrincipalTenant || got.ID != "acme" {
+		t.Fatalf("tenant principal = %+v", got)
+	}
+
+	req.Header.Set(APIKeyHeader, "forged")
+	if got := RatePrincipalFromRequest(req); got.Kind != PrincipalTenant {
+		t.Fatalf("unverified api key header should be ignored, got %+v", got)
+	}
+
+	req = req.WithContext(auth.WithAPIKey(req.Context(), "key-1"))
+	if got := RatePrincipalFromRequest(req); got.Key() != "api_key:key-1" {
+		t.Fatalf("api key principal = %+v", got)
+	}
+}
+
+func TestConfigRatePolicies(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("ratelimit.default.limit", 10)
+	cfg.Set("ratelimit.default.window", "1m")
+	cfg.Set("ratelimit.tenant.default.limit", 100)
+	cfg.Set("ratelimit.tenant.default.window", "1m")
+	cfg.Set("ratelimit.tenant.acme.limit", 1000)
+	cfg.Set("ratelimit.tenant.acme.window", "1h")
+
+	policies := NewConfigRatePolicies(cfg, "")
+	ctx := context.Background()
+	cases := []struct {
+		principal RatePrincipal
+		want      RatePolicy
+	}{
+		{RatePrincipal{PrincipalTenant, "acme"}, RatePolicy{Limit: 1000, Window: time.Hour}},
+		{RatePrincipal{PrincipalTenant, "other"}, RatePolicy{Limit: 100, Window: time.Minute}},
+		{RatePrincipal{PrincipalUser, "u1"}, RatePolicy{Limit: 10, Window: time.Minute}},
+	}
+	for _, tc := range cases {
+		got, err := policies.ResolveRatePolicy(ctx, tc.principal)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %+v (%v), want %+v", tc.principal.Key(), got, err, tc.want)
+		}
+	}
+
+	cfg.Set("ratelimit.user.u1.limit", 2)
+	cfg.Set("ratelimit.user.u1.window", "1s")
+	if got, _ := policies.ResolveRatePolicy(ctx, RatePrincipal{PrincipalUser, "u1"}); got.Limit != 2 {
+		t.Fatalf("runtime config change not picked up: %+v", got)
+	}
+
+	if got, _ := NewConfigRatePolicies(NewConfig(), "").ResolveRatePolicy(ctx, RatePrincipal{PrincipalIP, "1.2.3.4"}); !got.Unlimited() {
+		t.Fatalf("empty config should be unlimited, got %+v", got)
+	}
+}
@@ -0,0 +1,305 @@
+package aqm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultRecordingsDir = ".aqm/recordings"
+
+// Recording is an upstream interaction stored on disk.
+type Recording struct {
+	Key        string              `json:"key"`
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Status     int                 `json:"status"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       string              `json:"body,omitempty"`
+	RecordedAt time.Time           `json:"recorded_at"`
+}
+
+// Recorder is an http.RoundTripper for local development. When recording,
+// every upstream response is saved to Dir; when replaying, a saved response
+// is served whenever the upstream is unreachable or answers 502, 503 or 504,
+// so services can be developed while their dependencies are down.
+type Recorder struct {
+	Dir    string
+	Record bool
+	Replay bool
+	Next   http.RoundTripper
+	Logger Logger
+}
+
+// NewRecorderFromConfig builds a Recorder from client.record,
+// client.replay and client.recordings_dir (default .aqm/recordings). It
+// returns nil in the prod profile or when neither mode is enabled.
+func NewRecorderFromConfig(cfg *Config, logger Logger) *Recorder {
+	if cfg == nil || cfg.IsProd() {
+		return nil
+	}
+	record, replay := cfg.GetBoolOrFalse("client.record"), cfg.GetBoolOrFalse("client.replay")
+	if !record && !replay {
+		return nil
+	}
+	if logger == nil {
+		logger = NewNoopLogger()
+	}
+	return &Recorder{
+		Dir:    cfg.GetStringOrDef("client.recordings_dir", defaultRecordingsDir),
+		Record: record,
+		Replay: replay,
+		Logger: logger,
+	}
+}
+
+// RoundTrip implements http.RoundTripper, sending live requests through Next.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.roundTrip(req, r.next())
+}
+
+// Wrap returns a transport that records and replays through r but sends live
+// requests through next, so one Recorder can serve clients with different
+// transports. A nil next falls back to Next.
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = r.next()
+	}
+	return &recordingTransport{recorder: r, next: next}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.recorder.roundTrip(req, t.next)
+}
+
+func (r *Recorder) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	key := recordingKey(req, body)
+
+	resp, err := next.RoundTrip(req)
+	if r.Replay && upstreamDown(resp, err) {
+		if recorded, loadErr := r.load(key); loadErr == nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			r.log().Info("replaying recorded response", "method", req.Method, "url", req.URL.String())
+			return recorded.response(req), nil
+		}
+	}
+	if err != nil || !r.Record {
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("recorder: read response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if !upstreamDown(resp, nil) {
+		rec := Recording{
+			Key:        key,
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			Status:     resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       string(respBody),
+			RecordedAt: time.Now().UTC(),
+		}
+		if err := r.save(rec); err != nil {
+			r.log().Error("cannot save recording", "url", rec.URL, "error", err)
+		}
+	}
+	return resp, nil
+}
+
+// List returns the stored recordings sorted by URL.
+func (r *Recorder) List() ([]Recording, error) {
+	paths, err := filepath.Glob(filepath.Join(r.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	recordings := make([]Recording, 0, len(paths))
+	for _, path := range paths {
+		rec, err := readRecording(path)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, rec)
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		if recordings[i].URL != recordings[j].URL {
+			return recordings[i].URL < recordings[j].URL
+		}
+		return recordings[i].Method < recordings[j].Method
+	})
+	return recordings, nil
+}
+
+// Clear deletes every stored recording.
+func (r *Recorder) Clear() error {
+	paths, err := filepath.Glob(filepath.Join(r.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	var errs error
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return errs
+}
+
+func (r *Recorder) next() http.RoundTripper {
+	if r.Next != nil {
+		return r.Next
+	}
+	return http.DefaultTransport
+}
+
+func (r *Recorder) log() Logger {
+	if r.Logger == nil {
+		return NewNoopLogger()
+	}
+	return r.Logger
+}
+
+func (r *Recorder) save(rec Recording) error {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.Dir, rec.Key+".json"), data, 0o644)
+}
+
+func (r *Recorder) load(key string) (Recording, error) {
+	return readRecording(filepath.Join(r.Dir, key+".json"))
+}
+
+func readRecording(path string) (Recording, error) {
+	var rec Recording
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("recorder: decode %s: %w", path, err)
+	}
+	return rec, nil
+}
+
+func (rec Recording) response(req *http.Request) *http.Response {
+	header := http.Header(rec.Header).Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("X-Aqm-Replayed", "true")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("recorder: read request: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// recordingKey identifies an interaction by method, URL and body.
+func recordingKey(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.String()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func upstreamDown(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RecordingsModule is a dev-mode HTTPModule exposing the recorder state:
+// GET /debug/recordings lists the stored interactions and DELETE clears them.
+type RecordingsModule struct {
+	recorder *Recorder
+}
+
+// NewRecordingsModule builds the module. A nil recorder registers no routes.
+func NewRecordingsModule(recorder *Recorder) *RecordingsModule {
+	return &RecordingsModule{recorder: recorder}
+}
+
+// Name implements the module naming used in route attribution.
+func (m *RecordingsModule) Name() string {
+	return "recordings"
+}
+
+// RegisterRoutes implements HTTPModule.
+func (m *RecordingsModule) RegisterRoutes(r chi.Router) {
+	if m.recorder == nil {
+		return
+	}
+	r.Get("/debug/recordings", func(w http.ResponseWriter, req *http.Request) {
+		recordings, err := m.recorder.List()
+		if err != nil {
+			RespondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		RespondSuccess(w, recordings)
+	})
+	r.Delete("/debug/recordings", func(w http.ResponseWriter, req *http.Request) {
+		if err := m.recorder.Clear(); err != nil {
+			RespondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
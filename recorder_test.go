@@ -0,0 +1,161 @@
+package aqm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRecorderRecordsAndReplays(t *testing.T) {
+	up := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			RespondError(w, http.StatusServiceUnavailable, "down")
+			return
+		}
+		RespondSuccess(w, map[string]string{"id": "42", "name": "Ada"})
+	}))
+	defer upstream.Close()
+
+	recorder := &Recorder{Dir: t.TempDir(), Record: true, Replay: true}
+	client := NewServiceClient(upstream.URL, WithRecorder(recorder))
+	client.http.RetryDelay = time.Millisecond
+
+	resp, err := client.Get(context.Background(), "users", "42")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	recordings, err := recorder.List()
+	if err != nil || len(recordings) != 1 || recordings[0].Status != http.StatusOK {
+		t.Fatalf("expected one recording, got %+v (%v)", recordings, err)
+	}
+
+	up = false
+	replayed, err := client.Get(context.Background(), "users", "42")
+	if err != nil {
+		t.Fatalf("expected replay while upstream is down, got %v", err)
+	}
+	if data, _ := json.Marshal(replayed.Data); string(data) != `{"id":"42","name":"Ada"}` {
+		t.Errorf("unexpected replayed data %s (live was %v)", data, resp.Data)
+	}
+
+	if _, err := client.Get(context.Background(), "users", "7"); err == nil {
+		t.Error("expected error for an interaction never recorded")
+	}
+	if recordings, _ := recorder.List(); len(recordings) != 1 {
+		t.Errorf("expected failed responses not to be recorded, got %d", len(recordings))
+	}
+}
+
+func TestRecorderReplaysOnConnectionError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondSuccess(w, "pong")
+	}))
+	recorder := &Recorder{Dir: t.TempDir(), Record: true, Replay: true}
+	client := NewServiceClient(upstream.URL, WithRecorder(recorder))
+	if _, err := client.Request(context.Background(), http.MethodGet, "/ping", nil); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	upstream.Close()
+
+	resp, err := client.Request(context.Background(), http.MethodGet, "/ping", nil)
+	if err != nil || resp.Data != "pong" {
+		t.Fatalf("expected replayed pong, got %v (%v)", resp, err)
+	}
+}
+
+type countingTransport struct {
+	calls int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRecorderSharedAcrossClients(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondSuccess(w, "pong")
+	}))
+	defer upstream.Close()
+	recorder := &Recorder{Dir: t.TempDir(), Record: true}
+
+	first, second := &countingTransport{}, &countingTransport{}
+	clientA := NewServiceClient(upstream.URL)
+	clientA.http.HTTPClient.Transport = first
+	WithRecorder(recorder)(clientA)
+	clientB := NewServiceClient(upstream.URL)
+	clientB.http.HTTPClient.Transport = second
+	WithRecorder(recorder)(clientB)
+
+	for _, client := range []*ServiceClient{clientA, clientB, clientB} {
+		if _, err := client.Request(context.Background(), http.MethodGet, "/ping", nil); err != nil {
+			t.Fatalf("request: %v", err)
+		}
+	}
+	if first.calls != 1 || second.calls != 2 {
+		t.Errorf("expected each client to keep its transport, got %d and %d calls", first.calls, second.calls)
+	}
+	if recorder.Next != nil {
+		t.Error("expected the shared recorder to stay untouched")
+	}
+}
+
+func TestNewRecorderFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]any
+		profile string
+		want    bool
+	}{
+		{name: "disabled", values: map[string]any{}},
+		{name: "record", values: map[string]any{"client.record": true}, want: true},
+		{name: "replay", values: map[string]any{"client.replay": true, "client.recordings_dir": "/tmp/rec"}, want: true},
+		{name: "prod", values: map[string]any{"client.record": true}, profile: "prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.MergeFlat(tt.values)
+			if tt.profile != "" {
+				cfg.SetProfile(tt.profile)
+			}
+			recorder := NewRecorderFromConfig(cfg, nil)
+			if (recorder != nil) != tt.want {
+				t.Fatalf("expected recorder=%v, got %+v", tt.want, recorder)
+			}
+		})
+	}
+}
+
+func TestRecordingsModule(t *testing.T) {
+	recorder := &Recorder{Dir: t.TempDir()}
+	if err := recorder.save(Recording{Key: "abc", Method: http.MethodGet, URL: "http://users/1", Status: 200}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	r := chi.NewRouter()
+	NewRecordingsModule(recorder).RegisterRoutes(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/recordings", nil))
+	var body struct {
+		Data []Recording `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || len(body.Data) != 1 {
+		t.Fatalf("expected one listed recording, got %+v (%v)", body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/recordings", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if recordings, _ := recorder.List(); len(recordings) != 0 {
+		t.Errorf("expected recordings cleared, got %d", len(recordings))
+	}
+}
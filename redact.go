@@ -0,0 +1,401 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactFields are field name fragments whose values are always
+// redacted, on top of DefaultRedactKeys.
+var DefaultRedactFields = []string{"authorization", "cookie", "session", "email", "phone", "card", "ssn"}
+
+// DefaultRedactPatterns match personal data and credentials inside values:
+// email addresses, bearer tokens, JWTs and card numbers (known issuer
+// prefix, Luhn checked, not part of a longer digit run).
+var DefaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`),
+	regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+}
+
+// Redactor scrubs sensitive data from log fields and error reports: values
+// of fields whose name contains a configured fragment are replaced whole
+// with RedactedValue, and matches of the patterns are replaced inside any
+// other string. A nil Redactor leaves everything untouched.
+type Redactor struct {
+	fields   []string
+	patterns []*regexp.Regexp
+}
+
+// RedactorOption configures NewRedactor.
+type RedactorOption func(*Redactor)
+
+// WithRedactFields adds field name fragments, matched case-insensitively.
+func WithRedactFields(names ...string) RedactorOption {
+	return func(r *Redactor) {
+		for _, name := range names {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				r.fields = append(r.fields, name)
+			}
+		}
+	}
+}
+
+// WithRedactPatterns adds patterns replaced inside string values.
+func WithRedactPatterns(patterns ...*regexp.Regexp) RedactorOption {
+	return func(r *Redactor) {
+		for _, pattern := range patterns {
+			if pattern != nil {
+				r.patterns = append(r.patterns, pattern)
+			}
+		}
+	}
+}
+
+// NewRedactor builds a Redactor with DefaultRedactKeys, DefaultRedactFields
+// and DefaultRedactPatterns plus the given options.
+func NewRedactor(opts ...RedactorOption) *Redactor {
+	r := &Redactor{}
+	WithRedactFields(DefaultRedactKeys...)(r)
+	WithRedactFields(DefaultRedactFields...)(r)
+	WithRedactPatterns(DefaultRedactPatterns...)(r)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(r)
+		}
+	}
+	return r
+}
+
+// RedactorFromConfig builds a Redactor extended with the field fragments in
+// redact.fields and the regular expressions in redact.patterns.
+func RedactorFromConfig(cfg *Config) (*Redactor, error) {
+	if cfg == nil {
+		return NewRedactor(), nil
+	}
+	var patterns []*regexp.Regexp
+	for _, expr := range cfg.GetStringSliceOrDef("redact.patterns", nil) {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("redact.patterns: %w", err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return NewRedactor(
+		WithRedactFields(cfg.GetStringSliceOrDef("redact.fields", nil)...),
+		WithRedactPatterns(patterns...),
+	), nil
+}
+
+// String replaces the pattern matches in s.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, pattern := range r.patterns {
+		s = replaceMatches(s, pattern)
+	}
+	return s
+}
+
+// replaceMatches redacts the matches of pattern in s. Matches made only of
+// digits and separators are redacted only when they look like a card
+// number, so ids and timestamps survive.
+func replaceMatches(s string, pattern *regexp.Regexp) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range pattern.FindAllStringIndex(s, -1) {
+		match := s[loc[0]:loc[1]]
+		if digits, ok := cardDigits(match); ok && !isCardNumber(s, loc[0], loc[1], digits) {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(RedactedValue)
+		last = loc[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isCardNumber reports whether the digits found at s[start:end] carry a
+// known issuer prefix, pass the Luhn check and are not a slice of a longer
+// digit run such as "1234 5678 ..." references.
+func isCardNumber(s string, start, end int, digits string) bool {
+	if !hasCardIIN(digits) || !luhn(digits) {
+		return false
+	}
+	before := strings.TrimRight(s[:start], " -")
+	after := strings.TrimLeft(s[end:], " -")
+	if before != "" && isDigit(before[len(before)-1]) {
+		return false
+	}
+	return after == "" || !isDigit(after[0])
+}
+
+// cardIINRanges lists issuer prefixes as inclusive ranges of equal length:
+// Visa, Mastercard, American Express, Diners Club, Discover, JCB, UnionPay
+// and Maestro.
+var cardIINRanges = [][2]string{
+	{"4", "4"},
+	{"51", "55"}, {"2221", "2720"},
+	{"34", "34"}, {"37", "37"},
+	{"300", "305"}, {"36", "36"}, {"38", "39"},
+	{"6011", "6011"}, {"644", "649"}, {"65", "65"},
+	{"3528", "3589"},
+	{"62", "62"},
+	{"50", "50"}, {"56", "58"}, {"67", "67"},
+}
+
+func hasCardIIN(digits string) bool {
+	for _, r := range cardIINRanges {
+		if len(digits) < len(r[0]) {
+			continue
+		}
+		prefix := digits[:len(r[0])]
+		if prefix >= r[0] && prefix <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// cardDigits returns the digits of a match made only of digits, spaces and
+// dashes.
+func cardDigits(match string) (string, bool) {
+	var b strings.Builder
+	for _, c := range match {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == ' ' || c == '-':
+		default:
+			return "", false
+		}
+	}
+	return b.String(), b.Len() >= 13
+}
+
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// IsSensitive reports whether values of the field name are redacted whole.
+func (r *Redactor) IsSensitive(name string) bool {
+	return r != nil && isRedactedKey(name, r.fields)
+}
+
+// Value returns v redacted as the value of the field key. Strings, errors
+// and stringers are scrubbed, maps and slices are walked, other values are
+// kept.
+func (r *Redactor) Value(key string, v any) any {
+	if r == nil || v == nil {
+		return v
+	}
+	if r.IsSensitive(key) {
+		return RedactedValue
+	}
+	switch value := v.(type) {
+	case string:
+		return r.String(value)
+	case []byte:
+		return r.String(string(value))
+	case error:
+		return r.String(value.Error())
+	case fmt.Stringer:
+		return r.String(value.String())
+	case map[string]any:
+		return r.Fields(value)
+	case map[string]string:
+		out := make(map[string]string, len(value))
+		for k, item := range value {
+			out[k] = fmt.Sprint(r.Value(k, item))
+		}
+		return out
+	case []any:
+		out := make([]any, len(value))
+		for i, item := range value {
+			out[i] = r.Value(key, item)
+		}
+		return out
+	case []string:
+		out := make([]string, len(value))
+		for i, item := range value {
+			out[i] = r.String(item)
+		}
+		return out
+	}
+	return v
+}
+
+// Fields returns a redacted copy of fields, e.g. the fields of an error
+// report.
+func (r *Redactor) Fields(fields map[string]any) map[string]any {
+	if r == nil || fields == nil {
+		return fields
+	}
+	out := make(map[string]any, len(fields))
+	for key, value := range fields {
+		out[key] = r.Value(key, value)
+	}
+	return out
+}
+
+// Args returns a redacted copy of key/value pairs or slog.Attr values, as
+// passed to Logger.With.
+func (r *Redactor) Args(args []any) []any {
+	if r == nil || len(args) == 0 {
+		return args
+	}
+	out := make([]any, len(args))
+	copy(out, args)
+	for i := 0; i < len(out); i++ {
+		switch arg := out[i].(type) {
+		case slog.Attr:
+			out[i] = r.attr(arg)
+		case string:
+			if i+1 < len(out) {
+				out[i+1] = r.Value(arg, out[i+1])
+				i++
+			}
+		default:
+			out[i] = r.Value("", arg)
+		}
+	}
+	return out
+}
+
+func (r *Redactor) attr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		group := value.Group()
+		attrs := make([]any, len(group))
+		for i, item := range group {
+			attrs[i] = r.attr(item)
+		}
+		return slog.Group(attr.Key, attrs...)
+	}
+	return slog.Any(attr.Key, r.Value(attr.Key, value.Any()))
+}
+
+// RedactLogger returns a Logger that passes every message and field through
+// redactor before logging with logger, including the fields added with With,
+// so request logs and any body sample logged as a field are scrubbed.
+func RedactLogger(logger Logger, redactor *Redactor) Logger {
+	if logger == nil || redactor == nil {
+		return logger
+	}
+	return &redactingLogger{next: logger, redactor: redactor}
+}
+
+type redactingLogger struct {
+	next     Logger
+	redactor *Redactor
+}
+
+// entry redacts a message followed by key/value pairs.
+func (l *redactingLogger) entry(v []any) []any {
+	if len(v) == 0 {
+		return v
+	}
+	out := make([]any, 0, len(v))
+	out = append(out, l.redactor.Value("", v[0]))
+	return append(out, l.redactor.Args(v[1:])...)
+}
+
+func (l *redactingLogger) Debug(v ...any) { l.next.Debug(l.entry(v)...) }
+func (l *redactingLogger) Debugf(format string, a ...any) {
+	l.next.Debug(l.redactor.String(fmt.Sprintf(format, a...)))
+}
+func (l *redactingLogger) Info(v ...any) { l.next.Info(l.entry(v)...) }
+func (l *redactingLogger) Infof(format string, a ...any) {
+	l.next.Info(l.redactor.String(fmt.Sprintf(format, a...)))
+}
+func (l *redactingLogger) Warn(v ...any) { l.next.Warn(l.entry(v)...) }
+func (l *redactingLogger) Warnf(format string, a ...any) {
+	l.next.Warn(l.redactor.String(fmt.Sprintf(format, a...)))
+}
+func (l *redactingLogger) Error(v ...any) { l.next.Error(l.entry(v)...) }
+func (l *redactingLogger) Errorf(format string, a ...any) {
+	l.next.Error(l.redactor.String(fmt.Sprintf(format, a...)))
+}
+func (l *redactingLogger) Fatal(v ...any) { l.next.Fatal(l.entry(v)...) }
+func (l *redactingLogger) Fatalf(format string, a ...any) {
+	l.next.Fatal(l.redactor.String(fmt.Sprintf(format, a...)))
+}
+func (l *redactingLogger) SetLogLevel(level LogLevel) { l.next.SetLogLevel(level) }
+func (l *redactingLogger) With(args ...any) Logger {
+	return &redactingLogger{next: l.next.With(l.redactor.Args(args)...), redactor: l.redactor}
+}
+
+// RedactErrorReporter returns an ErrorReporter that redacts the fields and
+// the error message before forwarding to reporter. The original error stays
+// reachable through errors.Is and errors.As.
+func RedactErrorReporter(reporter ErrorReporter, redactor *Redactor) ErrorReporter {
+	if reporter == nil || redactor == nil {
+		return reporter
+	}
+	return ErrorReporterFunc(func(ctx context.Context, err error, fields map[string]any) {
+		if err != nil {
+			if msg := redactor.String(err.Error()); msg != err.Error() {
+				err = &redactedError{msg: msg, err: err}
+			}
+		}
+		reporter.Report(ctx, err, redactor.Fields(fields))
+	})
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// WithRedactor scrubs the shared logger and error reporter with redactor.
+// It applies once all options ran, whatever their order.
+func WithRedactor(redactor *Redactor) Option {
+	return func(ms *Micro) error {
+		if redactor == nil {
+			return errors.New("nil redactor provided")
+		}
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.redactor = redactor
+		return nil
+	}
+}
+
+func (micro *Micro) applyRedactor() {
+	micro.mu.Lock()
+	defer micro.mu.Unlock()
+	if micro.redactor == nil {
+		return
+	}
+	micro.deps.Logger = RedactLogger(micro.deps.Logger, micro.redactor)
+	micro.deps.Errors = RedactErrorReporter(micro.deps.Errors, micro.redactor)
+}
@@ -0,0 +1,124 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactorString(t *testing.T) {
+	r := NewRedactor(WithRedactPatterns(regexp.MustCompile(`acct-\d+`)))
+	tests := map[string]string{
+		"mail ada@example.com now":               "mail ****** now",
+		"Authorization: Bearer abc.def-ghi":      "Authorization: ******",
+		"token eyJhbGciOi.eyJzdWIiOi.sig_nature": "token ******",
+		"card 4111 1111 1111 1111 declined":      "card ****** declined",
+		"order 1712345678901 shipped":            "order 1712345678901 shipped",
+		"amex 3782-822463-10005 ok":              "amex ****** ok",
+		"ts 1700000000004 logged":                "ts 1700000000004 logged",
+		"ref 4111 1111 1111 1111 2222 kept":      "ref 4111 1111 1111 1111 2222 kept",
+		"account acct-42":                        "account ******",
+	}
+	for in, want := range tests {
+		if got := r.String(in); got != want {
+			t.Errorf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+	var nilRedactor *Redactor
+	if got := nilRedactor.String("ada@example.com"); got != "ada@example.com" {
+		t.Errorf("nil redactor changed %q", got)
+	}
+}
+
+func TestRedactorFields(t *testing.T) {
+	r := NewRedactor(WithRedactFields("iban"))
+	fields := map[string]any{
+		"password":  "hunter2",
+		"user_iban": "DE89370400440532013000",
+		"path":      "/users/ada@example.com",
+		"status":    500,
+		"nested":    map[string]any{"api_key": "k", "ok": "fine"},
+	}
+	got := r.Fields(fields)
+	if got["password"] != RedactedValue || got["user_iban"] != RedactedValue {
+		t.Errorf("sensitive fields kept: %v", got)
+	}
+	if got["path"] != "/users/******" || got["status"] != 500 {
+		t.Errorf("values = %v", got)
+	}
+	if nested := got["nested"].(map[string]any); nested["api_key"] != RedactedValue || nested["ok"] != "fine" {
+		t.Errorf("nested = %v", nested)
+	}
+	if fields["password"] != "hunter2" {
+		t.Error("Fields must not modify its input")
+	}
+}
+
+func TestRedactLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := RedactLogger(newBufferLogger(&buf), NewRedactor())
+
+	logger.With("session_id", "s1").Info("login ada@example.com", "email", "ada@example.com", "attempt", 2)
+	logger.Debug("refresh", slog.String("token", "t"))
+	logger.Errorf("charge %s failed", "4111-1111-1111-1111")
+
+	out := buf.String()
+	for _, leaked := range []string{"ada@example.com", "s1", "4111", "token=t"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("log leaked %q:\n%s", leaked, out)
+		}
+	}
+	for _, want := range []string{"session_id=******", "login ******", "email=******", "attempt=2", "token=******", "charge ****** failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRedactErrorReporter(t *testing.T) {
+	cause := errors.New("lookup ada@example.com: not found")
+	var gotErr error
+	var gotFields map[string]any
+	reporter := RedactErrorReporter(ErrorReporterFunc(func(_ context.Context, err error, fields map[string]any) {
+		gotErr, gotFields = err, fields
+	}), NewRedactor())
+
+	reporter.Report(context.Background(), cause, map[string]any{"authorization": "Basic x", "path": "/x"})
+	if gotErr.Error() != "lookup ******: not found" || !errors.Is(gotErr, cause) {
+		t.Errorf("reported error = %v", gotErr)
+	}
+	if gotFields["authorization"] != RedactedValue || gotFields["path"] != "/x" {
+		t.Errorf("reported fields = %v", gotFields)
+	}
+}
+
+func TestWithRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	ms := NewMicro(WithRedactor(NewRedactor()), WithLogger(newBufferLogger(&buf)), WithConfig(NewConfig()))
+	ms.Deps().Logger.Info("signup", "email", "ada@example.com")
+	if strings.Contains(buf.String(), "ada@example.com") {
+		t.Errorf("micro logger not redacted:\n%s", buf.String())
+	}
+}
+
+func TestRedactorFromConfig(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("redact.fields", []string{"iban"})
+	cfg.Set("redact.patterns", []string{`acct-\d+`})
+	r, err := RedactorFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.IsSensitive("IBAN") || r.String("acct-7") != RedactedValue {
+		t.Error("config fields and patterns not applied")
+	}
+
+	cfg.Set("redact.patterns", []string{`(`})
+	if _, err := RedactorFromConfig(cfg); err == nil {
+		t.Error("expected invalid pattern error")
+	}
+}
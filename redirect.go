@@ -0,0 +1,140 @@
+package aqm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const flashCookie = "aqm_flash"
+
+// Flash levels.
+const (
+	FlashInfo    = "info"
+	FlashSuccess = "success"
+	FlashWarning = "warning"
+	FlashError   = "error"
+)
+
+// Flash is a one-time message shown on the page a redirect lands on.
+type Flash struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// RedirectOptions configures Redirect.
+type RedirectOptions struct {
+	// Status overrides the browser redirect status. Defaults to 303 See
+	// Other after POST, PUT, PATCH and DELETE, so the browser follows with a
+	// GET, and 302 Found otherwise.
+	Status int
+	// Flash messages survive the redirect in a cookie read by Flashes; JSON
+	// clients receive them in the response instead.
+	Flash []Flash
+	// Location navigates HTMX clients with HX-Location, an AJAX request that
+	// keeps the page, instead of a full reload through HX-Redirect.
+	Location bool
+}
+
+// Redirect sends the client to url with the mechanism its request expects:
+// HX-Redirect (or HX-Location) with 200 for HTMX, since a 3xx would be
+// followed by the XHR itself; a 200 JSON body {"data":{"location":url}} with
+// a Location header for API clients asking for JSON; and a 302/303 redirect
+// for browsers.
+func Redirect(w http.ResponseWriter, r *http.Request, url string, opts RedirectOptions) {
+	switch {
+	case IsHTMX(r):
+		SetFlash(w, opts.Flash...)
+		if opts.Location {
+			w.Header().Set(HXLocation, url)
+		} else {
+			SetHTMXRedirect(w, url)
+		}
+		w.WriteHeader(http.StatusOK)
+	case WantsJSON(r):
+		w.Header().Set("Location", url)
+		Respond(w, http.StatusOK, redirectPayload{Location: url, Flash: opts.Flash}, nil)
+	default:
+		SetFlash(w, opts.Flash...)
+		status := opts.Status
+		if status == 0 {
+			status = http.StatusFound
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				status = http.StatusSeeOther
+			}
+		}
+		http.Redirect(w, r, url, status)
+	}
+}
+
+type redirectPayload struct {
+	Location string  `json:"location"`
+	Flash    []Flash `json:"flash,omitempty"`
+}
+
+// WantsJSON reports whether the Accept header asks for JSON rather than
+// HTML.
+func WantsJSON(r *http.Request) bool {
+	wants := false
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch {
+		case mediaType == "text/html":
+			return false
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			wants = true
+		}
+	}
+	return wants
+}
+
+// SetFlash stores messages for the next request in a short-lived cookie,
+// replacing any pending ones. Without messages it does nothing.
+func SetFlash(w http.ResponseWriter, flashes ...Flash) {
+	if len(flashes) == 0 {
+		return
+	}
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(data),
+		Path:     "/",
+		MaxAge:   300,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Flashes returns the messages set before a redirect and clears them, so
+// each is shown once.
+func Flashes(w http.ResponseWriter, r *http.Request) []Flash {
+	cookie, err := r.Cookie(flashCookie)
+	if err != nil {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	var flashes []Flash
+	if err := json.Unmarshal(data, &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
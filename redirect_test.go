@@ -0,0 +1,96 @@
+package aqm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	flash := []Flash{{Level: FlashSuccess, Message: "Saved"}}
+
+	t.Run("browser", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Redirect(rec, httptest.NewRequest(http.MethodPost, "/users", nil), "/users/1", RedirectOptions{Flash: flash})
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/users/1" {
+			t.Fatalf("POST redirect = %d %q", rec.Code, rec.Header().Get("Location"))
+		}
+
+		// The landing page reads the flash once.
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		for _, c := range rec.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		landing := httptest.NewRecorder()
+		got := Flashes(landing, req)
+		if len(got) != 1 || got[0] != flash[0] {
+			t.Errorf("flashes = %v", got)
+		}
+		if cookies := landing.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Errorf("flash cookie not cleared: %v", cookies)
+		}
+
+		rec = httptest.NewRecorder()
+		Redirect(rec, httptest.NewRequest(http.MethodGet, "/old", nil), "/new", RedirectOptions{})
+		if rec.Code != http.StatusFound || len(rec.Result().Cookies()) != 0 {
+			t.Errorf("GET redirect = %d cookies %v", rec.Code, rec.Result().Cookies())
+		}
+	})
+
+	t.Run("htmx", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		req.Header.Set(HXRequest, "true")
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		Redirect(rec, req, "/users/1", RedirectOptions{Flash: flash})
+		if rec.Code != http.StatusOK || rec.Header().Get(HXRedirect) != "/users/1" || rec.Header().Get("Location") != "" {
+			t.Errorf("htmx redirect = %d %v", rec.Code, rec.Header())
+		}
+		if len(rec.Result().Cookies()) != 1 {
+			t.Error("htmx redirect should keep the flash for the next page")
+		}
+
+		rec = httptest.NewRecorder()
+		Redirect(rec, req, "/users/1", RedirectOptions{Location: true})
+		if rec.Header().Get(HXLocation) != "/users/1" || rec.Header().Get(HXRedirect) != "" {
+			t.Errorf("htmx location = %v", rec.Header())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		Redirect(rec, req, "/users/1", RedirectOptions{Flash: flash})
+		if rec.Code != http.StatusOK || rec.Header().Get("Location") != "/users/1" {
+			t.Fatalf("json redirect = %d %v", rec.Code, rec.Header())
+		}
+		var body struct {
+			Data redirectPayload `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.Location != "/users/1" || len(body.Data.Flash) != 1 {
+			t.Errorf("payload = %+v", body.Data)
+		}
+	})
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := map[string]bool{
+		"":                                 false,
+		"application/json":                 true,
+		"application/vnd.api+json":         true,
+		"text/html,application/json;q=0.9": false,
+		"*/*":                              false,
+	}
+	for accept, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		if got := WantsJSON(req); got != want {
+			t.Errorf("WantsJSON(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceInfo describes the service announced to a discovery backend.
+type ServiceInfo struct {
+	ID         string
+	Name       string
+	Version    string
+	Address    string
+	Port       int
+	HealthPath string
+	Tags       []string
+	Meta       map[string]string
+}
+
+// ServiceRegistrar announces a service to a discovery backend.
+type ServiceRegistrar interface {
+	Register(ctx context.Context, info ServiceInfo) error
+	Deregister(ctx context.Context, info ServiceInfo) error
+}
+
+// ServiceHeartbeater is implemented by registrars whose registrations expire
+// unless renewed, such as Consul TTL checks.
+type ServiceHeartbeater interface {
+	Heartbeat(ctx context.Context, info ServiceInfo) error
+	HeartbeatInterval() time.Duration
+}
+
+// WithServiceRegistration registers the service with registrar when Micro
+// starts, renews it while running when registrar is a ServiceHeartbeater, and
+// deregisters it on shutdown. The announced details are read from config:
+// service.name, service.version, service.id, service.address, service.tags,
+// service.health_path (default /readyz) and http.port. Runners start
+// concurrently, so discovery backends should gate traffic on the health
+// endpoint rather than on option order. Heartbeats are held back until the
+// warmups finished. Deregistration runs on shutdown with its own timeout, as
+// the run context is already cancelled by then.
+func WithServiceRegistration(registrar ServiceRegistrar) Option {
+	return func(ms *Micro) error {
+		if registrar == nil {
+			return errors.New("nil service registrar provided")
+		}
+		ms.addRunner(&registrationRunner{
+			registrar: registrar,
+			info:      func() ServiceInfo { return serviceInfoFromConfig(ms.Deps().Config) },
+			logger:    func() Logger { return ms.Deps().Logger },
+			ready:     ms.WarmedUp,
+		})
+		return nil
+	}
+}
+
+func serviceInfoFromConfig(cfg *Config) ServiceInfo {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	hostname, _ := os.Hostname()
+	name := cfg.GetStringOrDef("service.name", "aqm")
+	port, _ := strconv.Atoi(strings.TrimPrefix(cfg.GetPort("http.port", ":8080"), ":"))
+	version := cfg.GetStringOrDef("service.version", "")
+
+	info := ServiceInfo{
+		ID:         cfg.GetStringOrDef("service.id", name+"-"+hostname),
+		Name:       name,
+		Version:    version,
+		Address:    cfg.GetStringOrDef("service.address", hostname),
+		Port:       port,
+		HealthPath: cfg.GetStringOrDef("service.health_path", "/readyz"),
+		Tags:       cfg.GetStringSliceOrDef("service.tags", nil),
+	}
+	if version != "" {
+		info.Meta = map[string]string{"version": version}
+	}
+	return info
+}
+
+const deregisterTimeout = 5 * time.Second
+
+type registrationRunner struct {
+	registrar ServiceRegistrar
+	info      func() ServiceInfo
+	logger    func() Logger
+	ready     func() bool // heartbeats wait for warmup
+
+	mu         sync.Mutex
+	current    ServiceInfo
+	registered bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func (r *registrationRunner) Name() string {
+	return "service registration"
+}
+
+func (r *registrationRunner) Start(ctx context.Context) error {
+	info := r.info()
+	if err := r.registrar.Register(ctx, info); err != nil {
+		return fmt.Errorf("service registration: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current, r.registered = info, true
+	heartbeater, ok := r.registrar.(ServiceHeartbeater)
+	if !ok || heartbeater.HeartbeatInterval() <= 0 {
+		return nil
+	}
+	hbCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.heartbeat(hbCtx, heartbeater, info, r.done)
+	return nil
+}
+
+func (r *registrationRunner) heartbeat(ctx context.Context, hb ServiceHeartbeater, info ServiceInfo, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(hb.HeartbeatInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.ready != nil && !r.ready() {
+				continue
+			}
+			if err := hb.Heartbeat(ctx, info); err != nil && ctx.Err() == nil {
+				r.log().Error("service heartbeat failed", "service_id", info.ID, "error", err)
+			}
+		}
+	}
+}
+
+func (r *registrationRunner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done, info, registered := r.cancel, r.done, r.current, r.registered
+	r.cancel, r.done, r.registered = nil, nil, false
+	r.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	if !registered {
+		return nil
+	}
+	ctx, cancelStop := context.WithTimeout(context.WithoutCancel(ctx), deregisterTimeout)
+	defer cancelStop()
+	if err := r.registrar.Deregister(ctx, info); err != nil {
+		return fmt.Errorf("service deregistration: %w", err)
+	}
+	return nil
+}
+
+func (r *registrationRunner) log() Logger {
+	if r.logger == nil {
+		return NewNoopLogger()
+	}
+	if logger := r.logger(); logger != nil {
+		return logger
+	}
+	return NewNoopLogger()
+}
+
+// ConsulRegistrar registers services through the Consul agent HTTP API. With a
+// TTL the service gets a TTL check renewed by heartbeats; without one Consul
+// polls the service health endpoint instead.
+type ConsulRegistrar struct {
+	BaseURL string
+	Token   string
+	TTL     time.Duration
+	Client  *http.Client
+}
+
+// NewConsulRegistrar builds a registrar for the agent at baseURL (e.g.
+// http://localhost:8500).
+func NewConsulRegistrar(baseURL string, ttl time.Duration) *ConsulRegistrar {
+	return &ConsulRegistrar{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		TTL:     ttl,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type consulServiceRegistration struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   consulCheck       `json:"Check"`
+}
+
+type consulCheck struct {
+	CheckID                        string `json:"CheckID"`
+	TTL                            string `json:"TTL,omitempty"`
+	HTTP                           string `json:"HTTP,omitempty"`
+	Interval                       string `json:"Interval,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// Register implements ServiceRegistrar.
+func (c *ConsulRegistrar) Register(ctx context.Context, info ServiceInfo) error {
+	check := consulCheck{
+		CheckID:                        consulCheckID(info),
+		DeregisterCriticalServiceAfter: "1m",
+	}
+	if c.TTL > 0 {
+		check.TTL = c.TTL.String()
+	} else {
+		check.HTTP = fmt.Sprintf("http://%s:%d%s", info.Address, info.Port, info.HealthPath)
+		check.Interval = "10s"
+	}
+	body := consulServiceRegistration{
+		ID:      info.ID,
+		Name:    info.Name,
+		Tags:    info.Tags,
+		Address: info.Address,
+		Port:    info.Port,
+		Meta:    info.Meta,
+		Check:   check,
+	}
+	return c.put(ctx, "/v1/agent/service/register", body)
+}
+
+// Deregister implements ServiceRegistrar.
+func (c *ConsulRegistrar) Deregister(ctx context.Context, info ServiceInfo) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(info.ID), nil)
+}
+
+// Heartbeat marks the TTL check as passing.
+func (c *ConsulRegistrar) Heartbeat(ctx context.Context, info ServiceInfo) error {
+	return c.put(ctx, "/v1/agent/check/pass/"+url.PathEscape(consulCheckID(info)), nil)
+}
+
+// HeartbeatInterval renews the TTL check three times per TTL; zero disables
+// heartbeats when no TTL is configured.
+func (c *ConsulRegistrar) HeartbeatInterval() time.Duration {
+	return c.TTL / 3
+}
+
+func (c *ConsulRegistrar) put(ctx context.Context, path string, body any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("consul: encode request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.BaseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("consul: create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("consul: %s %s: status %d: %s", http.MethodPut, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func consulCheckID(info ServiceInfo) string {
+	return "service:" + info.ID
+}
+
+// KubernetesMetadataRegistrar writes the service details as a Kubernetes
+// metadata patch (labels and annotations) to Path, suitable for
+// `kubectl patch --patch-file` or a sidecar that applies it. The file is
+// removed on deregistration.
+type KubernetesMetadataRegistrar struct {
+	Path string
+}
+
+// NewKubernetesMetadataRegistrar builds a registrar writing to path.
+func NewKubernetesMetadataRegistrar(path string) *KubernetesMetadataRegistrar {
+	return &KubernetesMetadataRegistrar{Path: path}
+}
+
+// Register implements ServiceRegistrar.
+func (k *KubernetesMetadataRegistrar) Register(_ context.Context, info ServiceInfo) error {
+	if k.Path == "" {
+		return errors.New("kubernetes metadata: path required")
+	}
+	labels := map[string]string{"app.kubernetes.io/name": info.Name}
+	if info.Version != "" {
+		labels["app.kubernetes.io/version"] = info.Version
+	}
+	annotations := map[string]string{
+		"aqm.io/service-id":  info.ID,
+		"aqm.io/health-path": info.HealthPath,
+		"aqm.io/port":        strconv.Itoa(info.Port),
+	}
+	if len(info.Tags) > 0 {
+		annotations["aqm.io/tags"] = strings.Join(info.Tags, ",")
+	}
+	for key, value := range info.Meta {
+		annotations["aqm.io/meta-"+key] = value
+	}
+
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	}
+	payload, err := json.MarshalIndent(patch, "", "  ")
+	if err != nil {
+		return fmt.Errorf("kubernetes metadata: encode: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0o755); err != nil {
+		return fmt.Errorf("kubernetes metadata: create dir: %w", err)
+	}
+	if err := os.WriteFile(k.Path, payload, 0o644); err != nil {
+		return fmt.Errorf("kubernetes metadata: write: %w", err)
+	}
+	return nil
+}
+
+// Deregister implements ServiceRegistrar.
+func (k *KubernetesMetadataRegistrar) Deregister(_ context.Context, _ ServiceInfo) error {
+	if err := os.Remove(k.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("kubernetes metadata: remove: %w", err)
+	}
+	return nil
+}
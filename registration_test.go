@@ -0,0 +1,200 @@
+package aqm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRegistrar struct {
+	mu         sync.Mutex
+	registered []ServiceInfo
+	heartbeats int
+	deregister int
+}
+
+func (f *fakeRegistrar) Register(_ context.Context, info ServiceInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.registered = append(f.registered, info)
+	return nil
+}
+
+func (f *fakeRegistrar) Deregister(ctx context.Context, _ ServiceInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deregister++
+	return nil
+}
+
+func (f *fakeRegistrar) Heartbeat(context.Context, ServiceInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.heartbeats++
+	return nil
+}
+
+func (f *fakeRegistrar) HeartbeatInterval() time.Duration { return 5 * time.Millisecond }
+
+func TestWithServiceRegistration(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MergeFlat(map[string]any{
+		"service.name":    "tasks",
+		"service.version": "v1.2.0",
+		"service.id":      "tasks-1",
+		"service.address": "10.0.0.5",
+		"http.port":       ":8082",
+	})
+	registrar := &fakeRegistrar{}
+	ms := NewMicro(WithConfig(cfg), WithLogger(NewNoopLogger()), WithServiceRegistration(registrar))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ms.Run(ctx) }()
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registrar.mu.Lock()
+	defer registrar.mu.Unlock()
+	if len(registrar.registered) != 1 {
+		t.Fatalf("expected one registration, got %d", len(registrar.registered))
+	}
+	info := registrar.registered[0]
+	if info.ID != "tasks-1" || info.Name != "tasks" || info.Port != 8082 || info.Address != "10.0.0.5" || info.HealthPath != "/readyz" {
+		t.Errorf("unexpected service info %+v", info)
+	}
+	if info.Meta["version"] != "v1.2.0" {
+		t.Errorf("expected version meta, got %v", info.Meta)
+	}
+	if registrar.heartbeats == 0 {
+		t.Error("expected heartbeats while running")
+	}
+	if registrar.deregister != 1 {
+		t.Errorf("expected one deregistration, got %d", registrar.deregister)
+	}
+}
+
+func TestRegistrationRunnerStopWithoutRegister(t *testing.T) {
+	registrar := &fakeRegistrar{}
+	runner := &registrationRunner{registrar: registrar, info: func() ServiceInfo { return ServiceInfo{ID: "tasks-1"} }}
+	if err := runner.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if registrar.deregister != 0 {
+		t.Errorf("deregistered a service that was never registered")
+	}
+}
+
+func TestWithServiceRegistrationNil(t *testing.T) {
+	ms := &Micro{deps: DefaultDeps()}
+	if err := WithServiceRegistration(nil)(ms); err == nil {
+		t.Error("expected error for nil registrar")
+	}
+}
+
+func TestConsulRegistrar(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	var registered consulServiceRegistration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/v1/agent/service/register" {
+			json.NewDecoder(r.Body).Decode(&registered)
+		}
+	}))
+	defer server.Close()
+
+	registrar := NewConsulRegistrar(server.URL, 15*time.Second)
+	registrar.Token = "secret"
+	info := ServiceInfo{ID: "tasks-1", Name: "tasks", Address: "10.0.0.5", Port: 8082, HealthPath: "/readyz"}
+	ctx := context.Background()
+
+	if err := registrar.Register(ctx, info); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := registrar.Heartbeat(ctx, info); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if err := registrar.Deregister(ctx, info); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+
+	want := []string{
+		"PUT /v1/agent/service/register",
+		"PUT /v1/agent/check/pass/service:tasks-1",
+		"PUT /v1/agent/service/deregister/tasks-1",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != len(want) {
+		t.Fatalf("expected calls %v, got %v", want, calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d: expected %q, got %q", i, want[i], calls[i])
+		}
+	}
+	if registered.ID != "tasks-1" || registered.Check.TTL != "15s" {
+		t.Errorf("unexpected registration %+v", registered)
+	}
+	if registrar.HeartbeatInterval() != 5*time.Second {
+		t.Errorf("expected heartbeat every TTL/3, got %v", registrar.HeartbeatInterval())
+	}
+
+	registrar.Token = ""
+	if err := registrar.Register(ctx, info); err == nil {
+		t.Error("expected error for rejected request")
+	}
+}
+
+func TestKubernetesMetadataRegistrar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta", "patch.json")
+	registrar := NewKubernetesMetadataRegistrar(path)
+	info := ServiceInfo{ID: "tasks-1", Name: "tasks", Version: "v1", Port: 8082, HealthPath: "/readyz"}
+
+	if err := registrar.Register(context.Background(), info); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var patch struct {
+		Metadata struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if patch.Metadata.Labels["app.kubernetes.io/version"] != "v1" || patch.Metadata.Annotations["aqm.io/port"] != "8082" {
+		t.Errorf("unexpected patch %s", data)
+	}
+
+	if err := registrar.Deregister(context.Background(), info); err != nil {
+		t.Fatalf("deregister: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected metadata file to be removed")
+	}
+}
@@ -4,30 +4,20 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/aquamarinepk/aqm/aqmctx"
 	"github.com/google/uuid"
 )
 
 const RequestIDHeader = "X-Request-ID"
 
-type requestIDKeyType struct{}
-
-var requestIDKey requestIDKeyType
-
+// WithRequestID stores the request ID in ctx. See aqmctx.WithRequestID.
 func WithRequestID(ctx context.Context, id string) context.Context {
-	if ctx == nil || id == "" {
-		return ctx
-	}
-	return context.WithValue(ctx, requestIDKey, id)
+	return aqmctx.WithRequestID(ctx, id)
 }
 
+// RequestIDFrom returns the request ID stored in ctx, or "" when none was stored.
 func RequestIDFrom(ctx context.Context) string {
-	if ctx == nil {
-		return ""
-	}
-	if v, ok := ctx.Value(requestIDKey).(string); ok {
-		return v
-	}
-	return ""
+	return aqmctx.RequestIDFrom(ctx)
 }
 
 func RequestIDMiddleware(next http.Handler) http.Handler {
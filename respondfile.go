@@ -0,0 +1,198 @@
+package aqm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sniffLen = 512
+
+// FileOptions describes a file sent by RespondFile.
+type FileOptions struct {
+	// Name is the file name offered to the client; it also selects the
+	// content type when ContentType is empty.
+	Name        string
+	ContentType string
+	// Inline shows the file in the browser instead of downloading it.
+	Inline bool
+	// Size is the content length, or 0 when unknown. With a reader that is
+	// also an io.ReaderAt, a size enables range requests.
+	Size    int64
+	ModTime time.Time
+	// ETag overrides the entity tag derived from ModTime and Size.
+	ETag string
+}
+
+// RespondFile sends content as a download, or inline, with the headers
+// handlers tend to get subtly wrong: an RFC 6266 Content-Disposition with an
+// RFC 5987 encoded name, Content-Type, ETag and Last-Modified. Conditional
+// requests answer 304, and when content can seek (io.ReadSeeker, or
+// io.ReaderAt with a Size) range requests are served so interrupted
+// downloads resume. Other readers are streamed whole.
+func RespondFile(w http.ResponseWriter, r *http.Request, content io.Reader, opts FileOptions) error {
+	h := w.Header()
+	h.Set("Content-Disposition", ContentDisposition(opts.Inline, opts.Name))
+	h.Set("X-Content-Type-Options", "nosniff")
+	if ctype := fileContentType(opts); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+	if etag := fileETag(opts); etag != "" {
+		h.Set("ETag", etag)
+	}
+
+	if seeker := fileSeeker(content, opts.Size); seeker != nil {
+		// ServeContent handles ranges, If-Range and the conditional headers.
+		http.ServeContent(w, r, opts.Name, opts.ModTime, seeker)
+		return nil
+	}
+
+	if !opts.ModTime.IsZero() {
+		h.Set("Last-Modified", opts.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, h.Get("ETag"), opts.ModTime) {
+		h.Del("Content-Type")
+		h.Del("Content-Disposition")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	h.Set("Accept-Ranges", "none")
+	if h.Get("Content-Type") == "" {
+		buffered := bufio.NewReaderSize(content, sniffLen)
+		head, _ := buffered.Peek(sniffLen)
+		h.Set("Content-Type", http.DetectContentType(head))
+		content = buffered
+	}
+	if opts.Size > 0 {
+		h.Set("Content-Length", strconv.FormatInt(opts.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		return fmt.Errorf("respond file %s: %w", opts.Name, err)
+	}
+	return nil
+}
+
+// ContentDisposition formats an attachment (or inline) disposition for name
+// with an ASCII fallback filename and, when name is not plain ASCII, an
+// RFC 5987 filename* parameter.
+func ContentDisposition(inline bool, name string) string {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return disposition
+	}
+	fallback, ascii := asciiFilename(name)
+	value := disposition + `; filename="` + fallback + `"`
+	if !ascii {
+		value += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return value
+}
+
+// asciiFilename replaces the characters a quoted filename cannot carry.
+func asciiFilename(name string) (string, bool) {
+	var b strings.Builder
+	ascii := true
+	for _, r := range name {
+		switch {
+		case r > 0x7e:
+			ascii = false
+			b.WriteByte('_')
+		case r < 0x20 || r == '"' || r == '\\':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), ascii
+}
+
+// encodeRFC5987 percent-encodes every byte outside the RFC 5987 attr-char set.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	return b.String()
+}
+
+func fileContentType(opts FileOptions) string {
+	if opts.ContentType != "" {
+		return opts.ContentType
+	}
+	if ext := path.Ext(opts.Name); ext != "" {
+		return mime.TypeByExtension(ext)
+	}
+	return ""
+}
+
+// fileETag is opts.ETag, quoted when needed, or a tag derived from the
+// modification time and size when both are known.
+func fileETag(opts FileOptions) string {
+	if etag := opts.ETag; etag != "" {
+		if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+			return etag
+		}
+		return strconv.Quote(etag)
+	}
+	if opts.ModTime.IsZero() || opts.Size <= 0 {
+		return ""
+	}
+	return `"` + strconv.FormatInt(opts.ModTime.UnixNano(), 36) + "-" + strconv.FormatInt(opts.Size, 36) + `"`
+}
+
+func fileSeeker(content io.Reader, size int64) io.ReadSeeker {
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		return seeker
+	}
+	if at, ok := content.(io.ReaderAt); ok && size > 0 {
+		return io.NewSectionReader(at, 0, size)
+	}
+	return nil
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since without it, for
+// GET and HEAD requests.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
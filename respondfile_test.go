@@ -0,0 +1,109 @@
+package aqm
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRespondFileRanges(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	opts := FileOptions{Name: "report.csv", Size: 10, ModTime: modTime}
+
+	rec := httptest.NewRecorder()
+	if err := RespondFile(rec, httptest.NewRequest(http.MethodGet, "/report", nil), strings.NewReader("0123456789"), opts); err != nil {
+		t.Fatal(err)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("full response = %d %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="report.csv"` {
+		t.Errorf("disposition = %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("content type = %q", got)
+	}
+	if etag == "" || rec.Header().Get("Last-Modified") != "Fri, 01 Mar 2024 12:00:00 GMT" || rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("missing validators or ranges: %v", rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.Header.Set("Range", "bytes=4-")
+	req.Header.Set("If-Range", etag)
+	rec = httptest.NewRecorder()
+	// Expose only ReadAt, as a blob handle would, to resume through a SectionReader.
+	if err := RespondFile(rec, req, struct {
+		io.ReaderAt
+		io.Reader
+	}{bytes.NewReader([]byte("0123456789")), nil}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "456789" || rec.Header().Get("Content-Range") != "bytes 4-9/10" {
+		t.Errorf("resumed response = %d %q %v", rec.Code, rec.Body, rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	RespondFile(rec, req, strings.NewReader("0123456789"), opts)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional status = %d, want 304", rec.Code)
+	}
+}
+
+func TestRespondFileStream(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	opts := FileOptions{Name: "Übersicht 2024.pdf", Inline: true, ModTime: modTime, ETag: "v1"}
+	content := func() io.Reader { return io.MultiReader(strings.NewReader("%PDF-1.4 body")) }
+
+	rec := httptest.NewRecorder()
+	if err := RespondFile(rec, httptest.NewRequest(http.MethodGet, "/doc", nil), content(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "%PDF-1.4 body" {
+		t.Fatalf("response = %d %q", rec.Code, rec.Body)
+	}
+	want := `inline; filename="_bersicht 2024.pdf"; filename*=UTF-8''%C3%9Cbersicht%202024.pdf`
+	if got := rec.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("disposition = %q, want %q", got, want)
+	}
+	if rec.Header().Get("ETag") != `"v1"` || rec.Header().Get("Accept-Ranges") != "none" || rec.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	req.Header.Set("If-Modified-Since", modTime.Add(time.Minute).Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	RespondFile(rec, req, content(), opts)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("conditional = %d %q, want 304", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	RespondFile(rec, httptest.NewRequest(http.MethodGet, "/doc", nil), content(), FileOptions{})
+	if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("sniffed content type = %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment" {
+		t.Errorf("nameless disposition = %q", got)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := map[string]string{
+		"../etc/passwd":      `attachment; filename="passwd"`,
+		`say "hi".txt`:       `attachment; filename="say _hi_.txt"`,
+		"naïve;x=1.txt":      `attachment; filename="na_ve;x=1.txt"; filename*=UTF-8''na%C3%AFve%3Bx%3D1.txt`,
+		`C:\reports\q1.xlsx`: `attachment; filename="q1.xlsx"`,
+	}
+	for name, want := range tests {
+		if got := ContentDisposition(false, name); got != want {
+			t.Errorf("ContentDisposition(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
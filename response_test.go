@@ -365,3 +365,67 @@ func TestRespondChild(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
 	}
 }
+
+// benchWriter discards the body so benchmarks measure the encoding alone.
+type benchWriter struct {
+	header http.Header
+}
+
+func newBenchWriter() *benchWriter {
+	return &benchWriter{header: make(http.Header)}
+}
+
+func (w *benchWriter) Header() http.Header         { return w.header }
+func (w *benchWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *benchWriter) WriteHeader(int)             {}
+
+type benchOrder struct {
+	ID    string   `json:"id"`
+	Total float64  `json:"total"`
+	Items []string `json:"items"`
+}
+
+var benchOrders = []benchOrder{
+	{ID: "ord-1", Total: 42.5, Items: []string{"book", "pen"}},
+	{ID: "ord-2", Total: 7, Items: []string{"mug"}},
+}
+
+func BenchmarkRespond(b *testing.B) {
+	w := newBenchWriter()
+	meta := map[string]int{"total": len(benchOrders)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Respond(w, http.StatusOK, benchOrders, meta)
+	}
+}
+
+func BenchmarkRespondSuccessWithLinks(b *testing.B) {
+	w := newBenchWriter()
+	links := CollectionLinksFor("order")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		RespondSuccess(w, benchOrders[0], links...)
+	}
+}
+
+func BenchmarkError(b *testing.B) {
+	w := newBenchWriter()
+	details := []ValidationError{{Field: "email", Code: "required", Message: "email is required"}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Error(w, http.StatusUnprocessableEntity, "validation_failed", "invalid order", details...)
+	}
+}
+
+func BenchmarkRespondParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		w := newBenchWriter()
+		for pb.Next() {
+			Respond(w, http.StatusOK, benchOrders, nil)
+		}
+	})
+}
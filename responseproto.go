@@ -0,0 +1,63 @@
+package aqm
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protobuf media types. ContentTypeProtobuf is written on binary responses;
+// both are accepted in the Accept header.
+const (
+	ContentTypeProtobuf    = "application/x-protobuf"
+	contentTypeProtobufAlt = "application/protobuf"
+)
+
+// AcceptsProtobuf reports whether the Accept header asks for binary protobuf
+// ahead of JSON.
+func AcceptsProtobuf(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ContentTypeProtobuf, contentTypeProtobufAlt:
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// RespondProto writes msg as binary protobuf when the request accepts
+// application/x-protobuf, and otherwise as canonical protojson in the data
+// field of the standard success envelope, so REST endpoints can reuse gRPC
+// message types. The message is encoded before anything is written, so an
+// encoding error can still produce an error response.
+func RespondProto(w http.ResponseWriter, r *http.Request, msg proto.Message, links ...Link) error {
+	if AcceptsProtobuf(r) {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("respond proto: %w", err)
+		}
+		w.Header().Set("Content-Type", ContentTypeProtobuf)
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(data)
+		return err
+	}
+
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("respond proto: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(SuccessResponse{Data: json.RawMessage(data), Links: links})
+}
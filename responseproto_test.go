@@ -0,0 +1,85 @@
+package aqm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestAcceptsProtobuf(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/x-protobuf", want: true},
+		{accept: "application/protobuf;q=0.9", want: true},
+		{accept: "application/json, application/x-protobuf", want: false},
+		{accept: "*/*", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			if got := AcceptsProtobuf(req); got != tt.want {
+				t.Errorf("AcceptsProtobuf(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRespondProto(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]any{"name": "widget", "count": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if err := RespondProto(rec, req, msg, Link{Rel: RelSelf, Href: "/widgets/1"}); err != nil {
+			t.Fatalf("RespondProto: %v", err)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var body struct {
+			Data  map[string]any `json:"data"`
+			Links []Link         `json:"links"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body.Data["name"] != "widget" || body.Data["count"] != float64(3) {
+			t.Errorf("unexpected data %v", body.Data)
+		}
+		if len(body.Links) != 1 || body.Links[0].Href != "/widgets/1" {
+			t.Errorf("unexpected links %v", body.Links)
+		}
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", ContentTypeProtobuf)
+		if err := RespondProto(rec, req, msg); err != nil {
+			t.Fatalf("RespondProto: %v", err)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != ContentTypeProtobuf {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var decoded structpb.Struct
+		if err := proto.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if !proto.Equal(&decoded, msg) {
+			t.Errorf("decoded %v, want %v", &decoded, msg)
+		}
+	})
+}
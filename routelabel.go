@@ -0,0 +1,90 @@
+package aqm
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// UnmatchedRouteLabel labels requests that did not match a registered route.
+	UnmatchedRouteLabel = "unmatched"
+	// OverflowRouteLabel labels requests once the distinct label cap is reached.
+	OverflowRouteLabel = "other"
+
+	defaultMaxRouteLabels = 500
+)
+
+// RouteLabeler turns requests into metric path labels with bounded
+// cardinality: the chi route pattern (/todos/{id}) instead of the raw path,
+// a fixed label for unmatched requests and a cap on distinct values.
+type RouteLabeler struct {
+	unmatched func(*http.Request) string
+	max       int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// RouteLabelOption customises a RouteLabeler.
+type RouteLabelOption func(*RouteLabeler)
+
+// WithUnmatchedRouteLabel installs a hook that names requests without a chi
+// route pattern (404s, handlers mounted outside chi). Returning "" falls back
+// to UnmatchedRouteLabel.
+func WithUnmatchedRouteLabel(fn func(*http.Request) string) RouteLabelOption {
+	return func(l *RouteLabeler) {
+		l.unmatched = fn
+	}
+}
+
+// WithMaxRouteLabels caps the number of distinct labels; further values are
+// reported as OverflowRouteLabel. Non-positive values keep the default of 500.
+func WithMaxRouteLabels(max int) RouteLabelOption {
+	return func(l *RouteLabeler) {
+		if max > 0 {
+			l.max = max
+		}
+	}
+}
+
+// NewRouteLabeler builds a RouteLabeler with the provided options.
+func NewRouteLabeler(opts ...RouteLabelOption) *RouteLabeler {
+	l := &RouteLabeler{
+		max:  defaultMaxRouteLabels,
+		seen: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(l)
+		}
+	}
+	return l
+}
+
+// Label returns the metric label for r. Call it after the handler ran, since
+// chi only fills in the route pattern while routing.
+func (l *RouteLabeler) Label(r *http.Request) string {
+	label := ""
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		label = rctx.RoutePattern()
+	}
+	if label == "" && l.unmatched != nil {
+		label = l.unmatched(r)
+	}
+	if label == "" {
+		label = UnmatchedRouteLabel
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[label]; ok {
+		return label
+	}
+	if len(l.seen) >= l.max {
+		return OverflowRouteLabel
+	}
+	l.seen[label] = struct{}{}
+	return label
+}
@@ -0,0 +1,68 @@
+package aqm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRouteLabeler(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []RouteLabelOption
+		path string
+		want string
+	}{
+		{name: "routePattern", path: "/todos/123", want: "/todos/{id}"},
+		{name: "unmatched", path: "/missing/1", want: UnmatchedRouteLabel},
+		{
+			name: "unmatchedHook",
+			opts: []RouteLabelOption{WithUnmatchedRouteLabel(func(r *http.Request) string {
+				return "/" + strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0] + "/*"
+			})},
+			path: "/missing/1",
+			want: "/missing/*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labeler := NewRouteLabeler(tt.opts...)
+			var got string
+			router := chi.NewRouter()
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r)
+					got = labeler.Label(r)
+				})
+			})
+			router.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRouteLabelerCap(t *testing.T) {
+	labeler := NewRouteLabeler(WithMaxRouteLabels(2), WithUnmatchedRouteLabel(func(r *http.Request) string {
+		return r.URL.Path
+	}))
+
+	labels := make([]string, 0, 4)
+	for _, path := range []string{"/a", "/b", "/c", "/a"} {
+		labels = append(labels, labeler.Label(httptest.NewRequest(http.MethodGet, path, nil)))
+	}
+
+	want := []string{"/a", "/b", OverflowRouteLabel, "/a"}
+	for i := range want {
+		if labels[i] != want[i] {
+			t.Errorf("label %d: expected %q, got %q", i, want[i], labels[i])
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package aqm
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CoreModule attributes routes registered by Micro itself, such as the
+// health and debug endpoints.
+const CoreModule = "aqm"
+
+// RouteConflictError reports a route claimed by two registrations. Module is
+// the registration that failed and Existing the one that owned the route.
+type RouteConflictError struct {
+	Method   string
+	Pattern  string
+	Module   string
+	Existing string
+}
+
+func (e *RouteConflictError) Error() string {
+	return fmt.Sprintf("route %s %s registered by %s conflicts with %s", e.Method, e.Pattern, e.Module, e.Existing)
+}
+
+type routeClaim struct {
+	method  string
+	pattern string
+	module  string
+	mount   bool
+}
+
+// routeTable records which module registered each route so collisions are
+// reported with attribution before chi panics or silently overrides them.
+type routeTable struct {
+	mu     sync.Mutex
+	claims []routeClaim
+}
+
+var routeParamPattern = regexp.MustCompile(`\{[^}:]*(:[^}]*)?\}`)
+
+// normalizeRoutePattern drops param names, since chi treats /users/{id} and
+// /users/{uid} as the same route.
+func normalizeRoutePattern(pattern string) string {
+	return routeParamPattern.ReplaceAllString(pattern, "{$1}")
+}
+
+func (t *routeTable) claim(method, pattern, module string, mount bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	normalized := normalizeRoutePattern(pattern)
+	for _, existing := range t.claims {
+		if normalizeRoutePattern(existing.pattern) != normalized {
+			continue
+		}
+		if existing.mount || mount || existing.method == "*" || method == "*" || existing.method == method {
+			return &RouteConflictError{Method: method, Pattern: pattern, Module: module, Existing: existing.module}
+		}
+	}
+	t.claims = append(t.claims, routeClaim{method: method, pattern: pattern, module: module, mount: mount})
+	return nil
+}
+
+// seed attributes the routes already present on r to module.
+func (t *routeTable) seed(r chi.Routes, module string) {
+	for _, route := range enumerateRoutes(r) {
+		_ = t.claim(route.Method, route.Pattern, module, false)
+	}
+}
+
+// owner returns the module that registered method and pattern, falling back
+// to the longest mount covering the pattern.
+func (t *routeTable) owner(method, pattern string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	owner, longest := "", -1
+	for _, c := range t.claims {
+		if c.mount {
+			prefix := strings.TrimSuffix(c.pattern, "*")
+			if (strings.HasPrefix(pattern, prefix) || pattern+"/" == prefix) && len(prefix) > longest {
+				owner, longest = c.module, len(prefix)
+			}
+			continue
+		}
+		if c.pattern == pattern && (c.method == method || c.method == "*") {
+			return c.module
+		}
+	}
+	return owner
+}
+
+// registerModule runs module.RegisterRoutes against router, recording its
+// routes under name. Conflicts and chi registration panics are returned as
+// errors naming the module.
+func (t *routeTable) registerModule(router chi.Router, name string, module HTTPModule) (err error) {
+	var conflict error
+	rec := &recordingRouter{Router: router, table: t, module: name, err: &conflict}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("http module %s: registering routes: %v", name, r)
+		}
+	}()
+	module.RegisterRoutes(rec)
+	if conflict != nil {
+		return fmt.Errorf("http module %s: %w", name, conflict)
+	}
+	return nil
+}
+
+func moduleName(module any) string {
+	if named, ok := module.(interface{ Name() string }); ok && named.Name() != "" {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", module)
+}
+
+// recordingRouter forwards registrations to the wrapped chi.Router after
+// claiming them in the route table. Routers derived through With, Group and
+// Route share the first conflict, and conflicting routes are not registered.
+type recordingRouter struct {
+	chi.Router
+	table  *routeTable
+	module string
+	prefix string
+	err    *error
+}
+
+func (r *recordingRouter) derive(router chi.Router, prefix string) *recordingRouter {
+	return &recordingRouter{Router: router, table: r.table, module: r.module, prefix: prefix, err: r.err}
+}
+
+func (r *recordingRouter) claim(method, pattern string, mount bool) bool {
+	if *r.err != nil {
+		return false
+	}
+	full := r.prefix + pattern
+	if mount {
+		full = strings.TrimSuffix(full, "/") + "/*"
+	}
+	if err := r.table.claim(method, full, r.module, mount); err != nil {
+		*r.err = err
+		return false
+	}
+	return true
+}
+
+func (r *recordingRouter) With(middlewares ...func(http.Handler) http.Handler) chi.Router {
+	return r.derive(r.Router.With(middlewares...), r.prefix)
+}
+
+func (r *recordingRouter) Group(fn func(chi.Router)) chi.Router {
+	return r.Router.Group(func(sub chi.Router) {
+		if fn != nil {
+			fn(r.derive(sub, r.prefix))
+		}
+	})
+}
+
+func (r *recordingRouter) Route(pattern string, fn func(chi.Router)) chi.Router {
+	if !r.claim("*", pattern, true) {
+		return chi.NewRouter()
+	}
+	return r.Router.Route(pattern, func(sub chi.Router) {
+		if fn != nil {
+			fn(r.derive(sub, r.prefix+pattern))
+		}
+	})
+}
+
+func (r *recordingRouter) Mount(pattern string, h http.Handler) {
+	if r.claim("*", pattern, true) {
+		r.Router.Mount(pattern, h)
+	}
+}
+
+func (r *recordingRouter) Handle(pattern string, h http.Handler) {
+	if r.claim("*", pattern, false) {
+		r.Router.Handle(pattern, h)
+	}
+}
+
+func (r *recordingRouter) HandleFunc(pattern string, h http.HandlerFunc) {
+	if r.claim("*", pattern, false) {
+		r.Router.HandleFunc(pattern, h)
+	}
+}
+
+func (r *recordingRouter) Method(method, pattern string, h http.Handler) {
+	if r.claim(strings.ToUpper(method), pattern, false) {
+		r.Router.Method(method, pattern, h)
+	}
+}
+
+func (r *recordingRouter) MethodFunc(method, pattern string, h http.HandlerFunc) {
+	if r.claim(strings.ToUpper(method), pattern, false) {
+		r.Router.MethodFunc(method, pattern, h)
+	}
+}
+
+func (r *recordingRouter) Connect(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodConnect, pattern, h)
+}
+
+func (r *recordingRouter) Delete(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodDelete, pattern, h)
+}
+
+func (r *recordingRouter) Get(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodGet, pattern, h)
+}
+
+func (r *recordingRouter) Head(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodHead, pattern, h)
+}
+
+func (r *recordingRouter) Options(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodOptions, pattern, h)
+}
+
+func (r *recordingRouter) Patch(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodPatch, pattern, h)
+}
+
+func (r *recordingRouter) Post(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodPost, pattern, h)
+}
+
+func (r *recordingRouter) Put(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodPut, pattern, h)
+}
+
+func (r *recordingRouter) Trace(pattern string, h http.HandlerFunc) {
+	r.MethodFunc(http.MethodTrace, pattern, h)
+}
+
+// Routes returns every route served by the HTTP server with the module that
+// registered it, sorted by pattern and method. It is empty until
+// WithHTTPServer has been applied.
+func (micro *Micro) Routes() []RouteInfo {
+	micro.mu.RLock()
+	router, table := micro.httpRouter, micro.routeTable
+	micro.mu.RUnlock()
+	if router == nil {
+		return []RouteInfo{}
+	}
+	return attributedRoutes(router, table)
+}
+
+func attributedRoutes(router chi.Routes, table *routeTable) []RouteInfo {
+	routes := enumerateRoutes(router)
+	for i := range routes {
+		if table != nil {
+			routes[i].Module = table.owner(routes[i].Method, routes[i].Pattern)
+		}
+		if routes[i].Module == "" {
+			routes[i].Module = CoreModule
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
@@ -0,0 +1,172 @@
+package aqm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type routesModule struct {
+	name     string
+	register func(chi.Router)
+}
+
+func (m *routesModule) Name() string                { return m.name }
+func (m *routesModule) RegisterRoutes(r chi.Router) { m.register(r) }
+
+func noopHandler(http.ResponseWriter, *http.Request) {}
+
+func TestRouteTableConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    func(chi.Router)
+		second   func(chi.Router)
+		conflict bool
+	}{
+		{
+			name:     "sameMethodAndPattern",
+			first:    func(r chi.Router) { r.Get("/users/{id}", noopHandler) },
+			second:   func(r chi.Router) { r.Get("/users/{userID}", noopHandler) },
+			conflict: true,
+		},
+		{
+			name:   "differentMethods",
+			first:  func(r chi.Router) { r.Get("/users", noopHandler) },
+			second: func(r chi.Router) { r.Post("/users", noopHandler) },
+		},
+		{
+			name:     "handleAllMethods",
+			first:    func(r chi.Router) { r.Get("/users", noopHandler) },
+			second:   func(r chi.Router) { r.Handle("/users", http.HandlerFunc(noopHandler)) },
+			conflict: true,
+		},
+		{
+			name:     "sameRoutePrefix",
+			first:    func(r chi.Router) { r.Route("/api", func(r chi.Router) { r.Get("/a", noopHandler) }) },
+			second:   func(r chi.Router) { r.Route("/api", func(r chi.Router) { r.Get("/b", noopHandler) }) },
+			conflict: true,
+		},
+		{
+			name:  "nestedWithChain",
+			first: func(r chi.Router) { r.Route("/api", func(r chi.Router) { r.Get("/items", noopHandler) }) },
+			second: func(r chi.Router) {
+				r.Group(func(r chi.Router) { r.With().Get("/api/*", noopHandler) })
+			},
+			conflict: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &routeTable{}
+			router := chi.NewRouter()
+			if err := table.registerModule(router, "first", &routesModule{register: tt.first}); err != nil {
+				t.Fatalf("first module: %v", err)
+			}
+			err := table.registerModule(router, "second", &routesModule{register: tt.second})
+			if !tt.conflict {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var conflict *RouteConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("expected RouteConflictError, got %v", err)
+			}
+			if conflict.Module != "second" || conflict.Existing != "first" {
+				t.Errorf("unexpected attribution %+v", conflict)
+			}
+		})
+	}
+}
+
+func TestRouteTableRecoversChiPanics(t *testing.T) {
+	table := &routeTable{}
+	err := table.registerModule(chi.NewRouter(), "broken", &routesModule{register: func(r chi.Router) {
+		r.Get("no-slash", noopHandler)
+	}})
+	if err == nil || !strings.Contains(err.Error(), "http module broken") {
+		t.Fatalf("expected attributed error, got %v", err)
+	}
+}
+
+func TestWithHTTPServerRouteConflict(t *testing.T) {
+	users := &routesModule{name: "users", register: func(r chi.Router) { r.Get("/users", noopHandler) }}
+	admin := &routesModule{name: "admin", register: func(r chi.Router) { r.Get("/users", noopHandler) }}
+
+	ms := &Micro{deps: DefaultDeps()}
+	ms.deps.Config = NewConfig()
+	err := WithHTTPServerModules("http.port", users, admin)(ms)
+	if err == nil || !strings.Contains(err.Error(), "route GET /users registered by admin conflicts with users") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	health := &routesModule{name: "health", register: func(r chi.Router) { r.Get("/healthz", noopHandler) }}
+	ms = &Micro{deps: DefaultDeps()}
+	ms.deps.Config = NewConfig()
+	err = WithHTTPServerModules("http.port", health)(ms)
+	var conflict *RouteConflictError
+	if !errors.As(err, &conflict) || conflict.Existing != CoreModule {
+		t.Fatalf("expected conflict with core routes, got %v", err)
+	}
+}
+
+func TestMicroRoutes(t *testing.T) {
+	users := &routesModule{name: "users", register: func(r chi.Router) {
+		r.Route("/users", func(r chi.Router) {
+			r.Get("/", noopHandler)
+			r.Post("/{id}", noopHandler)
+		})
+	}}
+	files := &routesModule{name: "files", register: func(r chi.Router) {
+		r.Mount("/files", http.HandlerFunc(noopHandler))
+	}}
+	cfg := NewConfig()
+	cfg.SetProfile(ProfileDev)
+	ms := NewMicro(WithConfig(cfg), WithLogger(NewNoopLogger()), WithHTTPServerModules("http.port", users, files))
+
+	owners := map[string]string{}
+	for _, route := range ms.Routes() {
+		owners[route.Method+" "+route.Pattern] = route.Module
+	}
+	want := map[string]string{
+		"GET /users/":      "users",
+		"POST /users/{id}": "users",
+		"GET /files/*":     "files",
+		"GET /healthz":     CoreModule,
+	}
+	for key, module := range want {
+		if owners[key] != module {
+			t.Errorf("expected %s owned by %q, got %q", key, module, owners[key])
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+	var listed []RouteInfo
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	found := false
+	for _, route := range listed {
+		if route.Pattern == "/users/{id}" && route.Module == "users" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected /debug/routes to include module attribution, got %+v", listed)
+	}
+}
+
+func TestMicroRoutesWithoutHTTPServer(t *testing.T) {
+	ms := NewMicro(WithConfig(NewConfig()), WithLogger(NewNoopLogger()))
+	if routes := ms.Routes(); len(routes) != 0 {
+		t.Errorf("expected no routes, got %v", routes)
+	}
+}
@@ -0,0 +1,162 @@
+package aqm
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RequestTimeoutHeader carries the caller's remaining deadline in milliseconds
+// so downstream services can stop working on requests nobody is waiting for.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+type routeTimeoutKeyType struct{}
+
+var routeTimeoutKey routeTimeoutKeyType
+
+// WithRouteTimeout returns a chi middleware that applies a per-route deadline
+// to the routes it wraps. The route timeout never outlives a deadline already
+// on the request (the global timeout or one propagated by the caller); routes
+// that need more time, such as long exports or uploads, require a larger
+// global timeout with tighter values on the remaining routes.
+//
+//	r.With(aqm.WithRouteTimeout(5*time.Second)).Get("/search", h.Search)
+func WithRouteTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := ContextWithRouteTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ContextWithRouteTimeout derives a context whose deadline is the earlier of
+// d from now and the parent deadline, and records d for RouteTimeoutFrom.
+func ContextWithRouteTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(parent, d)
+	return context.WithValue(ctx, routeTimeoutKey, d), cancel
+}
+
+// RouteTimeoutFrom reports the per-route timeout applied to the context, if any.
+func RouteTimeoutFrom(ctx context.Context) (time.Duration, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	d, ok := ctx.Value(routeTimeoutKey).(time.Duration)
+	return d, ok
+}
+
+// RemainingTimeout returns the time left before the context deadline. The
+// boolean is false when the context carries no deadline.
+func RemainingTimeout(ctx context.Context) (time.Duration, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	remaining := time.Until(deadline)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// ParseRequestTimeout reads the propagated deadline from the request headers.
+func ParseRequestTimeout(r *http.Request) (time.Duration, bool) {
+	raw := strings.TrimSpace(r.Header.Get(RequestTimeoutHeader))
+	if raw == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// SetRequestTimeoutHeader forwards the remaining deadline of ctx to an outgoing request.
+func SetRequestTimeoutHeader(ctx context.Context, req *http.Request) {
+	if remaining, ok := RemainingTimeout(ctx); ok {
+		ms := remaining.Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		req.Header.Set(RequestTimeoutHeader, strconv.FormatInt(ms, 10))
+	}
+}
+
+// RouteTimeouts is a registry of per-route deadlines keyed by method and chi
+// route pattern. It lets modules declare timeouts next to their routes and
+// apply them from a single middleware.
+type RouteTimeouts struct {
+	mu       sync.RWMutex
+	timeouts map[string]time.Duration
+}
+
+// NewRouteTimeouts constructs an empty registry.
+func NewRouteTimeouts() *RouteTimeouts {
+	return &RouteTimeouts{timeouts: map[string]time.Duration{}}
+}
+
+// Set registers a timeout for the route. Use "*" as method to match any method.
+func (rt *RouteTimeouts) Set(method, pattern string, d time.Duration) {
+	if pattern == "" || d <= 0 {
+		return
+	}
+	rt.mu.Lock()
+	rt.timeouts[routeTimeoutKeyFor(method, pattern)] = d
+	rt.mu.Unlock()
+}
+
+// Lookup returns the timeout registered for the method and route pattern.
+func (rt *RouteTimeouts) Lookup(method, pattern string) (time.Duration, bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	if d, ok := rt.timeouts[routeTimeoutKeyFor(method, pattern)]; ok {
+		return d, true
+	}
+	d, ok := rt.timeouts[routeTimeoutKeyFor("*", pattern)]
+	return d, ok
+}
+
+// Middleware resolves the route pattern using routes and applies the matching
+// registered timeout. It can be installed globally because resolution does not
+// depend on chi having routed the request yet.
+func (rt *RouteTimeouts) Middleware(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if routes == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			pattern := routes.Find(chi.NewRouteContext(), r.Method, r.URL.Path)
+			d, ok := rt.Lookup(r.Method, pattern)
+			if pattern == "" || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := ContextWithRouteTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func routeTimeoutKeyFor(method, pattern string) string {
+	if method == "" {
+		method = "*"
+	}
+	return strings.ToUpper(method) + " " + pattern
+}
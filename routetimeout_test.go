@@ -0,0 +1,139 @@
+package aqm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestContextWithRouteTimeoutShortens(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	ctx, done := ContextWithRouteTimeout(parent, time.Second)
+	defer done()
+
+	remaining, ok := RemainingTimeout(ctx)
+	if !ok || remaining > time.Second {
+		t.Errorf("expected remaining <= 1s, got %v (ok=%v)", remaining, ok)
+	}
+	if d, ok := RouteTimeoutFrom(ctx); !ok || d != time.Second {
+		t.Errorf("expected route timeout 1s, got %v", d)
+	}
+}
+
+func TestContextWithRouteTimeoutKeepsEarlierDeadline(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ctx, done := ContextWithRouteTimeout(parent, time.Hour)
+	defer done()
+
+	remaining, ok := RemainingTimeout(ctx)
+	if !ok || remaining > 20*time.Millisecond {
+		t.Errorf("expected parent deadline to win, got %v (ok=%v)", remaining, ok)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("route context outlived the parent deadline")
+	}
+	if d, ok := RouteTimeoutFrom(ctx); !ok || d != time.Hour {
+		t.Errorf("expected route timeout 1h, got %v", d)
+	}
+}
+
+func TestContextWithRouteTimeoutPropagatesCancel(t *testing.T) {
+	parent, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	client, cancelClient := context.WithCancel(parent)
+
+	ctx, done := ContextWithRouteTimeout(client, time.Hour)
+	defer done()
+
+	cancelClient()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("client cancellation was not propagated")
+	}
+}
+
+func TestRequestTimeoutHeader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	SetRequestTimeoutHeader(ctx, req)
+
+	d, ok := ParseRequestTimeout(req)
+	if !ok || d <= 0 || d > 2*time.Second {
+		t.Errorf("unexpected propagated timeout %v (ok=%v)", d, ok)
+	}
+
+	req.Header.Set(RequestTimeoutHeader, "nope")
+	if _, ok := ParseRequestTimeout(req); ok {
+		t.Error("expected invalid header to be ignored")
+	}
+}
+
+func TestRouteTimeoutsMiddleware(t *testing.T) {
+	registry := NewRouteTimeouts()
+	registry.Set(http.MethodGet, "/exports/{id}", 3*time.Second)
+
+	var got time.Duration
+	router := chi.NewRouter()
+	router.Use(registry.Middleware(router))
+	router.Get("/exports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = RouteTimeoutFrom(r.Context())
+	})
+	router.Get("/other", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = RouteTimeoutFrom(r.Context())
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/exports/42", nil))
+	if got != 3*time.Second {
+		t.Errorf("expected 3s route timeout, got %v", got)
+	}
+
+	got = 0
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+	if got != 0 {
+		t.Errorf("expected no route timeout, got %v", got)
+	}
+}
+
+func TestWithRouteTimeout(t *testing.T) {
+	var remaining time.Duration
+	handler := WithRouteTimeout(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining, _ = RemainingTimeout(r.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if remaining <= 0 || remaining > time.Minute {
+		t.Errorf("unexpected remaining timeout %v", remaining)
+	}
+}
+
+func TestHTTPClientForwardsDeadline(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(RequestTimeoutHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL})
+	if err := client.Delete(ctx, "/x"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if header == "" {
+		t.Error("expected deadline header to be forwarded")
+	}
+}
@@ -1,9 +1,130 @@
 package aqm
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
 
 // Runner represents a lifecycle-managed component such as an HTTP or gRPC server.
 type Runner interface {
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
 }
+
+// ErrRunnerStartTimeout is returned when a runner exceeds its start timeout.
+var ErrRunnerStartTimeout = errors.New("start timed out")
+
+// NamedRunner is implemented by runners that identify themselves in start
+// errors and logs.
+type NamedRunner interface {
+	Runner
+	Name() string
+}
+
+// RunnerOption customises a runner registered with WithRunner.
+type RunnerOption func(*configuredRunner)
+
+// WithRunnerName names the runner in start errors and logs.
+func WithRunnerName(name string) RunnerOption {
+	return func(r *configuredRunner) {
+		r.name = name
+	}
+}
+
+// WithRunnerStartTimeout bounds how long the runner may take to start,
+// overriding the runner.start_timeout config value.
+func WithRunnerStartTimeout(timeout time.Duration) RunnerOption {
+	return func(r *configuredRunner) {
+		r.startTimeout = timeout
+	}
+}
+
+type configuredRunner struct {
+	Runner
+	name         string
+	startTimeout time.Duration
+}
+
+func (r *configuredRunner) Name() string {
+	if r.name != "" {
+		return r.name
+	}
+	return runnerName(r.Runner)
+}
+
+func runnerName(r Runner) string {
+	if named, ok := r.(NamedRunner); ok && named.Name() != "" {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", r)
+}
+
+func runnerStartTimeout(r Runner, def time.Duration) time.Duration {
+	if configured, ok := r.(*configuredRunner); ok && configured.startTimeout > 0 {
+		return configured.startTimeout
+	}
+	return def
+}
+
+// startRunners starts every runner concurrently with ctx. When one fails or
+// exceeds its start timeout, cancel aborts the remaining starts and, once
+// every Start has returned, all runners are stopped in reverse registration
+// order: a Start that failed or was cancelled may still have acquired
+// resources. The returned error names the first runner that failed.
+func startRunners(ctx context.Context, cancel context.CancelFunc, runners []Runner, defaultTimeout time.Duration) error {
+	if len(runners) == 0 {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, runner := range runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := startRunner(ctx, runner, runnerStartTimeout(runner, defaultTimeout)); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("runner %s start: %w", runnerName(runner), err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr == nil {
+		return nil
+	}
+
+	stopCtx := context.WithoutCancel(ctx)
+	for i := len(runners) - 1; i >= 0; i-- {
+		if err := runners[i].Stop(stopCtx); err != nil {
+			firstErr = errors.Join(firstErr, fmt.Errorf("runner %s rollback: %w", runnerName(runners[i]), err))
+		}
+	}
+	return firstErr
+}
+
+// startRunner waits for runner.Start up to timeout. A timed out start keeps
+// running in the background, so the caller must still stop the runner.
+func startRunner(ctx context.Context, runner Runner, timeout time.Duration) error {
+	if timeout <= 0 {
+		return runner.Start(ctx)
+	}
+	done := make(chan error, 1)
+	go func() { done <- runner.Start(ctx) }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %s", ErrRunnerStartTimeout, timeout)
+	}
+}
@@ -3,7 +3,10 @@ package aqm
 import (
 	"context"
 	"errors"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRunnerInterface(t *testing.T) {
@@ -91,3 +94,157 @@ func TestRunnerImplLifecycle(t *testing.T) {
 		t.Error("Stop should have been called")
 	}
 }
+
+type blockingRunner struct {
+	delay   time.Duration
+	err     error
+	started atomic.Bool
+	stopped atomic.Bool
+}
+
+func (r *blockingRunner) Start(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	r.started.Store(true)
+	return nil
+}
+
+func (r *blockingRunner) Stop(context.Context) error {
+	r.stopped.Store(true)
+	return nil
+}
+
+func TestStartRunnersConcurrently(t *testing.T) {
+	runners := []Runner{
+		&blockingRunner{delay: 50 * time.Millisecond},
+		&blockingRunner{delay: 50 * time.Millisecond},
+		&blockingRunner{delay: 50 * time.Millisecond},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	begin := time.Now()
+	if err := startRunners(ctx, cancel, runners, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 120*time.Millisecond {
+		t.Errorf("expected concurrent start, took %v", elapsed)
+	}
+}
+
+func TestStartRunnersFailureStopsStarted(t *testing.T) {
+	ok := &blockingRunner{}
+	slow := &blockingRunner{delay: time.Second}
+	failing := &blockingRunner{delay: 10 * time.Millisecond, err: errors.New("bind failed")}
+	runners := []Runner{
+		ok,
+		slow,
+		&configuredRunner{Runner: failing, name: "api"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := startRunners(ctx, cancel, runners, 0)
+	if err == nil || !strings.Contains(err.Error(), "runner api start: bind failed") {
+		t.Fatalf("expected named start error, got %v", err)
+	}
+	if !ok.stopped.Load() {
+		t.Error("expected started runner to be stopped")
+	}
+	if slow.started.Load() || !slow.stopped.Load() {
+		t.Error("expected cancelled runner to be stopped without starting")
+	}
+	if !failing.stopped.Load() {
+		t.Error("expected failed runner to be stopped")
+	}
+}
+
+// slowStartRunner acquires its resources as soon as Start is called but only
+// reports ready after delay, returning the context error when cancelled.
+type slowStartRunner struct {
+	delay    time.Duration
+	acquired atomic.Bool
+}
+
+func (r *slowStartRunner) Start(ctx context.Context) error {
+	r.acquired.Store(true)
+	select {
+	case <-time.After(r.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *slowStartRunner) Stop(context.Context) error {
+	r.acquired.Store(false)
+	return nil
+}
+
+func TestStartRunnersFailureStopsSlowStarter(t *testing.T) {
+	slow := &slowStartRunner{delay: time.Second}
+	runners := []Runner{slow, &blockingRunner{delay: 10 * time.Millisecond, err: errors.New("bind failed")}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startRunners(ctx, cancel, runners, 0); err == nil {
+		t.Fatal("expected start error")
+	}
+	if slow.acquired.Load() {
+		t.Error("expected runner cancelled mid-start to be stopped")
+	}
+}
+
+func TestStartRunnersTimeout(t *testing.T) {
+	hung := &blockingRunner{delay: time.Second}
+	runners := []Runner{&configuredRunner{Runner: hung, startTimeout: 10 * time.Millisecond}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := startRunners(ctx, cancel, runners, 0)
+	if !errors.Is(err, ErrRunnerStartTimeout) {
+		t.Fatalf("expected ErrRunnerStartTimeout, got %v", err)
+	}
+	if !hung.stopped.Load() {
+		t.Error("expected timed out runner to be stopped")
+	}
+}
+
+func TestRunnerName(t *testing.T) {
+	tests := []struct {
+		name   string
+		runner Runner
+		want   string
+	}{
+		{name: "configured", runner: &configuredRunner{Runner: &testRunnerImpl{}, name: "worker"}, want: "worker"},
+		{name: "named", runner: &registrationRunner{}, want: "service registration"},
+		{name: "fallback", runner: &testRunnerImpl{}, want: "*aqm.testRunnerImpl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runnerName(tt.runner); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithRunnerOptions(t *testing.T) {
+	ms := &Micro{deps: DefaultDeps()}
+	if err := WithRunner(&testRunnerImpl{}, WithRunnerName("jobs"), WithRunnerStartTimeout(time.Second))(ms); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := runnerName(ms.runners[0]); got != "jobs" {
+		t.Errorf("expected runner name jobs, got %q", got)
+	}
+	if got := runnerStartTimeout(ms.runners[0], 0); got != time.Second {
+		t.Errorf("expected 1s start timeout, got %v", got)
+	}
+}
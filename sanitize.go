@@ -0,0 +1,205 @@
+package aqm
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const defaultEllipsis = "…"
+
+var (
+	scriptStylePattern = regexp.MustCompile(`(?is)<(script|style)\b[^>]*>.*?</(script|style)\s*>`)
+	tagPattern         = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z][^>]*>`)
+	whitespacePattern  = regexp.MustCompile(`\s+`)
+)
+
+// SanitizeFunc transforms user input before it is validated or persisted.
+type SanitizeFunc func(string) string
+
+// Sanitize applies fns to s in order:
+//
+//	name = aqm.Sanitize(name, aqm.NormalizeUnicode, aqm.StripControl, aqm.CollapseWhitespace, aqm.Truncator(80))
+func Sanitize(s string, fns ...SanitizeFunc) string {
+	for _, fn := range fns {
+		s = fn(s)
+	}
+	return s
+}
+
+// StripHTML removes tags, comments and the content of script and style
+// elements, then decodes entities, leaving plain text.
+func StripHTML(s string) string {
+	s = scriptStylePattern.ReplaceAllString(s, "")
+	s = tagPattern.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+// EscapeHTML escapes <, >, &, ' and " so the text renders literally.
+func EscapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// CollapseWhitespace replaces runs of whitespace with one space and trims
+// both ends.
+func CollapseWhitespace(s string) string {
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(s, " "))
+}
+
+// TrimSpace removes leading and trailing whitespace.
+func TrimSpace(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// NormalizeUnicode converts s to Unicode NFC, so visually identical input
+// compares and indexes equally.
+func NormalizeUnicode(s string) string {
+	return norm.NFC.String(s)
+}
+
+// StripControl removes control and format characters (including zero-width
+// and bidi overrides) except newlines and tabs, and drops invalid UTF-8.
+func StripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Truncate shortens s to at most max characters, ending with an ellipsis
+// when cut.
+func Truncate(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	ellipsis := []rune(defaultEllipsis)
+	if max <= len(ellipsis) {
+		return string(runes[:max])
+	}
+	return strings.TrimRightFunc(string(runes[:max-len(ellipsis)]), unicode.IsSpace) + defaultEllipsis
+}
+
+// Truncator returns a SanitizeFunc truncating to max characters.
+func Truncator(max int) SanitizeFunc {
+	return func(s string) string {
+		return Truncate(s, max)
+	}
+}
+
+var sanitizeRules = map[string]SanitizeFunc{
+	"trim":      TrimSpace,
+	"collapse":  CollapseWhitespace,
+	"nfc":       NormalizeUnicode,
+	"control":   StripControl,
+	"striphtml": StripHTML,
+	"escape":    EscapeHTML,
+}
+
+// SanitizeStruct rewrites the string fields of the struct v points to using
+// `sanitize` tags, applied in order, e.g.
+//
+//	Bio string `sanitize:"striphtml,control,nfc,collapse,truncate=280"`
+//
+// Available rules are trim, collapse, nfc, control, striphtml, escape and
+// truncate=N. Nested structs, pointers and slices are traversed.
+func SanitizeStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("sanitize: pointer to struct required")
+	}
+	return sanitizeValue(rv.Elem())
+}
+
+func sanitizeValue(v reflect.Value) error {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			value := v.Field(i)
+			if tag := field.Tag.Get("sanitize"); tag != "" && tag != "-" {
+				if err := sanitizeField(value, field.Name, tag); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := sanitizeValue(value); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := sanitizeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sanitizeField(value reflect.Value, name, tag string) error {
+	fns, err := parseSanitizeTag(tag)
+	if err != nil {
+		return fmt.Errorf("sanitize %s: %w", name, err)
+	}
+	apply := func(s reflect.Value) {
+		if s.Kind() == reflect.String && s.CanSet() {
+			s.SetString(Sanitize(s.String(), fns...))
+		}
+	}
+	target := indirect(value)
+	switch {
+	case !target.IsValid():
+	case target.Kind() == reflect.String:
+		apply(target)
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < target.Len(); i++ {
+			apply(target.Index(i))
+		}
+	default:
+		return fmt.Errorf("sanitize %s: tag on non-string field", name)
+	}
+	return nil
+}
+
+func parseSanitizeTag(tag string) ([]SanitizeFunc, error) {
+	var fns []SanitizeFunc
+	for _, raw := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(raw), "=")
+		if name == "truncate" {
+			max, err := strconv.Atoi(param)
+			if err != nil || max <= 0 {
+				return nil, fmt.Errorf("invalid truncate length %q", param)
+			}
+			fns = append(fns, Truncator(max))
+			continue
+		}
+		fn, ok := sanitizeRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		fns = append(fns, fn)
+	}
+	return fns, nil
+}
@@ -0,0 +1,77 @@
+package aqm
+
+import "testing"
+
+func TestSanitizeFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   SanitizeFunc
+		in   string
+		want string
+	}{
+		{"strip html", StripHTML, `<p>Hi <b>there</b><script>alert(1)</script><!-- x --> &amp; bye</p>`, "Hi there & bye"},
+		{"escape html", EscapeHTML, `<b>"x"</b>`, "&lt;b&gt;&#34;x&#34;&lt;/b&gt;"},
+		{"collapse", CollapseWhitespace, "  a \n\t b   c ", "a b c"},
+		{"nfc", NormalizeUnicode, "Jose\u0301", "Jos\u00e9"},
+		{"control", StripControl, "a\x00b\u200bc\u202ed\ne\tf", "abcd\ne\tf"},
+		{"truncate", Truncator(6), "hello world", "hello…"},
+		{"truncate short", Truncator(20), "hello", "hello"},
+		{"truncate runes", Truncator(3), "ñandú", "ña…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.in); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	if got := Sanitize("  <i>Ada</i>   Lovelace ", StripHTML, CollapseWhitespace); got != "Ada Lovelace" {
+		t.Errorf("unexpected chained result %q", got)
+	}
+}
+
+type testProfile struct {
+	Name    string   `sanitize:"striphtml,control,nfc,collapse"`
+	Bio     *string  `sanitize:"trim,truncate=5"`
+	Tags    []string `sanitize:"trim"`
+	Raw     string
+	Contact struct {
+		Email string `sanitize:"trim"`
+	}
+	Links []struct {
+		Label string `sanitize:"escape"`
+	}
+}
+
+func TestSanitizeStruct(t *testing.T) {
+	bio := "  a very long bio "
+	profile := testProfile{Name: " <b>Jose\u0301</b>\x00  Doe ", Bio: &bio, Tags: []string{" go "}, Raw: " keep "}
+	profile.Contact.Email = " ada@example.com "
+	profile.Links = append(profile.Links, struct {
+		Label string `sanitize:"escape"`
+	}{Label: "<x>"})
+
+	if err := SanitizeStruct(&profile); err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	if profile.Name != "Jos\u00e9 Doe" {
+		t.Errorf("unexpected name %q", profile.Name)
+	}
+	if *profile.Bio != "a ve…" {
+		t.Errorf("unexpected bio %q", *profile.Bio)
+	}
+	if profile.Tags[0] != "go" || profile.Raw != " keep " || profile.Contact.Email != "ada@example.com" || profile.Links[0].Label != "&lt;x&gt;" {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+
+	if err := SanitizeStruct(profile); err == nil {
+		t.Error("expected error for non-pointer")
+	}
+	bad := struct {
+		Name string `sanitize:"shout"`
+	}{}
+	if err := SanitizeStruct(&bad); err == nil {
+		t.Error("expected error for unknown rule")
+	}
+}
@@ -0,0 +1,208 @@
+// Package seo serves the crawler facing files of public server rendered
+// services: robots.txt, favicon.ico and a sitemap generated from a URL
+// provider.
+package seo
+
+import (
+	_ "embed"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed favicon.ico
+var defaultFavicon []byte
+
+const (
+	defaultPageSize = 50000 // the sitemap protocol limit per file
+	defaultMaxAge   = 24 * 60 * 60
+)
+
+// Module serves /robots.txt, /favicon.ico, /sitemap.xml and the gzipped
+// sitemap pages it links to.
+type Module struct {
+	robots      string
+	favicon     []byte
+	faviconType string
+	baseURL     string
+	provider    URLProvider
+	pageSize    int
+	maxAge      int
+	log         aqm.Logger
+}
+
+// Option configures the Module.
+type Option func(*Module)
+
+// New builds the module with a robots.txt allowing everything and the
+// embedded favicon.
+func New(opts ...Option) *Module {
+	m := &Module{
+		favicon:     defaultFavicon,
+		faviconType: "image/x-icon",
+		pageSize:    defaultPageSize,
+		maxAge:      defaultMaxAge,
+		log:         aqm.NewNoopLogger(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m
+}
+
+// WithRobots replaces the robots.txt body. A Sitemap line is appended when
+// a URL provider is set and the body has none.
+func WithRobots(body string) Option {
+	return func(m *Module) {
+		m.robots = body
+	}
+}
+
+// WithFavicon serves data as /favicon.ico; an empty contentType is sniffed.
+func WithFavicon(data []byte, contentType string) Option {
+	return func(m *Module) {
+		if len(data) == 0 {
+			return
+		}
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		m.favicon, m.faviconType = data, contentType
+	}
+}
+
+// WithBaseURL sets the absolute origin, e.g. https://example.com, used for
+// relative sitemap locations and the Sitemap line of robots.txt. It is
+// required for the sitemap: the request Host header is client controlled and
+// must not end up in URLs crawlers trust.
+func WithBaseURL(base string) Option {
+	return func(m *Module) {
+		m.baseURL = strings.TrimRight(base, "/")
+	}
+}
+
+// WithURLProvider enables the sitemap, together with WithBaseURL.
+func WithURLProvider(provider URLProvider) Option {
+	return func(m *Module) {
+		m.provider = provider
+	}
+}
+
+// WithPageSize sets the number of URLs per sitemap file, at most 50000.
+func WithPageSize(n int) Option {
+	return func(m *Module) {
+		if n > 0 && n <= defaultPageSize {
+			m.pageSize = n
+		}
+	}
+}
+
+// WithConfig reads the seo.* properties: base_url, robots (the body),
+// robots_file and favicon_file. Unreadable files are logged and skipped, so
+// apply WithLogger first.
+func WithConfig(cfg *aqm.Config) Option {
+	return func(m *Module) {
+		if cfg == nil {
+			return
+		}
+		if base, ok := cfg.GetString("seo.base_url"); ok {
+			WithBaseURL(base)(m)
+		}
+		if body, ok := cfg.GetString("seo.robots"); ok {
+			m.robots = body
+		}
+		if file, ok := cfg.GetString("seo.robots_file"); ok && file != "" {
+			if data, err := os.ReadFile(file); err != nil {
+				m.log.Error("seo: cannot read robots file", "file", file, "error", err)
+			} else {
+				m.robots = string(data)
+			}
+		}
+		if file, ok := cfg.GetString("seo.favicon_file"); ok && file != "" {
+			if data, err := os.ReadFile(file); err != nil {
+				m.log.Error("seo: cannot read favicon", "file", file, "error", err)
+			} else {
+				WithFavicon(data, "")(m)
+			}
+		}
+	}
+}
+
+// WithLogger wires the logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(m *Module) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (m *Module) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Get("/robots.txt", m.serveRobots)
+	r.Get("/favicon.ico", m.serveFavicon)
+	if m.provider != nil && !m.hasBaseURL() {
+		m.log.Error("seo: sitemap disabled, an absolute seo.base_url is required", "base_url", m.baseURL)
+	}
+	if m.sitemapEnabled() {
+		r.Get("/sitemap.xml", m.serveSitemap)
+		r.Get("/sitemap-{page}.xml.gz", m.servePage)
+	}
+}
+
+func (m *Module) sitemapEnabled() bool {
+	return m.provider != nil && m.hasBaseURL()
+}
+
+func (m *Module) hasBaseURL() bool {
+	u, err := url.Parse(m.baseURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (m *Module) serveRobots(w http.ResponseWriter, _ *http.Request) {
+	body := m.robots
+	if body == "" {
+		body = "User-agent: *\nAllow: /\n"
+	}
+	if m.sitemapEnabled() && !strings.Contains(strings.ToLower(body), "sitemap:") {
+		if !strings.HasSuffix(body, "\n") {
+			body += "\n"
+		}
+		body += "\nSitemap: " + m.absolute("/sitemap.xml") + "\n"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	m.cache(w)
+	_, _ = w.Write([]byte(body))
+}
+
+func (m *Module) serveFavicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", m.faviconType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.favicon)))
+	m.cache(w)
+	_, _ = w.Write(m.favicon)
+}
+
+func (m *Module) cache(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(m.maxAge))
+}
+
+// absolute joins path with the base URL.
+func (m *Module) absolute(path string) string {
+	if strings.Contains(path, "://") {
+		return path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return m.baseURL + path
+}
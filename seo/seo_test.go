@@ -0,0 +1,112 @@
+package seo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+func get(t *testing.T, m *Module, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := chi.NewRouter()
+	m.RegisterRoutes(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil))
+	return rec
+}
+
+func TestRobotsAndFavicon(t *testing.T) {
+	m := New()
+	rec := get(t, m, "/robots.txt")
+	if rec.Code != http.StatusOK || rec.Body.String() != "User-agent: *\nAllow: /\n" {
+		t.Errorf("robots: %d %q", rec.Code, rec.Body)
+	}
+	rec = get(t, m, "/favicon.ico")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/x-icon" || !bytes.Equal(rec.Body.Bytes(), defaultFavicon) {
+		t.Errorf("favicon: %d %v", rec.Code, rec.Header())
+	}
+	if rec := get(t, m, "/sitemap.xml"); rec.Code != http.StatusNotFound {
+		t.Errorf("sitemap without provider: %d", rec.Code)
+	}
+
+	dir := t.TempDir()
+	robots := filepath.Join(dir, "robots.txt")
+	_ = os.WriteFile(robots, []byte("User-agent: *\nDisallow: /admin\n"), 0o600)
+	cfg := aqm.NewConfig()
+	cfg.MergeNested(map[string]any{"seo": map[string]any{"base_url": "https://example.com/", "robots_file": robots}})
+	m = New(WithConfig(cfg), WithURLProvider(StaticURLs{{Loc: "/"}}))
+	rec = get(t, m, "/robots.txt")
+	if !strings.Contains(rec.Body.String(), "Disallow: /admin") || !strings.Contains(rec.Body.String(), "Sitemap: https://example.com/sitemap.xml") {
+		t.Errorf("configured robots: %q", rec.Body)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	mod := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := New(WithBaseURL("https://example.com"), WithURLProvider(StaticURLs{
+		{Loc: "/", Priority: 1},
+		{Loc: "/about", LastMod: mod, ChangeFreq: "monthly"},
+		{Loc: "https://cdn.example.com/docs"},
+	}))
+	rec := get(t, m, "/sitemap.xml")
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+		"<loc>https://example.com/about</loc><lastmod>2026-03-01T12:00:00Z</lastmod><changefreq>monthly</changefreq>",
+		"<priority>1.0</priority>",
+		"<loc>https://cdn.example.com/docs</loc>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("sitemap missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSitemapPages(t *testing.T) {
+	var urls StaticURLs
+	for i := range 5 {
+		urls = append(urls, URL{Loc: fmt.Sprintf("/p/%d", i)})
+	}
+	m := New(WithBaseURL("https://example.com"), WithURLProvider(urls), WithPageSize(2))
+
+	index := get(t, m, "/sitemap.xml").Body.String()
+	if !strings.Contains(index, "<sitemapindex") || !strings.Contains(index, "<loc>https://example.com/sitemap-3.xml.gz</loc>") || strings.Contains(index, "sitemap-4") {
+		t.Fatalf("index:\n%s", index)
+	}
+
+	rec := get(t, m, "/sitemap-3.xml.gz")
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(zr)
+	if !strings.Contains(string(page), "<loc>https://example.com/p/4</loc>") || strings.Contains(string(page), "/p/3") {
+		t.Errorf("page 3:\n%s", page)
+	}
+	if rec := get(t, m, "/sitemap-4.xml.gz"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing page: %d", rec.Code)
+	}
+}
+
+func TestSitemapRequiresBaseURL(t *testing.T) {
+	for _, base := range []string{"", "example.com", "/site"} {
+		m := New(WithBaseURL(base), WithURLProvider(StaticURLs{{Loc: "/"}}))
+		if rec := get(t, m, "/sitemap.xml"); rec.Code != http.StatusNotFound {
+			t.Errorf("base %q: sitemap served %d", base, rec.Code)
+		}
+		if rec := get(t, m, "/robots.txt"); strings.Contains(rec.Body.String(), "Sitemap:") {
+			t.Errorf("base %q: robots advertises a sitemap: %q", base, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package seo
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+// URL is one sitemap entry. Loc may be relative to the base URL; zero
+// LastMod, ChangeFreq and Priority are omitted.
+type URL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   float64
+}
+
+// URLProvider lists the public URLs of the service, a page at a time.
+type URLProvider interface {
+	Count(ctx context.Context) (int, error)
+	URLs(ctx context.Context, offset, limit int) ([]URL, error)
+}
+
+// StaticURLs is a URLProvider over a fixed list.
+type StaticURLs []URL
+
+// Count implements URLProvider.
+func (s StaticURLs) Count(context.Context) (int, error) { return len(s), nil }
+
+// URLs implements URLProvider.
+func (s StaticURLs) URLs(_ context.Context, offset, limit int) ([]URL, error) {
+	if offset >= len(s) {
+		return nil, nil
+	}
+	return s[offset:min(offset+limit, len(s))], nil
+}
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type xmlURLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	NS      string   `xml:"xmlns,attr"`
+	URLs    []xmlURL `xml:"url"`
+}
+
+type xmlURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type xmlIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	NS       string       `xml:"xmlns,attr"`
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+type xmlSitemap struct {
+	Loc string `xml:"loc"`
+}
+
+// serveSitemap answers with the URL set itself when it fits in one page,
+// otherwise with an index of the gzipped pages.
+func (m *Module) serveSitemap(w http.ResponseWriter, r *http.Request) {
+	total, err := m.provider.Count(r.Context())
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	if total <= m.pageSize {
+		urls, err := m.provider.URLs(r.Context(), 0, m.pageSize)
+		if err != nil {
+			m.fail(w, err)
+			return
+		}
+		m.writeXML(w, m.urlSet(urls), false)
+		return
+	}
+
+	index := xmlIndex{NS: sitemapNS}
+	for page := 1; (page-1)*m.pageSize < total; page++ {
+		index.Sitemaps = append(index.Sitemaps, xmlSitemap{Loc: m.absolute("/sitemap-" + strconv.Itoa(page) + ".xml.gz")})
+	}
+	m.writeXML(w, index, false)
+}
+
+func (m *Module) servePage(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(chi.URLParam(r, "page"))
+	if err != nil || page < 1 {
+		aqm.Error(w, http.StatusNotFound, "not_found", "no such sitemap page")
+		return
+	}
+	urls, err := m.provider.URLs(r.Context(), (page-1)*m.pageSize, m.pageSize)
+	if err != nil {
+		m.fail(w, err)
+		return
+	}
+	if len(urls) == 0 {
+		aqm.Error(w, http.StatusNotFound, "not_found", "no such sitemap page")
+		return
+	}
+	m.writeXML(w, m.urlSet(urls), true)
+}
+
+func (m *Module) urlSet(urls []URL) xmlURLSet {
+	set := xmlURLSet{NS: sitemapNS, URLs: make([]xmlURL, 0, len(urls))}
+	for _, u := range urls {
+		entry := xmlURL{Loc: m.absolute(u.Loc), ChangeFreq: u.ChangeFreq}
+		if !u.LastMod.IsZero() {
+			entry.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+		}
+		if u.Priority > 0 {
+			entry.Priority = strconv.FormatFloat(u.Priority, 'f', 1, 64)
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+	return set
+}
+
+func (m *Module) writeXML(w http.ResponseWriter, v any, gzipped bool) {
+	m.cache(w)
+	if !gzipped {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		_, _ = w.Write([]byte(xml.Header))
+		_ = xml.NewEncoder(w).Encode(v)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	zw := gzip.NewWriter(w)
+	_, _ = zw.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(zw).Encode(v)
+	_ = zw.Close()
+}
+
+func (m *Module) fail(w http.ResponseWriter, err error) {
+	m.log.Error("seo: cannot list sitemap URLs", "error", err)
+	aqm.Error(w, http.StatusServiceUnavailable, "sitemap_unavailable", "cannot build the sitemap")
+}
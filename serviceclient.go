@@ -11,12 +11,34 @@ type ServiceClient struct {
 	http    *HTTPClient
 }
 
+// ServiceClientOption configures a ServiceClient.
+type ServiceClientOption func(*ServiceClient)
+
+// WithRecorder routes the client traffic through recorder so upstream
+// interactions are recorded or replayed, keeping the client's own transport
+// for live requests. A nil recorder is ignored, so the result of
+// NewRecorderFromConfig can be passed as is.
+func WithRecorder(recorder *Recorder) ServiceClientOption {
+	return func(c *ServiceClient) {
+		if recorder == nil {
+			return
+		}
+		c.http.HTTPClient.Transport = recorder.Wrap(c.http.HTTPClient.Transport)
+	}
+}
+
 // NewServiceClient creates a new service client for the given base URL.
-func NewServiceClient(baseURL string) *ServiceClient {
-	return &ServiceClient{
+func NewServiceClient(baseURL string, opts ...ServiceClientOption) *ServiceClient {
+	c := &ServiceClient{
 		baseURL: baseURL,
 		http:    NewHTTPClient(HTTPClientConfig{BaseURL: baseURL}),
 	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c
 }
 
 func (c *ServiceClient) List(ctx context.Context, resource string) (*SuccessResponse, error) {
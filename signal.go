@@ -0,0 +1,99 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"runtime/pprof"
+	"sync"
+)
+
+// SignalHandlerFunc reacts to a delivered signal. Returned errors are logged
+// and do not stop the service.
+type SignalHandlerFunc func(ctx context.Context, sig os.Signal) error
+
+type signalRegistration struct {
+	sig os.Signal
+	fn  SignalHandlerFunc
+}
+
+// WithSignalHandler runs fn every time sig is delivered while Micro.Run is
+// serving, e.g. dumping goroutines on SIGUSR1, rotating logs on SIGUSR2 or
+// reloading config on SIGHUP. Handlers run one at a time in registration
+// order; several handlers may share a signal. Termination signals remain the
+// caller's responsibility through the context passed to Run.
+func WithSignalHandler(sig os.Signal, fn SignalHandlerFunc) Option {
+	return func(ms *Micro) error {
+		if sig == nil || fn == nil {
+			return errors.New("signal handler requires a signal and a function")
+		}
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.signalHandlers = append(ms.signalHandlers, signalRegistration{sig: sig, fn: fn})
+		return nil
+	}
+}
+
+// DumpGoroutines writes the stack of every goroutine to w, suitable for a
+// SIGUSR1 handler.
+func DumpGoroutines(w io.Writer) error {
+	return pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// watchSignals subscribes to the registered signals and dispatches them until
+// the returned stop function is called, which unsubscribes and waits for any
+// running handler to finish. Stop is idempotent.
+func (micro *Micro) watchSignals(ctx context.Context) (stop func()) {
+	micro.mu.RLock()
+	handlers := append([]signalRegistration(nil), micro.signalHandlers...)
+	micro.mu.RUnlock()
+	if len(handlers) == 0 {
+		return func() {}
+	}
+
+	sigs := make([]os.Signal, 0, len(handlers))
+	for _, h := range handlers {
+		sigs = append(sigs, h.sig)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				micro.dispatchSignal(ctx, sig, handlers)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+func (micro *Micro) dispatchSignal(ctx context.Context, sig os.Signal, handlers []signalRegistration) {
+	logger := micro.Deps().Logger
+	logger.Info("signal received", "signal", sig.String())
+	for _, h := range handlers {
+		if h.sig != sig {
+			continue
+		}
+		if err := h.fn(ctx, sig); err != nil {
+			logger.Error("signal handler failed", "signal", sig.String(), "error", err)
+		}
+	}
+}
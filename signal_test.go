@@ -0,0 +1,77 @@
+//go:build unix
+
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithSignalHandler(t *testing.T) {
+	received := make(chan os.Signal, 4)
+	ms := NewMicro(
+		WithConfig(NewConfig()),
+		WithLogger(NewNoopLogger()),
+		WithSignalHandler(syscall.SIGUSR1, func(_ context.Context, sig os.Signal) error {
+			received <- sig
+			return nil
+		}),
+		WithSignalHandler(syscall.SIGUSR1, func(context.Context, os.Signal) error {
+			return errors.New("handler errors are logged only")
+		}),
+		WithSignalHandler(syscall.SIGUSR2, func(_ context.Context, sig os.Signal) error {
+			received <- sig
+			return nil
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ms.Run(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+
+	for _, sig := range []syscall.Signal{syscall.SIGUSR1, syscall.SIGUSR2} {
+		if err := syscall.Kill(os.Getpid(), sig); err != nil {
+			t.Fatalf("kill: %v", err)
+		}
+		select {
+		case got := <-received:
+			if got != sig {
+				t.Errorf("expected %v, got %v", sig, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler for %v not invoked", sig)
+		}
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWithSignalHandlerValidation(t *testing.T) {
+	ms := &Micro{deps: DefaultDeps()}
+	if err := WithSignalHandler(nil, func(context.Context, os.Signal) error { return nil })(ms); err == nil {
+		t.Error("expected error for nil signal")
+	}
+	if err := WithSignalHandler(syscall.SIGHUP, nil)(ms); err == nil {
+		t.Error("expected error for nil handler")
+	}
+}
+
+func TestDumpGoroutines(t *testing.T) {
+	var buf bytes.Buffer
+	if err := DumpGoroutines(&buf); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if !strings.Contains(buf.String(), "goroutine") {
+		t.Error("expected goroutine stacks in dump")
+	}
+}
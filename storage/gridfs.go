@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSBlob stores blobs in a Mongo GridFS bucket, using the key as file name
+// and keeping the content type in the file metadata. Putting a key uploads a
+// new revision and removes the revisions created before it, so concurrent
+// Puts of one key leave the newest upload. Uploads and downloads stop when
+// their context is done.
+type GridFSBlob struct {
+	bucket *gridfs.Bucket
+}
+
+// NewGridFSBlob opens bucket (default "fs") in db.
+func NewGridFSBlob(db *mongo.Database, bucket string) (*GridFSBlob, error) {
+	if db == nil {
+		return nil, errors.New("mongo database is required")
+	}
+	opts := options.GridFSBucket()
+	if bucket != "" {
+		opts.SetName(bucket)
+	}
+	b, err := gridfs.NewBucket(db, opts)
+	if err != nil {
+		return nil, fmt.Errorf("gridfs bucket: %w", err)
+	}
+	return &GridFSBlob{bucket: b}, nil
+}
+
+type gridfsMetadata struct {
+	ContentType string `bson:"contentType"`
+}
+
+type gridfsFile struct {
+	ID         any            `bson:"_id"`
+	Length     int64          `bson:"length"`
+	UploadDate time.Time      `bson:"uploadDate"`
+	Name       string         `bson:"filename"`
+	Metadata   gridfsMetadata `bson:"metadata"`
+}
+
+func (f gridfsFile) object() Object {
+	return Object{Key: f.Name, ContentType: f.Metadata.ContentType, Size: f.Length, UpdatedAt: f.UploadDate}
+}
+
+// Put implements Blob.
+func (g *GridFSBlob) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	if key == "" {
+		return Object{}, errors.New("storage: key is required")
+	}
+	opts := options.GridFSUpload().SetMetadata(gridfsMetadata{ContentType: contentType})
+	stream, err := g.bucket.OpenUploadStream(key, opts)
+	if err != nil {
+		return Object{}, fmt.Errorf("gridfs upload %s: %w", key, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetWriteDeadline(deadline)
+	}
+	if _, err := io.Copy(stream, contextReader{ctx: ctx, r: r}); err != nil {
+		_ = stream.Abort()
+		return Object{}, fmt.Errorf("gridfs upload %s: %w", key, err)
+	}
+	if err := stream.Close(); err != nil {
+		return Object{}, fmt.Errorf("gridfs upload %s: %w", key, err)
+	}
+
+	// Object IDs grow with time, so a concurrent Put of the same key never
+	// removes a revision newer than its own.
+	older, err := g.files(ctx, bson.M{"filename": key, "_id": bson.M{"$lt": stream.FileID}})
+	if err != nil {
+		return Object{}, err
+	}
+	for _, file := range older {
+		if err := g.bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return Object{}, fmt.Errorf("gridfs delete revision of %s: %w", key, err)
+		}
+	}
+	return g.stat(ctx, key)
+}
+
+// Get implements Blob.
+func (g *GridFSBlob) Get(ctx context.Context, key string) ([]byte, Object, error) {
+	reader, obj, err := g.Stream(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("gridfs read %s: %w", key, err)
+	}
+	return data, obj, nil
+}
+
+// Stream implements Blob. The returned reader supports seeking, reopening the
+// download at the requested offset, so it can back HTTP range requests.
+func (g *GridFSBlob) Stream(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	files, err := g.files(ctx, bson.M{"filename": key}, options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(1))
+	if err != nil {
+		return nil, Object{}, err
+	}
+	if len(files) == 0 {
+		return nil, Object{}, ErrNotFound
+	}
+	file := files[0]
+	return &gridfsReader{ctx: ctx, bucket: g.bucket, id: file.ID, size: file.Length}, file.object(), nil
+}
+
+// Delete implements Blob, removing every revision of key.
+func (g *GridFSBlob) Delete(ctx context.Context, key string) error {
+	files, err := g.files(ctx, bson.M{"filename": key})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return ErrNotFound
+	}
+	for _, file := range files {
+		if err := g.bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return fmt.Errorf("gridfs delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (g *GridFSBlob) stat(ctx context.Context, key string) (Object, error) {
+	reader, obj, err := g.Stream(ctx, key)
+	if err != nil {
+		return Object{}, err
+	}
+	reader.Close()
+	return obj, nil
+}
+
+func (g *GridFSBlob) files(ctx context.Context, filter any, opts ...*options.GridFSFindOptions) ([]gridfsFile, error) {
+	cursor, err := g.bucket.FindContext(ctx, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gridfs find: %w", err)
+	}
+	var files []gridfsFile
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("gridfs find: %w", err)
+	}
+	return files, nil
+}
+
+// contextReader fails reads once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// gridfsReader opens the download lazily and reopens it after a seek, since
+// GridFS download streams only move forward. Reads stop when ctx is done.
+type gridfsReader struct {
+	ctx    context.Context
+	bucket *gridfs.Bucket
+	id     any
+	size   int64
+	pos    int64
+	stream *gridfs.DownloadStream
+}
+
+func (r *gridfsReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if r.stream == nil {
+		stream, err := r.bucket.OpenDownloadStream(r.id)
+		if err != nil {
+			return 0, fmt.Errorf("gridfs open: %w", err)
+		}
+		if deadline, ok := r.ctx.Deadline(); ok {
+			_ = stream.SetReadDeadline(deadline)
+		}
+		if r.pos > 0 {
+			if _, err := stream.Skip(r.pos); err != nil {
+				stream.Close()
+				return 0, fmt.Errorf("gridfs skip: %w", err)
+			}
+		}
+		r.stream = stream
+	}
+	n, err := r.stream.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *gridfsReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, errors.New("gridfs seek: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("gridfs seek: negative position")
+	}
+	if pos != r.pos && r.stream != nil {
+		r.stream.Close()
+		r.stream = nil
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+func (r *gridfsReader) Close() error {
+	if r.stream == nil {
+		return nil
+	}
+	err := r.stream.Close()
+	r.stream = nil
+	return err
+}
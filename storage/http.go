@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultPrefix = "/files"
+
+// Module serves stored blobs over HTTP. Downloads require a URL signed with
+// SignedURL, which expires, and support range requests and conditional GETs.
+type Module struct {
+	blob   Blob
+	secret []byte
+	prefix string
+	log    aqm.Logger
+	now    func() time.Time
+}
+
+// ModuleOption configures a Module.
+type ModuleOption func(*Module)
+
+// WithPrefix overrides the mount point (defaults to /files).
+func WithPrefix(prefix string) ModuleOption {
+	return func(m *Module) {
+		if prefix = strings.TrimRight(prefix, "/"); prefix != "" {
+			if !strings.HasPrefix(prefix, "/") {
+				prefix = "/" + prefix
+			}
+			m.prefix = prefix
+		}
+	}
+}
+
+// WithLogger wires a custom logger. It falls back to a noop logger when nil.
+func WithLogger(logger aqm.Logger) ModuleOption {
+	return func(m *Module) {
+		if logger != nil {
+			m.log = logger
+		}
+	}
+}
+
+// NewModule builds a module serving blob, signing URLs with secret.
+func NewModule(blob Blob, secret []byte, opts ...ModuleOption) (*Module, error) {
+	if blob == nil {
+		return nil, errors.New("storage: blob is required")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("storage: signing secret is required")
+	}
+	m := &Module{
+		blob:   blob,
+		secret: secret,
+		prefix: defaultPrefix,
+		log:    aqm.NewNoopLogger(),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+	return m, nil
+}
+
+// Name identifies the module in route listings.
+func (m *Module) Name() string {
+	return "storage"
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (m *Module) RegisterRoutes(r chi.Router) {
+	r.Get(m.prefix+"/*", m.serve)
+	r.Head(m.prefix+"/*", m.serve)
+}
+
+// SignedURL returns a relative download URL for key valid for ttl.
+func (m *Module) SignedURL(key string, ttl time.Duration) string {
+	expires := strconv.FormatInt(m.now().Add(ttl).Unix(), 10)
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	query := url.Values{"expires": {expires}, "signature": {m.sign(key, expires)}}
+	return m.prefix + "/" + strings.Join(segments, "/") + "?" + query.Encode()
+}
+
+func (m *Module) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestKey returns the blob key of r, unescaped exactly once. chi matches
+// the escaped path when the URL carries one (r.URL.RawPath) and the decoded
+// path otherwise, so the wildcard is only unescaped in the first case; a key
+// such as "100%41" must not turn into "100A".
+func requestKey(r *http.Request) (string, bool) {
+	key := chi.URLParam(r, "*")
+	if r.URL.RawPath == "" {
+		return key, key != ""
+	}
+	unescaped, err := url.PathUnescape(key)
+	if err != nil {
+		return "", false
+	}
+	return unescaped, unescaped != ""
+}
+
+func (m *Module) serve(w http.ResponseWriter, r *http.Request) {
+	key, ok := requestKey(r)
+	query := r.URL.Query()
+	expires := query.Get("expires")
+	signature := query.Get("signature")
+	if !ok || !hmac.Equal([]byte(signature), []byte(m.sign(key, expires))) {
+		aqm.RespondError(w, http.StatusForbidden, "invalid signature")
+		return
+	}
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || m.now().Unix() > deadline {
+		aqm.RespondError(w, http.StatusForbidden, "download link expired")
+		return
+	}
+
+	reader, obj, err := m.blob.Stream(r.Context(), key)
+	if errors.Is(err, ErrNotFound) {
+		aqm.RespondError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if err != nil {
+		m.log.Error("cannot open stored file", "key", key, "error", err)
+		aqm.RespondError(w, http.StatusInternalServerError, "cannot read file")
+		return
+	}
+	defer reader.Close()
+
+	// Stored files are user content: always download them rather than let
+	// the browser render, or sniff, them in the application's origin.
+	h := w.Header()
+	h.Set("Content-Disposition", aqm.ContentDisposition(false, path.Base(key)))
+	h.Set("X-Content-Type-Options", "nosniff")
+	if obj.ContentType != "" {
+		h.Set("Content-Type", obj.ContentType)
+	}
+	h.Set("Cache-Control", "private, max-age=0")
+	http.ServeContent(w, r, obj.Key, obj.UpdatedAt, reader)
+}
@@ -0,0 +1,97 @@
+// Package storage defines blob storage for uploaded files and the backends
+// that implement it.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when no blob is stored under a key.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// Object describes a stored blob.
+type Object struct {
+	Key         string
+	ContentType string
+	Size        int64
+	UpdatedAt   time.Time
+}
+
+// Blob stores opaque content by key. Putting an existing key replaces it.
+type Blob interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error)
+	Get(ctx context.Context, key string) ([]byte, Object, error)
+	Stream(ctx context.Context, key string) (io.ReadSeekCloser, Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryBlob keeps blobs in memory, for tests and local development.
+type MemoryBlob struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	Object
+	data []byte
+}
+
+// NewMemoryBlob builds an empty in-memory store.
+func NewMemoryBlob() *MemoryBlob {
+	return &MemoryBlob{objects: make(map[string]memoryObject)}
+}
+
+// Put implements Blob.
+func (m *MemoryBlob) Put(_ context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Object{}, err
+	}
+	obj := Object{Key: key, ContentType: contentType, Size: int64(len(data)), UpdatedAt: time.Now().UTC()}
+	m.mu.Lock()
+	m.objects[key] = memoryObject{Object: obj, data: data}
+	m.mu.Unlock()
+	return obj, nil
+}
+
+// Get implements Blob.
+func (m *MemoryBlob) Get(_ context.Context, key string) ([]byte, Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stored, ok := m.objects[key]
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+	return bytes.Clone(stored.data), stored.Object, nil
+}
+
+// Stream implements Blob.
+func (m *MemoryBlob) Stream(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	data, obj, err := m.Get(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return nopCloser{bytes.NewReader(data)}, obj, nil
+}
+
+// Delete implements Blob.
+func (m *MemoryBlob) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
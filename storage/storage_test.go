@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMemoryBlob(t *testing.T) {
+	ctx := context.Background()
+	blob := NewMemoryBlob()
+
+	obj, err := blob.Put(ctx, "docs/a.txt", strings.NewReader("hello"), "text/plain")
+	if err != nil || obj.Size != 5 || obj.ContentType != "text/plain" {
+		t.Fatalf("unexpected put result %+v (%v)", obj, err)
+	}
+	data, _, err := blob.Get(ctx, "docs/a.txt")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("unexpected get %q (%v)", data, err)
+	}
+	if err := blob.Delete(ctx, "docs/a.txt"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, _, err := blob.Get(ctx, "docs/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestNewGridFSBlobRequiresDatabase(t *testing.T) {
+	if _, err := NewGridFSBlob(nil, ""); err == nil {
+		t.Error("expected error for nil database")
+	}
+}
+
+func TestGridFSReadsStopWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := (contextReader{ctx: ctx, r: strings.NewReader("data")}).Read(make([]byte, 4)); !errors.Is(err, context.Canceled) {
+		t.Errorf("upload read = %v, want context.Canceled", err)
+	}
+	reader := &gridfsReader{ctx: ctx, size: 4}
+	if _, err := reader.Read(make([]byte, 4)); !errors.Is(err, context.Canceled) {
+		t.Errorf("download read = %v, want context.Canceled", err)
+	}
+}
+
+func TestModuleSignedDownloads(t *testing.T) {
+	blob := NewMemoryBlob()
+	blob.Put(context.Background(), "reports/q1 2024.csv", strings.NewReader("0123456789"), "text/csv")
+
+	module, err := NewModule(blob, []byte("secret"))
+	if err != nil {
+		t.Fatalf("new module: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	module.now = func() time.Time { return now }
+
+	router := chi.NewRouter()
+	module.RegisterRoutes(router)
+	signed := module.SignedURL("reports/q1 2024.csv", time.Minute)
+
+	tests := []struct {
+		name       string
+		url        string
+		rangeHdr   string
+		advance    time.Duration
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "full", url: signed, wantStatus: http.StatusOK, wantBody: "0123456789"},
+		{name: "range", url: signed, rangeHdr: "bytes=2-4", wantStatus: http.StatusPartialContent, wantBody: "234"},
+		{name: "tampered", url: strings.Replace(signed, "q1", "q2", 1), wantStatus: http.StatusForbidden},
+		{name: "unsigned", url: "/files/reports/q1%202024.csv", wantStatus: http.StatusForbidden},
+		{name: "expired", url: signed, advance: 2 * time.Minute, wantStatus: http.StatusForbidden},
+		{name: "missing", url: module.SignedURL("nope.csv", time.Minute), wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module.now = func() time.Time { return now.Add(tt.advance) }
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.rangeHdr != "" {
+				req.Header.Set("Range", tt.rangeHdr)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantBody != "" {
+				body, _ := io.ReadAll(rec.Body)
+				if string(body) != tt.wantBody {
+					t.Errorf("expected body %q, got %q", tt.wantBody, body)
+				}
+				if rec.Header().Get("Content-Type") != "text/csv" {
+					t.Errorf("expected stored content type, got %q", rec.Header().Get("Content-Type"))
+				}
+				if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="q1 2024.csv"` {
+					t.Errorf("expected an attachment disposition, got %q", got)
+				}
+				if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+					t.Error("expected nosniff")
+				}
+			}
+		})
+	}
+}
+
+func TestModuleKeysWithPercent(t *testing.T) {
+	blob := NewMemoryBlob()
+	blob.Put(context.Background(), "100%41.txt", strings.NewReader("percent"), "text/plain")
+	blob.Put(context.Background(), "100A.txt", strings.NewReader("letter"), "text/plain")
+
+	module, err := NewModule(blob, []byte("secret"))
+	if err != nil {
+		t.Fatalf("new module: %v", err)
+	}
+	router := chi.NewRouter()
+	module.RegisterRoutes(router)
+
+	for key, want := range map[string]string{"100%41.txt": "percent", "100A.txt": "letter", "a b/100%25.txt": ""} {
+		if want == "" {
+			blob.Put(context.Background(), key, strings.NewReader("nested"), "text/plain")
+			want = "nested"
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, module.SignedURL(key, time.Minute), nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("%s: expected %q, got %d %q", key, want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// The signature of one key must not open another that unescapes to it.
+	signed := module.SignedURL("100A.txt", time.Minute)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.Replace(signed, "100A", "100%2541", 1), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected the signature to be bound to the key, got %d", rec.Code)
+	}
+}
+
+func TestNewModuleValidation(t *testing.T) {
+	if _, err := NewModule(nil, []byte("s")); err == nil {
+		t.Error("expected error for nil blob")
+	}
+	if _, err := NewModule(NewMemoryBlob(), nil); err == nil {
+		t.Error("expected error for empty secret")
+	}
+}
@@ -0,0 +1,297 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStreamGrace = 3 * time.Second
+
+// ErrStreamsDraining is returned when a stream is opened after shutdown began.
+var ErrStreamsDraining = errors.New("server is shutting down")
+
+// Stream is a long-lived connection, such as an SSE response or a WebSocket,
+// that must be told about shutdown instead of being cut off.
+type Stream interface {
+	// Drain tells the peer the server is going away, e.g. a final SSE event or
+	// a WebSocket close frame, and makes the handler return.
+	Drain(ctx context.Context) error
+	// Close terminates the stream once the grace period is over.
+	Close() error
+}
+
+// StreamFuncs adapts plain functions to Stream, e.g. to wrap a WebSocket
+// connection from any library.
+type StreamFuncs struct {
+	OnDrain func(context.Context) error
+	OnClose func() error
+}
+
+func (s StreamFuncs) Drain(ctx context.Context) error {
+	if s.OnDrain == nil {
+		return nil
+	}
+	return s.OnDrain(ctx)
+}
+
+func (s StreamFuncs) Close() error {
+	if s.OnClose == nil {
+		return nil
+	}
+	return s.OnClose()
+}
+
+// StreamRegistry tracks open streams so shutdown can drain them.
+type StreamRegistry struct {
+	mu       sync.Mutex
+	streams  map[*streamEntry]struct{}
+	draining bool
+	idle     chan struct{}
+}
+
+type streamEntry struct {
+	stream Stream
+}
+
+// NewStreamRegistry builds an empty registry.
+func NewStreamRegistry() *StreamRegistry {
+	return &StreamRegistry{streams: make(map[*streamEntry]struct{})}
+}
+
+// Register tracks s until the returned release function is called, normally
+// deferred by the handler serving the stream. It fails with
+// ErrStreamsDraining once Shutdown has started.
+func (r *StreamRegistry) Register(s Stream) (release func(), err error) {
+	if s == nil {
+		return nil, errors.New("nil stream provided")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		return nil, ErrStreamsDraining
+	}
+	entry := &streamEntry{stream: s}
+	r.streams[entry] = struct{}{}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.streams, entry)
+			if len(r.streams) == 0 && r.idle != nil {
+				close(r.idle)
+				r.idle = nil
+			}
+		})
+	}, nil
+}
+
+// Active returns the number of open streams.
+func (r *StreamRegistry) Active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.streams)
+}
+
+// Shutdown stops accepting streams, drains the open ones and waits for their
+// handlers to return until ctx expires, then force-closes the rest.
+func (r *StreamRegistry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.draining = true
+	streams := r.snapshot()
+	var idle chan struct{}
+	if len(streams) > 0 {
+		if r.idle == nil {
+			r.idle = make(chan struct{})
+		}
+		idle = r.idle
+	}
+	r.mu.Unlock()
+	if idle == nil {
+		return nil
+	}
+
+	var aggErr error
+	var errMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Drain(ctx); err != nil {
+				errMu.Lock()
+				aggErr = errors.Join(aggErr, fmt.Errorf("drain stream: %w", err))
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-idle:
+		return aggErr
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	remaining := r.snapshot()
+	r.mu.Unlock()
+	for _, s := range remaining {
+		if err := s.Close(); err != nil {
+			aggErr = errors.Join(aggErr, fmt.Errorf("close stream: %w", err))
+		}
+	}
+	return errors.Join(aggErr, fmt.Errorf("%d streams force-closed: %w", len(remaining), ctx.Err()))
+}
+
+func (r *StreamRegistry) snapshot() []Stream {
+	streams := make([]Stream, 0, len(r.streams))
+	for entry := range r.streams {
+		streams = append(streams, entry.stream)
+	}
+	return streams
+}
+
+type streamRegistryKeyType struct{}
+
+var streamRegistryKey streamRegistryKeyType
+
+// ContextWithStreams stores registry so streams opened with the request
+// context are tracked by it.
+func ContextWithStreams(ctx context.Context, registry *StreamRegistry) context.Context {
+	if ctx == nil || registry == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, streamRegistryKey, registry)
+}
+
+// StreamsFrom returns the registry stored in ctx, or nil.
+func StreamsFrom(ctx context.Context) *StreamRegistry {
+	if ctx == nil {
+		return nil
+	}
+	registry, _ := ctx.Value(streamRegistryKey).(*StreamRegistry)
+	return registry
+}
+
+// StreamsMiddleware exposes registry to handlers through the request context.
+// WithHTTPServer installs it with the server's registry.
+func StreamsMiddleware(registry *StreamRegistry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(ContextWithStreams(r.Context(), registry)))
+		})
+	}
+}
+
+// SSEStream writes Server-Sent Events and takes part in graceful shutdown:
+// on drain it sends a final "shutdown" event with a reconnect hint and
+// cancels Context so the handler loop returns.
+type SSEStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	ctx     context.Context
+	cancel  context.CancelFunc
+	release func()
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewSSEStream prepares w for event streaming and registers the stream with
+// the registry in the request context. It responds 503 and returns
+// ErrStreamsDraining while the server is shutting down.
+func NewSSEStream(w http.ResponseWriter, r *http.Request) (*SSEStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		RespondError(w, http.StatusInternalServerError, "streaming unsupported")
+		return nil, errors.New("response writer does not support flushing")
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	s := &SSEStream{w: w, flusher: flusher, ctx: ctx, cancel: cancel, release: func() {}}
+
+	if registry := StreamsFrom(r.Context()); registry != nil {
+		release, err := registry.Register(s)
+		if err != nil {
+			cancel()
+			w.Header().Set("Retry-After", "1")
+			RespondError(w, http.StatusServiceUnavailable, err.Error())
+			return nil, err
+		}
+		s.release = release
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return s, nil
+}
+
+// Context is cancelled when the client disconnects or the stream is drained
+// or closed.
+func (s *SSEStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send writes one event. An empty event name sends a default message event.
+func (s *SSEStream) Send(event, data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamsDraining
+	}
+	return s.write(event, data, 0)
+}
+
+func (s *SSEStream) write(event, data string, retry time.Duration) error {
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	if retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", retry.Milliseconds())
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	if _, err := s.w.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Drain implements Stream by sending a final shutdown event asking the client
+// to reconnect after a second, normally to another instance.
+func (s *SSEStream) Drain(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.write("shutdown", "{}", time.Second)
+	s.cancel()
+	return err
+}
+
+// Close implements Stream and releases the registration. Handlers should
+// defer it.
+func (s *SSEStream) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cancel()
+	s.release()
+	return nil
+}
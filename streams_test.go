@@ -0,0 +1,113 @@
+package aqm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamRegistryShutdownDrains(t *testing.T) {
+	registry := NewStreamRegistry()
+	done := make(chan struct{})
+	var release func()
+	stream := StreamFuncs{OnDrain: func(context.Context) error {
+		go func() {
+			release()
+			close(done)
+		}()
+		return nil
+	}}
+	release, err := registry.Register(stream)
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if err := registry.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	<-done
+	if registry.Active() != 0 {
+		t.Errorf("expected no active streams, got %d", registry.Active())
+	}
+	if _, err := registry.Register(stream); !errors.Is(err, ErrStreamsDraining) {
+		t.Errorf("expected ErrStreamsDraining, got %v", err)
+	}
+}
+
+func TestStreamRegistryForceCloses(t *testing.T) {
+	registry := NewStreamRegistry()
+	closed := false
+	_, err := registry.Register(StreamFuncs{OnClose: func() error { closed = true; return nil }})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := registry.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	if !closed {
+		t.Error("expected lingering stream to be force-closed")
+	}
+}
+
+func TestSSEStreamDrainedOnShutdown(t *testing.T) {
+	registry := NewStreamRegistry()
+	handlerDone := make(chan struct{}, 1)
+	handler := StreamsMiddleware(registry)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream, err := NewSSEStream(w, r)
+		if err != nil {
+			return
+		}
+		defer func() { handlerDone <- struct{}{} }()
+		defer stream.Close()
+		_ = stream.Send("greeting", "hello\nworld")
+		<-stream.Context().Done()
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	if got := readEvent(); got != "event: greeting\ndata: hello\ndata: world\n" {
+		t.Errorf("unexpected event %q", got)
+	}
+
+	if err := registry.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if got := readEvent(); got != "event: shutdown\nretry: 1000\ndata: {}\n" {
+		t.Errorf("unexpected shutdown event %q", got)
+	}
+	<-handlerDone
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", rec.Code)
+	}
+}
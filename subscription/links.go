@@ -0,0 +1,90 @@
+package subscription
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	actionConfirm     = "confirm"
+	actionUnsubscribe = "unsubscribe"
+)
+
+var (
+	// ErrInvalidLink is returned for tokens that are malformed, forged or
+	// signed for another action.
+	ErrInvalidLink = errors.New("subscription: invalid link")
+	// ErrLinkExpired is returned for confirmation tokens past their TTL.
+	ErrLinkExpired = errors.New("subscription: link expired")
+)
+
+// sign returns a token for action on id. A zero expiry never expires, which
+// unsubscribe links need to keep working in old emails.
+func (s *Service) sign(action string, id uuid.UUID, expires time.Time) string {
+	var exp int64
+	if !expires.IsZero() {
+		exp = expires.Unix()
+	}
+	payload := action + ":" + id.String() + ":" + strconv.FormatInt(exp, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+func (s *Service) verify(token, action string) (uuid.UUID, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, ErrInvalidLink
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return uuid.Nil, ErrInvalidLink
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(string(raw))) {
+		return uuid.Nil, ErrInvalidLink
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != action {
+		return uuid.Nil, ErrInvalidLink
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return uuid.Nil, ErrInvalidLink
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return uuid.Nil, ErrInvalidLink
+	}
+	if exp != 0 && s.now().Unix() > exp {
+		return uuid.Nil, ErrLinkExpired
+	}
+	return id, nil
+}
+
+func (s *Service) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.keys.Signing)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// ConfirmURL returns a confirmation link for id valid for the confirm TTL.
+func (s *Service) ConfirmURL(id uuid.UUID) string {
+	return s.link("/confirm", s.sign(actionConfirm, id, s.now().Add(s.confirmTTL)))
+}
+
+// UnsubscribeURL returns a non-expiring unsubscribe link for id, to include
+// in every mailing and its List-Unsubscribe header.
+func (s *Service) UnsubscribeURL(id uuid.UUID) string {
+	return s.link("/unsubscribe", s.sign(actionUnsubscribe, id, time.Time{}))
+}
+
+func (s *Service) link(path, token string) string {
+	return s.baseURL + s.basePath + path + "?token=" + token
+}
@@ -0,0 +1,151 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps subscriptions in the _email_subscriptions collection and
+// suppressed addresses in _email_suppressions.
+type MongoStore struct {
+	subscriptions *mongo.Collection
+	suppressions  *mongo.Collection
+}
+
+var (
+	_ Store           = (*MongoStore)(nil)
+	_ SuppressionList = (*MongoStore)(nil)
+)
+
+// NewMongoStore stores subscriptions in db.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		subscriptions: db.Collection("_email_subscriptions"),
+		suppressions:  db.Collection("_email_suppressions"),
+	}
+}
+
+type subscriptionDocument struct {
+	ID             string     `bson:"_id"`
+	UserID         string     `bson:"user_id,omitempty"`
+	EmailCT        []byte     `bson:"email_ct"`
+	EmailLookup    []byte     `bson:"email_lookup"`
+	ConsentType    string     `bson:"consent_type"`
+	ConsentScope   string     `bson:"consent_scope,omitempty"`
+	ConsentAt      time.Time  `bson:"consent_at"`
+	ConsentIP      string     `bson:"consent_ip,omitempty"`
+	ConfirmedAt    *time.Time `bson:"confirmed_at,omitempty"`
+	RequestedAt    time.Time  `bson:"requested_at"`
+	UnsubscribedAt *time.Time `bson:"unsubscribed_at,omitempty"`
+}
+
+type suppressionDocument struct {
+	Lookup    []byte    `bson:"_id"`
+	Reason    string    `bson:"reason"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// EnsureIndexes creates the unique index on the email lookup hash.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.subscriptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email_lookup", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("subscription: create lookup index: %w", err)
+	}
+	return nil
+}
+
+// Save implements Store.
+func (s *MongoStore) Save(ctx context.Context, record Record) error {
+	sub := record.Subscription
+	d := subscriptionDocument{
+		ID:             record.ID.String(),
+		EmailCT:        sub.EmailCT,
+		EmailLookup:    sub.EmailLookup,
+		ConsentType:    sub.Consent.Type,
+		ConsentScope:   sub.Consent.Scope,
+		ConsentAt:      sub.Consent.Timestamp,
+		ConsentIP:      sub.Consent.SourceIP,
+		ConfirmedAt:    sub.ConfirmedAt,
+		RequestedAt:    record.RequestedAt,
+		UnsubscribedAt: record.UnsubscribedAt,
+	}
+	if sub.UserID != nil {
+		d.UserID = sub.UserID.String()
+	}
+	_, err := s.subscriptions.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("subscription: save %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// Get implements Store.
+func (s *MongoStore) Get(ctx context.Context, id uuid.UUID) (Record, error) {
+	return s.findOne(ctx, bson.M{"_id": id.String()})
+}
+
+// FindByLookup implements Store.
+func (s *MongoStore) FindByLookup(ctx context.Context, lookup []byte) (Record, error) {
+	return s.findOne(ctx, bson.M{"email_lookup": lookup})
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (Record, error) {
+	var d subscriptionDocument
+	err := s.subscriptions.FindOne(ctx, filter).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("subscription: find: %w", err)
+	}
+	rec := Record{
+		Subscription: auth.EmailSubscription{
+			EmailCT:     d.EmailCT,
+			EmailLookup: d.EmailLookup,
+			Consent: auth.ConsentRecord{
+				Type:      d.ConsentType,
+				Scope:     d.ConsentScope,
+				Timestamp: d.ConsentAt,
+				SourceIP:  d.ConsentIP,
+			},
+			ConfirmedAt: d.ConfirmedAt,
+		},
+		RequestedAt:    d.RequestedAt,
+		UnsubscribedAt: d.UnsubscribedAt,
+	}
+	rec.ID, _ = uuid.Parse(d.ID)
+	if userID, err := uuid.Parse(d.UserID); err == nil {
+		rec.Subscription.UserID = &userID
+	}
+	return rec, nil
+}
+
+// IsSuppressed implements SuppressionList.
+func (s *MongoStore) IsSuppressed(ctx context.Context, lookup []byte) (bool, error) {
+	n, err := s.suppressions.CountDocuments(ctx, bson.M{"_id": lookup}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("subscription: check suppression: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Suppress implements SuppressionList.
+func (s *MongoStore) Suppress(ctx context.Context, lookup []byte, reason string) error {
+	d := suppressionDocument{Lookup: lookup, Reason: reason, CreatedAt: time.Now().UTC()}
+	_, err := s.suppressions.ReplaceOne(ctx, bson.M{"_id": lookup}, d, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("subscription: suppress: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package subscription
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by stores when no subscription matches.
+var ErrNotFound = errors.New("subscription: not found")
+
+// Record is a stored auth.EmailSubscription. Subscription.EmailCT holds the
+// nonce, ciphertext and tag of the address (see Service.Email).
+type Record struct {
+	ID             uuid.UUID
+	Subscription   auth.EmailSubscription
+	RequestedAt    time.Time
+	UnsubscribedAt *time.Time
+}
+
+// Status of a subscription.
+const (
+	StatusPending      = "pending"
+	StatusConfirmed    = "confirmed"
+	StatusUnsubscribed = "unsubscribed"
+)
+
+// Status reports where the record is in the double opt-in flow.
+func (r Record) Status() string {
+	switch {
+	case r.UnsubscribedAt != nil:
+		return StatusUnsubscribed
+	case r.Subscription.ConfirmedAt != nil:
+		return StatusConfirmed
+	default:
+		return StatusPending
+	}
+}
+
+// Store persists subscriptions.
+type Store interface {
+	Save(ctx context.Context, record Record) error
+	Get(ctx context.Context, id uuid.UUID) (Record, error)
+	FindByLookup(ctx context.Context, lookup []byte) (Record, error)
+}
+
+// SuppressionList holds addresses, by lookup hash, that must never be
+// mailed, e.g. after hard bounces or spam complaints.
+type SuppressionList interface {
+	IsSuppressed(ctx context.Context, lookup []byte) (bool, error)
+	Suppress(ctx context.Context, lookup []byte, reason string) error
+}
+
+// MemoryStore keeps subscriptions in process memory.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[uuid.UUID]Record
+}
+
+// NewMemoryStore builds an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[uuid.UUID]Record)}
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.ID] = record
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, id uuid.UUID) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// FindByLookup implements Store.
+func (s *MemoryStore) FindByLookup(_ context.Context, lookup []byte) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.records {
+		if bytes.Equal(r.Subscription.EmailLookup, lookup) {
+			return r, nil
+		}
+	}
+	return Record{}, ErrNotFound
+}
+
+// MemorySuppressionList keeps suppressed lookups in process memory.
+type MemorySuppressionList struct {
+	mu      sync.RWMutex
+	entries map[string]string
+}
+
+// NewMemorySuppressionList builds an empty list.
+func NewMemorySuppressionList() *MemorySuppressionList {
+	return &MemorySuppressionList{entries: make(map[string]string)}
+}
+
+// IsSuppressed implements SuppressionList.
+func (l *MemorySuppressionList) IsSuppressed(_ context.Context, lookup []byte) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.entries[hex.EncodeToString(lookup)]
+	return ok, nil
+}
+
+// Suppress implements SuppressionList.
+func (l *MemorySuppressionList) Suppress(_ context.Context, lookup []byte, reason string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[hex.EncodeToString(lookup)] = reason
+	return nil
+}
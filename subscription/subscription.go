@@ -0,0 +1,459 @@
+// Package subscription implements double opt-in email subscriptions on top
+// of auth.EmailSubscription: addresses are stored encrypted with the consent
+// that was given, confirmed through a signed link sent by email and
+// unsubscribed through a signed link that never expires.
+package subscription
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmctx"
+	"github.com/aquamarinepk/aqm/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBasePath   = "/subscriptions"
+	defaultConfirmTTL = 48 * time.Hour
+	defaultName       = "email_subscription"
+
+	// ConsentType is the type of the consent recorded on subscribe.
+	ConsentType = "email_subscription"
+)
+
+// Message is an email to deliver.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	Headers map[string]string
+}
+
+// Mailer delivers email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// MailerFunc adapts a function to Mailer.
+type MailerFunc func(ctx context.Context, msg Message) error
+
+// Send implements Mailer.
+func (f MailerFunc) Send(ctx context.Context, msg Message) error { return f(ctx, msg) }
+
+// Keys holds the secrets of the flow: Encryption is the AES key addresses
+// are sealed with, Lookup keys their lookup hash and Signing keys the links.
+type Keys struct {
+	Encryption []byte
+	Lookup     []byte
+	Signing    []byte
+}
+
+// Service runs the double opt-in flow. It implements aqm.HTTPModule.
+type Service struct {
+	store        Store
+	keys         Keys
+	mailer       Mailer
+	suppressions SuppressionList
+	metrics      aqm.Metrics
+	plural       string
+	baseURL      string
+	basePath     string
+	confirmTTL   time.Duration
+	compose      func(link string) Message
+	log          aqm.Logger
+	now          func() time.Time
+}
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithMailer sets the mailer confirmation emails are sent with. Without one
+// confirmation emails are only logged.
+func WithMailer(mailer Mailer) Option {
+	return func(s *Service) {
+		s.mailer = mailer
+	}
+}
+
+// WithSuppressionList sets the addresses that are never mailed.
+func WithSuppressionList(list SuppressionList) Option {
+	return func(s *Service) {
+		if list != nil {
+			s.suppressions = list
+		}
+	}
+}
+
+// WithMetrics counts subscribe requests, confirmations, unsubscribes and
+// suppressed requests as <plural name>_<event>_total.
+func WithMetrics(metrics aqm.Metrics) Option {
+	return func(s *Service) {
+		s.metrics = metrics
+	}
+}
+
+// WithName names the subscription in metrics, pluralized, so several lists
+// can be told apart (defaults to email_subscription).
+func WithName(name string) Option {
+	return func(s *Service) {
+		if name != "" {
+			s.plural = aqm.Pluralize(name)
+		}
+	}
+}
+
+// WithBaseURL sets the scheme and host links point to, e.g.
+// https://example.com.
+func WithBaseURL(url string) Option {
+	return func(s *Service) {
+		s.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithBasePath overrides the mount point (defaults to /subscriptions).
+func WithBasePath(base string) Option {
+	return func(s *Service) {
+		if base != "" {
+			s.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithConfirmTTL sets how long confirmation links stay valid (defaults to
+// 48 hours).
+func WithConfirmTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.confirmTTL = ttl
+		}
+	}
+}
+
+// WithConfirmationMessage overrides the confirmation email; compose receives
+// the confirmation link. The recipient is filled in by the service.
+func WithConfirmationMessage(compose func(link string) Message) Option {
+	return func(s *Service) {
+		if compose != nil {
+			s.compose = compose
+		}
+	}
+}
+
+// WithLogger wires the logger audit lines are written to.
+func WithLogger(logger aqm.Logger) Option {
+	return func(s *Service) {
+		if logger != nil {
+			s.log = logger
+		}
+	}
+}
+
+// New returns a Service storing subscriptions in store. A nil store
+// defaults to memory.
+func New(store Store, keys Keys, opts ...Option) *Service {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	s := &Service{
+		store:        store,
+		keys:         keys,
+		suppressions: NewMemorySuppressionList(),
+		plural:       aqm.Pluralize(defaultName),
+		basePath:     defaultBasePath,
+		confirmTTL:   defaultConfirmTTL,
+		compose:      defaultMessage,
+		log:          aqm.NewNoopLogger(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// RegisterRoutes implements aqm.HTTPModule:
+//
+//	POST     {base}                           subscribe, 202 in every case
+//	GET|POST {base}/confirm?token=...         confirm
+//	GET|POST {base}/unsubscribe?token=...     unsubscribe (one-click POST)
+func (s *Service) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Route(s.basePath, func(r chi.Router) {
+		r.Post("/", s.handleSubscribe)
+		r.Get("/confirm", s.handleConfirm)
+		r.Post("/confirm", s.handleConfirm)
+		r.Get("/unsubscribe", s.handleUnsubscribe)
+		r.Post("/unsubscribe", s.handleUnsubscribe)
+	})
+}
+
+// Subscribe starts the double opt-in of email: it stores a pending
+// subscription with consent and sends the confirmation link. Confirmed and
+// suppressed addresses are left alone without error, so callers can answer
+// identically whatever the state of the address.
+func (s *Service) Subscribe(ctx context.Context, email string, userID *uuid.UUID, consent auth.ConsentRecord) error {
+	email = auth.NormalizeEmail(email)
+	lookup := s.lookup(email)
+
+	suppressed, err := s.suppressions.IsSuppressed(ctx, lookup)
+	if err != nil {
+		return fmt.Errorf("subscription: check suppression: %w", err)
+	}
+	if suppressed {
+		s.count(ctx, "suppressed")
+		s.log.Info("subscription suppressed", "lookup", fmt.Sprintf("%x", lookup[:8]))
+		return nil
+	}
+
+	now := s.now().UTC()
+	rec, err := s.store.FindByLookup(ctx, lookup)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		sealed, err := s.seal(email)
+		if err != nil {
+			return err
+		}
+		rec = Record{ID: uuid.New(), Subscription: auth.EmailSubscription{EmailCT: sealed, EmailLookup: lookup}}
+	case err != nil:
+		return fmt.Errorf("subscription: find: %w", err)
+	case rec.Status() == StatusConfirmed:
+		s.count(ctx, "requested")
+		return nil
+	}
+
+	if consent.Type == "" {
+		consent.Type = ConsentType
+	}
+	if consent.Timestamp.IsZero() {
+		consent.Timestamp = now
+	}
+	rec.Subscription.Consent = consent
+	rec.Subscription.ConfirmedAt = nil
+	if userID != nil {
+		rec.Subscription.UserID = userID
+	}
+	rec.RequestedAt = now
+	rec.UnsubscribedAt = nil
+	if err := s.store.Save(ctx, rec); err != nil {
+		return fmt.Errorf("subscription: save: %w", err)
+	}
+	s.count(ctx, "requested")
+
+	msg := s.compose(s.ConfirmURL(rec.ID))
+	msg.To = email
+	if s.mailer == nil {
+		s.log.Info("subscription confirmation not sent, no mailer configured", "subscription_id", rec.ID)
+		return nil
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("subscription: send confirmation: %w", err)
+	}
+	s.log.Info("subscription requested", "subscription_id", rec.ID, "source_ip", consent.SourceIP)
+	return nil
+}
+
+// Confirm completes the double opt-in for the subscription a confirmation
+// token was issued for. Confirming twice is not an error.
+func (s *Service) Confirm(ctx context.Context, token string) (Record, error) {
+	id, err := s.verify(token, actionConfirm)
+	if err != nil {
+		return Record{}, err
+	}
+	rec, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Record{}, err
+	}
+	switch rec.Status() {
+	case StatusConfirmed:
+		return rec, nil
+	case StatusUnsubscribed:
+		return Record{}, ErrInvalidLink
+	}
+	now := s.now().UTC()
+	rec.Subscription.ConfirmedAt = &now
+	if err := s.store.Save(ctx, rec); err != nil {
+		return Record{}, fmt.Errorf("subscription: save: %w", err)
+	}
+	s.count(ctx, "confirmed")
+	s.log.Info("subscription confirmed", "subscription_id", rec.ID)
+	return rec, nil
+}
+
+// Unsubscribe ends the subscription an unsubscribe token was issued for.
+// Unsubscribing twice is not an error.
+func (s *Service) Unsubscribe(ctx context.Context, token string) (Record, error) {
+	id, err := s.verify(token, actionUnsubscribe)
+	if err != nil {
+		return Record{}, err
+	}
+	rec, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Record{}, err
+	}
+	if rec.Status() == StatusUnsubscribed {
+		return rec, nil
+	}
+	now := s.now().UTC()
+	rec.UnsubscribedAt = &now
+	if err := s.store.Save(ctx, rec); err != nil {
+		return Record{}, fmt.Errorf("subscription: save: %w", err)
+	}
+	s.count(ctx, "unsubscribed")
+	s.log.Info("subscription cancelled", "subscription_id", rec.ID)
+	return rec, nil
+}
+
+// Suppress blocks email from ever being mailed and unsubscribes it.
+func (s *Service) Suppress(ctx context.Context, email, reason string) error {
+	lookup := s.lookup(email)
+	if err := s.suppressions.Suppress(ctx, lookup, reason); err != nil {
+		return fmt.Errorf("subscription: suppress: %w", err)
+	}
+	rec, err := s.store.FindByLookup(ctx, lookup)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("subscription: find: %w", err)
+	}
+	if rec.Status() != StatusUnsubscribed {
+		now := s.now().UTC()
+		rec.UnsubscribedAt = &now
+		if err := s.store.Save(ctx, rec); err != nil {
+			return fmt.Errorf("subscription: save: %w", err)
+		}
+	}
+	s.log.Info("subscription address suppressed", "subscription_id", rec.ID, "reason", reason)
+	return nil
+}
+
+// Email decrypts the address of rec.
+func (s *Service) Email(rec Record) (string, error) {
+	sealed := rec.Subscription.EmailCT
+	block, err := aes.NewCipher(s.keys.Encryption)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("subscription: sealed email too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// seal encrypts email with auth.EncryptEmail and packs nonce, ciphertext
+// and tag into one value, as EmailSubscription has a single field for it.
+func (s *Service) seal(email string) ([]byte, error) {
+	enc, err := auth.EncryptEmail(email, s.keys.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("subscription: encrypt email: %w", err)
+	}
+	sealed := make([]byte, 0, len(enc.IV)+len(enc.Ciphertext)+len(enc.Tag))
+	sealed = append(sealed, enc.IV...)
+	sealed = append(sealed, enc.Ciphertext...)
+	return append(sealed, enc.Tag...), nil
+}
+
+func (s *Service) lookup(email string) []byte {
+	return auth.ComputeLookupHash(auth.NormalizeEmail(email), s.keys.Lookup)
+}
+
+func (s *Service) count(ctx context.Context, event string) {
+	if s.metrics != nil {
+		s.metrics.Counter(ctx, s.plural+"_"+event+"_total", 1, nil)
+	}
+}
+
+func defaultMessage(link string) Message {
+	return Message{
+		Subject: "Confirm your subscription",
+		Text: "Please confirm your subscription by opening the link below.\n\n" + link +
+			"\n\nIf you did not ask to subscribe, ignore this email.",
+	}
+}
+
+// SubscribeInput is the body of subscribe requests.
+type SubscribeInput struct {
+	Email string `json:"email"`
+	Scope string `json:"scope,omitempty"`
+}
+
+func (s *Service) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var in SubscribeInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		aqm.Error(w, http.StatusBadRequest, "invalid_body", "request body is not valid JSON")
+		return
+	}
+	if errs := auth.ValidateEmail(in.Email); len(errs) > 0 {
+		details := make([]aqm.ValidationError, 0, len(errs))
+		for _, e := range errs {
+			details = append(details, aqm.ValidationError{Field: "email", Code: e.Code, Message: e.Message})
+		}
+		aqm.Error(w, http.StatusUnprocessableEntity, "validation_failed", "request is invalid", details...)
+		return
+	}
+	var userID *uuid.UUID
+	if claims := auth.ClaimsFrom(r.Context()); claims != nil {
+		if id, err := uuid.Parse(claims.Subject); err == nil {
+			userID = &id
+		}
+	}
+	consent := auth.ConsentRecord{Type: ConsentType, Scope: in.Scope, SourceIP: aqmctx.ClientIP(r)}
+	if err := s.Subscribe(r.Context(), in.Email, userID, consent); err != nil {
+		s.log.Error("cannot subscribe", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "subscribe_failed", "cannot process subscription")
+		return
+	}
+	aqm.Respond(w, http.StatusAccepted, map[string]string{"status": StatusPending}, nil)
+}
+
+func (s *Service) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.Confirm(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	aqm.RespondSuccess(w, map[string]string{"status": rec.Status()})
+}
+
+func (s *Service) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.Unsubscribe(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	aqm.RespondSuccess(w, map[string]string{"status": rec.Status()})
+}
+
+func (s *Service) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrLinkExpired):
+		aqm.Error(w, http.StatusGone, "link_expired", "link has expired, subscribe again")
+	case errors.Is(err, ErrInvalidLink), errors.Is(err, ErrNotFound):
+		aqm.Error(w, http.StatusBadRequest, "invalid_link", "link is invalid")
+	default:
+		s.log.Error("subscription request failed", "error", err)
+		aqm.Error(w, http.StatusInternalServerError, "subscription_failed", "cannot process subscription")
+	}
+}
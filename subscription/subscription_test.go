@@ -0,0 +1,173 @@
+package subscription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type outbox struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (o *outbox) Send(_ context.Context, msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+type counters map[string]float64
+
+func (c counters) Counter(_ context.Context, name string, value float64, _ map[string]string) {
+	c[name] += value
+}
+
+func (c counters) ObserveHTTPRequest(string, string, int, time.Duration) {}
+
+var testKeys = Keys{
+	Encryption: bytes.Repeat([]byte{7}, 32),
+	Lookup:     []byte("lookup-key"),
+	Signing:    []byte("signing-key"),
+}
+
+var linkPattern = regexp.MustCompile(`https://example\.com\S+`)
+
+func newService(t *testing.T, opts ...Option) (*Service, chi.Router, *outbox, counters) {
+	t.Helper()
+	mail := &outbox{}
+	metrics := counters{}
+	s := New(nil, testKeys, append([]Option{
+		WithMailer(mail), WithMetrics(metrics), WithBaseURL("https://example.com"),
+	}, opts...)...)
+	r := chi.NewRouter()
+	s.RegisterRoutes(r)
+	return s, r, mail, metrics
+}
+
+func call(r chi.Router, method, target string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, target, &buf))
+	return rec
+}
+
+func pathOf(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.RequestURI()
+}
+
+func TestDoubleOptIn(t *testing.T) {
+	s, r, mail, metrics := newService(t)
+
+	if rec := call(r, http.MethodPost, "/subscriptions", SubscribeInput{Email: " Ana@Example.com ", Scope: "newsletter"}); rec.Code != http.StatusAccepted {
+		t.Fatalf("subscribe: %d %s", rec.Code, rec.Body)
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "ana@example.com" {
+		t.Fatalf("sent = %+v", mail.sent)
+	}
+	link := linkPattern.FindString(mail.sent[0].Text)
+	if link == "" {
+		t.Fatalf("no link in %q", mail.sent[0].Text)
+	}
+
+	rec, err := s.store.(*MemoryStore).FindByLookup(context.Background(), s.lookup("ana@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(rec.Subscription.EmailCT, []byte("ana@example.com")) {
+		t.Fatal("email stored in clear")
+	}
+	if email, err := s.Email(rec); err != nil || email != "ana@example.com" {
+		t.Fatalf("Email = %q, %v", email, err)
+	}
+	if rec.Subscription.Consent.Type != ConsentType || rec.Subscription.Consent.Scope != "newsletter" {
+		t.Errorf("consent = %+v", rec.Subscription.Consent)
+	}
+
+	if res := call(r, http.MethodGet, pathOf(t, link), nil); res.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", res.Code, res.Body)
+	}
+	if res := call(r, http.MethodGet, pathOf(t, link), nil); res.Code != http.StatusOK {
+		t.Errorf("second confirm: %d", res.Code)
+	}
+
+	call(r, http.MethodPost, "/subscriptions", SubscribeInput{Email: "ana@example.com"})
+	if len(mail.sent) != 1 {
+		t.Errorf("confirmed address mailed again")
+	}
+
+	if res := call(r, http.MethodPost, pathOf(t, s.UnsubscribeURL(rec.ID)), nil); res.Code != http.StatusOK {
+		t.Fatalf("unsubscribe: %d %s", res.Code, res.Body)
+	}
+	if got, _ := s.store.Get(context.Background(), rec.ID); got.Status() != StatusUnsubscribed {
+		t.Errorf("status = %s", got.Status())
+	}
+
+	for name, want := range map[string]float64{
+		"email_subscriptions_requested_total":    2,
+		"email_subscriptions_confirmed_total":    1,
+		"email_subscriptions_unsubscribed_total": 1,
+	} {
+		if metrics[name] != want {
+			t.Errorf("%s = %v, want %v", name, metrics[name], want)
+		}
+	}
+}
+
+func TestLinksAreSignedAndExpire(t *testing.T) {
+	s, r, mail, _ := newService(t, WithConfirmTTL(time.Hour))
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	call(r, http.MethodPost, "/subscriptions", SubscribeInput{Email: "bo@example.com"})
+	link := pathOf(t, linkPattern.FindString(mail.sent[0].Text))
+
+	if res := call(r, http.MethodGet, link+"x", nil); res.Code != http.StatusBadRequest {
+		t.Errorf("tampered link: %d", res.Code)
+	}
+	rec, _ := s.store.FindByLookup(context.Background(), s.lookup("bo@example.com"))
+	if _, err := s.verify(s.sign(actionUnsubscribe, rec.ID, time.Time{}), actionConfirm); err != ErrInvalidLink {
+		t.Errorf("unsubscribe token confirmed: %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if res := call(r, http.MethodGet, link, nil); res.Code != http.StatusGone {
+		t.Errorf("expired link: %d", res.Code)
+	}
+}
+
+func TestSuppressedAddressesAreNotMailed(t *testing.T) {
+	s, r, mail, metrics := newService(t)
+	if err := s.Suppress(context.Background(), "Spam@Example.com", "complaint"); err != nil {
+		t.Fatal(err)
+	}
+	if res := call(r, http.MethodPost, "/subscriptions", SubscribeInput{Email: "spam@example.com"}); res.Code != http.StatusAccepted {
+		t.Fatalf("subscribe: %d", res.Code)
+	}
+	if len(mail.sent) != 0 {
+		t.Errorf("suppressed address mailed")
+	}
+	if metrics["email_subscriptions_suppressed_total"] != 1 {
+		t.Errorf("metrics = %v", metrics)
+	}
+	if res := call(r, http.MethodPost, "/subscriptions", SubscribeInput{Email: "not-an-email"}); res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid email: %d", res.Code)
+	}
+}
@@ -0,0 +1,291 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// RestartPolicy decides whether a supervised task runs again after it ends.
+type RestartPolicy int
+
+const (
+	// RestartNever runs the task once.
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure runs the task again, with backoff, when it returns an
+	// error or panics.
+	RestartOnFailure
+)
+
+const (
+	defaultRestartBackoff    = 100 * time.Millisecond
+	defaultMaxRestartBackoff = 30 * time.Second
+	supervisorStopTimeout    = 5 * time.Second
+)
+
+// ErrSupervisorStopped is returned by Go once the supervisor has been stopped.
+var ErrSupervisorStopped = errors.New("supervisor stopped")
+
+// PanicError wraps a value recovered from a panicking task.
+type PanicError struct {
+	Task  string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task %s panicked: %v", e.Task, e.Value)
+}
+
+// Supervisor tracks background goroutines, recovers their panics, reports
+// failures and restarts tasks according to their policy. Stop cancels every
+// task and waits for them, so nothing outlives shutdown.
+type Supervisor struct {
+	reporter ErrorReporter
+	logger   Logger
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	stopped bool
+	tasks   map[*supervisedTask]struct{}
+}
+
+// SupervisorOption configures a Supervisor.
+type SupervisorOption func(*Supervisor)
+
+// WithSupervisorReporter forwards task failures and panics to reporter.
+func WithSupervisorReporter(reporter ErrorReporter) SupervisorOption {
+	return func(s *Supervisor) {
+		if reporter != nil {
+			s.reporter = reporter
+		}
+	}
+}
+
+// WithSupervisorLogger wires a custom logger. It falls back to a noop logger
+// when nil.
+func WithSupervisorLogger(logger Logger) SupervisorOption {
+	return func(s *Supervisor) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// NewSupervisor builds an empty supervisor.
+func NewSupervisor(opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		reporter: NoopErrorReporter{},
+		logger:   NewNoopLogger(),
+		tasks:    make(map[*supervisedTask]struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// TaskOption configures a single supervised task.
+type TaskOption func(*supervisedTask)
+
+// WithRestart sets the task restart policy (RestartNever by default).
+func WithRestart(policy RestartPolicy) TaskOption {
+	return func(t *supervisedTask) {
+		t.policy = policy
+	}
+}
+
+// WithRestartBackoff sets the initial delay between restarts, doubled after
+// each consecutive failure up to max.
+func WithRestartBackoff(initial, max time.Duration) TaskOption {
+	return func(t *supervisedTask) {
+		if initial > 0 {
+			t.backoff = initial
+		}
+		if max > 0 {
+			t.maxBackoff = max
+		}
+	}
+}
+
+// WithMaxRestarts limits how many times a task is restarted; zero means
+// unlimited.
+func WithMaxRestarts(n int) TaskOption {
+	return func(t *supervisedTask) {
+		if n >= 0 {
+			t.maxRestarts = n
+		}
+	}
+}
+
+// WithTaskTimeout bounds each run of the task; the run context is cancelled
+// after d and the run counts as failed if it returns an error. Zero disables
+// the bound.
+func WithTaskTimeout(d time.Duration) TaskOption {
+	return func(t *supervisedTask) {
+		if d >= 0 {
+			t.timeout = d
+		}
+	}
+}
+
+type supervisedTask struct {
+	name        string
+	fn          func(context.Context) error
+	cancel      context.CancelFunc
+	policy      RestartPolicy
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	maxRestarts int
+	timeout     time.Duration
+}
+
+// Go runs fn in a tracked goroutine. The task context is derived from ctx and
+// cancelled by Stop. Panics are recovered and, like returned errors, logged
+// and reported.
+func (s *Supervisor) Go(ctx context.Context, name string, fn func(context.Context) error, opts ...TaskOption) error {
+	if fn == nil {
+		return errors.New("nil task function provided")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	task := &supervisedTask{
+		name:       name,
+		fn:         fn,
+		backoff:    defaultRestartBackoff,
+		maxBackoff: defaultMaxRestartBackoff,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(task)
+		}
+	}
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return ErrSupervisorStopped
+	}
+	taskCtx, cancel := context.WithCancel(ctx)
+	task.cancel = cancel
+	s.tasks[task] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go s.supervise(taskCtx, task)
+	return nil
+}
+
+// Active returns the number of tasks still running.
+func (s *Supervisor) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+// Stop rejects new tasks, cancels running ones and waits for them to return
+// or for ctx to expire. It implements Stoppable.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	for task := range s.tasks {
+		task.cancel()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("supervisor: %d tasks still running: %w", s.Active(), ctx.Err())
+	}
+}
+
+func (s *Supervisor) supervise(ctx context.Context, task *supervisedTask) {
+	defer func() {
+		task.cancel()
+		s.mu.Lock()
+		delete(s.tasks, task)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	delay := task.backoff
+	for restarts := 0; ; restarts++ {
+		err := runTask(ctx, task)
+		var panicErr *PanicError
+		if err == nil || (ctx.Err() != nil && !errors.As(err, &panicErr)) {
+			return
+		}
+		s.logger.Error("background task failed", "task", task.name, "restarts", restarts, "error", err)
+		s.reporter.Report(ctx, err, map[string]any{"task": task.name, "restarts": restarts})
+
+		if task.policy != RestartOnFailure || (task.maxRestarts > 0 && restarts >= task.maxRestarts) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, task.maxBackoff)
+	}
+}
+
+func runTask(ctx context.Context, task *supervisedTask) (err error) {
+	if task.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.timeout)
+		defer cancel()
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = &PanicError{Task: task.name, Value: rec, Stack: debug.Stack()}
+		}
+	}()
+	return task.fn(ctx)
+}
+
+type supervisorKeyType struct{}
+
+var supervisorKey supervisorKeyType
+
+var defaultSupervisor = NewSupervisor()
+
+// ContextWithSupervisor stores s so Go spawns tasks on it.
+func ContextWithSupervisor(ctx context.Context, s *Supervisor) context.Context {
+	if ctx == nil || s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, supervisorKey, s)
+}
+
+// SupervisorFrom returns the supervisor stored in ctx, or a process-wide
+// default that recovers panics without reporting them.
+func SupervisorFrom(ctx context.Context) *Supervisor {
+	if ctx != nil {
+		if s, ok := ctx.Value(supervisorKey).(*Supervisor); ok {
+			return s
+		}
+	}
+	return defaultSupervisor
+}
+
+// Go runs fn in a panic-safe goroutine tracked by the supervisor in ctx.
+// Micro.Run passes its supervisor to runners and lifecycle hooks, so tasks
+// spawned from their Start methods are reported through Deps.Errors and
+// awaited during shutdown.
+func Go(ctx context.Context, name string, fn func(context.Context) error, opts ...TaskOption) error {
+	return SupervisorFrom(ctx).Go(ctx, name, fn, opts...)
+}
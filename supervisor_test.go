@@ -0,0 +1,166 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	errs   []error
+	fields []map[string]any
+}
+
+func (r *recordingReporter) Report(_ context.Context, err error, fields map[string]any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+	r.fields = append(r.fields, fields)
+}
+
+func (r *recordingReporter) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.errs)
+}
+
+func TestSupervisorRecoversPanics(t *testing.T) {
+	reporter := &recordingReporter{}
+	s := NewSupervisor(WithSupervisorReporter(reporter))
+
+	if err := s.Go(context.Background(), "exploder", func(context.Context) error { panic("boom") }); err != nil {
+		t.Fatalf("go: %v", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	if reporter.count() != 1 {
+		t.Fatalf("expected one report, got %d", reporter.count())
+	}
+	var panicErr *PanicError
+	if !errors.As(reporter.errs[0], &panicErr) || panicErr.Task != "exploder" || panicErr.Value != "boom" {
+		t.Errorf("unexpected report %v", reporter.errs[0])
+	}
+	if reporter.fields[0]["task"] != "exploder" {
+		t.Errorf("expected task field, got %v", reporter.fields[0])
+	}
+}
+
+func TestSupervisorRestartPolicies(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []TaskOption
+		calls int32
+	}{
+		{name: "never", calls: 1},
+		{name: "onFailure", opts: []TaskOption{WithRestart(RestartOnFailure), WithRestartBackoff(time.Millisecond, 2*time.Millisecond), WithMaxRestarts(2)}, calls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			s := NewSupervisor()
+			done := make(chan struct{})
+			err := s.Go(context.Background(), "flaky", func(context.Context) error {
+				calls.Add(1)
+				return errors.New("failed")
+			}, tt.opts...)
+			if err != nil {
+				t.Fatalf("go: %v", err)
+			}
+			go func() {
+				for s.Active() > 0 {
+					time.Sleep(time.Millisecond)
+				}
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("task did not finish")
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("expected %d calls, got %d", tt.calls, calls.Load())
+			}
+		})
+	}
+}
+
+func TestSupervisorStopCancelsTasks(t *testing.T) {
+	s := NewSupervisor()
+	started := make(chan struct{})
+	_ = s.Go(context.Background(), "worker", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if s.Active() != 0 {
+		t.Errorf("expected no active tasks, got %d", s.Active())
+	}
+	if err := s.Go(context.Background(), "late", func(context.Context) error { return nil }); !errors.Is(err, ErrSupervisorStopped) {
+		t.Errorf("expected ErrSupervisorStopped, got %v", err)
+	}
+}
+
+func TestSupervisorStopTimeout(t *testing.T) {
+	s := NewSupervisor()
+	release := make(chan struct{})
+	defer close(release)
+	_ = s.Go(context.Background(), "stubborn", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+}
+
+type spawningRunner struct {
+	stopped chan struct{}
+}
+
+func (r *spawningRunner) Start(ctx context.Context) error {
+	return Go(ctx, "loop", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(r.stopped)
+		return nil
+	})
+}
+
+func (r *spawningRunner) Stop(context.Context) error { return nil }
+
+func TestMicroWaitsForSupervisedTasks(t *testing.T) {
+	runner := &spawningRunner{stopped: make(chan struct{})}
+	ms := NewMicro(WithConfig(NewConfig()), WithLogger(NewNoopLogger()), WithRunner(runner))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ms.Run(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	if ms.Supervisor().Active() != 1 {
+		t.Fatalf("expected task tracked by micro supervisor, got %d", ms.Supervisor().Active())
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-runner.stopped:
+	default:
+		t.Error("expected task to finish before Run returned")
+	}
+}
@@ -12,6 +12,7 @@ import (
 type HTTP struct {
 	tracer  aqm.Tracer
 	metrics aqm.Metrics
+	labeler *aqm.RouteLabeler
 }
 
 // Option mutates HTTP configuration.
@@ -28,6 +29,9 @@ func NewHTTP(opts ...Option) *HTTP {
 			opt(h)
 		}
 	}
+	if h.labeler == nil {
+		h.labeler = aqm.NewRouteLabeler()
+	}
 	return h
 }
 
@@ -51,6 +55,13 @@ func WithMetrics(m aqm.Metrics) Option {
 	}
 }
 
+// WithRouteLabels tunes how request paths are turned into metric labels.
+func WithRouteLabels(opts ...aqm.RouteLabelOption) Option {
+	return func(h *HTTP) {
+		h.labeler = aqm.NewRouteLabeler(opts...)
+	}
+}
+
 // Start wraps the request/response pair, starting a span and returning a finish
 // function that records duration and status.
 func (h *HTTP) Start(w http.ResponseWriter, r *http.Request, spanName string) (http.ResponseWriter, *http.Request, func()) {
@@ -62,6 +73,10 @@ func (h *HTTP) Start(w http.ResponseWriter, r *http.Request, spanName string) (h
 	if metrics == nil {
 		metrics = aqm.NoopMetrics{}
 	}
+	labeler := h.labeler
+	if labeler == nil {
+		labeler = aqm.NewRouteLabeler()
+	}
 
 	ctx, span := tracer.Start(r.Context(), spanName, nil)
 	rw := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
@@ -70,18 +85,19 @@ func (h *HTTP) Start(w http.ResponseWriter, r *http.Request, spanName string) (h
 
 	finish := func() {
 		span.End(nil)
-		metrics.ObserveHTTPRequest(reqWithCtx.URL.Path, reqWithCtx.Method, rw.Status(), time.Since(start))
+		metrics.ObserveHTTPRequest(labeler.Label(reqWithCtx), reqWithCtx.Method, rw.Status(), time.Since(start))
 	}
 
 	return rw, reqWithCtx, finish
 }
 
 // NewMetricsMiddleware measures request durations and reports them through the
-// provided Metrics implementation.
-func NewMetricsMiddleware(metrics aqm.Metrics) func(http.Handler) http.Handler {
+// provided Metrics implementation, labelled by chi route pattern.
+func NewMetricsMiddleware(metrics aqm.Metrics, opts ...aqm.RouteLabelOption) func(http.Handler) http.Handler {
 	if metrics == nil {
 		metrics = aqm.NoopMetrics{}
 	}
+	labeler := aqm.NewRouteLabeler(opts...)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -91,7 +107,7 @@ func NewMetricsMiddleware(metrics aqm.Metrics) func(http.Handler) http.Handler {
 			next.ServeHTTP(rw, r)
 
 			duration := time.Since(start)
-			metrics.ObserveHTTPRequest(r.URL.Path, r.Method, rw.Status(), duration)
+			metrics.ObserveHTTPRequest(labeler.Label(r), r.Method, rw.Status(), duration)
 		})
 	}
 }
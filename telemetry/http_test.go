@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aquamarinepk/aqm"
+	"github.com/go-chi/chi/v5"
 )
 
 func TestNewHTTP(t *testing.T) {
@@ -203,8 +204,8 @@ func TestMetricsMiddlewareRecordsDuration(t *testing.T) {
 	if !recorder.observed {
 		t.Error("metrics should have been observed")
 	}
-	if recorder.path != "/test" {
-		t.Errorf("path = %s, want /test", recorder.path)
+	if recorder.path != aqm.UnmatchedRouteLabel {
+		t.Errorf("path = %s, want %s", recorder.path, aqm.UnmatchedRouteLabel)
 	}
 	if recorder.method != "GET" {
 		t.Errorf("method = %s, want GET", recorder.method)
@@ -214,6 +215,22 @@ func TestMetricsMiddlewareRecordsDuration(t *testing.T) {
 	}
 }
 
+func TestMetricsMiddlewareUsesRoutePattern(t *testing.T) {
+	recorder := &metricsRecorder{}
+
+	router := chi.NewRouter()
+	router.Use(NewMetricsMiddleware(recorder))
+	router.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/todos/123", nil))
+
+	if recorder.path != "/todos/{id}" {
+		t.Errorf("path = %s, want /todos/{id}", recorder.path)
+	}
+}
+
 type metricsRecorder struct {
 	observed bool
 	path     string
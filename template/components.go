@@ -0,0 +1,248 @@
+package template
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	componentFuncName   = "component"
+	componentPrefix     = "component/"
+	defaultComponentDir = "components"
+)
+
+//go:embed components/*.html
+var builtinComponents embed.FS
+
+// WithComponentsDir overrides the directory, under the base path, holding
+// the service's components (defaults to components). A file there replaces
+// the built-in component of the same name.
+func WithComponentsDir(name string) Option {
+	return func(m *Manager) {
+		if name != "" {
+			m.componentsDir = strings.Trim(name, "/")
+		}
+	}
+}
+
+// WithComponent registers a component from source, replacing the built-in
+// or file component of the same name.
+func WithComponent(name, source string) Option {
+	return func(m *Manager) {
+		if name == "" {
+			return
+		}
+		if m.extraComponents == nil {
+			m.extraComponents = map[string]string{}
+		}
+		m.extraComponents[name] = source
+	}
+}
+
+// loadComponents returns the component sources by name: the built-ins
+// (pagination, table, datatable, field, form, modal, meta, breadcrumbs and
+// menu), then the service's components directory, then those registered
+// with WithComponent.
+func (m *Manager) loadComponents() (map[string]string, error) {
+	components := map[string]string{}
+	if err := readComponents(builtinComponents, "components", defaultExtension, components); err != nil {
+		return nil, err
+	}
+	dir := path.Join(m.basePath, m.componentDir())
+	if err := readComponents(m.fs, dir, m.extension, components); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading components: %w", err)
+	}
+	for name, source := range m.extraComponents {
+		components[name] = source
+	}
+	return components, nil
+}
+
+func (m *Manager) componentDir() string {
+	if m.componentsDir == "" {
+		return defaultComponentDir
+	}
+	return m.componentsDir
+}
+
+func readComponents(fsys fs.FS, dir, ext string, into map[string]string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ext) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		into[strings.TrimSuffix(entry.Name(), ext)] = string(data)
+	}
+	return nil
+}
+
+// addComponents parses the components into tmpl as component/<name>.
+func addComponents(tmpl *template.Template, components map[string]string) error {
+	for name, source := range components {
+		if _, err := tmpl.New(componentPrefix + name).Parse(source); err != nil {
+			return fmt.Errorf("parsing component %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// componentPlaceholder lets templates parse before bindComponents swaps in
+// the implementation bound to the parsed set.
+var componentPlaceholder = template.FuncMap{
+	componentFuncName: func(string, any) (template.HTML, error) {
+		return "", fmt.Errorf("components not bound")
+	},
+}
+
+// bindComponents enables {{component "pagination" .}} in tmpl.
+func bindComponents(tmpl *template.Template) {
+	tmpl.Funcs(template.FuncMap{
+		componentFuncName: func(name string, data any) (template.HTML, error) {
+			if tmpl.Lookup(componentPrefix+name) == nil {
+				return "", fmt.Errorf("component %q not found", name)
+			}
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, componentPrefix+name, data); err != nil {
+				return "", err
+			}
+			return template.HTML(buf.String()), nil
+		},
+	})
+}
+
+// Pagination is the data of the pagination component.
+type Pagination struct {
+	// Page is the current page, starting at 1.
+	Page  int
+	Pages int
+	// BaseURL is the list URL; the page is set in its Param query parameter
+	// (default "page"), other parameters are kept.
+	BaseURL string
+	Param   string
+	// PerPage switches to offset paging as read by aqm.ParseListParams: the
+	// links set offset (or Param) to (page-1)*PerPage.
+	PerPage int
+	// Window is the number of page links shown on each side of the current
+	// one (default 2).
+	Window int
+}
+
+// PageLink is one numbered link of a Pagination.
+type PageLink struct {
+	Number  int
+	URL     string
+	Current bool
+}
+
+// HasPrev reports whether there is a page before the current one.
+func (p Pagination) HasPrev() bool { return p.Page > 1 }
+
+// HasNext reports whether there is a page after the current one.
+func (p Pagination) HasNext() bool { return p.Page < p.Pages }
+
+// PrevURL is the URL of the previous page.
+func (p Pagination) PrevURL() string { return p.URL(p.Page - 1) }
+
+// NextURL is the URL of the next page.
+func (p Pagination) NextURL() string { return p.URL(p.Page + 1) }
+
+// URL returns the URL of page n.
+func (p Pagination) URL(n int) string {
+	param, value := p.Param, n
+	if p.PerPage > 0 {
+		value = (n - 1) * p.PerPage
+		if param == "" {
+			param = "offset"
+		}
+	}
+	if param == "" {
+		param = "page"
+	}
+	u, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return p.BaseURL
+	}
+	q := u.Query()
+	q.Set(param, strconv.Itoa(value))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Links returns the numbered links around the current page.
+func (p Pagination) Links() []PageLink {
+	window := p.Window
+	if window <= 0 {
+		window = 2
+	}
+	first, last := max(1, p.Page-window), min(p.Pages, p.Page+window)
+	links := make([]PageLink, 0, max(0, last-first+1))
+	for n := first; n <= last; n++ {
+		links = append(links, PageLink{Number: n, URL: p.URL(n), Current: n == p.Page})
+	}
+	return links
+}
+
+// Table is the data of the table component.
+type Table struct {
+	Headers []string
+	Rows    [][]any
+	// Empty is shown when there are no rows (default "No records").
+	Empty string
+}
+
+// Field is the data of the field component, a labelled form control. Type
+// is an input type, "textarea", "select" or "checkbox".
+type Field struct {
+	Name        string
+	Label       string
+	Type        string
+	Value       any
+	Placeholder string
+	Required    bool
+	Error       string
+	// ElementID defaults to Name.
+	ElementID string
+	// Checked is the state of a checkbox.
+	Checked bool
+	// Choices are the options of a select.
+	Choices []Choice
+	// Attrs are added to the control, e.g. validation or hx-* attributes.
+	Attrs template.HTMLAttr
+}
+
+// Choice is one option of a select Field.
+type Choice struct {
+	Value string
+	Label string
+}
+
+// ID is the element id of the control.
+func (f Field) ID() string {
+	if f.ElementID != "" {
+		return f.ElementID
+	}
+	return f.Name
+}
+
+// Modal is the data of the modal component, rendered as a <dialog>.
+type Modal struct {
+	ID     string
+	Title  string
+	Body   template.HTML
+	Footer template.HTML
+}
@@ -0,0 +1,66 @@
+package template
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestComponents(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/shared/base.html":      {Data: []byte(`{{define "base"}}{{block "content" .}}{{end}}{{end}}`)},
+		"assets/templates/components/modal.html": {Data: []byte(`<div class="custom-modal">{{.Title}}</div>`)},
+		"assets/templates/user/users.html": {Data: []byte(
+			`{{component "pagination" .Pager}}|{{component "table" .Table}}|{{component "field" .Field}}|{{component "modal" .Modal}}|{{component "badge" "new"}}`)},
+	}
+	mgr := NewManager(assets, WithComponent("badge", `<span class="badge">{{.}}</span>`))
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Get("components.html"); err == nil {
+		t.Error("components directory should not be a handler")
+	}
+
+	var out strings.Builder
+	err := mgr.Render(&out, "users.html", map[string]any{
+		"Pager": Pagination{Page: 2, Pages: 5, BaseURL: "/users?sort=name"},
+		"Table": Table{Headers: []string{"Name"}, Rows: [][]any{{"<ada>"}}},
+		"Field": Field{Name: "email", Label: "Email", Type: "email", Required: true, Error: "is invalid"},
+		"Modal": Modal{ID: "confirm", Title: "Delete?"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := out.String()
+	for _, want := range []string{
+		`<a class="pagination-prev" href="/users?page=1&amp;sort=name" rel="prev">`,
+		`<span aria-current="page">2</span>`,
+		`<a href="/users?page=4&amp;sort=name">4</a>`,
+		`<td>&lt;ada&gt;</td>`,
+		`<input id="email" name="email" type="email" value="" required aria-invalid="true" aria-describedby="email-error">`,
+		`<p class="field-error" id="email-error">is invalid</p>`,
+		`<div class="custom-modal">Delete?</div>`,
+		`<span class="badge">new</span>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "<dialog") {
+		t.Error("service component should replace the built-in modal")
+	}
+}
+
+func TestUnknownComponent(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/user/users.html": {Data: []byte(`{{component "nope" .}}`)},
+	}
+	mgr := NewManager(assets)
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Render(&strings.Builder{}, "users.html", nil); err == nil || !strings.Contains(err.Error(), `component "nope" not found`) {
+		t.Errorf("expected unknown component error, got %v", err)
+	}
+}
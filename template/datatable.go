@@ -0,0 +1,282 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+const datatableComponent = "datatable"
+
+// DataTable describes a server-side list: its columns, which of them sort,
+// and the filters it accepts. Requests are read with aqm.ParseListParams, so
+// a descriptor and a Mongo repository query share the same parameters.
+type DataTable struct {
+	// ID is the element id of the table container, the HTMX target of its
+	// sort, filter and page links.
+	ID      string
+	Columns []Column
+	Filters []Filter
+	// DefaultSort applies when the request sorts by nothing, e.g. "-created_at".
+	DefaultSort []string
+}
+
+// Column is one column of a DataTable. Field is the sort key and, without a
+// Value func, the struct field (by json name or Go name) or map key shown.
+type Column struct {
+	Field    string
+	Label    string
+	Sortable bool
+	Value    func(item any) any
+}
+
+// Filter is an equality filter of a DataTable, a select when it has choices
+// and a text input otherwise.
+type Filter struct {
+	Field   string
+	Label   string
+	Choices []Choice
+}
+
+// ListFunc runs the repository query of a DataTable, e.g. with
+// aqm.NewQuery(...).Apply(params), returning a page of items and the total.
+type ListFunc[T any] func(ctx context.Context, params aqm.ListParams) (items []T, total int, err error)
+
+// ListView is the data of the datatable component and of the pages
+// rendered by ListHandler.
+type ListView struct {
+	ID      string
+	Columns []ColumnView
+	Filters []FilterView
+	Rows    [][]any
+	Items   any
+	Total   int
+	Params  aqm.ListParams
+	// Sort and Limit are kept as hidden fields of the filter form.
+	Sort       string
+	Limit      int
+	Pagination Pagination
+	// Attrs make the links and filter form of the table swap the table
+	// through HTMX.
+	Attrs template.HTMLAttr
+}
+
+// ColumnView is a Column resolved against the current request.
+type ColumnView struct {
+	Label    string
+	Sortable bool
+	// SortURL toggles the column sort.
+	SortURL string
+	// Sorted is asc, desc or empty.
+	Sorted string
+}
+
+// FilterView is a Filter with its current value.
+type FilterView struct {
+	Field   string
+	Label   string
+	Value   string
+	Choices []Choice
+}
+
+// Params parses the list parameters of r, dropping sorts on columns that
+// are not sortable and filters the table does not declare.
+func (t DataTable) Params(r *http.Request) (aqm.ListParams, error) {
+	params, err := aqm.ParseListParams(r)
+	if err != nil {
+		return params, err
+	}
+	var sorts []string
+	for _, s := range params.Sort {
+		if col, ok := t.column(strings.TrimLeft(s, "+-")); ok && col.Sortable {
+			sorts = append(sorts, s)
+		}
+	}
+	if len(sorts) == 0 {
+		sorts = t.DefaultSort
+	}
+	params.Sort = sorts
+	for field, value := range params.Filters {
+		if !t.hasFilter(field) || value == "" {
+			delete(params.Filters, field)
+		}
+	}
+	return params, nil
+}
+
+func (t DataTable) column(field string) (Column, bool) {
+	for _, col := range t.Columns {
+		if col.Field == field {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+func (t DataTable) hasFilter(field string) bool {
+	return slices.ContainsFunc(t.Filters, func(f Filter) bool { return f.Field == field })
+}
+
+// View builds the ListView of a page of items for the request r.
+func (t DataTable) View(r *http.Request, params aqm.ListParams, items any, total int) ListView {
+	view := ListView{
+		ID:     t.ID,
+		Items:  items,
+		Total:  total,
+		Params: params,
+		Sort:   strings.Join(params.Sort, ","),
+		Limit:  params.Limit,
+	}
+	view.Attrs = aqm.H().Boost().Target("#" + t.ID).Swap(aqm.SwapOuterHTML).PushURL(true).Attrs()
+
+	// Links carry the effective parameters, not the raw query, so ignored
+	// sorts and filters do not stick.
+	base := *r.URL
+	query := url.Values{}
+	if r.URL.Query().Has("limit") {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if view.Sort != "" {
+		query.Set("sort", view.Sort)
+	}
+	for field, value := range params.Filters {
+		query.Set(field, value)
+	}
+	for _, col := range t.Columns {
+		cv := ColumnView{Label: col.Label, Sortable: col.Sortable}
+		if cv.Label == "" {
+			cv.Label = humanize(col.Field)
+		}
+		if col.Sortable {
+			next := col.Field
+			switch {
+			case slices.Contains(params.Sort, col.Field) || slices.Contains(params.Sort, "+"+col.Field):
+				cv.Sorted, next = "asc", "-"+col.Field
+			case slices.Contains(params.Sort, "-"+col.Field):
+				cv.Sorted = "desc"
+			}
+			cv.SortURL = withQuery(base, query, "sort", next)
+		}
+		view.Columns = append(view.Columns, cv)
+	}
+	for _, f := range t.Filters {
+		label := f.Label
+		if label == "" {
+			label = humanize(f.Field)
+		}
+		view.Filters = append(view.Filters, FilterView{Field: f.Field, Label: label, Value: params.Filters[f.Field], Choices: f.Choices})
+	}
+
+	rv := reflect.ValueOf(items)
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			item := rv.Index(i).Interface()
+			row := make([]any, len(t.Columns))
+			for j, col := range t.Columns {
+				if col.Value != nil {
+					row[j] = col.Value(item)
+				} else {
+					row[j] = fieldValue(item, col.Field)
+				}
+			}
+			view.Rows = append(view.Rows, row)
+		}
+	}
+
+	limit := max(params.Limit, 1)
+	view.Pagination = Pagination{
+		Page:    params.Offset/limit + 1,
+		Pages:   (total + limit - 1) / limit,
+		BaseURL: withQuery(base, query, "", ""),
+		PerPage: limit,
+	}
+	return view
+}
+
+func withQuery(u url.URL, query url.Values, key, value string) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	if key != "" {
+		q.Set(key, value)
+	}
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// fieldValue reads field from a struct, by json name or Go name, or from a
+// string keyed map.
+func fieldValue(item any, field string) any {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		value := v.MapIndex(reflect.ValueOf(field).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return nil
+		}
+		return value.Interface()
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if name == field || sf.Name == field {
+				return v.Field(i).Interface()
+			}
+		}
+	}
+	return nil
+}
+
+// ListHandler serves a DataTable: it parses the list parameters, runs list
+// and renders page with the ListView, or only the datatable component when
+// the request comes from the table itself through HTMX. Invalid parameters
+// answer 400 and list errors 500.
+func ListHandler[T any](m *Manager, page string, table DataTable, list ListFunc[T], opts ...RenderOption) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := table.Params(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, total, err := list(r.Context(), params)
+		if err != nil {
+			m.log.Error("list query failed", "table", table.ID, "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		view := table.View(r, params, items, total)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Add("Vary", "HX-Request")
+		if aqm.IsHTMX(r) && aqm.GetHTMXTarget(r) == table.ID {
+			err = m.RenderComponent(w, datatableComponent, view)
+		} else {
+			err = m.Render(w, page, view, opts...)
+		}
+		if err != nil {
+			m.WriteError(w, fmt.Errorf("render %s: %w", page, err))
+		}
+	}
+}
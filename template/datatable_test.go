@@ -0,0 +1,126 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+type listedUser struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Email  string
+}
+
+func TestListHandler(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/user/users.html": {Data: []byte(`<main>{{component "datatable" .}}</main>`)},
+	}
+	mgr := NewManager(assets)
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	table := DataTable{
+		ID: "users",
+		Columns: []Column{
+			{Field: "name", Sortable: true},
+			{Field: "status", Label: "State"},
+			{Field: "Email", Value: func(item any) any { return strings.ToUpper(item.(listedUser).Email) }},
+		},
+		Filters:     []Filter{{Field: "status", Choices: []Choice{{Value: "active", Label: "Active"}}}},
+		DefaultSort: []string{"-name"},
+	}
+	var got aqm.ListParams
+	handler := ListHandler(mgr, "users.html", table, func(_ context.Context, params aqm.ListParams) ([]listedUser, int, error) {
+		got = params
+		return []listedUser{{Name: "ada", Status: "active", Email: "ada@example.com"}}, 45, nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users?status=active&sort=status&role=x&limit=10&offset=10", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(got.Sort) != 1 || got.Sort[0] != "-name" {
+		t.Errorf("sort = %v, want default sort for a non-sortable column", got.Sort)
+	}
+	if len(got.Filters) != 1 || got.Filters["status"] != "active" {
+		t.Errorf("filters = %v, want only status", got.Filters)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<main><div id="users" class="datatable" hx-target="#users" hx-swap="outerHTML" hx-push-url="true" hx-boost="true">`,
+		`<th scope="col" aria-sort="descending"><a href="/users?limit=10&amp;sort=name&amp;status=active">Name</a></th>`,
+		`<th scope="col">State</th>`,
+		`<option value="active" selected>Active</option>`,
+		`<input type="hidden" name="sort" value="-name">`,
+		`<td>ada</td><td>active</td><td>ADA@EXAMPLE.COM</td>`,
+		`<span aria-current="page">2</span>`,
+		`<a href="/users?limit=10&amp;offset=20&amp;sort=-name&amp;status=active">3</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/users?sort=name", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "users")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	body = rec.Body.String()
+	if strings.Contains(body, "<main>") || !strings.HasPrefix(body, `<div id="users"`) {
+		t.Errorf("HTMX request should render only the table:\n%s", body)
+	}
+	if !strings.Contains(body, `aria-sort="ascending"><a href="/users?sort=-name">`) {
+		t.Errorf("ascending column should toggle to descending:\n%s", body)
+	}
+}
+
+func TestListHandlerErrors(t *testing.T) {
+	mgr := NewManager(fstest.MapFS{
+		"assets/templates/user/users.html": {Data: []byte(`{{component "datatable" .}}`)},
+	})
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	table := DataTable{ID: "users", Columns: []Column{{Field: "name"}}}
+	handler := ListHandler(mgr, "users.html", table, func(context.Context, aqm.ListParams) ([]map[string]any, int, error) {
+		return nil, 0, errors.New("db down")
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/users?limit=abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid params status = %d, want 400", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "db down") {
+		t.Errorf("list error = %d %q, want a generic 500", rec.Code, rec.Body)
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	user := &listedUser{Name: "ada", Email: "a@x"}
+	if v := fieldValue(user, "name"); v != "ada" {
+		t.Errorf("json name = %v", v)
+	}
+	if v := fieldValue(user, "Email"); v != "a@x" {
+		t.Errorf("Go name = %v", v)
+	}
+	if v := fieldValue(map[string]any{"n": 1}, "n"); v != 1 {
+		t.Errorf("map key = %v", v)
+	}
+	if v := fieldValue(user, "missing"); v != nil {
+		t.Errorf("missing = %v", v)
+	}
+}
@@ -0,0 +1,220 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// snippetContext is the number of lines shown around the offending one.
+const snippetContext = 2
+
+// errorLocation matches the position prefix of text/template and
+// html/template errors, e.g. `template: nav.html:2:12: executing "nav" at
+// <.User.Name>: ...` or `html/template:show.html:1:11: ...`.
+var errorLocation = regexp.MustCompile(`^(?:html/)?template: ?([^:]+):(\d+)(?::(\d+))?: (.*)$`)
+
+var executingName = regexp.MustCompile(`^executing "([^"]+)"`)
+
+// Error is a template parse or execution error located in its source file.
+type Error struct {
+	// Template is the template that was parsed or executed, e.g. show-user.html.
+	Template string
+	// File is the path of the offending file within the template filesystem.
+	File   string
+	Line   int
+	Column int
+	// Message is the underlying error without its position prefix.
+	Message string
+	// Snippet holds the lines around Line, the offending one marked with ">".
+	Snippet string
+	// Chain is the include chain from Template to the failing definition,
+	// e.g. show-user.html → base.html → content → nav.
+	Chain []string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("template ")
+	b.WriteString(e.Template)
+	if e.File != "" {
+		fmt.Fprintf(&b, " (%s:%d", e.File, e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+		b.WriteString(")")
+	}
+	if len(e.Chain) > 1 {
+		b.WriteString(" via ")
+		b.WriteString(strings.Join(e.Chain, " → "))
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// locateError turns err, raised while parsing or executing the template
+// name, into an *Error. tmpl may be nil for parse errors. Errors without a
+// position are returned unchanged.
+func (m *Manager) locateError(err error, name string, tmpl *template.Template, paths []string) error {
+	if err == nil {
+		return nil
+	}
+	var located *Error
+	if errors.As(err, &located) {
+		return err
+	}
+	match := errorLocation.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(match[2])
+	column, _ := strconv.Atoi(match[3])
+	e := &Error{Template: name, Line: line, Column: column, Message: match[4], Err: err}
+
+	file := fileFor(match[1], paths)
+	if file != "" {
+		e.File = file
+		if data, readErr := fs.ReadFile(m.fs, file); readErr == nil {
+			e.Snippet = snippet(data, line)
+		}
+	}
+	if tmpl != nil {
+		target := match[1]
+		if exec := executingName.FindStringSubmatch(match[4]); exec != nil {
+			target = exec[1]
+		}
+		e.Chain = includeChain(tmpl, tmpl.Name(), target)
+	}
+	return e
+}
+
+// fileFor maps a template name to the file defining it. ParseFS names
+// templates after the base name of their file.
+func fileFor(name string, paths []string) string {
+	for _, p := range paths {
+		if path.Base(p) == name {
+			return p
+		}
+	}
+	return ""
+}
+
+func snippet(data []byte, line int) string {
+	lines := strings.Split(string(data), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	var b strings.Builder
+	first, last := max(1, line-snippetContext), min(len(lines), line+snippetContext)
+	width := len(strconv.Itoa(last))
+	for n := first; n <= last; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, n, lines[n-1])
+	}
+	return b.String()
+}
+
+// includeChain returns the template names leading from root to target
+// through {{template}} actions, or nil when target is not reachable.
+func includeChain(tmpl *template.Template, root, target string) []string {
+	seen := map[string]bool{}
+	var walk func(name string) []string
+	walk = func(name string) []string {
+		if name == target {
+			return []string{name}
+		}
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		t := tmpl.Lookup(name)
+		if t == nil || t.Tree == nil || t.Tree.Root == nil {
+			return nil
+		}
+		for _, called := range calledTemplates(t.Tree.Root) {
+			if rest := walk(called); rest != nil {
+				return append([]string{name}, rest...)
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+func calledTemplates(node parse.Node) []string {
+	var names []string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			names = append(names, calledTemplates(child)...)
+		}
+	case *parse.TemplateNode:
+		names = append(names, n.Name)
+	case *parse.IfNode:
+		names = append(names, branchTemplates(&n.BranchNode)...)
+	case *parse.RangeNode:
+		names = append(names, branchTemplates(&n.BranchNode)...)
+	case *parse.WithNode:
+		names = append(names, branchTemplates(&n.BranchNode)...)
+	}
+	return names
+}
+
+func branchTemplates(n *parse.BranchNode) []string {
+	names := calledTemplates(n.List)
+	if n.ElseList != nil {
+		names = append(names, calledTemplates(n.ElseList)...)
+	}
+	return names
+}
+
+// devErrorPage renders an *Error for developers.
+var devErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Template error</title>
+<style>body{font-family:sans-serif;margin:2rem}pre{background:#f6f6f6;padding:1rem;overflow:auto}</style>
+</head><body>
+<h1>Template error in {{.Template}}</h1>
+{{if .File}}<p><code>{{.File}}:{{.Line}}{{if .Column}}:{{.Column}}{{end}}</code></p>{{end}}
+<p>{{.Message}}</p>
+{{if gt (len .Chain) 1}}<p>Include chain: {{range $i, $n := .Chain}}{{if $i}} → {{end}}<code>{{$n}}</code>{{end}}</p>{{end}}
+{{if .Snippet}}<pre>{{.Snippet}}</pre>{{end}}
+</body></html>
+`))
+
+// WriteError answers a failed render. In dev mode template errors are shown
+// with their location, snippet and include chain; otherwise, and for other
+// errors, a generic 500 is written and the details are only logged.
+func (m *Manager) WriteError(w http.ResponseWriter, err error) {
+	m.log.Error("template render failed", "error", err)
+	var located *Error
+	if m.devMode && errors.As(err, &located) {
+		var buf bytes.Buffer
+		if devErrorPage.Execute(&buf, located) == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = buf.WriteTo(w)
+			return
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,85 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func errorAssets() fstest.MapFS {
+	return fstest.MapFS{
+		"assets/templates/shared/base.html": {Data: []byte("<html>\n{{template \"content\" .}}\n</html>")},
+		"assets/templates/shared/nav.html":  {Data: []byte("{{define \"nav\"}}\n<nav>{{.User.Name}}</nav>\n{{end}}")},
+		"assets/templates/user/show-user.html": {Data: []byte(
+			"{{template \"base.html\" .}}\n{{define \"content\"}}\n<p>hi</p>\n{{if .User}}{{template \"nav\" .}}{{end}}\n{{end}}")},
+	}
+}
+
+func TestRenderLocatesExecError(t *testing.T) {
+	mgr := NewManager(errorAssets())
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := mgr.Render(&out, "show-user.html", map[string]any{"User": map[string]any{"Name": "ada"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<nav>ada</nav>") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	err := mgr.Render(&out, "show-user.html", map[string]any{"User": 3})
+	var located *Error
+	if !errors.As(err, &located) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("partial output written: %q", out.String())
+	}
+	if located.File != "assets/templates/shared/nav.html" || located.Line != 2 || located.Column == 0 {
+		t.Errorf("unexpected location %+v", located)
+	}
+	if got := strings.Join(located.Chain, " → "); got != "show-user.html → base.html → content → nav" {
+		t.Errorf("unexpected chain %q", got)
+	}
+	if !strings.Contains(located.Snippet, "> 2 | <nav>{{.User.Name}}</nav>") {
+		t.Errorf("unexpected snippet:\n%s", located.Snippet)
+	}
+}
+
+func TestParseErrorLocated(t *testing.T) {
+	assets := errorAssets()
+	assets["assets/templates/user/edit-user.html"] = &fstest.MapFile{Data: []byte("<form>\n{{if .X}\n</form>")}
+	err := NewManager(assets).Start(context.Background())
+	var located *Error
+	if !errors.As(err, &located) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if located.File != "assets/templates/user/edit-user.html" || located.Line != 2 || !strings.Contains(located.Snippet, "> 2 | {{if .X}") {
+		t.Errorf("unexpected location %+v", located)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	err := &Error{Template: "show-user.html", File: "nav.html", Line: 2, Message: "can't <evaluate>", Chain: []string{"show-user.html", "nav"}, Snippet: "> 2 | x\n"}
+
+	rec := httptest.NewRecorder()
+	NewManager(errorAssets()).WriteError(rec, err)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "nav.html") {
+		t.Errorf("production leaked details: %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	NewManager(errorAssets(), WithDevMode(true)).WriteError(rec, err)
+	body := rec.Body.String()
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(body, "<code>nav.html:2</code>") ||
+		!strings.Contains(body, "can&#39;t &lt;evaluate&gt;") || !strings.Contains(body, "Include chain") {
+		t.Errorf("unexpected dev page %q", body)
+	}
+}
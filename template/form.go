@@ -0,0 +1,371 @@
+package template
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Form is the data of the form component, built from a struct by NewForm.
+type Form struct {
+	Action string
+	Method string
+	Submit string
+	Fields []Field
+	// Attrs are added to the form element.
+	Attrs template.HTMLAttr
+}
+
+// FormOption configures NewForm.
+type FormOption func(*formConfig)
+
+type formConfig struct {
+	action, method, submit string
+	errs                   aqm.ValidationErrors
+	validateURL            string
+}
+
+// WithAction sets the form action URL.
+func WithAction(url string) FormOption {
+	return func(c *formConfig) { c.action = url }
+}
+
+// WithMethod sets the form method (default post).
+func WithMethod(method string) FormOption {
+	return func(c *formConfig) { c.method = strings.ToLower(method) }
+}
+
+// WithSubmit sets the label of the submit button (default Save).
+func WithSubmit(label string) FormOption {
+	return func(c *formConfig) { c.submit = label }
+}
+
+// WithErrors shows the first error of each field, as returned by
+// aqm.ValidateStruct.
+func WithErrors(errs aqm.ValidationErrors) FormOption {
+	return func(c *formConfig) { c.errs = errs }
+}
+
+// WithInlineValidation posts the whole form to url with HTMX whenever a
+// field changes, swapping the field with the response. The handler renders
+// {{component "field" (.Form.Field name)}} for the field named by
+// aqm.GetHTMXTriggerName.
+func WithInlineValidation(url string) FormOption {
+	return func(c *formConfig) { c.validateURL = url }
+}
+
+// NewForm builds the form of the struct v, one field per exported field:
+//
+//	type UserForm struct {
+//		Name  string `json:"name" label:"Full name" validate:"required,max=80"`
+//		Email string `json:"email" input:"email" placeholder:"you@example.com" validate:"required,email"`
+//		Role  string `json:"role" validate:"oneof=admin member"`
+//		Bio   string `json:"bio" input:"textarea"`
+//	}
+//
+// Field names come from the json tag, labels from the label tag or the Go
+// name, and the control type from the input tag or the Go type. validate
+// rules add required, min/max, minlength/maxlength and select choices (oneof).
+// Fields tagged form:"-" are skipped.
+func NewForm(v any, opts ...FormOption) Form {
+	var cfg formConfig
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	form := Form{Action: cfg.action, Method: cfg.method, Submit: cfg.submit}
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			value = reflect.Zero(value.Type().Elem())
+			break
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct {
+		form.Fields = formFields(value, cfg)
+	}
+	return form
+}
+
+// Field returns the field named name, or the zero Field.
+func (f Form) Field(name string) Field {
+	for _, field := range f.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return Field{}
+}
+
+func formFields(v reflect.Value, cfg formConfig) []Field {
+	var fields []Field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("form") == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, formFields(fv, cfg)...)
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		field, ok := buildField(sf, fv, name)
+		if !ok {
+			continue
+		}
+		for _, e := range cfg.errs {
+			if e.Field == name {
+				field.Error = e.Message
+				break
+			}
+		}
+		if cfg.validateURL != "" {
+			field.Attrs = joinAttrs(field.Attrs, aqm.H().Post(cfg.validateURL).Trigger("change").
+				Target("#"+field.ID()+"-field").Swap(aqm.SwapOuterHTML).Include("closest form").Attrs())
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func buildField(sf reflect.StructField, v reflect.Value, name string) (Field, bool) {
+	field := Field{
+		Name:        name,
+		Label:       sf.Tag.Get("label"),
+		Type:        sf.Tag.Get("input"),
+		Placeholder: sf.Tag.Get("placeholder"),
+	}
+	if field.Label == "" {
+		field.Label = humanize(sf.Name)
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+			break
+		}
+		v = v.Elem()
+	}
+
+	numeric := false
+	switch {
+	case v.Type() == timeType:
+		if field.Type == "" {
+			field.Type = "datetime-local"
+		}
+		if t := v.Interface().(time.Time); !t.IsZero() {
+			layout := "2006-01-02T15:04"
+			if field.Type == "date" {
+				layout = "2006-01-02"
+			}
+			field.Value = t.Format(layout)
+		} else {
+			field.Value = ""
+		}
+	case v.Kind() == reflect.Bool:
+		field.Type = "checkbox"
+		field.Checked = v.Bool()
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Float64:
+		numeric = true
+		if field.Type == "" {
+			field.Type = "number"
+		}
+		field.Value = v.Interface()
+	case v.Kind() == reflect.String:
+		field.Value = v.String()
+	default:
+		return Field{}, false
+	}
+
+	var attrs []string
+	for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+		rule, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch rule {
+		case "required":
+			field.Required = true
+		case "email", "url":
+			if field.Type == "" {
+				field.Type = rule
+			}
+		case "min", "max":
+			attr := rule
+			if !numeric {
+				attr += "length"
+			}
+			attrs = append(attrs, attr+`="`+template.HTMLEscapeString(param)+`"`)
+		case "oneof":
+			if field.Type == "" {
+				field.Type = "select"
+			}
+			for _, choice := range strings.Fields(param) {
+				field.Choices = append(field.Choices, Choice{Value: choice, Label: humanize(choice)})
+			}
+		}
+	}
+	field.Attrs = template.HTMLAttr(strings.Join(attrs, " "))
+	if field.Type == "" {
+		field.Type = "text"
+	}
+	return field, true
+}
+
+// DecodeForm fills the struct dst points to from the submitted form values,
+// using the field names of NewForm, so a handler can decode, validate with
+// aqm.ValidateStruct and render the form back with its errors. Unchecked
+// checkboxes set false.
+func DecodeForm(r *http.Request, dst any) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode form: %T is not a pointer to a struct", dst)
+	}
+	return decodeFields(r, v.Elem())
+}
+
+func decodeFields(r *http.Request, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("form") == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := decodeFields(r, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		raw, present := r.Form[name]
+		if fv.Kind() == reflect.Bool {
+			fv.SetBool(present && raw[0] != "" && raw[0] != "false")
+			continue
+		}
+		if !present {
+			continue
+		}
+		if err := setFormValue(fv, raw[0], sf.Tag.Get("input")); err != nil {
+			return fmt.Errorf("decode form field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFormValue(v reflect.Value, raw, input string) error {
+	if v.Kind() == reflect.Pointer {
+		if raw == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Type() == timeType:
+		if raw == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+		layout := "2006-01-02T15:04"
+		if input == "date" {
+			layout = "2006-01-02"
+		}
+		t, err := time.Parse(layout, raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		if raw == "" {
+			v.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		if raw == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+func joinAttrs(a, b template.HTMLAttr) template.HTMLAttr {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + " " + b
+}
+
+// humanize turns FirstName or first_name into "First name".
+func humanize(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r == '-':
+			b.WriteRune(' ')
+			continue
+		case i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(name[i-1])):
+			b.WriteRune(' ')
+		}
+		if i == 0 {
+			b.WriteRune(unicode.ToUpper(r))
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package template
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+)
+
+type userForm struct {
+	Name     string    `json:"name" label:"Full name" validate:"required,max=80"`
+	Email    string    `json:"email" placeholder:"you@example.com" validate:"required,email"`
+	Role     string    `json:"role" validate:"oneof=admin member"`
+	Age      int       `json:"age" validate:"min=18"`
+	Bio      string    `json:"bio" input:"textarea"`
+	Active   bool      `json:"active"`
+	Birthday time.Time `json:"birthday" input:"date"`
+	Secret   string    `json:"-"`
+	Internal string    `json:"internal" form:"-"`
+}
+
+func TestNewForm(t *testing.T) {
+	in := userForm{Name: "Ada", Role: "admin", Age: 36, Active: true, Birthday: time.Date(1815, 12, 10, 0, 0, 0, 0, time.UTC)}
+	form := NewForm(&in, WithAction("/users"), WithErrors(aqm.ValidateStruct(in)), WithInlineValidation("/users/validate"))
+
+	if len(form.Fields) != 7 {
+		t.Fatalf("expected 7 fields, got %+v", form.Fields)
+	}
+	name := form.Field("name")
+	if name.Label != "Full name" || name.Type != "text" || !name.Required || name.Value != "Ada" || !strings.Contains(string(name.Attrs), `maxlength="80"`) {
+		t.Errorf("unexpected name field %+v", name)
+	}
+	if !strings.Contains(string(name.Attrs), `hx-post="/users/validate"`) || !strings.Contains(string(name.Attrs), `hx-target="#name-field"`) {
+		t.Errorf("missing inline validation attrs: %s", name.Attrs)
+	}
+	email := form.Field("email")
+	if email.Type != "email" || email.Label != "Email" || email.Error != "Field is required" {
+		t.Errorf("unexpected email field %+v", email)
+	}
+	if role := form.Field("role"); role.Type != "select" || len(role.Choices) != 2 || role.Choices[1].Label != "Member" {
+		t.Errorf("unexpected role field %+v", role)
+	}
+	if age := form.Field("age"); age.Type != "number" || !strings.Contains(string(age.Attrs), `min="18"`) {
+		t.Errorf("unexpected age field %+v", age)
+	}
+	if f := form.Field("active"); f.Type != "checkbox" || !f.Checked {
+		t.Errorf("unexpected active field %+v", f)
+	}
+	if f := form.Field("birthday"); f.Value != "1815-12-10" {
+		t.Errorf("unexpected birthday field %+v", f)
+	}
+}
+
+func TestFormComponent(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/user/new-user.html": {Data: []byte(`{{component "form" .}}`)},
+	}
+	mgr := NewManager(assets)
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := mgr.Render(&out, "new-user.html", NewForm(userForm{Role: "member"}, WithAction("/users"), WithSubmit("Create"))); err != nil {
+		t.Fatal(err)
+	}
+	body := out.String()
+	for _, want := range []string{
+		`<form action="/users" method="post" novalidate>`,
+		`<input id="name" name="name" type="text" value="" required maxlength="80">`,
+		`<option value="member" selected>Member</option>`,
+		`<textarea id="bio" name="bio"></textarea>`,
+		`<input id="active" name="active" type="checkbox" value="true">`,
+		`<button type="submit">Create</button>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestDecodeForm(t *testing.T) {
+	values := url.Values{"name": {"Ada"}, "age": {"36"}, "active": {"true"}, "birthday": {"1815-12-10"}, "internal": {"x"}}
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var got userForm
+	if err := DecodeForm(r, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Ada" || got.Age != 36 || !got.Active || got.Birthday.Year() != 1815 || got.Internal != "" {
+		t.Errorf("unexpected decode %+v", got)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("age=old"))
+	bad.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := DecodeForm(bad, &got); err == nil {
+		t.Error("expected error for a non numeric age")
+	}
+}
@@ -0,0 +1,147 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm/events"
+)
+
+const cacheFuncName = "cache"
+
+// FragmentCache keeps rendered HTML fragments for a limited time so heavy
+// partials, such as dashboard widgets, are not rendered on every request.
+// Entries are dropped when they expire or when invalidated explicitly, e.g.
+// from a domain event handler.
+type FragmentCache struct {
+	mu      sync.Mutex
+	entries map[string]fragmentEntry
+	now     func() time.Time
+}
+
+type fragmentEntry struct {
+	html    template.HTML
+	expires time.Time
+}
+
+// NewFragmentCache builds an empty cache.
+func NewFragmentCache() *FragmentCache {
+	return &FragmentCache{entries: make(map[string]fragmentEntry), now: time.Now}
+}
+
+// Fragment returns the cached HTML for key, calling render and caching its
+// output for ttl on a miss. Render errors are returned and not cached.
+func (c *FragmentCache) Fragment(key string, ttl time.Duration, render func() (template.HTML, error)) (template.HTML, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.html, nil
+	}
+
+	html, err := render()
+	if err != nil {
+		return "", err
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = fragmentEntry{html: html, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return html, nil
+}
+
+// Invalidate drops the given keys.
+func (c *FragmentCache) Invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+// InvalidatePrefix drops every key starting with one of prefixes, so keys
+// like "dashboard:<user>" can be cleared together.
+func (c *FragmentCache) InvalidatePrefix(prefixes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// InvalidateOn returns an event handler that drops the keys starting with
+// prefixes whenever it receives a message, to be subscribed to the domain
+// events that change the cached data:
+//
+//	sub.Subscribe(ctx, "orders.created", fragments.InvalidateOn("dashboard:"))
+func (c *FragmentCache) InvalidateOn(prefixes ...string) events.HandlerFunc {
+	return func(context.Context, []byte) error {
+		c.InvalidatePrefix(prefixes...)
+		return nil
+	}
+}
+
+// Len reports how many fragments are cached, including expired ones not yet
+// replaced.
+func (c *FragmentCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// WithFragmentCache enables the cache template function, which renders a
+// named template through cache:
+//
+//	{{ cache (printf "dashboard:%s" .UserID) "5m" "stats" . }}
+//
+// renders the "stats" template with the given data at most once every five
+// minutes per user.
+func WithFragmentCache(cache *FragmentCache) Option {
+	return func(m *Manager) {
+		if cache == nil {
+			return
+		}
+		m.fragments = cache
+		if m.funcs == nil {
+			m.funcs = template.FuncMap{}
+		}
+		// Placeholder so templates parse; bindFragmentCache swaps in the
+		// implementation bound to each parsed set.
+		m.funcs[cacheFuncName] = func(string, string, string, any) (template.HTML, error) {
+			return "", fmt.Errorf("fragment cache not bound")
+		}
+	}
+}
+
+func (m *Manager) bindFragmentCache(tmpl *template.Template) {
+	if m.fragments == nil {
+		return
+	}
+	tmpl.Funcs(template.FuncMap{
+		cacheFuncName: func(key, ttl, name string, data any) (template.HTML, error) {
+			duration, err := time.ParseDuration(ttl)
+			if err != nil {
+				return "", fmt.Errorf("cache %s: invalid ttl %q: %w", key, ttl, err)
+			}
+			return m.fragments.Fragment(key, duration, func() (template.HTML, error) {
+				var buf bytes.Buffer
+				if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+					return "", err
+				}
+				return template.HTML(buf.String()), nil
+			})
+		},
+	})
+}
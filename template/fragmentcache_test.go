@@ -0,0 +1,100 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFragmentCacheTTL(t *testing.T) {
+	cache := NewFragmentCache()
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+
+	renders := 0
+	render := func() (template.HTML, error) {
+		renders++
+		return template.HTML(strings.Repeat("x", renders)), nil
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    template.HTML
+	}{
+		{name: "miss", want: "x"},
+		{name: "hit", advance: 30 * time.Second, want: "x"},
+		{name: "expired", advance: 2 * time.Minute, want: "xx"},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		got, err := cache.Fragment("k", time.Minute, render)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: expected %q, got %q (%v)", tt.name, tt.want, got, err)
+		}
+	}
+
+	if _, err := cache.Fragment("bad", time.Minute, func() (template.HTML, error) { return "", errors.New("boom") }); err == nil {
+		t.Error("expected render error")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected failed render not to be cached, got %d entries", cache.Len())
+	}
+}
+
+func TestFragmentCacheInvalidation(t *testing.T) {
+	cache := NewFragmentCache()
+	for _, key := range []string{"dashboard:1", "dashboard:2", "menu"} {
+		cache.Fragment(key, time.Minute, func() (template.HTML, error) { return "v", nil })
+	}
+
+	cache.Invalidate("menu")
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", cache.Len())
+	}
+	if err := cache.InvalidateOn("dashboard:")(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("expected dashboard fragments dropped, got %d", cache.Len())
+	}
+}
+
+func TestManagerCacheFunc(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/shared/stats.html":   &fstest.MapFile{Data: []byte(`{{define "stats"}}<b>{{.N}}</b>{{end}}`)},
+		"assets/templates/dash/dashboard.html": &fstest.MapFile{Data: []byte(`{{cache "dash" "1m" "stats" .}}`)},
+	}
+	cache := NewFragmentCache()
+	mgr := NewManager(assets, WithFragmentCache(cache))
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	tmpl, err := mgr.Get("dashboard.html")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+
+	render := func(n int) string {
+		var out strings.Builder
+		if err := tmpl.Execute(&out, map[string]int{"N": n}); err != nil {
+			t.Fatalf("Execute error: %v", err)
+		}
+		return out.String()
+	}
+
+	if got := render(1); got != "<b>1</b>" {
+		t.Fatalf("expected rendered fragment, got %q", got)
+	}
+	if got := render(2); got != "<b>1</b>" {
+		t.Errorf("expected cached fragment, got %q", got)
+	}
+	cache.Invalidate("dash")
+	if got := render(3); got != "<b>3</b>" {
+		t.Errorf("expected fresh fragment after invalidation, got %q", got)
+	}
+}
@@ -0,0 +1,119 @@
+package template
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// layoutDefine is the template a page defines to select its layout, e.g.
+// {{define "layout"}}auth{{end}}.
+const layoutDefine = "layout"
+
+var defaultLayouts = []string{"base"}
+
+// WithLayouts names the layouts of the shared directory; each lives in
+// <name><extension> and defines a template of the same name, e.g.
+// {{define "auth"}}...{{block "content" .}}{{end}}...{{end}}. Layouts are
+// not exposed via Get. Defaults to base.
+func WithLayouts(names ...string) Option {
+	return func(m *Manager) {
+		m.layouts = nil
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				m.layouts = append(m.layouts, name)
+			}
+		}
+	}
+}
+
+// RenderOption customises a single Render call.
+type RenderOption func(*renderOptions)
+
+type renderOptions struct {
+	layout string
+
+	view        bool
+	request     *http.Request
+	meta        PageMeta
+	breadcrumbs Breadcrumbs
+}
+
+// WithLayout renders the page inside the named layout, overriding the layout
+// the page selects itself.
+func WithLayout(name string) RenderOption {
+	return func(o *renderOptions) {
+		o.layout = strings.TrimSpace(name)
+	}
+}
+
+func (m *Manager) layoutNames() []string {
+	if len(m.layouts) == 0 {
+		return defaultLayouts
+	}
+	return m.layouts
+}
+
+func (m *Manager) isLayoutFile(name string) bool {
+	for _, layout := range m.layoutNames() {
+		if strings.EqualFold(name, layout+m.extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageLayout returns the layout a parsed page selects with its "layout"
+// define, or "" when it renders itself.
+func (m *Manager) pageLayout(name string, tmpl *template.Template) (string, error) {
+	if tmpl.Lookup(layoutDefine) == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	if err := tmpl.ExecuteTemplate(&b, layoutDefine, nil); err != nil {
+		return "", fmt.Errorf("reading layout of %s: %w", name, err)
+	}
+	layout := strings.TrimSpace(b.String())
+	if err := m.checkLayout(tmpl, layout); err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	return layout, nil
+}
+
+func (m *Manager) checkLayout(tmpl *template.Template, layout string) error {
+	if !slices.Contains(m.layoutNames(), layout) {
+		return fmt.Errorf("unknown layout %q", layout)
+	}
+	if tmpl.Lookup(layout) == nil {
+		return fmt.Errorf("layout %q is not defined", layout)
+	}
+	return nil
+}
+
+// execute runs the page, or the layout it is rendered in; the page's
+// blocks override the layout's defaults.
+func (m *Manager) execute(w io.Writer, name string, tmpl *template.Template, data any, opts []RenderOption) error {
+	var o renderOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	data = m.viewData(data, o)
+	layout := o.layout
+	if layout == "" {
+		m.mu.RLock()
+		layout = m.pageLayouts[name]
+		m.mu.RUnlock()
+	}
+	if layout == "" {
+		return tmpl.Execute(w, data)
+	}
+	if err := m.checkLayout(tmpl, layout); err != nil {
+		return fmt.Errorf("template %s: %w", name, err)
+	}
+	return tmpl.ExecuteTemplate(w, layout, data)
+}
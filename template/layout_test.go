@@ -0,0 +1,75 @@
+package template
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func layoutAssets() fstest.MapFS {
+	return fstest.MapFS{
+		"assets/templates/shared/base.html": {Data: []byte(
+			`{{define "base"}}<main>{{block "content" .}}empty{{end}}<aside>{{block "sidebar" .}}links{{end}}</aside></main>{{end}}`)},
+		"assets/templates/shared/auth.html":  {Data: []byte(`{{define "auth"}}<form>{{block "content" .}}{{end}}</form>{{end}}`)},
+		"assets/templates/shared/print.html": {Data: []byte(`{{define "print"}}<article>{{block "content" .}}{{end}}</article>{{end}}`)},
+		"assets/templates/shared/nav.html":   {Data: []byte(`{{define "nav"}}<nav>{{.}}</nav>{{end}}`)},
+		"assets/templates/user/show-user.html": {Data: []byte(
+			`{{define "layout"}}base{{end}}{{define "content"}}{{template "nav" .}}{{end}}{{define "sidebar"}}user links{{end}}`)},
+		"assets/templates/user/users.html":          {Data: []byte(`{{define "layout"}} base {{end}}{{define "content"}}all users{{end}}`)},
+		"assets/templates/session/new-session.html": {Data: []byte(`{{define "layout"}}auth{{end}}{{define "content"}}sign in{{end}}`)},
+		"assets/templates/user/legacy-user.html":    {Data: []byte(`{{template "base" .}}`)},
+	}
+}
+
+func render(t *testing.T, mgr *Manager, name string, opts ...RenderOption) string {
+	t.Helper()
+	var b strings.Builder
+	if err := mgr.Render(&b, name, "ada", opts...); err != nil {
+		t.Fatalf("render %s: %v", name, err)
+	}
+	return b.String()
+}
+
+func TestLayouts(t *testing.T) {
+	mgr := NewManager(layoutAssets(), WithLayouts("base", "auth", "print"))
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, layout := range []string{"base.html", "auth.html", "print.html"} {
+		if _, err := mgr.Get(layout); err == nil {
+			t.Errorf("layout %s exposed via Get", layout)
+		}
+	}
+	if _, err := mgr.Get("nav.html"); err != nil {
+		t.Errorf("shared partial not exposed: %v", err)
+	}
+
+	cases := map[string]string{
+		"show-user.html":   "<main><nav>ada</nav><aside>user links</aside></main>",
+		"users.html":       "<main>all users<aside>links</aside></main>",
+		"new-session.html": "<form>sign in</form>",
+		"legacy-user.html": "<main>empty<aside>links</aside></main>",
+	}
+	for name, want := range cases {
+		if got := render(t, mgr, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := render(t, mgr, "show-user.html", WithLayout("print")); got != "<article><nav>ada</nav></article>" {
+		t.Errorf("layout override = %q", got)
+	}
+	if err := mgr.Render(&strings.Builder{}, "users.html", nil, WithLayout("missing")); err == nil {
+		t.Error("expected error for unknown layout")
+	}
+	if tmpl, _ := mgr.GetByPath("user", "show"); tmpl == nil {
+		t.Error("GetByPath should still resolve pages")
+	}
+}
+
+func TestPageSelectsUnknownLayout(t *testing.T) {
+	assets := layoutAssets()
+	if err := NewManager(assets).Start(context.Background()); err == nil || !strings.Contains(err.Error(), `unknown layout "auth"`) {
+		t.Errorf("expected unknown layout error, got %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package template
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"path"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -31,9 +34,21 @@ type Manager struct {
 	sharedDir  string
 	extension  string
 	pluralizer *pluralize.Client
-
-	mu        sync.RWMutex
-	templates map[string]*template.Template
+	funcs      template.FuncMap
+	fragments  *FragmentCache
+	devMode    bool
+	layouts    []string
+	menu       NavMenu
+	meta       PageMeta
+
+	componentsDir   string
+	extraComponents map[string]string
+
+	mu          sync.RWMutex
+	templates   map[string]*template.Template
+	pageLayouts map[string]string
+	paths       []string
+	components  *template.Template
 }
 
 // Option configures a Manager instance.
@@ -41,7 +56,11 @@ type Option func(*Manager)
 
 // NewManager returns a Manager configured to read templates from the provided
 // filesystem. When no options are supplied it defaults to the Appetite layout
-// of assets/templates with a shared/ folder and .html files.
+// of assets/templates with a shared/ folder and .html files. Each page is
+// parsed together with the shared templates; pages either include the base
+// layout themselves or select a layout, see WithLayouts and Render.
+// Reusable components are rendered with {{component "name" data}}, see
+// WithComponentsDir.
 func NewManager(assets fs.FS, opts ...Option) *Manager {
 	mgr := &Manager{
 		fs:         assets,
@@ -108,6 +127,31 @@ func WithPluralizer(client *pluralize.Client) Option {
 	}
 }
 
+// WithFuncs registers template functions available to every template, such
+// as the helpers from experiments.FuncMap. Later calls add to earlier ones.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(m *Manager) {
+		if len(funcs) == 0 {
+			return
+		}
+		if m.funcs == nil {
+			m.funcs = template.FuncMap{}
+		}
+		for name, fn := range funcs {
+			m.funcs[name] = fn
+		}
+	}
+}
+
+// WithDevMode makes WriteError show template errors with their location,
+// source snippet and include chain instead of a generic 500. Enable it
+// outside production only.
+func WithDevMode(enabled bool) Option {
+	return func(m *Manager) {
+		m.devMode = enabled
+	}
+}
+
 // Start loads all templates into memory. It satisfies aqm.Startable.
 func (m *Manager) Start(context.Context) error {
 	if err := m.parseTemplates(); err != nil {
@@ -136,6 +180,44 @@ func (m *Manager) Get(name string) (*template.Template, error) {
 	return tmpl, nil
 }
 
+// Render executes the named template with data, inside its layout when the
+// page selects one or WithLayout is given. With WithRequest, WithMeta or
+// WithBreadcrumbs the template receives a View wrapping data. Output is
+// buffered so nothing is written when execution fails; parse and execution
+// errors are returned as *Error, locating the failure in its file.
+func (m *Manager) Render(w io.Writer, name string, data any, opts ...RenderOption) error {
+	tmpl, err := m.Get(name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := m.execute(&buf, name, tmpl, data, opts); err != nil {
+		m.mu.RLock()
+		paths := m.paths
+		m.mu.RUnlock()
+		return m.locateError(err, name, tmpl, paths)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// RenderComponent executes the named component with data, e.g. to answer an
+// HTMX request with a fragment.
+func (m *Manager) RenderComponent(w io.Writer, name string, data any) error {
+	m.mu.RLock()
+	set := m.components
+	m.mu.RUnlock()
+	if set == nil || set.Lookup(componentPrefix+name) == nil {
+		return fmt.Errorf("component %q not found", name)
+	}
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, componentPrefix+name, data); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
 // GetByPath resolves a template name using the handler/action convention
 // used by the Appetite admin UI.
 func (m *Manager) GetByPath(handler, action string) (*template.Template, error) {
@@ -173,7 +255,12 @@ func (m *Manager) parseTemplates() error {
 		return err
 	}
 
-	handlerDirs := collectHandlerDirs(baseEntries, m.sharedDir)
+	components, err := m.loadComponents()
+	if err != nil {
+		return err
+	}
+
+	handlerDirs := collectHandlerDirs(baseEntries, m.sharedDir, m.componentDir())
 	allPaths, err := m.collectAllPaths(handlerDirs, sharedEntries)
 	if err != nil {
 		return err
@@ -182,16 +269,24 @@ func (m *Manager) parseTemplates() error {
 		return errors.New("no templates found")
 	}
 
+	sharedPaths := m.sharedPaths(sharedEntries)
 	templates := make(map[string]*template.Template)
-	if err := m.buildHandlerTemplates(handlerDirs, allPaths, templates); err != nil {
+	layouts := make(map[string]string)
+	if err := m.buildHandlerTemplates(handlerDirs, sharedPaths, allPaths, components, templates, layouts); err != nil {
 		return err
 	}
-	if err := m.buildSharedTemplates(sharedEntries, allPaths, templates); err != nil {
+	if err := m.buildSharedTemplates(sharedEntries, sharedPaths, allPaths, components, templates); err != nil {
 		return err
 	}
 
+	componentSet := template.New("components").Funcs(componentPlaceholder).Funcs(m.funcs)
+	if err := addComponents(componentSet, components); err != nil {
+		return err
+	}
+	bindComponents(componentSet)
+
 	m.mu.Lock()
-	m.templates = templates
+	m.templates, m.pageLayouts, m.paths, m.components = templates, layouts, allPaths, componentSet
 	m.mu.Unlock()
 	return nil
 }
@@ -208,14 +303,19 @@ func (m *Manager) readShared() ([]fs.DirEntry, error) {
 	return entries, nil
 }
 
-func (m *Manager) collectAllPaths(handlerDirs []string, sharedEntries []fs.DirEntry) ([]string, error) {
+func (m *Manager) sharedPaths(sharedEntries []fs.DirEntry) []string {
 	var paths []string
-
 	for _, entry := range sharedEntries {
 		if !entry.IsDir() && strings.HasSuffix(entry.Name(), m.extension) {
 			paths = append(paths, path.Join(m.basePath, m.sharedDir, entry.Name()))
 		}
 	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (m *Manager) collectAllPaths(handlerDirs []string, sharedEntries []fs.DirEntry) ([]string, error) {
+	paths := m.sharedPaths(sharedEntries)
 
 	for _, handlerDir := range handlerDirs {
 		entries, err := fs.ReadDir(m.fs, path.Join(m.basePath, handlerDir))
@@ -236,7 +336,10 @@ func (m *Manager) collectAllPaths(handlerDirs []string, sharedEntries []fs.DirEn
 	return paths, nil
 }
 
-func (m *Manager) buildHandlerTemplates(handlerDirs []string, allPaths []string, templates map[string]*template.Template) error {
+// buildHandlerTemplates parses every page with the shared templates, the page
+// last so the blocks it defines override the layout defaults without leaking
+// into other pages.
+func (m *Manager) buildHandlerTemplates(handlerDirs, sharedPaths, allPaths []string, components map[string]string, templates map[string]*template.Template, layouts map[string]string) error {
 	for _, handlerDir := range handlerDirs {
 		entries, err := fs.ReadDir(m.fs, path.Join(m.basePath, handlerDir))
 		if err != nil {
@@ -248,11 +351,18 @@ func (m *Manager) buildHandlerTemplates(handlerDirs []string, allPaths []string,
 				continue
 			}
 			name := entry.Name()
-			tmpl := template.New(name)
-			parsed, err := tmpl.ParseFS(m.fs, allPaths...)
+			pagePaths := append(slices.Clone(sharedPaths), path.Join(m.basePath, handlerDir, name))
+			parsed, err := m.parseSet(name, pagePaths, allPaths, components)
 			if err != nil {
 				return fmt.Errorf("parsing template %s: %w", name, err)
 			}
+			layout, err := m.pageLayout(name, parsed)
+			if err != nil {
+				return err
+			}
+			if layout != "" {
+				layouts[name] = layout
+			}
 			templates[name] = parsed
 			m.log.Debug("loaded template", "name", name)
 		}
@@ -260,18 +370,17 @@ func (m *Manager) buildHandlerTemplates(handlerDirs []string, allPaths []string,
 	return nil
 }
 
-func (m *Manager) buildSharedTemplates(sharedEntries []fs.DirEntry, allPaths []string, templates map[string]*template.Template) error {
+func (m *Manager) buildSharedTemplates(sharedEntries []fs.DirEntry, sharedPaths, allPaths []string, components map[string]string, templates map[string]*template.Template) error {
 	for _, entry := range sharedEntries {
 		if entry.IsDir() || !strings.HasSuffix(entry.Name(), m.extension) {
 			continue
 		}
 		name := entry.Name()
-		if strings.EqualFold(name, "base"+m.extension) {
-			// base layout is included everywhere but not exposed via Get.
+		if m.isLayoutFile(name) {
+			// layouts are included everywhere but not exposed via Get.
 			continue
 		}
-		tmpl := template.New(name)
-		parsed, err := tmpl.ParseFS(m.fs, allPaths...)
+		parsed, err := m.parseSet(name, sharedPaths, allPaths, components)
 		if err != nil {
 			return fmt.Errorf("parsing shared template %s: %w", name, err)
 		}
@@ -281,10 +390,26 @@ func (m *Manager) buildSharedTemplates(sharedEntries []fs.DirEntry, allPaths []s
 	return nil
 }
 
-func collectHandlerDirs(entries []fs.DirEntry, sharedDir string) []string {
+// parseSet parses the template set of name from paths, adds the components
+// and binds the template functions to the set.
+func (m *Manager) parseSet(name string, paths, allPaths []string, components map[string]string) (*template.Template, error) {
+	tmpl := template.New(name).Funcs(componentPlaceholder).Funcs(m.funcs)
+	parsed, err := tmpl.ParseFS(m.fs, paths...)
+	if err != nil {
+		return nil, m.locateError(err, name, nil, allPaths)
+	}
+	if err := addComponents(parsed, components); err != nil {
+		return nil, err
+	}
+	bindComponents(parsed)
+	m.bindFragmentCache(parsed)
+	return parsed, nil
+}
+
+func collectHandlerDirs(entries []fs.DirEntry, skip ...string) []string {
 	var dirs []string
 	for _, entry := range entries {
-		if entry.IsDir() && entry.Name() != sharedDir {
+		if entry.IsDir() && !slices.Contains(skip, entry.Name()) {
 			dirs = append(dirs, entry.Name())
 		}
 	}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"html/template"
 	"io/fs"
+	"strings"
 	"testing"
 	"testing/fstest"
 
 	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/aqmtest"
 	"github.com/gertd/go-pluralize"
 )
 
@@ -459,3 +461,78 @@ func (e *fakeEntry) Name() string               { return e.name }
 func (e *fakeEntry) IsDir() bool                { return e.isDir }
 func (e *fakeEntry) Type() fs.FileMode          { return 0 }
 func (e *fakeEntry) Info() (fs.FileInfo, error) { return nil, nil }
+
+func TestWithFuncs(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/shared/base.html": &fstest.MapFile{Data: []byte(`{{define "base"}}base{{end}}`)},
+		"assets/templates/user/users.html":  &fstest.MapFile{Data: []byte(`{{shout "hi"}}`)},
+	}
+	mgr := NewManager(assets, WithFuncs(template.FuncMap{
+		"shout": func(s string) string { return s + "!" },
+	}))
+
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	tmpl, err := mgr.Get("users.html")
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, nil); err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if out.String() != "hi!" {
+		t.Errorf("expected %q, got %q", "hi!", out.String())
+	}
+}
+
+func benchManager(tb testing.TB) *Manager {
+	tb.Helper()
+	mgr := NewManager(errorAssets())
+	if err := mgr.Start(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+	return mgr
+}
+
+var benchPage = map[string]any{"User": map[string]any{"Name": "ada"}}
+
+func BenchmarkRender(b *testing.B) {
+	mgr := benchManager(b)
+	var out strings.Builder
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := mgr.Render(&out, "show-user.html", benchPage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderParallel(b *testing.B) {
+	mgr := benchManager(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var out strings.Builder
+		for pb.Next() {
+			out.Reset()
+			if err := mgr.Render(&out, "show-user.html", benchPage); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestRenderAllocBudget(t *testing.T) {
+	mgr := benchManager(t)
+	var out strings.Builder
+	aqmtest.AllocBudget(t, 30, func() {
+		out.Reset()
+		mgr.Render(&out, "show-user.html", benchPage)
+	})
+}
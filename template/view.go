@@ -0,0 +1,213 @@
+package template
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// View is the template data of a page rendered with view options: the
+// handler data in Data next to the page metadata, breadcrumbs and menu.
+// Templates read {{.Data.Users}}, {{.Meta.Title}} or
+// {{component "meta" .Meta}}.
+type View struct {
+	Meta        PageMeta
+	Breadcrumbs Breadcrumbs
+	Menu        NavMenu
+	Data        any
+}
+
+// Breadcrumb is one step of a breadcrumb trail; the current page has no URL.
+type Breadcrumb struct {
+	Label string
+	URL   string
+}
+
+// Breadcrumbs is a trail from the root to the current page, built with Add:
+//
+//	template.Breadcrumbs{}.Add("Home", "/").Add("Users", "/users").Add(user.Name, "")
+type Breadcrumbs []Breadcrumb
+
+// Add returns the trail with a step appended.
+func (b Breadcrumbs) Add(label, url string) Breadcrumbs {
+	return append(b[:len(b):len(b)], Breadcrumb{Label: label, URL: url})
+}
+
+// Current is the last step, or the zero Breadcrumb.
+func (b Breadcrumbs) Current() Breadcrumb {
+	if len(b) == 0 {
+		return Breadcrumb{}
+	}
+	return b[len(b)-1]
+}
+
+// MenuItem is one navigation entry. Pattern is the chi route pattern the
+// item stands for, e.g. /users/*; without it the item matches its URL and
+// the paths below it.
+type MenuItem struct {
+	Label    string
+	URL      string
+	Pattern  string
+	Icon     string
+	Active   bool
+	Children NavMenu
+}
+
+// NavMenu is a navigation menu, usually configured once with WithMenu and
+// resolved against each request.
+type NavMenu []MenuItem
+
+// Resolve returns a copy of the menu with Active set on the items matching
+// r, and on their parents.
+func (m NavMenu) Resolve(r *http.Request) NavMenu {
+	if len(m) == 0 || r == nil {
+		return m
+	}
+	pattern := ""
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		pattern = rctx.RoutePattern()
+	}
+	return m.resolve(pattern, r.URL.Path)
+}
+
+func (m NavMenu) resolve(pattern, path string) NavMenu {
+	resolved := make(NavMenu, len(m))
+	for i, item := range m {
+		item.Children = item.Children.resolve(pattern, path)
+		item.Active = item.matches(pattern, path) || item.Children.hasActive()
+		resolved[i] = item
+	}
+	return resolved
+}
+
+func (m NavMenu) hasActive() bool {
+	for _, item := range m {
+		if item.Active {
+			return true
+		}
+	}
+	return false
+}
+
+func (i MenuItem) matches(pattern, path string) bool {
+	if i.Pattern != "" {
+		if prefix, ok := strings.CutSuffix(i.Pattern, "*"); ok {
+			return strings.HasPrefix(pattern, prefix) || pattern == strings.TrimSuffix(prefix, "/")
+		}
+		return pattern == i.Pattern
+	}
+	if i.URL == "" {
+		return false
+	}
+	if i.URL == "/" {
+		return path == "/"
+	}
+	base := strings.TrimSuffix(i.URL, "/")
+	return path == base || strings.HasPrefix(path, base+"/")
+}
+
+// PageMeta holds the title, description and Open Graph tags of a page,
+// rendered in the head with {{component "meta" .Meta}}.
+type PageMeta struct {
+	Title       string
+	Description string
+	// SiteName is appended to the title and used as og:site_name.
+	SiteName  string
+	Canonical string
+	Image     string
+	// Type is the og:type (default website).
+	Type   string
+	Robots string
+}
+
+// FullTitle is the title followed by the site name.
+func (p PageMeta) FullTitle() string {
+	switch {
+	case p.Title == "":
+		return p.SiteName
+	case p.SiteName == "" || p.Title == p.SiteName:
+		return p.Title
+	default:
+		return p.Title + " | " + p.SiteName
+	}
+}
+
+// OGType is the og:type, website by default.
+func (p PageMeta) OGType() string {
+	if p.Type == "" {
+		return "website"
+	}
+	return p.Type
+}
+
+// merge fills the empty fields of p from defaults.
+func (p PageMeta) merge(defaults PageMeta) PageMeta {
+	fill := func(v *string, def string) {
+		if *v == "" {
+			*v = def
+		}
+	}
+	fill(&p.Title, defaults.Title)
+	fill(&p.Description, defaults.Description)
+	fill(&p.SiteName, defaults.SiteName)
+	fill(&p.Canonical, defaults.Canonical)
+	fill(&p.Image, defaults.Image)
+	fill(&p.Type, defaults.Type)
+	fill(&p.Robots, defaults.Robots)
+	return p
+}
+
+// WithMenu sets the navigation menu placed in View.Menu, resolved against
+// the request given with WithRequest.
+func WithMenu(menu NavMenu) Option {
+	return func(m *Manager) {
+		m.menu = menu
+	}
+}
+
+// WithPageMeta sets the defaults of View.Meta, e.g. the site name and
+// default description.
+func WithPageMeta(meta PageMeta) Option {
+	return func(m *Manager) {
+		m.meta = meta
+	}
+}
+
+// WithRequest renders the page with a View, its menu resolved against r.
+func WithRequest(r *http.Request) RenderOption {
+	return func(o *renderOptions) {
+		o.view = true
+		o.request = r
+	}
+}
+
+// WithMeta renders the page with a View carrying meta over the manager
+// defaults.
+func WithMeta(meta PageMeta) RenderOption {
+	return func(o *renderOptions) {
+		o.view = true
+		o.meta = meta
+	}
+}
+
+// WithBreadcrumbs renders the page with a View carrying the trail.
+func WithBreadcrumbs(trail Breadcrumbs) RenderOption {
+	return func(o *renderOptions) {
+		o.view = true
+		o.breadcrumbs = trail
+	}
+}
+
+// viewData wraps data in a View when a view option was given.
+func (m *Manager) viewData(data any, o renderOptions) any {
+	if !o.view {
+		return data
+	}
+	return View{
+		Meta:        o.meta.merge(m.meta),
+		Breadcrumbs: o.breadcrumbs,
+		Menu:        m.menu.Resolve(o.request),
+		Data:        data,
+	}
+}
@@ -0,0 +1,103 @@
+package template
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var testMenu = NavMenu{
+	{Label: "Home", URL: "/"},
+	{Label: "Users", URL: "/users", Pattern: "/users/*"},
+	{Label: "Settings", URL: "/settings", Children: NavMenu{
+		{Label: "Profile", URL: "/settings/profile"},
+		{Label: "Keys", URL: "/settings/keys"},
+	}},
+}
+
+func resolveAt(t *testing.T, route, path string) NavMenu {
+	t.Helper()
+	var menu NavMenu
+	r := chi.NewRouter()
+	r.Get(route, func(w http.ResponseWriter, r *http.Request) { menu = testMenu.Resolve(r) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	return menu
+}
+
+func TestNavMenuResolve(t *testing.T) {
+	menu := resolveAt(t, "/users/{id}", "/users/42")
+	if menu[0].Active || !menu[1].Active || menu[2].Active {
+		t.Errorf("users route: %+v", menu)
+	}
+	menu = resolveAt(t, "/settings/keys", "/settings/keys")
+	if !menu[2].Active || menu[2].Children[0].Active || !menu[2].Children[1].Active {
+		t.Errorf("settings route: %+v", menu)
+	}
+	if menu = resolveAt(t, "/", "/"); !menu[0].Active || menu[1].Active {
+		t.Errorf("home route: %+v", menu)
+	}
+	if testMenu[1].Active {
+		t.Error("Resolve modified the configured menu")
+	}
+}
+
+func TestBreadcrumbsAndMeta(t *testing.T) {
+	home := Breadcrumbs{}.Add("Home", "/")
+	users := home.Add("Users", "/users")
+	a, b := users.Add("Ada", ""), users.Add("Bob", "")
+	if len(home) != 1 || a.Current().Label != "Ada" || b.Current().Label != "Bob" {
+		t.Errorf("trails share storage: %v %v", a, b)
+	}
+
+	meta := PageMeta{Title: "Users"}.merge(PageMeta{Title: "Admin", SiteName: "Admin", Description: "Back office"})
+	if meta.FullTitle() != "Users | Admin" || meta.Description != "Back office" || meta.OGType() != "website" {
+		t.Errorf("unexpected meta %+v", meta)
+	}
+}
+
+func TestRenderView(t *testing.T) {
+	assets := fstest.MapFS{
+		"assets/templates/user/users.html": {Data: []byte(
+			`<head>{{component "meta" .Meta}}</head>{{component "breadcrumbs" .Breadcrumbs}}{{component "menu" .Menu}}<p>{{.Data.Count}}</p>`)},
+	}
+	mgr := NewManager(assets, WithMenu(testMenu), WithPageMeta(PageMeta{SiteName: "Admin", Description: "Back office"}))
+	if err := mgr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var body string
+	r := chi.NewRouter()
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+		var out strings.Builder
+		err := mgr.Render(&out, "users.html", map[string]int{"Count": 3},
+			WithRequest(r),
+			WithMeta(PageMeta{Title: "Users", Canonical: "https://admin.example.com/users"}),
+			WithBreadcrumbs(Breadcrumbs{}.Add("Home", "/").Add("Users", "")))
+		if err != nil {
+			t.Error(err)
+		}
+		body = out.String()
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	for _, want := range []string{
+		"<title>Users | Admin</title>",
+		`<meta name="description" content="Back office">`,
+		`<meta property="og:url" content="https://admin.example.com/users">`,
+		`<meta property="og:site_name" content="Admin">`,
+		`<a href="/">Home</a>`,
+		`<span aria-current="page">Users</span>`,
+		`<li class="active"><a href="/users" aria-current="page">Users</a>`,
+		`<a href="/settings/keys">Keys</a>`,
+		"<p>3</p>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package aqm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/aquamarinepk/aqm/aqmctx"
+)
+
+const (
+	// TraceparentHeader carries the W3C trace context between services.
+	TraceparentHeader = "traceparent"
+	// TraceIDHeader exposes the trace ID of a request to its client.
+	TraceIDHeader = "X-Trace-Id"
+)
+
+var traceKey = aqmctx.NewKey[TraceContext]("trace")
+
+// TraceContext identifies the current span of a distributed trace, using
+// the W3C Trace Context formats: a 32 hex digit trace ID and a 16 hex digit
+// span ID.
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+// TraceSpan is implemented by spans that expose their trace context.
+// Observe stores it in the context handed to the call, so logs, error
+// reports and outgoing requests made inside the span carry its IDs.
+type TraceSpan interface {
+	TraceContext() TraceContext
+}
+
+// NewTraceContext starts a new sampled trace.
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceID: randomHex(16), SpanID: randomHex(8), Sampled: true}
+}
+
+// Child returns a new span of the same trace.
+func (tc TraceContext) Child() TraceContext {
+	return TraceContext{TraceID: tc.TraceID, SpanID: randomHex(8), Sampled: tc.Sampled}
+}
+
+// IsValid reports whether both IDs are well formed and not all zeros.
+func (tc TraceContext) IsValid() bool {
+	return validTraceID(tc.TraceID, 32) && validTraceID(tc.SpanID, 16)
+}
+
+// Traceparent formats tc as a traceparent header value.
+func (tc TraceContext) Traceparent() string {
+	flags := "00"
+	if tc.Sampled {
+		flags = "01"
+	}
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + flags
+}
+
+// ParseTraceparent reads a traceparent header value, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func ParseTraceparent(value string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return TraceContext{}, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return TraceContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return TraceContext{}, false
+	}
+	tc := TraceContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags[0]&1 == 1}
+	if !tc.IsValid() {
+		return TraceContext{}, false
+	}
+	return tc, true
+}
+
+// ContextWithTrace stores tc as the current span of ctx.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	if ctx == nil || !tc.IsValid() {
+		return ctx
+	}
+	return traceKey.With(ctx, tc)
+}
+
+// TraceFrom returns the current span stored in ctx.
+func TraceFrom(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	return traceKey.From(ctx)
+}
+
+// TraceFields returns the trace_id and span_id key/value pairs of ctx, or
+// nil without a trace.
+func TraceFields(ctx context.Context) []any {
+	tc, ok := TraceFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return []any{"trace_id", tc.TraceID, "span_id", tc.SpanID}
+}
+
+// SetTraceHeaders propagates the trace of ctx to an outgoing request.
+func SetTraceHeaders(ctx context.Context, req *http.Request) {
+	if tc, ok := TraceFrom(ctx); ok {
+		req.Header.Set(TraceparentHeader, tc.Traceparent())
+	}
+}
+
+// TraceMiddleware continues the trace of an incoming traceparent header
+// with a new span, or starts a trace, and stores it in the request context.
+// With expose the trace ID is returned in X-Trace-Id so clients can quote it
+// in support requests. Requests that already carry a trace pass through.
+func TraceMiddleware(expose bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := TraceFrom(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tc, ok := ParseTraceparent(r.Header.Get(TraceparentHeader))
+			if ok {
+				tc = tc.Child()
+			} else {
+				tc = NewTraceContext()
+			}
+			if expose {
+				w.Header().Set(TraceIDHeader, tc.TraceID)
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithTrace(r.Context(), tc)))
+		})
+	}
+}
+
+// TraceErrorReporter adds the trace_id and span_id of the report context to
+// the fields forwarded to reporter. NewMicro installs it around the shared
+// reporter.
+func TraceErrorReporter(reporter ErrorReporter) ErrorReporter {
+	if reporter == nil {
+		return nil
+	}
+	return ErrorReporterFunc(func(ctx context.Context, err error, fields map[string]any) {
+		if tc, ok := TraceFrom(ctx); ok {
+			merged := make(map[string]any, len(fields)+2)
+			for key, value := range fields {
+				merged[key] = value
+			}
+			merged["trace_id"], merged["span_id"] = tc.TraceID, tc.SpanID
+			fields = merged
+		}
+		reporter.Report(ctx, err, fields)
+	})
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	for {
+		rand.Read(buf)
+		for _, b := range buf {
+			if b != 0 {
+				return hex.EncodeToString(buf)
+			}
+		}
+	}
+}
+
+func validTraceID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
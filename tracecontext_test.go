@@ -0,0 +1,122 @@
+package aqm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.SpanID != "00f067aa0ba902b7" || !tc.Sampled {
+		t.Fatalf("parsed = %+v, %v", tc, ok)
+	}
+	if tc.Traceparent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("round trip = %q", tc.Traceparent())
+	}
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Errorf("ParseTraceparent(%q) should fail", invalid)
+		}
+	}
+
+	child := tc.Child()
+	if child.TraceID != tc.TraceID || child.SpanID == tc.SpanID || !child.IsValid() {
+		t.Errorf("child = %+v", child)
+	}
+	if fresh := NewTraceContext(); !fresh.IsValid() || !fresh.Sampled {
+		t.Errorf("new trace = %+v", fresh)
+	}
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	var got TraceContext
+	handler := TraceMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = TraceFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.SpanID == "00f067aa0ba902b7" || got.Sampled {
+		t.Errorf("continued trace = %+v", got)
+	}
+	if rec.Header().Get(TraceIDHeader) != got.TraceID {
+		t.Errorf("%s = %q", TraceIDHeader, rec.Header().Get(TraceIDHeader))
+	}
+
+	rec = httptest.NewRecorder()
+	TraceMiddleware(false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = TraceFrom(r.Context())
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !got.IsValid() || rec.Header().Get(TraceIDHeader) != "" {
+		t.Errorf("started trace = %+v, header %q", got, rec.Header().Get(TraceIDHeader))
+	}
+}
+
+func TestTraceCorrelation(t *testing.T) {
+	tc := NewTraceContext()
+	ctx := ContextWithTrace(context.Background(), tc)
+
+	var buf bytes.Buffer
+	LoggerFrom(ContextWithLogger(ctx, newBufferLogger(&buf))).Info("hello")
+	if !strings.Contains(buf.String(), "trace_id="+tc.TraceID) || !strings.Contains(buf.String(), "span_id="+tc.SpanID) {
+		t.Errorf("log lacks trace ids: %s", buf.String())
+	}
+
+	var fields map[string]any
+	reporter := TraceErrorReporter(ErrorReporterFunc(func(_ context.Context, _ error, f map[string]any) {
+		fields = f
+	}))
+	reporter.Report(ctx, errors.New("boom"), map[string]any{"path": "/x"})
+	if fields["trace_id"] != tc.TraceID || fields["span_id"] != tc.SpanID || fields["path"] != "/x" {
+		t.Errorf("report fields = %v", fields)
+	}
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(TraceparentHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	if err := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL}).Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if traceparent != tc.Traceparent() {
+		t.Errorf("propagated traceparent = %q, want %q", traceparent, tc.Traceparent())
+	}
+}
+
+type tracedSpan struct{ tc TraceContext }
+
+func (s tracedSpan) End(error)                  {}
+func (s tracedSpan) TraceContext() TraceContext { return s.tc }
+
+type spanTracer struct{ tc TraceContext }
+
+func (t spanTracer) Start(ctx context.Context, _ string, _ map[string]any) (context.Context, Span) {
+	return ctx, tracedSpan{t.tc}
+}
+
+func TestObserveTraceSpan(t *testing.T) {
+	tc := NewTraceContext()
+	o := &Observer{Tracer: spanTracer{tc}}
+	o.Observe(context.Background(), "call", func(ctx context.Context) error {
+		if got, _ := TraceFrom(ctx); got != tc {
+			t.Errorf("call trace = %+v, want %+v", got, tc)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,347 @@
+package aqm
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// TagValidator checks a field value against the parameter of its tag rule,
+// e.g. "50" in max=50. Values are dereferenced before the call.
+type TagValidator func(value reflect.Value, param string) bool
+
+type tagRule struct {
+	code    string
+	message string
+	check   TagValidator
+	param   func(string) error // validates the parameter, when set
+}
+
+var (
+	tagRulesMu sync.RWMutex
+	tagRules   = map[string]tagRule{
+		"required": {CodeRequired, "Field is required", func(v reflect.Value, _ string) bool { return !isZeroValue(v) }, nil},
+		"email":    {CodeInvalidEmail, "Must be a valid email address", stringRule(IsEmail), nil},
+		"phone":    {CodeInvalidPhone, "Must be a phone number in international format, e.g. +14155552671", stringRule(IsPhone), nil},
+		"url":      {CodeInvalidURL, "Must be a valid absolute URL", urlRule, nil},
+		"country":  {CodeInvalidCountry, "Must be a two-letter ISO country code", stringRule(IsCountryCode), nil},
+		"locale":   {CodeInvalidLocale, "Must be a locale such as en or en-US", stringRule(IsLocale), nil},
+		"uuid":     {"invalid_uuid", "Must be a valid UUID", uuidRule, nil},
+		"min": {"min", "Must be at least %s", func(v reflect.Value, p string) bool {
+			return compareSize(v, p, func(a, b float64) bool { return a >= b })
+		}, numberParam},
+		"max": {"max", "Must be at most %s", func(v reflect.Value, p string) bool {
+			return compareSize(v, p, func(a, b float64) bool { return a <= b })
+		}, numberParam},
+		"len": {"len", "Must have length %s", func(v reflect.Value, p string) bool {
+			return compareSize(v, p, func(a, b float64) bool { return a == b })
+		}, numberParam},
+		"oneof": {"oneof", "Must be one of: %s", oneOfRule, nil},
+	}
+	structCache sync.Map // fieldsKey -> []structField
+)
+
+// CodeInvalidRule is reported for a validate tag naming an unknown rule or
+// carrying an invalid parameter, which is a programming error.
+const CodeInvalidRule = "invalid_rule"
+
+// RegisterValidator adds a tag rule usable in validate tags. The message may
+// contain one %s, replaced by the rule parameter. Registering an existing name
+// replaces it.
+func RegisterValidator(name, code, message string, check TagValidator) {
+	tagRulesMu.Lock()
+	defer tagRulesMu.Unlock()
+	tagRules[name] = tagRule{code: code, message: message, check: check}
+}
+
+// ValidateStruct validates v using `validate` struct tags such as
+// validate:"required,email,max=50,oneof=free pro". Errors are keyed by JSON
+// field names with dotted paths for nested structs and indexes for slices
+// (items[0].name). Nested structs and slices of structs are always
+// traversed; "dive" applies the remaining rules to each element of a slice
+// or map. Rules other than required skip empty values. min, max and len
+// compare numbers by value, durations in seconds, and strings, slices and
+// maps by length. Config.Bind applies the same rules. A tag naming an
+// unknown rule or with an invalid parameter is reported with
+// CodeInvalidRule; CheckValidationTags finds those at startup.
+func ValidateStruct(v any) ValidationErrors {
+	var errs ValidationErrors
+	validateValue(reflect.ValueOf(v), "", "json", &errs)
+	return errs
+}
+
+// CheckValidationTags reports the first invalid validate tag of the struct
+// type of v, or of any struct it contains, without validating values. Call
+// it from tests or at startup to catch typos before the first request.
+func CheckValidationTags(v any) error {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return checkTags(t, map[reflect.Type]bool{})
+}
+
+func checkTags(t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for _, field := range fieldsOf(t, "json") {
+		for _, raw := range field.rules {
+			name, param, _ := strings.Cut(raw, "=")
+			if name == "dive" {
+				continue
+			}
+			if _, err := lookupRule(name, param); err != nil {
+				return fmt.Errorf("aqm: %s.%s: %w", t.Name(), t.Field(field.index).Name, err)
+			}
+		}
+		ft := t.Field(field.index).Type
+		for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array || ft.Kind() == reflect.Map {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			if err := checkTags(ft, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupRule returns the rule registered under name after checking param.
+func lookupRule(name, param string) (tagRule, error) {
+	tagRulesMu.RLock()
+	rule, ok := tagRules[name]
+	tagRulesMu.RUnlock()
+	if !ok {
+		return tagRule{}, fmt.Errorf("unknown validation rule %q", name)
+	}
+	if rule.param != nil {
+		if err := rule.param(param); err != nil {
+			return tagRule{}, fmt.Errorf("invalid %s parameter %q", name, param)
+		}
+	}
+	return rule, nil
+}
+
+type structField struct {
+	index int
+	name  string
+	rules []string
+}
+
+type fieldsKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// validateValue walks v naming fields by their nameTag ("json" for
+// ValidateStruct, "koanf" for Config.Bind).
+func validateValue(v reflect.Value, path, nameTag string, errs *ValidationErrors) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, field := range fieldsOf(v.Type(), nameTag) {
+			fieldPath := joinPath(path, field.name)
+			value := v.Field(field.index)
+			applyRules(value, fieldPath, nameTag, field.rules, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), nameTag, errs)
+		}
+	}
+}
+
+func applyRules(value reflect.Value, path, nameTag string, rules []string, errs *ValidationErrors) {
+	for i, raw := range rules {
+		name, param, _ := strings.Cut(raw, "=")
+		if name == "dive" {
+			elems := indirect(value)
+			if elems.Kind() == reflect.Slice || elems.Kind() == reflect.Array {
+				for j := 0; j < elems.Len(); j++ {
+					applyRules(elems.Index(j), fmt.Sprintf("%s[%d]", path, j), nameTag, rules[i+1:], errs)
+				}
+			} else if elems.Kind() == reflect.Map {
+				for _, key := range elems.MapKeys() {
+					applyRules(elems.MapIndex(key), fmt.Sprintf("%s[%v]", path, key), nameTag, rules[i+1:], errs)
+				}
+			}
+			return
+		}
+
+		rule, err := lookupRule(name, param)
+		if err != nil {
+			*errs = append(*errs, ValidationError{Field: path, Code: CodeInvalidRule, Message: err.Error()})
+			continue
+		}
+		target := indirect(value)
+		if name != "required" && isZeroValue(target) {
+			continue
+		}
+		if !rule.check(target, param) {
+			message := rule.message
+			if strings.Contains(message, "%s") {
+				message = fmt.Sprintf(message, param)
+			}
+			*errs = append(*errs, ValidationError{Field: path, Code: rule.code, Message: message})
+			if name == "required" {
+				return
+			}
+		}
+	}
+	validateValue(value, path, nameTag, errs)
+}
+
+// fieldsOf lists the exported fields of t with their validate rules, named
+// by nameTag. Without the tag json uses the field name and koanf the field
+// name in lower case, as the config decoder matches it.
+func fieldsOf(t reflect.Type, nameTag string) []structField {
+	key := fieldsKey{t, nameTag}
+	if cached, ok := structCache.Load(key); ok {
+		return cached.([]structField)
+	}
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if nameTag == "koanf" {
+			name = strings.ToLower(f.Name)
+		}
+		if tag, _, _ := strings.Cut(f.Tag.Get(nameTag), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		var rules []string
+		if tag := f.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, r := range strings.Split(tag, ",") {
+				if r = strings.TrimSpace(r); r != "" {
+					rules = append(rules, r)
+				}
+			}
+		}
+		if f.Anonymous && nameTag == "json" && f.Tag.Get("json") == "" {
+			// Embedded structs validate their fields at the parent level.
+			name = ""
+		}
+		fields = append(fields, structField{index: i, name: name, rules: rules})
+	}
+	structCache.Store(key, fields)
+	return fields
+}
+
+func joinPath(parent, name string) string {
+	switch {
+	case parent == "":
+		return name
+	case name == "":
+		return parent
+	}
+	return parent + "." + name
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isZeroValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func stringRule(check func(string) bool) TagValidator {
+	return func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && check(v.String())
+	}
+}
+
+func urlRule(v reflect.Value, param string) bool {
+	var schemes []string
+	if param != "" {
+		schemes = strings.Fields(param)
+	}
+	return v.Kind() == reflect.String && IsURL(v.String(), schemes...)
+}
+
+func uuidRule(v reflect.Value, _ string) bool {
+	if id, ok := v.Interface().(uuid.UUID); ok {
+		return id != uuid.Nil
+	}
+	if v.Kind() != reflect.String {
+		return false
+	}
+	_, err := uuid.Parse(v.String())
+	return err == nil
+}
+
+func oneOfRule(v reflect.Value, param string) bool {
+	value := fmt.Sprint(v.Interface())
+	for _, option := range strings.Fields(param) {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+func numberParam(param string) error {
+	_, err := strconv.ParseFloat(param, 64)
+	return err
+}
+
+// compareSize compares numbers by value, durations in seconds, and strings,
+// slices and maps by length (characters for strings). lookupRule has
+// checked the parameter.
+func compareSize(v reflect.Value, param string, cmp func(a, b float64) bool) bool {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false
+	}
+	if v.Type() == durationType {
+		return cmp(time.Duration(v.Int()).Seconds(), limit)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return cmp(float64(utf8.RuneCountInString(v.String())), limit)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return cmp(float64(v.Len()), limit)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp(float64(v.Int()), limit)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp(float64(v.Uint()), limit)
+	case reflect.Float32, reflect.Float64:
+		return cmp(v.Float(), limit)
+	}
+	return false
+}
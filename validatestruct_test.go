@@ -0,0 +1,135 @@
+package aqm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAddress struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"required,country"`
+}
+
+type testLine struct {
+	SKU      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1,max=10"`
+}
+
+type testSignup struct {
+	Name     string       `json:"name" validate:"required,max=5"`
+	Email    string       `json:"email" validate:"required,email"`
+	Phone    string       `json:"phone,omitempty" validate:"phone"`
+	Website  string       `json:"website" validate:"url"`
+	Plan     string       `json:"plan" validate:"oneof=free pro"`
+	Tags     []string     `json:"tags" validate:"max=2,dive,min=2"`
+	Address  *testAddress `json:"address" validate:"required"`
+	Lines    []testLine   `json:"lines"`
+	Billing  testAddress  `json:"billing"`
+	Internal string       `json:"-" validate:"required"`
+	Slug     string       `validate:"even"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	RegisterValidator("even", "even_length", "Must have an even length", func(v reflect.Value, _ string) bool {
+		return len(v.String())%2 == 0
+	})
+
+	valid := testSignup{
+		Name:    "Ada",
+		Email:   "ada@example.com",
+		Phone:   "+14155552671",
+		Plan:    "pro",
+		Tags:    []string{"go"},
+		Address: &testAddress{City: "London", Country: "GB"},
+		Lines:   []testLine{{SKU: "a", Quantity: 2}},
+		Billing: testAddress{City: "Paris", Country: "fr"},
+		Slug:    "ab",
+	}
+	if errs := ValidateStruct(&valid); errs.HasErrors() {
+		t.Fatalf("expected no errors, got %+v", errs)
+	}
+
+	invalid := testSignup{
+		Name:    "Grace Hopper",
+		Email:   "nope",
+		Phone:   "555",
+		Website: "ftp://x.test",
+		Plan:    "gold",
+		Tags:    []string{"a", "bb", "cc"},
+		Lines:   []testLine{{Quantity: 0}, {SKU: "b", Quantity: 11}},
+		Billing: testAddress{City: "Paris", Country: "XX"},
+		Slug:    "abc",
+	}
+	want := map[string]string{
+		"name":              "max",
+		"email":             CodeInvalidEmail,
+		"phone":             CodeInvalidPhone,
+		"website":           CodeInvalidURL,
+		"plan":              "oneof",
+		"tags":              "max",
+		"tags[0]":           "min",
+		"address":           CodeRequired,
+		"lines[0].sku":      CodeRequired,
+		"lines[1].quantity": "max",
+		"billing.country":   CodeInvalidCountry,
+		"Slug":              "even_length",
+	}
+	errs := ValidateStruct(invalid)
+	got := make(map[string]string, len(errs))
+	for _, e := range errs {
+		got[e.Field] = e.Code
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d errors, got %d: %v", len(want), len(got), got)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("field %q: expected %q, got %q", field, code, got[field])
+		}
+	}
+	for _, e := range errs {
+		if e.Field == "name" && !strings.Contains(e.Message, "5") {
+			t.Errorf("expected parameter in message, got %q", e.Message)
+		}
+	}
+}
+
+func TestValidateStructInvalidTags(t *testing.T) {
+	type invalid struct {
+		Name  string `json:"name" validate:"bogus"`
+		Count int    `json:"count" validate:"max=ten"`
+	}
+	errs := ValidateStruct(invalid{Name: "x", Count: 3})
+	if len(errs) != 2 || errs[0].Code != CodeInvalidRule || errs[1].Code != CodeInvalidRule {
+		t.Fatalf("expected invalid_rule errors, got %+v", errs)
+	}
+
+	if err := CheckValidationTags(&invalid{}); err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("expected the unknown rule to be reported, got %v", err)
+	}
+	if err := CheckValidationTags([]struct {
+		Lines []testLine `json:"lines"`
+	}{}); err != nil {
+		t.Errorf("unexpected error for valid tags: %v", err)
+	}
+	type nested struct {
+		Items []*invalid `json:"items"`
+	}
+	if err := CheckValidationTags(nested{}); err == nil {
+		t.Error("expected tags of nested structs to be checked")
+	}
+}
+
+func TestValidateStructDurations(t *testing.T) {
+	type timeouts struct {
+		Read time.Duration `json:"read" validate:"min=1,max=60"`
+	}
+	if errs := ValidateStruct(timeouts{Read: 30 * time.Second}); errs.HasErrors() {
+		t.Errorf("expected durations compared in seconds, got %+v", errs)
+	}
+	if errs := ValidateStruct(timeouts{Read: 2 * time.Minute}); len(errs) != 1 || errs[0].Code != "max" {
+		t.Errorf("expected max error, got %+v", errs)
+	}
+}
@@ -2,6 +2,7 @@ package aqm
 
 import (
 	"context"
+	"net/url"
 	"regexp"
 	"strings"
 
@@ -110,3 +111,183 @@ func IsInList[T comparable](value T, list []T) bool {
 	}
 	return false
 }
+
+// Validation error codes emitted by the rules below.
+const (
+	CodeRequired       = "required"
+	CodeInvalidEmail   = "invalid_email"
+	CodeInvalidPhone   = "invalid_phone"
+	CodeInvalidURL     = "invalid_url"
+	CodeInvalidCountry = "invalid_country"
+	CodeInvalidLocale  = "invalid_locale"
+)
+
+var (
+	e164Pattern     = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+	phoneStrip      = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "")
+	languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+	regionDigits    = regexp.MustCompile(`^\d{3}$`)
+	countryCodes    = make(map[string]struct{})
+)
+
+// ISO 3166-1 alpha-2 codes.
+const iso3166Alpha2 = "AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ " +
+	"CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR " +
+	"GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP " +
+	"KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT " +
+	"MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW " +
+	"SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG " +
+	"UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW"
+
+func init() {
+	for _, code := range strings.Fields(iso3166Alpha2) {
+		countryCodes[code] = struct{}{}
+	}
+}
+
+// NormalizePhone converts a phone number to E.164 (e.g. "+14155552671"),
+// removing spaces, dashes, dots and parentheses and turning a 00 prefix into
+// "+". Numbers without an international prefix get defaultCallingCode (e.g.
+// "34"), dropping a leading trunk 0. It reports false when the result is not
+// a valid E.164 number.
+func NormalizePhone(value, defaultCallingCode string) (string, bool) {
+	number := phoneStrip.Replace(strings.TrimSpace(value))
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + number[2:]
+	case defaultCallingCode != "":
+		number = "+" + strings.TrimPrefix(defaultCallingCode, "+") + strings.TrimPrefix(number, "0")
+	}
+	if !e164Pattern.MatchString(number) {
+		return "", false
+	}
+	return number, true
+}
+
+// IsPhone checks if a string value is a phone number in E.164 format.
+func IsPhone(value string) bool {
+	if value == "" {
+		return true // Empty string is considered valid if not required
+	}
+	return e164Pattern.MatchString(value)
+}
+
+// IsURL checks if a string value is an absolute URL with a host and one of
+// schemes (http and https when none are given).
+func IsURL(value string, schemes ...string) bool {
+	if value == "" {
+		return true // Empty string is considered valid if not required
+	}
+	u, err := url.Parse(value)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return false
+	}
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeURL lowercases the scheme and host of an absolute URL.
+func NormalizeURL(value string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String(), true
+}
+
+// IsCountryCode checks if a string value is an ISO 3166-1 alpha-2 code. The
+// check is case-insensitive.
+func IsCountryCode(value string) bool {
+	if value == "" {
+		return true // Empty string is considered valid if not required
+	}
+	_, ok := countryCodes[strings.ToUpper(value)]
+	return ok
+}
+
+// IsLocale checks if a string value is a language tag such as "en", "pt-BR"
+// or "es_419": an ISO 639 language optionally followed by an ISO 3166-1
+// country or a UN M.49 region.
+func IsLocale(value string) bool {
+	if value == "" {
+		return true // Empty string is considered valid if not required
+	}
+	language, region, hasRegion := strings.Cut(strings.ReplaceAll(value, "_", "-"), "-")
+	if !languagePattern.MatchString(strings.ToLower(language)) {
+		return false
+	}
+	if !hasRegion {
+		return true
+	}
+	if regionDigits.MatchString(region) {
+		return true
+	}
+	return len(region) == 2 && IsCountryCode(region)
+}
+
+// Rule checks a single field value and returns nil when it is valid.
+type Rule func(field, value string) *ValidationError
+
+// Check runs rules against value in order and collects their errors. A
+// failing Required rule stops the chain so empty values only report once.
+func Check(field, value string, rules ...Rule) ValidationErrors {
+	var errs ValidationErrors
+	for _, rule := range rules {
+		if err := rule(field, value); err != nil {
+			errs = append(errs, *err)
+			if err.Code == CodeRequired {
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func rule(ok func(string) bool, code, message string) Rule {
+	return func(field, value string) *ValidationError {
+		if ok(value) {
+			return nil
+		}
+		return &ValidationError{Field: field, Code: code, Message: message}
+	}
+}
+
+// Required fails on empty or whitespace-only values.
+func Required() Rule {
+	return rule(IsRequired, CodeRequired, "Field is required")
+}
+
+// Email fails on values that are not email addresses.
+func Email() Rule {
+	return rule(IsEmail, CodeInvalidEmail, "Must be a valid email address")
+}
+
+// Phone fails on values that are not E.164 phone numbers.
+func Phone() Rule {
+	return rule(IsPhone, CodeInvalidPhone, "Must be a phone number in international format, e.g. +14155552671")
+}
+
+// URL fails on values that are not absolute URLs using one of schemes.
+func URL(schemes ...string) Rule {
+	return rule(func(v string) bool { return IsURL(v, schemes...) }, CodeInvalidURL, "Must be a valid absolute URL")
+}
+
+// CountryCode fails on values that are not ISO 3166-1 alpha-2 codes.
+func CountryCode() Rule {
+	return rule(IsCountryCode, CodeInvalidCountry, "Must be a two-letter ISO country code")
+}
+
+// Locale fails on values that are not language tags such as en-US.
+func Locale() Rule {
+	return rule(IsLocale, CodeInvalidLocale, "Must be a locale such as en or en-US")
+}
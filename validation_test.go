@@ -249,3 +249,110 @@ func TestIsInList(t *testing.T) {
 		}
 	})
 }
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		cc     string
+		want   string
+		wantOK bool
+	}{
+		{"e164", "+14155552671", "", "+14155552671", true},
+		{"formatted", "+1 (415) 555-2671", "", "+14155552671", true},
+		{"double zero prefix", "0034 612 345 678", "", "+34612345678", true},
+		{"national with trunk zero", "0612 345 678", "34", "+34612345678", true},
+		{"national without default", "612345678", "", "", false},
+		{"too short", "+12345", "", "", false},
+		{"letters", "+1415CALLME", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizePhone(tt.value, tt.cc)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizePhone(%q, %q) = %q, %v, want %q, %v", tt.value, tt.cc, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		schemes  []string
+		expected bool
+	}{
+		{"empty", "", nil, true},
+		{"https", "https://example.com/path?q=1", nil, true},
+		{"relative", "/path", nil, false},
+		{"no host", "http://", nil, false},
+		{"scheme not allowed", "ftp://example.com", nil, false},
+		{"custom scheme", "ftp://example.com", []string{"ftp"}, true},
+		{"javascript", "javascript:alert(1)", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsURL(tt.value, tt.schemes...); got != tt.expected {
+				t.Errorf("IsURL(%q) = %v, want %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+
+	if got, ok := NormalizeURL("HTTPS://Example.COM/Path"); !ok || got != "https://example.com/Path" {
+		t.Errorf("NormalizeURL = %q, %v", got, ok)
+	}
+}
+
+func TestIsCountryCodeAndLocale(t *testing.T) {
+	tests := []struct {
+		value   string
+		country bool
+		locale  bool
+	}{
+		{"ES", true, true},
+		{"us", true, true},
+		{"XX1", false, false},
+		{"en-US", false, true},
+		{"pt_BR", false, true},
+		{"es-419", false, true},
+		{"en-XX", false, false},
+		{"english", false, false},
+	}
+	for _, tt := range tests {
+		if got := IsCountryCode(tt.value); got != tt.country {
+			t.Errorf("IsCountryCode(%q) = %v, want %v", tt.value, got, tt.country)
+		}
+		if got := IsLocale(tt.value); got != tt.locale {
+			t.Errorf("IsLocale(%q) = %v, want %v", tt.value, got, tt.locale)
+		}
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		rules []Rule
+		codes []string
+	}{
+		{"valid", "+14155552671", []Rule{Required(), Phone()}, nil},
+		{"required stops chain", "", []Rule{Required(), Phone()}, []string{CodeRequired}},
+		{"optional empty", "", []Rule{URL()}, nil},
+		{"invalid url", "not a url", []Rule{URL()}, []string{CodeInvalidURL}},
+		{"several", "zz", []Rule{CountryCode(), Locale(), Email()}, []string{CodeInvalidCountry, CodeInvalidEmail}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Check("field", tt.value, tt.rules...)
+			if len(errs) != len(tt.codes) {
+				t.Fatalf("expected codes %v, got %v", tt.codes, errs)
+			}
+			for i, code := range tt.codes {
+				if errs[i].Code != code || errs[i].Field != "field" {
+					t.Errorf("error %d: expected %q on field, got %+v", i, code, errs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultWarmupTimeout = 30 * time.Second
+
+// Warmable is implemented by modules that prime caches, compile templates or
+// open connections before taking traffic. Warmup runs after the runners
+// started and before /readyz reports ready.
+type Warmable interface {
+	Warmup(ctx context.Context) error
+}
+
+type warmupRegistration struct {
+	name    string
+	fn      func(context.Context) error
+	timeout time.Duration
+}
+
+// WithWarmup registers fn to run once the service started, before it is
+// reported ready. A zero timeout falls back to warmup.timeout (default 30s).
+// Failures and timeouts are logged and do not keep the service unready:
+// warming up is an optimisation, readiness checks guard real dependencies.
+func WithWarmup(name string, timeout time.Duration, fn func(context.Context) error) Option {
+	return func(ms *Micro) error {
+		if fn == nil {
+			return errors.New("nil warmup function provided")
+		}
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.addWarmup(name, timeout, fn)
+		return nil
+	}
+}
+
+// addWarmup queues a warmup. Callers hold ms.mu.
+func (ms *Micro) addWarmup(name string, timeout time.Duration, fn func(context.Context) error) {
+	ms.warmups = append(ms.warmups, warmupRegistration{name: name, fn: fn, timeout: timeout})
+	ms.warmupPending.Store(true)
+}
+
+// WarmedUp reports whether every registered warmup finished. It is true when
+// none were registered.
+func (ms *Micro) WarmedUp() bool {
+	return !ms.warmupPending.Load()
+}
+
+// warmupReadiness is the readiness check failing while warmups run.
+func (ms *Micro) warmupReadiness(context.Context) error {
+	if !ms.WarmedUp() {
+		return errors.New("warming up")
+	}
+	return nil
+}
+
+// runWarmups runs the warmups one after the other, each bounded by its
+// timeout, logging progress, and then marks the service warm.
+func (ms *Micro) runWarmups(ctx context.Context, warmups []warmupRegistration) {
+	defer ms.warmupPending.Store(false)
+	if len(warmups) == 0 {
+		return
+	}
+
+	log := ms.Deps().Logger
+	defaultTimeout := ms.Deps().Config.GetDurationOrDef("warmup.timeout", defaultWarmupTimeout)
+	start := time.Now()
+	log.Info("warmup started", "count", len(warmups))
+	for i, w := range warmups {
+		if ctx.Err() != nil {
+			return
+		}
+		timeout := w.timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		stepCtx, cancel := context.WithTimeout(ctx, timeout)
+		stepStart := time.Now()
+		err := runWarmup(stepCtx, w.fn)
+		cancel()
+		progress := fmt.Sprintf("%d/%d", i+1, len(warmups))
+		if err != nil {
+			log.Error("warmup failed", "name", w.name, "progress", progress, "duration", time.Since(stepStart), "error", err)
+			continue
+		}
+		log.Info("warmup finished", "name", w.name, "progress", progress, "duration", time.Since(stepStart))
+	}
+	log.Info("warmup complete", "duration", time.Since(start))
+}
+
+// runWarmup returns when fn does or ctx expires, whichever comes first, so a
+// warmup ignoring its context cannot hold readiness back.
+func runWarmup(ctx context.Context, fn func(context.Context) error) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("panic: %v", rec)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
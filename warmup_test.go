@@ -0,0 +1,94 @@
+package aqm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type warmModule struct {
+	release chan struct{}
+}
+
+func (m *warmModule) RegisterRoutes(chi.Router) {}
+
+func (m *warmModule) Warmup(ctx context.Context) error {
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func readyz(ms *Micro) int {
+	rec := httptest.NewRecorder()
+	ms.httpRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code
+}
+
+func TestWarmupGatesReadiness(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Set("http.port", ":0")
+	cfg.Set("health.cache_ttl", "0s")
+	module := &warmModule{release: make(chan struct{})}
+	var failed, hung atomic.Bool
+	ms := NewMicro(
+		WithConfig(cfg),
+		WithLogger(NewNoopLogger()),
+		WithHTTPServerModules("http.port", module),
+		WithWarmup("fails", time.Second, func(context.Context) error {
+			failed.Store(true)
+			return errors.New("cache unreachable")
+		}),
+		WithWarmup("hangs", 10*time.Millisecond, func(context.Context) error {
+			hung.Store(true)
+			select {}
+		}),
+	)
+	if ms.WarmedUp() {
+		t.Fatal("expected warmups pending")
+	}
+	if code := readyz(ms); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz before warmup: %d", code)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ms.runWarmups(context.Background(), ms.warmups)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if ms.WarmedUp() {
+		t.Fatal("warmed up before the module finished")
+	}
+	close(module.release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("warmups did not finish")
+	}
+
+	if !failed.Load() || !hung.Load() {
+		t.Error("expected every warmup to run")
+	}
+	if code := readyz(ms); code != http.StatusOK {
+		t.Errorf("readyz after warmup: %d", code)
+	}
+}
+
+func TestWarmupNoneRegistered(t *testing.T) {
+	ms := NewMicro(WithConfig(NewConfig()), WithLogger(NewNoopLogger()))
+	if !ms.WarmedUp() {
+		t.Error("expected ready without warmups")
+	}
+	if err := WithWarmup("nil", 0, nil)(ms); err == nil {
+		t.Error("expected error for nil warmup")
+	}
+}
@@ -0,0 +1,296 @@
+// Package watchdog samples goroutine count, heap usage and scheduler latency,
+// warns when they cross configured thresholds and captures pprof profiles to
+// blob storage so a leak or stall can be diagnosed after the fact.
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultBasePath = "/debug/watchdog"
+	profileType     = "application/octet-stream"
+	maxCaptures     = 20
+	captureTimeout  = time.Minute
+)
+
+// captureProfiles are written on every capture.
+var captureProfiles = []string{"goroutine", "heap", "allocs", "block", "mutex"}
+
+// Config holds the thresholds. Zero thresholds are not checked. It binds
+// from config, e.g. watchdog.FromConfig(cfg, "watchdog").
+type Config struct {
+	// Interval between samples.
+	Interval time.Duration `koanf:"interval" default:"15s"`
+	// Goroutines is the goroutine count to warn above.
+	Goroutines int `koanf:"goroutines"`
+	// HeapBytes is the in-use heap size to warn above.
+	HeapBytes uint64 `koanf:"heap_bytes"`
+	// Latency is the scheduling delay of a fresh goroutine to warn above.
+	Latency time.Duration `koanf:"latency"`
+	// Cooldown is the minimum time between two profile captures.
+	Cooldown time.Duration `koanf:"cooldown" default:"10m"`
+	// Prefix is the blob key prefix profiles are written under.
+	Prefix string `koanf:"prefix" default:"diagnostics"`
+}
+
+// FromConfig binds Config from the config subtree at path.
+func FromConfig(cfg *aqm.Config, path string) (Config, error) {
+	return aqm.BindEnv[Config](cfg, path)
+}
+
+// Stats is one sample.
+type Stats struct {
+	Goroutines  int           `json:"goroutines"`
+	HeapBytes   uint64        `json:"heap_bytes"`
+	HeapObjects uint64        `json:"heap_objects"`
+	NumGC       uint32        `json:"num_gc"`
+	Latency     time.Duration `json:"latency_ns"`
+	SampledAt   time.Time     `json:"sampled_at"`
+	Breaches    []string      `json:"breaches,omitempty"`
+}
+
+// Watchdog samples the runtime on an interval. It implements aqm.Runner and
+// aqm.HTTPModule; register it with aqm.WithRunner and mount it next to the
+// other debug routes.
+type Watchdog struct {
+	cfg      Config
+	blob     storage.Blob
+	basePath string
+	log      aqm.Logger
+	now      func() time.Time
+
+	mu          sync.Mutex
+	last        Stats
+	lastCapture time.Time
+	captures    []string
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// Option configures a Watchdog.
+type Option func(*Watchdog)
+
+// WithBlob enables profile captures into blob.
+func WithBlob(blob storage.Blob) Option {
+	return func(w *Watchdog) {
+		w.blob = blob
+	}
+}
+
+// WithBasePath overrides the stats endpoint (defaults to /debug/watchdog).
+func WithBasePath(base string) Option {
+	return func(w *Watchdog) {
+		if base != "" {
+			w.basePath = "/" + strings.Trim(base, "/")
+		}
+	}
+}
+
+// WithLogger wires a custom logger.
+func WithLogger(logger aqm.Logger) Option {
+	return func(w *Watchdog) {
+		if logger != nil {
+			w.log = logger
+		}
+	}
+}
+
+// New returns a Watchdog checking the thresholds of cfg.
+func New(cfg Config, opts ...Option) *Watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Prefix = strings.Trim(cfg.Prefix, "/"); cfg.Prefix == "" {
+		cfg.Prefix = "diagnostics"
+	}
+	w := &Watchdog{
+		cfg:      cfg,
+		basePath: defaultBasePath,
+		log:      aqm.NewNoopLogger(),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(w)
+		}
+	}
+	return w
+}
+
+// Name implements aqm.NamedRunner.
+func (w *Watchdog) Name() string {
+	return "watchdog"
+}
+
+// Check takes a sample, logs a warning per crossed threshold and captures
+// profiles when any was crossed and the cooldown elapsed. A capture runs
+// detached from ctx cancellation, bounded by its own timeout, so a shutdown
+// does not leave a partial profile set behind.
+func (w *Watchdog) Check(ctx context.Context) Stats {
+	stats := w.sample()
+	if w.cfg.Goroutines > 0 && stats.Goroutines > w.cfg.Goroutines {
+		stats.Breaches = append(stats.Breaches, "goroutines")
+		w.log.Warn("watchdog: goroutine threshold crossed", "goroutines", stats.Goroutines, "threshold", w.cfg.Goroutines)
+	}
+	if w.cfg.HeapBytes > 0 && stats.HeapBytes > w.cfg.HeapBytes {
+		stats.Breaches = append(stats.Breaches, "heap")
+		w.log.Warn("watchdog: heap threshold crossed", "heap_bytes", stats.HeapBytes, "threshold", w.cfg.HeapBytes)
+	}
+	if w.cfg.Latency > 0 && stats.Latency > w.cfg.Latency {
+		stats.Breaches = append(stats.Breaches, "latency")
+		w.log.Warn("watchdog: scheduler latency threshold crossed", "latency", stats.Latency, "threshold", w.cfg.Latency)
+	}
+
+	w.mu.Lock()
+	w.last = stats
+	capture := len(stats.Breaches) > 0 && w.blob != nil &&
+		(w.lastCapture.IsZero() || stats.SampledAt.Sub(w.lastCapture) >= w.cfg.Cooldown)
+	if capture {
+		w.lastCapture = stats.SampledAt
+	}
+	w.mu.Unlock()
+
+	if capture {
+		captureCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), captureTimeout)
+		defer cancel()
+		if err := w.capture(captureCtx, stats); err != nil {
+			w.log.Error("watchdog: profile capture failed", "error", err)
+		}
+	}
+	return stats
+}
+
+// Stats returns the latest sample and the key prefixes of the recent
+// captures.
+func (w *Watchdog) Stats() (Stats, []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last, append([]string(nil), w.captures...)
+}
+
+func (w *Watchdog) sample() Stats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return Stats{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapBytes:   mem.HeapInuse,
+		HeapObjects: mem.HeapObjects,
+		NumGC:       mem.NumGC,
+		Latency:     schedulerLatency(),
+		SampledAt:   w.now().UTC(),
+	}
+}
+
+// schedulerLatency measures how long a new goroutine waits before it runs,
+// which grows when the scheduler is saturated or stalled.
+func schedulerLatency() time.Duration {
+	start := time.Now()
+	ran := make(chan time.Time, 1)
+	go func() { ran <- time.Now() }()
+	return (<-ran).Sub(start)
+}
+
+// capture writes every profile under prefix/<timestamp>/<name>.pb.gz.
+func (w *Watchdog) capture(ctx context.Context, stats Stats) error {
+	dir := w.cfg.Prefix + "/" + stats.SampledAt.Format("20060102T150405.000Z")
+	for _, name := range captureProfiles {
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := profile.WriteTo(&buf, 0); err != nil {
+			return fmt.Errorf("writing %s profile: %w", name, err)
+		}
+		if _, err := w.blob.Put(ctx, dir+"/"+name+".pb.gz", &buf, profileType); err != nil {
+			return fmt.Errorf("storing %s profile: %w", name, err)
+		}
+	}
+	w.log.Info("watchdog: profiles captured", "prefix", dir, "breaches", strings.Join(stats.Breaches, ","))
+
+	w.mu.Lock()
+	w.captures = append(w.captures, dir)
+	if len(w.captures) > maxCaptures {
+		w.captures = w.captures[len(w.captures)-maxCaptures:]
+	}
+	w.mu.Unlock()
+	return nil
+}
+
+// RegisterRoutes implements aqm.HTTPModule.
+func (w *Watchdog) RegisterRoutes(r chi.Router) {
+	if r == nil {
+		return
+	}
+	r.Get(w.basePath, w.handleStats)
+}
+
+func (w *Watchdog) handleStats(rw http.ResponseWriter, r *http.Request) {
+	last, captures := w.Stats()
+	if last.SampledAt.IsZero() {
+		last = w.sample()
+	}
+	aqm.Respond(rw, http.StatusOK, map[string]any{
+		"stats":      last,
+		"thresholds": w.cfg,
+		"captures":   captures,
+	}, nil)
+}
+
+// Start launches the sampling loop.
+func (w *Watchdog) Start(context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		return nil
+	}
+	w.stop, w.done = make(chan struct{}), make(chan struct{})
+	go w.loop(w.stop, w.done)
+	return nil
+}
+
+// Stop halts the sampling loop, waiting for an in-flight capture to finish
+// until ctx expires.
+func (w *Watchdog) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	stop, done := w.stop, w.done
+	w.stop, w.done = nil, nil
+	w.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Watchdog) loop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.Check(context.Background())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aquamarinepk/aqm"
+	"github.com/aquamarinepk/aqm/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCheckCapturesOnBreach(t *testing.T) {
+	blob := storage.NewMemoryBlob()
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	w := New(Config{Goroutines: 1, Cooldown: time.Minute}, WithBlob(blob))
+	w.now = func() time.Time { return now }
+
+	stats := w.Check(context.Background())
+	if len(stats.Breaches) != 1 || stats.Breaches[0] != "goroutines" {
+		t.Fatalf("unexpected breaches %v", stats.Breaches)
+	}
+	for _, name := range []string{"goroutine", "heap"} {
+		if _, obj, err := blob.Get(context.Background(), "diagnostics/20260501T100000.000Z/"+name+".pb.gz"); err != nil || obj.Size == 0 {
+			t.Errorf("%s profile not captured: %v", name, err)
+		}
+	}
+
+	now = now.Add(30 * time.Second)
+	w.Check(context.Background())
+	if _, captures := w.Stats(); len(captures) != 1 {
+		t.Errorf("expected cooldown to hold the second capture, got %v", captures)
+	}
+	now = now.Add(time.Minute)
+	w.Check(context.Background())
+	if _, captures := w.Stats(); len(captures) != 2 {
+		t.Errorf("expected a capture after the cooldown, got %v", captures)
+	}
+}
+
+type blockingBlob struct {
+	*storage.MemoryBlob
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	ctxErr  chan error
+}
+
+func (b *blockingBlob) Put(ctx context.Context, key string, r io.Reader, contentType string) (storage.Object, error) {
+	b.once.Do(func() {
+		close(b.started)
+		<-b.release
+		b.ctxErr <- ctx.Err()
+	})
+	return b.MemoryBlob.Put(ctx, key, r, contentType)
+}
+
+func TestStopWaitsForCapture(t *testing.T) {
+	blob := &blockingBlob{
+		MemoryBlob: storage.NewMemoryBlob(),
+		started:    make(chan struct{}),
+		release:    make(chan struct{}),
+		ctxErr:     make(chan error, 1),
+	}
+	w := New(Config{Interval: time.Millisecond, Goroutines: 1, Cooldown: time.Hour}, WithBlob(blob))
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	<-blob.started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- w.Stop(context.Background()) }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned during a capture: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(blob.release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := <-blob.ctxErr; err != nil {
+		t.Errorf("capture context was cancelled: %v", err)
+	}
+	if _, captures := w.Stats(); len(captures) != 1 {
+		t.Errorf("expected the capture to complete, got %v", captures)
+	}
+}
+
+func TestCheckWithinThresholds(t *testing.T) {
+	blob := storage.NewMemoryBlob()
+	w := New(Config{Goroutines: 1 << 20, HeapBytes: 1 << 40, Latency: time.Minute}, WithBlob(blob))
+	if stats := w.Check(context.Background()); len(stats.Breaches) != 0 || stats.Goroutines == 0 || stats.HeapBytes == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, captures := w.Stats(); len(captures) != 0 {
+		t.Errorf("unexpected captures %v", captures)
+	}
+}
+
+func TestStatsEndpointAndConfig(t *testing.T) {
+	cfg := aqm.NewConfig()
+	cfg.MergeNested(map[string]any{"watchdog": map[string]any{"goroutines": 5000, "heap_bytes": 1 << 30}})
+	c, err := FromConfig(cfg, "watchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Goroutines != 5000 || c.Interval != 15*time.Second || c.Cooldown != 10*time.Minute || c.Prefix != "diagnostics" {
+		t.Fatalf("unexpected config %+v", c)
+	}
+
+	w := New(c)
+	if err := w.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop(context.Background())
+
+	r := chi.NewRouter()
+	w.RegisterRoutes(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/watchdog", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var body struct {
+		Data struct {
+			Stats Stats `json:"stats"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.Stats.Goroutines == 0 {
+		t.Errorf("expected live stats, got %s", rec.Body)
+	}
+}
@@ -0,0 +1,520 @@
+package aqm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultWebhookMaxBodyBytes int64 = 1 << 20
+
+var (
+	// ErrWebhookSignature is returned when a webhook signature is missing or invalid.
+	ErrWebhookSignature = errors.New("webhook: invalid signature")
+	// ErrWebhookTimestamp is returned when a signed timestamp falls outside the tolerance window.
+	ErrWebhookTimestamp = errors.New("webhook: timestamp outside tolerance")
+	// ErrWebhookNoHandler is returned when no handler is registered for an event type.
+	ErrWebhookNoHandler = errors.New("webhook: no handler registered")
+)
+
+// WebhookEvent is the provider-agnostic representation of an inbound webhook.
+type WebhookEvent struct {
+	ID         string
+	Type       string
+	Payload    []byte
+	Headers    http.Header
+	ReceivedAt time.Time
+}
+
+// Decode unmarshals the raw payload into the provided target.
+func (e WebhookEvent) Decode(target any) error {
+	return json.Unmarshal(e.Payload, target)
+}
+
+// WebhookVerifier authenticates an inbound request and extracts the event
+// identity from it. Implementations must not consume the request body; the raw
+// payload is provided separately.
+type WebhookVerifier interface {
+	Verify(r *http.Request, body []byte) (WebhookEvent, error)
+}
+
+// WebhookVerifierFunc adapts a function into a WebhookVerifier.
+type WebhookVerifierFunc func(r *http.Request, body []byte) (WebhookEvent, error)
+
+func (f WebhookVerifierFunc) Verify(r *http.Request, body []byte) (WebhookEvent, error) {
+	return f(r, body)
+}
+
+// HMACVerifier validates generic HMAC signatures sent as hex digests in a
+// request header (e.g. X-Signature: sha256=abcdef...).
+type HMACVerifier struct {
+	Secret     []byte
+	Header     string
+	Prefix     string
+	Hash       func() hash.Hash
+	IDHeader   string
+	TypeHeader string
+}
+
+// NewHMACVerifier builds a SHA-256 HMAC verifier reading the signature from
+// header. The secret is required.
+func NewHMACVerifier(secret []byte, header string) (*HMACVerifier, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("webhook: hmac secret is required")
+	}
+	return &HMACVerifier{
+		Secret:     secret,
+		Header:     header,
+		Hash:       sha256.New,
+		IDHeader:   "X-Webhook-ID",
+		TypeHeader: "X-Webhook-Event",
+	}, nil
+}
+
+// Verify implements WebhookVerifier.
+func (v *HMACVerifier) Verify(r *http.Request, body []byte) (WebhookEvent, error) {
+	header := v.Header
+	if header == "" {
+		header = "X-Signature"
+	}
+	hashFn := v.Hash
+	if hashFn == nil {
+		hashFn = sha256.New
+	}
+	sig := strings.TrimPrefix(strings.TrimSpace(r.Header.Get(header)), v.Prefix)
+	if sig == "" || !validHMAC(hashFn, v.Secret, body, sig) {
+		return WebhookEvent{}, ErrWebhookSignature
+	}
+	event := WebhookEvent{
+		ID:      r.Header.Get(v.IDHeader),
+		Type:    r.Header.Get(v.TypeHeader),
+		Payload: body,
+		Headers: r.Header.Clone(),
+	}
+	if event.ID == "" {
+		sum := sha256.Sum256(body)
+		event.ID = hex.EncodeToString(sum[:])
+	}
+	return event, nil
+}
+
+// GitHubVerifier validates X-Hub-Signature-256 headers sent by GitHub. The
+// legacy SHA-1 X-Hub-Signature header is not accepted.
+type GitHubVerifier struct {
+	Secret []byte
+}
+
+// NewGitHubVerifier builds a verifier for GitHub webhooks. The secret is
+// required.
+func NewGitHubVerifier(secret []byte) (*GitHubVerifier, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("webhook: github secret is required")
+	}
+	return &GitHubVerifier{Secret: secret}, nil
+}
+
+// Verify implements WebhookVerifier.
+func (v *GitHubVerifier) Verify(r *http.Request, body []byte) (WebhookEvent, error) {
+	sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok || !validHMAC(sha256.New, v.Secret, body, sig) {
+		return WebhookEvent{}, ErrWebhookSignature
+	}
+	return WebhookEvent{
+		ID:      r.Header.Get("X-GitHub-Delivery"),
+		Type:    r.Header.Get("X-GitHub-Event"),
+		Payload: body,
+		Headers: r.Header.Clone(),
+	}, nil
+}
+
+// StripeVerifier validates Stripe-Signature headers (t=<ts>,v1=<sig>) and
+// rejects events whose timestamp is more than Tolerance in the past or the
+// future.
+type StripeVerifier struct {
+	Secret    []byte
+	Tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewStripeVerifier builds a verifier for Stripe webhooks using the default
+// five minute tolerance. The secret is required.
+func NewStripeVerifier(secret []byte) (*StripeVerifier, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("webhook: stripe secret is required")
+	}
+	return &StripeVerifier{Secret: secret, Tolerance: 5 * time.Minute}, nil
+}
+
+// Verify implements WebhookVerifier.
+func (v *StripeVerifier) Verify(r *http.Request, body []byte) (WebhookEvent, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return WebhookEvent{}, ErrWebhookSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return WebhookEvent{}, ErrWebhookSignature
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	if v.Tolerance > 0 {
+		if age := now().Sub(time.Unix(ts, 0)); age > v.Tolerance || age < -v.Tolerance {
+			return WebhookEvent{}, ErrWebhookTimestamp
+		}
+	}
+
+	signed := append([]byte(timestamp+"."), body...)
+	valid := false
+	for _, sig := range signatures {
+		if validHMAC(sha256.New, v.Secret, signed, sig) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return WebhookEvent{}, ErrWebhookSignature
+	}
+
+	var envelope struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return WebhookEvent{}, fmt.Errorf("webhook: decode stripe event: %w", err)
+	}
+	return WebhookEvent{
+		ID:      envelope.ID,
+		Type:    envelope.Type,
+		Payload: body,
+		Headers: r.Header.Clone(),
+	}, nil
+}
+
+// validHMAC never accepts a signature made with an empty secret, which
+// verifiers built without their constructor would otherwise allow.
+func validHMAC(hashFn func() hash.Hash, secret, body []byte, signature string) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(hashFn, secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// WebhookHandlerFunc processes a verified webhook event.
+type WebhookHandlerFunc func(ctx context.Context, event WebhookEvent) error
+
+// WebhookRouter dispatches events to handlers registered by event type.
+type WebhookRouter struct {
+	mu       sync.RWMutex
+	handlers map[string]WebhookHandlerFunc
+	fallback WebhookHandlerFunc
+}
+
+// NewWebhookRouter constructs an empty router.
+func NewWebhookRouter() *WebhookRouter {
+	return &WebhookRouter{handlers: map[string]WebhookHandlerFunc{}}
+}
+
+// On registers a handler for the given event type.
+func (wr *WebhookRouter) On(eventType string, handler WebhookHandlerFunc) *WebhookRouter {
+	if eventType == "" || handler == nil {
+		return wr
+	}
+	wr.mu.Lock()
+	wr.handlers[eventType] = handler
+	wr.mu.Unlock()
+	return wr
+}
+
+// OnWebhookTyped registers a handler that receives the payload decoded into T.
+func OnWebhookTyped[T any](wr *WebhookRouter, eventType string, handler func(ctx context.Context, event WebhookEvent, payload T) error) *WebhookRouter {
+	if handler == nil {
+		return wr
+	}
+	return wr.On(eventType, func(ctx context.Context, event WebhookEvent) error {
+		var payload T
+		if err := event.Decode(&payload); err != nil {
+			return fmt.Errorf("webhook: decode %s payload: %w", eventType, err)
+		}
+		return handler(ctx, event, payload)
+	})
+}
+
+// Fallback registers a handler for events without a dedicated handler.
+func (wr *WebhookRouter) Fallback(handler WebhookHandlerFunc) *WebhookRouter {
+	wr.mu.Lock()
+	wr.fallback = handler
+	wr.mu.Unlock()
+	return wr
+}
+
+// Dispatch routes the event to its handler.
+func (wr *WebhookRouter) Dispatch(ctx context.Context, event WebhookEvent) error {
+	wr.mu.RLock()
+	handler, ok := wr.handlers[event.Type]
+	if !ok {
+		handler = wr.fallback
+	}
+	wr.mu.RUnlock()
+	if handler == nil {
+		return fmt.Errorf("%w: %s", ErrWebhookNoHandler, event.Type)
+	}
+	return handler(ctx, event)
+}
+
+// WebhookDedupStore remembers processed event IDs so retried deliveries are
+// acknowledged without being processed twice.
+type WebhookDedupStore interface {
+	// MarkSeen records the ID and reports whether it was seen for the first time.
+	MarkSeen(ctx context.Context, id string) (bool, error)
+	// Forget drops the ID after the event could not be handed off, so the
+	// provider's retry is processed instead of discarded as a duplicate.
+	Forget(ctx context.Context, id string) error
+}
+
+// MemoryWebhookStore is an in-process WebhookDedupStore that forgets IDs after ttl.
+type MemoryWebhookStore struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[string]time.Time
+}
+
+// NewMemoryWebhookStore builds an in-memory dedup store. A ttl of zero keeps
+// IDs for 24 hours.
+func NewMemoryWebhookStore(ttl time.Duration) *MemoryWebhookStore {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &MemoryWebhookStore{ttl: ttl, seen: map[string]time.Time{}}
+}
+
+// MarkSeen implements WebhookDedupStore.
+func (s *MemoryWebhookStore) MarkSeen(_ context.Context, id string) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, expires := range s.seen {
+		if now.After(expires) {
+			delete(s.seen, key)
+		}
+	}
+	if _, ok := s.seen[id]; ok {
+		return false, nil
+	}
+	s.seen[id] = now.Add(s.ttl)
+	return true, nil
+}
+
+// Forget implements WebhookDedupStore.
+func (s *MemoryWebhookStore) Forget(_ context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.seen, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// WebhookQueue runs event processing outside the request goroutine so the
+// provider receives a fast acknowledgement.
+type WebhookQueue interface {
+	Enqueue(ctx context.Context, task func(context.Context) error) error
+}
+
+type goroutineQueue struct {
+	reporter ErrorReporter
+}
+
+func (q goroutineQueue) Enqueue(ctx context.Context, task func(context.Context) error) error {
+	go func() {
+		if err := task(ctx); err != nil {
+			q.reporter.Report(ctx, err, map[string]any{"component": "webhook"})
+		}
+	}()
+	return nil
+}
+
+// WebhookOption customises the webhook handler.
+type WebhookOption func(*webhookHandler)
+
+// WithWebhookMaxBodyBytes caps the accepted payload size (defaults to 1MiB).
+func WithWebhookMaxBodyBytes(n int64) WebhookOption {
+	return func(h *webhookHandler) {
+		if n > 0 {
+			h.maxBody = n
+		}
+	}
+}
+
+// WithWebhookDedupStore enables event ID deduplication.
+func WithWebhookDedupStore(store WebhookDedupStore) WebhookOption {
+	return func(h *webhookHandler) {
+		h.store = store
+	}
+}
+
+// WithWebhookQueue overrides where events are processed after the fast ack.
+func WithWebhookQueue(queue WebhookQueue) WebhookOption {
+	return func(h *webhookHandler) {
+		if queue != nil {
+			h.queue = queue
+		}
+	}
+}
+
+// WithWebhookSync processes events inline and only acknowledges after the
+// handler succeeds, letting the provider retry failures.
+func WithWebhookSync() WebhookOption {
+	return func(h *webhookHandler) {
+		h.sync = true
+	}
+}
+
+// WithWebhookErrorReporter forwards asynchronous processing failures.
+func WithWebhookErrorReporter(reporter ErrorReporter) WebhookOption {
+	return func(h *webhookHandler) {
+		if reporter != nil {
+			h.reporter = reporter
+		}
+	}
+}
+
+type webhookHandler struct {
+	verifier WebhookVerifier
+	router   *WebhookRouter
+	maxBody  int64
+	store    WebhookDedupStore
+	queue    WebhookQueue
+	reporter ErrorReporter
+	sync     bool
+}
+
+// WebhookHandler returns an http.Handler that verifies, deduplicates and
+// dispatches inbound webhooks. By default events are acknowledged with 202
+// before processing happens asynchronously through the configured queue.
+func WebhookHandler(verifier WebhookVerifier, router *WebhookRouter, opts ...WebhookOption) http.Handler {
+	h := &webhookHandler{
+		verifier: verifier,
+		router:   router,
+		maxBody:  defaultWebhookMaxBodyBytes,
+		reporter: NoopErrorReporter{},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(h)
+		}
+	}
+	if h.router == nil {
+		h.router = NewWebhookRouter()
+	}
+	if h.queue == nil {
+		h.queue = goroutineQueue{reporter: h.reporter}
+	}
+	return h
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondError(w, http.StatusMethodNotAllowed, "webhooks must be delivered via POST")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBody))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			RespondError(w, http.StatusRequestEntityTooLarge, "webhook payload too large")
+			return
+		}
+		RespondError(w, http.StatusBadRequest, "cannot read webhook payload")
+		return
+	}
+
+	if h.verifier == nil {
+		RespondError(w, http.StatusInternalServerError, "webhook verifier not configured")
+		return
+	}
+	event, err := h.verifier.Verify(r, body)
+	if err != nil {
+		RespondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	event.ReceivedAt = time.Now().UTC()
+
+	ctx := r.Context()
+	if h.store != nil && event.ID != "" {
+		first, err := h.store.MarkSeen(ctx, event.ID)
+		if err != nil {
+			h.reporter.Report(ctx, err, map[string]any{"component": "webhook", "event_id": event.ID})
+			RespondError(w, http.StatusServiceUnavailable, "webhook dedup store unavailable")
+			return
+		}
+		if !first {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	if h.sync {
+		if err := h.router.Dispatch(ctx, event); err != nil {
+			h.reporter.Report(ctx, err, map[string]any{"component": "webhook", "event_id": event.ID, "event_type": event.Type})
+			h.forget(ctx, event.ID)
+			RespondError(w, http.StatusInternalServerError, "webhook processing failed")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	taskCtx := context.WithoutCancel(ctx)
+	if err := h.queue.Enqueue(taskCtx, func(ctx context.Context) error {
+		return h.router.Dispatch(ctx, event)
+	}); err != nil {
+		h.reporter.Report(ctx, err, map[string]any{"component": "webhook", "event_id": event.ID, "event_type": event.Type})
+		h.forget(ctx, event.ID)
+		RespondError(w, http.StatusServiceUnavailable, "webhook queue unavailable")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// forget releases an event ID marked by ServeHTTP whose processing did not
+// start, so the provider's retry is not answered as a duplicate.
+func (h *webhookHandler) forget(ctx context.Context, id string) {
+	if h.store == nil || id == "" {
+		return
+	}
+	if err := h.store.Forget(ctx, id); err != nil {
+		h.reporter.Report(ctx, err, map[string]any{"component": "webhook", "event_id": id})
+	}
+}
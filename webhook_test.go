@@ -0,0 +1,344 @@
+package aqm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signHex(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHMACVerifier(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"hello":"world"}`)
+	verifier, err := NewHMACVerifier(secret, "X-Signature")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	verifier.Prefix = "sha256="
+
+	tests := []struct {
+		name    string
+		sig     string
+		wantErr bool
+	}{
+		{name: "valid", sig: "sha256=" + signHex(secret, body)},
+		{name: "invalid", sig: "sha256=" + signHex([]byte("other"), body), wantErr: true},
+		{name: "missing", sig: "", wantErr: true},
+		{name: "notHex", sig: "sha256=zz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+			req.Header.Set("X-Signature", tt.sig)
+			req.Header.Set("X-Webhook-Event", "thing.created")
+			event, err := verifier.Verify(req, body)
+			if tt.wantErr {
+				if !errors.Is(err, ErrWebhookSignature) {
+					t.Fatalf("expected ErrWebhookSignature, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if event.Type != "thing.created" {
+				t.Errorf("expected type thing.created, got %q", event.Type)
+			}
+			if event.ID == "" {
+				t.Error("expected ID derived from payload hash")
+			}
+		})
+	}
+}
+
+func TestGitHubVerifier(t *testing.T) {
+	secret := []byte("gh")
+	body := []byte(`{"action":"opened"}`)
+	req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+signHex(secret, body))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-GitHub-Delivery", "delivery-1")
+
+	verifier, err := NewGitHubVerifier(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event, err := verifier.Verify(req, body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.ID != "delivery-1" || event.Type != "pull_request" {
+		t.Errorf("unexpected event identity: %+v", event)
+	}
+
+	req.Header.Set("X-Hub-Signature-256", "sha256=00")
+	if _, err := verifier.Verify(req, body); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("expected ErrWebhookSignature, got %v", err)
+	}
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(body)
+	req.Header.Del("X-Hub-Signature-256")
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	if _, err := verifier.Verify(req, body); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("expected the sha1 signature to be rejected, got %v", err)
+	}
+}
+
+func TestWebhookVerifiersRequireSecret(t *testing.T) {
+	if _, err := NewHMACVerifier(nil, "X-Signature"); err == nil {
+		t.Error("expected an error for an empty hmac secret")
+	}
+	if _, err := NewGitHubVerifier([]byte{}); err == nil {
+		t.Error("expected an error for an empty github secret")
+	}
+	if _, err := NewStripeVerifier(nil); err == nil {
+		t.Error("expected an error for an empty stripe secret")
+	}
+
+	body := []byte(`{}`)
+	req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+signHex(nil, body))
+	if _, err := (&GitHubVerifier{}).Verify(req, body); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("expected a signature made without a secret to be rejected, got %v", err)
+	}
+}
+
+func TestStripeVerifier(t *testing.T) {
+	secret := []byte("whsec")
+	body := []byte(`{"id":"evt_1","type":"invoice.paid"}`)
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := signHex(secret, []byte(ts+"."+string(body)))
+
+	verifier, err := NewStripeVerifier(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	verifier.now = func() time.Time { return now }
+
+	req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+	req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%s,v1=%s", ts, sig))
+	event, err := verifier.Verify(req, body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != "invoice.paid" {
+		t.Errorf("unexpected event identity: %+v", event)
+	}
+
+	verifier.now = func() time.Time { return now.Add(10 * time.Minute) }
+	if _, err := verifier.Verify(req, body); !errors.Is(err, ErrWebhookTimestamp) {
+		t.Errorf("expected ErrWebhookTimestamp, got %v", err)
+	}
+
+	verifier.now = func() time.Time { return now.Add(-10 * time.Minute) }
+	if _, err := verifier.Verify(req, body); !errors.Is(err, ErrWebhookTimestamp) {
+		t.Errorf("expected a future timestamp to be rejected, got %v", err)
+	}
+}
+
+func TestWebhookRouterDispatch(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	var got string
+	router := NewWebhookRouter()
+	OnWebhookTyped(router, "named", func(_ context.Context, _ WebhookEvent, p payload) error {
+		got = p.Name
+		return nil
+	})
+
+	if err := router.Dispatch(context.Background(), WebhookEvent{Type: "named", Payload: []byte(`{"name":"aqm"}`)}); err != nil {
+		t.Fatalf("dispatch error: %v", err)
+	}
+	if got != "aqm" {
+		t.Errorf("expected typed payload aqm, got %q", got)
+	}
+
+	if err := router.Dispatch(context.Background(), WebhookEvent{Type: "unknown"}); !errors.Is(err, ErrWebhookNoHandler) {
+		t.Errorf("expected ErrWebhookNoHandler, got %v", err)
+	}
+
+	router.Fallback(func(context.Context, WebhookEvent) error { return nil })
+	if err := router.Dispatch(context.Background(), WebhookEvent{Type: "unknown"}); err != nil {
+		t.Errorf("expected fallback to handle event, got %v", err)
+	}
+}
+
+func TestMemoryWebhookStore(t *testing.T) {
+	store := NewMemoryWebhookStore(time.Minute)
+	ctx := context.Background()
+
+	first, _ := store.MarkSeen(ctx, "a")
+	second, _ := store.MarkSeen(ctx, "a")
+	if !first || second {
+		t.Errorf("expected first=true second=false, got %v %v", first, second)
+	}
+
+	_ = store.Forget(ctx, "a")
+	again, _ := store.MarkSeen(ctx, "a")
+	if !again {
+		t.Error("expected forgotten ID to be processed again")
+	}
+}
+
+type webhookQueueFunc func(ctx context.Context, task func(context.Context) error) error
+
+func (f webhookQueueFunc) Enqueue(ctx context.Context, task func(context.Context) error) error {
+	return f(ctx, task)
+}
+
+func TestWebhookHandler(t *testing.T) {
+	secret := []byte("s3cret")
+	body := `{"ok":true}`
+	verifier, err := NewHMACVerifier(secret, "X-Signature")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	newRequest := func(sig string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+		req.Header.Set("X-Signature", sig)
+		req.Header.Set("X-Webhook-ID", "evt-1")
+		req.Header.Set("X-Webhook-Event", "ping")
+		return req
+	}
+
+	t.Run("asyncAck", func(t *testing.T) {
+		done := make(chan WebhookEvent, 1)
+		router := NewWebhookRouter().On("ping", func(_ context.Context, e WebhookEvent) error {
+			done <- e
+			return nil
+		})
+		handler := WebhookHandler(verifier, router)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(signHex(secret, []byte(body))))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", rec.Code)
+		}
+		select {
+		case e := <-done:
+			if e.ID != "evt-1" {
+				t.Errorf("expected evt-1, got %q", e.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler was not invoked")
+		}
+	})
+
+	t.Run("badSignature", func(t *testing.T) {
+		handler := WebhookHandler(verifier, NewWebhookRouter())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("deadbeef"))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("tooLarge", func(t *testing.T) {
+		handler := WebhookHandler(verifier, NewWebhookRouter(), WithWebhookMaxBodyBytes(4))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(signHex(secret, []byte(body))))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d", rec.Code)
+		}
+	})
+
+	t.Run("dedupAndSync", func(t *testing.T) {
+		calls := 0
+		router := NewWebhookRouter().On("ping", func(context.Context, WebhookEvent) error {
+			calls++
+			return nil
+		})
+		handler := WebhookHandler(verifier, router,
+			WithWebhookSync(),
+			WithWebhookDedupStore(NewMemoryWebhookStore(time.Minute)),
+		)
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newRequest(signHex(secret, []byte(body))))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rec.Code)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("expected a single dispatch, got %d", calls)
+		}
+	})
+
+	t.Run("syncFailureAllowsRetry", func(t *testing.T) {
+		calls := 0
+		router := NewWebhookRouter().On("ping", func(context.Context, WebhookEvent) error {
+			calls++
+			return errors.New("boom")
+		})
+		handler := WebhookHandler(verifier, router,
+			WithWebhookSync(),
+			WithWebhookDedupStore(NewMemoryWebhookStore(time.Minute)),
+		)
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newRequest(signHex(secret, []byte(body))))
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("expected 500, got %d", rec.Code)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("expected retry to be dispatched, got %d calls", calls)
+		}
+	})
+
+	t.Run("enqueueFailureAllowsRetry", func(t *testing.T) {
+		calls := 0
+		failing := true
+		queue := webhookQueueFunc(func(ctx context.Context, task func(context.Context) error) error {
+			if failing {
+				return errors.New("queue full")
+			}
+			calls++
+			return task(ctx)
+		})
+		handler := WebhookHandler(verifier, NewWebhookRouter().On("ping", func(context.Context, WebhookEvent) error { return nil }),
+			WithWebhookQueue(queue),
+			WithWebhookDedupStore(NewMemoryWebhookStore(time.Minute)),
+		)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(signHex(secret, []byte(body))))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", rec.Code)
+		}
+
+		failing = false
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(signHex(secret, []byte(body))))
+		if rec.Code != http.StatusAccepted || calls != 1 {
+			t.Fatalf("expected the retry to be enqueued, got %d with %d calls", rec.Code, calls)
+		}
+	})
+
+	t.Run("methodNotAllowed", func(t *testing.T) {
+		handler := WebhookHandler(verifier, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hook", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+	})
+}